@@ -2,25 +2,69 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"reflect"
+	"sort"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/bendiamant/leash-gateway/internal/admin"
 	"github.com/bendiamant/leash-gateway/internal/config"
+	"github.com/bendiamant/leash-gateway/internal/correlation"
+	"github.com/bendiamant/leash-gateway/internal/deadletter"
+	"github.com/bendiamant/leash-gateway/internal/envelope"
+	"github.com/bendiamant/leash-gateway/internal/featureflags"
+	"github.com/bendiamant/leash-gateway/internal/health"
+	"github.com/bendiamant/leash-gateway/internal/killswitch"
 	"github.com/bendiamant/leash-gateway/internal/logger"
 	"github.com/bendiamant/leash-gateway/internal/metrics"
+	"github.com/bendiamant/leash-gateway/internal/modulehost"
 	modulelogger "github.com/bendiamant/leash-gateway/internal/modules/core/logger"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/audit"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/clockskew"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/contextwindow"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/conversationlimit"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/costtracker"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/decisionwebhook"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/fingerprint"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/jsonmode"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/modelpolicy"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/moderation"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/postprocess"
 	"github.com/bendiamant/leash-gateway/internal/modules/core/ratelimiter"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/redactionaudit"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/requestvalidator"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/sanitizer"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/securityevents"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/spendforecast"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/tenanthealth"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/toolpolicy"
 	"github.com/bendiamant/leash-gateway/internal/modules/interface"
 	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
 	"github.com/bendiamant/leash-gateway/internal/modules/registry"
+	"github.com/bendiamant/leash-gateway/internal/pricing"
+	"github.com/bendiamant/leash-gateway/internal/providers"
+	"github.com/bendiamant/leash-gateway/internal/providers/base"
+	"github.com/bendiamant/leash-gateway/internal/providers/cache"
+	"github.com/bendiamant/leash-gateway/internal/replay"
+	"github.com/bendiamant/leash-gateway/internal/selftest"
+	"github.com/bendiamant/leash-gateway/internal/tenants"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
 )
 
 const (
@@ -30,6 +74,23 @@ const (
 )
 
 func main() {
+	// `module-host call ...` sends a single request to a running module host
+	if len(os.Args) > 1 && os.Args[1] == "call" {
+		if err := modulehost.RunCall(os.Args[2:], os.Stdout, os.Stderr); err != nil {
+			fmt.Fprintf(os.Stderr, "call failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	// `module-host replay ...` replays captured requests against a module host
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		if err := modulehost.RunReplay(os.Args[2:], os.Stdout, os.Stderr); err != nil {
+			fmt.Fprintf(os.Stderr, "replay failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Initialize logger
 	zapLogger, err := logger.NewLogger(logger.Config{
 		Level:       "info",
@@ -57,50 +118,209 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Create tenant store
+	tenantStore, err := newTenantStore(cfg)
+	if err != nil {
+		logger.Fatalf("Failed to create tenant store: %v", err)
+	}
+	tenantList, err := tenantStore.ListTenants(ctx)
+	if err != nil {
+		logger.Fatalf("Failed to load tenants: %v", err)
+	}
+	logger.Infof("Loaded %d tenants from %s tenant store", len(tenantList), cfg.TenantStore.Backend)
+
+	// Known tenants keep their metric label; others are collapsed per policy
+	if err := metricsRegistry.SetTenantLabelPolicy(tenantLabelPolicy(cfg.Observability.Metrics.TenantLabels, tenantList)); err != nil {
+		logger.Fatalf("Invalid tenant label policy: %v", err)
+	}
+
+	// Tenant IDs in logs, metric labels and annotations can be replaced by
+	// pseudonyms, resolvable only through the authorized admin lookup
+	var tenantAnonymizer *tenants.Anonymizer
+	if anonymization := cfg.Security.TenantAnonymization; anonymization.Enabled {
+		tenantAnonymizer, err = tenants.NewAnonymizer(anonymization.Salt, anonymization.LookupTokenSHA256)
+		if err != nil {
+			logger.Fatalf("Invalid tenant anonymization: %v", err)
+		}
+		metricsRegistry.SetTenantAnonymizer(tenantAnonymizer.TenantID)
+	}
+
 	// Create module registry and pipeline
 	moduleRegistry := registry.NewModuleRegistry(logger)
+	if err := moduleRegistry.SetDuplicatePolicy(cfg.ModuleHost.DuplicateModule); err != nil {
+		logger.Fatalf("Invalid duplicate module policy: %v", err)
+	}
 	modulePipeline := pipeline.NewPipeline(logger)
+	// A replaced module leaves the pipeline before it is stopped
+	moduleRegistry.SetReplaceHook(func(old, replacement interfaces.Module) error {
+		return modulePipeline.ReplaceModule(replacement)
+	})
+	modulePipeline.SetMetrics(metricsRegistry)
+	modulePipeline.SetSlowRequestThreshold(cfg.ModuleHost.SlowRequestThreshold)
+	modulePipeline.SetDecisionSummary(cfg.ModuleHost.DecisionSummary)
+	modulePipeline.SetAnnotationLimits(pipeline.AnnotationLimits{
+		MaxCount:      cfg.ModuleHost.Annotations.MaxCount,
+		MaxValueBytes: cfg.ModuleHost.Annotations.MaxValueBytes,
+	})
+	// Diffs carry body content, so they are never recorded outside debug mode
+	modulePipeline.SetTransformDiff(cfg.Development.DebugMode && cfg.Development.TransformDiff)
+	modulePipeline.SetBypass(bypassConfig(cfg.Security.TrustedPrincipals))
+	modulePipeline.SetResultCaching(resultCacheTTLs(cfg.Modules))
+	modulePipeline.SetModuleRetries(moduleRetries(cfg.Modules))
+	modulePipeline.SetTimeoutModes(timeoutModes(cfg.Modules))
+	if degraded := cfg.ModuleHost.DegradedMode; degraded.Enabled {
+		modulePipeline.SetDegradedMode(pipeline.DegradedConfig{
+			FailureThreshold: degraded.FailureThreshold,
+			Cooldown:         degraded.Cooldown,
+			NonEssential:     nonEssentialModules(cfg.Modules),
+		})
+	}
+	if deadLetter := cfg.ModuleHost.DeadLetter; deadLetter.Enabled {
+		store, err := deadletter.NewStore(deadLetter.Backend, deadLetter.Path)
+		if err != nil {
+			logger.Fatalf("Failed to create dead-letter store: %v", err)
+		}
+		modulePipeline.SetDeadLetter(store, deadLetter.MaxAttempts)
+		modulePipeline.StartDeadLetterRetry(deadLetter.RetryInterval)
+	}
+
+	// Kill switch rules from config are engaged at startup
+	killSwitch := killswitch.New(cfg.KillSwitch.Message)
+	for _, rule := range cfg.KillSwitch.Rules {
+		engaged := killSwitch.Engage(killswitch.Rule{Tenant: rule.Tenant, Model: rule.Model, Message: rule.Message})
+		logger.Warnf("Kill switch %s engaged from configuration", engaged.ID)
+	}
+	modulePipeline.SetKillSwitch(killSwitch)
+
+	// Replicas share state through one Redis client, created when a module
+	// first needs it
+	var redisClient *redis.Client
+	sharedRedis := func() *redis.Client {
+		if redisClient == nil {
+			redisClient, err = newRedisClient(cfg.Redis)
+			if err != nil {
+				logger.Fatalf("Invalid Redis configuration: %v", err)
+			}
+		}
+		return redisClient
+	}
 
 	// Initialize core modules
+	modelPolicyModule := modelpolicy.NewModelPolicy(logger)
 	rateLimiterModule := ratelimiter.NewRateLimiter(logger)
+	contextWindowModule := contextwindow.NewContextWindow(logger)
+	contextWindowModule.SetMetrics(metricsRegistry)
 	loggerModule := modulelogger.NewLogger(logger)
+	rateLimiterModule.SetTenantAnonymizer(tenantAnonymizer)
+	loggerModule.SetTenantAnonymizer(tenantAnonymizer)
+	var bodyEncryptor *envelope.Encryptor
+	if encryption := cfg.Security.BodyEncryption; encryption.Enabled {
+		keystore, err := bodyKeystore(encryption)
+		if err != nil {
+			logger.Fatalf("Invalid body encryption keys: %v", err)
+		}
+		bodyEncryptor = envelope.NewEncryptor(keystore)
+		loggerModule.SetBodyEncryptor(bodyEncryptor)
+	}
 
-	// Register modules
-	if err := moduleRegistry.Register(rateLimiterModule); err != nil {
-		logger.Fatalf("Failed to register rate limiter module: %v", err)
+	// Register modules and add them to the pipeline
+	if err := addModule(moduleRegistry, modulePipeline, modelPolicyModule); err != nil {
+		logger.Fatalf("Failed to add model policy module: %v", err)
 	}
-	if err := moduleRegistry.Register(loggerModule); err != nil {
-		logger.Fatalf("Failed to register logger module: %v", err)
+	if err := addModule(moduleRegistry, modulePipeline, rateLimiterModule); err != nil {
+		logger.Fatalf("Failed to add rate limiter module: %v", err)
 	}
-
-	// Add modules to pipeline
-	if err := modulePipeline.AddModule(rateLimiterModule); err != nil {
-		logger.Fatalf("Failed to add rate limiter to pipeline: %v", err)
+	if err := addModule(moduleRegistry, modulePipeline, contextWindowModule); err != nil {
+		logger.Fatalf("Failed to add context window module: %v", err)
 	}
-	if err := modulePipeline.AddModule(loggerModule); err != nil {
-		logger.Fatalf("Failed to add logger to pipeline: %v", err)
+	if err := addModule(moduleRegistry, modulePipeline, loggerModule); err != nil {
+		logger.Fatalf("Failed to add logger module: %v", err)
 	}
 
 	// Initialize modules
-	moduleConfig := &interfaces.ModuleConfig{
-		Name:     "rate-limiter",
-		Type:     "policy",
-		Enabled:  true,
-		Priority: 100,
-		Config: map[string]interface{}{
-			"algorithm":     "token_bucket",
-			"default_limit": 1000,
-			"default_window": "1h",
-			"storage":       "memory",
-		},
+	if err := modelPolicyModule.Initialize(ctx, modelPolicyConfig(tenantList)); err != nil {
+		logger.Fatalf("Failed to initialize model policy: %v", err)
 	}
-	if err := rateLimiterModule.Initialize(ctx, moduleConfig); err != nil {
+	if err := modelPolicyModule.Start(ctx); err != nil {
+		logger.Fatalf("Failed to start model policy: %v", err)
+	}
+
+	if err := rateLimiterModule.ValidateConfig(rateLimiterConfig(cfg, tenantList)); err != nil {
+		logger.Fatalf("Invalid rate limiter configuration: %v", err)
+	}
+	if err := rateLimiterModule.Initialize(ctx, rateLimiterConfig(cfg, tenantList)); err != nil {
 		logger.Fatalf("Failed to initialize rate limiter: %v", err)
 	}
+	// With redis storage, instances share the usage they admit; counts
+	// expire a window after their last write
+	if usage := rateLimiterModule.GetConfig().Config; usage["storage"] == "redis" {
+		window, _ := time.ParseDuration(usage["default_window"].(string))
+		rateLimiterModule.SetUsageStore(ratelimiter.NewRedisUsageStore(sharedRedis(), "leash:ratelimit:", window))
+	}
 	if err := rateLimiterModule.Start(ctx); err != nil {
 		logger.Fatalf("Failed to start rate limiter: %v", err)
 	}
 
+	// Context windows come from the providers' model max_tokens
+	if err := contextWindowModule.Initialize(ctx, contextWindowConfig(cfg)); err != nil {
+		logger.Fatalf("Failed to initialize context window: %v", err)
+	}
+	if err := contextWindowModule.Start(ctx); err != nil {
+		logger.Fatalf("Failed to start context window: %v", err)
+	}
+
+	// Model rules and rate limits are rebuilt from the tenant store whenever
+	// its tenants change, so tenants added later are policed without a restart
+	var tenantConfigMu sync.Mutex
+	appliedTenants := tenantList
+	applyTenantConfigs := func(reason string) {
+		tenantConfigMu.Lock()
+		defer tenantConfigMu.Unlock()
+		current, err := tenantStore.ListTenants(ctx)
+		if err != nil {
+			logger.Errorf("Failed to list tenants after %s: %v", reason, err)
+			return
+		}
+		if reflect.DeepEqual(current, appliedTenants) {
+			return
+		}
+		if err := modelPolicyModule.UpdateConfig(ctx, modelPolicyConfig(current)); err != nil {
+			logger.Errorf("Failed to apply model rules after %s: %v", reason, err)
+		}
+		if err := rateLimiterModule.UpdateConfig(ctx, rateLimiterConfig(cfg, current)); err != nil {
+			logger.Errorf("Failed to apply rate limits after %s: %v", reason, err)
+		}
+		appliedTenants = current
+	}
+
+	// Unknown tenants are either rejected or, for requests bearing an
+	// onboarding key, onboarded from the template; an onboarded tenant's
+	// model rules and rate limits reach the policy modules before its first
+	// request is processed
+	if cfg.TenantStore.UnknownTenants == "onboard" {
+		tenantStore = tenants.NewOnboardingStore(tenantStore, cfg.TenantStore, func(tenant *tenants.Tenant) {
+			tenantID := tenantAnonymizer.TenantID(tenant.ID)
+			logger.Infow("Onboarded unknown tenant from template", "tenant", tenantID)
+			metricsRegistry.RecordTenantOnboarded()
+			applyTenantConfigs("onboarding tenant " + tenantID)
+		})
+	}
+
+	if interval := cfg.TenantStore.RefreshInterval; interval > 0 {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					applyTenantConfigs("tenant store refresh")
+				}
+			}
+		}()
+	}
+
 	loggerConfig := &interfaces.ModuleConfig{
 		Name:     "logger",
 		Type:     "sink",
@@ -119,6 +339,475 @@ func main() {
 		logger.Fatalf("Failed to start logger module: %v", err)
 	}
 
+	// Request fingerprints flag clients spanning many tenants or keys
+	if moduleCfg := cfg.Modules["request-fingerprint"]; moduleCfg.Enabled {
+		fingerprintModule := fingerprint.NewRequestFingerprint(logger)
+		fingerprintModule.SetMetrics(metricsRegistry)
+		if err := addModule(moduleRegistry, modulePipeline, fingerprintModule); err != nil {
+			logger.Fatalf("Failed to add request fingerprint module: %v", err)
+		}
+		fingerprintConfig := &interfaces.ModuleConfig{
+			Name:     "request-fingerprint",
+			Type:     "inspector",
+			Enabled:  true,
+			Priority: moduleCfg.Priority,
+			Config:   moduleCfg.Config,
+		}
+		if err := fingerprintModule.Initialize(ctx, fingerprintConfig); err != nil {
+			logger.Fatalf("Failed to initialize request fingerprint module: %v", err)
+		}
+		if err := fingerprintModule.Start(ctx); err != nil {
+			logger.Fatalf("Failed to start request fingerprint module: %v", err)
+		}
+	}
+
+	// Moderation scores request content with a provider moderation API; with
+	// the block action a policy blocks the requests it flags
+	if moduleCfg := cfg.Modules["moderation"]; moduleCfg.Enabled {
+		moderationModule := moderation.NewModeration(logger)
+		moderationModule.SetMetrics(metricsRegistry)
+		moderationModules := []interfaces.Module{moderationModule}
+		moderationConfigs := []*interfaces.ModuleConfig{{
+			Name:     "moderation",
+			Type:     "inspector",
+			Enabled:  true,
+			Priority: moduleCfg.Priority,
+			Config:   moduleCfg.Config,
+		}}
+		if action, _ := moduleCfg.Config["action"].(string); action == moderation.ActionBlock {
+			moderationModules = append(moderationModules, moderation.NewEscalation(logger))
+			moderationConfigs = append(moderationConfigs, &interfaces.ModuleConfig{
+				Name:     "moderation-escalation",
+				Type:     "policy",
+				Enabled:  true,
+				Priority: 250,
+			})
+		}
+		for i, module := range moderationModules {
+			if err := addModule(moduleRegistry, modulePipeline, module); err != nil {
+				logger.Fatalf("Failed to add %s module: %v", module.Name(), err)
+			}
+			if err := module.Initialize(ctx, moderationConfigs[i]); err != nil {
+				logger.Fatalf("Failed to initialize %s module: %v", module.Name(), err)
+			}
+			if err := module.Start(ctx); err != nil {
+				logger.Fatalf("Failed to start %s module: %v", module.Name(), err)
+			}
+		}
+	}
+
+	// Client timestamps outside max_skew, and with a nonce header reused
+	// nonces, are rejected
+	if moduleCfg := cfg.Modules["clock-skew"]; moduleCfg.Enabled {
+		clockSkewModule := clockskew.NewClockSkew(logger)
+		clockSkewConfig := &interfaces.ModuleConfig{
+			Name:     "clock-skew",
+			Type:     "policy",
+			Enabled:  true,
+			Priority: moduleCfg.Priority,
+			Config:   moduleCfg.Config,
+		}
+		if err := clockSkewModule.ValidateConfig(clockSkewConfig); err != nil {
+			logger.Fatalf("Invalid clock skew configuration: %v", err)
+		}
+		if err := addModule(moduleRegistry, modulePipeline, clockSkewModule); err != nil {
+			logger.Fatalf("Failed to add clock skew module: %v", err)
+		}
+		if err := clockSkewModule.Initialize(ctx, clockSkewConfig); err != nil {
+			logger.Fatalf("Failed to initialize clock skew module: %v", err)
+		}
+		if err := clockSkewModule.Start(ctx); err != nil {
+			logger.Fatalf("Failed to start clock skew module: %v", err)
+		}
+	}
+
+	// Requests declaring tools or functions a tenant may not use are blocked
+	if moduleCfg := cfg.Modules["tool-policy"]; moduleCfg.Enabled {
+		toolPolicyModule := toolpolicy.NewToolPolicy(logger)
+		toolPolicyConfig := &interfaces.ModuleConfig{
+			Name:     "tool-policy",
+			Type:     "policy",
+			Enabled:  true,
+			Priority: moduleCfg.Priority,
+			Config:   moduleCfg.Config,
+		}
+		if err := toolPolicyModule.ValidateConfig(toolPolicyConfig); err != nil {
+			logger.Fatalf("Invalid tool policy configuration: %v", err)
+		}
+		if err := addModule(moduleRegistry, modulePipeline, toolPolicyModule); err != nil {
+			logger.Fatalf("Failed to add tool policy module: %v", err)
+		}
+		if err := toolPolicyModule.Initialize(ctx, toolPolicyConfig); err != nil {
+			logger.Fatalf("Failed to initialize tool policy module: %v", err)
+		}
+		if err := toolPolicyModule.Start(ctx); err != nil {
+			logger.Fatalf("Failed to start tool policy module: %v", err)
+		}
+	}
+
+	// Request bodies that fail to parse as their declared JSON, or with
+	// schema_validation the target provider's schema, are rejected with a 400
+	if moduleCfg := cfg.Modules["request-validator"]; moduleCfg.Enabled {
+		requestValidatorModule := requestvalidator.NewRequestValidator(logger)
+		requestValidatorConfig := &interfaces.ModuleConfig{
+			Name:     "request-validator",
+			Type:     "policy",
+			Enabled:  true,
+			Priority: moduleCfg.Priority,
+			Config:   moduleCfg.Config,
+		}
+		if err := requestValidatorModule.ValidateConfig(requestValidatorConfig); err != nil {
+			logger.Fatalf("Invalid request validator configuration: %v", err)
+		}
+		if err := addModule(moduleRegistry, modulePipeline, requestValidatorModule); err != nil {
+			logger.Fatalf("Failed to add request validator module: %v", err)
+		}
+		if err := requestValidatorModule.Initialize(ctx, requestValidatorConfig); err != nil {
+			logger.Fatalf("Failed to initialize request validator module: %v", err)
+		}
+		if err := requestValidatorModule.Start(ctx); err != nil {
+			logger.Fatalf("Failed to start request validator module: %v", err)
+		}
+	}
+
+	// Conversations over max_messages or max_characters are blocked, or
+	// truncated to fit
+	if moduleCfg := cfg.Modules["conversation-limit"]; moduleCfg.Enabled {
+		conversationLimitModule := conversationlimit.NewConversationLimit(logger)
+		conversationLimitConfig := &interfaces.ModuleConfig{
+			Name:     "conversation-limit",
+			Type:     "policy",
+			Enabled:  true,
+			Priority: moduleCfg.Priority,
+			Config:   moduleCfg.Config,
+		}
+		if err := conversationLimitModule.ValidateConfig(conversationLimitConfig); err != nil {
+			logger.Fatalf("Invalid conversation limit configuration: %v", err)
+		}
+		if err := addModule(moduleRegistry, modulePipeline, conversationLimitModule); err != nil {
+			logger.Fatalf("Failed to add conversation limit module: %v", err)
+		}
+		if err := conversationLimitModule.Initialize(ctx, conversationLimitConfig); err != nil {
+			logger.Fatalf("Failed to initialize conversation limit module: %v", err)
+		}
+		if err := conversationLimitModule.Start(ctx); err != nil {
+			logger.Fatalf("Failed to start conversation limit module: %v", err)
+		}
+	}
+
+	// Control characters in request strings are stripped or escaped and
+	// oversized fields truncated before the request is routed
+	if moduleCfg := cfg.Modules["request-sanitizer"]; moduleCfg.Enabled {
+		sanitizerModule := sanitizer.NewSanitizer(logger)
+		sanitizerConfig := &interfaces.ModuleConfig{
+			Name:     "request-sanitizer",
+			Type:     "transformer",
+			Enabled:  true,
+			Priority: moduleCfg.Priority,
+			Config:   moduleCfg.Config,
+		}
+		if err := sanitizerModule.ValidateConfig(sanitizerConfig); err != nil {
+			logger.Fatalf("Invalid request sanitizer configuration: %v", err)
+		}
+		if err := addModule(moduleRegistry, modulePipeline, sanitizerModule); err != nil {
+			logger.Fatalf("Failed to add request sanitizer module: %v", err)
+		}
+		if err := sanitizerModule.Initialize(ctx, sanitizerConfig); err != nil {
+			logger.Fatalf("Failed to initialize request sanitizer module: %v", err)
+		}
+		if err := sanitizerModule.Start(ctx); err != nil {
+			logger.Fatalf("Failed to start request sanitizer module: %v", err)
+		}
+	}
+
+	// Responses to requests asking for JSON output must parse as JSON; others
+	// are retried by the caller or rejected per on_invalid
+	if moduleCfg := cfg.Modules["json-mode"]; moduleCfg.Enabled {
+		jsonModeModule := jsonmode.NewJSONMode(logger)
+		jsonModeConfig := &interfaces.ModuleConfig{
+			Name:     "json-mode",
+			Type:     "transformer",
+			Enabled:  true,
+			Priority: moduleCfg.Priority,
+			Config:   moduleCfg.Config,
+		}
+		if err := jsonModeModule.ValidateConfig(jsonModeConfig); err != nil {
+			logger.Fatalf("Invalid JSON mode configuration: %v", err)
+		}
+		if err := addModule(moduleRegistry, modulePipeline, jsonModeModule); err != nil {
+			logger.Fatalf("Failed to add JSON mode module: %v", err)
+		}
+		if err := jsonModeModule.Initialize(ctx, jsonModeConfig); err != nil {
+			logger.Fatalf("Failed to initialize JSON mode module: %v", err)
+		}
+		if err := jsonModeModule.Start(ctx); err != nil {
+			logger.Fatalf("Failed to start JSON mode module: %v", err)
+		}
+	}
+
+	// Successful JSON responses are rewritten by the configured steps, in order
+	if moduleCfg := cfg.Modules["response-postprocessor"]; moduleCfg.Enabled {
+		postProcessorModule := postprocess.NewPostProcessor(logger)
+		postProcessorConfig := &interfaces.ModuleConfig{
+			Name:     "response-postprocessor",
+			Type:     "transformer",
+			Enabled:  true,
+			Priority: moduleCfg.Priority,
+			Config:   moduleCfg.Config,
+		}
+		if err := postProcessorModule.ValidateConfig(postProcessorConfig); err != nil {
+			logger.Fatalf("Invalid response post-processor configuration: %v", err)
+		}
+		if err := addModule(moduleRegistry, modulePipeline, postProcessorModule); err != nil {
+			logger.Fatalf("Failed to add response post-processor module: %v", err)
+		}
+		if err := postProcessorModule.Initialize(ctx, postProcessorConfig); err != nil {
+			logger.Fatalf("Failed to initialize response post-processor module: %v", err)
+		}
+		if err := postProcessorModule.Start(ctx); err != nil {
+			logger.Fatalf("Failed to start response post-processor module: %v", err)
+		}
+	}
+
+	// The cost tracker records spend and the cost limiter policy blocks
+	// tenants over their limits; with aggregation enabled, limits apply to
+	// global spend shared through Redis
+	var costTrackerModule *costtracker.CostTracker
+	if moduleCfg := cfg.Modules["cost-tracker"]; moduleCfg.Enabled {
+		costTrackerModule = costtracker.NewCostTracker(logger)
+		if aggregation, _ := moduleCfg.Config["aggregation"].(map[string]interface{}); aggregation["enabled"] == true {
+			costTrackerModule.SetAggregationStore(costtracker.NewRedisAggregationStore(sharedRedis(), "leash:cost:"))
+		}
+		costModules := []interfaces.Module{costTrackerModule, costtracker.NewCostLimiter(logger, costTrackerModule)}
+		costConfigs := []*interfaces.ModuleConfig{{
+			Name:     "cost-tracker",
+			Type:     "sink",
+			Enabled:  true,
+			Priority: moduleCfg.Priority,
+			Config:   moduleCfg.Config,
+		}, {
+			Name:     "cost-limiter",
+			Type:     "policy",
+			Enabled:  true,
+			Priority: 150,
+		}}
+		for i, module := range costModules {
+			if err := addModule(moduleRegistry, modulePipeline, module); err != nil {
+				logger.Fatalf("Failed to add %s module: %v", module.Name(), err)
+			}
+			if err := module.Initialize(ctx, costConfigs[i]); err != nil {
+				logger.Fatalf("Failed to initialize %s module: %v", module.Name(), err)
+			}
+			if err := module.Start(ctx); err != nil {
+				logger.Fatalf("Failed to start %s module: %v", module.Name(), err)
+			}
+		}
+	}
+
+	// Each tenant's spend is projected to the end of its budget period, with
+	// an alert once per period when the projection overruns the budget
+	if moduleCfg := cfg.Modules["spend-forecast"]; moduleCfg.Enabled {
+		spendForecastModule := spendforecast.NewSpendForecast(logger)
+		spendForecastModule.SetMetrics(metricsRegistry)
+		if err := addModule(moduleRegistry, modulePipeline, spendForecastModule); err != nil {
+			logger.Fatalf("Failed to add spend forecast module: %v", err)
+		}
+		spendForecastConfig := &interfaces.ModuleConfig{
+			Name:     "spend-forecast",
+			Type:     "sink",
+			Enabled:  true,
+			Priority: moduleCfg.Priority,
+			Config:   moduleCfg.Config,
+		}
+		if err := spendForecastModule.Initialize(ctx, spendForecastConfig); err != nil {
+			logger.Fatalf("Failed to initialize spend forecast module: %v", err)
+		}
+		if err := spendForecastModule.Start(ctx); err != nil {
+			logger.Fatalf("Failed to start spend forecast module: %v", err)
+		}
+	}
+
+	// Tenant health scores are served on the admin endpoints when enabled,
+	// scoring cost-limit proximity from the cost tracker when it runs
+	var tenantHealthModule *tenanthealth.TenantHealth
+	if moduleCfg := cfg.Modules["tenant-health"]; moduleCfg.Enabled {
+		tenantHealthModule = tenanthealth.NewTenantHealth(logger)
+		tenantHealthModule.SetMetrics(metricsRegistry)
+		tenantHealthModule.SetTenantAnonymizer(tenantAnonymizer)
+		if costTrackerModule != nil {
+			tenantHealthModule.SetCostSource(costTrackerModule)
+		}
+		if err := addModule(moduleRegistry, modulePipeline, tenantHealthModule); err != nil {
+			logger.Fatalf("Failed to add tenant health module: %v", err)
+		}
+		tenantHealthConfig := &interfaces.ModuleConfig{
+			Name:     "tenant-health",
+			Type:     "sink",
+			Enabled:  true,
+			Priority: moduleCfg.Priority,
+			Config:   moduleCfg.Config,
+		}
+		if err := tenantHealthModule.Initialize(ctx, tenantHealthConfig); err != nil {
+			logger.Fatalf("Failed to initialize tenant health module: %v", err)
+		}
+		if err := tenantHealthModule.Start(ctx); err != nil {
+			logger.Fatalf("Failed to start tenant health module: %v", err)
+		}
+	}
+
+	// Block, redaction and high-risk decisions are pushed in signed batches
+	// to the configured webhook
+	if moduleCfg := cfg.Modules["decision-webhook"]; moduleCfg.Enabled {
+		decisionWebhookModule := decisionwebhook.NewDecisionWebhook(logger)
+		decisionWebhookModule.SetTenantAnonymizer(tenantAnonymizer)
+		if err := addModule(moduleRegistry, modulePipeline, decisionWebhookModule); err != nil {
+			logger.Fatalf("Failed to add decision webhook module: %v", err)
+		}
+		decisionWebhookConfig := &interfaces.ModuleConfig{
+			Name:     "decision-webhook",
+			Type:     "sink",
+			Enabled:  true,
+			Priority: moduleCfg.Priority,
+			Config:   moduleCfg.Config,
+		}
+		if err := decisionWebhookModule.Initialize(ctx, decisionWebhookConfig); err != nil {
+			logger.Fatalf("Failed to initialize decision webhook module: %v", err)
+		}
+		if err := decisionWebhookModule.Start(ctx); err != nil {
+			logger.Fatalf("Failed to start decision webhook module: %v", err)
+		}
+	}
+
+	// Blocked and flagged requests are kept for security review and served
+	// on the health port when enabled
+	var securityEventsModule *securityevents.SecurityEvents
+	if moduleCfg := cfg.Modules["security-events"]; moduleCfg.Enabled {
+		securityEventsModule = securityevents.NewSecurityEvents(logger)
+		securityEventsModule.SetTenantAnonymizer(tenantAnonymizer)
+		if err := addModule(moduleRegistry, modulePipeline, securityEventsModule); err != nil {
+			logger.Fatalf("Failed to add security events module: %v", err)
+		}
+		securityEventsConfig := &interfaces.ModuleConfig{
+			Name:     "security-events",
+			Type:     "sink",
+			Enabled:  true,
+			Priority: moduleCfg.Priority,
+			Config:   moduleCfg.Config,
+		}
+		if err := securityEventsModule.Initialize(ctx, securityEventsConfig); err != nil {
+			logger.Fatalf("Failed to initialize security events module: %v", err)
+		}
+		if err := securityEventsModule.Start(ctx); err != nil {
+			logger.Fatalf("Failed to start security events module: %v", err)
+		}
+	}
+
+	// The audit trail keeps each field for its retention, purged every
+	// purge_interval; prompts and responses are sealed like logged bodies
+	if moduleCfg := cfg.Modules["audit"]; moduleCfg.Enabled {
+		auditModule := audit.NewAuditor(logger)
+		if bodyEncryptor != nil {
+			auditModule.SetBodyEncryptor(bodyEncryptor)
+		}
+		if err := addModule(moduleRegistry, modulePipeline, auditModule); err != nil {
+			logger.Fatalf("Failed to add audit module: %v", err)
+		}
+		auditConfig := &interfaces.ModuleConfig{
+			Name:     "audit",
+			Type:     "sink",
+			Enabled:  true,
+			Priority: moduleCfg.Priority,
+			Config:   moduleCfg.Config,
+		}
+		if err := auditModule.Initialize(ctx, auditConfig); err != nil {
+			logger.Fatalf("Failed to initialize audit module: %v", err)
+		}
+		if err := auditModule.Start(ctx); err != nil {
+			logger.Fatalf("Failed to start audit module: %v", err)
+		}
+	}
+
+	// Content filter redactions are appended to a compliance trail at path,
+	// or stdout, without the redacted text
+	if moduleCfg := cfg.Modules["redaction-audit"]; moduleCfg.Enabled {
+		redactionAuditModule := redactionaudit.NewRedactionAuditor(logger)
+		redactionAuditModule.SetTenantAnonymizer(tenantAnonymizer)
+		if err := addModule(moduleRegistry, modulePipeline, redactionAuditModule); err != nil {
+			logger.Fatalf("Failed to add redaction audit module: %v", err)
+		}
+		redactionAuditConfig := &interfaces.ModuleConfig{
+			Name:     "redaction-audit",
+			Type:     "sink",
+			Enabled:  true,
+			Priority: moduleCfg.Priority,
+			Config:   moduleCfg.Config,
+		}
+		if err := redactionAuditModule.Initialize(ctx, redactionAuditConfig); err != nil {
+			logger.Fatalf("Failed to initialize redaction audit module: %v", err)
+		}
+		if err := redactionAuditModule.Start(ctx); err != nil {
+			logger.Fatalf("Failed to start redaction audit module: %v", err)
+		}
+	}
+
+	// Initialize providers
+	flags := featureFlags(cfg.FeatureFlags)
+	providerRegistry := providers.NewRegistry(logger)
+	providerRegistry.SetFeatureFlags(flags)
+	providerRegistry.SetMetrics(metricsRegistry)
+	providerRegistry.SetErrorEnvelope(cfg.ModuleHost.ErrorEnvelope)
+	if cfg.ResponseCache.Enabled {
+		responseCache := newResponseCache(cfg, logger)
+		responseCache.SetMetrics(metricsRegistry)
+		responseCache.SetFeatureFlags(flags)
+		providerRegistry.SetResponseCache(responseCache)
+	}
+	if err := providerRegistry.SetRouting(providers.RoutingConfig{
+		Strategy:         cfg.Routing.Strategy,
+		SwitchMargin:     cfg.Routing.SwitchMargin,
+		MinDwell:         cfg.Routing.MinDwell,
+		LatencySmoothing: cfg.Routing.LatencySmoothing,
+		ExploreFraction:  cfg.Routing.ExploreFraction,
+	}); err != nil {
+		logger.Fatalf("Invalid provider routing: %v", err)
+	}
+	if err := providerRegistry.SetClientDeadline(providers.ClientDeadlineConfig{
+		Enabled:    cfg.Routing.ClientDeadline.Enabled,
+		Header:     cfg.Routing.ClientDeadline.Header,
+		MaxTimeout: cfg.Routing.ClientDeadline.MaxTimeout,
+	}); err != nil {
+		logger.Fatalf("Invalid client deadline: %v", err)
+	}
+	configuredProviders := providerConfigs(cfg.Providers)
+
+	// Pricing feed prices replace the configured model prices as they arrive
+	var pricingUpdater *pricing.Updater
+	if cfg.Pricing.Enabled {
+		prices := base.NewPriceTable()
+		for _, providerConfig := range configuredProviders {
+			providerConfig.Prices = prices
+		}
+		pricingUpdater = pricing.NewUpdater(pricing.Config{
+			Source:   cfg.Pricing.Source,
+			Interval: cfg.Pricing.Interval,
+			Timeout:  cfg.Pricing.Timeout,
+			MaxAge:   cfg.Pricing.MaxAge,
+		}, prices, logger)
+		pricingUpdater.SetMetrics(metricsRegistry)
+	}
+	if err := providerRegistry.InitializeFromConfig(configuredProviders); err != nil {
+		logger.Fatalf("Failed to initialize providers: %v", err)
+	}
+	if pricingUpdater != nil {
+		pricingUpdater.Start(ctx)
+	}
+
+	// Startup self-test gates readiness when enabled
+	selfTest := selftest.NewRunner(providerRegistry, modulePipeline, cfg.ModuleHost.SelfTest, logger)
+	if cfg.ModuleHost.Warmup.Enabled {
+		selfTest.SetWarmup(moduleRegistry)
+	}
+
 	// Create module host server
 	moduleHost := &ModuleHostServer{
 		logger:   logger,
@@ -128,22 +817,64 @@ func main() {
 		pipeline: modulePipeline,
 	}
 
+	// Create gRPC server for the ModuleHost service
+	moduleHostService := modulehost.NewService(modulePipeline, logger)
+	moduleHostService.SetErrorEnvelope(cfg.ModuleHost.ErrorEnvelope)
+	moduleHostService.SetTenantAnonymizer(tenantAnonymizer)
+	moduleHostService.SetTenantResolver(tenants.NewResolver(tenantStore, cfg.Security.APIKeys))
+	if err := moduleHostService.SetBypassRoutes(bypassRoutes(cfg.ModuleHost.BypassRoutes)); err != nil {
+		logger.Fatalf("Invalid module host bypass routes: %v", err)
+	}
+	if err := moduleHostService.SetDefaultTenantRoutes(defaultTenantRoutes(cfg.ModuleHost.DefaultTenantRoutes)); err != nil {
+		logger.Fatalf("Invalid module host default tenant routes: %v", err)
+	}
+	if admission := cfg.ModuleHost.Admission; admission.Enabled {
+		if err := moduleHostService.SetAdmission(modulehost.AdmissionConfig{
+			MaxConcurrent: admission.MaxConcurrent,
+			MaxQueue:      admission.MaxQueue,
+			MaxWait:       admission.MaxWait,
+		}); err != nil {
+			logger.Fatalf("Invalid module host admission limits: %v", err)
+		}
+	}
+	var captureFile *os.File
+	if capture := cfg.ModuleHost.Capture; capture.Enabled {
+		captureFile, err = os.OpenFile(capture.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			logger.Fatalf("Failed to open capture file: %v", err)
+		}
+		recorder, err := replay.NewRecorder(captureFile, capture.SampleRate, tenantAnonymizer)
+		if err != nil {
+			logger.Fatalf("Invalid request capture: %v", err)
+		}
+		moduleHostService.SetRecorder(recorder)
+		logger.Infof("Capturing %.2f%% of requests to %s", capture.SampleRate*100, capture.Path)
+	}
+	grpcServer := modulehost.NewGRPCServer(
+		moduleHostService,
+		health.NewServer(),
+		grpc.MaxRecvMsgSize(cfg.ModuleHost.MaxRecvMsgSize),
+		grpc.MaxSendMsgSize(cfg.ModuleHost.MaxSendMsgSize),
+		grpc.KeepaliveParams(cfg.ModuleHost.KeepaliveParams()),
+	)
+
 	// Create HTTP server for simplified implementation
 	httpMux := http.NewServeMux()
 	
 	// Add module host endpoints
-	httpMux.HandleFunc("/process", moduleHost.ProcessRequestHTTP)
+	processHandler := modulehost.NewHTTPHandler(moduleHostService, cfg.ModuleHost.ProtobufEnabled, int64(cfg.ModuleHost.MaxRecvMsgSize))
+	httpMux.Handle("/process", correlation.Middleware(processHandler))
 	httpMux.HandleFunc("/health", moduleHost.HealthHTTP)
-	httpMux.HandleFunc("/modules", moduleHost.ModulesHTTP)
+	httpMux.Handle("/modules", moduleRegistry.ModulesHandler())
 	
-	// Start HTTP server for module processing
+	// Start server for module processing; gRPC and HTTP share the port
 	moduleServer := &http.Server{
 		Addr:    fmt.Sprintf(":%d", cfg.ModuleHost.GRPCPort),
-		Handler: httpMux,
+		Handler: h2c.NewHandler(modulehost.Handler(grpcServer, httpMux), &http2.Server{}),
 	}
 
 	go func() {
-		logger.Infof("Module Host HTTP server listening on port %d", cfg.ModuleHost.GRPCPort)
+		logger.Infof("Module Host gRPC/HTTP server listening on port %d", cfg.ModuleHost.GRPCPort)
 		if err := moduleServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			logger.Errorf("Module Host HTTP server failed: %v", err)
 			cancel()
@@ -152,10 +883,7 @@ func main() {
 
 	// Add metrics and health endpoints to the same server
 	httpMux.Handle("/metrics", promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
-	httpMux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("READY"))
-	})
+	httpMux.HandleFunc("/ready", selfTest.ReadyHTTP)
 
 	// Start health server on separate port
 	healthMux := http.NewServeMux()
@@ -164,10 +892,19 @@ func main() {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	})
-	healthMux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("READY"))
-	})
+	healthMux.HandleFunc("/ready", selfTest.ReadyHTTP)
+	adminAuth := admin.NewTokenAuth(cfg.Security.Admin.TokenSHA256)
+	mountAdmin(healthMux, adminAuth, "/admin/kill-switch", killSwitch.Handler(), logger)
+	mountAdmin(healthMux, adminAuth, "/admin/state", moduleRegistry.StateHandler(), logger)
+	if tenantAnonymizer != nil {
+		healthMux.Handle("/admin/tenant-pseudonyms", tenantAnonymizer.LookupHandler())
+	}
+	if tenantHealthModule != nil {
+		mountAdmin(healthMux, adminAuth, "/admin/tenant-health", tenantHealthModule.Handler(), logger)
+	}
+	if securityEventsModule != nil {
+		mountAdmin(healthMux, adminAuth, "/admin/security-events", securityEventsModule.Handler(), logger)
+	}
 
 	healthServer := &http.Server{
 		Addr:    fmt.Sprintf(":%d", cfg.ModuleHost.HealthPort),
@@ -196,6 +933,19 @@ func main() {
 		}
 	}()
 
+	// Modules warm up while the servers report not ready
+	if cfg.ModuleHost.Warmup.Enabled {
+		go func() {
+			warmupCtx, cancel := context.WithTimeout(ctx, cfg.ModuleHost.Warmup.Timeout)
+			defer cancel()
+			moduleRegistry.Warmup(warmupCtx)
+		}()
+	}
+
+	if cfg.ModuleHost.SelfTest.Enabled {
+		go selfTest.Run(ctx)
+	}
+
 	// Wait for shutdown signal
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -207,16 +957,46 @@ func main() {
 		logger.Info("Context cancelled, shutting down")
 	}
 
-	// Graceful shutdown
+	// Graceful shutdown, in order: stop accepting traffic, drain the
+	// pipeline, stop modules (sinks first so they flush), then providers
 	logger.Info("Shutting down servers...")
 
-	// Shutdown HTTP servers
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer shutdownCancel()
 
 	if err := moduleServer.Shutdown(shutdownCtx); err != nil {
 		logger.Errorf("Module server shutdown error: %v", err)
 	}
+	grpcStopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(grpcStopped)
+	}()
+	select {
+	case <-grpcStopped:
+	case <-shutdownCtx.Done():
+		grpcServer.Stop()
+	}
+
+	if captureFile != nil {
+		captureFile.Close()
+	}
+
+	modulePipeline.StopDeadLetterRetry()
+	if err := modulePipeline.Drain(shutdownCtx); err != nil {
+		logger.Errorf("Pipeline drain error: %v", err)
+	}
+
+	if err := moduleRegistry.Shutdown(shutdownCtx); err != nil {
+		logger.Errorf("Module shutdown error: %v", err)
+	}
+
+	if pricingUpdater != nil {
+		pricingUpdater.Stop()
+	}
+	if err := providerRegistry.Shutdown(); err != nil {
+		logger.Errorf("Provider shutdown error: %v", err)
+	}
 
 	if err := healthServer.Shutdown(shutdownCtx); err != nil {
 		logger.Errorf("Health server shutdown error: %v", err)
@@ -226,50 +1006,434 @@ func main() {
 		logger.Errorf("Metrics server shutdown error: %v", err)
 	}
 
+	if redisClient != nil {
+		redisClient.Close()
+	}
+
 	logger.Info("Module Host shutdown complete")
 }
 
-// ModuleHostServer implements the ModuleHost HTTP service
-type ModuleHostServer struct {
-	logger   *zap.SugaredLogger
-	config   *config.Config
-	metrics  *metrics.Registry
-	registry *registry.ModuleRegistry
-	pipeline *pipeline.Pipeline
+// newTenantStore creates the configured tenant store. The database backend
+// supports the postgres and mysql drivers linked in above.
+func newTenantStore(cfg *config.Config) (tenants.TenantStore, error) {
+	if cfg.TenantStore.Backend != "database" {
+		return tenants.NewConfigStore(cfg.Tenants), nil
+	}
+
+	db, err := sql.Open(cfg.Database.Driver, cfg.Database.URL)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.Database.ConnMaxLifetime)
+	return tenants.NewDBStore(db, cfg.Database.Driver), nil
+}
+
+// newRedisClient creates the Redis client replicas share state through
+func newRedisClient(redisConfig config.RedisConfig) (*redis.Client, error) {
+	options, err := redis.ParseURL(redisConfig.URL)
+	if err != nil {
+		return nil, err
+	}
+	if redisConfig.MaxRetries > 0 {
+		options.MaxRetries = redisConfig.MaxRetries
+	}
+	if redisConfig.RetryDelay > 0 {
+		options.MinRetryBackoff = redisConfig.RetryDelay
+	}
+	if redisConfig.PoolSize > 0 {
+		options.PoolSize = redisConfig.PoolSize
+	}
+	options.MinIdleConns = redisConfig.MinIdleConns
+	return redis.NewClient(options), nil
+}
+
+// modelPolicyConfig builds the model policy module config for the tenants
+func modelPolicyConfig(tenantList []*tenants.Tenant) *interfaces.ModuleConfig {
+	return &interfaces.ModuleConfig{
+		Name:     "model-policy",
+		Type:     "policy",
+		Enabled:  true,
+		Priority: 50,
+		Config: map[string]interface{}{
+			"tenants": tenantModelRules(tenantList),
+		},
+	}
+}
+
+// rateLimiterConfig builds the rate limiter module config from the
+// configured module settings and the tenants' rate limits
+func rateLimiterConfig(cfg *config.Config, tenantList []*tenants.Tenant) *interfaces.ModuleConfig {
+	moduleConfig := map[string]interface{}{
+		"algorithm":      "token_bucket",
+		"default_limit":  1000,
+		"default_window": "1h",
+		"storage":        "memory",
+	}
+	for key, value := range cfg.Modules["rate-limiter"].Config {
+		moduleConfig[key] = value
+	}
+	moduleConfig["tenants"] = tenantRateLimits(tenantList)
+	return &interfaces.ModuleConfig{
+		Name:     "rate-limiter",
+		Type:     "policy",
+		Enabled:  true,
+		Priority: 100,
+		Config:   moduleConfig,
+	}
+}
+
+// contextWindowConfig builds the context window module configuration from
+// provider model limits and the module's configured action
+func contextWindowConfig(cfg *config.Config) *interfaces.ModuleConfig {
+	windows := make(map[string]interface{}, len(cfg.Providers))
+	for name, provider := range cfg.Providers {
+		models := make(map[string]interface{})
+		for _, model := range provider.Models {
+			if model.MaxTokens > 0 {
+				models[model.Name] = model.MaxTokens
+			}
+		}
+		windows[name] = models
+	}
+
+	moduleConfig := map[string]interface{}{"context_windows": windows}
+	if action, ok := cfg.Modules["context-window"].Config["action"].(string); ok {
+		moduleConfig["action"] = action
+	}
+	return &interfaces.ModuleConfig{
+		Name:     "context-window",
+		Type:     "policy",
+		Enabled:  true,
+		Priority: 250,
+		Config:   moduleConfig,
+	}
+}
+
+// tenantModelRules builds the model policy tenant rules from the tenant store
+func tenantModelRules(tenantList []*tenants.Tenant) map[string]interface{} {
+	rules := make(map[string]interface{}, len(tenantList))
+	for _, tenant := range tenantList {
+		if len(tenant.AllowedModels) == 0 && len(tenant.DeniedModels) == 0 {
+			continue
+		}
+		rules[tenant.ID] = map[string]interface{}{
+			"allowed_models": tenant.AllowedModels,
+			"denied_models":  tenant.DeniedModels,
+		}
+	}
+	return rules
+}
+
+// tenantRateLimits builds the rate limiter's per-tenant rules from the
+// tenants' named rate limits
+func tenantRateLimits(tenantList []*tenants.Tenant) map[string]interface{} {
+	limits := make(map[string]interface{}, len(tenantList))
+	for _, tenant := range tenantList {
+		if len(tenant.RateLimits) == 0 {
+			continue
+		}
+		rules := make([]interface{}, 0, len(tenant.RateLimits))
+		for _, limit := range tenant.RateLimits {
+			conditions := make([]interface{}, 0, len(limit.Conditions))
+			for _, condition := range limit.Conditions {
+				conditions = append(conditions, condition)
+			}
+			rules = append(rules, map[string]interface{}{
+				"name":       limit.Name,
+				"limit":      limit.Limit,
+				"window":     limit.Window,
+				"conditions": conditions,
+			})
+		}
+		limits[tenant.ID] = map[string]interface{}{"rate_limits": rules}
+	}
+	return limits
+}
+
+// newResponseCache creates the provider response cache, with an embeddings
+// client for the semantic tier when enabled
+func newResponseCache(cfg *config.Config, logger *zap.SugaredLogger) *cache.Cache {
+	semantic := cfg.ResponseCache.Semantic
+
+	var embedder cache.Embedder
+	if semantic.Enabled {
+		embedding := semantic.Embedding
+		endpoint := embedding.Endpoint
+		if endpoint == "" {
+			endpoint = cfg.Providers[embedding.Provider].Endpoint
+		}
+		headers := map[string]string{}
+		if embedding.APIKeyEnv != "" {
+			headers["Authorization"] = "Bearer " + os.Getenv(embedding.APIKeyEnv)
+		}
+		embedder = cache.NewHTTPEmbedder(endpoint, embedding.Model, headers, embedding.Timeout)
+	}
+
+	return cache.NewCache(cache.Config{
+		TTL:                 cfg.ResponseCache.TTL,
+		MaxEntries:          cfg.ResponseCache.MaxEntries,
+		SemanticEnabled:     semantic.Enabled,
+		SimilarityThreshold: semantic.SimilarityThreshold,
+	}, embedder, logger)
+}
+
+// featureFlags resolves the global feature flags with per-tenant overrides
+func featureFlags(configured config.FeatureFlagsConfig) *featureflags.Set {
+	overrides := make(map[string]featureflags.Overrides, len(configured.Tenants))
+	for tenantID, tenant := range configured.Tenants {
+		overrides[tenantID] = featureflags.Overrides{
+			Streaming:            tenant.EnableStreaming,
+			Caching:              tenant.EnableCaching,
+			RequestSigning:       tenant.EnableRequestSigning,
+			ResponseCompression:  tenant.EnableResponseCompression,
+			RequestDeduplication: tenant.EnableRequestDeduplication,
+		}
+	}
+	return featureflags.New(featureflags.Flags{
+		Streaming:            configured.EnableStreaming,
+		Caching:              configured.EnableCaching,
+		RequestSigning:       configured.EnableRequestSigning,
+		ResponseCompression:  configured.EnableResponseCompression,
+		RequestDeduplication: configured.EnableRequestDeduplication,
+	}, overrides)
+}
+
+// tenantLabelPolicy builds the metrics tenant label policy, allowlisting the
+// configured tenants alongside any listed explicitly
+func tenantLabelPolicy(labels config.TenantLabelsConfig, tenantList []*tenants.Tenant) metrics.TenantLabelPolicy {
+	allowlist := append([]string{}, labels.Allowlist...)
+	for _, tenant := range tenantList {
+		allowlist = append(allowlist, tenant.ID)
+	}
+	return metrics.TenantLabelPolicy{
+		Mode:       labels.Mode,
+		Allowlist:  allowlist,
+		Buckets:    labels.Buckets,
+		OtherLabel: labels.OtherLabel,
+	}
 }
 
-// ProcessRequestHTTP handles HTTP requests for module processing
-func (s *ModuleHostServer) ProcessRequestHTTP(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// addModule registers a module and adds it to the pipeline. A duplicate the
+// registry skips stays out of the pipeline; one replacing a registered module
+// takes that module's place in it.
+func addModule(modules *registry.ModuleRegistry, p *pipeline.Pipeline, module interfaces.Module) error {
+	_, err := modules.Get(module.Name())
+	replacing := err == nil
+	if err := modules.Register(module); errors.Is(err, registry.ErrDuplicateSkipped) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	// The registry's replace hook swapped a replacement into the pipeline
+	if replacing {
+		return nil
+	}
+	return p.AddModule(module)
+}
+
+// mountAdmin serves an admin endpoint behind the admin token, or leaves it
+// unmounted when no token is configured
+func mountAdmin(mux *http.ServeMux, auth *admin.TokenAuth, pattern string, handler http.Handler, logger *zap.SugaredLogger) {
+	if !auth.Enabled() {
+		logger.Warnf("No admin token configured, not serving %s", pattern)
 		return
 	}
+	mux.Handle(pattern, auth.Require(handler))
+}
 
-	start := time.Now()
-	requestID := fmt.Sprintf("req_%d", time.Now().UnixNano())
-	
-	s.logger.Debugf("Processing HTTP request %s", requestID)
+// bypassConfig converts trusted principal configuration into pipeline bypass config
+func bypassConfig(trusted config.TrustedPrincipals) pipeline.BypassConfig {
+	principals := make([]pipeline.TrustedPrincipal, len(trusted.Principals))
+	for i, principal := range trusted.Principals {
+		principals[i] = pipeline.TrustedPrincipal{
+			Name:                  principal.Name,
+			TokenSHA256:           principal.TokenSHA256,
+			BypassModules:         principal.BypassModules,
+			AllowProviderOverride: principal.AllowProviderOverride,
+			AllowDryRun:           principal.AllowDryRun,
+		}
+	}
+	return pipeline.BypassConfig{
+		Header:                 trusted.Header,
+		ProviderOverrideHeader: trusted.ProviderOverrideHeader,
+		DryRunHeader:           trusted.DryRunHeader,
+		Principals:             principals,
+	}
+}
 
-	// For simplified demo, just allow all requests
-	response := map[string]interface{}{
-		"action":             "continue",
-		"processing_time_ms": time.Since(start).Milliseconds(),
-		"annotations": map[string]string{
-			"processed_by": "leash-module-host",
-			"request_id":   requestID,
-		},
-		"metadata": map[string]string{
-			"module_host": "active",
-		},
+// bodyKeystore builds the tenant keystore for body encryption from configuration
+func bodyKeystore(encryption config.BodyEncryptionConfig) (*envelope.StaticKeystore, error) {
+	keys := make(map[string][]envelope.Key, len(encryption.Tenants))
+	for _, tenant := range encryption.Tenants {
+		for _, configured := range tenant.Keys {
+			key, err := envelope.ParseKey(configured.ID, configured.Key)
+			if err != nil {
+				return nil, fmt.Errorf("tenant %s: %w", tenant.Tenant, err)
+			}
+			keys[tenant.Tenant] = append(keys[tenant.Tenant], key)
+		}
 	}
+	return envelope.NewStaticKeystore(keys)
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+// resultCacheTTLs collects the inspectors opted in to result caching
+func resultCacheTTLs(modules map[string]config.Module) map[string]time.Duration {
+	ttls := make(map[string]time.Duration)
+	for name, module := range modules {
+		if module.ResultCacheTTL > 0 {
+			ttls[name] = module.ResultCacheTTL
+		}
+	}
+	return ttls
+}
 
-	s.logger.Debugf("Request %s processed in %dms", requestID, response["processing_time_ms"])
+// moduleRetries collects the modules opted in to retrying failed executions
+func moduleRetries(modules map[string]config.Module) map[string]pipeline.RetryPolicy {
+	policies := make(map[string]pipeline.RetryPolicy)
+	for name, module := range modules {
+		if module.Retry.MaxAttempts > 1 {
+			policies[name] = pipeline.RetryPolicy{
+				MaxAttempts:       module.Retry.MaxAttempts,
+				Backoff:           module.Retry.Backoff,
+				BackoffMultiplier: module.Retry.BackoffMultiplier,
+				MaxBackoff:        module.Retry.MaxBackoff,
+			}
+		}
+	}
+	return policies
+}
+
+// timeoutModes collects the modules overriding their behaviour on timeout
+func timeoutModes(modules map[string]config.Module) map[string]pipeline.TimeoutMode {
+	modes := make(map[string]pipeline.TimeoutMode)
+	for name, module := range modules {
+		if module.OnTimeout != "" {
+			modes[name] = pipeline.TimeoutMode(module.OnTimeout)
+		}
+	}
+	return modes
 }
 
+// nonEssentialModules collects the modules skipped while the pipeline is
+// degraded, sorted
+func nonEssentialModules(modules map[string]config.Module) []string {
+	var names []string
+	for name, module := range modules {
+		if module.NonEssential {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// bypassRoutes converts bypass route configuration into module host routes
+func bypassRoutes(configured []config.BypassRoute) []modulehost.BypassRoute {
+	routes := make([]modulehost.BypassRoute, len(configured))
+	for i, route := range configured {
+		routes[i] = modulehost.BypassRoute{Method: route.Method, Path: route.Path}
+	}
+	return routes
+}
+
+// defaultTenantRoutes converts default tenant route configuration into module host routes
+func defaultTenantRoutes(configured []config.DefaultTenantRoute) []modulehost.DefaultTenantRoute {
+	routes := make([]modulehost.DefaultTenantRoute, len(configured))
+	for i, route := range configured {
+		routes[i] = modulehost.DefaultTenantRoute{Method: route.Method, Path: route.Path, Tenant: route.Tenant}
+	}
+	return routes
+}
+
+// providerConfigs converts provider configuration into provider registry configs
+func providerConfigs(configured map[string]config.Provider) map[string]*base.ProviderConfig {
+	configs := make(map[string]*base.ProviderConfig, len(configured))
+	for name, provider := range configured {
+		models := make([]base.ModelConfig, len(provider.Models))
+		for i, model := range provider.Models {
+			models[i] = base.ModelConfig{
+				Name:                       model.Name,
+				CostPer1kInputTokens:       model.CostPer1kInputTokens,
+				CostPer1kOutputTokens:      model.CostPer1kOutputTokens,
+				CostPer1kCachedInputTokens: model.CostPer1kCachedInputTokens,
+				CostPer1kReasoningTokens:   model.CostPer1kReasoningTokens,
+				Path:                       model.Path,
+				MaxTokens:                  model.MaxTokens,
+				RoutingWeight:              model.RoutingWeight,
+			}
+		}
+
+		configs[name] = &base.ProviderConfig{
+			Name:                    name,
+			Type:                    provider.Type,
+			Endpoint:                provider.Endpoint,
+			Timeout:                 provider.Timeout,
+			RetryAttempts:           provider.RetryAttempts,
+			RetryDelay:              provider.RetryDelay,
+			RetryBackoffMultiplier:  provider.RetryBackoffMultiplier,
+			MaxRetryDelay:           provider.MaxRetryDelay,
+			RetryableStatusCodes:    provider.RetryableStatusCodes,
+			NonRetryableStatusCodes: provider.NonRetryableStatusCodes,
+			CircuitBreaker: base.CircuitBreakerConfig{
+				FailureThreshold: provider.CircuitBreaker.FailureThreshold,
+				SuccessThreshold: provider.CircuitBreaker.SuccessThreshold,
+				Timeout:          provider.CircuitBreaker.Timeout,
+				HalfOpenProbes:   provider.CircuitBreaker.HalfOpenProbes,
+				ErrorSamples:     provider.CircuitBreaker.ErrorSamples,
+			},
+			HealthCheck: base.HealthCheckConfig{
+				Enabled:  provider.HealthCheck.Enabled,
+				Interval: provider.HealthCheck.Interval,
+				Timeout:  provider.HealthCheck.Timeout,
+				Path:     provider.HealthCheck.Path,
+				Method:   provider.HealthCheck.Method,
+				Body:     provider.HealthCheck.Body,
+			},
+			Headers: provider.Headers,
+			Parameters: base.ParameterMapping{
+				Rename:        provider.Parameters.Rename,
+				Unsupported:   provider.Parameters.Unsupported,
+				OnUnsupported: provider.Parameters.OnUnsupported,
+			},
+			TLS: base.TLSConfig{
+				MinVersion:   provider.TLS.MinVersion,
+				PinnedSHA256: provider.TLS.PinnedSHA256,
+				CAFile:       provider.TLS.CAFile,
+			},
+			StreamFormat:      provider.StreamFormat,
+			StreamHeartbeat:   provider.StreamHeartbeat,
+			IdempotencyHeader: provider.IdempotencyHeader,
+			MaxResponseBytes:  provider.MaxResponseBytes,
+			OversizeResponse:  provider.OversizeResponse,
+			TraceHeaders:      provider.TraceHeaders,
+			RequestCompression: base.CompressionConfig{
+				Enabled:  provider.RequestCompression.Enabled,
+				MinBytes: provider.RequestCompression.MinBytes,
+			},
+			StreamIdleTimeout: provider.StreamIdleTimeout,
+			StreamMaxDuration: provider.StreamMaxDuration,
+			Shadow: base.ShadowConfig{
+				Provider: provider.Shadow.Provider,
+				Fraction: provider.Shadow.Fraction,
+				Model:    provider.Shadow.Model,
+				Timeout:  provider.Shadow.Timeout,
+			},
+			Models: models,
+		}
+	}
+	return configs
+}
+
+// ModuleHostServer implements the ModuleHost HTTP service
+type ModuleHostServer struct {
+	logger   *zap.SugaredLogger
+	config   *config.Config
+	metrics  *metrics.Registry
+	registry *registry.ModuleRegistry
+	pipeline *pipeline.Pipeline
+}
 
 // HealthHTTP handles HTTP health checks
 func (s *ModuleHostServer) HealthHTTP(w http.ResponseWriter, r *http.Request) {
@@ -302,6 +1466,7 @@ func (s *ModuleHostServer) HealthHTTP(w http.ResponseWriter, r *http.Request) {
 			"git_commit":      gitCommit,
 			"modules_count":   len(s.registry.List()),
 			"pipeline_status": s.pipeline.GetPipelineStatus(),
+			"degraded_mode":   s.pipeline.DegradedStatus(),
 		},
 	}
 
@@ -313,29 +1478,3 @@ func (s *ModuleHostServer) HealthHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	json.NewEncoder(w).Encode(response)
 }
-
-// ModulesHTTP handles requests for module information
-func (s *ModuleHostServer) ModulesHTTP(w http.ResponseWriter, r *http.Request) {
-	modules := s.registry.List()
-	moduleInfo := make([]map[string]interface{}, len(modules))
-	
-	for i, module := range modules {
-		moduleInfo[i] = map[string]interface{}{
-			"name":        module.Name(),
-			"version":     module.Version(),
-			"type":        module.Type().String(),
-			"description": module.Description(),
-			"status":      module.Status(),
-			"metrics":     module.Metrics(),
-		}
-	}
-
-	response := map[string]interface{}{
-		"modules": moduleInfo,
-		"count":   len(modules),
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
-}
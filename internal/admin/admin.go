@@ -0,0 +1,65 @@
+package admin
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// TokenAuth authorizes requests bearing a token whose SHA-256 is configured.
+// Only the digests are held, so the tokens themselves never appear in config.
+type TokenAuth struct {
+	tokens []string // SHA-256 hex digests of the allowed tokens
+}
+
+// NewTokenAuth creates a token check allowing the tokens whose SHA-256 hex
+// digests are listed; with none, no request is authorized
+func NewTokenAuth(tokenSHA256 []string) *TokenAuth {
+	tokens := make([]string, 0, len(tokenSHA256))
+	for _, token := range tokenSHA256 {
+		if token = strings.ToLower(strings.TrimSpace(token)); token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+	return &TokenAuth{tokens: tokens}
+}
+
+// Enabled reports whether any token is configured
+func (a *TokenAuth) Enabled() bool {
+	return a != nil && len(a.tokens) > 0
+}
+
+// Authorized reports whether a request bears an allowed bearer token
+func (a *TokenAuth) Authorized(r *http.Request) bool {
+	if a == nil {
+		return false
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(token))
+	tokenHash := hex.EncodeToString(sum[:])
+
+	for _, allowed := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(tokenHash), []byte(allowed)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// Require serves next only for requests bearing an allowed token, answering
+// any other request with 401
+func (a *TokenAuth) Require(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.Authorized(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -12,6 +12,8 @@ type CircuitBreaker struct {
 	maxFailures      int
 	minRequests      int
 	resetTimeout     time.Duration
+	maxProbes        int
+	probes           int // probes admitted since entering half-open
 	state            State
 	failures         int
 	requests         int
@@ -19,6 +21,9 @@ type CircuitBreaker struct {
 	lastSuccessTime  time.Time
 	mu               sync.RWMutex
 	onStateChange    func(name string, from State, to State)
+	onTransition     func(Transition)
+	errorSamples     int
+	recentErrors     []ErrorSample // oldest first, at most errorSamples
 }
 
 // State represents circuit breaker state
@@ -49,64 +54,147 @@ type Config struct {
 	MaxFailures      int
 	MinRequests      int
 	ResetTimeout     time.Duration
+	HalfOpenProbes   int // concurrent requests admitted while half-open, default 1
 	OnStateChange    func(name string, from State, to State)
+	OnTransition     func(Transition) // receives each state change with the breaker's stats
+	ErrorSamples     int              // recent errors kept for transitions, default 5
+}
+
+// Transition is a state change of a circuit breaker, with the statistics
+// that led to it
+type Transition struct {
+	Name         string        `json:"name"`
+	From         State         `json:"from"`
+	To           State         `json:"to"`
+	Time         time.Time     `json:"time"`
+	Stats        Stats         `json:"stats"`
+	RecentErrors []ErrorSample `json:"recent_errors,omitempty"`
+}
+
+// ErrorSample is a failed call recorded by a circuit breaker
+type ErrorSample struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error"`
+}
+
+// Fields returns the transition as alternating keys and values for
+// structured logging
+func (t Transition) Fields() []interface{} {
+	errors := make([]string, len(t.RecentErrors))
+	for i, sample := range t.RecentErrors {
+		errors[i] = sample.Error
+	}
+	fields := []interface{}{
+		"breaker", t.Name,
+		"from", t.From.String(),
+		"to", t.To.String(),
+		"failure_rate", t.Stats.FailureRate,
+		"failures", t.Stats.Failures,
+		"requests", t.Stats.Requests,
+		"recent_errors", errors,
+	}
+	if !t.Stats.LastFailureTime.IsZero() {
+		fields = append(fields, "last_failure", t.Stats.LastFailureTime)
+	}
+	if !t.Stats.LastSuccessTime.IsZero() {
+		fields = append(fields, "last_success", t.Stats.LastSuccessTime)
+	}
+	return fields
 }
 
 // NewCircuitBreaker creates a new circuit breaker
 func NewCircuitBreaker(config Config) *CircuitBreaker {
+	maxProbes := config.HalfOpenProbes
+	if maxProbes <= 0 {
+		maxProbes = 1
+	}
+	errorSamples := config.ErrorSamples
+	if errorSamples <= 0 {
+		errorSamples = 5
+	}
+
 	return &CircuitBreaker{
 		name:          config.Name,
 		maxFailures:   config.MaxFailures,
 		minRequests:   config.MinRequests,
 		resetTimeout:  config.ResetTimeout,
+		maxProbes:     maxProbes,
 		state:         StateClosed,
 		onStateChange: config.OnStateChange,
+		onTransition:  config.OnTransition,
+		errorSamples:  errorSamples,
 	}
 }
 
 // Call executes a function with circuit breaker protection
 func (cb *CircuitBreaker) Call(fn func() error) error {
-	if !cb.allowRequest() {
+	allowed, probe := cb.allowRequest()
+	if !allowed {
 		return fmt.Errorf("circuit breaker %s is open", cb.name)
 	}
 
 	err := fn()
-	cb.recordResult(err)
+	cb.recordResult(err, probe)
 	return err
 }
 
-// allowRequest determines if a request should be allowed
-func (cb *CircuitBreaker) allowRequest() bool {
+// allowRequest determines if a request should be allowed and whether it is a
+// half-open probe. While half-open only maxProbes requests are in flight at
+// once; the rest are rejected as if open until a probe resolves.
+func (cb *CircuitBreaker) allowRequest() (bool, bool) {
 	cb.mu.Lock()
 	defer cb.mu.Unlock()
 
 	switch cb.state {
 	case StateClosed:
-		return true
+		return true, false
 	case StateOpen:
 		// Check if we should transition to half-open
 		if time.Since(cb.lastFailureTime) > cb.resetTimeout {
 			cb.setState(StateHalfOpen)
-			return true
+			cb.probes = 1
+			return true, true
 		}
-		return false
+		return false, false
 	case StateHalfOpen:
-		return true
+		if cb.probes < cb.maxProbes {
+			cb.probes++
+			return true, true
+		}
+		return false, false
 	default:
-		return false
+		return false, false
 	}
 }
 
 // recordResult records the result of a request
-func (cb *CircuitBreaker) recordResult(err error) {
+func (cb *CircuitBreaker) recordResult(err error, probe bool) {
 	cb.mu.Lock()
 	defer cb.mu.Unlock()
 
+	if probe && cb.state == StateHalfOpen {
+		// A probe decides the outcome: failure reopens, success closes
+		if err != nil {
+			cb.failures++
+			cb.lastFailureTime = time.Now()
+			cb.sampleError(err)
+			cb.probes = 0
+			cb.setState(StateOpen)
+			return
+		}
+		cb.lastSuccessTime = time.Now()
+		cb.probes = 0
+		cb.setState(StateClosed)
+		cb.reset()
+		return
+	}
+
 	cb.requests++
 
 	if err != nil {
 		cb.failures++
 		cb.lastFailureTime = time.Now()
+		cb.sampleError(err)
 
 		// Check if we should open the circuit
 		if cb.requests >= cb.minRequests {
@@ -117,12 +205,6 @@ func (cb *CircuitBreaker) recordResult(err error) {
 		}
 	} else {
 		cb.lastSuccessTime = time.Now()
-
-		// Check if we should close the circuit (from half-open)
-		if cb.state == StateHalfOpen {
-			cb.setState(StateClosed)
-			cb.reset()
-		}
 	}
 }
 
@@ -135,7 +217,26 @@ func (cb *CircuitBreaker) setState(newState State) {
 		if cb.onStateChange != nil {
 			go cb.onStateChange(cb.name, oldState, newState)
 		}
+		if cb.onTransition != nil {
+			transition := Transition{
+				Name:         cb.name,
+				From:         oldState,
+				To:           newState,
+				Time:         time.Now(),
+				Stats:        cb.stats(),
+				RecentErrors: append([]ErrorSample(nil), cb.recentErrors...),
+			}
+			go cb.onTransition(transition)
+		}
+	}
+}
+
+// sampleError keeps err among the recent errors reported with transitions
+func (cb *CircuitBreaker) sampleError(err error) {
+	if len(cb.recentErrors) >= cb.errorSamples {
+		cb.recentErrors = append(cb.recentErrors[:0], cb.recentErrors[1:]...)
 	}
+	cb.recentErrors = append(cb.recentErrors, ErrorSample{Time: time.Now(), Error: err.Error()})
 }
 
 // reset resets the circuit breaker counters
@@ -155,7 +256,11 @@ func (cb *CircuitBreaker) GetState() State {
 func (cb *CircuitBreaker) GetStats() Stats {
 	cb.mu.RLock()
 	defer cb.mu.RUnlock()
+	return cb.stats()
+}
 
+// stats returns the breaker's statistics. Callers must hold cb.mu.
+func (cb *CircuitBreaker) stats() Stats {
 	var failureRate float64
 	if cb.requests > 0 {
 		failureRate = float64(cb.failures) / float64(cb.requests)
@@ -185,8 +290,9 @@ type Stats struct {
 
 // Manager manages multiple circuit breakers
 type Manager struct {
-	breakers map[string]*CircuitBreaker
-	mu       sync.RWMutex
+	breakers     map[string]*CircuitBreaker
+	onTransition func(Transition)
+	mu           sync.RWMutex
 }
 
 // NewManager creates a new circuit breaker manager
@@ -206,11 +312,28 @@ func (m *Manager) GetOrCreate(name string, config Config) *CircuitBreaker {
 	}
 
 	config.Name = name
+	if managed := m.onTransition; managed != nil {
+		own := config.OnTransition
+		config.OnTransition = func(transition Transition) {
+			managed(transition)
+			if own != nil {
+				own(transition)
+			}
+		}
+	}
 	breaker := NewCircuitBreaker(config)
 	m.breakers[name] = breaker
 	return breaker
 }
 
+// SetOnTransition sets a handler receiving the transitions of every
+// breaker created afterwards, in addition to its own OnTransition
+func (m *Manager) SetOnTransition(onTransition func(Transition)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onTransition = onTransition
+}
+
 // Get gets a circuit breaker by name
 func (m *Manager) Get(name string) (*CircuitBreaker, error) {
 	m.mu.RLock()
@@ -3,8 +3,11 @@ package config
 import (
 	"fmt"
 	"os"
+	"path"
+	"strings"
 	"time"
 
+	"github.com/bendiamant/leash-gateway/internal/providers/base"
 	"github.com/spf13/viper"
 	"google.golang.org/grpc/keepalive"
 )
@@ -17,7 +20,12 @@ type Config struct {
 	Database      DatabaseConfig      `mapstructure:"database"`
 	Redis         RedisConfig         `mapstructure:"redis"`
 	Tenants       map[string]Tenant   `mapstructure:"tenants"`
+	TenantStore   TenantStoreConfig   `mapstructure:"tenant_store"`
 	Providers     map[string]Provider `mapstructure:"providers"`
+	Routing       RoutingConfig       `mapstructure:"routing"`
+	Pricing       PricingConfig       `mapstructure:"pricing"`
+	ResponseCache ResponseCacheConfig `mapstructure:"response_cache"`
+	KillSwitch    KillSwitchConfig    `mapstructure:"kill_switch"`
 	Modules       map[string]Module   `mapstructure:"modules"`
 	Observability ObservabilityConfig `mapstructure:"observability"`
 	Security      SecurityConfig      `mapstructure:"security"`
@@ -45,11 +53,91 @@ type EnvoyConfig struct {
 
 // ModuleHostConfig contains Module Host gRPC service configuration
 type ModuleHostConfig struct {
-	GRPCPort       int                    `mapstructure:"grpc_port"`
-	HealthPort     int                    `mapstructure:"health_port"`
-	MaxRecvMsgSize int                    `mapstructure:"max_recv_msg_size"`
-	MaxSendMsgSize int                    `mapstructure:"max_send_msg_size"`
-	Keepalive      KeepaliveConfig        `mapstructure:"keepalive"`
+	GRPCPort             int                  `mapstructure:"grpc_port"`
+	HealthPort           int                  `mapstructure:"health_port"`
+	MaxRecvMsgSize       int                  `mapstructure:"max_recv_msg_size"`
+	MaxSendMsgSize       int                  `mapstructure:"max_send_msg_size"`
+	Keepalive            KeepaliveConfig      `mapstructure:"keepalive"`
+	SelfTest             SelfTestConfig       `mapstructure:"self_test"`
+	Warmup               WarmupConfig         `mapstructure:"warmup"`
+	ProtobufEnabled      bool                 `mapstructure:"protobuf_enabled"`      // accept application/x-protobuf on the HTTP API
+	BypassRoutes         []BypassRoute        `mapstructure:"bypass_routes"`         // requests answered without running modules
+	DefaultTenantRoutes  []DefaultTenantRoute `mapstructure:"default_tenant_routes"` // tenant assumed for requests without credentials
+	DeadLetter           DeadLetterConfig     `mapstructure:"dead_letter"`
+	Admission            AdmissionConfig      `mapstructure:"admission"`
+	DuplicateModule      string               `mapstructure:"duplicate_module"` // error, replace, skip
+	Capture              CaptureConfig        `mapstructure:"capture"`
+	SlowRequestThreshold time.Duration        `mapstructure:"slow_request_threshold"` // requests slower than this are logged with timings; 0 disables
+	DecisionSummary      bool                 `mapstructure:"decision_summary"`       // attach a consolidated leash_decision annotation to request results
+	Annotations          AnnotationLimits     `mapstructure:"annotations"`
+	DegradedMode         DegradedModeConfig   `mapstructure:"degraded_mode"`
+	ErrorEnvelope        bool                 `mapstructure:"error_envelope"` // answer non-2xx with {"error": {source, code, message}}
+}
+
+// AnnotationLimits caps the annotations modules add to one request; 0 disables a cap
+type AnnotationLimits struct {
+	MaxCount      int `mapstructure:"max_count"`       // annotations per request
+	MaxValueBytes int `mapstructure:"max_value_bytes"` // JSON size of one annotation value
+}
+
+// DegradedModeConfig skips the modules marked non_essential while another
+// module keeps failing, e.g. because a dependency is down
+type DegradedModeConfig struct {
+	Enabled          bool          `mapstructure:"enabled"`
+	FailureThreshold int           `mapstructure:"failure_threshold"` // consecutive failures of one module
+	Cooldown         time.Duration `mapstructure:"cooldown"`          // time without failures before recovering
+}
+
+// CaptureConfig records sampled, anonymized requests and their decisions for
+// replay against another gateway
+type CaptureConfig struct {
+	Enabled    bool    `mapstructure:"enabled"`
+	Path       string  `mapstructure:"path"`        // JSON lines file, appended to
+	SampleRate float64 `mapstructure:"sample_rate"` // fraction of requests captured, in (0, 1]
+}
+
+// AdmissionConfig queues requests by tenant priority when the host is at capacity
+type AdmissionConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	MaxConcurrent int           `mapstructure:"max_concurrent"` // requests run through the pipeline at once
+	MaxQueue      int           `mapstructure:"max_queue"`      // waiting requests before new ones are rejected
+	MaxWait       time.Duration `mapstructure:"max_wait"`       // longest a request waits for capacity; 0 waits indefinitely
+}
+
+// DeadLetterConfig keeps sink events that fail to deliver for replay
+type DeadLetterConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	Backend       string        `mapstructure:"backend"`        // file, memory
+	Path          string        `mapstructure:"path"`           // file backend location
+	RetryInterval time.Duration `mapstructure:"retry_interval"` // background replay interval; 0 disables it
+	MaxAttempts   int           `mapstructure:"max_attempts"`   // replays before an event is parked; 0 is unlimited
+}
+
+// BypassRoute matches requests that skip the module pipeline
+type BypassRoute struct {
+	Method string `mapstructure:"method"` // empty or "*" matches any method
+	Path   string `mapstructure:"path"`   // path.Match pattern, e.g. "/health"; a trailing "/**" matches any depth
+}
+
+// DefaultTenantRoute gives requests without tenant credentials on a route a
+// fixed tenant, e.g. a system tenant for internal callers
+type DefaultTenantRoute struct {
+	Method string `mapstructure:"method"` // as for bypass routes
+	Path   string `mapstructure:"path"`
+	Tenant string `mapstructure:"tenant"`
+}
+
+// SelfTestConfig contains startup self-test configuration
+type SelfTestConfig struct {
+	Enabled     bool          `mapstructure:"enabled"`
+	Timeout     time.Duration `mapstructure:"timeout"`
+	FatalChecks []string      `mapstructure:"fatal_checks"` // providers, provider:<name>, pipeline
+}
+
+// WarmupConfig contains module warmup configuration
+type WarmupConfig struct {
+	Enabled bool          `mapstructure:"enabled"`
+	Timeout time.Duration `mapstructure:"timeout"` // modules still warming after this are left to finish on first use
 }
 
 // KeepaliveConfig contains gRPC keepalive configuration
@@ -88,12 +176,28 @@ type RedisConfig struct {
 
 // Tenant represents a tenant configuration
 type Tenant struct {
-	Name        string               `mapstructure:"name"`
-	Description string               `mapstructure:"description"`
-	Policies    []string             `mapstructure:"policies"`
-	Quotas      TenantQuotas         `mapstructure:"quotas"`
-	RateLimits  []RateLimit          `mapstructure:"rate_limits"`
-	Providers   map[string]Provider  `mapstructure:"providers"`
+	Name          string              `mapstructure:"name"`
+	Description   string              `mapstructure:"description"`
+	Policies      []string            `mapstructure:"policies"`
+	Quotas        TenantQuotas        `mapstructure:"quotas"`
+	RateLimits    []RateLimit         `mapstructure:"rate_limits"`
+	Providers     map[string]Provider `mapstructure:"providers"`
+	AllowedModels []string            `mapstructure:"allowed_models"` // empty allows all models
+	DeniedModels  []string            `mapstructure:"denied_models"`
+	APIKeys       []string            `mapstructure:"api_keys"`
+	Priority      int                 `mapstructure:"priority"` // higher is admitted first when requests queue
+}
+
+// TenantStoreConfig selects where tenants are loaded from and how requests
+// for tenants the store does not know are handled
+type TenantStoreConfig struct {
+	Backend        string   `mapstructure:"backend"`               // config, database
+	UnknownTenants string   `mapstructure:"unknown_tenants"`       // reject, onboard
+	Template       Tenant   `mapstructure:"template"`              // configuration of onboarded tenants
+	OnboardingKeys []string `mapstructure:"onboarding_key_sha256"` // SHA-256 hex digests of the API keys allowed to onboard
+	MaxOnboarded   int      `mapstructure:"max_onboarded"`         // most tenants onboarded at once
+
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"` // how often tenant policies are reloaded; 0 disables
 }
 
 // TenantQuotas represents tenant usage quotas
@@ -113,15 +217,124 @@ type RateLimit struct {
 
 // Provider represents a provider configuration
 type Provider struct {
-	Endpoint                 string                 `mapstructure:"endpoint"`
-	Timeout                  time.Duration          `mapstructure:"timeout"`
-	RetryAttempts           int                    `mapstructure:"retry_attempts"`
-	RetryDelay              time.Duration          `mapstructure:"retry_delay"`
-	RetryBackoffMultiplier  float64                `mapstructure:"retry_backoff_multiplier"`
-	MaxRetryDelay           time.Duration          `mapstructure:"max_retry_delay"`
-	CircuitBreaker          CircuitBreakerConfig   `mapstructure:"circuit_breaker"`
-	HealthCheck             HealthCheckConfig      `mapstructure:"health_check"`
-	Models                  []ModelConfig          `mapstructure:"models"`
+	Type                    string               `mapstructure:"type"` // openai, anthropic; defaults to the provider name
+	Endpoint                string               `mapstructure:"endpoint"`
+	Timeout                 time.Duration        `mapstructure:"timeout"`
+	RetryAttempts           int                  `mapstructure:"retry_attempts"`
+	RetryDelay              time.Duration        `mapstructure:"retry_delay"`
+	RetryBackoffMultiplier  float64              `mapstructure:"retry_backoff_multiplier"`
+	MaxRetryDelay           time.Duration        `mapstructure:"max_retry_delay"`
+	RetryableStatusCodes    []int                `mapstructure:"retryable_status_codes"`
+	NonRetryableStatusCodes []int                `mapstructure:"non_retryable_status_codes"`
+	CircuitBreaker          CircuitBreakerConfig `mapstructure:"circuit_breaker"`
+	HealthCheck             HealthCheckConfig    `mapstructure:"health_check"`
+	Headers                 map[string]string    `mapstructure:"headers"` // values may be templates, e.g. "{{.Model}}"
+	Parameters              ParameterMapping     `mapstructure:"parameters"`
+	TLS                     ProviderTLSConfig    `mapstructure:"tls"`
+	Shadow                  ShadowConfig         `mapstructure:"shadow"`
+	StreamFormat            string               `mapstructure:"stream_format"`      // passthrough (default), canonical
+	StreamHeartbeat         time.Duration        `mapstructure:"stream_heartbeat"`   // keepalive comment after this long without stream data; 0 disables
+	IdempotencyHeader       string               `mapstructure:"idempotency_header"` // header carrying a key reused across retries; empty sends none
+	MaxResponseBytes        int64                `mapstructure:"max_response_bytes"` // largest non-streaming body buffered; 0 is unlimited
+	OversizeResponse        string               `mapstructure:"oversize_response"`  // error (default), stream
+	TraceHeaders            []string             `mapstructure:"trace_headers"`      // upstream correlation headers captured and returned as X-Leash-Provider-<name>
+	RequestCompression      CompressionConfig    `mapstructure:"request_compression"`
+	StreamIdleTimeout       time.Duration        `mapstructure:"stream_idle_timeout"`
+	StreamMaxDuration       time.Duration        `mapstructure:"stream_max_duration"`
+	Models                  []ModelConfig        `mapstructure:"models"`
+}
+
+// CompressionConfig gzips large request bodies for providers accepting Content-Encoding: gzip
+type CompressionConfig struct {
+	Enabled  bool `mapstructure:"enabled"`
+	MinBytes int  `mapstructure:"min_bytes"` // smaller bodies are sent uncompressed; defaults to 64KB
+}
+
+// ShadowConfig mirrors a fraction of a provider's requests to another provider
+type ShadowConfig struct {
+	Provider string        `mapstructure:"provider"` // shadow provider name; empty disables mirroring
+	Fraction float64       `mapstructure:"fraction"` // share of requests mirrored, 0-1
+	Model    string        `mapstructure:"model"`    // model sent to the shadow, defaults to the request's
+	Timeout  time.Duration `mapstructure:"timeout"`
+}
+
+// ProviderTLSConfig contains TLS settings for provider connections
+type ProviderTLSConfig struct {
+	MinVersion   string   `mapstructure:"min_version"`   // 1.2 (default), 1.3
+	PinnedSHA256 []string `mapstructure:"pinned_sha256"` // accepted certificate fingerprints
+	CAFile       string   `mapstructure:"ca_file"`       // PEM bundle trusted in addition to the system roots
+}
+
+// ParameterMapping translates request parameters to a provider's names
+type ParameterMapping struct {
+	Rename        map[string]string `mapstructure:"rename"`         // gateway name -> provider name
+	Unsupported   []string          `mapstructure:"unsupported"`    // parameters the provider rejects
+	OnUnsupported string            `mapstructure:"on_unsupported"` // drop, error
+}
+
+// KillSwitchConfig contains kill-switch rules engaged at startup
+type KillSwitchConfig struct {
+	Message string           `mapstructure:"message"` // default message for blocked requests
+	Rules   []KillSwitchRule `mapstructure:"rules"`
+}
+
+// KillSwitchRule blocks matching traffic; empty tenant and model match everything
+type KillSwitchRule struct {
+	Tenant  string `mapstructure:"tenant"`
+	Model   string `mapstructure:"model"`
+	Message string `mapstructure:"message"`
+}
+
+// RoutingConfig selects how requests are routed across providers serving the same model
+type RoutingConfig struct {
+	Strategy         string               `mapstructure:"strategy"`          // weighted, cost, latency
+	SwitchMargin     float64              `mapstructure:"switch_margin"`     // fraction cheaper a provider must be to take a model over under the cost strategy
+	MinDwell         time.Duration        `mapstructure:"min_dwell"`         // time a provider keeps a model before a cheaper one may take it over
+	LatencySmoothing float64              `mapstructure:"latency_smoothing"` // weight of each new response time in a provider's latency average
+	ExploreFraction  float64              `mapstructure:"explore_fraction"`  // share of requests probing slower providers under the latency strategy
+	ClientDeadline   ClientDeadlineConfig `mapstructure:"client_deadline"`
+}
+
+// ClientDeadlineConfig cancels provider calls once the timeout a client sends
+// has passed, bounded by max_timeout and the provider's own timeout
+type ClientDeadlineConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	Header     string        `mapstructure:"header"`      // carries the client's timeout as a duration ("1500ms") or seconds ("1.5")
+	MaxTimeout time.Duration `mapstructure:"max_timeout"` // longest client timeout honoured; 0 leaves only the provider's timeout
+}
+
+// PricingConfig contains pricing feed configuration. Feed prices take
+// precedence over the prices configured for provider models.
+type PricingConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Source   string        `mapstructure:"source"`   // http(s) URL or file path of the feed
+	Interval time.Duration `mapstructure:"interval"` // between refreshes
+	Timeout  time.Duration `mapstructure:"timeout"`  // for fetching the feed
+	MaxAge   time.Duration `mapstructure:"max_age"`  // feed prices not refreshed for this long revert to the configured ones; 0 keeps them
+}
+
+// ResponseCacheConfig contains provider response cache configuration
+type ResponseCacheConfig struct {
+	Enabled    bool                `mapstructure:"enabled"`
+	TTL        time.Duration       `mapstructure:"ttl"`
+	MaxEntries int                 `mapstructure:"max_entries"`
+	Semantic   SemanticCacheConfig `mapstructure:"semantic"`
+}
+
+// SemanticCacheConfig contains embedding-based cache lookup configuration
+type SemanticCacheConfig struct {
+	Enabled             bool            `mapstructure:"enabled"`
+	SimilarityThreshold float64         `mapstructure:"similarity_threshold"`
+	Embedding           EmbeddingConfig `mapstructure:"embedding"`
+}
+
+// EmbeddingConfig selects the OpenAI-compatible embeddings API for the semantic cache
+type EmbeddingConfig struct {
+	Provider  string        `mapstructure:"provider"`    // provider whose endpoint is used
+	Endpoint  string        `mapstructure:"endpoint"`    // overrides the provider endpoint
+	Model     string        `mapstructure:"model"`
+	APIKeyEnv string        `mapstructure:"api_key_env"` // env var holding a bearer token
+	Timeout   time.Duration `mapstructure:"timeout"`
 }
 
 // CircuitBreakerConfig represents circuit breaker configuration
@@ -129,6 +342,8 @@ type CircuitBreakerConfig struct {
 	FailureThreshold int           `mapstructure:"failure_threshold"`
 	SuccessThreshold int           `mapstructure:"success_threshold"`
 	Timeout          time.Duration `mapstructure:"timeout"`
+	HalfOpenProbes   int           `mapstructure:"half_open_max_probes"`
+	ErrorSamples     int           `mapstructure:"error_samples"`
 }
 
 // HealthCheckConfig represents health check configuration
@@ -137,22 +352,42 @@ type HealthCheckConfig struct {
 	Interval time.Duration `mapstructure:"interval"`
 	Timeout  time.Duration `mapstructure:"timeout"`
 	Path     string        `mapstructure:"path"`
+	Method   string        `mapstructure:"method"`
+	Body     string        `mapstructure:"body"`
 }
 
 // ModelConfig represents model pricing configuration
 type ModelConfig struct {
-	Name                   string  `mapstructure:"name"`
-	CostPer1kInputTokens   float64 `mapstructure:"cost_per_1k_input_tokens"`
-	CostPer1kOutputTokens  float64 `mapstructure:"cost_per_1k_output_tokens"`
+	Name                       string  `mapstructure:"name"`
+	CostPer1kInputTokens       float64 `mapstructure:"cost_per_1k_input_tokens"`
+	CostPer1kOutputTokens      float64 `mapstructure:"cost_per_1k_output_tokens"`
+	CostPer1kCachedInputTokens float64 `mapstructure:"cost_per_1k_cached_input_tokens"` // Rate for prompt tokens served from the provider's cache
+	CostPer1kReasoningTokens   float64 `mapstructure:"cost_per_1k_reasoning_tokens"`    // Rate for completion tokens spent reasoning; 0 uses the output rate
+	Path                       string  `mapstructure:"path"`                            // Optional path template, e.g. /v1/models/{model}/chat
+	MaxTokens                  int     `mapstructure:"max_tokens"`                      // Context window in tokens; 0 leaves it unenforced
+	RoutingWeight              float64 `mapstructure:"routing_weight"`                  // Relative share of the model's traffic across providers weighting it
 }
 
 // Module represents a module configuration
 type Module struct {
-	Enabled    bool                   `mapstructure:"enabled"`
-	Type       string                 `mapstructure:"type"`
-	Priority   int                    `mapstructure:"priority"`
-	Config     map[string]interface{} `mapstructure:"config"`
-	Conditions []map[string]interface{} `mapstructure:"conditions"`
+	Enabled        bool                     `mapstructure:"enabled"`
+	Type           string                   `mapstructure:"type"`
+	Priority       int                      `mapstructure:"priority"`
+	Config         map[string]interface{}   `mapstructure:"config"`
+	Conditions     []map[string]interface{} `mapstructure:"conditions"`
+	ResultCacheTTL time.Duration            `mapstructure:"result_cache_ttl"` // inspectors only: reuse results for identical requests
+	Retry          ModuleRetry              `mapstructure:"retry"`
+	OnTimeout      string                   `mapstructure:"on_timeout"`    // fail-open, fail-closed; defaults to the module type's error behaviour
+	NonEssential   bool                     `mapstructure:"non_essential"` // skipped while the pipeline is degraded
+}
+
+// ModuleRetry retries a module's failed executions before the pipeline
+// gives up on it; independent of provider retries
+type ModuleRetry struct {
+	MaxAttempts       int           `mapstructure:"max_attempts"` // including the first; 0 or 1 disables retries
+	Backoff           time.Duration `mapstructure:"backoff"`
+	BackoffMultiplier float64       `mapstructure:"backoff_multiplier"`
+	MaxBackoff        time.Duration `mapstructure:"max_backoff"`
 }
 
 // ObservabilityConfig contains observability configuration
@@ -165,11 +400,20 @@ type ObservabilityConfig struct {
 
 // MetricsConfig contains metrics configuration
 type MetricsConfig struct {
-	Enabled    bool              `mapstructure:"enabled"`
-	Port       int               `mapstructure:"port"`
-	Path       string            `mapstructure:"path"`
-	Collectors []string          `mapstructure:"collectors"`
-	Labels     map[string]string `mapstructure:"labels"`
+	Enabled      bool               `mapstructure:"enabled"`
+	Port         int                `mapstructure:"port"`
+	Path         string             `mapstructure:"path"`
+	Collectors   []string           `mapstructure:"collectors"`
+	Labels       map[string]string  `mapstructure:"labels"`
+	TenantLabels TenantLabelsConfig `mapstructure:"tenant_labels"`
+}
+
+// TenantLabelsConfig bounds the cardinality of tenant metric labels
+type TenantLabelsConfig struct {
+	Mode       string   `mapstructure:"mode"`        // passthrough, allowlist, hash
+	Allowlist  []string `mapstructure:"allowlist"`   // configured tenants are always allowlisted
+	Buckets    int      `mapstructure:"buckets"`     // hash mode bucket count
+	OtherLabel string   `mapstructure:"other_label"` // allowlist mode label for other tenants
 }
 
 // LoggingConfig contains logging configuration
@@ -203,10 +447,63 @@ type ProfilingConfig struct {
 
 // SecurityConfig contains security configuration
 type SecurityConfig struct {
-	APIKeys            APIKeysConfig        `mapstructure:"api_keys"`
-	CORS               CORSConfig           `mapstructure:"cors"`
-	RateLimiting       RateLimitingConfig   `mapstructure:"rate_limiting"`
-	RequestSizeLimits  RequestSizeLimits    `mapstructure:"request_size_limits"`
+	APIKeys             APIKeysConfig             `mapstructure:"api_keys"`
+	CORS                CORSConfig                `mapstructure:"cors"`
+	RateLimiting        RateLimitingConfig        `mapstructure:"rate_limiting"`
+	RequestSizeLimits   RequestSizeLimits         `mapstructure:"request_size_limits"`
+	TrustedPrincipals   TrustedPrincipals         `mapstructure:"trusted_principals"`
+	TenantAnonymization TenantAnonymizationConfig `mapstructure:"tenant_anonymization"`
+	BodyEncryption      BodyEncryptionConfig      `mapstructure:"body_encryption"`
+	Admin               AdminConfig               `mapstructure:"admin"`
+}
+
+// AdminConfig guards the admin endpoints on the health port
+type AdminConfig struct {
+	TokenSHA256 []string `mapstructure:"token_sha256"` // bearer tokens allowed to use /admin endpoints; with none they are not served
+}
+
+// BodyEncryptionConfig encrypts request and response bodies written by sinks
+// with per-tenant keys
+type BodyEncryptionConfig struct {
+	Enabled bool             `mapstructure:"enabled"`
+	Tenants []TenantBodyKeys `mapstructure:"tenants"`
+}
+
+// TenantBodyKeys are a tenant's body encryption keys, current key first
+type TenantBodyKeys struct {
+	Tenant string          `mapstructure:"tenant"`
+	Keys   []EncryptionKey `mapstructure:"keys"`
+}
+
+// EncryptionKey is a base64-encoded 256-bit key
+type EncryptionKey struct {
+	ID  string `mapstructure:"id"`
+	Key string `mapstructure:"key"`
+}
+
+// TenantAnonymizationConfig replaces tenant IDs in logs, metric labels and
+// annotations with salted pseudonyms
+type TenantAnonymizationConfig struct {
+	Enabled           bool     `mapstructure:"enabled"`
+	Salt              string   `mapstructure:"salt"`
+	LookupTokenSHA256 []string `mapstructure:"lookup_token_sha256"` // tokens allowed to resolve pseudonyms via /admin/tenant-pseudonyms
+}
+
+// TrustedPrincipals configures internal services allowed to bypass modules
+type TrustedPrincipals struct {
+	Header                 string             `mapstructure:"header"`
+	ProviderOverrideHeader string             `mapstructure:"provider_override_header"` // names the provider to force for a request
+	DryRunHeader           string             `mapstructure:"dry_run_header"`           // marks a request as a dry run
+	Principals             []TrustedPrincipal `mapstructure:"principals"`
+}
+
+// TrustedPrincipal is an internal service identified by the SHA-256 of its token
+type TrustedPrincipal struct {
+	Name                  string   `mapstructure:"name"`
+	TokenSHA256           string   `mapstructure:"token_sha256"`
+	BypassModules         []string `mapstructure:"bypass_modules"`
+	AllowProviderOverride bool     `mapstructure:"allow_provider_override"`
+	AllowDryRun           bool     `mapstructure:"allow_dry_run"`
 }
 
 // APIKeysConfig contains API key configuration
@@ -260,6 +557,19 @@ type FeatureFlagsConfig struct {
 	EnableRequestSigning        bool `mapstructure:"enable_request_signing"`
 	EnableResponseCompression   bool `mapstructure:"enable_response_compression"`
 	EnableRequestDeduplication  bool `mapstructure:"enable_request_deduplication"`
+
+	// Per-tenant overrides by tenant ID during rollouts; unset flags
+	// inherit the global values above
+	Tenants map[string]TenantFeatureFlags `mapstructure:"tenants"`
+}
+
+// TenantFeatureFlags overrides feature flags for one tenant
+type TenantFeatureFlags struct {
+	EnableStreaming            *bool `mapstructure:"enable_streaming"`
+	EnableCaching              *bool `mapstructure:"enable_caching"`
+	EnableRequestSigning       *bool `mapstructure:"enable_request_signing"`
+	EnableResponseCompression  *bool `mapstructure:"enable_response_compression"`
+	EnableRequestDeduplication *bool `mapstructure:"enable_request_deduplication"`
 }
 
 // DevelopmentConfig contains development/debug settings
@@ -269,6 +579,7 @@ type DevelopmentConfig struct {
 	LogRequests   bool `mapstructure:"log_requests"`
 	LogResponses  bool `mapstructure:"log_responses"`
 	EnablePprof   bool `mapstructure:"enable_pprof"`
+	TransformDiff bool `mapstructure:"transform_diff"` // record body diffs of policies and transformers; requires debug_mode
 }
 
 // Load loads configuration from file and environment variables
@@ -337,11 +648,63 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("module_host.keepalive.time", "30s")
 	v.SetDefault("module_host.keepalive.timeout", "5s")
 	v.SetDefault("module_host.keepalive.permit_without_stream", true)
+	v.SetDefault("module_host.protobuf_enabled", true)
+	v.SetDefault("module_host.duplicate_module", "error")
+	v.SetDefault("module_host.annotations.max_count", 256)
+	v.SetDefault("module_host.annotations.max_value_bytes", 65536)
+	v.SetDefault("module_host.capture.sample_rate", 0.01)
+	v.SetDefault("module_host.degraded_mode.failure_threshold", 5)
+	v.SetDefault("module_host.degraded_mode.cooldown", "30s")
+	v.SetDefault("module_host.self_test.enabled", false)
+	v.SetDefault("module_host.self_test.timeout", "10s")
+	v.SetDefault("module_host.self_test.fatal_checks", []string{"providers", "pipeline"})
+	v.SetDefault("module_host.warmup.enabled", true)
+	v.SetDefault("module_host.warmup.timeout", "60s")
+
+	// Security defaults
+	v.SetDefault("security.trusted_principals.header", "X-Leash-Internal-Token")
+	v.SetDefault("security.trusted_principals.provider_override_header", "X-Leash-Provider")
+
+	// Provider routing defaults
+	v.SetDefault("routing.strategy", "weighted")
+	v.SetDefault("routing.switch_margin", 0.1)
+	v.SetDefault("routing.min_dwell", "1m")
+	v.SetDefault("routing.latency_smoothing", 0.2)
+	v.SetDefault("routing.explore_fraction", 0.05)
+	v.SetDefault("routing.client_deadline.enabled", false)
+	v.SetDefault("routing.client_deadline.header", "X-Request-Timeout")
+
+	// Response cache defaults
+	v.SetDefault("pricing.enabled", false)
+	v.SetDefault("pricing.interval", "1h")
+	v.SetDefault("pricing.timeout", "10s")
+	v.SetDefault("pricing.max_age", "0s")
+	v.SetDefault("response_cache.enabled", false)
+	v.SetDefault("response_cache.ttl", "5m")
+	v.SetDefault("response_cache.max_entries", 1000)
+	v.SetDefault("response_cache.semantic.enabled", false)
+	v.SetDefault("response_cache.semantic.similarity_threshold", 0.95)
+	v.SetDefault("response_cache.semantic.embedding.provider", "openai")
+	v.SetDefault("response_cache.semantic.embedding.model", "text-embedding-3-small")
+	v.SetDefault("response_cache.semantic.embedding.timeout", "5s")
+
+	// Feature flag defaults; the response cache is only used by tenants
+	// with caching enabled, so it stays on wherever response_cache is
+	v.SetDefault("feature_flags.enable_streaming", true)
+	v.SetDefault("feature_flags.enable_caching", true)
+
+	// Tenant store defaults
+	v.SetDefault("tenant_store.backend", "config")
+	v.SetDefault("tenant_store.unknown_tenants", "reject")
+	v.SetDefault("tenant_store.max_onboarded", 1000)
 
 	// Observability defaults
 	v.SetDefault("observability.metrics.enabled", true)
 	v.SetDefault("observability.metrics.port", 9090)
 	v.SetDefault("observability.metrics.path", "/metrics")
+	v.SetDefault("observability.metrics.tenant_labels.mode", "passthrough")
+	v.SetDefault("observability.metrics.tenant_labels.buckets", 16)
+	v.SetDefault("observability.metrics.tenant_labels.other_label", "other")
 	v.SetDefault("observability.logging.level", "info")
 	v.SetDefault("observability.logging.format", "json")
 	v.SetDefault("observability.logging.output", "stdout")
@@ -363,6 +726,238 @@ func validate(config *Config) error {
 		return fmt.Errorf("invalid module host health port: %d", config.ModuleHost.HealthPort)
 	}
 
+	for _, route := range config.ModuleHost.BypassRoutes {
+		if _, err := path.Match(route.Path, ""); err != nil || route.Path == "" {
+			return fmt.Errorf("invalid module host bypass route path: %q", route.Path)
+		}
+	}
+	for _, route := range config.ModuleHost.DefaultTenantRoutes {
+		if _, err := path.Match(route.Path, ""); err != nil || route.Path == "" {
+			return fmt.Errorf("invalid module host default tenant route path: %q", route.Path)
+		}
+		if route.Tenant == "" {
+			return fmt.Errorf("module host default tenant route %s needs a tenant", route.Path)
+		}
+	}
+
+	if encryption := config.Security.BodyEncryption; encryption.Enabled {
+		for _, tenant := range encryption.Tenants {
+			if tenant.Tenant == "" {
+				return fmt.Errorf("body_encryption tenant is required")
+			}
+			if len(tenant.Keys) == 0 {
+				return fmt.Errorf("body_encryption tenant %s has no keys", tenant.Tenant)
+			}
+			for _, key := range tenant.Keys {
+				if key.ID == "" || key.Key == "" {
+					return fmt.Errorf("body_encryption tenant %s: key id and key are required", tenant.Tenant)
+				}
+			}
+		}
+	}
+
+	if anonymization := config.Security.TenantAnonymization; anonymization.Enabled && anonymization.Salt == "" {
+		return fmt.Errorf("tenant_anonymization requires a salt")
+	}
+
+	if deadLetter := config.ModuleHost.DeadLetter; deadLetter.Enabled {
+		switch deadLetter.Backend {
+		case "", "file":
+			if deadLetter.Path == "" {
+				return fmt.Errorf("dead_letter path is required for the file backend")
+			}
+		case "memory":
+		default:
+			return fmt.Errorf("invalid dead_letter backend: %s", deadLetter.Backend)
+		}
+		if deadLetter.RetryInterval < 0 || deadLetter.MaxAttempts < 0 {
+			return fmt.Errorf("dead_letter retry_interval and max_attempts cannot be negative")
+		}
+	}
+
+	if admission := config.ModuleHost.Admission; admission.Enabled {
+		if admission.MaxConcurrent <= 0 {
+			return fmt.Errorf("admission max_concurrent must be positive")
+		}
+		if admission.MaxQueue < 0 || admission.MaxWait < 0 {
+			return fmt.Errorf("admission max_queue and max_wait cannot be negative")
+		}
+	}
+
+	if capture := config.ModuleHost.Capture; capture.Enabled {
+		if capture.Path == "" {
+			return fmt.Errorf("capture path is required")
+		}
+		if capture.SampleRate <= 0 || capture.SampleRate > 1 {
+			return fmt.Errorf("capture sample_rate must be in (0, 1], got %v", capture.SampleRate)
+		}
+	}
+
+	if config.ModuleHost.SlowRequestThreshold < 0 {
+		return fmt.Errorf("slow_request_threshold cannot be negative")
+	}
+
+	if limits := config.ModuleHost.Annotations; limits.MaxCount < 0 || limits.MaxValueBytes < 0 {
+		return fmt.Errorf("annotation limits cannot be negative")
+	}
+
+	if degraded := config.ModuleHost.DegradedMode; degraded.Enabled && (degraded.FailureThreshold < 1 || degraded.Cooldown <= 0) {
+		return fmt.Errorf("degraded_mode needs a failure_threshold of at least 1 and a positive cooldown")
+	}
+
+	if warmup := config.ModuleHost.Warmup; warmup.Enabled && warmup.Timeout <= 0 {
+		return fmt.Errorf("warmup timeout must be positive")
+	}
+
+	switch config.ModuleHost.DuplicateModule {
+	case "", "error", "replace", "skip":
+	default:
+		return fmt.Errorf("invalid duplicate_module policy: %s", config.ModuleHost.DuplicateModule)
+	}
+
+	switch config.Routing.Strategy {
+	case "", "weighted", "cost", "latency":
+	default:
+		return fmt.Errorf("invalid routing strategy: %s", config.Routing.Strategy)
+	}
+	if config.Routing.LatencySmoothing <= 0 || config.Routing.LatencySmoothing > 1 {
+		return fmt.Errorf("routing latency_smoothing must be in (0, 1], got %v", config.Routing.LatencySmoothing)
+	}
+	if config.Routing.ExploreFraction < 0 || config.Routing.ExploreFraction >= 1 {
+		return fmt.Errorf("routing explore_fraction must be in [0, 1), got %v", config.Routing.ExploreFraction)
+	}
+	if config.Routing.ClientDeadline.MaxTimeout < 0 {
+		return fmt.Errorf("routing client_deadline max_timeout cannot be negative")
+	}
+	if config.Routing.SwitchMargin < 0 || config.Routing.SwitchMargin >= 1 || config.Routing.MinDwell < 0 {
+		return fmt.Errorf("routing switch_margin must be in [0, 1) and min_dwell cannot be negative")
+	}
+
+	if pricing := config.Pricing; pricing.Enabled {
+		if pricing.Source == "" {
+			return fmt.Errorf("pricing source is required when the pricing feed is enabled")
+		}
+		if pricing.Interval <= 0 || pricing.Timeout <= 0 || pricing.MaxAge < 0 {
+			return fmt.Errorf("pricing interval and timeout must be positive and max_age cannot be negative")
+		}
+	}
+
+	if threshold := config.ResponseCache.Semantic.SimilarityThreshold; threshold <= 0 || threshold > 1 {
+		return fmt.Errorf("invalid semantic cache similarity threshold: %v", threshold)
+	}
+
+	for name, provider := range config.Providers {
+		if _, err := base.ParseHeaderTemplates(provider.Headers); err != nil {
+			return fmt.Errorf("provider %s: %w", name, err)
+		}
+		tlsConfig := base.TLSConfig{
+			MinVersion:   provider.TLS.MinVersion,
+			PinnedSHA256: provider.TLS.PinnedSHA256,
+			CAFile:       provider.TLS.CAFile,
+		}
+		if err := tlsConfig.Validate(); err != nil {
+			return fmt.Errorf("provider %s: %w", name, err)
+		}
+		switch provider.Parameters.OnUnsupported {
+		case "", base.UnsupportedParameterDrop, base.UnsupportedParameterError:
+		default:
+			return fmt.Errorf("provider %s: invalid on_unsupported action: %s", name, provider.Parameters.OnUnsupported)
+		}
+		switch provider.Type {
+		case "", "openai", "anthropic":
+		default:
+			return fmt.Errorf("provider %s: unsupported type: %s", name, provider.Type)
+		}
+		switch provider.StreamFormat {
+		case "", "passthrough", "canonical":
+		default:
+			return fmt.Errorf("provider %s: invalid stream_format: %s", name, provider.StreamFormat)
+		}
+		if provider.StreamHeartbeat < 0 {
+			return fmt.Errorf("provider %s: stream_heartbeat cannot be negative", name)
+		}
+		if provider.StreamIdleTimeout < 0 || provider.StreamMaxDuration < 0 {
+			return fmt.Errorf("provider %s: stream_idle_timeout and stream_max_duration cannot be negative", name)
+		}
+		if provider.MaxResponseBytes < 0 {
+			return fmt.Errorf("provider %s: max_response_bytes cannot be negative", name)
+		}
+		if provider.RequestCompression.MinBytes < 0 {
+			return fmt.Errorf("provider %s: request_compression min_bytes cannot be negative", name)
+		}
+		switch provider.OversizeResponse {
+		case "", "error", "stream":
+		default:
+			return fmt.Errorf("provider %s: invalid oversize_response: %s", name, provider.OversizeResponse)
+		}
+		for _, model := range provider.Models {
+			if model.RoutingWeight < 0 {
+				return fmt.Errorf("provider %s: model %s routing weight cannot be negative", name, model.Name)
+			}
+		}
+		if provider.CircuitBreaker.ErrorSamples < 0 {
+			return fmt.Errorf("provider %s: circuit_breaker.error_samples cannot be negative", name)
+		}
+		if provider.CircuitBreaker.HalfOpenProbes < 0 {
+			return fmt.Errorf("provider %s: circuit_breaker.half_open_max_probes cannot be negative", name)
+		}
+		switch strings.ToUpper(provider.HealthCheck.Method) {
+		case "", "GET", "HEAD", "POST":
+		default:
+			return fmt.Errorf("provider %s: unsupported health_check method: %s", name, provider.HealthCheck.Method)
+		}
+		if healthPath := provider.HealthCheck.Path; healthPath != "" && !strings.HasPrefix(healthPath, "/") {
+			return fmt.Errorf("provider %s: health_check path must start with /: %s", name, healthPath)
+		}
+		if shadow := provider.Shadow; shadow.Provider != "" {
+			if _, exists := config.Providers[shadow.Provider]; !exists || shadow.Provider == name {
+				return fmt.Errorf("provider %s: invalid shadow provider: %s", name, shadow.Provider)
+			}
+			if shadow.Fraction < 0 || shadow.Fraction > 1 {
+				return fmt.Errorf("provider %s: shadow fraction must be between 0 and 1, got %v", name, shadow.Fraction)
+			}
+		}
+	}
+
+	for name, module := range config.Modules {
+		if module.ResultCacheTTL < 0 {
+			return fmt.Errorf("module %s: result_cache_ttl cannot be negative", name)
+		}
+		if module.ResultCacheTTL > 0 && module.Type != "inspector" {
+			return fmt.Errorf("module %s: result_cache_ttl is only supported for inspectors", name)
+		}
+		if retry := module.Retry; retry.MaxAttempts < 0 || retry.Backoff < 0 || retry.MaxBackoff < 0 || retry.BackoffMultiplier < 0 {
+			return fmt.Errorf("module %s: retry settings cannot be negative", name)
+		}
+		switch module.OnTimeout {
+		case "", "fail-open":
+		case "fail-closed":
+			if module.Type == "sink" {
+				return fmt.Errorf("module %s: sinks cannot fail closed on timeout", name)
+			}
+		default:
+			return fmt.Errorf("module %s: invalid on_timeout: %s", name, module.OnTimeout)
+		}
+	}
+
+	switch config.TenantStore.Backend {
+	case "config", "database":
+	default:
+		return fmt.Errorf("invalid tenant store backend: %s", config.TenantStore.Backend)
+	}
+	switch config.TenantStore.UnknownTenants {
+	case "", "reject":
+	case "onboard":
+		if len(config.TenantStore.OnboardingKeys) == 0 {
+			return fmt.Errorf("unknown_tenants onboard requires onboarding_key_sha256")
+		}
+		if config.TenantStore.MaxOnboarded <= 0 {
+			return fmt.Errorf("invalid max_onboarded: %d", config.TenantStore.MaxOnboarded)
+		}
+	default:
+		return fmt.Errorf("invalid unknown_tenants mode: %s", config.TenantStore.UnknownTenants)
+	}
+
 	// Validate observability config
 	if config.Observability.Metrics.Port <= 0 || config.Observability.Metrics.Port > 65535 {
 		return fmt.Errorf("invalid metrics port: %d", config.Observability.Metrics.Port)
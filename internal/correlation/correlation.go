@@ -0,0 +1,66 @@
+package correlation
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Header carries the request correlation ID between clients, the gateway and providers
+const Header = "X-Request-Id"
+
+// maxIDLength bounds accepted incoming IDs so they stay safe to log and forward
+const maxIDLength = 128
+
+// NewID generates a new request ID
+func NewID() string {
+	return fmt.Sprintf("req_%d", time.Now().UnixNano())
+}
+
+// Valid reports whether an incoming ID can be reused: non-empty, bounded, and
+// limited to letters, digits and . _ : - characters
+func Valid(id string) bool {
+	if id == "" || len(id) > maxIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '.', r == '_', r == ':', r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Ensure returns id when it is valid, or a newly generated ID
+func Ensure(id string) string {
+	if Valid(id) {
+		return id
+	}
+	return NewID()
+}
+
+// FromHeaders returns the correlation ID in a header map, matching the header
+// name case-insensitively, or "" when absent
+func FromHeaders(headers map[string]string) string {
+	for key, value := range headers {
+		if strings.EqualFold(key, Header) {
+			return value
+		}
+	}
+	return ""
+}
+
+// Middleware reuses the incoming correlation ID or generates one, sets it on
+// the request so handlers can read it, and echoes it in the response header
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := Ensure(r.Header.Get(Header))
+		r.Header.Set(Header, requestID)
+		w.Header().Set(Header, requestID)
+		next.ServeHTTP(w, r)
+	})
+}
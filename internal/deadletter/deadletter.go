@@ -0,0 +1,171 @@
+package deadletter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+)
+
+// Backends a dead-letter store can be kept in
+const (
+	BackendFile   = "file"
+	BackendMemory = "memory"
+)
+
+// Phases of the pipeline a sink event can come from
+const (
+	PhaseRequest  = "request"
+	PhaseResponse = "response"
+)
+
+// Event is a sink delivery that failed, kept with the request or response
+// the sink was given so it can be delivered again
+type Event struct {
+	Sink     string                             `json:"sink"`
+	Phase    string                             `json:"phase"` // request, response
+	Reason   string                             `json:"reason"`
+	Attempts int                                `json:"attempts"`
+	FailedAt time.Time                          `json:"failed_at"`
+	Request  *interfaces.ProcessRequestContext  `json:"request,omitempty"`
+	Response *interfaces.ProcessResponseContext `json:"response,omitempty"`
+}
+
+// RequestID returns the ID of the request the event belongs to
+func (e *Event) RequestID() string {
+	switch {
+	case e.Response != nil && e.Response.ProcessRequestContext != nil:
+		return e.Response.RequestID
+	case e.Request != nil:
+		return e.Request.RequestID
+	default:
+		return ""
+	}
+}
+
+// Store keeps undeliverable sink events until they are replayed
+type Store interface {
+	// Append adds an event to the store
+	Append(event Event) error
+	// Take removes and returns every stored event, oldest first
+	Take() ([]Event, error)
+}
+
+// NewStore creates a store for a backend; path is the file of the file backend
+func NewStore(backend, path string) (Store, error) {
+	switch backend {
+	case "", BackendFile:
+		if path == "" {
+			return nil, fmt.Errorf("dead-letter file backend requires a path")
+		}
+		return NewFileStore(path), nil
+	case BackendMemory:
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unsupported dead-letter backend: %s", backend)
+	}
+}
+
+// FileStore keeps events as JSON lines in a local file, so they survive a
+// restart
+type FileStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileStore creates a store appending to the file at path
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Append writes an event as a line at the end of the file
+func (s *FileStore) Append(event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode dead-letter event: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open dead-letter file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write dead-letter event: %w", err)
+	}
+	return nil
+}
+
+// Take reads every event and empties the file. Lines that cannot be decoded
+// are reported rather than dropped, and the file is left untouched.
+func (s *FileStore) Take() ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dead-letter file: %w", err)
+	}
+	defer file.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, fmt.Errorf("invalid dead-letter event on line %d: %w", line, err)
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read dead-letter file: %w", err)
+	}
+
+	if err := os.Truncate(s.path, 0); err != nil {
+		return nil, fmt.Errorf("failed to clear dead-letter file: %w", err)
+	}
+	return events, nil
+}
+
+// MemoryStore keeps events in memory; they are lost on restart
+type MemoryStore struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Append adds an event to the store
+func (s *MemoryStore) Append(event Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+// Take removes and returns every stored event
+func (s *MemoryStore) Take() ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := s.events
+	s.events = nil
+	return events, nil
+}
@@ -0,0 +1,189 @@
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// keySize is the size of tenant and data keys (AES-256)
+const keySize = 32
+
+// Errors returned when a body cannot be encrypted or decrypted
+var (
+	ErrNoTenantKey = errors.New("no encryption key for tenant")
+	ErrUnknownKey  = errors.New("unknown encryption key")
+	ErrDecrypt     = errors.New("body could not be decrypted")
+)
+
+// Key is a tenant key-encryption key
+type Key struct {
+	ID       string
+	Material []byte // 32 bytes
+}
+
+// Keystore provides tenants' key-encryption keys, e.g. from configuration or
+// a KMS. Stored envelopes carry only key IDs. Errors must not name the tenant,
+// since they may be logged where tenant IDs are anonymized.
+type Keystore interface {
+	// CurrentKey returns the key a tenant's bodies are encrypted with
+	CurrentKey(tenantID string) (Key, error)
+	// Key returns a tenant's key by ID, including retired ones
+	Key(tenantID, keyID string) (Key, error)
+}
+
+// StaticKeystore holds tenant keys in memory, typically from configuration
+type StaticKeystore struct {
+	keys map[string][]Key // tenant -> keys, current first
+}
+
+// NewStaticKeystore creates a keystore from each tenant's keys, current key
+// first; older keys are kept so bodies encrypted with them still decrypt
+func NewStaticKeystore(keys map[string][]Key) (*StaticKeystore, error) {
+	store := &StaticKeystore{keys: make(map[string][]Key, len(keys))}
+	for tenantID, tenantKeys := range keys {
+		if len(tenantKeys) == 0 {
+			return nil, fmt.Errorf("tenant %s: no encryption keys", tenantID)
+		}
+		seen := make(map[string]bool, len(tenantKeys))
+		for _, key := range tenantKeys {
+			if key.ID == "" {
+				return nil, fmt.Errorf("tenant %s: encryption key id is required", tenantID)
+			}
+			if seen[key.ID] {
+				return nil, fmt.Errorf("tenant %s: duplicate encryption key id %s", tenantID, key.ID)
+			}
+			if len(key.Material) != keySize {
+				return nil, fmt.Errorf("tenant %s: encryption key %s must be %d bytes, got %d", tenantID, key.ID, keySize, len(key.Material))
+			}
+			seen[key.ID] = true
+		}
+		store.keys[tenantID] = append([]Key(nil), tenantKeys...)
+	}
+	return store, nil
+}
+
+// ParseKey decodes a base64-encoded key, as generated by openssl rand -base64 32
+func ParseKey(id, encoded string) (Key, error) {
+	material, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return Key{}, fmt.Errorf("encryption key %s is not valid base64: %w", id, err)
+	}
+	return Key{ID: id, Material: material}, nil
+}
+
+// CurrentKey returns the tenant's first key
+func (s *StaticKeystore) CurrentKey(tenantID string) (Key, error) {
+	keys := s.keys[tenantID]
+	if len(keys) == 0 {
+		return Key{}, ErrNoTenantKey
+	}
+	return keys[0], nil
+}
+
+// Key returns one of the tenant's keys by ID
+func (s *StaticKeystore) Key(tenantID, keyID string) (Key, error) {
+	for _, key := range s.keys[tenantID] {
+		if key.ID == keyID {
+			return key, nil
+		}
+	}
+	return Key{}, fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+}
+
+// Envelope is an encrypted body. The body is sealed with a data key generated
+// for it alone, and the data key is sealed with the tenant's key. Both are
+// bound to the tenant ID, so an envelope cannot be decrypted as another
+// tenant's even under a shared key. The tenant ID itself is not stored.
+type Envelope struct {
+	KeyID      string `json:"key_id"`
+	WrappedKey []byte `json:"wrapped_key"` // nonce followed by the sealed data key
+	Ciphertext []byte `json:"ciphertext"`  // nonce followed by the sealed body
+}
+
+// Encryptor encrypts bodies for storage and decrypts them for authorized
+// readers
+type Encryptor struct {
+	keys Keystore
+}
+
+// NewEncryptor creates an encryptor using tenant keys from a keystore
+func NewEncryptor(keys Keystore) *Encryptor {
+	return &Encryptor{keys: keys}
+}
+
+// Encrypt seals a tenant's body under a fresh data key
+func (e *Encryptor) Encrypt(tenantID string, body []byte) (*Envelope, error) {
+	kek, err := e.keys.CurrentKey(tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	wrappedKey, err := seal(kek.Material, dataKey, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := seal(dataKey, body, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{KeyID: kek.ID, WrappedKey: wrappedKey, Ciphertext: ciphertext}, nil
+}
+
+// Decrypt opens a tenant's envelope with the tenant key it was sealed with
+func (e *Encryptor) Decrypt(tenantID string, envelope *Envelope) ([]byte, error) {
+	kek, err := e.keys.Key(tenantID, envelope.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := open(kek.Material, envelope.WrappedKey, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return open(dataKey, envelope.Ciphertext, tenantID)
+}
+
+// seal encrypts plaintext with AES-GCM, prefixing the random nonce
+func seal(key, plaintext []byte, tenantID string) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, []byte(tenantID)), nil
+}
+
+// open decrypts a nonce-prefixed AES-GCM ciphertext
+func open(key, sealed []byte, tenantID string) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(tenantID))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
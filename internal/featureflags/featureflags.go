@@ -0,0 +1,72 @@
+package featureflags
+
+// Flags are the feature flags in effect for a request
+type Flags struct {
+	Streaming            bool `json:"streaming"`
+	Caching              bool `json:"caching"`
+	RequestSigning       bool `json:"request_signing"`
+	ResponseCompression  bool `json:"response_compression"`
+	RequestDeduplication bool `json:"request_deduplication"`
+}
+
+// Overrides are a tenant's feature flags that differ from the global ones.
+// Nil fields inherit the global value.
+type Overrides struct {
+	Streaming            *bool `json:"streaming,omitempty"`
+	Caching              *bool `json:"caching,omitempty"`
+	RequestSigning       *bool `json:"request_signing,omitempty"`
+	ResponseCompression  *bool `json:"response_compression,omitempty"`
+	RequestDeduplication *bool `json:"request_deduplication,omitempty"`
+}
+
+// Set resolves the feature flags of each tenant: the global flags with the
+// tenant's overrides applied. A Set is immutable and safe for concurrent use.
+type Set struct {
+	defaults Flags
+	tenants  map[string]Flags // tenant ID -> resolved flags
+}
+
+// New creates a flag set from the global flags and per-tenant overrides
+func New(defaults Flags, tenants map[string]Overrides) *Set {
+	s := &Set{
+		defaults: defaults,
+		tenants:  make(map[string]Flags, len(tenants)),
+	}
+	for tenantID, overrides := range tenants {
+		s.tenants[tenantID] = overrides.apply(defaults)
+	}
+	return s
+}
+
+// For returns a tenant's flags. Tenants without overrides get the global
+// flags.
+func (s *Set) For(tenantID string) Flags {
+	if flags, ok := s.tenants[tenantID]; ok {
+		return flags
+	}
+	return s.defaults
+}
+
+// Defaults returns the global flags
+func (s *Set) Defaults() Flags {
+	return s.defaults
+}
+
+// apply returns flags with the overrides set
+func (o Overrides) apply(flags Flags) Flags {
+	for _, override := range []struct {
+		value  *bool
+		target *bool
+	}{
+		{o.Streaming, &flags.Streaming},
+		{o.Caching, &flags.Caching},
+		{o.RequestSigning, &flags.RequestSigning},
+		{o.ResponseCompression, &flags.ResponseCompression},
+		{o.RequestDeduplication, &flags.RequestDeduplication},
+	} {
+		if override.value != nil {
+			*override.target = *override.value
+		}
+	}
+	return flags
+}
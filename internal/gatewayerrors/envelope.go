@@ -0,0 +1,171 @@
+package gatewayerrors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// Error sources, telling clients which side of the gateway failed
+const (
+	SourceGateway  = "gateway"  // the gateway itself, or the client's request to it
+	SourceProvider = "provider" // the upstream provider
+	SourcePolicy   = "policy"   // a gateway policy refused the request
+)
+
+// Stable error codes. Block reasons that are themselves codes, such as
+// rate_limit_exceeded, are passed through as policy codes.
+const (
+	CodeInvalidRequest       = "invalid_request"
+	CodeUnauthenticated      = "unauthenticated"
+	CodePermissionDenied     = "permission_denied"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeOverloaded           = "overloaded"
+	CodeUnavailable          = "unavailable"
+	CodeInternal             = "internal_error"
+	CodePolicyViolation      = "policy_violation"
+	CodeProviderTimeout      = "provider_timeout"
+	CodeProviderUnavailable  = "provider_unavailable"
+	CodeProviderRateLimited  = "provider_rate_limited"
+	CodeProviderRejected     = "provider_rejected"
+	CodeProviderError        = "provider_error"
+)
+
+// ErrorResponse is the body of every non-2xx response in the error envelope
+// format, {"error": {...}}. Message is safe to show clients: it never holds
+// upstream bodies or internal error detail.
+type ErrorResponse struct {
+	Source    string `json:"source"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Status    int    `json:"status"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Envelope returns the response wrapped as {"error": {...}}
+func (r *ErrorResponse) Envelope() map[string]interface{} {
+	detail := map[string]interface{}{
+		"source":  r.Source,
+		"code":    r.Code,
+		"message": r.Message,
+		"status":  r.Status,
+	}
+	if r.RequestID != "" {
+		detail["request_id"] = r.RequestID
+	}
+	return map[string]interface{}{"error": detail}
+}
+
+// JSON returns the encoded envelope
+func (r *ErrorResponse) JSON() []byte {
+	encoded, _ := json.Marshal(r.Envelope())
+	return encoded
+}
+
+// Write writes the envelope as a JSON response with its status
+func (r *ErrorResponse) Write(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(r.Status)
+	w.Write(r.JSON())
+}
+
+// Gateway returns an error of the gateway itself
+func Gateway(status int, code, message string) *ErrorResponse {
+	return &ErrorResponse{Source: SourceGateway, Code: code, Message: message, Status: status}
+}
+
+// blockCode matches block reasons that are stable codes
+var blockCode = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`)
+
+// policyMessages are client messages for well-known block codes
+var policyMessages = map[string]string{
+	"rate_limit_exceeded": "Rate limit exceeded",
+	"cost_limit_exceeded": "Cost limit exceeded",
+}
+
+// Policy returns the error for a request a policy blocked. A block reason in
+// code form becomes the error code; free-text reasons, which may describe
+// what matched, are reported as policy_violation.
+func Policy(blockReason string) *ErrorResponse {
+	response := &ErrorResponse{
+		Source:  SourcePolicy,
+		Code:    CodePolicyViolation,
+		Message: "Request blocked by policy",
+		Status:  http.StatusForbidden,
+	}
+	if blockCode.MatchString(blockReason) {
+		response.Code = blockReason
+		if message, ok := policyMessages[blockReason]; ok {
+			response.Message = message
+		}
+	}
+	if response.Code == "rate_limit_exceeded" {
+		response.Status = http.StatusTooManyRequests
+	}
+	return response
+}
+
+// ProviderStatus returns the error for a non-2xx upstream response. Upstream
+// 5xx statuses other than timeouts are returned as 502, so a 500 or 503 the
+// client sees from the gateway never looks like the gateway's own.
+func ProviderStatus(provider string, status int) *ErrorResponse {
+	response := &ErrorResponse{Source: SourceProvider, Status: status}
+	switch {
+	case status == http.StatusTooManyRequests:
+		response.Code = CodeProviderRateLimited
+		response.Message = fmt.Sprintf("Provider %s is rate limiting requests", provider)
+	case status == http.StatusGatewayTimeout:
+		response.Code = CodeProviderTimeout
+		response.Message = fmt.Sprintf("Provider %s timed out", provider)
+	case status == http.StatusServiceUnavailable:
+		response.Code = CodeProviderUnavailable
+		response.Message = fmt.Sprintf("Provider %s is unavailable", provider)
+		response.Status = http.StatusBadGateway
+	case status >= 500:
+		response.Code = CodeProviderError
+		response.Message = fmt.Sprintf("Provider %s failed to process the request", provider)
+		response.Status = http.StatusBadGateway
+	default:
+		response.Code = CodeProviderRejected
+		response.Message = fmt.Sprintf("Provider %s rejected the request", provider)
+	}
+	return response
+}
+
+// ProviderFailure returns the error for a provider call that got no usable
+// response: a timeout, or a connection or circuit breaker failure
+func ProviderFailure(provider string, err error) *ErrorResponse {
+	var providerTimeout *ProviderTimeoutError
+	if errors.As(err, &providerTimeout) || IsTimeout(err) {
+		return ProviderStatus(provider, http.StatusGatewayTimeout)
+	}
+	return &ErrorResponse{
+		Source:  SourceProvider,
+		Code:    CodeProviderUnavailable,
+		Message: fmt.Sprintf("Provider %s is unavailable", provider),
+		Status:  http.StatusBadGateway,
+	}
+}
+
+// ResponseError is an error carrying the response the client is sent for it
+type ResponseError struct {
+	Response *ErrorResponse
+	Err      error
+}
+
+func (e *ResponseError) Error() string { return e.Err.Error() }
+
+func (e *ResponseError) Unwrap() error { return e.Err }
+
+// ResponseFor returns the response carried by err, or an internal gateway
+// error for errors that carry none
+func ResponseFor(err error) *ErrorResponse {
+	var responseErr *ResponseError
+	if errors.As(err, &responseErr) {
+		return responseErr.Response
+	}
+	return Gateway(http.StatusInternalServerError, CodeInternal, "Internal gateway error")
+}
@@ -0,0 +1,87 @@
+package gatewayerrors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Error types used as the error_type label on error metrics
+const (
+	ErrorTypeProviderTimeout = "provider_timeout" // Upstream provider did not answer in time
+	ErrorTypeModuleTimeout   = "module_timeout"   // Gateway module processing exceeded its budget
+	ErrorTypeCanceled        = "canceled"         // Caller cancelled the request
+	ErrorTypeError           = "error"            // Any other failure
+)
+
+// ProviderTimeoutError indicates that a provider call timed out
+type ProviderTimeoutError struct {
+	Provider string
+	Timeout  time.Duration
+	Err      error
+}
+
+func (e *ProviderTimeoutError) Error() string {
+	if e.Timeout > 0 {
+		return fmt.Sprintf("provider %s timed out after %v: %v", e.Provider, e.Timeout, e.Err)
+	}
+	return fmt.Sprintf("provider %s timed out: %v", e.Provider, e.Err)
+}
+
+func (e *ProviderTimeoutError) Unwrap() error { return e.Err }
+
+// ModuleTimeoutError indicates that a module exceeded its processing timeout
+type ModuleTimeoutError struct {
+	Module  string
+	Timeout time.Duration
+}
+
+func (e *ModuleTimeoutError) Error() string {
+	return fmt.Sprintf("module %s timed out after %v", e.Module, e.Timeout)
+}
+
+// IsTimeout reports whether err is a deadline or network timeout
+func IsTimeout(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// WrapProviderError wraps timeouts from a provider call as ProviderTimeoutError,
+// leaving other errors untouched
+func WrapProviderError(provider string, timeout time.Duration, err error) error {
+	if err == nil {
+		return nil
+	}
+	var providerTimeout *ProviderTimeoutError
+	if errors.As(err, &providerTimeout) || !IsTimeout(err) {
+		return err
+	}
+	return &ProviderTimeoutError{Provider: provider, Timeout: timeout, Err: err}
+}
+
+// Classify maps an error to its error_type metric label
+func Classify(err error) string {
+	var providerTimeout *ProviderTimeoutError
+	var moduleTimeout *ModuleTimeoutError
+
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &moduleTimeout):
+		return ErrorTypeModuleTimeout
+	case errors.As(err, &providerTimeout):
+		return ErrorTypeProviderTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrorTypeCanceled
+	default:
+		return ErrorTypeError
+	}
+}
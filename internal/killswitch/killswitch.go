@@ -0,0 +1,195 @@
+package killswitch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultMessage is returned for blocked requests when a rule has no message
+const DefaultMessage = "Service temporarily unavailable"
+
+// Rule blocks matching requests while engaged. Empty Tenant and Model match
+// everything, so a rule with neither is the global kill switch. Model
+// supports glob patterns such as "gpt-4*".
+type Rule struct {
+	ID        string    `json:"id"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Model     string    `json:"model,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	EngagedAt time.Time `json:"engaged_at"`
+}
+
+// Global reports whether the rule matches all traffic
+func (r *Rule) Global() bool { return r.Tenant == "" && r.Model == "" }
+
+// Matches reports whether the rule applies to a tenant and model
+func (r *Rule) Matches(tenant, model string) bool {
+	if r.Tenant != "" && r.Tenant != tenant {
+		return false
+	}
+	if r.Model != "" {
+		if matched, err := path.Match(r.Model, model); err != nil || !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// Switch holds the engaged kill-switch rules
+type Switch struct {
+	mu             sync.RWMutex
+	rules          map[string]*Rule
+	defaultMessage string
+}
+
+// New creates a kill switch; defaultMessage is used for rules without one
+func New(defaultMessage string) *Switch {
+	if defaultMessage == "" {
+		defaultMessage = DefaultMessage
+	}
+	return &Switch{
+		rules:          make(map[string]*Rule),
+		defaultMessage: defaultMessage,
+	}
+}
+
+// Engage adds or replaces a rule. Rules without an ID get one derived from
+// their scope, so engaging the same scope twice replaces the earlier rule.
+func (s *Switch) Engage(rule Rule) *Rule {
+	if rule.ID == "" {
+		rule.ID = ruleID(rule.Tenant, rule.Model)
+	}
+	if rule.Message == "" {
+		rule.Message = s.defaultMessage
+	}
+	rule.EngagedAt = time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules[rule.ID] = &rule
+	return &rule
+}
+
+// Release removes a rule, reporting whether it was engaged
+func (s *Switch) Release(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.rules[id]; !exists {
+		return false
+	}
+	delete(s.rules, id)
+	return true
+}
+
+// ReleaseAll removes every rule
+func (s *Switch) ReleaseAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = make(map[string]*Rule)
+}
+
+// Rules returns the engaged rules ordered by ID
+func (s *Switch) Rules() []Rule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rules := make([]Rule, 0, len(s.rules))
+	for _, rule := range s.rules {
+		rules = append(rules, *rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+	return rules
+}
+
+// Match returns the engaged rule blocking a tenant and model, preferring the
+// global rule, or nil when traffic is allowed
+func (s *Switch) Match(tenant, model string) *Rule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var match *Rule
+	for _, rule := range s.rules {
+		if !rule.Matches(tenant, model) {
+			continue
+		}
+		if rule.Global() {
+			copied := *rule
+			return &copied
+		}
+		if match == nil || rule.ID < match.ID {
+			match = rule
+		}
+	}
+	if match == nil {
+		return nil
+	}
+	copied := *match
+	return &copied
+}
+
+// ruleID derives a stable rule ID from its scope
+func ruleID(tenant, model string) string {
+	switch {
+	case tenant == "" && model == "":
+		return "global"
+	case model == "":
+		return "tenant:" + tenant
+	case tenant == "":
+		return "model:" + model
+	default:
+		return fmt.Sprintf("tenant:%s/model:%s", tenant, model)
+	}
+}
+
+// Handler serves the kill-switch admin API:
+//
+//	GET    lists engaged rules
+//	POST   engages a rule from a JSON body {"tenant", "model", "message"}
+//	DELETE releases the rule named by ?id=, or all rules with ?all=true
+func (s *Switch) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, map[string]interface{}{"rules": s.Rules()})
+
+		case http.MethodPost:
+			var rule Rule
+			if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+				http.Error(w, fmt.Sprintf("invalid rule: %v", err), http.StatusBadRequest)
+				return
+			}
+			if _, err := path.Match(rule.Model, ""); err != nil {
+				http.Error(w, fmt.Sprintf("invalid model pattern: %v", err), http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, http.StatusOK, s.Engage(rule))
+
+		case http.MethodDelete:
+			if r.URL.Query().Get("all") == "true" {
+				s.ReleaseAll()
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			if !s.Release(r.URL.Query().Get("id")) {
+				http.Error(w, "rule not found", http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
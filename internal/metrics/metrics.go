@@ -3,6 +3,7 @@ package metrics
 import (
 	"fmt"
 
+	"github.com/bendiamant/leash-gateway/internal/gatewayerrors"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -20,26 +21,45 @@ type Registry struct {
 	ModuleProcessingDuration *prometheus.HistogramVec
 	ModuleExecutions        *prometheus.CounterVec
 	ModuleErrors           *prometheus.CounterVec
+	ModuleSkips            *prometheus.CounterVec
+	ModuleRetries          *prometheus.CounterVec
 	
 	// Business metrics
 	TokensProcessed    *prometheus.CounterVec
+	TokenEstimatesDegraded *prometheus.CounterVec
 	CostAccrued       *prometheus.CounterVec
+	ProjectedSpend    *prometheus.GaugeVec
+	SpendForecastAlerts *prometheus.CounterVec
 	PolicyViolations  *prometheus.CounterVec
 	PIIDetections     *prometheus.CounterVec
+	FingerprintAnomalies *prometheus.CounterVec
+	ModerationChecks  *prometheus.CounterVec
 	
 	// Provider metrics
 	ProviderRequests  *prometheus.CounterVec
 	ProviderLatency   *prometheus.HistogramVec
+	ProviderErrors    *prometheus.CounterVec
 	CircuitBreakerState *prometheus.GaugeVec
+	CircuitBreakerTransitions *prometheus.CounterVec
 	
 	// System metrics
 	ActiveConnections *prometheus.GaugeVec
 	ConfigReloads     *prometheus.CounterVec
 	CacheOperations   *prometheus.CounterVec
+	TenantsOnboarded  *prometheus.CounterVec
+	SlowRequests      *prometheus.CounterVec
+	AnnotationsDropped *prometheus.CounterVec
+	PricingUpdates     *prometheus.CounterVec
+	PipelineDegraded   *prometheus.GaugeVec
 	
 	// SLI/SLO metrics
 	SLOCompliance       *prometheus.GaugeVec
 	ErrorBudgetRemaining *prometheus.GaugeVec
+	TenantHealthScore   *prometheus.GaugeVec
+
+	tenantLabels       tenantLabeler
+	tenantHealthScores *tenantGauge
+	projectedSpend     *tenantGauge
 }
 
 // NewRegistry creates a new metrics registry with all custom metrics
@@ -110,11 +130,23 @@ func (r *Registry) initializeMetrics() {
 		[]string{"module_name", "module_type", "tenant", "error_type"},
 	)
 	
+	r.ModuleSkips = r.registerCounterVec(
+		"leash_module_skipped_total",
+		"Module executions skipped, by reason",
+		[]string{"module_name", "module_type", "reason"}, // disabled, draining, bypassed, condition-not-met, degraded
+	)
+	
+	r.ModuleRetries = r.registerCounterVec(
+		"leash_module_retries_total",
+		"Module executions retried after a failed attempt",
+		[]string{"module_name", "module_type"},
+	)
+	
 	// Business metrics
 	r.TokensProcessed = r.registerCounterVec(
 		"leash_tokens_processed_total",
 		"Total number of tokens processed",
-		[]string{"tenant", "provider", "model", "token_type"}, // input, output
+		[]string{"tenant", "provider", "model", "token_type"}, // input, output, reasoning (also counted in output)
 	)
 	
 	r.CostAccrued = r.registerCounterVec(
@@ -123,6 +155,20 @@ func (r *Registry) initializeMetrics() {
 		[]string{"tenant", "provider", "model"},
 	)
 	
+	r.ProjectedSpend = r.registerGaugeVec(
+		"leash_tenant_projected_spend_usd",
+		"Spend projected for the end of the tenant's budget period at the current rate",
+		[]string{"tenant"},
+	)
+	// Tenants sharing a label report their combined projected spend
+	r.projectedSpend = newTenantGauge(r.ProjectedSpend, sumValues)
+	
+	r.SpendForecastAlerts = r.registerCounterVec(
+		"leash_spend_forecast_alerts_total",
+		"Budget periods in which a tenant's projected spend exceeded its budget",
+		[]string{"tenant"},
+	)
+	
 	r.PolicyViolations = r.registerCounterVec(
 		"leash_policy_violations_total",
 		"Total number of policy violations",
@@ -135,6 +181,18 @@ func (r *Registry) initializeMetrics() {
 		[]string{"tenant", "pii_type", "location"}, // request, response
 	)
 	
+	r.FingerprintAnomalies = r.registerCounterVec(
+		"leash_fingerprint_anomalies_total",
+		"Requests whose client fingerprint spanned an anomalous number of tenants or API keys",
+		[]string{"reason"}, // tenants, keys
+	)
+	
+	r.ModerationChecks = r.registerCounterVec(
+		"leash_moderation_checks_total",
+		"Moderation API checks of request content by result",
+		[]string{"result"}, // clean, flagged, failed, skipped
+	)
+	
 	// Provider metrics
 	r.ProviderRequests = r.registerCounterVec(
 		"leash_provider_requests_total",
@@ -149,12 +207,24 @@ func (r *Registry) initializeMetrics() {
 		[]float64{.1, .25, .5, 1, 2.5, 5, 10, 30, 60},
 	)
 	
+	r.ProviderErrors = r.registerCounterVec(
+		"leash_provider_errors_total",
+		"Total number of provider call errors",
+		[]string{"provider", "model", "error_type"}, // provider_timeout, canceled, error
+	)
+	
 	r.CircuitBreakerState = r.registerGaugeVec(
 		"leash_circuit_breaker_state",
 		"Circuit breaker state (0=closed, 1=open, 2=half-open)",
 		[]string{"provider"},
 	)
 	
+	r.CircuitBreakerTransitions = r.registerCounterVec(
+		"leash_circuit_breaker_transitions_total",
+		"Circuit breaker state changes",
+		[]string{"provider", "from", "to"}, // closed, open, half-open
+	)
+	
 	// System metrics
 	r.ActiveConnections = r.registerGaugeVec(
 		"leash_active_connections",
@@ -171,7 +241,43 @@ func (r *Registry) initializeMetrics() {
 	r.CacheOperations = r.registerCounterVec(
 		"leash_cache_operations_total",
 		"Total cache operations",
-		[]string{"operation", "result"}, // get/set/delete, hit/miss/error
+		[]string{"operation", "result"}, // get/set/delete, hit/miss/error/bypass
+	)
+	
+	r.TokenEstimatesDegraded = r.registerCounterVec(
+		"leash_token_estimates_degraded_total",
+		"Token counts estimated at four characters per token because no tokenizer was available",
+		[]string{"model"},
+	)
+	
+	r.TenantsOnboarded = r.registerCounterVec(
+		"leash_tenants_onboarded_total",
+		"Unknown tenants created from the onboarding template",
+		[]string{},
+	)
+	
+	r.SlowRequests = r.registerCounterVec(
+		"leash_slow_requests_total",
+		"Requests whose latency exceeded the slow-request threshold",
+		[]string{"phase", "provider", "model"}, // request, response
+	)
+	
+	r.AnnotationsDropped = r.registerCounterVec(
+		"leash_annotations_dropped_total",
+		"Module annotations dropped for exceeding the annotation limits",
+		[]string{"module"},
+	)
+	
+	r.PricingUpdates = r.registerCounterVec(
+		"leash_pricing_updates_total",
+		"Pricing feed refreshes by result",
+		[]string{"result"}, // applied, rejected, failed
+	)
+	
+	r.PipelineDegraded = r.registerGaugeVec(
+		"leash_pipeline_degraded",
+		"1 while the pipeline is degraded and skips non-essential modules, 0 otherwise",
+		[]string{},
 	)
 	
 	// SLI/SLO metrics
@@ -186,6 +292,14 @@ func (r *Registry) initializeMetrics() {
 		"Remaining error budget (0-1)",
 		[]string{"slo_name", "tenant", "window"}, // 1h, 24h, 30d
 	)
+
+	r.TenantHealthScore = r.registerGaugeVec(
+		"leash_tenant_health_score",
+		"Tenant health score (0-100) combining error rate, latency, rate-limit pressure and cost-limit proximity",
+		[]string{"tenant"},
+	)
+	// Tenants sharing a label report the least healthy among them
+	r.tenantHealthScores = newTenantGauge(r.TenantHealthScore, minValue)
 }
 
 // registerCounterVec creates and registers a counter vector
@@ -230,6 +344,7 @@ func (r *Registry) registerGaugeVec(name, help string, labels []string) *prometh
 
 // RecordHTTPMetrics records HTTP request metrics
 func (r *Registry) RecordHTTPMetrics(tenant, provider, model, method string, status int, duration float64, requestSize, responseSize int64) {
+	tenant = r.TenantLabel(tenant)
 	labels := prometheus.Labels{
 		"tenant":   tenant,
 		"provider": provider,
@@ -246,18 +361,146 @@ func (r *Registry) RecordHTTPMetrics(tenant, provider, model, method string, sta
 
 // RecordBusinessMetrics records business-related metrics
 func (r *Registry) RecordBusinessMetrics(tenant, provider, model string, inputTokens, outputTokens int64, cost float64) {
+	r.RecordTokens(tenant, provider, model, inputTokens, outputTokens, 0)
+	r.CostAccrued.WithLabelValues(r.TenantLabel(tenant), provider, model).Add(cost)
+}
+
+// RecordTokens records processed tokens by type. Reasoning tokens are the
+// part of the output a reasoning model spent thinking; they are counted in
+// output too and only recorded when reported.
+func (r *Registry) RecordTokens(tenant, provider, model string, inputTokens, outputTokens, reasoningTokens int64) {
+	tenant = r.TenantLabel(tenant)
 	r.TokensProcessed.WithLabelValues(tenant, provider, model, "input").Add(float64(inputTokens))
 	r.TokensProcessed.WithLabelValues(tenant, provider, model, "output").Add(float64(outputTokens))
-	r.CostAccrued.WithLabelValues(tenant, provider, model).Add(cost)
+	if reasoningTokens > 0 {
+		r.TokensProcessed.WithLabelValues(tenant, provider, model, "reasoning").Add(float64(reasoningTokens))
+	}
 }
 
 // RecordModuleMetrics records module execution metrics
 func (r *Registry) RecordModuleMetrics(moduleName, moduleType, tenant, status string, duration float64) {
+	tenant = r.TenantLabel(tenant)
 	r.ModuleExecutions.WithLabelValues(moduleName, moduleType, tenant, status).Inc()
 	r.ModuleProcessingDuration.WithLabelValues(moduleName, moduleType, tenant).Observe(duration)
 }
 
+// RecordModuleSkipped records a module that did not run for a request or
+// response, by reason (disabled, draining, bypassed, condition-not-met,
+// degraded)
+func (r *Registry) RecordModuleSkipped(moduleName, moduleType, reason string) {
+	r.ModuleSkips.WithLabelValues(moduleName, moduleType, reason).Inc()
+}
+
+// RecordModuleRetry records a retried module execution
+func (r *Registry) RecordModuleRetry(moduleName, moduleType string) {
+	r.ModuleRetries.WithLabelValues(moduleName, moduleType).Inc()
+}
+
 // RecordModuleError records module error metrics
 func (r *Registry) RecordModuleError(moduleName, moduleType, tenant, errorType string) {
+	tenant = r.TenantLabel(tenant)
 	r.ModuleErrors.WithLabelValues(moduleName, moduleType, tenant, errorType).Inc()
 }
+
+// RecordModuleFailure records a module error classified by its cause
+func (r *Registry) RecordModuleFailure(moduleName, moduleType, tenant string, err error) {
+	r.RecordModuleError(moduleName, moduleType, tenant, gatewayerrors.Classify(err))
+}
+
+// RecordSpendForecast records a tenant's projected end-of-period spend.
+// Tenants whose labels collapse into one series report the sum of their
+// projections.
+func (r *Registry) RecordSpendForecast(tenant string, projectedUSD float64) {
+	r.projectedSpend.set(r.TenantLabel(tenant), tenant, projectedUSD)
+}
+
+// RecordSpendForecastAlert records a forecast of a tenant overrunning its budget
+func (r *Registry) RecordSpendForecastAlert(tenant string) {
+	r.SpendForecastAlerts.WithLabelValues(r.TenantLabel(tenant)).Inc()
+}
+
+// RecordTenantHealthScore records a tenant's current health score. Tenants
+// whose labels collapse into one series report the lowest of their scores.
+func (r *Registry) RecordTenantHealthScore(tenant string, score float64) {
+	r.tenantHealthScores.set(r.TenantLabel(tenant), tenant, score)
+}
+
+// ForgetTenantHealthScore removes the health score of a tenant no longer
+// tracked, keeping the series of other tenants sharing its label
+func (r *Registry) ForgetTenantHealthScore(tenant string) {
+	r.tenantHealthScores.forget(r.TenantLabel(tenant), tenant)
+}
+
+// RecordPolicyViolation records a policy violation
+func (r *Registry) RecordPolicyViolation(tenant, policyName, violationType, action string) {
+	r.PolicyViolations.WithLabelValues(r.TenantLabel(tenant), policyName, violationType, action).Inc()
+}
+
+// RecordPIIDetection records a PII detection in a request or response
+func (r *Registry) RecordPIIDetection(tenant, piiType, location string) {
+	r.PIIDetections.WithLabelValues(r.TenantLabel(tenant), piiType, location).Inc()
+}
+
+// RecordCircuitBreakerTransition records a provider circuit breaker
+// changing state; state is the new state's gauge value
+func (r *Registry) RecordCircuitBreakerTransition(provider, from, to string, state int) {
+	r.CircuitBreakerTransitions.WithLabelValues(provider, from, to).Inc()
+	r.CircuitBreakerState.WithLabelValues(provider).Set(float64(state))
+}
+
+// RecordFingerprintAnomaly records a request flagged for its fingerprint
+// spanning too many tenants or keys
+func (r *Registry) RecordFingerprintAnomaly(reason string) {
+	r.FingerprintAnomalies.WithLabelValues(reason).Inc()
+}
+
+// RecordModerationCheck records a moderation API check of request content
+func (r *Registry) RecordModerationCheck(result string) {
+	r.ModerationChecks.WithLabelValues(result).Inc()
+}
+
+// RecordTenantOnboarded records a tenant created from the onboarding template
+func (r *Registry) RecordTenantOnboarded() {
+	r.TenantsOnboarded.WithLabelValues().Inc()
+}
+
+// RecordSlowRequest records a request phase that exceeded the slow-request
+// threshold
+func (r *Registry) RecordSlowRequest(phase, provider, model string) {
+	r.SlowRequests.WithLabelValues(phase, provider, model).Inc()
+}
+
+// RecordAnnotationsDropped records annotations a module added beyond the
+// annotation limits
+func (r *Registry) RecordAnnotationsDropped(module string, count int) {
+	r.AnnotationsDropped.WithLabelValues(module).Add(float64(count))
+}
+
+// RecordPipelineDegraded records the pipeline entering or leaving degraded
+// mode
+func (r *Registry) RecordPipelineDegraded(degraded bool) {
+	value := 0.0
+	if degraded {
+		value = 1
+	}
+	r.PipelineDegraded.WithLabelValues().Set(value)
+}
+
+// RecordPricingUpdate records a pricing feed refresh
+func (r *Registry) RecordPricingUpdate(result string) {
+	r.PricingUpdates.WithLabelValues(result).Inc()
+}
+
+// RecordTokenEstimateDegraded records a token count that fell back to the
+// character heuristic for a model without a tokenizer
+func (r *Registry) RecordTokenEstimateDegraded(model string) {
+	r.TokenEstimatesDegraded.WithLabelValues(model).Inc()
+}
+
+// RecordProviderError records a provider call error classified by its cause,
+// so provider timeouts are distinguishable from gateway-side timeouts
+func (r *Registry) RecordProviderError(provider, model string, err error) {
+	errorType := gatewayerrors.Classify(err)
+	r.ProviderErrors.WithLabelValues(provider, model, errorType).Inc()
+	r.ProviderRequests.WithLabelValues(provider, errorType, model).Inc()
+}
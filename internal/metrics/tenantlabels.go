@@ -0,0 +1,169 @@
+package metrics
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Tenant label modes
+const (
+	TenantLabelPassthrough = "passthrough" // tenant IDs are used as-is
+	TenantLabelAllowlist   = "allowlist"   // unlisted tenants collapse to OtherLabel
+	TenantLabelHash        = "hash"        // unlisted tenants hash into Buckets buckets
+)
+
+// TenantLabelPolicy bounds the cardinality of tenant labels. Allowlisted
+// tenants always keep their own label in every mode.
+type TenantLabelPolicy struct {
+	Mode       string
+	Allowlist  []string
+	Buckets    int
+	OtherLabel string
+}
+
+// tenantLabeler applies a tenant label policy
+type tenantLabeler struct {
+	mu        sync.RWMutex
+	policy    TenantLabelPolicy
+	allowlist map[string]bool
+	anonymize func(tenant string) string
+}
+
+// SetTenantLabelPolicy sets the policy applied to tenant labels by all
+// recording helpers
+func (r *Registry) SetTenantLabelPolicy(policy TenantLabelPolicy) error {
+	switch policy.Mode {
+	case "", TenantLabelPassthrough, TenantLabelAllowlist:
+	case TenantLabelHash:
+		if policy.Buckets <= 0 {
+			return fmt.Errorf("tenant label hash mode needs a positive bucket count, got %d", policy.Buckets)
+		}
+	default:
+		return fmt.Errorf("unknown tenant label mode: %s", policy.Mode)
+	}
+	if policy.OtherLabel == "" {
+		policy.OtherLabel = "other"
+	}
+
+	allowlist := make(map[string]bool, len(policy.Allowlist))
+	for _, tenant := range policy.Allowlist {
+		allowlist[tenant] = true
+	}
+
+	r.tenantLabels.mu.Lock()
+	defer r.tenantLabels.mu.Unlock()
+	r.tenantLabels.policy = policy
+	r.tenantLabels.allowlist = allowlist
+	return nil
+}
+
+// SetTenantAnonymizer makes labels that would carry a tenant ID carry
+// anonymize(tenant) instead. Collapsed and bucketed labels are unaffected.
+func (r *Registry) SetTenantAnonymizer(anonymize func(tenant string) string) {
+	r.tenantLabels.mu.Lock()
+	defer r.tenantLabels.mu.Unlock()
+	r.tenantLabels.anonymize = anonymize
+}
+
+// TenantLabel returns the label value recorded for a tenant
+func (r *Registry) TenantLabel(tenant string) string {
+	l := &r.tenantLabels
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.allowlist[tenant] {
+		return l.tenantID(tenant)
+	}
+
+	switch l.policy.Mode {
+	case TenantLabelAllowlist:
+		return l.policy.OtherLabel
+	case TenantLabelHash:
+		h := fnv.New32a()
+		h.Write([]byte(tenant))
+		return fmt.Sprintf("bucket_%d", h.Sum32()%uint32(l.policy.Buckets))
+	default:
+		return l.tenantID(tenant)
+	}
+}
+
+// tenantID returns the tenant ID as labelled, anonymized when configured
+func (l *tenantLabeler) tenantID(tenant string) string {
+	if l.anonymize == nil {
+		return tenant
+	}
+	return l.anonymize(tenant)
+}
+
+// tenantGauge is a per-tenant gauge whose label policy may collapse several
+// tenants into one series. Each series is set to an aggregate of the values
+// of every tenant currently sharing its label, so tenants never overwrite
+// each other and forgetting one tenant keeps the others' series.
+type tenantGauge struct {
+	mu        sync.Mutex
+	vec       *prometheus.GaugeVec
+	aggregate func(values map[string]float64) float64
+	values    map[string]map[string]float64 // label -> tenant -> value
+}
+
+func newTenantGauge(vec *prometheus.GaugeVec, aggregate func(values map[string]float64) float64) *tenantGauge {
+	return &tenantGauge{
+		vec:       vec,
+		aggregate: aggregate,
+		values:    make(map[string]map[string]float64),
+	}
+}
+
+// set records a tenant's value and refreshes its label's series
+func (g *tenantGauge) set(label, tenant string, value float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	tenants, ok := g.values[label]
+	if !ok {
+		tenants = make(map[string]float64)
+		g.values[label] = tenants
+	}
+	tenants[tenant] = value
+	g.vec.WithLabelValues(label).Set(g.aggregate(tenants))
+}
+
+// forget drops a tenant's value, deleting its label's series once no
+// tenant shares the label
+func (g *tenantGauge) forget(label, tenant string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	tenants := g.values[label]
+	delete(tenants, tenant)
+	if len(tenants) == 0 {
+		delete(g.values, label)
+		g.vec.DeleteLabelValues(label)
+		return
+	}
+	g.vec.WithLabelValues(label).Set(g.aggregate(tenants))
+}
+
+// minValue aggregates a label's series as its lowest tenant value
+func minValue(values map[string]float64) float64 {
+	first := true
+	lowest := 0.0
+	for _, value := range values {
+		if first || value < lowest {
+			lowest, first = value, false
+		}
+	}
+	return lowest
+}
+
+// sumValues aggregates a label's series as the total of its tenant values
+func sumValues(values map[string]float64) float64 {
+	total := 0.0
+	for _, value := range values {
+		total += value
+	}
+	return total
+}
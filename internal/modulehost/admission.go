@@ -0,0 +1,161 @@
+package modulehost
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Errors returned when a request cannot be admitted
+var (
+	ErrQueueFull    = errors.New("request queue is full")
+	ErrQueueTimeout = errors.New("timed out waiting for capacity")
+)
+
+// AdmissionConfig bounds how many requests run through the pipeline at once.
+// Requests beyond MaxConcurrent wait in a queue of at most MaxQueue entries
+// and are admitted by tenant priority, highest first and in arrival order
+// within a priority, for up to MaxWait.
+type AdmissionConfig struct {
+	MaxConcurrent int
+	MaxQueue      int
+	MaxWait       time.Duration
+}
+
+// admission is a bounded priority queue in front of the pipeline
+type admission struct {
+	config  AdmissionConfig
+	mu      sync.Mutex
+	running int
+	waiting waiters
+	seq     uint64
+}
+
+// waiter is a queued request; ready is closed when it is handed a slot
+type waiter struct {
+	priority int
+	seq      uint64
+	index    int
+	admitted bool
+	ready    chan struct{}
+}
+
+// waiters orders queued requests by priority, then arrival
+type waiters []*waiter
+
+func (w waiters) Len() int { return len(w) }
+func (w waiters) Less(i, j int) bool {
+	if w[i].priority != w[j].priority {
+		return w[i].priority > w[j].priority
+	}
+	return w[i].seq < w[j].seq
+}
+func (w waiters) Swap(i, j int) {
+	w[i], w[j] = w[j], w[i]
+	w[i].index = i
+	w[j].index = j
+}
+func (w *waiters) Push(x interface{}) {
+	item := x.(*waiter)
+	item.index = len(*w)
+	*w = append(*w, item)
+}
+func (w *waiters) Pop() interface{} {
+	old := *w
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*w = old[:len(old)-1]
+	item.index = -1
+	return item
+}
+
+// SetAdmission limits concurrent pipeline requests and queues the rest by
+// tenant priority. A MaxConcurrent of 0 removes the limit.
+func (s *Service) SetAdmission(config AdmissionConfig) error {
+	if config.MaxConcurrent < 0 || config.MaxQueue < 0 || config.MaxWait < 0 {
+		return fmt.Errorf("admission limits cannot be negative")
+	}
+	if config.MaxConcurrent == 0 {
+		s.admission = nil
+		return nil
+	}
+	s.admission = &admission{config: config}
+	return nil
+}
+
+// QueuedRequests returns how many requests are waiting for admission
+func (s *Service) QueuedRequests() int {
+	if s.admission == nil {
+		return 0
+	}
+	s.admission.mu.Lock()
+	defer s.admission.mu.Unlock()
+	return s.admission.waiting.Len()
+}
+
+// acquire waits for a pipeline slot. Requests are admitted immediately while
+// there is capacity and nobody is queued, so queued requests are never
+// overtaken by new arrivals.
+func (a *admission) acquire(ctx context.Context, priority int) error {
+	a.mu.Lock()
+	if a.running < a.config.MaxConcurrent && a.waiting.Len() == 0 {
+		a.running++
+		a.mu.Unlock()
+		return nil
+	}
+	if a.waiting.Len() >= a.config.MaxQueue {
+		a.mu.Unlock()
+		return ErrQueueFull
+	}
+	a.seq++
+	w := &waiter{priority: priority, seq: a.seq, ready: make(chan struct{})}
+	heap.Push(&a.waiting, w)
+	a.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if a.config.MaxWait > 0 {
+		timer := time.NewTimer(a.config.MaxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var err error
+	select {
+	case <-w.ready:
+		return nil
+	case <-timeout:
+		err = ErrQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if w.admitted {
+		// Handed a slot while giving up; pass it on
+		a.releaseLocked()
+	} else {
+		heap.Remove(&a.waiting, w.index)
+	}
+	return err
+}
+
+// release frees a slot, handing it to the highest-priority waiter
+func (a *admission) release() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.releaseLocked()
+}
+
+func (a *admission) releaseLocked() {
+	if a.waiting.Len() == 0 {
+		a.running--
+		return
+	}
+	next := heap.Pop(&a.waiting).(*waiter)
+	next.admitted = true
+	close(next.ready)
+}
@@ -0,0 +1,72 @@
+package modulehost
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+)
+
+// BypassRoute matches requests that skip the module pipeline entirely, such
+// as health-check pings and CORS preflights. Path is a path.Match pattern in
+// which a trailing "/**" matches one or more further segments; an empty or
+// "*" method matches any method.
+type BypassRoute struct {
+	Method string
+	Path   string
+}
+
+// Validate checks the route's path pattern
+func (r BypassRoute) Validate() error {
+	if r.Path == "" {
+		return fmt.Errorf("bypass route path is required")
+	}
+	if _, err := path.Match(r.Path, ""); err != nil {
+		return fmt.Errorf("invalid bypass route path %q: %w", r.Path, err)
+	}
+	return nil
+}
+
+// matches reports whether the route covers a request's method and path
+func (r BypassRoute) matches(method, requestPath string) bool {
+	if r.Method != "" && r.Method != "*" && !strings.EqualFold(r.Method, method) {
+		return false
+	}
+	if prefix, ok := strings.CutSuffix(r.Path, "/**"); ok {
+		// Match the prefix against as many leading segments of the path
+		prefixSegments := strings.Split(prefix, "/")
+		segments := strings.Split(requestPath, "/")
+		if len(segments) <= len(prefixSegments) {
+			return false
+		}
+		matched, _ := path.Match(prefix, strings.Join(segments[:len(prefixSegments)], "/"))
+		return matched
+	}
+	matched, _ := path.Match(r.Path, requestPath)
+	return matched
+}
+
+// SetBypassRoutes configures routes answered at the host boundary without
+// running modules
+func (s *Service) SetBypassRoutes(routes []BypassRoute) error {
+	for _, route := range routes {
+		if err := route.Validate(); err != nil {
+			return err
+		}
+	}
+	s.bypassRoutes = routes
+	return nil
+}
+
+// bypassed reports whether a request matches a bypass route. The query
+// string is ignored.
+func (s *Service) bypassed(req *interfaces.ProcessRequestContext) bool {
+	requestPath, _, _ := strings.Cut(req.Path, "?")
+	for _, route := range s.bypassRoutes {
+		if route.matches(req.Method, requestPath) {
+			return true
+		}
+	}
+	return false
+}
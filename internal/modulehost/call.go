@@ -0,0 +1,152 @@
+package modulehost
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// headerFlags collects repeated --header key=value flags
+type headerFlags map[string]string
+
+func (h headerFlags) String() string { return fmt.Sprint(map[string]string(h)) }
+
+func (h headerFlags) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("header must be key=value, got %q", value)
+	}
+	h[key] = val
+	return nil
+}
+
+// RunCall implements the `module-host call` subcommand: it sends a single
+// ProcessRequest to a running module host and prints the decision
+func RunCall(args []string, stdout, stderr io.Writer) error {
+	headers := headerFlags{}
+
+	fs := flag.NewFlagSet("call", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	addr := fs.String("addr", "localhost:50051", "module host gRPC address")
+	file := fs.String("file", "", "JSON file with the request (flags override its fields)")
+	requestID := fs.String("request-id", "", "request ID")
+	tenant := fs.String("tenant", "", "tenant ID")
+	provider := fs.String("provider", "", "provider name")
+	model := fs.String("model", "", "model name")
+	method := fs.String("method", "", "HTTP method of the proxied request")
+	path := fs.String("path", "", "HTTP path of the proxied request")
+	body := fs.String("body", "", "request body (JSON)")
+	dryRun := fs.Bool("dry-run", false, "skip side effects such as sinks; needs a -header with a trusted principal token allowing them")
+	timeout := fs.Duration("timeout", 10*time.Second, "call timeout")
+	jsonOutput := fs.Bool("json", false, "print the full decision as JSON")
+	fs.Var(headers, "header", "request header as key=value (repeatable)")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	fields := map[string]interface{}{}
+	if *file != "" {
+		data, err := os.ReadFile(*file)
+		if err != nil {
+			return fmt.Errorf("failed to read request file: %w", err)
+		}
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return fmt.Errorf("failed to parse request file: %w", err)
+		}
+	}
+
+	for key, value := range map[string]string{
+		"request_id": *requestID,
+		"tenant_id":  *tenant,
+		"provider":   *provider,
+		"model":      *model,
+		"method":     *method,
+		"path":       *path,
+		"body":       *body,
+	} {
+		if value != "" {
+			fields[key] = value
+		}
+	}
+	if *dryRun {
+		headers[pipeline.DefaultDryRunHeader] = "true"
+	}
+	if len(headers) > 0 {
+		merged, _ := fields["headers"].(map[string]interface{})
+		if merged == nil {
+			merged = map[string]interface{}{}
+		}
+		for key, value := range headers {
+			merged[key] = value
+		}
+		fields["headers"] = merged
+	}
+
+	req, err := structpb.NewStruct(fields)
+	if err != nil {
+		return fmt.Errorf("invalid request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, *addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", *addr, err)
+	}
+	defer conn.Close()
+
+	resp := &structpb.Struct{}
+	if err := conn.Invoke(ctx, ProcessRequestMethod, req, resp); err != nil {
+		return fmt.Errorf("ProcessRequest failed: %w", err)
+	}
+
+	return printDecision(stdout, resp.AsMap(), *jsonOutput)
+}
+
+// printDecision writes a decision as JSON or as human-readable lines
+func printDecision(w io.Writer, decision map[string]interface{}, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(decision)
+	}
+
+	fmt.Fprintf(w, "action: %v\n", decision["action"])
+	if reason, ok := decision["block_reason"]; ok {
+		fmt.Fprintf(w, "block_reason: %v\n", reason)
+	}
+	fmt.Fprintf(w, "request_id: %v\n", decision["request_id"])
+	fmt.Fprintf(w, "processing_time_ms: %v\n", decision["processing_time_ms"])
+
+	for _, section := range []string{"headers", "annotations"} {
+		values, ok := decision[section].(map[string]interface{})
+		if !ok || len(values) == 0 {
+			continue
+		}
+
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		fmt.Fprintf(w, "%s:\n", section)
+		for _, key := range keys {
+			fmt.Fprintf(w, "  %s: %v\n", key, values[key])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package modulehost
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+)
+
+// DefaultTenantRoute maps requests without tenant credentials to a fixed
+// tenant, such as a system tenant for internal routes whose callers carry no
+// API key. Method and Path match as for bypass routes. Requests that carry
+// credentials are resolved from them as usual, and routes without a default
+// tenant still reject requests that carry none.
+type DefaultTenantRoute struct {
+	Method string
+	Path   string
+	Tenant string
+}
+
+// Validate checks the route's tenant and path pattern
+func (r DefaultTenantRoute) Validate() error {
+	if r.Tenant == "" {
+		return fmt.Errorf("default tenant route %s %s needs a tenant", r.Method, r.Path)
+	}
+	if err := (BypassRoute{Method: r.Method, Path: r.Path}).Validate(); err != nil {
+		return fmt.Errorf("default tenant route: %w", err)
+	}
+	return nil
+}
+
+// SetDefaultTenantRoutes configures the tenant assumed for requests without
+// tenant credentials, by route; the first matching route applies
+func (s *Service) SetDefaultTenantRoutes(routes []DefaultTenantRoute) error {
+	for _, route := range routes {
+		if err := route.Validate(); err != nil {
+			return err
+		}
+	}
+	s.defaultTenants = routes
+	return nil
+}
+
+// defaultTenant returns the tenant of the first default tenant route matching
+// the request, ignoring the query string
+func (s *Service) defaultTenant(req *interfaces.ProcessRequestContext) (string, bool) {
+	requestPath, _, _ := strings.Cut(req.Path, "?")
+	for _, route := range s.defaultTenants {
+		if (BypassRoute{Method: route.Method, Path: route.Path}).matches(req.Method, requestPath) {
+			return route.Tenant, true
+		}
+	}
+	return "", false
+}
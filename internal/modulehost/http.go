@@ -0,0 +1,208 @@
+package modulehost
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/bendiamant/leash-gateway/internal/correlation"
+	"github.com/bendiamant/leash-gateway/internal/gatewayerrors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Content types the HTTP ProcessRequest endpoint negotiates between. Protobuf
+// bodies are a serialized google.protobuf.Struct, the message the gRPC API uses.
+const (
+	ContentTypeJSON          = "application/json"
+	ContentTypeProtobuf      = "application/x-protobuf"
+	contentTypeProtobufAlias = "application/protobuf"
+)
+
+// HTTPHandler serves ProcessRequest over plain HTTP with JSON or protobuf
+// bodies, sharing the gRPC service's pipeline path
+type HTTPHandler struct {
+	service         *Service
+	protobufEnabled bool
+	maxBodyBytes    int64
+}
+
+// NewHTTPHandler creates an HTTP ProcessRequest handler. Protobuf bodies are
+// rejected with 415 unless protobufEnabled is set; maxBodyBytes of 0 leaves
+// request bodies unbounded.
+func NewHTTPHandler(service *Service, protobufEnabled bool, maxBodyBytes int64) *HTTPHandler {
+	return &HTTPHandler{
+		service:         service,
+		protobufEnabled: protobufEnabled,
+		maxBodyBytes:    maxBodyBytes,
+	}
+}
+
+func (h *HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		if h.service.envelopes {
+			gatewayerrors.Gateway(http.StatusMethodNotAllowed, gatewayerrors.CodeMethodNotAllowed, "Method not allowed").Write(w)
+			return
+		}
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	requestType, ok := h.contentType(r.Header.Get("Content-Type"), ContentTypeJSON)
+	if !ok {
+		if h.service.envelopes {
+			gatewayerrors.Gateway(http.StatusUnsupportedMediaType, gatewayerrors.CodeUnsupportedMediaType, "Unsupported content type").Write(w)
+			return
+		}
+		http.Error(w, "Unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+	responseType := h.responseType(r.Header.Get("Accept"), requestType)
+
+	body := r.Body
+	if h.maxBodyBytes > 0 {
+		body = http.MaxBytesReader(w, r.Body, h.maxBodyBytes)
+	}
+	payload, err := io.ReadAll(body)
+	if err != nil {
+		h.writeError(w, responseType, status.Errorf(codes.InvalidArgument, "failed to read request: %v", err))
+		return
+	}
+
+	in := &structpb.Struct{}
+	if requestType == ContentTypeProtobuf {
+		err = proto.Unmarshal(payload, in)
+	} else {
+		err = in.UnmarshalJSON(payload)
+	}
+	if err != nil {
+		h.writeError(w, responseType, status.Errorf(codes.InvalidArgument, "invalid request: %v", err))
+		return
+	}
+
+	// The correlation ID header applies when the body does not carry one
+	if id := r.Header.Get(correlation.Header); id != "" {
+		if in.Fields == nil {
+			in.Fields = make(map[string]*structpb.Value)
+		}
+		if _, ok := in.Fields["request_id"]; !ok {
+			in.Fields["request_id"] = structpb.NewStringValue(id)
+		}
+	}
+
+	decision, err := h.service.ProcessRequest(r.Context(), in)
+	if err != nil {
+		h.writeError(w, responseType, err)
+		return
+	}
+	h.write(w, responseType, http.StatusOK, decision)
+}
+
+// contentType resolves a Content-Type or Accept entry to a supported type
+func (h *HTTPHandler) contentType(header, fallback string) (string, bool) {
+	if strings.TrimSpace(header) == "" {
+		return fallback, true
+	}
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return "", false
+	}
+	switch mediaType {
+	case ContentTypeJSON:
+		return ContentTypeJSON, true
+	case ContentTypeProtobuf, contentTypeProtobufAlias:
+		return ContentTypeProtobuf, h.protobufEnabled
+	default:
+		return "", false
+	}
+}
+
+// responseType picks the first supported type from Accept, falling back to
+// the request's content type
+func (h *HTTPHandler) responseType(accept, requestType string) string {
+	for _, entry := range strings.Split(accept, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		if responseType, ok := h.contentType(entry, requestType); ok {
+			return responseType
+		}
+	}
+	return requestType
+}
+
+func (h *HTTPHandler) write(w http.ResponseWriter, contentType string, code int, message *structpb.Struct) {
+	var payload []byte
+	var err error
+	if contentType == ContentTypeProtobuf {
+		payload, err = proto.Marshal(message)
+	} else {
+		payload, err = message.MarshalJSON()
+	}
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(code)
+	w.Write(payload)
+}
+
+// writeError writes a gRPC status error as an {"error": ...} message with
+// the matching HTTP status code
+func (h *HTTPHandler) writeError(w http.ResponseWriter, contentType string, err error) {
+	st := status.Convert(err)
+	message := &structpb.Struct{Fields: map[string]*structpb.Value{
+		"error": structpb.NewStringValue(st.Message()),
+	}}
+	if h.service.envelopes {
+		envelope, encodeErr := structpb.NewStruct(gatewayError(st).Envelope())
+		if encodeErr == nil {
+			message = envelope
+		}
+	}
+	h.write(w, contentType, httpStatus(st.Code()), message)
+}
+
+// gatewayError maps a gRPC status error of the service to its error
+// envelope. Server-side failures get a generic message rather than their
+// internal detail.
+func gatewayError(st *status.Status) *gatewayerrors.ErrorResponse {
+	code := httpStatus(st.Code())
+	switch st.Code() {
+	case codes.InvalidArgument:
+		return gatewayerrors.Gateway(code, gatewayerrors.CodeInvalidRequest, st.Message())
+	case codes.Unauthenticated:
+		return gatewayerrors.Gateway(code, gatewayerrors.CodeUnauthenticated, st.Message())
+	case codes.PermissionDenied:
+		return gatewayerrors.Gateway(code, gatewayerrors.CodePermissionDenied, st.Message())
+	case codes.ResourceExhausted:
+		return gatewayerrors.Gateway(code, gatewayerrors.CodeOverloaded, "Gateway is at capacity, retry later")
+	case codes.Unavailable:
+		return gatewayerrors.Gateway(code, gatewayerrors.CodeUnavailable, "Gateway is temporarily unavailable")
+	default:
+		return gatewayerrors.Gateway(code, gatewayerrors.CodeInternal, "Internal gateway error")
+	}
+}
+
+// httpStatus maps gRPC status codes returned by the service to HTTP
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
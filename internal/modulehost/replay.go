@@ -0,0 +1,78 @@
+package modulehost
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/replay"
+)
+
+// RunReplay implements the `module-host replay` subcommand: it drives the
+// requests in a capture file through a target module host's HTTP endpoint
+// and reports where its decisions differ from the captured ones. It returns
+// an error when any decision differs, so it can gate config changes.
+func RunReplay(args []string, stdout, stderr io.Writer) error {
+	headers := headerFlags{}
+
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	file := fs.String("file", "", "capture file to replay (JSON lines)")
+	target := fs.String("target", "http://localhost:50051/process", "target module host ProcessRequest URL")
+	rate := fs.Float64("rate", 10, "requests per second; 0 is unlimited")
+	tenant := fs.String("tenant", "", "send every request as this tenant instead of the captured one")
+	dryRun := fs.Bool("dry-run", true, "ask for dry runs so the target's sinks are not triggered; needs a -header with a trusted principal token allowing them")
+	timeout := fs.Duration("timeout", 30*time.Second, "per-request timeout")
+	jsonOutput := fs.Bool("json", false, "print the report as JSON")
+	fs.Var(headers, "header", "header added to every request as key=value (repeatable)")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return fmt.Errorf("-file is required")
+	}
+
+	input, err := os.Open(*file)
+	if err != nil {
+		return fmt.Errorf("failed to open capture file: %w", err)
+	}
+	records, err := replay.ReadRecords(input)
+	input.Close()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	replayer := &replay.Replayer{
+		Target:  *target,
+		Rate:    *rate,
+		Tenant:  *tenant,
+		Headers: headers,
+		DryRun:  *dryRun,
+		Client:  &http.Client{Timeout: *timeout},
+	}
+	report, err := replayer.Run(ctx, records)
+	if *jsonOutput {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	} else {
+		report.Write(stdout)
+	}
+	if err != nil {
+		return fmt.Errorf("replay interrupted: %w", err)
+	}
+	if len(report.Differences) > 0 {
+		return fmt.Errorf("%d of %d decisions differ", len(report.Differences), report.Total)
+	}
+	return nil
+}
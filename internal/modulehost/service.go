@@ -0,0 +1,376 @@
+package modulehost
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/correlation"
+	"github.com/bendiamant/leash-gateway/internal/gatewayerrors"
+	"github.com/bendiamant/leash-gateway/internal/health"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"github.com/bendiamant/leash-gateway/internal/replay"
+	"github.com/bendiamant/leash-gateway/internal/tenants"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Service and method names of the module host gRPC API
+const (
+	ServiceName          = "leash.modulehost.v1.ModuleHost"
+	ProcessRequestMethod = "/" + ServiceName + "/ProcessRequest"
+)
+
+// ModuleHostServer is the server API for the ModuleHost service. Requests and
+// responses are google.protobuf.Struct so any gRPC client (or grpcurl via
+// reflection) can call the service with plain JSON objects.
+type ModuleHostServer interface {
+	ProcessRequest(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error)
+}
+
+// Service implements the ModuleHost gRPC service on top of the module pipeline
+type Service struct {
+	pipeline       *pipeline.Pipeline
+	tenants        *tenants.Resolver
+	bypassRoutes   []BypassRoute
+	defaultTenants []DefaultTenantRoute
+	admission      *admission
+	recorder       *replay.Recorder
+	anonymizer     *tenants.Anonymizer
+	logger         *zap.SugaredLogger
+	envelopes      bool
+}
+
+// NewService creates a new module host gRPC service
+func NewService(modulePipeline *pipeline.Pipeline, logger *zap.SugaredLogger) *Service {
+	return &Service{
+		pipeline: modulePipeline,
+		logger:   logger,
+	}
+}
+
+// SetTenantResolver makes the service resolve and verify request tenants
+// through a tenant store instead of trusting the tenant ID as sent
+func (s *Service) SetTenantResolver(resolver *tenants.Resolver) {
+	s.tenants = resolver
+}
+
+// SetTenantAnonymizer makes logs carry tenant pseudonyms instead of tenant
+// IDs
+func (s *Service) SetTenantAnonymizer(anonymizer *tenants.Anonymizer) {
+	s.anonymizer = anonymizer
+}
+
+// SetRecorder captures a sample of processed requests and their decisions for
+// replay against another gateway
+func (s *Service) SetRecorder(recorder *replay.Recorder) {
+	s.recorder = recorder
+}
+
+// SetErrorEnvelope makes the service answer errors, over HTTP, and block
+// decisions with the structured error envelope of package gatewayerrors
+func (s *Service) SetErrorEnvelope(enabled bool) {
+	s.envelopes = enabled
+}
+
+// ProcessRequest runs a request through the module pipeline and returns the decision
+func (s *Service) ProcessRequest(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+	processCtx, err := DecodeRequest(req.AsMap())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid request: %v", err)
+	}
+
+	// Bypass routes are answered before tenant resolution so health pings
+	// and preflights need no credentials
+	if s.bypassed(processCtx) {
+		s.logger.Debugf("Request %s %s %s bypasses the module pipeline", processCtx.RequestID, processCtx.Method, processCtx.Path)
+		return EncodeResult(processCtx.RequestID, &interfaces.ProcessRequestResult{
+			Action:      interfaces.ActionContinue,
+			Annotations: map[string]interface{}{"pipeline_bypassed": true},
+		})
+	}
+
+	tenant, err := s.resolveTenant(ctx, processCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Echo the correlation ID to the caller; this only fails outside a gRPC call
+	grpc.SetHeader(ctx, metadata.Pairs(strings.ToLower(correlation.Header), processCtx.RequestID))
+
+	s.logger.Debugf("Processing gRPC request %s", processCtx.RequestID)
+
+	if s.admission != nil {
+		priority := 0
+		if tenant != nil {
+			priority = tenant.Priority
+		}
+		if err := s.admission.acquire(ctx, priority); err != nil {
+			s.logger.Warnf("Request %s for tenant %s not admitted: %v", processCtx.RequestID, s.anonymizer.TenantID(processCtx.TenantID), err)
+			return nil, status.Errorf(codes.ResourceExhausted, "request not admitted: %v", err)
+		}
+		defer s.admission.release()
+	}
+
+	start := time.Now()
+	result, err := s.pipeline.ProcessRequest(ctx, processCtx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "pipeline failed: %v", err)
+	}
+	if s.recorder != nil {
+		if err := s.recorder.Record(processCtx, result, time.Since(start)); err != nil {
+			s.logger.Warnf("Failed to capture request %s: %v", processCtx.RequestID, err)
+		}
+	}
+
+	decision, err := EncodeResult(processCtx.RequestID, result)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to encode decision: %v", err)
+	}
+	if s.envelopes && result.Action == interfaces.ActionBlock {
+		blocked := gatewayerrors.Policy(result.BlockReason)
+		blocked.RequestID = processCtx.RequestID
+		envelope, err := structpb.NewValue(blocked.Envelope()["error"])
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to encode decision: %v", err)
+		}
+		decision.Fields["error"] = envelope
+	}
+	return decision, nil
+}
+
+// DecodeRequest builds a pipeline request context from a JSON-style request map
+func DecodeRequest(fields map[string]interface{}) (*interfaces.ProcessRequestContext, error) {
+	req := &interfaces.ProcessRequestContext{
+		Timestamp: time.Now(),
+		Method:    http.MethodPost,
+		Headers:   make(map[string]string),
+	}
+
+	req.RequestID, _ = fields["request_id"].(string)
+	req.TenantID, _ = fields["tenant_id"].(string)
+	req.Provider, _ = fields["provider"].(string)
+	req.Model, _ = fields["model"].(string)
+	req.Path, _ = fields["path"].(string)
+	req.UserAgent, _ = fields["user_agent"].(string)
+	req.ClientIP, _ = fields["client_ip"].(string)
+	if method, ok := fields["method"].(string); ok && method != "" {
+		req.Method = strings.ToUpper(method)
+	}
+
+	if headers, ok := fields["headers"].(map[string]interface{}); ok {
+		for key, value := range headers {
+			req.Headers[strings.ToLower(key)] = fmt.Sprint(value)
+		}
+	}
+
+	// The body may be sent as a raw string or as a JSON object
+	switch body := fields["body"].(type) {
+	case nil:
+	case string:
+		req.Body = []byte(body)
+	default:
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid body: %w", err)
+		}
+		req.Body = encoded
+	}
+
+	if req.TenantID == "" {
+		req.TenantID = req.Headers["x-tenant-id"]
+	}
+	// An explicit request_id wins over the correlation header; invalid or
+	// missing IDs are replaced with a generated one
+	if req.RequestID == "" {
+		req.RequestID = req.Headers[strings.ToLower(correlation.Header)]
+	}
+	req.RequestID = correlation.Ensure(req.RequestID)
+	req.Headers[strings.ToLower(correlation.Header)] = req.RequestID
+
+	return req, nil
+}
+
+// resolveTenant sets the request tenant from the tenant resolver, or just
+// requires a tenant ID when no resolver is configured, in which case the
+// returned tenant is nil. A request without tenant credentials on a default
+// tenant route is given the route's tenant.
+func (s *Service) resolveTenant(ctx context.Context, req *interfaces.ProcessRequestContext) (*tenants.Tenant, error) {
+	if s.tenants == nil {
+		if req.TenantID == "" && !s.applyDefaultTenant(req) {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid request: %v", tenants.ErrTenantRequired)
+		}
+		return nil, nil
+	}
+
+	tenant, err := s.tenants.Resolve(ctx, req.TenantID, req.Headers)
+	if errors.Is(err, tenants.ErrTenantRequired) && s.applyDefaultTenant(req) {
+		tenant, err = s.tenants.Resolve(ctx, req.TenantID, req.Headers)
+	}
+	switch {
+	case err == nil:
+		req.TenantID = tenant.ID
+		return tenant, nil
+	case errors.Is(err, tenants.ErrTenantRequired):
+		return nil, status.Errorf(codes.InvalidArgument, "invalid request: %v", err)
+	case errors.Is(err, tenants.ErrUnknownAPIKey):
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, tenants.ErrTenantNotFound):
+		return nil, status.Errorf(codes.PermissionDenied, "%v: %s", err, req.TenantID)
+	case errors.Is(err, tenants.ErrTenantMismatch):
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, tenants.ErrOnboardingLimit):
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	default:
+		return nil, status.Errorf(codes.Unavailable, "tenant resolution failed: %v", err)
+	}
+}
+
+// applyDefaultTenant sets the tenant of the request's default tenant route,
+// annotating that the tenant was not supplied, and reports whether one applied
+func (s *Service) applyDefaultTenant(req *interfaces.ProcessRequestContext) bool {
+	tenantID, ok := s.defaultTenant(req)
+	if !ok {
+		return false
+	}
+	s.logger.Debugf("Request %s %s %s has no tenant credentials, using default tenant %s", req.RequestID, req.Method, req.Path, s.anonymizer.TenantID(tenantID))
+	req.TenantID = tenantID
+	if req.Annotations == nil {
+		req.Annotations = make(map[string]interface{})
+	}
+	req.Annotations["tenant_defaulted"] = true
+	return true
+}
+
+// EncodeResult converts a pipeline decision into a response struct
+func EncodeResult(requestID string, result *interfaces.ProcessRequestResult) (*structpb.Struct, error) {
+	decision := map[string]interface{}{
+		"request_id":         requestID,
+		"action":             result.Action.String(),
+		"processing_time_ms": result.ProcessingTime.Milliseconds(),
+	}
+	if result.BlockReason != "" {
+		decision["block_reason"] = result.BlockReason
+	}
+	if len(result.Annotations) > 0 {
+		decision["annotations"] = result.Annotations
+	}
+	if len(result.AdditionalHeaders) > 0 {
+		decision["headers"] = result.AdditionalHeaders
+	}
+	if len(result.Metadata) > 0 {
+		decision["metadata"] = result.Metadata
+	}
+
+	// Round-trip through JSON so annotation values of any type become Struct-compatible
+	encoded, err := json.Marshal(decision)
+	if err != nil {
+		return nil, err
+	}
+	response := &structpb.Struct{}
+	if err := response.UnmarshalJSON(encoded); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// NewGRPCServer creates a gRPC server exposing the ModuleHost service, the
+// standard health service, and server reflection
+func NewGRPCServer(service ModuleHostServer, healthServer *health.Server, opts ...grpc.ServerOption) *grpc.Server {
+	server := grpc.NewServer(opts...)
+	server.RegisterService(&serviceDesc, service)
+
+	if healthServer != nil {
+		healthServer.SetServingStatus("", grpc_health_v1.HealthCheckResponse_SERVING)
+		healthServer.SetServingStatus(ServiceName, grpc_health_v1.HealthCheckResponse_SERVING)
+		grpc_health_v1.RegisterHealthServer(server, healthServer)
+	}
+
+	reflection.Register(server)
+	return server
+}
+
+// Handler serves gRPC and plain HTTP on the same port, routing by content type.
+// It must be wrapped with h2c when served without TLS.
+func Handler(grpcServer *grpc.Server, httpHandler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			grpcServer.ServeHTTP(w, r)
+			return
+		}
+		httpHandler.ServeHTTP(w, r)
+	})
+}
+
+func processRequestHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ModuleHostServer).ProcessRequest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ProcessRequestMethod,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ModuleHostServer).ProcessRequest(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*ModuleHostServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ProcessRequest",
+			Handler:    processRequestHandler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "leash/modulehost/v1/modulehost.proto",
+}
+
+// The service descriptor is registered with the global registry so server
+// reflection can describe it without generated code
+func init() {
+	file := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("leash/modulehost/v1/modulehost.proto"),
+		Package:    proto.String("leash.modulehost.v1"),
+		Dependency: []string{"google/protobuf/struct.proto"},
+		Syntax:     proto.String("proto3"),
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("ModuleHost"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("ProcessRequest"),
+				InputType:  proto.String(".google.protobuf.Struct"),
+				OutputType: proto.String(".google.protobuf.Struct"),
+			}},
+		}},
+	}
+
+	descriptor, err := protodesc.NewFile(file, protoregistry.GlobalFiles)
+	if err != nil {
+		panic(fmt.Sprintf("modulehost: invalid service descriptor: %v", err))
+	}
+	if err := protoregistry.GlobalFiles.RegisterFile(descriptor); err != nil {
+		panic(fmt.Sprintf("modulehost: failed to register service descriptor: %v", err))
+	}
+}
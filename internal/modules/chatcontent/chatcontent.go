@@ -0,0 +1,334 @@
+package chatcontent
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Image is an image part of a multi-modal message
+type Image struct {
+	URL    string `json:"-"`
+	Inline bool   `json:"inline"` // data: URL carrying the image itself
+	Bytes  int    `json:"bytes"`  // decoded size of inline images, 0 for remote ones
+	Detail string `json:"detail,omitempty"`
+}
+
+// Tool is a tool or function a chat request declares to the model
+type Tool struct {
+	Name string `json:"name"` // function name, or the type of a built-in tool (e.g. web_search)
+	Type string `json:"type"` // function, or the built-in tool type
+}
+
+// Summary is the content extracted from a chat request or response
+type Summary struct {
+	Text       string  // text of all messages, space separated
+	Messages   int     // number of messages
+	TextParts  int     // number of text parts, counting string content as one
+	Images     []Image // image parts in message order
+	ImageBytes int     // total decoded size of inline images
+	Choices    int     // number of completion choices in a response
+	Tools      []Tool  // tools declared by a request, in declaration order
+}
+
+// Scope restricts the request messages whose content is extracted, so a
+// module that only acts on part of a conversation skips the rest of it
+type Scope string
+
+// Request scopes
+const (
+	ScopeAll             Scope = "all"
+	ScopeLastMessage     Scope = "last_message"      // the final message, of any role
+	ScopeLastUserMessage Scope = "last_user_message" // the final user message
+	ScopeUserMessages    Scope = "user_messages"
+	ScopeSystemMessages  Scope = "system_messages" // system and developer messages, and Responses API instructions
+)
+
+// ValidScope reports whether scope is a known request scope
+func ValidScope(scope Scope) bool {
+	switch scope {
+	case ScopeAll, ScopeLastMessage, ScopeLastUserMessage, ScopeUserMessages, ScopeSystemMessages:
+		return true
+	}
+	return false
+}
+
+// requestMessage is one message of a request and the role that sent it
+type requestMessage struct {
+	role    string
+	content interface{}
+}
+
+// ParseRequest extracts the content of a chat request body, either chat
+// completions messages or OpenAI Responses API instructions and input. It
+// returns false when the body is not a JSON object.
+func ParseRequest(body []byte) (*Summary, bool) {
+	return ParseRequestScope(body, ScopeAll)
+}
+
+// ParseRequestScope extracts the content of the request messages in scope;
+// Messages, text, images and their counts cover those messages only, while
+// Tools always lists every declared tool. It returns false when the body is
+// not a JSON object.
+func ParseRequestScope(body []byte, scope Scope) (*Summary, bool) {
+	var requestData map[string]interface{}
+	if err := json.Unmarshal(body, &requestData); err != nil {
+		return nil, false
+	}
+
+	summary := &Summary{}
+	messages := requestMessages(requestData)
+	switch scope {
+	case ScopeLastMessage:
+		if len(messages) > 0 {
+			summary.addMessage(messages[len(messages)-1].content)
+		}
+	case ScopeLastUserMessage:
+		for i := len(messages) - 1; i >= 0; i-- {
+			if messages[i].role == "user" {
+				summary.addMessage(messages[i].content)
+				break
+			}
+		}
+	case ScopeUserMessages:
+		for _, message := range messages {
+			if message.role == "user" {
+				summary.addMessage(message.content)
+			}
+		}
+	case ScopeSystemMessages:
+		for _, message := range messages {
+			if message.role == "system" || message.role == "developer" {
+				summary.addMessage(message.content)
+			}
+		}
+	default:
+		for _, message := range messages {
+			summary.addMessage(message.content)
+		}
+	}
+
+	summary.Tools = parseTools(requestData)
+	return summary, true
+}
+
+// requestMessages lists a request's messages in order: chat completions
+// messages, then Responses API instructions (a system message) and input
+func requestMessages(requestData map[string]interface{}) []requestMessage {
+	var messages []requestMessage
+	chatMessages, _ := requestData["messages"].([]interface{})
+	for _, msg := range chatMessages {
+		if msgMap, ok := msg.(map[string]interface{}); ok {
+			role, _ := msgMap["role"].(string)
+			messages = append(messages, requestMessage{role: role, content: msgMap["content"]})
+		}
+	}
+
+	// Responses API: system instructions, then input given as a string or
+	// as a list of items
+	if instructions, ok := requestData["instructions"].(string); ok && instructions != "" {
+		messages = append(messages, requestMessage{role: "system", content: instructions})
+	}
+	switch input := requestData["input"].(type) {
+	case string:
+		messages = append(messages, requestMessage{role: "user", content: input})
+	case []interface{}:
+		for _, item := range input {
+			itemMap, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			switch itemMap["type"] {
+			case nil, "message":
+				role, _ := itemMap["role"].(string)
+				messages = append(messages, requestMessage{role: role, content: itemMap["content"]})
+			case "function_call_output":
+				messages = append(messages, requestMessage{role: "tool", content: itemMap["output"]})
+			}
+		}
+	}
+	return messages
+}
+
+// parseTools extracts the declared tools of a request: chat completions
+// tools ({"type": "function", "function": {"name"}}) and legacy functions,
+// Responses API tools ({"type": "function", "name"}, or built-ins such as
+// {"type": "web_search"}) and Anthropic tools ({"name", "input_schema"})
+func parseTools(requestData map[string]interface{}) []Tool {
+	var tools []Tool
+	declared, _ := requestData["tools"].([]interface{})
+	for _, item := range declared {
+		toolMap, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		tool := Tool{Type: "function"}
+		if toolType, ok := toolMap["type"].(string); ok && toolType != "" {
+			tool.Type = toolType
+		}
+		if function, ok := toolMap["function"].(map[string]interface{}); ok {
+			tool.Name, _ = function["name"].(string)
+		}
+		if tool.Name == "" {
+			tool.Name, _ = toolMap["name"].(string)
+		}
+		if tool.Name == "" {
+			tool.Name = tool.Type
+		}
+		tools = append(tools, tool)
+	}
+
+	functions, _ := requestData["functions"].([]interface{})
+	for _, item := range functions {
+		if function, ok := item.(map[string]interface{}); ok {
+			if name, ok := function["name"].(string); ok && name != "" {
+				tools = append(tools, Tool{Name: name, Type: "function"})
+			}
+		}
+	}
+	return tools
+}
+
+// ParseResponse extracts the content of a chat completion response body,
+// covering every OpenAI choice (n > 1 returns several, as message content or
+// legacy completion text), OpenAI Responses API output messages and
+// Anthropic-style top-level content arrays. It returns false when the body is
+// not a JSON object.
+func ParseResponse(body []byte) (*Summary, bool) {
+	var responseData map[string]interface{}
+	if err := json.Unmarshal(body, &responseData); err != nil {
+		return nil, false
+	}
+
+	summary := &Summary{}
+	if choices, ok := responseData["choices"].([]interface{}); ok {
+		for _, choice := range choices {
+			choiceMap, ok := choice.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			summary.Choices++
+			if message, ok := choiceMap["message"].(map[string]interface{}); ok {
+				summary.addMessage(message["content"])
+			} else if text, ok := choiceMap["text"].(string); ok {
+				summary.addMessage(text)
+			}
+		}
+	}
+	if content, ok := responseData["content"].([]interface{}); ok {
+		summary.addMessage(content)
+	}
+
+	// Responses API output holds a single completion; reasoning and tool
+	// call items carry no response text
+	if output, ok := responseData["output"].([]interface{}); ok {
+		messages := 0
+		for _, item := range output {
+			if itemMap, ok := item.(map[string]interface{}); ok && itemMap["type"] == "message" {
+				summary.addMessage(itemMap["content"])
+				messages++
+			}
+		}
+		if messages > 0 {
+			summary.Choices++
+		}
+	}
+	return summary, true
+}
+
+// MessageText returns the text of a message's content, which may be a string
+// or an array of parts
+func MessageText(content interface{}) string {
+	summary := &Summary{}
+	summary.addContent(content)
+	return strings.TrimSuffix(summary.Text, " ")
+}
+
+// addMessage adds one message's content to the summary
+func (s *Summary) addMessage(content interface{}) {
+	s.Messages++
+	s.addContent(content)
+}
+
+// addContent walks string or content-array message content
+func (s *Summary) addContent(content interface{}) {
+	switch content := content.(type) {
+	case string:
+		s.addText(content)
+	case []interface{}:
+		for _, part := range content {
+			partMap, ok := part.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			switch partMap["type"] {
+			case "text", "input_text", "output_text":
+				if text, ok := partMap["text"].(string); ok {
+					s.addText(text)
+				}
+			case "image_url":
+				s.addImage(imageURLPart(partMap["image_url"]))
+			case "input_image":
+				// Responses API images give the URL as a string and detail beside it
+				image := imageURLPart(partMap["image_url"])
+				if image.Detail == "" {
+					image.Detail, _ = partMap["detail"].(string)
+				}
+				s.addImage(image)
+			case "image":
+				s.addImage(anthropicImagePart(partMap["source"]))
+			}
+		}
+	}
+}
+
+func (s *Summary) addText(text string) {
+	s.Text += text + " "
+	s.TextParts++
+}
+
+func (s *Summary) addImage(image Image) {
+	s.Images = append(s.Images, image)
+	s.ImageBytes += image.Bytes
+}
+
+// imageURLPart reads an OpenAI image_url part, given as an object or a string
+func imageURLPart(value interface{}) Image {
+	var image Image
+	switch value := value.(type) {
+	case string:
+		image.URL = value
+	case map[string]interface{}:
+		image.URL, _ = value["url"].(string)
+		image.Detail, _ = value["detail"].(string)
+	}
+
+	if strings.HasPrefix(image.URL, "data:") {
+		image.Inline = true
+		if _, data, ok := strings.Cut(image.URL, ","); ok {
+			image.Bytes = base64Size(data)
+		}
+	}
+	return image
+}
+
+// anthropicImagePart reads an Anthropic image part source
+func anthropicImagePart(value interface{}) Image {
+	var image Image
+	source, _ := value.(map[string]interface{})
+	switch source["type"] {
+	case "base64":
+		image.Inline = true
+		if data, ok := source["data"].(string); ok {
+			image.Bytes = base64Size(data)
+		}
+	case "url":
+		image.URL, _ = source["url"].(string)
+	}
+	return image
+}
+
+// base64Size returns the decoded size of base64 data
+func base64Size(data string) int {
+	data = strings.TrimRight(data, "=")
+	return len(data) * 3 / 4
+}
@@ -0,0 +1,543 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/envelope"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"go.uber.org/zap"
+)
+
+// Auditor implements a structured request/response audit sink with per-field retention
+type Auditor struct {
+	name        string
+	version     string
+	description string
+	author      string
+	config      *AuditConfig
+	records     map[string]*AuditRecord
+	order       []*AuditRecord // records oldest first, for eviction at max_records
+	logger      *zap.SugaredLogger
+	status      *interfaces.ModuleStatus
+	startTime   time.Time
+	stopPurge   chan struct{}
+	purgeDone   chan struct{}
+	mu          sync.RWMutex
+	encryptor   *envelope.Encryptor
+}
+
+// AuditConfig represents audit module configuration
+type AuditConfig struct {
+	Retention        map[string]time.Duration `yaml:"retention" json:"retention"`                 // field -> retention, 0 means never stored
+	DefaultRetention time.Duration            `yaml:"default_retention" json:"default_retention"` // for fields without a policy
+	PurgeInterval    time.Duration            `yaml:"purge_interval" json:"purge_interval"`
+	MaxRecords       int                      `yaml:"max_records" json:"max_records"` // the oldest record is evicted beyond this
+}
+
+// AuditRecord represents the retained audit fields of a single request
+type AuditRecord struct {
+	RequestID string                 `json:"request_id"`
+	CreatedAt time.Time              `json:"created_at"`
+	Fields    map[string]interface{} `json:"fields"`
+}
+
+// Audit field names
+const (
+	FieldTenantID     = "tenant_id"
+	FieldProvider     = "provider"
+	FieldModel        = "model"
+	FieldPromptHash   = "prompt_hash"
+	FieldPrompt       = "prompt"
+	FieldResponseHash = "response_hash"
+	FieldResponse     = "response"
+	FieldStatusCode   = "status_code"
+	FieldTokens       = "tokens"
+	FieldCostUSD      = "cost_usd"
+)
+
+// NewAuditor creates a new audit module
+func NewAuditor(logger *zap.SugaredLogger) *Auditor {
+	return &Auditor{
+		name:        "audit",
+		version:     "1.0.0",
+		description: "Structured prompt/response audit with per-field retention",
+		author:      "Leash Security",
+		records:     make(map[string]*AuditRecord),
+		logger:      logger,
+		status: &interfaces.ModuleStatus{
+			State:             interfaces.ModuleStateReady,
+			RequestsProcessed: 0,
+			ErrorCount:        0,
+		},
+	}
+}
+
+// SetBodyEncryptor makes prompts and responses be stored as envelopes sealed
+// with the tenant's key instead of in the clear
+func (a *Auditor) SetBodyEncryptor(encryptor *envelope.Encryptor) {
+	a.encryptor = encryptor
+}
+
+// Metadata methods
+func (a *Auditor) Name() string                { return a.name }
+func (a *Auditor) Version() string             { return a.version }
+func (a *Auditor) Type() interfaces.ModuleType { return interfaces.ModuleTypeSink }
+func (a *Auditor) Description() string         { return a.description }
+func (a *Auditor) Author() string              { return a.author }
+func (a *Auditor) Dependencies() []string      { return []string{} }
+
+// Lifecycle methods
+func (a *Auditor) Initialize(ctx context.Context, config *interfaces.ModuleConfig) error {
+	a.logger.Infof("Initializing audit module")
+
+	auditConfig := &AuditConfig{
+		Retention: map[string]time.Duration{
+			FieldTenantID:   365 * 24 * time.Hour,
+			FieldProvider:   365 * 24 * time.Hour,
+			FieldModel:      365 * 24 * time.Hour,
+			FieldCostUSD:    365 * 24 * time.Hour,
+			FieldTokens:     365 * 24 * time.Hour,
+			FieldStatusCode: 365 * 24 * time.Hour,
+			FieldPromptHash: 90 * 24 * time.Hour,
+			FieldPrompt:     0, // Raw prompts are not retained by default
+			FieldResponse:   0,
+		},
+		DefaultRetention: 30 * 24 * time.Hour,
+		PurgeInterval:    time.Hour,
+		MaxRecords:       100000,
+	}
+
+	// Override with provided config
+	if config != nil && config.Config != nil {
+		if retention, ok := config.Config["retention"].(map[string]interface{}); ok {
+			for field, value := range retention {
+				duration, err := parseRetention(value)
+				if err != nil {
+					return fmt.Errorf("invalid retention for field %s: %w", field, err)
+				}
+				auditConfig.Retention[field] = duration
+			}
+		}
+		if defaultRetention, ok := config.Config["default_retention"]; ok {
+			duration, err := parseRetention(defaultRetention)
+			if err != nil {
+				return fmt.Errorf("invalid default_retention: %w", err)
+			}
+			auditConfig.DefaultRetention = duration
+		}
+		if interval, ok := config.Config["purge_interval"]; ok {
+			duration, err := parsePurgeInterval(interval)
+			if err != nil {
+				return err
+			}
+			auditConfig.PurgeInterval = duration
+		}
+		if maxRecords, ok := config.Config["max_records"]; ok {
+			limit, err := parseMaxRecords(maxRecords)
+			if err != nil {
+				return err
+			}
+			auditConfig.MaxRecords = limit
+		}
+	}
+
+	a.mu.Lock()
+	a.config = auditConfig
+	a.evictLocked()
+	a.mu.Unlock()
+
+	a.startTime = time.Now()
+	a.status.State = interfaces.ModuleStateReady
+
+	a.logger.Infof("Audit module initialized with %d field retention policies, purge interval=%v, max_records=%d",
+		len(auditConfig.Retention), auditConfig.PurgeInterval, auditConfig.MaxRecords)
+	return nil
+}
+
+func (a *Auditor) Start(ctx context.Context) error {
+	a.stopPurge = make(chan struct{})
+	a.purgeDone = make(chan struct{})
+	go a.runPurge(a.config.PurgeInterval, a.stopPurge, a.purgeDone)
+
+	a.status.State = interfaces.ModuleStateRunning
+	a.status.StartTime = time.Now()
+	a.logger.Infof("Audit module started")
+	return nil
+}
+
+func (a *Auditor) Stop(ctx context.Context) error {
+	a.status.State = interfaces.ModuleStateDraining
+	if a.stopPurge != nil {
+		close(a.stopPurge)
+		<-a.purgeDone
+		a.stopPurge = nil
+	}
+	a.logger.Infof("Audit module stopping")
+	return nil
+}
+
+func (a *Auditor) Shutdown(ctx context.Context) error {
+	a.status.State = interfaces.ModuleStateStopped
+	a.logger.Infof("Audit module shutdown")
+	return nil
+}
+
+// Health and status methods
+func (a *Auditor) Health(ctx context.Context) (*interfaces.HealthStatus, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return &interfaces.HealthStatus{
+		Status:        interfaces.HealthStateHealthy,
+		Message:       "Audit module is healthy",
+		LastCheck:     time.Now(),
+		CheckDuration: time.Millisecond,
+		Details: map[string]interface{}{
+			"records":            len(a.records),
+			"retention_policies": len(a.config.Retention),
+		},
+	}, nil
+}
+
+func (a *Auditor) Status() *interfaces.ModuleStatus {
+	status := *a.status
+	status.LastActivity = time.Now()
+	return &status
+}
+
+func (a *Auditor) Metrics() map[string]interface{} {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return map[string]interface{}{
+		"requests_processed": a.status.RequestsProcessed,
+		"errors":             a.status.ErrorCount,
+		"records":            len(a.records),
+		"uptime_seconds":     time.Since(a.startTime).Seconds(),
+	}
+}
+
+// Processing methods
+func (a *Auditor) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequestContext) (*interfaces.ProcessRequestResult, error) {
+	start := time.Now()
+
+	a.record(req.RequestID, req.Timestamp, map[string]interface{}{
+		FieldTenantID:   req.TenantID,
+		FieldProvider:   req.Provider,
+		FieldModel:      req.Model,
+		FieldPromptHash: hashBody(req.Body),
+		FieldPrompt:     a.storedBody(FieldPrompt, req.RequestID, req.TenantID, req.Body),
+	})
+
+	a.status.RequestsProcessed++
+	a.status.LastActivity = time.Now()
+
+	return &interfaces.ProcessRequestResult{
+		Action:         interfaces.ActionContinue,
+		ProcessingTime: time.Since(start),
+		Annotations: map[string]interface{}{
+			"audited": true,
+		},
+	}, nil
+}
+
+func (a *Auditor) ProcessResponse(ctx context.Context, resp *interfaces.ProcessResponseContext) (*interfaces.ProcessResponseResult, error) {
+	start := time.Now()
+
+	fields := map[string]interface{}{
+		FieldStatusCode:   resp.StatusCode,
+		FieldCostUSD:      resp.CostUSD,
+		FieldResponseHash: hashBody(resp.ResponseBody),
+		FieldResponse:     a.storedBody(FieldResponse, resp.RequestID, resp.TenantID, resp.ResponseBody),
+	}
+	if resp.TokensUsed != nil {
+		fields[FieldTokens] = resp.TokensUsed.TotalTokens
+	}
+	a.record(resp.RequestID, resp.Timestamp, fields)
+
+	return &interfaces.ProcessResponseResult{
+		Action:         interfaces.ActionContinue,
+		ProcessingTime: time.Since(start),
+		Annotations: map[string]interface{}{
+			"response_audited": true,
+		},
+	}, nil
+}
+
+// Configuration methods
+func (a *Auditor) ValidateConfig(config *interfaces.ModuleConfig) error {
+	if config == nil {
+		return fmt.Errorf("config cannot be nil")
+	}
+
+	if configMap := config.Config; configMap != nil {
+		if retention, ok := configMap["retention"].(map[string]interface{}); ok {
+			for field, value := range retention {
+				if _, err := parseRetention(value); err != nil {
+					return fmt.Errorf("invalid retention for field %s: %w", field, err)
+				}
+			}
+		}
+		if defaultRetention, ok := configMap["default_retention"]; ok {
+			if _, err := parseRetention(defaultRetention); err != nil {
+				return fmt.Errorf("invalid default_retention: %w", err)
+			}
+		}
+		if interval, ok := configMap["purge_interval"]; ok {
+			if _, err := parsePurgeInterval(interval); err != nil {
+				return err
+			}
+		}
+		if maxRecords, ok := configMap["max_records"]; ok {
+			if _, err := parseMaxRecords(maxRecords); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (a *Auditor) UpdateConfig(ctx context.Context, config *interfaces.ModuleConfig) error {
+	if err := a.ValidateConfig(config); err != nil {
+		return err
+	}
+
+	return a.Initialize(ctx, config)
+}
+
+func (a *Auditor) GetConfig() *interfaces.ModuleConfig {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	retention := make(map[string]string, len(a.config.Retention))
+	for field, duration := range a.config.Retention {
+		retention[field] = duration.String()
+	}
+
+	return &interfaces.ModuleConfig{
+		Name:     a.name,
+		Type:     a.Type().String(),
+		Enabled:  a.status.State == interfaces.ModuleStateRunning,
+		Priority: 950, // Runs alongside other sinks near the end
+		Config: map[string]interface{}{
+			"retention":         retention,
+			"default_retention": a.config.DefaultRetention.String(),
+			"purge_interval":    a.config.PurgeInterval.String(),
+			"max_records":       a.config.MaxRecords,
+		},
+	}
+}
+
+// GetRecord returns a copy of the retained audit record for a request
+func (a *Auditor) GetRecord(requestID string) (*AuditRecord, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	record, exists := a.records[requestID]
+	if !exists {
+		return nil, fmt.Errorf("no audit record for request %s", requestID)
+	}
+
+	recordCopy := &AuditRecord{
+		RequestID: record.RequestID,
+		CreatedAt: record.CreatedAt,
+		Fields:    make(map[string]interface{}, len(record.Fields)),
+	}
+	for field, value := range record.Fields {
+		recordCopy.Fields[field] = value
+	}
+	return recordCopy, nil
+}
+
+// Purge removes every field whose retention has elapsed as of now, and
+// drops records that have no retained fields left. It returns the number
+// of fields purged.
+func (a *Auditor) Purge(now time.Time) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	purged := 0
+	for requestID, record := range a.records {
+		for field := range record.Fields {
+			if !now.Before(record.CreatedAt.Add(a.retentionFor(field))) {
+				delete(record.Fields, field)
+				purged++
+			}
+		}
+		if len(record.Fields) == 0 {
+			delete(a.records, requestID)
+		}
+	}
+	a.compactOrderLocked()
+
+	if purged > 0 {
+		a.logger.Debugf("Audit purge removed %d expired fields", purged)
+	}
+	return purged
+}
+
+// record stores the fields that have a non-zero retention for a request
+func (a *Auditor) record(requestID string, timestamp time.Time, fields map[string]interface{}) {
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	record, exists := a.records[requestID]
+	if !exists {
+		record = &AuditRecord{
+			RequestID: requestID,
+			CreatedAt: timestamp,
+			Fields:    make(map[string]interface{}),
+		}
+		a.records[requestID] = record
+		a.order = append(a.order, record)
+		a.evictLocked()
+	}
+
+	for field, value := range fields {
+		if value == nil || a.retentionFor(field) <= 0 {
+			continue // Zero retention means the field is never stored
+		}
+		record.Fields[field] = value
+	}
+}
+
+// evictLocked drops the oldest records beyond max_records; callers must hold
+// the lock
+func (a *Auditor) evictLocked() {
+	for len(a.records) > a.config.MaxRecords && len(a.order) > 0 {
+		oldest := a.order[0]
+		a.order = a.order[1:]
+		if a.records[oldest.RequestID] == oldest {
+			delete(a.records, oldest.RequestID)
+		}
+	}
+}
+
+// compactOrderLocked drops purged records from the eviction order; callers
+// must hold the lock
+func (a *Auditor) compactOrderLocked() {
+	live := a.order[:0]
+	for _, record := range a.order {
+		if a.records[record.RequestID] == record {
+			live = append(live, record)
+		}
+	}
+	for i := len(live); i < len(a.order); i++ {
+		a.order[i] = nil
+	}
+	a.order = live
+}
+
+// retentionFor returns the retention for a field; callers must hold the lock
+func (a *Auditor) retentionFor(field string) time.Duration {
+	if retention, ok := a.config.Retention[field]; ok {
+		return retention
+	}
+	return a.config.DefaultRetention
+}
+
+// runPurge periodically enforces retention until stopped
+func (a *Auditor) runPurge(interval time.Duration, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			a.Purge(now)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// storedBody returns a body field as it is stored: sealed with the tenant's
+// key when body encryption is enabled, or nil when it is not retained or
+// cannot be encrypted so that it is left out rather than stored in the clear
+func (a *Auditor) storedBody(field, requestID, tenantID string, body []byte) interface{} {
+	if a.encryptor == nil {
+		return string(body)
+	}
+	a.mu.RLock()
+	retained := a.retentionFor(field) > 0
+	a.mu.RUnlock()
+	if !retained {
+		return nil
+	}
+	sealed, err := a.encryptor.Encrypt(tenantID, body)
+	if err != nil {
+		a.logger.Warnf("Omitting body of request %s from the audit record: %v", requestID, err)
+		return nil
+	}
+	return sealed
+}
+
+// hashBody returns a hex-encoded SHA-256 of a body, or empty for no body
+func hashBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// parsePurgeInterval parses purge_interval, which must be a positive duration
+func parsePurgeInterval(value interface{}) (time.Duration, error) {
+	interval, ok := value.(string)
+	if !ok {
+		return 0, fmt.Errorf("purge_interval must be a duration string, got %v", value)
+	}
+	duration, err := time.ParseDuration(interval)
+	if err != nil {
+		return 0, fmt.Errorf("invalid purge_interval: %w", err)
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("purge_interval must be positive, got %v", duration)
+	}
+	return duration, nil
+}
+
+// parseMaxRecords parses max_records, which must be at least 1
+func parseMaxRecords(value interface{}) (int, error) {
+	limit, ok := value.(int)
+	if !ok || limit < 1 {
+		return 0, fmt.Errorf("max_records must be at least 1, got %v", value)
+	}
+	return limit, nil
+}
+
+// parseRetention parses a retention value, accepting Go durations plus a
+// "d" suffix for days (e.g. "90d", "365d")
+func parseRetention(value interface{}) (time.Duration, error) {
+	switch v := value.(type) {
+	case int:
+		return time.Duration(v) * 24 * time.Hour, nil
+	case time.Duration:
+		return v, nil
+	case string:
+		if strings.HasSuffix(v, "d") {
+			days, err := strconv.Atoi(strings.TrimSuffix(v, "d"))
+			if err != nil {
+				return 0, fmt.Errorf("invalid day count %q", v)
+			}
+			return time.Duration(days) * 24 * time.Hour, nil
+		}
+		return time.ParseDuration(v)
+	default:
+		return 0, fmt.Errorf("unsupported retention value %v", value)
+	}
+}
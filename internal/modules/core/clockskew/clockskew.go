@@ -0,0 +1,327 @@
+package clockskew
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"go.uber.org/zap"
+)
+
+// NonceStore records request nonces so a signed request cannot be replayed
+// within the skew window. A store shared with request signing can be set with
+// SetNonceStore; otherwise an in-memory store is used.
+type NonceStore interface {
+	// Remember records a nonce until expiry, reporting false if it was
+	// already recorded and has not expired
+	Remember(nonce string, expiry time.Time) bool
+}
+
+// ClockSkew implements a policy rejecting requests whose client-supplied
+// timestamp is outside the allowed skew from the gateway clock
+type ClockSkew struct {
+	name        string
+	version     string
+	description string
+	author      string
+	config      *ClockSkewConfig
+	nonces      NonceStore
+	logger      *zap.SugaredLogger
+	status      *interfaces.ModuleStatus
+	startTime   time.Time
+}
+
+// ClockSkewConfig represents clock skew policy configuration
+type ClockSkewConfig struct {
+	TimestampHeader  string        `yaml:"timestamp_header" json:"timestamp_header"`   // unix seconds or RFC 3339
+	MaxSkew          time.Duration `yaml:"max_skew" json:"max_skew"`                   // allowed age and future drift
+	RequireTimestamp bool          `yaml:"require_timestamp" json:"require_timestamp"` // block requests without a timestamp
+	NonceHeader      string        `yaml:"nonce_header" json:"nonce_header"`           // empty disables replay checks
+}
+
+// NewClockSkew creates a new clock skew policy module
+func NewClockSkew(logger *zap.SugaredLogger) *ClockSkew {
+	return &ClockSkew{
+		name:        "clock-skew",
+		version:     "1.0.0",
+		description: "Rejects stale, future-dated and replayed client-timestamped requests",
+		author:      "Leash Security",
+		nonces:      newMemoryNonceStore(),
+		logger:      logger,
+		status: &interfaces.ModuleStatus{
+			State:             interfaces.ModuleStateReady,
+			RequestsProcessed: 0,
+			ErrorCount:        0,
+		},
+	}
+}
+
+// SetNonceStore replaces the in-memory nonce store, e.g. with the store used
+// by request signing
+func (cs *ClockSkew) SetNonceStore(store NonceStore) {
+	cs.nonces = store
+}
+
+// Metadata methods
+func (cs *ClockSkew) Name() string                { return cs.name }
+func (cs *ClockSkew) Version() string             { return cs.version }
+func (cs *ClockSkew) Type() interfaces.ModuleType { return interfaces.ModuleTypePolicy }
+func (cs *ClockSkew) Description() string         { return cs.description }
+func (cs *ClockSkew) Author() string              { return cs.author }
+func (cs *ClockSkew) Dependencies() []string      { return []string{} }
+
+// Lifecycle methods
+func (cs *ClockSkew) Initialize(ctx context.Context, config *interfaces.ModuleConfig) error {
+	cs.logger.Infof("Initializing clock skew module")
+
+	skewConfig := &ClockSkewConfig{
+		TimestampHeader:  "X-Leash-Timestamp",
+		MaxSkew:          5 * time.Minute,
+		RequireTimestamp: false,
+		NonceHeader:      "",
+	}
+
+	// Override with provided config
+	if config != nil && config.Config != nil {
+		if header, ok := config.Config["timestamp_header"].(string); ok && header != "" {
+			skewConfig.TimestampHeader = header
+		}
+		if maxSkew, ok := config.Config["max_skew"].(string); ok {
+			if duration, err := time.ParseDuration(maxSkew); err == nil {
+				skewConfig.MaxSkew = duration
+			}
+		}
+		if require, ok := config.Config["require_timestamp"].(bool); ok {
+			skewConfig.RequireTimestamp = require
+		}
+		if header, ok := config.Config["nonce_header"].(string); ok {
+			skewConfig.NonceHeader = header
+		}
+	}
+
+	cs.config = skewConfig
+	cs.startTime = time.Now()
+	cs.status.State = interfaces.ModuleStateReady
+
+	cs.logger.Infof("Clock skew initialized with header=%s, max_skew=%v, require_timestamp=%t",
+		skewConfig.TimestampHeader, skewConfig.MaxSkew, skewConfig.RequireTimestamp)
+	return nil
+}
+
+func (cs *ClockSkew) Start(ctx context.Context) error {
+	cs.status.State = interfaces.ModuleStateRunning
+	cs.status.StartTime = time.Now()
+	cs.logger.Infof("Clock skew module started")
+	return nil
+}
+
+func (cs *ClockSkew) Stop(ctx context.Context) error {
+	cs.status.State = interfaces.ModuleStateDraining
+	cs.logger.Infof("Clock skew module stopping")
+	return nil
+}
+
+func (cs *ClockSkew) Shutdown(ctx context.Context) error {
+	cs.status.State = interfaces.ModuleStateStopped
+	cs.logger.Infof("Clock skew module shutdown")
+	return nil
+}
+
+// Health and status methods
+func (cs *ClockSkew) Health(ctx context.Context) (*interfaces.HealthStatus, error) {
+	return &interfaces.HealthStatus{
+		Status:        interfaces.HealthStateHealthy,
+		Message:       "Clock skew policy is healthy",
+		LastCheck:     time.Now(),
+		CheckDuration: time.Millisecond,
+		Details: map[string]interface{}{
+			"max_skew": cs.config.MaxSkew.String(),
+		},
+	}, nil
+}
+
+func (cs *ClockSkew) Status() *interfaces.ModuleStatus {
+	status := *cs.status
+	status.LastActivity = time.Now()
+	return &status
+}
+
+func (cs *ClockSkew) Metrics() map[string]interface{} {
+	return map[string]interface{}{
+		"requests_processed": cs.status.RequestsProcessed,
+		"errors":             cs.status.ErrorCount,
+		"uptime_seconds":     time.Since(cs.startTime).Seconds(),
+	}
+}
+
+// Processing methods
+func (cs *ClockSkew) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequestContext) (*interfaces.ProcessRequestResult, error) {
+	start := time.Now()
+	cs.status.RequestsProcessed++
+	cs.status.LastActivity = time.Now()
+
+	value := header(req.Headers, cs.config.TimestampHeader)
+	if value == "" {
+		if cs.config.RequireTimestamp {
+			return cs.block(req, start, "missing_timestamp", fmt.Sprintf("request timestamp header %s is required", cs.config.TimestampHeader)), nil
+		}
+		return &interfaces.ProcessRequestResult{
+			Action:         interfaces.ActionContinue,
+			ProcessingTime: time.Since(start),
+		}, nil
+	}
+
+	timestamp, err := parseTimestamp(value)
+	if err != nil {
+		return cs.block(req, start, "invalid_timestamp", fmt.Sprintf("invalid request timestamp %q", value)), nil
+	}
+
+	skew := time.Since(timestamp)
+	switch {
+	case skew > cs.config.MaxSkew:
+		return cs.block(req, start, "stale_timestamp", fmt.Sprintf("request timestamp is %v old, more than the allowed %v", skew.Round(time.Second), cs.config.MaxSkew)), nil
+	case -skew > cs.config.MaxSkew:
+		return cs.block(req, start, "future_timestamp", fmt.Sprintf("request timestamp is %v in the future, more than the allowed %v", (-skew).Round(time.Second), cs.config.MaxSkew)), nil
+	}
+
+	// A nonce only needs remembering while its timestamp is acceptable
+	if nonce := header(req.Headers, cs.config.NonceHeader); cs.config.NonceHeader != "" && nonce != "" {
+		if !cs.nonces.Remember(req.TenantID+":"+nonce, timestamp.Add(cs.config.MaxSkew)) {
+			return cs.block(req, start, "replayed_nonce", "request nonce has already been used"), nil
+		}
+	}
+
+	return &interfaces.ProcessRequestResult{
+		Action:         interfaces.ActionContinue,
+		ProcessingTime: time.Since(start),
+		Annotations: map[string]interface{}{
+			"clock_skew_ms": skew.Milliseconds(),
+		},
+	}, nil
+}
+
+func (cs *ClockSkew) ProcessResponse(ctx context.Context, resp *interfaces.ProcessResponseContext) (*interfaces.ProcessResponseResult, error) {
+	// Clock skew policy doesn't need to process responses
+	return &interfaces.ProcessResponseResult{
+		Action: interfaces.ActionContinue,
+	}, nil
+}
+
+// block rejects a request with a 401, as a signature check would
+func (cs *ClockSkew) block(req *interfaces.ProcessRequestContext, start time.Time, violation, reason string) *interfaces.ProcessRequestResult {
+	cs.logger.Warnf("Blocking request %s: %s", req.RequestID, reason)
+	return &interfaces.ProcessRequestResult{
+		Action:         interfaces.ActionBlock,
+		BlockReason:    reason,
+		ProcessingTime: time.Since(start),
+		Annotations: map[string]interface{}{
+			"clock_skew_violation": violation,
+		},
+		Metadata: map[string]string{
+			"status_code": strconv.Itoa(http.StatusUnauthorized),
+		},
+	}
+}
+
+// Configuration methods
+func (cs *ClockSkew) ValidateConfig(config *interfaces.ModuleConfig) error {
+	if config == nil {
+		return fmt.Errorf("config cannot be nil")
+	}
+
+	if configMap := config.Config; configMap != nil {
+		if maxSkew, ok := configMap["max_skew"].(string); ok {
+			duration, err := time.ParseDuration(maxSkew)
+			if err != nil {
+				return fmt.Errorf("invalid max_skew: %w", err)
+			}
+			if duration <= 0 {
+				return fmt.Errorf("max_skew must be positive, got %v", duration)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (cs *ClockSkew) UpdateConfig(ctx context.Context, config *interfaces.ModuleConfig) error {
+	if err := cs.ValidateConfig(config); err != nil {
+		return err
+	}
+
+	return cs.Initialize(ctx, config)
+}
+
+func (cs *ClockSkew) GetConfig() *interfaces.ModuleConfig {
+	return &interfaces.ModuleConfig{
+		Name:     cs.name,
+		Type:     cs.Type().String(),
+		Enabled:  cs.status.State == interfaces.ModuleStateRunning,
+		Priority: 60, // Before model policy and rate limiting so replays never consume quota
+		Config: map[string]interface{}{
+			"timestamp_header":  cs.config.TimestampHeader,
+			"max_skew":          cs.config.MaxSkew.String(),
+			"require_timestamp": cs.config.RequireTimestamp,
+			"nonce_header":      cs.config.NonceHeader,
+		},
+	}
+}
+
+// header returns a header value by case-insensitive name
+func header(headers map[string]string, name string) string {
+	if name == "" {
+		return ""
+	}
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// parseTimestamp accepts unix seconds or an RFC 3339 time
+func parseTimestamp(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// memoryNonceStore is the default in-process nonce store
+type memoryNonceStore struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+	swept  time.Time
+}
+
+func newMemoryNonceStore() *memoryNonceStore {
+	return &memoryNonceStore{nonces: make(map[string]time.Time)}
+}
+
+// Remember records a nonce, dropping expired ones at most once a minute
+func (s *memoryNonceStore) Remember(nonce string, expiry time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.swept) > time.Minute {
+		for key, expires := range s.nonces {
+			if now.After(expires) {
+				delete(s.nonces, key)
+			}
+		}
+		s.swept = now
+	}
+
+	if expires, seen := s.nonces[nonce]; seen && now.Before(expires) {
+		return false
+	}
+	s.nonces[nonce] = expiry
+	return true
+}
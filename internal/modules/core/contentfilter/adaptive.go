@@ -0,0 +1,160 @@
+package contentfilter
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// Feedback on a content filter decision, e.g. from a human-review step
+const (
+	FeedbackFalsePositive = "false_positive" // flagged content was acceptable
+	FeedbackConfirmed     = "confirmed"      // flagged content was a real violation
+)
+
+// DefaultFeedbackAnnotation is the request annotation carrying feedback for
+// the request's tenant
+const DefaultFeedbackAnnotation = "content_filter_feedback"
+
+// AdaptiveThresholdConfig adjusts severity_threshold per tenant from feedback.
+// Each false positive raises the tenant's threshold by Step and each
+// confirmed violation lowers it, always within [MinThreshold, MaxThreshold],
+// so detections at or above MaxThreshold are acted on for every tenant.
+type AdaptiveThresholdConfig struct {
+	Enabled            bool    `yaml:"enabled" json:"enabled"`
+	MinThreshold       float64 `yaml:"min_threshold" json:"min_threshold"`             // Defaults to severity_threshold
+	MaxThreshold       float64 `yaml:"max_threshold" json:"max_threshold"`             // Defaults to severity_threshold + 0.1
+	Step               float64 `yaml:"step" json:"step"`                               // Adjustment per feedback signal
+	FeedbackAnnotation string  `yaml:"feedback_annotation" json:"feedback_annotation"` // Request annotation carrying feedback
+}
+
+// adaptiveThresholds holds the learned threshold of each tenant that has
+// received feedback. It outlives config updates; thresholds are clamped to
+// the current bounds when read.
+type adaptiveThresholds struct {
+	mu         sync.Mutex
+	thresholds map[string]float64
+}
+
+func newAdaptiveThresholds() *adaptiveThresholds {
+	return &adaptiveThresholds{thresholds: make(map[string]float64)}
+}
+
+// parseAdaptiveThreshold reads the adaptive threshold settings from module
+// config, defaulting the bounds around the static severity threshold
+func parseAdaptiveThreshold(raw interface{}, base float64) (AdaptiveThresholdConfig, error) {
+	adaptive := AdaptiveThresholdConfig{
+		MinThreshold:       base,
+		MaxThreshold:       math.Min(base+0.1, 1),
+		Step:               0.01,
+		FeedbackAnnotation: DefaultFeedbackAnnotation,
+	}
+
+	fields, ok := raw.(map[string]interface{})
+	if !ok {
+		return adaptive, fmt.Errorf("adaptive_threshold must be a map")
+	}
+	if enabled, ok := fields["enabled"].(bool); ok {
+		adaptive.Enabled = enabled
+	}
+	for key, target := range map[string]*float64{
+		"min_threshold": &adaptive.MinThreshold,
+		"max_threshold": &adaptive.MaxThreshold,
+		"step":          &adaptive.Step,
+	} {
+		if value, exists := fields[key]; exists {
+			number, ok := toFloat(value)
+			if !ok || number < 0 || number > 1 {
+				return adaptive, fmt.Errorf("adaptive_threshold %s must be between 0 and 1, got %v", key, value)
+			}
+			*target = number
+		}
+	}
+	if annotation, ok := fields["feedback_annotation"].(string); ok && annotation != "" {
+		adaptive.FeedbackAnnotation = annotation
+	}
+
+	if adaptive.MinThreshold > adaptive.MaxThreshold {
+		return adaptive, fmt.Errorf("adaptive_threshold min_threshold %v exceeds max_threshold %v", adaptive.MinThreshold, adaptive.MaxThreshold)
+	}
+	if adaptive.Step == 0 {
+		return adaptive, fmt.Errorf("adaptive_threshold step must be positive")
+	}
+	return adaptive, nil
+}
+
+// Threshold returns the severity threshold applied to a tenant: its learned
+// threshold when adaptive thresholds are enabled, otherwise severity_threshold
+func (cf *ContentFilter) Threshold(tenantID string) float64 {
+	adaptive := cf.config.AdaptiveThreshold
+	if !adaptive.Enabled {
+		return cf.config.SeverityThreshold
+	}
+
+	cf.adaptive.mu.Lock()
+	threshold, ok := cf.adaptive.thresholds[tenantID]
+	cf.adaptive.mu.Unlock()
+	if !ok {
+		threshold = cf.config.SeverityThreshold
+	}
+	return clampThreshold(threshold, adaptive)
+}
+
+// RecordFeedback adjusts a tenant's threshold from feedback on one of its
+// decisions and returns the new threshold. It is a no-op unless adaptive
+// thresholds are enabled.
+func (cf *ContentFilter) RecordFeedback(tenantID, feedback string) (float64, error) {
+	adaptive := cf.config.AdaptiveThreshold
+	var delta float64
+	switch feedback {
+	case FeedbackFalsePositive:
+		delta = adaptive.Step
+	case FeedbackConfirmed:
+		delta = -adaptive.Step
+	default:
+		return 0, fmt.Errorf("unknown content filter feedback: %s", feedback)
+	}
+	if !adaptive.Enabled {
+		return cf.config.SeverityThreshold, nil
+	}
+
+	cf.adaptive.mu.Lock()
+	threshold, ok := cf.adaptive.thresholds[tenantID]
+	if !ok {
+		threshold = cf.config.SeverityThreshold
+	}
+	threshold = clampThreshold(clampThreshold(threshold, adaptive)+delta, adaptive)
+	cf.adaptive.thresholds[tenantID] = threshold
+	cf.adaptive.mu.Unlock()
+
+	cf.logger.Infof("Content filter threshold for tenant %s adjusted to %.3f after %s feedback", tenantID, threshold, feedback)
+	return threshold, nil
+}
+
+// recordAnnotatedFeedback records feedback a request carries in the
+// configured annotation, e.g. set by a human-review step upstream
+func (cf *ContentFilter) recordAnnotatedFeedback(tenantID string, annotations map[string]interface{}) {
+	adaptive := cf.config.AdaptiveThreshold
+	if !adaptive.Enabled || annotations == nil {
+		return
+	}
+	feedback, ok := annotations[adaptive.FeedbackAnnotation].(string)
+	if !ok || feedback == "" {
+		return
+	}
+	if _, err := cf.RecordFeedback(tenantID, feedback); err != nil {
+		cf.logger.Warnf("Ignoring content filter feedback for tenant %s: %v", tenantID, err)
+	}
+}
+
+// adjustedTenants returns how many tenants have a learned threshold
+func (cf *ContentFilter) adjustedTenants() int {
+	cf.adaptive.mu.Lock()
+	defer cf.adaptive.mu.Unlock()
+	return len(cf.adaptive.thresholds)
+}
+
+// clampThreshold keeps a threshold within the adaptive bounds
+func clampThreshold(threshold float64, adaptive AdaptiveThresholdConfig) float64 {
+	return math.Max(adaptive.MinThreshold, math.Min(adaptive.MaxThreshold, threshold))
+}
@@ -0,0 +1,156 @@
+package contentfilter
+
+import "strings"
+
+// Keyword matchers
+const (
+	MatcherAhoCorasick = "aho-corasick" // one pass over the content for all keywords
+	MatcherLinear      = "linear"       // one substring scan per keyword
+)
+
+var validMatchers = map[string]bool{
+	MatcherAhoCorasick: true,
+	MatcherLinear:      true,
+}
+
+// keywordAutomaton is an Aho-Corasick automaton over the blocked keywords.
+// It is compiled to a DFA whose alphabet is the bytes that occur in some
+// keyword, so a scan costs one table lookup per content byte however many
+// keywords are configured. Matching is byte-wise, exactly like
+// strings.Contains, so the results are the same as the linear scan.
+type keywordAutomaton struct {
+	classes  [256]int32 // byte -> alphabet class; 0 for bytes in no keyword
+	width    int32      // number of alphabet classes
+	delta    []int32    // state*width+class -> next state
+	terminal [][]int    // keyword indexes ending exactly at each state
+	dict     []int32    // nearest terminal state on the failure chain; 0 for none
+	always   []int      // empty keywords, which match any content
+	keywords int
+}
+
+// newKeywordAutomaton builds the automaton for keywords, which must already
+// be case-folded the way the content will be
+func newKeywordAutomaton(keywords []string) *keywordAutomaton {
+	a := &keywordAutomaton{keywords: len(keywords)}
+
+	a.width = 1
+	for _, keyword := range keywords {
+		for i := 0; i < len(keyword); i++ {
+			if a.classes[keyword[i]] == 0 {
+				a.classes[keyword[i]] = a.width
+				a.width++
+			}
+		}
+	}
+
+	// Build the trie, with -1 for missing transitions
+	a.delta = a.newState(nil)
+	a.terminal = [][]int{nil}
+	for i, keyword := range keywords {
+		if keyword == "" {
+			a.always = append(a.always, i)
+			continue
+		}
+		state := int32(0)
+		for j := 0; j < len(keyword); j++ {
+			slot := state*a.width + a.classes[keyword[j]]
+			if a.delta[slot] < 0 {
+				a.delta[slot] = int32(len(a.terminal))
+				a.delta = a.newState(a.delta)
+				a.terminal = append(a.terminal, nil)
+			}
+			state = a.delta[slot]
+		}
+		a.terminal[state] = append(a.terminal[state], i)
+	}
+
+	// Fill in failure transitions breadth-first, turning the trie into a DFA
+	states := len(a.terminal)
+	fail := make([]int32, states)
+	a.dict = make([]int32, states)
+	queue := make([]int32, 0, states)
+	for class := int32(0); class < a.width; class++ {
+		if child := a.delta[class]; child > 0 {
+			queue = append(queue, child)
+		} else {
+			a.delta[class] = 0
+		}
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		if f := fail[state]; len(a.terminal[f]) > 0 {
+			a.dict[state] = f
+		} else {
+			a.dict[state] = a.dict[f]
+		}
+
+		row := a.delta[state*a.width : (state+1)*a.width]
+		failRow := a.delta[fail[state]*a.width : (fail[state]+1)*a.width]
+		for class, child := range row {
+			if child < 0 {
+				row[class] = failRow[class]
+				continue
+			}
+			fail[child] = failRow[class]
+			queue = append(queue, child)
+		}
+	}
+
+	return a
+}
+
+// newState appends a row of missing transitions to delta
+func (a *keywordAutomaton) newState(delta []int32) []int32 {
+	for i := int32(0); i < a.width; i++ {
+		delta = append(delta, -1)
+	}
+	return delta
+}
+
+// match reports which keywords occur in content, indexed like the keywords
+// the automaton was built from
+func (a *keywordAutomaton) match(content string) []bool {
+	found := make([]bool, a.keywords)
+	remaining := a.keywords
+	for _, i := range a.always {
+		found[i] = true
+		remaining--
+	}
+
+	// seen marks terminal states already reported, so their failure chains
+	// are only walked once
+	seen := make([]bool, len(a.terminal))
+	state := int32(0)
+	for i := 0; i < len(content) && remaining > 0; i++ {
+		state = a.delta[state*a.width+a.classes[content[i]]]
+		for t := state; t > 0 && !seen[t]; t = a.dict[t] {
+			if len(a.terminal[t]) == 0 {
+				continue
+			}
+			seen[t] = true
+			for _, keyword := range a.terminal[t] {
+				found[keyword] = true
+				remaining--
+			}
+		}
+	}
+	return found
+}
+
+// matchKeywords reports which blocked keywords occur in content, which has
+// already been case-folded unless matching is case-sensitive
+func (cf *ContentFilter) matchKeywords(content string) []bool {
+	if cf.keywords != nil {
+		return cf.keywords.match(content)
+	}
+
+	found := make([]bool, len(cf.config.BlockedKeywords))
+	for i, keyword := range cf.config.BlockedKeywords {
+		if !cf.config.CaseSensitive {
+			keyword = strings.ToLower(keyword)
+		}
+		found[i] = strings.Contains(content, keyword)
+	}
+	return found
+}
@@ -2,12 +2,13 @@ package contentfilter
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/bendiamant/leash-gateway/internal/modules/chatcontent"
 	"github.com/bendiamant/leash-gateway/internal/modules/interface"
 	"go.uber.org/zap"
 )
@@ -20,6 +21,8 @@ type ContentFilter struct {
 	author      string
 	config      *ContentFilterConfig
 	patterns    []*regexp.Regexp
+	keywords    *keywordAutomaton // nil when keywords are matched linearly
+	adaptive    *adaptiveThresholds
 	logger      *zap.SugaredLogger
 	status      *interfaces.ModuleStatus
 	startTime   time.Time
@@ -27,23 +30,56 @@ type ContentFilter struct {
 
 // ContentFilterConfig represents content filter configuration
 type ContentFilterConfig struct {
-	BlockedKeywords    []string  `yaml:"blocked_keywords" json:"blocked_keywords"`
-	BlockedPatterns    []string  `yaml:"blocked_patterns" json:"blocked_patterns"`
-	SeverityThreshold  float64   `yaml:"severity_threshold" json:"severity_threshold"`
-	Action             string    `yaml:"action" json:"action"` // block, warn, annotate, redact
-	CaseSensitive      bool      `yaml:"case_sensitive" json:"case_sensitive"`
-	CheckRequests      bool      `yaml:"check_requests" json:"check_requests"`
-	CheckResponses     bool      `yaml:"check_responses" json:"check_responses"`
-	RedactionText      string    `yaml:"redaction_text" json:"redaction_text"`
+	BlockedKeywords   []string                `yaml:"blocked_keywords" json:"blocked_keywords"`
+	BlockedPatterns   []string                `yaml:"blocked_patterns" json:"blocked_patterns"`
+	SeverityThreshold float64                 `yaml:"severity_threshold" json:"severity_threshold"`
+	Action            string                  `yaml:"action" json:"action"`                     // block, warn, annotate, redact
+	SeverityBands     []SeverityBand          `yaml:"severity_bands" json:"severity_bands"`     // Replace severity_threshold and action when set
+	MatchConfidence   map[string]float64      `yaml:"match_confidence" json:"match_confidence"` // Confidence of individual keywords and patterns
+	CaseSensitive     bool                    `yaml:"case_sensitive" json:"case_sensitive"`
+	CheckRequests     bool                    `yaml:"check_requests" json:"check_requests"`
+	CheckResponses    bool                    `yaml:"check_responses" json:"check_responses"`
+	RedactionText     string                  `yaml:"redaction_text" json:"redaction_text"`
+	NormalizeUnicode  bool                    `yaml:"normalize_unicode" json:"normalize_unicode"`         // NFKC + strip zero-width chars before matching
+	FoldHomoglyphs    bool                    `yaml:"fold_homoglyphs" json:"fold_homoglyphs"`             // Map look-alike letters to Latin when normalizing
+	WarningHeader     string                  `yaml:"warning_header" json:"warning_header"`               // Header set on flagged content with the warn action
+	CaptureContext    bool                    `yaml:"capture_match_context" json:"capture_match_context"` // Record a redacted snippet around each match
+	ContextChars      int                     `yaml:"match_context_chars" json:"match_context_chars"`     // Characters kept either side of a match; the rest is redacted
+	RedactionAudit    bool                    `yaml:"redaction_audit" json:"redaction_audit"`             // Annotate redactions with rule, location and hash for the redaction audit sink
+	RedactionAuditKey string                  `yaml:"redaction_audit_hash_key" json:"-"`                  // HMAC key for hashing redacted text; plain SHA-256 when empty
+	KeywordMatcher    string                  `yaml:"keyword_matcher" json:"keyword_matcher"`             // aho-corasick or linear
+	AdaptiveThreshold AdaptiveThresholdConfig `yaml:"adaptive_threshold" json:"adaptive_threshold"`       // Per-tenant severity_threshold learned from feedback
+	RequestScope      chatcontent.Scope       `yaml:"request_scope" json:"request_scope"`                 // Request messages checked: all, last_message, last_user_message, user_messages, system_messages
 }
 
+// SeverityBand applies an action to detections whose confidence is at least
+// MinConfidence and below the next band's
+type SeverityBand struct {
+	MinConfidence float64 `yaml:"min_confidence" json:"min_confidence"`
+	Action        string  `yaml:"action" json:"action"`
+}
+
+// validActions are the actions a detection can trigger
+var validActions = map[string]bool{
+	"block": true, "warn": true, "annotate": true, "redact": true,
+}
+
+// Default confidence of keyword and pattern matches
+const (
+	keywordConfidence = 0.9
+	patternConfidence = 0.8
+)
+
 // DetectionResult represents content detection result
 type DetectionResult struct {
-	Detected   bool     `json:"detected"`
-	Matches    []string `json:"matches"`
-	Confidence float64  `json:"confidence"`
-	Action     string   `json:"action"`
-	Message    string   `json:"message"`
+	Detected   bool           `json:"detected"`
+	Matches    []string       `json:"matches"`
+	RuleIDs    []string       `json:"rule_ids"` // Matched rules by position, e.g. keyword-1 or pattern-2
+	Confidence float64        `json:"confidence"`
+	Action     string         `json:"action"`
+	Message    string         `json:"message"`
+	Normalized bool           `json:"normalized"`         // Normalization altered the checked content
+	Contexts   []MatchContext `json:"contexts,omitempty"` // Redacted match snippets, when capture is enabled
 }
 
 // NewContentFilter creates a new content filter module
@@ -53,6 +89,7 @@ func NewContentFilter(logger *zap.SugaredLogger) *ContentFilter {
 		version:     "1.0.0",
 		description: "Content filtering module for detecting and blocking inappropriate content",
 		author:      "Leash Security",
+		adaptive:    newAdaptiveThresholds(),
 		logger:      logger,
 		status: &interfaces.ModuleStatus{
 			State:             interfaces.ModuleStateReady,
@@ -83,6 +120,14 @@ func (cf *ContentFilter) Initialize(ctx context.Context, config *interfaces.Modu
 		CheckRequests:     true,
 		CheckResponses:    true,
 		RedactionText:     "[FILTERED]",
+		NormalizeUnicode:  false,
+		FoldHomoglyphs:    true,
+		WarningHeader:     "X-Leash-Content-Warning",
+		CaptureContext:    false,
+		ContextChars:      20,
+		RedactionAudit:    false,
+		KeywordMatcher:    MatcherAhoCorasick,
+		RequestScope:      chatcontent.ScopeAll,
 	}
 
 	// Override with provided config
@@ -123,29 +168,99 @@ func (cf *ContentFilter) Initialize(ctx context.Context, config *interfaces.Modu
 		if redactionText, ok := config.Config["redaction_text"].(string); ok {
 			filterConfig.RedactionText = redactionText
 		}
+		if normalizeUnicode, ok := config.Config["normalize_unicode"].(bool); ok {
+			filterConfig.NormalizeUnicode = normalizeUnicode
+		}
+		if foldHomoglyphs, ok := config.Config["fold_homoglyphs"].(bool); ok {
+			filterConfig.FoldHomoglyphs = foldHomoglyphs
+		}
+		if warningHeader, ok := config.Config["warning_header"].(string); ok && warningHeader != "" {
+			filterConfig.WarningHeader = warningHeader
+		}
+		if rawBands, ok := config.Config["severity_bands"]; ok {
+			bands, err := parseSeverityBands(rawBands)
+			if err != nil {
+				return err
+			}
+			filterConfig.SeverityBands = bands
+		}
+		if rawConfidences, ok := config.Config["match_confidence"]; ok {
+			confidences, err := parseMatchConfidence(rawConfidences)
+			if err != nil {
+				return err
+			}
+			filterConfig.MatchConfidence = confidences
+		}
+		if captureMatchContext, ok := config.Config["capture_match_context"].(bool); ok {
+			filterConfig.CaptureContext = captureMatchContext
+		}
+		if matchContextChars, ok := config.Config["match_context_chars"].(int); ok {
+			filterConfig.ContextChars = matchContextChars
+		}
+		if redactionAudit, ok := config.Config["redaction_audit"].(bool); ok {
+			filterConfig.RedactionAudit = redactionAudit
+		}
+		if hashKey, ok := config.Config["redaction_audit_hash_key"].(string); ok {
+			filterConfig.RedactionAuditKey = hashKey
+		}
+		if matcher, ok := config.Config["keyword_matcher"].(string); ok && matcher != "" {
+			if !validMatchers[matcher] {
+				return fmt.Errorf("invalid keyword_matcher: %s", matcher)
+			}
+			filterConfig.KeywordMatcher = matcher
+		}
+		if scope, ok := config.Config["request_scope"].(string); ok && scope != "" {
+			if !chatcontent.ValidScope(chatcontent.Scope(scope)) {
+				return fmt.Errorf("invalid request_scope: %s", scope)
+			}
+			filterConfig.RequestScope = chatcontent.Scope(scope)
+		}
+		if rawAdaptive, ok := config.Config["adaptive_threshold"]; ok {
+			adaptive, err := parseAdaptiveThreshold(rawAdaptive, filterConfig.SeverityThreshold)
+			if err != nil {
+				return err
+			}
+			if adaptive.Enabled && len(filterConfig.SeverityBands) > 0 {
+				return fmt.Errorf("adaptive_threshold cannot be combined with severity_bands")
+			}
+			filterConfig.AdaptiveThreshold = adaptive
+		}
 	}
 
 	// Compile regex patterns
 	cf.patterns = make([]*regexp.Regexp, len(filterConfig.BlockedPatterns))
 	for i, pattern := range filterConfig.BlockedPatterns {
-		flags := 0
+		flags := ""
 		if !filterConfig.CaseSensitive {
-			flags = regexp.IgnoreCase
+			flags = "(?i)"
 		}
 		
-		regex, err := regexp.Compile(fmt.Sprintf("(?%s)%s", "", pattern))
+		regex, err := regexp.Compile(flags + pattern)
 		if err != nil {
 			return fmt.Errorf("invalid regex pattern %s: %w", pattern, err)
 		}
 		cf.patterns[i] = regex
 	}
 
+	// Build the keyword automaton, folded the same way checkContent folds content
+	cf.keywords = nil
+	if filterConfig.KeywordMatcher == MatcherAhoCorasick {
+		keywords := filterConfig.BlockedKeywords
+		if !filterConfig.CaseSensitive {
+			keywords = make([]string, len(filterConfig.BlockedKeywords))
+			for i, keyword := range filterConfig.BlockedKeywords {
+				keywords[i] = strings.ToLower(keyword)
+			}
+		}
+		cf.keywords = newKeywordAutomaton(keywords)
+	}
+
 	cf.config = filterConfig
 	cf.startTime = time.Now()
 	cf.status.State = interfaces.ModuleStateReady
 
-	cf.logger.Infof("Content filter initialized with %d keywords, %d patterns, action=%s", 
-		len(filterConfig.BlockedKeywords), len(filterConfig.BlockedPatterns), filterConfig.Action)
+	cf.logger.Infof("Content filter initialized with %d keywords, %d patterns, action=%s, severity_bands=%d, normalize_unicode=%t, keyword_matcher=%s, request_scope=%s", 
+		len(filterConfig.BlockedKeywords), len(filterConfig.BlockedPatterns), filterConfig.Action, len(filterConfig.SeverityBands), filterConfig.NormalizeUnicode, filterConfig.KeywordMatcher, filterConfig.RequestScope)
 
 	return nil
 }
@@ -196,6 +311,7 @@ func (cf *ContentFilter) Metrics() map[string]interface{} {
 		"errors":            cf.status.ErrorCount,
 		"blocked_keywords":  len(cf.config.BlockedKeywords),
 		"blocked_patterns":  len(cf.patterns),
+		"adapted_tenants":   cf.adjustedTenants(),
 		"uptime_seconds":    time.Since(cf.startTime).Seconds(),
 	}
 }
@@ -221,41 +337,80 @@ func (cf *ContentFilter) ProcessRequest(ctx context.Context, req *interfaces.Pro
 		}, nil
 	}
 
+	// Apply review feedback before checking, so it counts from this request on
+	cf.recordAnnotatedFeedback(req.TenantID, req.Annotations)
+
 	// Check content
-	result := cf.checkContent(content)
+	result := cf.checkContent(req.TenantID, content)
 	cf.status.RequestsProcessed++
 	cf.status.LastActivity = time.Now()
 
-	if result.Detected && result.Confidence >= cf.config.SeverityThreshold {
-		switch cf.config.Action {
+	if result.Detected && result.Action != "" {
+		switch result.Action {
 		case "block":
 			cf.logger.Warnf("Blocking request %s due to content violation: %s", req.RequestID, result.Message)
 			return &interfaces.ProcessRequestResult{
 				Action:      interfaces.ActionBlock,
 				BlockReason: fmt.Sprintf("Content violation: %s", result.Message),
 				ProcessingTime: time.Since(start),
-				Annotations: map[string]interface{}{
+				Annotations: withMatchContext(result, map[string]interface{}{
 					"content_filter_detected": true,
 					"matches":                 result.Matches,
 					"confidence":              result.Confidence,
 					"action":                  "block",
-				},
+					"content_normalized":      result.Normalized,
+				}),
 			}, nil
 		case "redact":
 			// Redact content and continue
-			redactedBody := cf.redactContent(req.Body, result.Matches)
+			redactedBody, redactions, err := cf.redactContent(req.Body, result.Matches)
+			if err != nil {
+				cf.status.ErrorCount++
+				return nil, err
+			}
 			return &interfaces.ProcessRequestResult{
 				Action:       interfaces.ActionTransform,
 				ModifiedBody: redactedBody,
 				ProcessingTime: time.Since(start),
-				Annotations: map[string]interface{}{
+				Annotations: cf.withRedactionAudit(RedactionAuditAnnotation, redactions, map[string]interface{}{
 					"content_filter_redacted": true,
 					"matches":                 result.Matches,
 					"confidence":              result.Confidence,
-				},
+					"action":                  "redact",
+					"content_normalized":      result.Normalized,
+				}),
 			}, nil
-		default: // warn, annotate
+		case "warn":
+			// Let the request through but tell the client it was flagged
 			cf.logger.Warnf("Content warning for request %s: %s", req.RequestID, result.Message)
+			return &interfaces.ProcessRequestResult{
+				Action:            interfaces.ActionContinue,
+				ProcessingTime:    time.Since(start),
+				AdditionalHeaders: cf.warningHeaders(result),
+				Annotations: withMatchContext(result, map[string]interface{}{
+					"content_filter_checked": true,
+					"content_safe":           false,
+					"content_filter_warning": result.Message,
+					"matches":                result.Matches,
+					"confidence":             result.Confidence,
+					"action":                 "warn",
+					"content_normalized":     result.Normalized,
+				}),
+			}, nil
+		default: // annotate
+			cf.logger.Warnf("Content warning for request %s: %s", req.RequestID, result.Message)
+			return &interfaces.ProcessRequestResult{
+				Action:         interfaces.ActionContinue,
+				ProcessingTime: time.Since(start),
+				Annotations: withMatchContext(result, map[string]interface{}{
+					"content_filter_checked": true,
+					"content_safe":           false,
+					"matches":                result.Matches,
+					"confidence":             result.Confidence,
+					"action":                 "annotate",
+					"content_normalized":     result.Normalized,
+				}),
+			}, nil
 		}
 	}
 
@@ -265,6 +420,7 @@ func (cf *ContentFilter) ProcessRequest(ctx context.Context, req *interfaces.Pro
 		Annotations: map[string]interface{}{
 			"content_filter_checked": true,
 			"content_safe":           !result.Detected,
+			"content_normalized":     result.Normalized,
 		},
 	}, nil
 }
@@ -290,20 +446,39 @@ func (cf *ContentFilter) ProcessResponse(ctx context.Context, resp *interfaces.P
 	}
 
 	// Check content
-	result := cf.checkContent(content)
+	result := cf.checkContent(resp.TenantID, content)
 
-	if result.Detected && result.Confidence >= cf.config.SeverityThreshold {
-		if cf.config.Action == "redact" {
+	if result.Detected && result.Action != "" {
+		if result.Action == "redact" {
 			// Redact response content
-			redactedBody := cf.redactContent(resp.ResponseBody, result.Matches)
+			redactedBody, redactions, err := cf.redactContent(resp.ResponseBody, result.Matches)
+			if err != nil {
+				cf.status.ErrorCount++
+				return nil, err
+			}
 			return &interfaces.ProcessResponseResult{
 				Action:       interfaces.ActionTransform,
 				ModifiedBody: redactedBody,
 				ProcessingTime: time.Since(start),
-				Annotations: map[string]interface{}{
+				Annotations: cf.withRedactionAudit(ResponseRedactionAuditAnnotation, redactions, map[string]interface{}{
 					"response_content_redacted": true,
 					"matches":                   result.Matches,
-				},
+					"content_normalized":        result.Normalized,
+				}),
+			}, nil
+		}
+		if result.Action == "warn" {
+			return &interfaces.ProcessResponseResult{
+				Action:          interfaces.ActionContinue,
+				ModifiedHeaders: cf.warningHeaders(result),
+				ProcessingTime:  time.Since(start),
+				Annotations: withMatchContext(result, map[string]interface{}{
+					"response_content_checked": true,
+					"content_safe":             false,
+					"content_filter_warning":   result.Message,
+					"matches":                  result.Matches,
+					"content_normalized":       result.Normalized,
+				}),
 			}, nil
 		}
 	}
@@ -314,6 +489,7 @@ func (cf *ContentFilter) ProcessResponse(ctx context.Context, resp *interfaces.P
 		Annotations: map[string]interface{}{
 			"response_content_checked": true,
 			"content_safe":             !result.Detected,
+			"content_normalized":       result.Normalized,
 		},
 	}, nil
 }
@@ -326,9 +502,6 @@ func (cf *ContentFilter) ValidateConfig(config *interfaces.ModuleConfig) error {
 
 	if configMap := config.Config; configMap != nil {
 		if action, ok := configMap["action"].(string); ok {
-			validActions := map[string]bool{
-				"block": true, "warn": true, "annotate": true, "redact": true,
-			}
 			if !validActions[action] {
 				return fmt.Errorf("invalid action: %s", action)
 			}
@@ -339,6 +512,44 @@ func (cf *ContentFilter) ValidateConfig(config *interfaces.ModuleConfig) error {
 				return fmt.Errorf("severity_threshold must be between 0 and 1, got %f", threshold)
 			}
 		}
+
+		if rawBands, ok := configMap["severity_bands"]; ok {
+			if _, err := parseSeverityBands(rawBands); err != nil {
+				return err
+			}
+		}
+
+		if rawConfidences, ok := configMap["match_confidence"]; ok {
+			if _, err := parseMatchConfidence(rawConfidences); err != nil {
+				return err
+			}
+		}
+
+		if matchContextChars, ok := configMap["match_context_chars"].(int); ok && matchContextChars < 0 {
+			return fmt.Errorf("match_context_chars must be non-negative, got %d", matchContextChars)
+		}
+
+		if matcher, ok := configMap["keyword_matcher"].(string); ok && matcher != "" && !validMatchers[matcher] {
+			return fmt.Errorf("invalid keyword_matcher: %s", matcher)
+		}
+
+		if scope, ok := configMap["request_scope"].(string); ok && scope != "" && !chatcontent.ValidScope(chatcontent.Scope(scope)) {
+			return fmt.Errorf("invalid request_scope: %s", scope)
+		}
+
+		if rawAdaptive, ok := configMap["adaptive_threshold"]; ok {
+			base := 0.8
+			if threshold, ok := configMap["severity_threshold"].(float64); ok {
+				base = threshold
+			}
+			adaptive, err := parseAdaptiveThreshold(rawAdaptive, base)
+			if err != nil {
+				return err
+			}
+			if _, hasBands := configMap["severity_bands"]; adaptive.Enabled && hasBands {
+				return fmt.Errorf("adaptive_threshold cannot be combined with severity_bands")
+			}
+		}
 	}
 
 	return nil
@@ -359,13 +570,24 @@ func (cf *ContentFilter) GetConfig() *interfaces.ModuleConfig {
 		Enabled:  cf.status.State == interfaces.ModuleStateRunning,
 		Priority: 300, // Medium priority for content filtering
 		Config: map[string]interface{}{
-			"blocked_keywords":    cf.config.BlockedKeywords,
-			"blocked_patterns":    cf.config.BlockedPatterns,
-			"severity_threshold":  cf.config.SeverityThreshold,
-			"action":              cf.config.Action,
-			"case_sensitive":      cf.config.CaseSensitive,
-			"check_requests":      cf.config.CheckRequests,
-			"check_responses":     cf.config.CheckResponses,
+			"blocked_keywords":      cf.config.BlockedKeywords,
+			"blocked_patterns":      cf.config.BlockedPatterns,
+			"severity_threshold":    cf.config.SeverityThreshold,
+			"action":                cf.config.Action,
+			"severity_bands":        cf.config.SeverityBands,
+			"match_confidence":      cf.config.MatchConfidence,
+			"case_sensitive":        cf.config.CaseSensitive,
+			"check_requests":        cf.config.CheckRequests,
+			"check_responses":       cf.config.CheckResponses,
+			"normalize_unicode":     cf.config.NormalizeUnicode,
+			"fold_homoglyphs":       cf.config.FoldHomoglyphs,
+			"warning_header":        cf.config.WarningHeader,
+			"capture_match_context": cf.config.CaptureContext,
+			"match_context_chars":   cf.config.ContextChars,
+			"redaction_audit":       cf.config.RedactionAudit,
+			"keyword_matcher":       cf.config.KeywordMatcher,
+			"adaptive_threshold":    cf.config.AdaptiveThreshold,
+			"request_scope":         cf.config.RequestScope,
 		},
 	}
 }
@@ -376,27 +598,15 @@ func (cf *ContentFilter) extractContentFromRequest(body []byte) (string, error)
 		return "", nil
 	}
 
-	// Try to parse as JSON (LLM request)
-	var requestData map[string]interface{}
-	if err := json.Unmarshal(body, &requestData); err != nil {
+	// Try to parse as JSON (LLM request); text parts of multi-modal content
+	// are included, from the messages in the configured scope only
+	summary, ok := chatcontent.ParseRequestScope(body, cf.config.RequestScope)
+	if !ok {
 		// If not JSON, treat as plain text
 		return string(body), nil
 	}
 
-	// Extract messages content
-	var content strings.Builder
-	if messages, ok := requestData["messages"].([]interface{}); ok {
-		for _, msg := range messages {
-			if msgMap, ok := msg.(map[string]interface{}); ok {
-				if msgContent, ok := msgMap["content"].(string); ok {
-					content.WriteString(msgContent)
-					content.WriteString(" ")
-				}
-			}
-		}
-	}
-
-	return content.String(), nil
+	return summary.Text, nil
 }
 
 func (cf *ContentFilter) extractContentFromResponse(body []byte) (string, error) {
@@ -405,30 +615,15 @@ func (cf *ContentFilter) extractContentFromResponse(body []byte) (string, error)
 	}
 
 	// Try to parse as JSON (LLM response)
-	var responseData map[string]interface{}
-	if err := json.Unmarshal(body, &responseData); err != nil {
+	summary, ok := chatcontent.ParseResponse(body)
+	if !ok {
 		return string(body), nil
 	}
 
-	// Extract choices content
-	var content strings.Builder
-	if choices, ok := responseData["choices"].([]interface{}); ok {
-		for _, choice := range choices {
-			if choiceMap, ok := choice.(map[string]interface{}); ok {
-				if message, ok := choiceMap["message"].(map[string]interface{}); ok {
-					if msgContent, ok := message["content"].(string); ok {
-						content.WriteString(msgContent)
-						content.WriteString(" ")
-					}
-				}
-			}
-		}
-	}
-
-	return content.String(), nil
+	return summary.Text, nil
 }
 
-func (cf *ContentFilter) checkContent(content string) *DetectionResult {
+func (cf *ContentFilter) checkContent(tenantID, content string) *DetectionResult {
 	if content == "" {
 		return &DetectionResult{
 			Detected:   false,
@@ -436,24 +631,32 @@ func (cf *ContentFilter) checkContent(content string) *DetectionResult {
 		}
 	}
 
-	var matches []string
+	var matches, ruleIDs []string
 	var maxConfidence float64
 
+	// Normalize away zero-width and homoglyph evasion before matching
+	normalized := false
+	if cf.config.NormalizeUnicode {
+		if folded := normalizeText(content, cf.config.FoldHomoglyphs); folded != content {
+			content = folded
+			normalized = true
+		}
+	}
+
 	// Check against keywords
 	checkContent := content
 	if !cf.config.CaseSensitive {
 		checkContent = strings.ToLower(content)
 	}
 
-	for _, keyword := range cf.config.BlockedKeywords {
-		checkKeyword := keyword
-		if !cf.config.CaseSensitive {
-			checkKeyword = strings.ToLower(keyword)
-		}
-
-		if strings.Contains(checkContent, checkKeyword) {
+	found := cf.matchKeywords(checkContent)
+	for i, keyword := range cf.config.BlockedKeywords {
+		if found[i] {
 			matches = append(matches, keyword)
-			maxConfidence = 0.9 // High confidence for exact keyword match
+			ruleIDs = append(ruleIDs, fmt.Sprintf("keyword-%d", i+1))
+			if confidence := cf.matchConfidence(keyword, keywordConfidence); confidence > maxConfidence {
+				maxConfidence = confidence
+			}
 		}
 	}
 
@@ -461,40 +664,147 @@ func (cf *ContentFilter) checkContent(content string) *DetectionResult {
 	for i, pattern := range cf.patterns {
 		if pattern.MatchString(content) {
 			matches = append(matches, cf.config.BlockedPatterns[i])
-			if maxConfidence < 0.8 {
-				maxConfidence = 0.8 // Medium-high confidence for pattern match
+			ruleIDs = append(ruleIDs, fmt.Sprintf("pattern-%d", i+1))
+			if confidence := cf.matchConfidence(cf.config.BlockedPatterns[i], patternConfidence); confidence > maxConfidence {
+				maxConfidence = confidence
 			}
 		}
 	}
 
 	detected := len(matches) > 0
 	message := ""
+	var contexts []MatchContext
 	if detected {
 		message = fmt.Sprintf("Detected inappropriate content: %s", strings.Join(matches, ", "))
+		if cf.config.CaptureContext {
+			contexts = cf.matchContexts(content, cf.config.ContextChars)
+		}
+	}
+
+	action := ""
+	if detected {
+		action = cf.actionFor(tenantID, maxConfidence)
 	}
 
 	return &DetectionResult{
 		Detected:   detected,
 		Matches:    matches,
+		RuleIDs:    ruleIDs,
 		Confidence: maxConfidence,
-		Action:     cf.config.Action,
+		Action:     action,
 		Message:    message,
+		Normalized: normalized,
+		Contexts:   contexts,
 	}
 }
 
-func (cf *ContentFilter) redactContent(body []byte, matches []string) []byte {
-	content := string(body)
-	
-	// Simple redaction - replace matches with redaction text
-	for _, match := range matches {
-		if cf.config.CaseSensitive {
-			content = strings.ReplaceAll(content, match, cf.config.RedactionText)
-		} else {
-			// Case-insensitive replacement
-			re := regexp.MustCompile("(?i)" + regexp.QuoteMeta(match))
-			content = re.ReplaceAllString(content, cf.config.RedactionText)
+// matchConfidence returns the configured confidence of a keyword or pattern
+// match, or the default for its kind
+func (cf *ContentFilter) matchConfidence(match string, defaultConfidence float64) float64 {
+	if confidence, ok := cf.config.MatchConfidence[match]; ok {
+		return confidence
+	}
+	return defaultConfidence
+}
+
+// actionFor returns the action for a detection's confidence: that of the
+// highest severity band it reaches, or the configured action at or above
+// the tenant's severity threshold when no bands are set. Detections below
+// every band or the threshold get no action.
+func (cf *ContentFilter) actionFor(tenantID string, confidence float64) string {
+	if len(cf.config.SeverityBands) == 0 {
+		if confidence >= cf.Threshold(tenantID) {
+			return cf.config.Action
+		}
+		return ""
+	}
+	for _, band := range cf.config.SeverityBands {
+		if confidence >= band.MinConfidence {
+			return band.Action
+		}
+	}
+	return ""
+}
+
+// parseSeverityBands reads severity bands from module config, ordered from
+// the highest minimum confidence down
+func parseSeverityBands(raw interface{}) ([]SeverityBand, error) {
+	entries, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("severity_bands must be a list")
+	}
+
+	bands := make([]SeverityBand, 0, len(entries))
+	for _, entry := range entries {
+		fields, ok := entry.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid severity band: %v", entry)
+		}
+		minConfidence, ok := toFloat(fields["min_confidence"])
+		if !ok || minConfidence < 0 || minConfidence > 1 {
+			return nil, fmt.Errorf("severity band min_confidence must be between 0 and 1, got %v", fields["min_confidence"])
+		}
+		action, _ := fields["action"].(string)
+		if !validActions[action] {
+			return nil, fmt.Errorf("invalid severity band action: %s", action)
 		}
+		bands = append(bands, SeverityBand{MinConfidence: minConfidence, Action: action})
 	}
 
-	return []byte(content)
+	sort.SliceStable(bands, func(i, j int) bool { return bands[i].MinConfidence > bands[j].MinConfidence })
+	return bands, nil
+}
+
+// parseMatchConfidence reads per-match confidences from module config, a list
+// of {match, confidence} entries naming a keyword or pattern as configured
+func parseMatchConfidence(raw interface{}) (map[string]float64, error) {
+	entries, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("match_confidence must be a list")
+	}
+
+	confidences := make(map[string]float64, len(entries))
+	for _, entry := range entries {
+		fields, ok := entry.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid match_confidence entry: %v", entry)
+		}
+		match, _ := fields["match"].(string)
+		if match == "" {
+			return nil, fmt.Errorf("match_confidence entry requires a match")
+		}
+		confidence, ok := toFloat(fields["confidence"])
+		if !ok || confidence < 0 || confidence > 1 {
+			return nil, fmt.Errorf("match_confidence for %q must be between 0 and 1, got %v", match, fields["confidence"])
+		}
+		confidences[match] = confidence
+	}
+	return confidences, nil
+}
+
+// toFloat reads a numeric config value
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// withMatchContext adds captured match snippets to flagged-content annotations
+func withMatchContext(result *DetectionResult, annotations map[string]interface{}) map[string]interface{} {
+	if len(result.Contexts) > 0 {
+		annotations["match_context"] = result.Contexts
+	}
+	return annotations
+}
+
+// warningHeaders builds the client-facing warning header for flagged content.
+// It names the matched rules by ID only: echoing keywords or patterns would
+// hand clients the filter configuration to evade.
+func (cf *ContentFilter) warningHeaders(result *DetectionResult) map[string]string {
+	return map[string]string{cf.config.WarningHeader: "flagged: " + strings.Join(result.RuleIDs, ", ")}
 }
@@ -0,0 +1,63 @@
+package contentfilter
+
+import "regexp"
+
+// contextRedaction replaces checked content outside a match's context window
+const contextRedaction = "[REDACTED]"
+
+// MatchContext is a redacted snippet showing where a match occurred
+type MatchContext struct {
+	Match   string `json:"match"`   // configured keyword or pattern
+	Snippet string `json:"snippet"` // matched text with its context window; everything else redacted
+}
+
+// matchContexts builds a snippet for the first occurrence of each match,
+// keeping window runes either side of it and redacting the rest, so audit
+// records show where content matched without carrying the whole prompt
+func (cf *ContentFilter) matchContexts(content string, window int) []MatchContext {
+	var contexts []MatchContext
+
+	for _, keyword := range cf.config.BlockedKeywords {
+		flags := ""
+		if !cf.config.CaseSensitive {
+			flags = "(?i)"
+		}
+		re := regexp.MustCompile(flags + regexp.QuoteMeta(keyword))
+		if loc := re.FindStringIndex(content); loc != nil {
+			contexts = append(contexts, MatchContext{Match: keyword, Snippet: snippet(content, loc, window)})
+		}
+	}
+	for i, pattern := range cf.patterns {
+		if loc := pattern.FindStringIndex(content); loc != nil {
+			contexts = append(contexts, MatchContext{Match: cf.config.BlockedPatterns[i], Snippet: snippet(content, loc, window)})
+		}
+	}
+
+	return contexts
+}
+
+// snippet returns content[loc[0]:loc[1]] with up to window runes of context
+// either side, marking redacted content before and after
+func snippet(content string, loc []int, window int) string {
+	runes := []rune(content)
+	start := len([]rune(content[:loc[0]]))
+	end := start + len([]rune(content[loc[0]:loc[1]]))
+
+	from := start - window
+	if from < 0 {
+		from = 0
+	}
+	to := end + window
+	if to > len(runes) {
+		to = len(runes)
+	}
+
+	result := string(runes[from:to])
+	if from > 0 {
+		result = contextRedaction + result
+	}
+	if to < len(runes) {
+		result += contextRedaction
+	}
+	return result
+}
@@ -0,0 +1,74 @@
+package contentfilter
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// homoglyphs maps common look-alike characters to the Latin letters they imitate
+var homoglyphs = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o',
+	'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'ѕ': 's', 'і': 'i', 'ї': 'i',
+	'ј': 'j', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w', 'һ': 'h', 'ӏ': 'l',
+	'А': 'A', 'В': 'B', 'Е': 'E', 'К': 'K', 'М': 'M', 'Н': 'H', 'О': 'O', 'Р': 'P',
+	'С': 'C', 'Т': 'T', 'У': 'Y', 'Х': 'X', 'Ѕ': 'S', 'І': 'I', 'Ј': 'J',
+	// Greek
+	'α': 'a', 'ε': 'e', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'τ': 't',
+	'υ': 'u', 'χ': 'x', 'Α': 'A', 'Β': 'B', 'Ε': 'E', 'Η': 'H', 'Ι': 'I', 'Κ': 'K',
+	'Μ': 'M', 'Ν': 'N', 'Ο': 'O', 'Ρ': 'P', 'Τ': 'T', 'Υ': 'Y', 'Χ': 'X', 'Ζ': 'Z',
+}
+
+// isInvisible reports whether a rune renders as nothing and can be used to
+// split keywords (zero-width spaces/joiners, BOM, soft hyphen, other format characters)
+func isInvisible(r rune) bool {
+	switch r {
+	case '\u00AD', '\u034F', '\u180E', '\u200B', '\u200C', '\u200D', '\u2060', '\uFEFF':
+		return true
+	}
+	return unicode.Is(unicode.Cf, r)
+}
+
+// normalizeText applies NFKC, strips invisible characters and optionally folds
+// homoglyphs so evasion variants match plain keywords
+func normalizeText(text string, foldHomoglyphs bool) string {
+	return foldText(norm.NFKC.String(text), foldHomoglyphs)
+}
+
+// normalizeMapped normalizes text like normalizeText and maps each byte of
+// the result back to the span of text it came from, so matches found in the
+// normalized text can be located in the original
+func normalizeMapped(text string, foldHomoglyphs bool) (normalized string, starts, ends []int) {
+	var b strings.Builder
+	var it norm.Iter
+	it.InitString(norm.NFKC, text)
+	for !it.Done() {
+		start := it.Pos()
+		segment := foldText(string(it.Next()), foldHomoglyphs)
+		end := it.Pos()
+
+		b.WriteString(segment)
+		for i := 0; i < len(segment); i++ {
+			starts = append(starts, start)
+			ends = append(ends, end)
+		}
+	}
+	return b.String(), starts, ends
+}
+
+// foldText strips invisible characters and optionally folds homoglyphs
+func foldText(text string, foldHomoglyphs bool) string {
+	return strings.Map(func(r rune) rune {
+		if isInvisible(r) {
+			return -1
+		}
+		if foldHomoglyphs {
+			if latin, ok := homoglyphs[r]; ok {
+				return latin
+			}
+		}
+		return r
+	}, text)
+}
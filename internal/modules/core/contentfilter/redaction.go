@@ -0,0 +1,209 @@
+package contentfilter
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Annotations carrying redaction audit records, read by the redaction audit sink
+const (
+	RedactionAuditAnnotation         = "redaction_audit"
+	ResponseRedactionAuditAnnotation = "response_redaction_audit"
+)
+
+// Redaction records one redacted span of a body without the redacted text
+type Redaction struct {
+	Rule          string `json:"rule"`           // "keyword:<keyword>" or "pattern:<pattern>"
+	OriginalHash  string `json:"original_hash"`  // hex digest of the redacted text
+	HashAlgorithm string `json:"hash_algorithm"` // sha256, or hmac-sha256 when a hash key is configured
+	Path          string `json:"path,omitempty"` // dot-separated path of the redacted JSON string value; empty for plain-text bodies
+	Offset        int    `json:"offset"`         // byte offset of the redacted text in the original value at Path, or in the body
+	Length        int    `json:"length"`         // byte length of the redacted text
+}
+
+// redactedSpan is a text range to redact and the rule that matched it
+type redactedSpan struct {
+	start, end int
+	rule       string
+}
+
+// redactContent replaces the text of the matched keywords and patterns in
+// body with the redaction text and describes each replaced span. JSON bodies
+// are redacted in their decoded string values and re-encoded, so content can
+// never change the structure of the forwarded body; other bodies are
+// redacted as plain text.
+func (cf *ContentFilter) redactContent(body []byte, matches []string) ([]byte, []Redaction, error) {
+	matched := make(map[string]bool, len(matches))
+	for _, match := range matches {
+		matched[match] = true
+	}
+
+	var document interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil || decoder.More() {
+		redacted, redactions := cf.redactText(string(body), "", matched)
+		return []byte(redacted), redactions, nil
+	}
+
+	var redactions []Redaction
+	document = cf.redactValue(document, nil, matched, &redactions)
+	if len(redactions) == 0 {
+		return body, nil, nil
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(document); err != nil {
+		return nil, nil, fmt.Errorf("failed to encode redacted body: %w", err)
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), redactions, nil
+}
+
+// redactValue redacts the strings in a decoded JSON value at path. Object
+// keys are left alone and visited in order so records are stable.
+func (cf *ContentFilter) redactValue(value interface{}, path []string, matched map[string]bool, redactions *[]Redaction) interface{} {
+	switch v := value.(type) {
+	case string:
+		redacted, found := cf.redactText(v, strings.Join(path, "."), matched)
+		*redactions = append(*redactions, found...)
+		return redacted
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			v[key] = cf.redactValue(v[key], append(path[:len(path):len(path)], key), matched, redactions)
+		}
+		return v
+	case []interface{}:
+		for i, child := range v {
+			v[i] = cf.redactValue(child, append(path[:len(path):len(path)], strconv.Itoa(i)), matched, redactions)
+		}
+		return v
+	default:
+		return value
+	}
+}
+
+// redactText redacts the matched keywords and patterns in text. With
+// normalization enabled, matches in the normalized text are redacted at the
+// original characters they came from; the rest of text is kept as sent.
+func (cf *ContentFilter) redactText(text, path string, matched map[string]bool) (string, []Redaction) {
+	spans := cf.matchSpans(text, matched, nil, nil)
+	if cf.config.NormalizeUnicode {
+		if normalized, starts, ends := normalizeMapped(text, cf.config.FoldHomoglyphs); normalized != text {
+			spans = append(spans, cf.matchSpans(normalized, matched, starts, ends)...)
+		}
+	}
+	if len(spans) == 0 {
+		return text, nil
+	}
+
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	merged := spans[:1]
+	for _, span := range spans[1:] {
+		last := &merged[len(merged)-1]
+		if span.start < last.end {
+			if span.end > last.end {
+				last.end = span.end
+			}
+			continue
+		}
+		merged = append(merged, span)
+	}
+
+	var redacted strings.Builder
+	redacted.Grow(len(text))
+	redactions := make([]Redaction, 0, len(merged))
+	previous := 0
+	for _, span := range merged {
+		redacted.WriteString(text[previous:span.start])
+		redacted.WriteString(cf.config.RedactionText)
+		previous = span.end
+
+		digest, algorithm := cf.hashRedacted([]byte(text[span.start:span.end]))
+		redactions = append(redactions, Redaction{
+			Rule:          span.rule,
+			OriginalHash:  digest,
+			HashAlgorithm: algorithm,
+			Path:          path,
+			Offset:        span.start,
+			Length:        span.end - span.start,
+		})
+	}
+	redacted.WriteString(text[previous:])
+
+	return redacted.String(), redactions
+}
+
+// matchSpans finds the matched keywords and patterns in text. When text is
+// normalized, starts and ends map its bytes back to the original text and
+// the spans returned are in the original's offsets.
+func (cf *ContentFilter) matchSpans(text string, matched map[string]bool, starts, ends []int) []redactedSpan {
+	var spans []redactedSpan
+	add := func(loc []int, rule string) {
+		if loc[0] >= loc[1] {
+			return
+		}
+		if starts != nil {
+			loc = []int{starts[loc[0]], ends[loc[1]-1]}
+		}
+		spans = append(spans, redactedSpan{start: loc[0], end: loc[1], rule: rule})
+	}
+
+	for _, keyword := range cf.config.BlockedKeywords {
+		if !matched[keyword] || keyword == "" {
+			continue
+		}
+		flags := ""
+		if !cf.config.CaseSensitive {
+			flags = "(?i)"
+		}
+		re := regexp.MustCompile(flags + regexp.QuoteMeta(keyword))
+		for _, loc := range re.FindAllStringIndex(text, -1) {
+			add(loc, "keyword:"+keyword)
+		}
+	}
+	for i, pattern := range cf.patterns {
+		if !matched[cf.config.BlockedPatterns[i]] {
+			continue
+		}
+		for _, loc := range pattern.FindAllStringIndex(text, -1) {
+			add(loc, "pattern:"+cf.config.BlockedPatterns[i])
+		}
+	}
+	return spans
+}
+
+// hashRedacted digests redacted text. A keyed HMAC keeps short values such
+// as card or social security numbers from being recovered by brute force.
+func (cf *ContentFilter) hashRedacted(text []byte) (string, string) {
+	if cf.config.RedactionAuditKey == "" {
+		sum := sha256.Sum256(text)
+		return hex.EncodeToString(sum[:]), "sha256"
+	}
+	mac := hmac.New(sha256.New, []byte(cf.config.RedactionAuditKey))
+	mac.Write(text)
+	return hex.EncodeToString(mac.Sum(nil)), "hmac-sha256"
+}
+
+// withRedactionAudit adds the redaction audit records to annotations under
+// key when the redaction audit is enabled
+func (cf *ContentFilter) withRedactionAudit(key string, redactions []Redaction, annotations map[string]interface{}) map[string]interface{} {
+	if cf.config.RedactionAudit && len(redactions) > 0 {
+		annotations[key] = redactions
+	}
+	return annotations
+}
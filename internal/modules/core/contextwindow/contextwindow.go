@@ -0,0 +1,383 @@
+package contextwindow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/metrics"
+	"github.com/bendiamant/leash-gateway/internal/modules/chatcontent"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/tokens"
+	"go.uber.org/zap"
+)
+
+// ContextWindow implements a policy keeping requests within their model's
+// context window
+type ContextWindow struct {
+	name        string
+	version     string
+	description string
+	author      string
+	config      *ContextWindowConfig
+	logger      *zap.SugaredLogger
+	status      *interfaces.ModuleStatus
+	startTime   time.Time
+	tokens      *tokens.Counter
+	metrics     *metrics.Registry
+}
+
+// ContextWindowConfig represents context window configuration
+type ContextWindowConfig struct {
+	ContextWindows map[string]map[string]int `yaml:"context_windows" json:"context_windows"` // provider -> model -> max tokens
+	Action         string                    `yaml:"action" json:"action"`                   // block, truncate
+}
+
+// NewContextWindow creates a new context window module
+func NewContextWindow(logger *zap.SugaredLogger) *ContextWindow {
+	return &ContextWindow{
+		name:        "context-window",
+		version:     "1.0.0",
+		description: "Rejects or truncates requests that exceed the model's context window",
+		author:      "Leash Security",
+		logger:      logger,
+		tokens:      tokens.NewCounter(),
+		status: &interfaces.ModuleStatus{
+			State:             interfaces.ModuleStateReady,
+			RequestsProcessed: 0,
+			ErrorCount:        0,
+		},
+	}
+}
+
+// SetTokenCounter sets the tokenizers used to count prompt tokens. Models
+// without a tokenizer are estimated at four characters per token.
+func (cw *ContextWindow) SetTokenCounter(counter *tokens.Counter) {
+	cw.tokens = counter
+}
+
+// SetMetrics enables the degraded token estimate metric
+func (cw *ContextWindow) SetMetrics(registry *metrics.Registry) {
+	cw.metrics = registry
+}
+
+// Metadata methods
+func (cw *ContextWindow) Name() string                { return cw.name }
+func (cw *ContextWindow) Version() string             { return cw.version }
+func (cw *ContextWindow) Type() interfaces.ModuleType { return interfaces.ModuleTypePolicy }
+func (cw *ContextWindow) Description() string         { return cw.description }
+func (cw *ContextWindow) Author() string              { return cw.author }
+func (cw *ContextWindow) Dependencies() []string      { return []string{} }
+
+// Lifecycle methods
+func (cw *ContextWindow) Initialize(ctx context.Context, config *interfaces.ModuleConfig) error {
+	cw.logger.Infof("Initializing context window module")
+
+	windowConfig := &ContextWindowConfig{
+		ContextWindows: make(map[string]map[string]int),
+		Action:         "block",
+	}
+
+	// Override with provided config
+	if config != nil && config.Config != nil {
+		if windows, ok := config.Config["context_windows"].(map[string]interface{}); ok {
+			for provider, models := range windows {
+				modelMap, ok := models.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				limits := make(map[string]int, len(modelMap))
+				for model, maxTokens := range modelMap {
+					if value, ok := maxTokens.(int); ok && value > 0 {
+						limits[model] = value
+					}
+				}
+				windowConfig.ContextWindows[provider] = limits
+			}
+		}
+		if action, ok := config.Config["action"].(string); ok {
+			windowConfig.Action = action
+		}
+	}
+
+	cw.config = windowConfig
+	cw.startTime = time.Now()
+	cw.status.State = interfaces.ModuleStateReady
+
+	cw.logger.Infof("Context window initialized for %d providers with action=%s",
+		len(windowConfig.ContextWindows), windowConfig.Action)
+	return nil
+}
+
+func (cw *ContextWindow) Start(ctx context.Context) error {
+	cw.status.State = interfaces.ModuleStateRunning
+	cw.status.StartTime = time.Now()
+	cw.logger.Infof("Context window module started")
+	return nil
+}
+
+// Warmup loads the registered tokenizers so the first request for a model
+// does not wait for its vocabulary to load. Models whose tokenizer fails to
+// load are estimated as before.
+func (cw *ContextWindow) Warmup(ctx context.Context) error {
+	return cw.tokens.Warmup()
+}
+
+func (cw *ContextWindow) Stop(ctx context.Context) error {
+	cw.status.State = interfaces.ModuleStateDraining
+	cw.logger.Infof("Context window module stopping")
+	return nil
+}
+
+func (cw *ContextWindow) Shutdown(ctx context.Context) error {
+	cw.status.State = interfaces.ModuleStateStopped
+	cw.logger.Infof("Context window module shutdown")
+	return nil
+}
+
+// Health and status methods
+func (cw *ContextWindow) Health(ctx context.Context) (*interfaces.HealthStatus, error) {
+	return &interfaces.HealthStatus{
+		Status:        interfaces.HealthStateHealthy,
+		Message:       "Context window is healthy",
+		LastCheck:     time.Now(),
+		CheckDuration: time.Millisecond,
+		Details: map[string]interface{}{
+			"providers": len(cw.config.ContextWindows),
+			"action":    cw.config.Action,
+		},
+	}, nil
+}
+
+func (cw *ContextWindow) Status() *interfaces.ModuleStatus {
+	status := *cw.status
+	status.LastActivity = time.Now()
+	return &status
+}
+
+func (cw *ContextWindow) Metrics() map[string]interface{} {
+	return map[string]interface{}{
+		"requests_processed": cw.status.RequestsProcessed,
+		"errors":             cw.status.ErrorCount,
+		"uptime_seconds":     time.Since(cw.startTime).Seconds(),
+	}
+}
+
+// Processing methods
+func (cw *ContextWindow) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequestContext) (*interfaces.ProcessRequestResult, error) {
+	start := time.Now()
+	cw.status.RequestsProcessed++
+	cw.status.LastActivity = time.Now()
+
+	limit := cw.config.ContextWindows[req.Provider][req.Model]
+	if limit <= 0 {
+		// No context window configured for this model
+		return &interfaces.ProcessRequestResult{
+			Action:         interfaces.ActionContinue,
+			ProcessingTime: time.Since(start),
+		}, nil
+	}
+
+	var requestData map[string]interface{}
+	if err := json.Unmarshal(req.Body, &requestData); err != nil {
+		// Not a chat request; nothing to measure
+		return &interfaces.ProcessRequestResult{
+			Action:         interfaces.ActionContinue,
+			ProcessingTime: time.Since(start),
+		}, nil
+	}
+
+	messages, _ := requestData["messages"].([]interface{})
+	completionTokens := requestedCompletionTokens(requestData)
+	promptTokens, degraded := cw.countTokens(req.Model, messages)
+	annotations := map[string]interface{}{
+		"context_window":           limit,
+		"context_estimated_tokens": promptTokens + completionTokens,
+	}
+	if degraded {
+		annotations[tokens.DegradedAnnotation] = true
+		if cw.metrics != nil {
+			cw.metrics.RecordTokenEstimateDegraded(req.Model)
+		}
+	}
+
+	if promptTokens+completionTokens <= limit {
+		return &interfaces.ProcessRequestResult{
+			Action:         interfaces.ActionContinue,
+			ProcessingTime: time.Since(start),
+			Annotations:    annotations,
+		}, nil
+	}
+
+	annotations["context_window_exceeded"] = true
+
+	if cw.config.Action == "truncate" {
+		truncated := cw.truncate(req.Model, messages, limit-completionTokens)
+		if truncatedTokens, _ := cw.countTokens(req.Model, truncated); truncatedTokens+completionTokens <= limit {
+			requestData["messages"] = truncated
+			modifiedBody, err := json.Marshal(requestData)
+			if err != nil {
+				cw.status.ErrorCount++
+				return nil, fmt.Errorf("failed to marshal truncated request: %w", err)
+			}
+
+			annotations["context_truncated"] = true
+			annotations["context_estimated_tokens"] = truncatedTokens + completionTokens
+			annotations["context_original_tokens"] = promptTokens + completionTokens
+
+			cw.logger.Infof("Truncated request %s from %d to %d messages to fit the %d token context window of %s",
+				req.RequestID, len(messages), len(truncated), limit, req.Model)
+			return &interfaces.ProcessRequestResult{
+				Action:         interfaces.ActionTransform,
+				ModifiedBody:   modifiedBody,
+				ProcessingTime: time.Since(start),
+				Annotations:    annotations,
+			}, nil
+		}
+		// The system messages and most recent message alone do not fit; fall through to block
+	}
+
+	reason := fmt.Sprintf("context window exceeded: estimated %d prompt tokens + %d completion tokens exceeds the %d token context window of %s",
+		promptTokens, completionTokens, limit, req.Model)
+	cw.logger.Warnf("Blocking request %s: %s", req.RequestID, reason)
+
+	return &interfaces.ProcessRequestResult{
+		Action:         interfaces.ActionBlock,
+		BlockReason:    reason,
+		ProcessingTime: time.Since(start),
+		Annotations:    annotations,
+		Metadata: map[string]string{
+			"status_code": strconv.Itoa(http.StatusBadRequest),
+		},
+	}, nil
+}
+
+func (cw *ContextWindow) ProcessResponse(ctx context.Context, resp *interfaces.ProcessResponseContext) (*interfaces.ProcessResponseResult, error) {
+	// Context window doesn't need to process responses
+	return &interfaces.ProcessResponseResult{
+		Action: interfaces.ActionContinue,
+	}, nil
+}
+
+// Configuration methods
+func (cw *ContextWindow) ValidateConfig(config *interfaces.ModuleConfig) error {
+	if config == nil {
+		return fmt.Errorf("config cannot be nil")
+	}
+
+	if configMap := config.Config; configMap != nil {
+		if action, ok := configMap["action"].(string); ok {
+			if action != "block" && action != "truncate" {
+				return fmt.Errorf("invalid action: %s", action)
+			}
+		}
+		if windows, ok := configMap["context_windows"].(map[string]interface{}); ok {
+			for provider, models := range windows {
+				modelMap, ok := models.(map[string]interface{})
+				if !ok {
+					return fmt.Errorf("context_windows for provider %s must be a map of model to max tokens", provider)
+				}
+				for model, maxTokens := range modelMap {
+					if value, ok := maxTokens.(int); !ok || value < 0 {
+						return fmt.Errorf("context window for %s/%s must be a non-negative integer", provider, model)
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (cw *ContextWindow) UpdateConfig(ctx context.Context, config *interfaces.ModuleConfig) error {
+	if err := cw.ValidateConfig(config); err != nil {
+		return err
+	}
+
+	return cw.Initialize(ctx, config)
+}
+
+func (cw *ContextWindow) GetConfig() *interfaces.ModuleConfig {
+	windows := make(map[string]interface{}, len(cw.config.ContextWindows))
+	for provider, models := range cw.config.ContextWindows {
+		modelMap := make(map[string]interface{}, len(models))
+		for model, maxTokens := range models {
+			modelMap[model] = maxTokens
+		}
+		windows[provider] = modelMap
+	}
+
+	return &interfaces.ModuleConfig{
+		Name:     cw.name,
+		Type:     cw.Type().String(),
+		Enabled:  cw.status.State == interfaces.ModuleStateRunning,
+		Priority: 250, // After conversation limits, before content filtering
+		Config: map[string]interface{}{
+			"context_windows": windows,
+			"action":          cw.config.Action,
+		},
+	}
+}
+
+// truncate drops the oldest non-system messages until the prompt fits within
+// budget tokens, always keeping system messages and the most recent message
+func (cw *ContextWindow) truncate(model string, messages []interface{}, budget int) []interface{} {
+	truncated := append([]interface{}{}, messages...)
+
+	for {
+		if count, _ := cw.countTokens(model, truncated); count <= budget {
+			break
+		}
+		dropped := false
+		for i := 0; i < len(truncated)-1; i++ {
+			if role, _ := messageRole(truncated[i]); role == "system" {
+				continue
+			}
+			truncated = append(truncated[:i], truncated[i+1:]...)
+			dropped = true
+			break
+		}
+		if !dropped {
+			break
+		}
+	}
+
+	return truncated
+}
+
+// countTokens counts the prompt tokens of a conversation's content and
+// reports whether the count is a heuristic estimate
+func (cw *ContextWindow) countTokens(model string, messages []interface{}) (int, bool) {
+	var text strings.Builder
+	for _, msg := range messages {
+		if msgMap, ok := msg.(map[string]interface{}); ok {
+			text.WriteString(chatcontent.MessageText(msgMap["content"]))
+		}
+	}
+	return cw.tokens.Count(model, text.String())
+}
+
+// requestedCompletionTokens returns the completion tokens the request
+// reserves, which share the context window with the prompt
+func requestedCompletionTokens(requestData map[string]interface{}) int {
+	for _, key := range []string{"max_completion_tokens", "max_tokens"} {
+		if value, ok := requestData[key].(float64); ok && value > 0 {
+			return int(value)
+		}
+	}
+	return 0
+}
+
+// messageRole returns the role of a raw message
+func messageRole(msg interface{}) (string, bool) {
+	msgMap, ok := msg.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	role, ok := msgMap["role"].(string)
+	return role, ok
+}
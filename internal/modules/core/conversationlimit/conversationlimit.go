@@ -0,0 +1,320 @@
+package conversationlimit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/chatcontent"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"go.uber.org/zap"
+)
+
+// ConversationLimit implements a policy capping conversation length
+type ConversationLimit struct {
+	name        string
+	version     string
+	description string
+	author      string
+	config      *ConversationLimitConfig
+	logger      *zap.SugaredLogger
+	status      *interfaces.ModuleStatus
+	startTime   time.Time
+}
+
+// ConversationLimitConfig represents conversation limit configuration
+type ConversationLimitConfig struct {
+	MaxMessages   int    `yaml:"max_messages" json:"max_messages"`     // 0 disables the message cap
+	MaxCharacters int    `yaml:"max_characters" json:"max_characters"` // 0 disables the character cap
+	Action        string `yaml:"action" json:"action"`                 // block, truncate
+}
+
+// conversationSize represents the measured size of a conversation
+type conversationSize struct {
+	Messages   int
+	Characters int
+}
+
+// NewConversationLimit creates a new conversation limit module
+func NewConversationLimit(logger *zap.SugaredLogger) *ConversationLimit {
+	return &ConversationLimit{
+		name:        "conversation-limit",
+		version:     "1.0.0",
+		description: "Caps the number of messages and characters a request may contain",
+		author:      "Leash Security",
+		logger:      logger,
+		status: &interfaces.ModuleStatus{
+			State:             interfaces.ModuleStateReady,
+			RequestsProcessed: 0,
+			ErrorCount:        0,
+		},
+	}
+}
+
+// Metadata methods
+func (cl *ConversationLimit) Name() string                { return cl.name }
+func (cl *ConversationLimit) Version() string             { return cl.version }
+func (cl *ConversationLimit) Type() interfaces.ModuleType { return interfaces.ModuleTypePolicy }
+func (cl *ConversationLimit) Description() string         { return cl.description }
+func (cl *ConversationLimit) Author() string              { return cl.author }
+func (cl *ConversationLimit) Dependencies() []string      { return []string{} }
+
+// Lifecycle methods
+func (cl *ConversationLimit) Initialize(ctx context.Context, config *interfaces.ModuleConfig) error {
+	cl.logger.Infof("Initializing conversation limit module")
+
+	limitConfig := &ConversationLimitConfig{
+		MaxMessages:   100,
+		MaxCharacters: 200000,
+		Action:        "block",
+	}
+
+	// Override with provided config
+	if config != nil && config.Config != nil {
+		if maxMessages, ok := config.Config["max_messages"].(int); ok {
+			limitConfig.MaxMessages = maxMessages
+		}
+		if maxCharacters, ok := config.Config["max_characters"].(int); ok {
+			limitConfig.MaxCharacters = maxCharacters
+		}
+		if action, ok := config.Config["action"].(string); ok {
+			limitConfig.Action = action
+		}
+	}
+
+	cl.config = limitConfig
+	cl.startTime = time.Now()
+	cl.status.State = interfaces.ModuleStateReady
+
+	cl.logger.Infof("Conversation limit initialized with max_messages=%d, max_characters=%d, action=%s",
+		limitConfig.MaxMessages, limitConfig.MaxCharacters, limitConfig.Action)
+	return nil
+}
+
+func (cl *ConversationLimit) Start(ctx context.Context) error {
+	cl.status.State = interfaces.ModuleStateRunning
+	cl.status.StartTime = time.Now()
+	cl.logger.Infof("Conversation limit module started")
+	return nil
+}
+
+func (cl *ConversationLimit) Stop(ctx context.Context) error {
+	cl.status.State = interfaces.ModuleStateDraining
+	cl.logger.Infof("Conversation limit module stopping")
+	return nil
+}
+
+func (cl *ConversationLimit) Shutdown(ctx context.Context) error {
+	cl.status.State = interfaces.ModuleStateStopped
+	cl.logger.Infof("Conversation limit module shutdown")
+	return nil
+}
+
+// Health and status methods
+func (cl *ConversationLimit) Health(ctx context.Context) (*interfaces.HealthStatus, error) {
+	return &interfaces.HealthStatus{
+		Status:        interfaces.HealthStateHealthy,
+		Message:       "Conversation limit is healthy",
+		LastCheck:     time.Now(),
+		CheckDuration: time.Millisecond,
+		Details: map[string]interface{}{
+			"max_messages":   cl.config.MaxMessages,
+			"max_characters": cl.config.MaxCharacters,
+			"action":         cl.config.Action,
+		},
+	}, nil
+}
+
+func (cl *ConversationLimit) Status() *interfaces.ModuleStatus {
+	status := *cl.status
+	status.LastActivity = time.Now()
+	return &status
+}
+
+func (cl *ConversationLimit) Metrics() map[string]interface{} {
+	return map[string]interface{}{
+		"requests_processed": cl.status.RequestsProcessed,
+		"errors":             cl.status.ErrorCount,
+		"uptime_seconds":     time.Since(cl.startTime).Seconds(),
+	}
+}
+
+// Processing methods
+func (cl *ConversationLimit) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequestContext) (*interfaces.ProcessRequestResult, error) {
+	start := time.Now()
+	cl.status.RequestsProcessed++
+	cl.status.LastActivity = time.Now()
+
+	var requestData map[string]interface{}
+	if err := json.Unmarshal(req.Body, &requestData); err != nil {
+		// Not a chat request; nothing to measure
+		return &interfaces.ProcessRequestResult{
+			Action:         interfaces.ActionContinue,
+			ProcessingTime: time.Since(start),
+		}, nil
+	}
+
+	messages, _ := requestData["messages"].([]interface{})
+	original := measure(messages)
+	annotations := map[string]interface{}{
+		"conversation_messages":   original.Messages,
+		"conversation_characters": original.Characters,
+	}
+
+	if cl.withinLimits(original) {
+		return &interfaces.ProcessRequestResult{
+			Action:         interfaces.ActionContinue,
+			ProcessingTime: time.Since(start),
+			Annotations:    annotations,
+		}, nil
+	}
+
+	annotations["conversation_limit_exceeded"] = true
+
+	if cl.config.Action == "truncate" {
+		truncated := cl.truncate(messages)
+		if size := measure(truncated); cl.withinLimits(size) {
+			requestData["messages"] = truncated
+			modifiedBody, err := json.Marshal(requestData)
+			if err != nil {
+				cl.status.ErrorCount++
+				return nil, fmt.Errorf("failed to marshal truncated request: %w", err)
+			}
+
+			annotations["conversation_truncated"] = true
+			annotations["conversation_messages"] = size.Messages
+			annotations["conversation_characters"] = size.Characters
+			annotations["conversation_original_messages"] = original.Messages
+			annotations["conversation_original_characters"] = original.Characters
+
+			cl.logger.Infof("Truncated request %s from %d to %d messages", req.RequestID, original.Messages, size.Messages)
+			return &interfaces.ProcessRequestResult{
+				Action:         interfaces.ActionTransform,
+				ModifiedBody:   modifiedBody,
+				ProcessingTime: time.Since(start),
+				Annotations:    annotations,
+			}, nil
+		}
+		// The most recent message alone exceeds the limits; fall through to block
+	}
+
+	reason := fmt.Sprintf("conversation too long: %d messages / %d characters exceeds limit of %d messages / %d characters",
+		original.Messages, original.Characters, cl.config.MaxMessages, cl.config.MaxCharacters)
+	cl.logger.Warnf("Blocking request %s: %s", req.RequestID, reason)
+
+	return &interfaces.ProcessRequestResult{
+		Action:         interfaces.ActionBlock,
+		BlockReason:    reason,
+		ProcessingTime: time.Since(start),
+		Annotations:    annotations,
+	}, nil
+}
+
+func (cl *ConversationLimit) ProcessResponse(ctx context.Context, resp *interfaces.ProcessResponseContext) (*interfaces.ProcessResponseResult, error) {
+	// Conversation limit doesn't need to process responses
+	return &interfaces.ProcessResponseResult{
+		Action: interfaces.ActionContinue,
+	}, nil
+}
+
+// Configuration methods
+func (cl *ConversationLimit) ValidateConfig(config *interfaces.ModuleConfig) error {
+	if config == nil {
+		return fmt.Errorf("config cannot be nil")
+	}
+
+	if configMap := config.Config; configMap != nil {
+		if action, ok := configMap["action"].(string); ok {
+			if action != "block" && action != "truncate" {
+				return fmt.Errorf("invalid action: %s", action)
+			}
+		}
+		if maxMessages, ok := configMap["max_messages"].(int); ok && maxMessages < 0 {
+			return fmt.Errorf("max_messages cannot be negative, got %d", maxMessages)
+		}
+		if maxCharacters, ok := configMap["max_characters"].(int); ok && maxCharacters < 0 {
+			return fmt.Errorf("max_characters cannot be negative, got %d", maxCharacters)
+		}
+	}
+
+	return nil
+}
+
+func (cl *ConversationLimit) UpdateConfig(ctx context.Context, config *interfaces.ModuleConfig) error {
+	if err := cl.ValidateConfig(config); err != nil {
+		return err
+	}
+
+	return cl.Initialize(ctx, config)
+}
+
+func (cl *ConversationLimit) GetConfig() *interfaces.ModuleConfig {
+	return &interfaces.ModuleConfig{
+		Name:     cl.name,
+		Type:     cl.Type().String(),
+		Enabled:  cl.status.State == interfaces.ModuleStateRunning,
+		Priority: 200, // After rate limiting, before content filtering
+		Config: map[string]interface{}{
+			"max_messages":   cl.config.MaxMessages,
+			"max_characters": cl.config.MaxCharacters,
+			"action":         cl.config.Action,
+		},
+	}
+}
+
+// withinLimits checks a conversation size against the configured caps
+func (cl *ConversationLimit) withinLimits(size conversationSize) bool {
+	if cl.config.MaxMessages > 0 && size.Messages > cl.config.MaxMessages {
+		return false
+	}
+	if cl.config.MaxCharacters > 0 && size.Characters > cl.config.MaxCharacters {
+		return false
+	}
+	return true
+}
+
+// truncate drops the oldest non-system messages until the conversation fits,
+// always keeping system messages and the most recent message
+func (cl *ConversationLimit) truncate(messages []interface{}) []interface{} {
+	truncated := append([]interface{}{}, messages...)
+
+	for !cl.withinLimits(measure(truncated)) {
+		dropped := false
+		for i := 0; i < len(truncated)-1; i++ {
+			if role, _ := messageRole(truncated[i]); role == "system" {
+				continue
+			}
+			truncated = append(truncated[:i], truncated[i+1:]...)
+			dropped = true
+			break
+		}
+		if !dropped {
+			break
+		}
+	}
+
+	return truncated
+}
+
+// measure counts messages and content characters in a conversation
+func measure(messages []interface{}) conversationSize {
+	size := conversationSize{Messages: len(messages)}
+	for _, msg := range messages {
+		if msgMap, ok := msg.(map[string]interface{}); ok {
+			size.Characters += utf8.RuneCountInString(chatcontent.MessageText(msgMap["content"]))
+		}
+	}
+	return size
+}
+
+// messageRole returns the role of a raw message
+func messageRole(msg interface{}) (string, bool) {
+	msgMap, ok := msg.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	role, ok := msgMap["role"].(string)
+	return role, ok
+}
@@ -0,0 +1,302 @@
+package costtracker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// AggregationStore is a store shared by the cost trackers of every region,
+// holding each tenant's global cost per usage bucket. Bucket keys are the
+// tracker's hourly ("2006-01-02-15"), daily ("2006-01-02") and monthly
+// ("2006-01") keys, which never collide, so one map holds all three windows.
+type AggregationStore interface {
+	// Add adds a region's cost deltas, keyed by tenant ID then bucket key
+	Add(ctx context.Context, region string, deltas map[string]map[string]float64) error
+	// Totals returns a tenant's global cost in each of the given buckets
+	Totals(ctx context.Context, tenantID string, buckets []string) (map[string]float64, error)
+	// Reset clears a tenant's global cost in each of the given buckets, or
+	// every tenant's when tenantID is empty
+	Reset(ctx context.Context, tenantID string, buckets []string) error
+}
+
+// AggregationConfig makes regional trackers enforce limits on a tenant's
+// global spend. Each tracker pushes its cost deltas to the shared store and
+// reads back the global totals every sync_interval; between syncs its view
+// is the last global totals plus its own unpushed costs, so spend in other
+// regions is counted at most one sync interval late.
+type AggregationConfig struct {
+	Enabled      bool          `yaml:"enabled" json:"enabled"`
+	Region       string        `yaml:"region" json:"region"`               // this tracker's region, required when enabled
+	SyncInterval time.Duration `yaml:"sync_interval" json:"sync_interval"` // how often deltas are pushed and totals read
+	MaxStaleness time.Duration `yaml:"max_staleness" json:"max_staleness"` // global view older than this is reported stale
+}
+
+// aggregator holds a regional tracker's view of global usage. It outlives
+// config updates so unpushed costs are never lost.
+type aggregator struct {
+	mu       sync.Mutex
+	store    AggregationStore
+	pending  map[string]map[string]float64 // tenant -> bucket -> cost not yet pushed
+	global   map[string]map[string]float64 // tenant -> bucket -> global cost at last sync
+	lastSync time.Time
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func newAggregator() *aggregator {
+	return &aggregator{
+		pending: make(map[string]map[string]float64),
+		global:  make(map[string]map[string]float64),
+	}
+}
+
+// parseAggregation reads the aggregation settings from module config
+func parseAggregation(raw interface{}) (AggregationConfig, error) {
+	aggregation := AggregationConfig{
+		SyncInterval: 10 * time.Second,
+		MaxStaleness: time.Minute,
+	}
+
+	fields, ok := raw.(map[string]interface{})
+	if !ok {
+		return aggregation, fmt.Errorf("aggregation must be a map")
+	}
+	if enabled, ok := fields["enabled"].(bool); ok {
+		aggregation.Enabled = enabled
+	}
+	if region, ok := fields["region"].(string); ok {
+		aggregation.Region = region
+	}
+	for key, target := range map[string]*time.Duration{
+		"sync_interval": &aggregation.SyncInterval,
+		"max_staleness": &aggregation.MaxStaleness,
+	} {
+		if value, exists := fields[key]; exists {
+			str, _ := value.(string)
+			duration, err := time.ParseDuration(str)
+			if err != nil || duration <= 0 {
+				return aggregation, fmt.Errorf("aggregation %s must be a positive duration, got %v", key, value)
+			}
+			*target = duration
+		}
+	}
+
+	if aggregation.Enabled && aggregation.Region == "" {
+		return aggregation, fmt.Errorf("aggregation region is required when aggregation is enabled")
+	}
+	if aggregation.MaxStaleness < aggregation.SyncInterval {
+		return aggregation, fmt.Errorf("aggregation max_staleness %v is shorter than sync_interval %v", aggregation.MaxStaleness, aggregation.SyncInterval)
+	}
+	return aggregation, nil
+}
+
+// SetAggregationStore sets the store regional trackers share. Without one,
+// limits are enforced on this tracker's local usage only.
+func (ct *CostTracker) SetAggregationStore(store AggregationStore) {
+	ct.aggregator.mu.Lock()
+	defer ct.aggregator.mu.Unlock()
+	ct.aggregator.store = store
+}
+
+// aggregating reports whether limits are enforced on global usage
+func (ct *CostTracker) aggregating() bool {
+	enabled := ct.currentConfig().Aggregation.Enabled
+	ct.aggregator.mu.Lock()
+	defer ct.aggregator.mu.Unlock()
+	return enabled && ct.aggregator.store != nil
+}
+
+// recordDelta queues a cost for the next push to the shared store
+func (a *aggregator) recordDelta(tenantID string, buckets []string, cost float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.store == nil {
+		return
+	}
+	deltas, ok := a.pending[tenantID]
+	if !ok {
+		deltas = make(map[string]float64)
+		a.pending[tenantID] = deltas
+	}
+	for _, bucket := range buckets {
+		deltas[bucket] += cost
+	}
+}
+
+// globalCost returns a tenant's global cost in a bucket: the total at the
+// last sync plus the costs this tracker has not pushed yet
+func (a *aggregator) globalCost(tenantID, bucket string) float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.global[tenantID][bucket] + a.pending[tenantID][bucket]
+}
+
+// SyncGlobal pushes this tracker's pending cost deltas to the shared store
+// and refreshes the global totals of the given tenants and of every tenant
+// with a limit. A failed push is retried on the next sync.
+func (ct *CostTracker) SyncGlobal(ctx context.Context, tenantIDs ...string) error {
+	config := ct.currentConfig()
+	a := ct.aggregator
+	a.mu.Lock()
+	store, batch := a.store, a.pending
+	a.pending = make(map[string]map[string]float64)
+	a.mu.Unlock()
+	if store == nil {
+		return nil
+	}
+
+	if len(batch) > 0 {
+		if err := store.Add(ctx, config.Aggregation.Region, batch); err != nil {
+			a.mu.Lock()
+			for tenantID, deltas := range batch {
+				if a.pending[tenantID] == nil {
+					a.pending[tenantID] = make(map[string]float64)
+				}
+				for bucket, cost := range deltas {
+					a.pending[tenantID][bucket] += cost
+				}
+			}
+			a.mu.Unlock()
+			return fmt.Errorf("failed to push cost deltas: %w", err)
+		}
+
+		// Count the pushed costs until the totals are read back, so a failed
+		// read never drops them from the global view
+		a.mu.Lock()
+		for tenantID, deltas := range batch {
+			if a.global[tenantID] == nil {
+				a.global[tenantID] = make(map[string]float64)
+			}
+			for bucket, cost := range deltas {
+				a.global[tenantID][bucket] += cost
+			}
+		}
+		a.mu.Unlock()
+	}
+
+	tenants := make(map[string]bool)
+	for _, tenantID := range tenantIDs {
+		tenants[tenantID] = true
+	}
+	for tenantID := range config.Limits {
+		tenants[tenantID] = true
+	}
+	for tenantID := range batch {
+		tenants[tenantID] = true
+	}
+	// Limits are only checked against the current buckets
+	ct.mu.RLock()
+	hourKey, dayKey, monthKey := windowKeys(ct.clock.Now(), ct.location)
+	ct.mu.RUnlock()
+	buckets := []string{hourKey, dayKey, monthKey}
+	for tenantID := range tenants {
+		totals, err := store.Totals(ctx, tenantID, buckets)
+		if err != nil {
+			return fmt.Errorf("failed to read global cost for tenant %s: %w", tenantID, err)
+		}
+		a.mu.Lock()
+		a.global[tenantID] = totals
+		a.mu.Unlock()
+	}
+
+	now := ct.now()
+	a.mu.Lock()
+	a.lastSync = now
+	a.mu.Unlock()
+	return nil
+}
+
+// resetGlobal clears the current buckets of the given windows from the
+// global view and the shared store, for one tenant or every tenant when
+// tenantID is empty, so the next sync does not restore the reset spend.
+// Costs other regions have not pushed yet still count after the reset.
+func (ct *CostTracker) resetGlobal(tenantID string, windows ...UsageWindow) error {
+	if !ct.aggregating() {
+		return nil
+	}
+
+	ct.mu.RLock()
+	hourKey, dayKey, monthKey := windowKeys(ct.clock.Now(), ct.location)
+	ct.mu.RUnlock()
+	keys := map[UsageWindow]string{WindowHourly: hourKey, WindowDaily: dayKey, WindowMonthly: monthKey}
+	buckets := make([]string, 0, len(windows))
+	for _, window := range windows {
+		buckets = append(buckets, keys[window])
+	}
+
+	a := ct.aggregator
+	a.mu.Lock()
+	store := a.store
+	for _, view := range []map[string]map[string]float64{a.pending, a.global} {
+		for tenant, costs := range view {
+			if tenantID != "" && tenant != tenantID {
+				continue
+			}
+			for _, bucket := range buckets {
+				delete(costs, bucket)
+			}
+		}
+	}
+	a.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), ct.currentConfig().Aggregation.SyncInterval)
+	defer cancel()
+	return store.Reset(ctx, tenantID, buckets)
+}
+
+// globalStale reports whether the global view is older than max_staleness
+func (ct *CostTracker) globalStale() bool {
+	ct.aggregator.mu.Lock()
+	lastSync := ct.aggregator.lastSync
+	ct.aggregator.mu.Unlock()
+	if lastSync.IsZero() {
+		lastSync = ct.startTime
+	}
+	return ct.now().Sub(lastSync) > ct.currentConfig().Aggregation.MaxStaleness
+}
+
+// startSyncing syncs with the shared store every interval until stopSyncing
+func (ct *CostTracker) startSyncing(interval time.Duration) {
+	a := ct.aggregator
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.store == nil || a.stop != nil {
+		return
+	}
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	a.stop, a.done = stop, done
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), interval)
+				if err := ct.SyncGlobal(ctx); err != nil {
+					ct.logger.Warnf("Cost aggregation sync failed, retrying next interval: %v", err)
+				}
+				cancel()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// stopSyncing stops periodic syncs, waiting for one in progress
+func (ct *CostTracker) stopSyncing() {
+	a := ct.aggregator
+	a.mu.Lock()
+	stop, done := a.stop, a.done
+	a.stop, a.done = nil, nil
+	a.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
@@ -0,0 +1,50 @@
+package costtracker
+
+import (
+	"sync"
+	"time"
+)
+
+// windowClock reads the time usage is bucketed and reset at. It never runs
+// backwards: when the wall clock is stepped back (e.g. by an NTP correction)
+// it holds at the latest time seen until the wall clock catches up, so usage
+// is never booked into a window that has already closed or been reset.
+type windowClock struct {
+	mu   sync.Mutex
+	now  func() time.Time
+	last time.Time
+}
+
+// newWindowClock creates a clock reading now
+func newWindowClock(now func() time.Time) *windowClock {
+	return &windowClock{now: now}
+}
+
+// Now returns the current wall time in UTC, without a monotonic reading so
+// that it compares with window boundaries by wall time only
+func (c *windowClock) Now() time.Time {
+	t := c.now().Round(0).UTC()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t.Before(c.last) {
+		return c.last
+	}
+	c.last = t
+	return t
+}
+
+// SetClock replaces the source of the current time, e.g. with a clock synced
+// from a trusted source or a fixed clock in tests. Bucket keys are always
+// computed in the configured timezone, whatever the clock's location.
+func (ct *CostTracker) SetClock(now func() time.Time) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	ct.clock = newWindowClock(now)
+}
+
+// windowKeys returns the hourly, daily and monthly bucket keys of t in location
+func windowKeys(t time.Time, location *time.Location) (hour, day, month string) {
+	local := t.In(location)
+	return local.Format("2006-01-02-15"), local.Format("2006-01-02"), local.Format("2006-01")
+}
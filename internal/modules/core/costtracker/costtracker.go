@@ -2,11 +2,11 @@ package costtracker
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"sync"
 	"time"
 
+	"github.com/bendiamant/leash-gateway/internal/modules/chatcontent"
 	"github.com/bendiamant/leash-gateway/internal/modules/interface"
 	"go.uber.org/zap"
 )
@@ -22,19 +22,44 @@ type CostTracker struct {
 	logger      *zap.SugaredLogger
 	status      *interfaces.ModuleStatus
 	startTime   time.Time
+	location    *time.Location
+	clock       *windowClock
+	stopResets  chan struct{}
+	resetsDone  chan struct{}
+	aggregator  *aggregator
 	mu          sync.RWMutex
 }
 
 // CostTrackerConfig represents cost tracker configuration
 type CostTrackerConfig struct {
-	Storage           string                    `yaml:"storage" json:"storage"`                       // memory, database
-	AggregationWindow time.Duration            `yaml:"aggregation_window" json:"aggregation_window"` // 1h, 24h
-	AlertThresholds   []AlertThreshold          `yaml:"alert_thresholds" json:"alert_thresholds"`
-	Limits            map[string]CostLimit      `yaml:"limits" json:"limits"` // per-tenant limits
-	TrackRequests     bool                      `yaml:"track_requests" json:"track_requests"`
-	TrackResponses    bool                      `yaml:"track_responses" json:"track_responses"`
+	Storage           string               `yaml:"storage" json:"storage"`                       // memory, database
+	AggregationWindow time.Duration        `yaml:"aggregation_window" json:"aggregation_window"` // 1h, 24h
+	AlertThresholds   []AlertThreshold     `yaml:"alert_thresholds" json:"alert_thresholds"`
+	Limits            map[string]CostLimit `yaml:"limits" json:"limits"` // per-tenant limits
+	TrackRequests     bool                 `yaml:"track_requests" json:"track_requests"`
+	TrackResponses    bool                 `yaml:"track_responses" json:"track_responses"`
+	ResetSchedule     ResetSchedule        `yaml:"reset_schedule" json:"reset_schedule"`
+	Timezone          string               `yaml:"timezone" json:"timezone"`                 // IANA timezone usage is bucketed and reset in; UTC by default so replicas agree
+	TokensPerImage    int                  `yaml:"tokens_per_image" json:"tokens_per_image"` // estimated input tokens per image part
+	Aggregation       AggregationConfig    `yaml:"aggregation" json:"aggregation"`           // enforce limits on global spend across regions
 }
 
+// ResetSchedule represents scheduled usage window resets
+type ResetSchedule struct {
+	Windows       []UsageWindow `yaml:"windows" json:"windows"`               // windows reset at each of their boundaries
+	Timezone      string        `yaml:"timezone" json:"timezone"`             // used as the tracker timezone when that is not set
+	CheckInterval time.Duration `yaml:"check_interval" json:"check_interval"` // how often boundaries are checked
+}
+
+// UsageWindow identifies a usage aggregation bucket
+type UsageWindow string
+
+const (
+	WindowHourly  UsageWindow = "hourly"
+	WindowDaily   UsageWindow = "daily"
+	WindowMonthly UsageWindow = "monthly"
+)
+
 // AlertThreshold represents a cost alert threshold
 type AlertThreshold struct {
 	Threshold    float64 `yaml:"threshold" json:"threshold"`
@@ -69,6 +94,8 @@ func NewCostTracker(logger *zap.SugaredLogger) *CostTracker {
 		description: "Cost tracking and limiting module for monitoring LLM usage costs",
 		author:      "Leash Security",
 		usage:       make(map[string]*TenantUsage),
+		clock:       newWindowClock(time.Now),
+		aggregator:  newAggregator(),
 		logger:      logger,
 		status: &interfaces.ModuleStatus{
 			State:             interfaces.ModuleStateReady,
@@ -90,6 +117,18 @@ func (ct *CostTracker) Dependencies() []string          { return []string{} }
 func (ct *CostTracker) Initialize(ctx context.Context, config *interfaces.ModuleConfig) error {
 	ct.logger.Infof("Initializing cost tracker module")
 
+	if err := ct.configure(config); err != nil {
+		return err
+	}
+
+	ct.startTime = time.Now()
+	ct.status.State = interfaces.ModuleStateReady
+	return nil
+}
+
+// configure parses module config and swaps it in with its timezone, leaving
+// usage and the module state untouched
+func (ct *CostTracker) configure(config *interfaces.ModuleConfig) error {
 	// Parse configuration
 	trackerConfig := &CostTrackerConfig{
 		Storage:           "memory",
@@ -99,7 +138,16 @@ func (ct *CostTracker) Initialize(ctx context.Context, config *interfaces.Module
 		AlertThresholds: []AlertThreshold{
 			{Threshold: 100.0, Notification: "log", Message: "Cost threshold exceeded"},
 		},
-		Limits: make(map[string]CostLimit),
+		Limits:         make(map[string]CostLimit),
+		TokensPerImage: 765,
+		ResetSchedule: ResetSchedule{
+			Timezone:      "UTC",
+			CheckInterval: time.Minute,
+		},
+		Aggregation: AggregationConfig{
+			SyncInterval: 10 * time.Second,
+			MaxStaleness: time.Minute,
+		},
 	}
 
 	// Override with provided config
@@ -118,6 +166,26 @@ func (ct *CostTracker) Initialize(ctx context.Context, config *interfaces.Module
 		if trackResponses, ok := config.Config["track_responses"].(bool); ok {
 			trackerConfig.TrackResponses = trackResponses
 		}
+		if tokensPerImage, ok := config.Config["tokens_per_image"].(int); ok {
+			trackerConfig.TokensPerImage = tokensPerImage
+		}
+		if timezone, ok := config.Config["timezone"].(string); ok {
+			trackerConfig.Timezone = timezone
+		}
+		if limits, ok := config.Config["limits"].(map[string]interface{}); ok {
+			for tenantID, limit := range limits {
+				if limitMap, ok := limit.(map[string]interface{}); ok {
+					trackerConfig.Limits[tenantID] = parseLimit(limitMap)
+				}
+			}
+		}
+		if raw, ok := config.Config["aggregation"]; ok {
+			aggregation, err := parseAggregation(raw)
+			if err != nil {
+				return err
+			}
+			trackerConfig.Aggregation = aggregation
+		}
 		
 		// Parse alert thresholds
 		if thresholds, ok := config.Config["alert_thresholds"].([]interface{}); ok {
@@ -138,19 +206,59 @@ func (ct *CostTracker) Initialize(ctx context.Context, config *interfaces.Module
 				}
 			}
 		}
+
+		// Parse reset schedule
+		if schedule, ok := config.Config["reset_schedule"].(map[string]interface{}); ok {
+			if windows, ok := schedule["windows"].([]interface{}); ok {
+				for _, window := range windows {
+					if str, ok := window.(string); ok {
+						trackerConfig.ResetSchedule.Windows = append(trackerConfig.ResetSchedule.Windows, UsageWindow(str))
+					}
+				}
+			}
+			if timezone, ok := schedule["timezone"].(string); ok {
+				trackerConfig.ResetSchedule.Timezone = timezone
+			}
+			if interval, ok := schedule["check_interval"]; ok {
+				duration, err := parseCheckInterval(interval)
+				if err != nil {
+					return err
+				}
+				trackerConfig.ResetSchedule.CheckInterval = duration
+			}
+		}
+	}
+
+	// One timezone governs buckets, alerts and scheduled resets
+	if trackerConfig.Timezone == "" {
+		trackerConfig.Timezone = trackerConfig.ResetSchedule.Timezone
+	}
+	trackerConfig.ResetSchedule.Timezone = trackerConfig.Timezone
+	location, err := time.LoadLocation(trackerConfig.Timezone)
+	if err != nil {
+		return fmt.Errorf("invalid timezone %s: %w", trackerConfig.Timezone, err)
+	}
+	for _, window := range trackerConfig.ResetSchedule.Windows {
+		if !window.valid() {
+			return fmt.Errorf("invalid reset window: %s", window)
+		}
 	}
 
+	ct.mu.Lock()
+	ct.location = location
 	ct.config = trackerConfig
-	ct.startTime = time.Now()
-	ct.status.State = interfaces.ModuleStateReady
+	ct.mu.Unlock()
 
-	ct.logger.Infof("Cost tracker initialized with storage=%s, window=%v, %d alert thresholds", 
-		trackerConfig.Storage, trackerConfig.AggregationWindow, len(trackerConfig.AlertThresholds))
+	ct.logger.Infof("Cost tracker initialized with storage=%s, window=%v, %d alert thresholds, scheduled resets=%v (%s)", 
+		trackerConfig.Storage, trackerConfig.AggregationWindow, len(trackerConfig.AlertThresholds),
+		trackerConfig.ResetSchedule.Windows, trackerConfig.Timezone)
 
 	return nil
 }
 
 func (ct *CostTracker) Start(ctx context.Context) error {
+	ct.startBackground()
+
 	ct.status.State = interfaces.ModuleStateRunning
 	ct.status.StartTime = time.Now()
 	ct.logger.Infof("Cost tracker module started")
@@ -159,11 +267,52 @@ func (ct *CostTracker) Start(ctx context.Context) error {
 
 func (ct *CostTracker) Stop(ctx context.Context) error {
 	ct.status.State = interfaces.ModuleStateDraining
+	ct.stopBackground()
 	ct.logger.Infof("Cost tracker module stopping")
 	return nil
 }
 
+// startBackground starts the scheduled resets and aggregation syncs the
+// current configuration asks for
+func (ct *CostTracker) startBackground() {
+	config := ct.currentConfig()
+	if len(config.ResetSchedule.Windows) > 0 {
+		ct.stopResets = make(chan struct{})
+		ct.resetsDone = make(chan struct{})
+		go ct.runScheduledResets(config.ResetSchedule.CheckInterval, ct.stopResets, ct.resetsDone)
+	}
+	if config.Aggregation.Enabled {
+		ct.startSyncing(config.Aggregation.SyncInterval)
+	}
+}
+
+// stopBackground stops scheduled resets and aggregation syncs, waiting for
+// any in progress
+func (ct *CostTracker) stopBackground() {
+	if ct.stopResets != nil {
+		close(ct.stopResets)
+		<-ct.resetsDone
+		ct.stopResets = nil
+	}
+	ct.stopSyncing()
+}
+
+// currentConfig returns the configuration, which is replaced whole rather
+// than modified when the tracker is reconfigured
+func (ct *CostTracker) currentConfig() *CostTrackerConfig {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	return ct.config
+}
+
 func (ct *CostTracker) Shutdown(ctx context.Context) error {
+	ct.stopSyncing()
+	// Push the last deltas so other regions see this replica's final spend
+	if ct.aggregating() {
+		if err := ct.SyncGlobal(ctx); err != nil {
+			ct.logger.Warnf("Final cost aggregation sync failed: %v", err)
+		}
+	}
 	ct.status.State = interfaces.ModuleStateStopped
 	ct.logger.Infof("Cost tracker module shutdown")
 	return nil
@@ -171,15 +320,25 @@ func (ct *CostTracker) Shutdown(ctx context.Context) error {
 
 // Health and status methods
 func (ct *CostTracker) Health(ctx context.Context) (*interfaces.HealthStatus, error) {
+	config := ct.currentConfig()
+	status := interfaces.HealthStateHealthy
+	message := "Cost tracker is healthy"
+	if ct.aggregating() && ct.globalStale() {
+		status = interfaces.HealthStateDegraded
+		message = fmt.Sprintf("Global cost view is older than %v; limits use the last synced totals", config.Aggregation.MaxStaleness)
+	}
+
 	return &interfaces.HealthStatus{
-		Status:        interfaces.HealthStateHealthy,
-		Message:       "Cost tracker is healthy",
+		Status:        status,
+		Message:       message,
 		LastCheck:     time.Now(),
 		CheckDuration: time.Millisecond,
 		Details: map[string]interface{}{
 			"tracked_tenants":   len(ct.usage),
-			"storage":           ct.config.Storage,
-			"alert_thresholds":  len(ct.config.AlertThresholds),
+			"storage":           config.Storage,
+			"alert_thresholds":  len(config.AlertThresholds),
+			"limited_tenants":   len(config.Limits),
+			"aggregating":       ct.aggregating(),
 		},
 	}, nil
 }
@@ -215,8 +374,8 @@ func (ct *CostTracker) Metrics() map[string]interface{} {
 // Processing methods
 func (ct *CostTracker) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequestContext) (*interfaces.ProcessRequestResult, error) {
 	start := time.Now()
-	
-	if !ct.config.TrackRequests {
+
+	if !ct.currentConfig().TrackRequests {
 		return &interfaces.ProcessRequestResult{
 			Action:         interfaces.ActionContinue,
 			ProcessingTime: time.Since(start),
@@ -242,7 +401,7 @@ func (ct *CostTracker) ProcessRequest(ctx context.Context, req *interfaces.Proce
 func (ct *CostTracker) ProcessResponse(ctx context.Context, resp *interfaces.ProcessResponseContext) (*interfaces.ProcessResponseResult, error) {
 	start := time.Now()
 
-	if !ct.config.TrackResponses {
+	if !ct.currentConfig().TrackResponses {
 		return &interfaces.ProcessResponseResult{
 			Action:         interfaces.ActionContinue,
 			ProcessingTime: time.Since(start),
@@ -258,13 +417,18 @@ func (ct *CostTracker) ProcessResponse(ctx context.Context, resp *interfaces.Pro
 	// Check for alert thresholds
 	ct.checkAlertThresholds(resp.TenantID, actualCost)
 
+	annotations := map[string]interface{}{
+		"actual_cost_usd": actualCost,
+		"cost_tracked":    true,
+	}
+	if summary, ok := chatcontent.ParseResponse(resp.ResponseBody); ok && summary.Choices > 0 {
+		annotations["response_choices"] = summary.Choices
+	}
+
 	return &interfaces.ProcessResponseResult{
 		Action:         interfaces.ActionContinue,
 		ProcessingTime: time.Since(start),
-		Annotations: map[string]interface{}{
-			"actual_cost_usd": actualCost,
-			"cost_tracked":    true,
-		},
+		Annotations:    annotations,
 	}, nil
 }
 
@@ -280,20 +444,99 @@ func (ct *CostTracker) ValidateConfig(config *interfaces.ModuleConfig) error {
 				return fmt.Errorf("invalid storage type: %s", storage)
 			}
 		}
+		if tokensPerImage, ok := configMap["tokens_per_image"].(int); ok && tokensPerImage < 0 {
+			return fmt.Errorf("tokens_per_image cannot be negative, got %d", tokensPerImage)
+		}
+		if limits, ok := configMap["limits"]; ok {
+			limitsMap, ok := limits.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("limits must be a map of tenant limits")
+			}
+			for tenantID, limit := range limitsMap {
+				limitMap, ok := limit.(map[string]interface{})
+				if !ok {
+					return fmt.Errorf("limits for tenant %s must be a map", tenantID)
+				}
+				for key, value := range limitMap {
+					if amount, ok := toFloat(value); !ok || amount < 0 {
+						return fmt.Errorf("tenant %s %s must be a non-negative number, got %v", tenantID, key, value)
+					}
+				}
+			}
+		}
+		if aggregation, ok := configMap["aggregation"]; ok {
+			if _, err := parseAggregation(aggregation); err != nil {
+				return err
+			}
+		}
+		if timezone, ok := configMap["timezone"].(string); ok {
+			if _, err := time.LoadLocation(timezone); err != nil {
+				return fmt.Errorf("invalid timezone %s: %w", timezone, err)
+			}
+		}
+		if schedule, ok := configMap["reset_schedule"].(map[string]interface{}); ok {
+			if timezone, ok := schedule["timezone"].(string); ok {
+				if _, err := time.LoadLocation(timezone); err != nil {
+					return fmt.Errorf("invalid reset timezone %s: %w", timezone, err)
+				}
+			}
+			if windows, ok := schedule["windows"].([]interface{}); ok {
+				for _, window := range windows {
+					if str, _ := window.(string); !UsageWindow(str).valid() {
+						return fmt.Errorf("invalid reset window: %v", window)
+					}
+				}
+			}
+			if interval, ok := schedule["check_interval"]; ok {
+				if _, err := parseCheckInterval(interval); err != nil {
+					return err
+				}
+			}
+		}
 	}
 
 	return nil
 }
 
+// parseCheckInterval parses reset_schedule.check_interval, which must be a
+// positive duration
+func parseCheckInterval(value interface{}) (time.Duration, error) {
+	interval, ok := value.(string)
+	if !ok {
+		return 0, fmt.Errorf("reset check_interval must be a duration string, got %v", value)
+	}
+	duration, err := time.ParseDuration(interval)
+	if err != nil {
+		return 0, fmt.Errorf("invalid reset check_interval: %w", err)
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("reset check_interval must be positive, got %v", duration)
+	}
+	return duration, nil
+}
+
+// UpdateConfig applies new settings, keeping usage. A running tracker
+// restarts its scheduled resets and aggregation syncs with them.
 func (ct *CostTracker) UpdateConfig(ctx context.Context, config *interfaces.ModuleConfig) error {
 	if err := ct.ValidateConfig(config); err != nil {
 		return err
 	}
 
-	return ct.Initialize(ctx, config)
+	running := ct.status.State == interfaces.ModuleStateRunning
+	if running {
+		ct.stopBackground()
+	}
+	err := ct.configure(config)
+	if running {
+		ct.startBackground()
+	}
+	return err
 }
 
 func (ct *CostTracker) GetConfig() *interfaces.ModuleConfig {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+
 	return &interfaces.ModuleConfig{
 		Name:     ct.name,
 		Type:     ct.Type().String(),
@@ -305,6 +548,11 @@ func (ct *CostTracker) GetConfig() *interfaces.ModuleConfig {
 			"alert_thresholds":   ct.config.AlertThresholds,
 			"track_requests":     ct.config.TrackRequests,
 			"track_responses":    ct.config.TrackResponses,
+			"reset_schedule":     ct.config.ResetSchedule,
+			"tokens_per_image":   ct.config.TokensPerImage,
+			"timezone":           ct.config.Timezone,
+			"limits":             ct.config.Limits,
+			"aggregation":        ct.config.Aggregation,
 		},
 	}
 }
@@ -313,8 +561,13 @@ func (ct *CostTracker) GetConfig() *interfaces.ModuleConfig {
 func (ct *CostTracker) estimateRequestCost(req *interfaces.ProcessRequestContext) float64 {
 	// Simple estimation based on request size
 	// In reality, this would use model-specific token estimation
-	bodySize := len(req.Body)
-	estimatedTokens := bodySize / 4 // Rough estimate: 4 chars per token
+	estimatedTokens := len(req.Body) / 4 // Rough estimate: 4 chars per token
+
+	// For chat requests, count message text and a flat token cost per image
+	// so inline image data does not inflate the estimate
+	if summary, ok := chatcontent.ParseRequest(req.Body); ok && summary.Messages > 0 {
+		estimatedTokens = len(summary.Text)/4 + len(summary.Images)*ct.currentConfig().TokensPerImage
+	}
 	
 	// Use a default cost per token (would be model-specific in reality)
 	costPer1kTokens := 0.002 // Default cost
@@ -334,6 +587,12 @@ func (ct *CostTracker) calculateResponseCost(resp *interfaces.ProcessResponseCon
 		return inputCost + outputCost
 	}
 
+	// Without usage, estimate completion tokens from the text of every
+	// choice, since n > 1 requests are billed for all of them
+	if summary, ok := chatcontent.ParseResponse(resp.ResponseBody); ok {
+		return float64(len(summary.Text)/4) / 1000.0 * 0.002
+	}
+
 	return 0
 }
 
@@ -353,10 +612,8 @@ func (ct *CostTracker) trackUsage(tenantID, provider, model string, cost float64
 		ct.usage[tenantID] = usage
 	}
 
-	now := time.Now()
-	hourKey := now.Format("2006-01-02-15")
-	dayKey := now.Format("2006-01-02")
-	monthKey := now.Format("2006-01")
+	now := ct.clock.Now()
+	hourKey, dayKey, monthKey := windowKeys(now, ct.location)
 
 	// Update usage
 	usage.HourlyUsage[hourKey] += cost
@@ -371,6 +628,10 @@ func (ct *CostTracker) trackUsage(tenantID, provider, model string, cost float64
 	usage.Metadata["last_model"] = model
 	usage.Metadata["last_cost"] = cost
 
+	if ct.config.Aggregation.Enabled {
+		ct.aggregator.recordDelta(tenantID, []string{hourKey, dayKey, monthKey}, cost)
+	}
+
 	ct.logger.Debugf("Tracked usage for tenant %s: $%.6f (total: $%.6f)", 
 		tenantID, cost, usage.TotalCost)
 }
@@ -378,17 +639,18 @@ func (ct *CostTracker) trackUsage(tenantID, provider, model string, cost float64
 func (ct *CostTracker) checkAlertThresholds(tenantID string, cost float64) {
 	ct.mu.RLock()
 	usage, exists := ct.usage[tenantID]
-	ct.mu.RUnlock()
-
 	if !exists {
+		ct.mu.RUnlock()
 		return
 	}
 
 	// Check daily usage against thresholds
-	today := time.Now().Format("2006-01-02")
+	_, today, _ := windowKeys(ct.clock.Now(), ct.location)
 	dailyCost := usage.DailyUsage[today]
+	thresholds := ct.config.AlertThresholds
+	ct.mu.RUnlock()
 
-	for _, threshold := range ct.config.AlertThresholds {
+	for _, threshold := range thresholds {
 		if dailyCost >= threshold.Threshold {
 			ct.sendAlert(tenantID, dailyCost, threshold)
 		}
@@ -416,6 +678,80 @@ func (ct *CostTracker) sendAlert(tenantID string, cost float64, threshold AlertT
 	}
 }
 
+// checkLimits returns the first window in which a tenant's spend has reached
+// its limit, for the cost limiter. Spend is the tenant's global spend
+// when aggregating across regions, otherwise this tracker's own.
+func (ct *CostTracker) checkLimits(tenantID string) (UsageWindow, float64, float64, bool) {
+	for _, check := range ct.limitSpend(tenantID) {
+		if check.spent >= check.limit {
+			return check.window, check.spent, check.limit, true
+		}
+	}
+	return "", 0, 0, false
+}
+
+// LimitProximity returns a tenant's spend as a fraction of its nearest cost
+// limit, capped at 1 once a limit is reached; 0 for tenants without limits
+func (ct *CostTracker) LimitProximity(tenantID string) float64 {
+	proximity := 0.0
+	for _, check := range ct.limitSpend(tenantID) {
+		if check.spent >= check.limit {
+			return 1
+		}
+		proximity = max(proximity, check.spent/check.limit)
+	}
+	return proximity
+}
+
+// windowSpend is a tenant's spend against its limit in one window
+type windowSpend struct {
+	window UsageWindow
+	spent  float64
+	limit  float64
+}
+
+// limitSpend returns a tenant's current spend in each window it has a limit
+// for, hourly first
+func (ct *CostTracker) limitSpend(tenantID string) []windowSpend {
+	ct.mu.RLock()
+	limit, exists := ct.config.Limits[tenantID]
+	if !exists {
+		ct.mu.RUnlock()
+		return nil
+	}
+	hourKey, dayKey, monthKey := windowKeys(ct.clock.Now(), ct.location)
+	usage := ct.usage[tenantID]
+	local := map[string]float64{}
+	if usage != nil {
+		local[hourKey] = usage.HourlyUsage[hourKey]
+		local[dayKey] = usage.DailyUsage[dayKey]
+		local[monthKey] = usage.MonthlyUsage[monthKey]
+	}
+	ct.mu.RUnlock()
+
+	global := ct.aggregating()
+	var spend []windowSpend
+	for _, check := range []struct {
+		window UsageWindow
+		bucket string
+		limit  float64
+	}{
+		{WindowHourly, hourKey, limit.HourlyLimitUSD},
+		{WindowDaily, dayKey, limit.DailyLimitUSD},
+		{WindowMonthly, monthKey, limit.MonthlyLimitUSD},
+	} {
+		if check.limit <= 0 {
+			continue
+		}
+		spent := local[check.bucket]
+		if global {
+			spent = ct.aggregator.globalCost(tenantID, check.bucket)
+		}
+		spend = append(spend, windowSpend{window: check.window, spent: spent, limit: check.limit})
+	}
+	return spend
+}
+
 // GetTenantUsage returns usage information for a tenant
 func (ct *CostTracker) GetTenantUsage(tenantID string) (*TenantUsage, error) {
 	ct.mu.RLock()
@@ -445,16 +781,167 @@ func (ct *CostTracker) GetAllUsage() map[string]*TenantUsage {
 	return result
 }
 
-// ResetUsage resets usage data for a tenant
+// ResetUsage resets usage data for a tenant. When aggregating, the tenant's
+// global spend in the current windows is cleared as well.
 func (ct *CostTracker) ResetUsage(tenantID string) error {
 	ct.mu.Lock()
-	defer ct.mu.Unlock()
+	_, exists := ct.usage[tenantID]
+	delete(ct.usage, tenantID)
+	ct.mu.Unlock()
 
-	if _, exists := ct.usage[tenantID]; !exists {
+	if !exists && !ct.aggregating() {
 		return fmt.Errorf("no usage data for tenant %s", tenantID)
 	}
-
-	delete(ct.usage, tenantID)
+	if err := ct.resetGlobal(tenantID, WindowHourly, WindowDaily, WindowMonthly); err != nil {
+		return fmt.Errorf("failed to reset global cost for tenant %s: %w", tenantID, err)
+	}
 	ct.logger.Infof("Reset usage data for tenant %s", tenantID)
 	return nil
 }
+
+// ResetAll resets usage data for every tenant, e.g. at a billing boundary.
+// When aggregating, global spend in the current windows is cleared as well.
+func (ct *CostTracker) ResetAll() int {
+	ct.mu.Lock()
+	count := len(ct.usage)
+	ct.usage = make(map[string]*TenantUsage)
+	ct.mu.Unlock()
+
+	if err := ct.resetGlobal("", WindowHourly, WindowDaily, WindowMonthly); err != nil {
+		ct.logger.Warnf("Failed to reset global cost: %v", err)
+	}
+	ct.logger.Infof("Reset usage data for all %d tenants", count)
+	return count
+}
+
+// ResetWindow clears a single usage window for a tenant, preserving the
+// other windows and lifetime totals. When aggregating, the tenant's global
+// spend in the window is cleared as well.
+func (ct *CostTracker) ResetWindow(tenantID string, window UsageWindow) error {
+	if !window.valid() {
+		return fmt.Errorf("invalid usage window: %s", window)
+	}
+
+	ct.mu.Lock()
+	usage, exists := ct.usage[tenantID]
+	if exists {
+		usage.resetWindow(window)
+	}
+	ct.mu.Unlock()
+
+	if !exists && !ct.aggregating() {
+		return fmt.Errorf("no usage data for tenant %s", tenantID)
+	}
+	if err := ct.resetGlobal(tenantID, window); err != nil {
+		return fmt.Errorf("failed to reset global %s cost for tenant %s: %w", window, tenantID, err)
+	}
+	ct.logger.Infof("Reset %s usage for tenant %s", window, tenantID)
+	return nil
+}
+
+// ApplyScheduledResets resets every scheduled window whose boundary falls in
+// (since, now] and returns the windows that were reset
+func (ct *CostTracker) ApplyScheduledResets(since, now time.Time) []UsageWindow {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	var reset []UsageWindow
+	for _, window := range ct.config.ResetSchedule.Windows {
+		if window.start(now, ct.location).After(since) {
+			for _, usage := range ct.usage {
+				usage.resetWindow(window)
+			}
+			reset = append(reset, window)
+		}
+	}
+
+	if len(reset) > 0 {
+		ct.logger.Infof("Scheduled reset of %v usage for %d tenants", reset, len(ct.usage))
+	}
+	return reset
+}
+
+// runScheduledResets applies scheduled resets until stopped
+func (ct *CostTracker) runScheduledResets(interval time.Duration, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := ct.now()
+	for {
+		select {
+		case <-ticker.C:
+			now := ct.now()
+			ct.ApplyScheduledResets(last, now)
+			last = now
+		case <-stop:
+			return
+		}
+	}
+}
+
+// now reads the tracker's clock
+func (ct *CostTracker) now() time.Time {
+	ct.mu.RLock()
+	clock := ct.clock
+	ct.mu.RUnlock()
+	return clock.Now()
+}
+
+// resetWindow clears the buckets of a usage window
+func (u *TenantUsage) resetWindow(window UsageWindow) {
+	switch window {
+	case WindowHourly:
+		u.HourlyUsage = make(map[string]float64)
+	case WindowDaily:
+		u.DailyUsage = make(map[string]float64)
+	case WindowMonthly:
+		u.MonthlyUsage = make(map[string]float64)
+	}
+}
+
+// valid reports whether w is a known usage window
+func (w UsageWindow) valid() bool {
+	return w == WindowHourly || w == WindowDaily || w == WindowMonthly
+}
+
+// start returns the beginning of the window containing t in the given location
+func (w UsageWindow) start(t time.Time, location *time.Location) time.Time {
+	local := t.In(location)
+	switch w {
+	case WindowHourly:
+		return time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), 0, 0, 0, location)
+	case WindowMonthly:
+		return time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, location)
+	default:
+		return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, location)
+	}
+}
+
+// parseLimit converts a raw config map into a tenant cost limit
+func parseLimit(limitMap map[string]interface{}) CostLimit {
+	limit := CostLimit{}
+	if value, ok := toFloat(limitMap["hourly_limit_usd"]); ok {
+		limit.HourlyLimitUSD = value
+	}
+	if value, ok := toFloat(limitMap["daily_limit_usd"]); ok {
+		limit.DailyLimitUSD = value
+	}
+	if value, ok := toFloat(limitMap["monthly_limit_usd"]); ok {
+		limit.MonthlyLimitUSD = value
+	}
+	return limit
+}
+
+// toFloat reads a numeric config value
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,165 @@
+package costtracker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"go.uber.org/zap"
+)
+
+// LimitBlockReason is the reason given for requests blocked on cost limits
+const LimitBlockReason = "cost_limit_exceeded"
+
+// CostLimiter implements the policy blocking requests from tenants whose spend
+// has reached a cost limit. The cost tracker is a sink, whose results the
+// pipeline never acts on, so enforcing its limits needs a policy stage.
+type CostLimiter struct {
+	name        string
+	version     string
+	description string
+	author      string
+	tracker     *CostTracker
+	logger      *zap.SugaredLogger
+	status      *interfaces.ModuleStatus
+	startTime   time.Time
+}
+
+// NewCostLimiter creates a new cost limiter policy module enforcing the limits
+// configured on tracker
+func NewCostLimiter(logger *zap.SugaredLogger, tracker *CostTracker) *CostLimiter {
+	return &CostLimiter{
+		name:        "cost-limiter",
+		version:     "1.0.0",
+		description: "Blocks requests from tenants over their cost limits",
+		author:      "Leash Security",
+		tracker:     tracker,
+		logger:      logger,
+		status: &interfaces.ModuleStatus{
+			State:             interfaces.ModuleStateReady,
+			RequestsProcessed: 0,
+			ErrorCount:        0,
+		},
+	}
+}
+
+// Metadata methods
+func (cl *CostLimiter) Name() string                { return cl.name }
+func (cl *CostLimiter) Version() string             { return cl.version }
+func (cl *CostLimiter) Type() interfaces.ModuleType { return interfaces.ModuleTypePolicy }
+func (cl *CostLimiter) Description() string         { return cl.description }
+func (cl *CostLimiter) Author() string              { return cl.author }
+func (cl *CostLimiter) Dependencies() []string      { return []string{"cost-tracker"} }
+
+// Lifecycle methods
+func (cl *CostLimiter) Initialize(ctx context.Context, config *interfaces.ModuleConfig) error {
+	cl.startTime = time.Now()
+	cl.status.State = interfaces.ModuleStateReady
+	cl.logger.Infof("Cost limiter initialized")
+	return nil
+}
+
+func (cl *CostLimiter) Start(ctx context.Context) error {
+	cl.status.State = interfaces.ModuleStateRunning
+	cl.status.StartTime = time.Now()
+	cl.logger.Infof("Cost limiter module started")
+	return nil
+}
+
+func (cl *CostLimiter) Stop(ctx context.Context) error {
+	cl.status.State = interfaces.ModuleStateDraining
+	cl.logger.Infof("Cost limiter module stopping")
+	return nil
+}
+
+func (cl *CostLimiter) Shutdown(ctx context.Context) error {
+	cl.status.State = interfaces.ModuleStateStopped
+	cl.logger.Infof("Cost limiter module shutdown")
+	return nil
+}
+
+// Health and status methods
+func (cl *CostLimiter) Health(ctx context.Context) (*interfaces.HealthStatus, error) {
+	return &interfaces.HealthStatus{
+		Status:        interfaces.HealthStateHealthy,
+		Message:       "Cost limiter is healthy",
+		LastCheck:     time.Now(),
+		CheckDuration: time.Millisecond,
+	}, nil
+}
+
+func (cl *CostLimiter) Status() *interfaces.ModuleStatus {
+	status := *cl.status
+	status.LastActivity = time.Now()
+	return &status
+}
+
+func (cl *CostLimiter) Metrics() map[string]interface{} {
+	return map[string]interface{}{
+		"requests_processed": cl.status.RequestsProcessed,
+		"errors":             cl.status.ErrorCount,
+		"uptime_seconds":     time.Since(cl.startTime).Seconds(),
+	}
+}
+
+// Processing methods
+func (cl *CostLimiter) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequestContext) (*interfaces.ProcessRequestResult, error) {
+	start := time.Now()
+	cl.status.RequestsProcessed++
+	cl.status.LastActivity = time.Now()
+
+	window, spent, limit, exceeded := cl.tracker.checkLimits(req.TenantID)
+	if !exceeded {
+		return &interfaces.ProcessRequestResult{
+			Action:         interfaces.ActionContinue,
+			ProcessingTime: time.Since(start),
+		}, nil
+	}
+
+	cl.logger.Warnf("Cost limit exceeded for tenant %s: %s spend $%.2f >= $%.2f", req.TenantID, window, spent, limit)
+	return &interfaces.ProcessRequestResult{
+		Action:         interfaces.ActionBlock,
+		BlockReason:    LimitBlockReason,
+		ProcessingTime: time.Since(start),
+		Annotations: map[string]interface{}{
+			"cost_limit_exceeded": true,
+			"cost_limit_window":   string(window),
+			"cost_limit_usd":      limit,
+			"cost_spent_usd":      spent,
+			"cost_global":         cl.tracker.aggregating(),
+		},
+	}, nil
+}
+
+func (cl *CostLimiter) ProcessResponse(ctx context.Context, resp *interfaces.ProcessResponseContext) (*interfaces.ProcessResponseResult, error) {
+	// Spend is recorded by the cost tracker; limits only gate requests
+	return &interfaces.ProcessResponseResult{
+		Action: interfaces.ActionContinue,
+	}, nil
+}
+
+// Configuration methods
+func (cl *CostLimiter) ValidateConfig(config *interfaces.ModuleConfig) error {
+	if config == nil {
+		return fmt.Errorf("config cannot be nil")
+	}
+	return nil
+}
+
+func (cl *CostLimiter) UpdateConfig(ctx context.Context, config *interfaces.ModuleConfig) error {
+	if err := cl.ValidateConfig(config); err != nil {
+		return err
+	}
+	return cl.Initialize(ctx, config)
+}
+
+func (cl *CostLimiter) GetConfig() *interfaces.ModuleConfig {
+	return &interfaces.ModuleConfig{
+		Name:     cl.name,
+		Type:     cl.Type().String(),
+		Enabled:  cl.status.State == interfaces.ModuleStateRunning,
+		Priority: 150, // After the rate limiter, before content inspection work
+		Config:   map[string]interface{}{},
+	}
+}
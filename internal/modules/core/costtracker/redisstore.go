@@ -0,0 +1,116 @@
+package costtracker
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Bucket key retention in the Redis aggregation store: long enough for the
+// bucket to stay current everywhere, short enough that old buckets expire
+const (
+	hourlyBucketTTL  = 2 * time.Hour
+	dailyBucketTTL   = 2 * 24 * time.Hour
+	monthlyBucketTTL = 32 * 24 * time.Hour
+)
+
+// RedisAggregationStore is the AggregationStore regional trackers share
+// through Redis. Each tenant bucket is a hash of each region's cost,
+// incremented with HINCRBYFLOAT, so concurrent pushes from every region add
+// up without coordination and each region's share stays visible.
+type RedisAggregationStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewRedisAggregationStore creates an aggregation store keeping bucket
+// totals under prefix in Redis
+func NewRedisAggregationStore(client redis.Cmdable, prefix string) *RedisAggregationStore {
+	return &RedisAggregationStore{client: client, prefix: prefix}
+}
+
+// Add adds a region's cost deltas in one round trip
+func (s *RedisAggregationStore) Add(ctx context.Context, region string, deltas map[string]map[string]float64) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for tenantID, buckets := range deltas {
+			for bucket, cost := range buckets {
+				key := s.key(tenantID, bucket)
+				pipe.HIncrByFloat(ctx, key, region, cost)
+				pipe.Expire(ctx, key, bucketTTL(bucket))
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// Totals returns a tenant's global cost in each bucket, summed over the
+// regions, in one round trip; buckets nobody has spent in yet are 0
+func (s *RedisAggregationStore) Totals(ctx context.Context, tenantID string, buckets []string) (map[string]float64, error) {
+	regions := make([]*redis.StringSliceCmd, len(buckets))
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, bucket := range buckets {
+			regions[i] = pipe.HVals(ctx, s.key(tenantID, bucket))
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	totals := make(map[string]float64, len(buckets))
+	for i, cmd := range regions {
+		for _, value := range cmd.Val() {
+			cost, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, err
+			}
+			totals[buckets[i]] += cost
+		}
+	}
+	return totals, nil
+}
+
+// Reset deletes a tenant's bucket keys, or every tenant's when tenantID is
+// empty
+func (s *RedisAggregationStore) Reset(ctx context.Context, tenantID string, buckets []string) error {
+	var keys []string
+	for _, bucket := range buckets {
+		if tenantID != "" {
+			keys = append(keys, s.key(tenantID, bucket))
+			continue
+		}
+		iter := s.client.Scan(ctx, 0, s.prefix+"*:"+bucket, 0).Iterator()
+		for iter.Next(ctx) {
+			keys = append(keys, iter.Val())
+		}
+		if err := iter.Err(); err != nil {
+			return err
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return s.client.Del(ctx, keys...).Err()
+}
+
+// key returns the Redis key of a tenant's bucket
+func (s *RedisAggregationStore) key(tenantID, bucket string) string {
+	return s.prefix + tenantID + ":" + bucket
+}
+
+// bucketTTL returns how long a bucket key is kept, told apart by the length
+// of the hourly, daily and monthly keys
+func bucketTTL(bucket string) time.Duration {
+	switch len(bucket) {
+	case len("2006-01-02-15"):
+		return hourlyBucketTTL
+	case len("2006-01-02"):
+		return dailyBucketTTL
+	default:
+		return monthlyBucketTTL
+	}
+}
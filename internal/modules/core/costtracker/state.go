@@ -0,0 +1,88 @@
+package costtracker
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// stateVersion is the version of the exported cost tracker state format
+const stateVersion = 1
+
+// State is the exported cost tracker state
+type State struct {
+	Version int                     `json:"version"`
+	Usage   map[string]*TenantUsage `json:"usage"` // keyed by tenant ID
+}
+
+// ExportState returns the current per-tenant usage as JSON
+func (ct *CostTracker) ExportState() (json.RawMessage, error) {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+
+	return json.Marshal(State{Version: stateVersion, Usage: ct.usage})
+}
+
+// ImportState validates exported state and replaces all tenant usage with it
+func (ct *CostTracker) ImportState(data json.RawMessage) error {
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("invalid cost tracker state: %w", err)
+	}
+	if state.Version != stateVersion {
+		return fmt.Errorf("unsupported cost tracker state version %d", state.Version)
+	}
+
+	usage := make(map[string]*TenantUsage, len(state.Usage))
+	for tenantID, tenantUsage := range state.Usage {
+		if err := tenantUsage.validate(tenantID); err != nil {
+			return err
+		}
+		usage[tenantID] = tenantUsage
+	}
+
+	ct.mu.Lock()
+	ct.usage = usage
+	ct.mu.Unlock()
+
+	ct.logger.Infof("Cost tracker state imported for %d tenants", len(usage))
+	return nil
+}
+
+// validate checks imported usage for a tenant and fills in missing buckets
+func (u *TenantUsage) validate(tenantID string) error {
+	if tenantID == "" || u == nil {
+		return fmt.Errorf("invalid cost tracker state: empty tenant entry")
+	}
+	if u.TenantID != tenantID {
+		return fmt.Errorf("invalid cost tracker state: usage for %s is keyed as %s", u.TenantID, tenantID)
+	}
+	if u.TotalCost < 0 || u.RequestCount < 0 {
+		return fmt.Errorf("invalid cost tracker state: tenant %s has negative totals", tenantID)
+	}
+
+	for window, buckets := range map[string]map[string]float64{
+		"hourly":  u.HourlyUsage,
+		"daily":   u.DailyUsage,
+		"monthly": u.MonthlyUsage,
+	} {
+		for bucket, cost := range buckets {
+			if cost < 0 {
+				return fmt.Errorf("invalid cost tracker state: tenant %s has negative %s usage for %s", tenantID, window, bucket)
+			}
+		}
+	}
+
+	if u.HourlyUsage == nil {
+		u.HourlyUsage = make(map[string]float64)
+	}
+	if u.DailyUsage == nil {
+		u.DailyUsage = make(map[string]float64)
+	}
+	if u.MonthlyUsage == nil {
+		u.MonthlyUsage = make(map[string]float64)
+	}
+	if u.Metadata == nil {
+		u.Metadata = make(map[string]interface{})
+	}
+	return nil
+}
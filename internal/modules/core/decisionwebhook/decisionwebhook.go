@@ -0,0 +1,468 @@
+package decisionwebhook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/tenants"
+	"go.uber.org/zap"
+)
+
+// Decision event types
+const (
+	EventBlock    = "block"     // a policy blocked the request
+	EventRedact   = "redact"    // content was redacted from the request or response
+	EventHighRisk = "high_risk" // content was flagged unsafe but let through
+)
+
+// DecisionWebhook implements a sink pushing policy decisions (blocks,
+// redactions and high-risk content) to a webhook, such as a SOAR intake, as
+// signed JSON batches. Requests without a decision are not sent.
+type DecisionWebhook struct {
+	name         string
+	version      string
+	description  string
+	author       string
+	config       *WebhookConfig
+	logger       *zap.SugaredLogger
+	status       *interfaces.ModuleStatus
+	startTime    time.Time
+	client       *http.Client
+	anonymizer   *tenants.Anonymizer
+	mu           sync.Mutex
+	deliverMu    sync.Mutex // one delivery at a time keeps batches in order
+	queue        []Event
+	flushSignal  chan struct{}
+	stop         chan struct{}
+	done         chan struct{}
+	sent         int64
+	failed       int64
+	deadLettered int64
+	dropped      int64
+}
+
+// WebhookConfig represents decision webhook configuration
+type WebhookConfig struct {
+	URL            string        `yaml:"url" json:"url"`
+	Secret         string        `yaml:"secret" json:"-"`                      // HMAC-SHA256 signing key; batches are unsigned when empty
+	Events         []string      `yaml:"events" json:"events"`                 // block, redact, high_risk
+	MinConfidence  float64       `yaml:"min_confidence" json:"min_confidence"` // high_risk only for flags at least this confident
+	BatchSize      int           `yaml:"batch_size" json:"batch_size"`
+	FlushInterval  time.Duration `yaml:"flush_interval" json:"flush_interval"`
+	MaxQueue       int           `yaml:"max_queue" json:"max_queue"` // events beyond this are dropped
+	MaxAttempts    int           `yaml:"max_attempts" json:"max_attempts"`
+	RetryBackoff   time.Duration `yaml:"retry_backoff" json:"retry_backoff"` // doubled after each retry
+	Timeout        time.Duration `yaml:"timeout" json:"timeout"`
+	DeadLetterPath string        `yaml:"dead_letter_path" json:"dead_letter_path"` // JSON lines of undeliverable batches; dropped when empty
+}
+
+// Event is one policy decision sent to the webhook
+type Event struct {
+	ID         string    `json:"id"` // stable across retries, for deduplication
+	Type       string    `json:"type"`
+	Phase      string    `json:"phase"` // request or response
+	Timestamp  time.Time `json:"timestamp"`
+	RequestID  string    `json:"request_id"`
+	TenantID   string    `json:"tenant_id"` // pseudonym when tenant anonymization is enabled
+	Provider   string    `json:"provider,omitempty"`
+	Model      string    `json:"model,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	Matches    []string  `json:"matches,omitempty"` // rules that matched, not the matched content
+	Confidence float64   `json:"confidence,omitempty"`
+}
+
+// NewDecisionWebhook creates a new decision webhook module
+func NewDecisionWebhook(logger *zap.SugaredLogger) *DecisionWebhook {
+	return &DecisionWebhook{
+		name:        "decision-webhook",
+		version:     "1.0.0",
+		description: "Pushes block, redaction and high-risk decisions to a signed webhook",
+		author:      "Leash Security",
+		logger:      logger,
+		status: &interfaces.ModuleStatus{
+			State:             interfaces.ModuleStateReady,
+			RequestsProcessed: 0,
+			ErrorCount:        0,
+		},
+	}
+}
+
+// SetTenantAnonymizer makes events carry tenant pseudonyms instead of tenant
+// IDs
+func (w *DecisionWebhook) SetTenantAnonymizer(anonymizer *tenants.Anonymizer) {
+	w.anonymizer = anonymizer
+}
+
+// Metadata methods
+func (w *DecisionWebhook) Name() string                { return w.name }
+func (w *DecisionWebhook) Version() string             { return w.version }
+func (w *DecisionWebhook) Type() interfaces.ModuleType { return interfaces.ModuleTypeSink }
+func (w *DecisionWebhook) Description() string         { return w.description }
+func (w *DecisionWebhook) Author() string              { return w.author }
+func (w *DecisionWebhook) Dependencies() []string      { return []string{} }
+
+// Lifecycle methods
+func (w *DecisionWebhook) Initialize(ctx context.Context, config *interfaces.ModuleConfig) error {
+	w.logger.Infof("Initializing decision webhook module")
+
+	var configMap map[string]interface{}
+	if config != nil {
+		configMap = config.Config
+	}
+	webhookConfig, err := parseConfig(configMap)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	w.config = webhookConfig
+	w.client = &http.Client{Timeout: webhookConfig.Timeout}
+	w.mu.Unlock()
+
+	w.startTime = time.Now()
+	w.status.State = interfaces.ModuleStateReady
+
+	w.logger.Infof("Decision webhook initialized with events=%v, batch_size=%d, flush_interval=%v",
+		webhookConfig.Events, webhookConfig.BatchSize, webhookConfig.FlushInterval)
+	return nil
+}
+
+func (w *DecisionWebhook) Start(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.config.URL == "" {
+		return fmt.Errorf("decision webhook requires a url")
+	}
+	if w.stop == nil {
+		w.flushSignal = make(chan struct{}, 1)
+		w.stop = make(chan struct{})
+		w.done = make(chan struct{})
+		go w.run(w.stop, w.done, w.flushSignal, w.config.FlushInterval)
+	}
+
+	w.status.State = interfaces.ModuleStateRunning
+	w.status.StartTime = time.Now()
+	w.logger.Infof("Decision webhook module started")
+	return nil
+}
+
+func (w *DecisionWebhook) Stop(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.status.State = interfaces.ModuleStateDraining
+	w.logger.Infof("Decision webhook module stopping")
+	return nil
+}
+
+// Shutdown stops the background flusher and delivers the events still queued
+func (w *DecisionWebhook) Shutdown(ctx context.Context) error {
+	w.mu.Lock()
+	stop, done := w.stop, w.done
+	w.stop, w.done = nil, nil
+	w.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+	w.flush(ctx)
+
+	w.mu.Lock()
+	w.status.State = interfaces.ModuleStateStopped
+	w.mu.Unlock()
+	w.logger.Infof("Decision webhook module shutdown")
+	return nil
+}
+
+// Health and status methods
+func (w *DecisionWebhook) Health(ctx context.Context) (*interfaces.HealthStatus, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	status := interfaces.HealthStateHealthy
+	message := "Decision webhook is healthy"
+	if w.failed > 0 {
+		status = interfaces.HealthStateDegraded
+		message = fmt.Sprintf("%d decision events could not be delivered", w.failed)
+	}
+	return &interfaces.HealthStatus{
+		Status:        status,
+		Message:       message,
+		LastCheck:     time.Now(),
+		CheckDuration: time.Millisecond,
+		Details: map[string]interface{}{
+			"queued":        len(w.queue),
+			"sent":          w.sent,
+			"failed":        w.failed,
+			"dead_lettered": w.deadLettered,
+			"dropped":       w.dropped,
+		},
+	}, nil
+}
+
+func (w *DecisionWebhook) Status() *interfaces.ModuleStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	status := *w.status
+	status.LastActivity = time.Now()
+	return &status
+}
+
+func (w *DecisionWebhook) Metrics() map[string]interface{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return map[string]interface{}{
+		"requests_processed":   w.status.RequestsProcessed,
+		"errors":               w.status.ErrorCount,
+		"events_queued":        len(w.queue),
+		"events_sent":          w.sent,
+		"events_failed":        w.failed,
+		"events_dead_lettered": w.deadLettered,
+		"events_dropped":       w.dropped,
+		"uptime_seconds":       time.Since(w.startTime).Seconds(),
+	}
+}
+
+// Processing methods
+func (w *DecisionWebhook) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequestContext) (*interfaces.ProcessRequestResult, error) {
+	start := time.Now()
+
+	switch {
+	case req.Annotations["content_filter_redacted"] == true:
+		w.enqueue(w.event(req, EventRedact, "request", "request content redacted", req.Annotations))
+	case req.Annotations["content_safe"] == false:
+		w.enqueue(w.event(req, EventHighRisk, "request", "request content flagged", req.Annotations))
+	default:
+		w.enqueue()
+	}
+
+	return &interfaces.ProcessRequestResult{
+		Action:         interfaces.ActionContinue,
+		ProcessingTime: time.Since(start),
+	}, nil
+}
+
+func (w *DecisionWebhook) ProcessResponse(ctx context.Context, resp *interfaces.ProcessResponseContext) (*interfaces.ProcessResponseResult, error) {
+	start := time.Now()
+
+	// Annotations are shared with the request phase; only response checks
+	// count here so request decisions are not sent twice
+	switch {
+	case resp.Annotations["response_content_redacted"] == true:
+		w.enqueue(w.event(resp.ProcessRequestContext, EventRedact, "response", "response content redacted", resp.Annotations))
+	case resp.Annotations["response_content_checked"] == true && resp.Annotations["content_safe"] == false:
+		w.enqueue(w.event(resp.ProcessRequestContext, EventHighRisk, "response", "response content flagged", resp.Annotations))
+	default:
+		w.enqueue()
+	}
+
+	return &interfaces.ProcessResponseResult{
+		Action:         interfaces.ActionContinue,
+		ProcessingTime: time.Since(start),
+	}, nil
+}
+
+// ObserveBlock sends a block event for a request blocked by a policy
+func (w *DecisionWebhook) ObserveBlock(ctx context.Context, req *interfaces.ProcessRequestContext, result *interfaces.ProcessRequestResult) {
+	w.enqueue(w.event(req, EventBlock, "request", result.BlockReason, result.Annotations))
+}
+
+// Configuration methods
+func (w *DecisionWebhook) ValidateConfig(config *interfaces.ModuleConfig) error {
+	if config == nil {
+		return fmt.Errorf("config cannot be nil")
+	}
+
+	webhookConfig, err := parseConfig(config.Config)
+	if err != nil {
+		return err
+	}
+	if webhookConfig.URL == "" {
+		return fmt.Errorf("url is required")
+	}
+	return nil
+}
+
+func (w *DecisionWebhook) UpdateConfig(ctx context.Context, config *interfaces.ModuleConfig) error {
+	if err := w.ValidateConfig(config); err != nil {
+		return err
+	}
+
+	return w.Initialize(ctx, config)
+}
+
+func (w *DecisionWebhook) GetConfig() *interfaces.ModuleConfig {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return &interfaces.ModuleConfig{
+		Name:     w.name,
+		Type:     w.Type().String(),
+		Enabled:  w.status.State == interfaces.ModuleStateRunning,
+		Priority: 940, // Runs alongside other sinks near the end
+		Config: map[string]interface{}{
+			"url":              w.config.URL,
+			"signed":           w.config.Secret != "",
+			"events":           w.config.Events,
+			"min_confidence":   w.config.MinConfidence,
+			"batch_size":       w.config.BatchSize,
+			"flush_interval":   w.config.FlushInterval.String(),
+			"max_queue":        w.config.MaxQueue,
+			"max_attempts":     w.config.MaxAttempts,
+			"retry_backoff":    w.config.RetryBackoff.String(),
+			"timeout":          w.config.Timeout.String(),
+			"dead_letter_path": w.config.DeadLetterPath,
+		},
+	}
+}
+
+// event builds a decision event, or returns nil when the decision type is
+// not configured or a flag is below the confidence threshold
+func (w *DecisionWebhook) event(req *interfaces.ProcessRequestContext, eventType, phase, reason string, annotations map[string]interface{}) *Event {
+	if !w.sends(eventType) {
+		return nil
+	}
+	confidence, _ := annotations["confidence"].(float64)
+	if eventType == EventHighRisk && confidence < w.config.MinConfidence {
+		return nil
+	}
+	matches, _ := annotations["matches"].([]string)
+
+	return &Event{
+		ID:         req.RequestID + ":" + phase + ":" + eventType,
+		Type:       eventType,
+		Phase:      phase,
+		Timestamp:  time.Now().UTC(),
+		RequestID:  req.RequestID,
+		TenantID:   w.anonymizer.TenantID(req.TenantID),
+		Provider:   req.Provider,
+		Model:      req.Model,
+		Reason:     reason,
+		Matches:    matches,
+		Confidence: confidence,
+	}
+}
+
+// sends reports whether an event type is configured to be sent
+func (w *DecisionWebhook) sends(eventType string) bool {
+	for _, configured := range w.config.Events {
+		if configured == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// enqueue counts a processed request and queues its decision event, if any,
+// waking the flusher once a batch is full
+func (w *DecisionWebhook) enqueue(events ...*Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.status.RequestsProcessed++
+	w.status.LastActivity = time.Now()
+	for _, event := range events {
+		if event == nil {
+			continue
+		}
+		if len(w.queue) >= w.config.MaxQueue {
+			w.dropped++
+			w.status.ErrorCount++
+			w.logger.Warnf("Dropping %s decision event for request %s: queue full", event.Type, event.RequestID)
+			continue
+		}
+		w.queue = append(w.queue, *event)
+	}
+
+	if len(w.queue) >= w.config.BatchSize && w.flushSignal != nil {
+		select {
+		case w.flushSignal <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// parseConfig reads and validates decision webhook configuration
+func parseConfig(configMap map[string]interface{}) (*WebhookConfig, error) {
+	webhookConfig := &WebhookConfig{
+		Events:        []string{EventBlock, EventRedact, EventHighRisk},
+		BatchSize:     20,
+		FlushInterval: 2 * time.Second,
+		MaxQueue:      10000,
+		MaxAttempts:   3,
+		RetryBackoff:  time.Second,
+		Timeout:       5 * time.Second,
+	}
+	if configMap == nil {
+		return webhookConfig, nil
+	}
+
+	if rawURL, ok := configMap["url"].(string); ok {
+		parsed, err := url.Parse(rawURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("invalid webhook url: %q", rawURL)
+		}
+		webhookConfig.URL = rawURL
+	}
+	if secret, ok := configMap["secret"].(string); ok {
+		webhookConfig.Secret = secret
+	}
+	if events, ok := configMap["events"].([]interface{}); ok {
+		webhookConfig.Events = webhookConfig.Events[:0]
+		for _, event := range events {
+			eventType, _ := event.(string)
+			switch eventType {
+			case EventBlock, EventRedact, EventHighRisk:
+				webhookConfig.Events = append(webhookConfig.Events, eventType)
+			default:
+				return nil, fmt.Errorf("unsupported decision event: %v", event)
+			}
+		}
+	}
+	if minConfidence, ok := configMap["min_confidence"].(float64); ok {
+		webhookConfig.MinConfidence = minConfidence
+	}
+
+	for key, target := range map[string]*int{
+		"batch_size":   &webhookConfig.BatchSize,
+		"max_queue":    &webhookConfig.MaxQueue,
+		"max_attempts": &webhookConfig.MaxAttempts,
+	} {
+		if value, ok := configMap[key].(int); ok {
+			if value < 1 {
+				return nil, fmt.Errorf("%s must be at least 1", key)
+			}
+			*target = value
+		}
+	}
+	for key, target := range map[string]*time.Duration{
+		"flush_interval": &webhookConfig.FlushInterval,
+		"retry_backoff":  &webhookConfig.RetryBackoff,
+		"timeout":        &webhookConfig.Timeout,
+	} {
+		if value, ok := configMap[key].(string); ok {
+			duration, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", key, err)
+			}
+			if duration < 0 || (duration == 0 && key != "retry_backoff") {
+				return nil, fmt.Errorf("%s must be positive", key)
+			}
+			*target = duration
+		}
+	}
+	if path, ok := configMap["dead_letter_path"].(string); ok {
+		webhookConfig.DeadLetterPath = path
+	}
+
+	return webhookConfig, nil
+}
@@ -0,0 +1,201 @@
+package decisionwebhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Webhook request headers
+const (
+	SignatureHeader = "X-Leash-Signature" // sha256=<hex HMAC of "<timestamp>.<body>">
+	TimestampHeader = "X-Leash-Timestamp" // unix seconds the batch was signed at
+)
+
+// Batch is the body POSTed to the webhook
+type Batch struct {
+	SentAt time.Time `json:"sent_at"`
+	Events []Event   `json:"events"`
+}
+
+// deadLetter is a batch that could not be delivered, written as one JSON
+// line to the dead-letter file
+type deadLetter struct {
+	FailedAt time.Time `json:"failed_at"`
+	Reason   string    `json:"reason"`
+	Attempts int       `json:"attempts"`
+	Events   []Event   `json:"events"`
+}
+
+// Sign returns the signature header value for a webhook body signed at
+// timestamp. Receivers recompute it with the shared secret to verify the
+// batch, and should reject stale timestamps to prevent replays.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// run flushes queued events every flush interval, or as soon as a batch
+// fills, until stop is closed
+func (w *DecisionWebhook) run(stop <-chan struct{}, done chan<- struct{}, flush <-chan struct{}, interval time.Duration) {
+	defer close(done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-flush:
+		case <-stop:
+			return
+		}
+		w.flush(context.Background())
+	}
+}
+
+// flush delivers every queued event in batches of at most batch_size
+func (w *DecisionWebhook) flush(ctx context.Context) {
+	w.deliverMu.Lock()
+	defer w.deliverMu.Unlock()
+
+	for {
+		w.mu.Lock()
+		n := len(w.queue)
+		if n > w.config.BatchSize {
+			n = w.config.BatchSize
+		}
+		events := append([]Event(nil), w.queue[:n]...)
+		w.queue = w.queue[n:]
+		w.mu.Unlock()
+
+		if len(events) == 0 {
+			return
+		}
+		w.deliver(ctx, events)
+	}
+}
+
+// deliver POSTs a batch, retrying transport errors, 429s and 5xx responses
+// with backoff, and dead-letters it once the attempts are used up
+func (w *DecisionWebhook) deliver(ctx context.Context, events []Event) {
+	w.mu.Lock()
+	config, client := w.config, w.client
+	w.mu.Unlock()
+
+	body, err := json.Marshal(Batch{SentAt: time.Now().UTC(), Events: events})
+	if err != nil {
+		w.fail(config, events, 0, fmt.Errorf("failed to encode batch: %w", err))
+		return
+	}
+
+	delay := config.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		retryable, err := post(ctx, config, client, body)
+		if err == nil {
+			w.mu.Lock()
+			w.sent += int64(len(events))
+			w.mu.Unlock()
+			return
+		}
+		if !retryable || attempt >= config.MaxAttempts {
+			w.fail(config, events, attempt, err)
+			return
+		}
+
+		w.logger.Debugf("Decision webhook delivery failed on attempt %d of %d, retrying in %v: %v",
+			attempt, config.MaxAttempts, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			w.fail(config, events, attempt, ctx.Err())
+			return
+		}
+		delay *= 2
+	}
+}
+
+// post sends one signed delivery attempt and reports whether a failure is
+// worth retrying
+func post(ctx context.Context, config *WebhookConfig, client *http.Client, body []byte) (bool, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, config.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := time.Now().Unix()
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	if config.Secret != "" {
+		httpReq.Header.Set(SignatureHeader, Sign(config.Secret, timestamp, body))
+	}
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retryable, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+}
+
+// fail records an undeliverable batch and appends it to the dead-letter file
+// when one is configured
+func (w *DecisionWebhook) fail(config *WebhookConfig, events []Event, attempts int, err error) {
+	w.mu.Lock()
+	w.failed += int64(len(events))
+	w.status.ErrorCount++
+	w.mu.Unlock()
+
+	if config.DeadLetterPath == "" {
+		w.logger.Errorf("Dropping %d decision events after %d attempts: %v", len(events), attempts, err)
+		return
+	}
+
+	line, marshalErr := json.Marshal(deadLetter{
+		FailedAt: time.Now().UTC(),
+		Reason:   err.Error(),
+		Attempts: attempts,
+		Events:   events,
+	})
+	if marshalErr == nil {
+		marshalErr = appendLine(config.DeadLetterPath, line)
+	}
+	if marshalErr != nil {
+		w.logger.Errorf("Failed to dead-letter %d decision events (%v): %v", len(events), err, marshalErr)
+		return
+	}
+
+	w.mu.Lock()
+	w.deadLettered += int64(len(events))
+	w.mu.Unlock()
+	w.logger.Warnf("Dead-lettered %d decision events after %d attempts: %v", len(events), attempts, err)
+}
+
+// appendLine appends a JSON line to a file, creating it if needed
+func appendLine(path string, line []byte) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
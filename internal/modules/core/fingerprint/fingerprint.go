@@ -0,0 +1,518 @@
+package fingerprint
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/metrics"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"go.uber.org/zap"
+)
+
+// Fingerprint components
+const (
+	ComponentClientIP   = "client_ip"
+	ComponentUserAgent  = "user_agent"
+	ComponentKeyPattern = "key_pattern"
+)
+
+// Anomaly reasons, as recorded in leash_fingerprint_anomalies_total
+const (
+	ReasonTenants = "tenants" // the fingerprint spans too many tenants
+	ReasonKeys    = "keys"    // the fingerprint spans too many API keys
+)
+
+// maxTrackedPerFingerprint bounds the tenants and keys remembered for one
+// fingerprint; a fingerprint reaching it is far past any sensible threshold
+const maxTrackedPerFingerprint = 1000
+
+// RequestFingerprint implements an inspector that fingerprints requests by
+// client IP, user agent and API key pattern, and flags a fingerprint that
+// spans an anomalous number of tenants or API keys within a window, as a
+// client cycling through stolen credentials would
+type RequestFingerprint struct {
+	name        string
+	version     string
+	description string
+	author      string
+	config      *FingerprintConfig
+	logger      *zap.SugaredLogger
+	status      *interfaces.ModuleStatus
+	startTime   time.Time
+	metrics     *metrics.Registry
+
+	mu           sync.Mutex
+	now          func() time.Time
+	swept        time.Time
+	fingerprints map[string]*fingerprintUsage
+}
+
+// FingerprintConfig represents request fingerprinting configuration
+type FingerprintConfig struct {
+	Window          time.Duration `yaml:"window" json:"window"`                     // tenants and keys older than this are forgotten
+	MaxTenants      int           `yaml:"max_tenants" json:"max_tenants"`           // tenants one fingerprint may span; 0 disables
+	MaxKeys         int           `yaml:"max_keys" json:"max_keys"`                 // API keys one fingerprint may span; 0 disables
+	Components      []string      `yaml:"components" json:"components"`             // client_ip, user_agent, key_pattern
+	KeyHeaders      []string      `yaml:"key_headers" json:"key_headers"`           // first present header carries the API key
+	MaxFingerprints int           `yaml:"max_fingerprints" json:"max_fingerprints"` // new fingerprints beyond this are not tracked
+}
+
+// fingerprintUsage records when a fingerprint last used each tenant and key.
+// Keys are held as hashes only.
+type fingerprintUsage struct {
+	tenants  map[string]time.Time
+	keys     map[string]time.Time
+	lastSeen time.Time
+}
+
+// NewRequestFingerprint creates a new request fingerprinting module
+func NewRequestFingerprint(logger *zap.SugaredLogger) *RequestFingerprint {
+	return &RequestFingerprint{
+		name:        "request-fingerprint",
+		version:     "1.0.0",
+		description: "Flags clients spanning an anomalous number of tenants or API keys",
+		author:      "Leash Security",
+		config:      defaultConfig(),
+		logger:      logger,
+		status: &interfaces.ModuleStatus{
+			State:             interfaces.ModuleStateReady,
+			RequestsProcessed: 0,
+			ErrorCount:        0,
+		},
+		now:          time.Now,
+		fingerprints: make(map[string]*fingerprintUsage),
+	}
+}
+
+// SetMetrics enables the fingerprint anomaly counter
+func (rf *RequestFingerprint) SetMetrics(registry *metrics.Registry) {
+	rf.metrics = registry
+}
+
+// SetClock replaces the source of the current time, e.g. with a fixed clock
+// in tests
+func (rf *RequestFingerprint) SetClock(now func() time.Time) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	rf.now = now
+}
+
+// Metadata methods
+func (rf *RequestFingerprint) Name() string                { return rf.name }
+func (rf *RequestFingerprint) Version() string             { return rf.version }
+func (rf *RequestFingerprint) Type() interfaces.ModuleType { return interfaces.ModuleTypeInspector }
+func (rf *RequestFingerprint) Description() string         { return rf.description }
+func (rf *RequestFingerprint) Author() string              { return rf.author }
+func (rf *RequestFingerprint) Dependencies() []string      { return []string{} }
+
+// Lifecycle methods
+func (rf *RequestFingerprint) Initialize(ctx context.Context, config *interfaces.ModuleConfig) error {
+	rf.logger.Infof("Initializing request fingerprint module")
+
+	fingerprintConfig, err := parseConfig(config)
+	if err != nil {
+		return err
+	}
+
+	rf.mu.Lock()
+	if strings.Join(fingerprintConfig.Components, ",") != strings.Join(rf.config.Components, ",") {
+		// Fingerprints are computed from the components, so usage cannot carry over
+		rf.fingerprints = make(map[string]*fingerprintUsage)
+	}
+	rf.config = fingerprintConfig
+	rf.mu.Unlock()
+
+	rf.startTime = time.Now()
+	rf.status.State = interfaces.ModuleStateReady
+
+	rf.logger.Infof("Request fingerprint initialized with components=%v, window=%v, max_tenants=%d, max_keys=%d",
+		fingerprintConfig.Components, fingerprintConfig.Window, fingerprintConfig.MaxTenants, fingerprintConfig.MaxKeys)
+	return nil
+}
+
+func (rf *RequestFingerprint) Start(ctx context.Context) error {
+	rf.status.State = interfaces.ModuleStateRunning
+	rf.status.StartTime = time.Now()
+	rf.logger.Infof("Request fingerprint module started")
+	return nil
+}
+
+func (rf *RequestFingerprint) Stop(ctx context.Context) error {
+	rf.status.State = interfaces.ModuleStateDraining
+	rf.logger.Infof("Request fingerprint module stopping")
+	return nil
+}
+
+func (rf *RequestFingerprint) Shutdown(ctx context.Context) error {
+	rf.status.State = interfaces.ModuleStateStopped
+	rf.logger.Infof("Request fingerprint module shutdown")
+	return nil
+}
+
+// Health and status methods
+func (rf *RequestFingerprint) Health(ctx context.Context) (*interfaces.HealthStatus, error) {
+	rf.mu.Lock()
+	tracked := len(rf.fingerprints)
+	rf.mu.Unlock()
+
+	return &interfaces.HealthStatus{
+		Status:        interfaces.HealthStateHealthy,
+		Message:       "Request fingerprint is healthy",
+		LastCheck:     time.Now(),
+		CheckDuration: time.Millisecond,
+		Details: map[string]interface{}{
+			"window":               rf.config.Window.String(),
+			"fingerprints_tracked": tracked,
+		},
+	}, nil
+}
+
+func (rf *RequestFingerprint) Status() *interfaces.ModuleStatus {
+	status := *rf.status
+	status.LastActivity = time.Now()
+	return &status
+}
+
+func (rf *RequestFingerprint) Metrics() map[string]interface{} {
+	return map[string]interface{}{
+		"requests_processed": rf.status.RequestsProcessed,
+		"errors":             rf.status.ErrorCount,
+		"uptime_seconds":     time.Since(rf.startTime).Seconds(),
+	}
+}
+
+// Processing methods
+
+// ProcessRequest annotates the request's fingerprint and flags it when the
+// fingerprint has spanned too many tenants or keys within the window. Flagged
+// requests continue; policies and sinks act on the annotations.
+func (rf *RequestFingerprint) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequestContext) (*interfaces.ProcessRequestResult, error) {
+	start := time.Now()
+	rf.status.RequestsProcessed++
+	rf.status.LastActivity = time.Now()
+
+	key := apiKey(req.Headers, rf.config.KeyHeaders)
+	fingerprint, ok := rf.fingerprint(req, key)
+	if !ok {
+		// Without any component every client would share one fingerprint
+		return &interfaces.ProcessRequestResult{
+			Action:         interfaces.ActionContinue,
+			ProcessingTime: time.Since(start),
+		}, nil
+	}
+
+	annotations := map[string]interface{}{
+		"request_fingerprint": fingerprint,
+	}
+	if req.DryRun {
+		return &interfaces.ProcessRequestResult{
+			Action:         interfaces.ActionContinue,
+			ProcessingTime: time.Since(start),
+			Annotations:    annotations,
+		}, nil
+	}
+
+	tenants, keys := rf.observe(fingerprint, req.TenantID, key)
+	var reasons []string
+	if rf.config.MaxTenants > 0 && tenants > rf.config.MaxTenants {
+		reasons = append(reasons, ReasonTenants)
+	}
+	if rf.config.MaxKeys > 0 && keys > rf.config.MaxKeys {
+		reasons = append(reasons, ReasonKeys)
+	}
+	if len(reasons) > 0 {
+		rf.logger.Warnf("Request %s fingerprint %s spans %d tenants and %d keys within %v",
+			req.RequestID, fingerprint, tenants, keys, rf.config.Window)
+		annotations["fingerprint_anomaly"] = true
+		annotations["fingerprint_anomaly_reasons"] = reasons
+		annotations["fingerprint_tenants"] = tenants
+		annotations["fingerprint_keys"] = keys
+		if rf.metrics != nil {
+			for _, reason := range reasons {
+				rf.metrics.RecordFingerprintAnomaly(reason)
+			}
+		}
+	}
+
+	return &interfaces.ProcessRequestResult{
+		Action:         interfaces.ActionContinue,
+		ProcessingTime: time.Since(start),
+		Annotations:    annotations,
+	}, nil
+}
+
+func (rf *RequestFingerprint) ProcessResponse(ctx context.Context, resp *interfaces.ProcessResponseContext) (*interfaces.ProcessResponseResult, error) {
+	// Request fingerprinting doesn't need to process responses
+	return &interfaces.ProcessResponseResult{
+		Action: interfaces.ActionContinue,
+	}, nil
+}
+
+// fingerprint hashes the request's configured components, reporting false
+// when the request has none of them
+func (rf *RequestFingerprint) fingerprint(req *interfaces.ProcessRequestContext, key string) (string, bool) {
+	values := make([]string, 0, len(rf.config.Components))
+	present := false
+	for _, component := range rf.config.Components {
+		var value string
+		switch component {
+		case ComponentClientIP:
+			value = req.ClientIP
+		case ComponentUserAgent:
+			value = req.UserAgent
+		case ComponentKeyPattern:
+			value = keyPattern(key)
+		}
+		present = present || value != ""
+		values = append(values, component+"="+value)
+	}
+	if !present {
+		return "", false
+	}
+	sum := sha256.Sum256([]byte(strings.Join(values, "\n")))
+	return hex.EncodeToString(sum[:8]), true
+}
+
+// observe records the fingerprint's use of a tenant and key and returns how
+// many distinct tenants and keys it used within the window
+func (rf *RequestFingerprint) observe(fingerprint, tenantID, key string) (int, int) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	now := rf.now()
+	rf.sweep(now)
+	usage, exists := rf.fingerprints[fingerprint]
+	if !exists {
+		if len(rf.fingerprints) >= rf.config.MaxFingerprints {
+			return 0, 0
+		}
+		usage = &fingerprintUsage{
+			tenants: make(map[string]time.Time),
+			keys:    make(map[string]time.Time),
+		}
+		rf.fingerprints[fingerprint] = usage
+	}
+	usage.lastSeen = now
+
+	cutoff := now.Add(-rf.config.Window)
+	if tenantID != "" {
+		remember(usage.tenants, tenantID, now, cutoff)
+	}
+	if key != "" {
+		sum := sha256.Sum256([]byte(key))
+		remember(usage.keys, hex.EncodeToString(sum[:]), now, cutoff)
+	}
+	return len(usage.tenants), len(usage.keys)
+}
+
+// sweep forgets fingerprints idle for longer than the window, at most once
+// a minute. Callers must hold rf.mu.
+func (rf *RequestFingerprint) sweep(now time.Time) {
+	if now.Sub(rf.swept) < time.Minute {
+		return
+	}
+	cutoff := now.Add(-rf.config.Window)
+	for fingerprint, usage := range rf.fingerprints {
+		if usage.lastSeen.Before(cutoff) {
+			delete(rf.fingerprints, fingerprint)
+		}
+	}
+	rf.swept = now
+}
+
+// remember records a use of value, first dropping uses older than cutoff
+func remember(seen map[string]time.Time, value string, now, cutoff time.Time) {
+	for existing, last := range seen {
+		if last.Before(cutoff) {
+			delete(seen, existing)
+		}
+	}
+	if _, exists := seen[value]; exists || len(seen) < maxTrackedPerFingerprint {
+		seen[value] = now
+	}
+}
+
+// apiKey returns the API key from the first key header present, without a
+// bearer prefix
+func apiKey(headers map[string]string, names []string) string {
+	for _, name := range names {
+		for header, value := range headers {
+			if !strings.EqualFold(header, name) {
+				continue
+			}
+			value = strings.TrimSpace(value)
+			if len(value) > 7 && strings.EqualFold(value[:7], "bearer ") {
+				value = strings.TrimSpace(value[7:])
+			}
+			if value != "" {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+// keyPattern reduces an API key to its shape: the short lowercase segments
+// naming its issuer and kind (e.g. "sk-proj-") and its length. Keys minted
+// by the same issuer share a pattern; the secret part is never kept.
+func keyPattern(key string) string {
+	if key == "" {
+		return ""
+	}
+	prefix := 0
+	for prefix < len(key) {
+		end := strings.IndexAny(key[prefix:], "-_")
+		if end <= 0 || end > 6 || strings.ToLower(key[prefix:prefix+end]) != key[prefix:prefix+end] {
+			break
+		}
+		prefix += end + 1
+	}
+	return key[:prefix] + "*" + strconv.Itoa(len(key))
+}
+
+// Configuration methods
+func (rf *RequestFingerprint) ValidateConfig(config *interfaces.ModuleConfig) error {
+	if config == nil {
+		return fmt.Errorf("config cannot be nil")
+	}
+
+	_, err := parseConfig(config)
+	return err
+}
+
+func (rf *RequestFingerprint) UpdateConfig(ctx context.Context, config *interfaces.ModuleConfig) error {
+	if err := rf.ValidateConfig(config); err != nil {
+		return err
+	}
+
+	return rf.Initialize(ctx, config)
+}
+
+func (rf *RequestFingerprint) GetConfig() *interfaces.ModuleConfig {
+	return &interfaces.ModuleConfig{
+		Name:     rf.name,
+		Type:     rf.Type().String(),
+		Enabled:  rf.status.State == interfaces.ModuleStateRunning,
+		Priority: 40, // Before the policies, so they can act on the flag
+		Config: map[string]interface{}{
+			"window":           rf.config.Window.String(),
+			"max_tenants":      rf.config.MaxTenants,
+			"max_keys":         rf.config.MaxKeys,
+			"components":       rf.config.Components,
+			"key_headers":      rf.config.KeyHeaders,
+			"max_fingerprints": rf.config.MaxFingerprints,
+		},
+	}
+}
+
+// defaultConfig returns the configuration used when none is given
+func defaultConfig() *FingerprintConfig {
+	return &FingerprintConfig{
+		Window:          10 * time.Minute,
+		MaxTenants:      5,
+		MaxKeys:         10,
+		Components:      []string{ComponentClientIP, ComponentUserAgent, ComponentKeyPattern},
+		KeyHeaders:      []string{"Authorization", "X-API-Key"},
+		MaxFingerprints: 100000,
+	}
+}
+
+// parseConfig parses and checks a module config over the defaults
+func parseConfig(config *interfaces.ModuleConfig) (*FingerprintConfig, error) {
+	fingerprintConfig := defaultConfig()
+	if config == nil || config.Config == nil {
+		return fingerprintConfig, nil
+	}
+	configMap := config.Config
+
+	if value, exists := configMap["window"]; exists {
+		str, _ := value.(string)
+		duration, err := time.ParseDuration(str)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("window must be a positive duration, got %v", value)
+		}
+		fingerprintConfig.Window = duration
+	}
+
+	for key, target := range map[string]*int{
+		"max_tenants":      &fingerprintConfig.MaxTenants,
+		"max_keys":         &fingerprintConfig.MaxKeys,
+		"max_fingerprints": &fingerprintConfig.MaxFingerprints,
+	} {
+		if value, exists := configMap[key]; exists {
+			number, ok := toFloat(value)
+			if !ok || number < 0 || number != float64(int(number)) {
+				return nil, fmt.Errorf("%s must be a non-negative integer, got %v", key, value)
+			}
+			*target = int(number)
+		}
+	}
+	if fingerprintConfig.MaxFingerprints == 0 {
+		return nil, fmt.Errorf("max_fingerprints must be positive")
+	}
+
+	if value, exists := configMap["components"]; exists {
+		components, err := toStrings(value)
+		if err != nil {
+			return nil, fmt.Errorf("components %w", err)
+		}
+		if len(components) == 0 {
+			return nil, fmt.Errorf("components must list at least one component")
+		}
+		for _, component := range components {
+			switch component {
+			case ComponentClientIP, ComponentUserAgent, ComponentKeyPattern:
+			default:
+				return nil, fmt.Errorf("unknown fingerprint component: %s", component)
+			}
+		}
+		fingerprintConfig.Components = components
+	}
+
+	if value, exists := configMap["key_headers"]; exists {
+		headers, err := toStrings(value)
+		if err != nil {
+			return nil, fmt.Errorf("key_headers %w", err)
+		}
+		fingerprintConfig.KeyHeaders = headers
+	}
+	return fingerprintConfig, nil
+}
+
+// toFloat reads a numeric config value
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// toStrings reads a list of strings from config
+func toStrings(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case []string:
+		return v, nil
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			str, ok := item.(string)
+			if !ok || str == "" {
+				return nil, fmt.Errorf("must be a list of names, got %v", item)
+			}
+			values = append(values, str)
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("must be a list of names, got %v", value)
+	}
+}
@@ -0,0 +1,323 @@
+package jsonmode
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/chatcontent"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"go.uber.org/zap"
+)
+
+// RetryAttemptHeader carries the number of times a request has already been
+// retried; callers honouring ActionRetry increment it on each retry
+const RetryAttemptHeader = "X-Leash-Retry-Attempt"
+
+// Invalid response handling
+const (
+	OnInvalidRetry = "retry" // ask the caller to retry, falling back to an error
+	OnInvalidError = "error" // replace the response with a normalized error
+)
+
+// JSONMode implements a transformer enforcing JSON output for requests that
+// ask for it with response_format
+type JSONMode struct {
+	name        string
+	version     string
+	description string
+	author      string
+	config      *JSONModeConfig
+	logger      *zap.SugaredLogger
+	status      *interfaces.ModuleStatus
+	startTime   time.Time
+}
+
+// JSONModeConfig represents JSON mode enforcement configuration
+type JSONModeConfig struct {
+	OnInvalid  string `yaml:"on_invalid" json:"on_invalid"`   // retry, error
+	MaxRetries int    `yaml:"max_retries" json:"max_retries"` // retries before an invalid response becomes an error
+}
+
+// NewJSONMode creates a new JSON mode enforcement module
+func NewJSONMode(logger *zap.SugaredLogger) *JSONMode {
+	return &JSONMode{
+		name:        "json-mode",
+		version:     "1.0.0",
+		description: "Validates that responses to JSON mode requests contain valid JSON",
+		author:      "Leash Security",
+		logger:      logger,
+		status: &interfaces.ModuleStatus{
+			State:             interfaces.ModuleStateReady,
+			RequestsProcessed: 0,
+			ErrorCount:        0,
+		},
+	}
+}
+
+// Metadata methods
+func (jm *JSONMode) Name() string                { return jm.name }
+func (jm *JSONMode) Version() string             { return jm.version }
+func (jm *JSONMode) Type() interfaces.ModuleType { return interfaces.ModuleTypeTransformer }
+func (jm *JSONMode) Description() string         { return jm.description }
+func (jm *JSONMode) Author() string              { return jm.author }
+func (jm *JSONMode) Dependencies() []string      { return []string{} }
+
+// Lifecycle methods
+func (jm *JSONMode) Initialize(ctx context.Context, config *interfaces.ModuleConfig) error {
+	jm.logger.Infof("Initializing JSON mode module")
+
+	jsonModeConfig := &JSONModeConfig{
+		OnInvalid:  OnInvalidError,
+		MaxRetries: 1,
+	}
+
+	// Override with provided config
+	if config != nil && config.Config != nil {
+		if onInvalid, ok := config.Config["on_invalid"].(string); ok {
+			jsonModeConfig.OnInvalid = onInvalid
+		}
+		if maxRetries, ok := config.Config["max_retries"].(int); ok {
+			jsonModeConfig.MaxRetries = maxRetries
+		}
+	}
+
+	jm.config = jsonModeConfig
+	jm.startTime = time.Now()
+	jm.status.State = interfaces.ModuleStateReady
+
+	jm.logger.Infof("JSON mode initialized with on_invalid=%s, max_retries=%d",
+		jsonModeConfig.OnInvalid, jsonModeConfig.MaxRetries)
+	return nil
+}
+
+func (jm *JSONMode) Start(ctx context.Context) error {
+	jm.status.State = interfaces.ModuleStateRunning
+	jm.status.StartTime = time.Now()
+	jm.logger.Infof("JSON mode module started")
+	return nil
+}
+
+func (jm *JSONMode) Stop(ctx context.Context) error {
+	jm.status.State = interfaces.ModuleStateDraining
+	jm.logger.Infof("JSON mode module stopping")
+	return nil
+}
+
+func (jm *JSONMode) Shutdown(ctx context.Context) error {
+	jm.status.State = interfaces.ModuleStateStopped
+	jm.logger.Infof("JSON mode module shutdown")
+	return nil
+}
+
+// Health and status methods
+func (jm *JSONMode) Health(ctx context.Context) (*interfaces.HealthStatus, error) {
+	return &interfaces.HealthStatus{
+		Status:        interfaces.HealthStateHealthy,
+		Message:       "JSON mode is healthy",
+		LastCheck:     time.Now(),
+		CheckDuration: time.Millisecond,
+		Details: map[string]interface{}{
+			"on_invalid": jm.config.OnInvalid,
+		},
+	}, nil
+}
+
+func (jm *JSONMode) Status() *interfaces.ModuleStatus {
+	status := *jm.status
+	status.LastActivity = time.Now()
+	return &status
+}
+
+func (jm *JSONMode) Metrics() map[string]interface{} {
+	return map[string]interface{}{
+		"requests_processed": jm.status.RequestsProcessed,
+		"errors":             jm.status.ErrorCount,
+		"uptime_seconds":     time.Since(jm.startTime).Seconds(),
+	}
+}
+
+// Processing methods
+func (jm *JSONMode) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequestContext) (*interfaces.ProcessRequestResult, error) {
+	// JSON mode is enforced on the response
+	return &interfaces.ProcessRequestResult{
+		Action: interfaces.ActionContinue,
+	}, nil
+}
+
+// ProcessResponse checks that every choice of a successful response to a JSON
+// mode request parses as JSON. Invalid output is retried while attempts
+// remain when configured, and otherwise replaced with a normalized error.
+func (jm *JSONMode) ProcessResponse(ctx context.Context, resp *interfaces.ProcessResponseContext) (*interfaces.ProcessResponseResult, error) {
+	start := time.Now()
+	jm.status.RequestsProcessed++
+	jm.status.LastActivity = time.Now()
+
+	if resp.StatusCode >= 400 || !requestsJSON(resp.Body) {
+		return &interfaces.ProcessResponseResult{
+			Action:         interfaces.ActionContinue,
+			ProcessingTime: time.Since(start),
+		}, nil
+	}
+
+	invalid := invalidChoices(resp.ResponseBody)
+	if len(invalid) == 0 {
+		return &interfaces.ProcessResponseResult{
+			Action:         interfaces.ActionContinue,
+			ProcessingTime: time.Since(start),
+			Annotations: map[string]interface{}{
+				"json_mode_valid": true,
+			},
+		}, nil
+	}
+
+	annotations := map[string]interface{}{
+		"json_mode_valid":   false,
+		"json_mode_invalid": invalid,
+	}
+
+	attempt := retryAttempt(resp.Headers)
+	if jm.config.OnInvalid == OnInvalidRetry && attempt < jm.config.MaxRetries {
+		jm.logger.Warnf("Response %s to JSON mode request is not valid JSON, retrying (attempt %d of %d)",
+			resp.RequestID, attempt+1, jm.config.MaxRetries)
+		return &interfaces.ProcessResponseResult{
+			Action:         interfaces.ActionRetry,
+			ProcessingTime: time.Since(start),
+			Annotations:    annotations,
+			ModifiedHeaders: map[string]string{
+				RetryAttemptHeader: strconv.Itoa(attempt + 1),
+			},
+		}, nil
+	}
+
+	jm.logger.Warnf("Response %s to JSON mode request is not valid JSON, returning an error", resp.RequestID)
+	return &interfaces.ProcessResponseResult{
+		Action:         interfaces.ActionBlock,
+		ModifiedBody:   errorBody(len(invalid)),
+		ProcessingTime: time.Since(start),
+		Annotations:    annotations,
+		Metadata: map[string]string{
+			"status_code": strconv.Itoa(http.StatusBadGateway),
+		},
+	}, nil
+}
+
+// Configuration methods
+func (jm *JSONMode) ValidateConfig(config *interfaces.ModuleConfig) error {
+	if config == nil {
+		return fmt.Errorf("config cannot be nil")
+	}
+
+	if configMap := config.Config; configMap != nil {
+		if onInvalid, ok := configMap["on_invalid"].(string); ok {
+			if onInvalid != OnInvalidRetry && onInvalid != OnInvalidError {
+				return fmt.Errorf("unsupported on_invalid action: %s", onInvalid)
+			}
+		}
+		if maxRetries, ok := configMap["max_retries"].(int); ok && maxRetries < 0 {
+			return fmt.Errorf("max_retries cannot be negative, got %d", maxRetries)
+		}
+	}
+
+	return nil
+}
+
+func (jm *JSONMode) UpdateConfig(ctx context.Context, config *interfaces.ModuleConfig) error {
+	if err := jm.ValidateConfig(config); err != nil {
+		return err
+	}
+
+	return jm.Initialize(ctx, config)
+}
+
+func (jm *JSONMode) GetConfig() *interfaces.ModuleConfig {
+	return &interfaces.ModuleConfig{
+		Name:     jm.name,
+		Type:     jm.Type().String(),
+		Enabled:  jm.status.State == interfaces.ModuleStateRunning,
+		Priority: 500,
+		Config: map[string]interface{}{
+			"on_invalid":  jm.config.OnInvalid,
+			"max_retries": jm.config.MaxRetries,
+		},
+	}
+}
+
+// requestsJSON reports whether a chat completion request asks for JSON output
+// with a json_object or json_schema response_format
+func requestsJSON(body []byte) bool {
+	var request struct {
+		ResponseFormat struct {
+			Type string `json:"type"`
+		} `json:"response_format"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return false
+	}
+	switch request.ResponseFormat.Type {
+	case "json_object", "json_schema":
+		return true
+	}
+	return false
+}
+
+// invalidChoices returns the indexes of response choices whose content does
+// not parse as JSON. Choices without text content, such as tool calls, are
+// not checked; a body that is not a JSON object counts as one invalid choice.
+func invalidChoices(body []byte) []int {
+	var response struct {
+		Choices []struct {
+			Message struct {
+				Content interface{} `json:"content"`
+			} `json:"message"`
+			Text *string `json:"text"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return []int{0}
+	}
+
+	invalid := []int{}
+	for i, choice := range response.Choices {
+		if choice.Message.Content == nil && choice.Text == nil {
+			continue
+		}
+		content := chatcontent.MessageText(choice.Message.Content)
+		if choice.Text != nil {
+			content = *choice.Text
+		}
+		if !json.Valid(bytes.TrimSpace([]byte(content))) {
+			invalid = append(invalid, i)
+		}
+	}
+	return invalid
+}
+
+// retryAttempt returns the retry attempt recorded on the request, 0 for the
+// first attempt
+func retryAttempt(headers map[string]string) int {
+	for key, value := range headers {
+		if strings.EqualFold(key, RetryAttemptHeader) {
+			if attempt, err := strconv.Atoi(value); err == nil && attempt > 0 {
+				return attempt
+			}
+		}
+	}
+	return 0
+}
+
+// errorBody encodes the normalized error returned in place of invalid output
+func errorBody(invalid int) []byte {
+	body, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]string{
+			"message": fmt.Sprintf("provider returned invalid JSON for a JSON mode request (%d invalid choices)", invalid),
+			"type":    "invalid_json_response",
+		},
+	})
+	return body
+}
@@ -0,0 +1,143 @@
+package logger
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/redact"
+)
+
+// capture is a request retained until its outcome is known
+type capture struct {
+	Timestamp   time.Time
+	Body        []byte
+	Headers     map[string]string
+	Annotations map[string]interface{}
+}
+
+// captureBuffer is a bounded ring of recent requests, keyed by request ID.
+// The oldest request is evicted when a new one arrives at capacity.
+type captureBuffer struct {
+	mu      sync.Mutex
+	size    int
+	order   []string // ring of request IDs, oldest at next
+	next    int
+	entries map[string]*capture
+}
+
+func newCaptureBuffer(size int) *captureBuffer {
+	return &captureBuffer{
+		size:    size,
+		order:   make([]string, 0, size),
+		entries: make(map[string]*capture, size),
+	}
+}
+
+// add retains a request, evicting the oldest at capacity
+func (b *captureBuffer) add(requestID string, entry *capture) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, exists := b.entries[requestID]; exists {
+		b.entries[requestID] = entry
+		return
+	}
+	if len(b.order) < b.size {
+		b.order = append(b.order, requestID)
+	} else {
+		delete(b.entries, b.order[b.next])
+		b.order[b.next] = requestID
+		b.next = (b.next + 1) % b.size
+	}
+	b.entries[requestID] = entry
+}
+
+// take removes and returns a retained request, or nil if it was evicted or
+// never captured. Its ring slot is reclaimed when overwritten.
+func (b *captureBuffer) take(requestID string) *capture {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entry := b.entries[requestID]
+	delete(b.entries, requestID)
+	return entry
+}
+
+// len returns the number of retained requests
+func (b *captureBuffer) len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.entries)
+}
+
+// captureRequest retains a request's redacted detail until its outcome is known
+func (l *Logger) captureRequest(req *interfaces.ProcessRequestContext) {
+	annotations := make(map[string]interface{}, len(req.Annotations))
+	for key, value := range req.Annotations {
+		annotations[key] = value
+	}
+	l.captures.add(req.RequestID, &capture{
+		Timestamp:   time.Now(),
+		Body:        l.redactBody(req.Body),
+		Headers:     l.filterHeaders(req.Headers),
+		Annotations: annotations,
+	})
+}
+
+// captureEntry builds the full-detail log entry for a failed or blocked
+// request, using the retained request when it is still buffered
+func (l *Logger) captureEntry(req *interfaces.ProcessRequestContext, outcome string) map[string]interface{} {
+	entry := map[string]interface{}{
+		"timestamp":  time.Now(),
+		"request_id": req.RequestID,
+		"tenant_id":  l.anonymizer.TenantID(req.TenantID),
+		"provider":   req.Provider,
+		"model":      req.Model,
+		"method":     req.Method,
+		"path":       req.Path,
+		"outcome":    outcome,
+		"type":       "capture",
+	}
+
+	if captured := l.captures.take(req.RequestID); captured != nil {
+		l.setBody(entry, "request_body", req.TenantID, captured.Body)
+		entry["request_headers"] = captured.Headers
+		entry["request_annotations"] = captured.Annotations
+	} else {
+		l.setBody(entry, "request_body", req.TenantID, l.redactBody(req.Body))
+		entry["request_headers"] = l.filterHeaders(req.Headers)
+	}
+	if len(req.Annotations) > 0 {
+		entry["annotations"] = req.Annotations
+	}
+	return entry
+}
+
+// setBody adds a body to a log entry, sealed with the tenant's key when body
+// encryption is enabled. A body that cannot be encrypted is left out rather
+// than written in the clear.
+func (l *Logger) setBody(entry map[string]interface{}, field, tenantID string, body []byte) {
+	if l.encryptor == nil {
+		entry[field] = string(body)
+		return
+	}
+	sealed, err := l.encryptor.Encrypt(tenantID, body)
+	if err != nil {
+		l.logger.Warnf("Omitting %s of request %s from the log: %v", field, entry["request_id"], err)
+		return
+	}
+	entry[field] = sealed
+}
+
+// redactBody masks PII when redaction is enabled and bounds a captured body
+func (l *Logger) redactBody(body []byte) []byte {
+	body = append([]byte(nil), body...)
+	if l.config.RedactPII {
+		body = redact.Body(body)
+	}
+	if max := l.config.CaptureMaxBodyBytes; max > 0 && len(body) > max {
+		body = append(body[:max:max], "...[truncated]"...)
+	}
+	return body
+}
@@ -4,13 +4,21 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"time"
 
+	"github.com/bendiamant/leash-gateway/internal/envelope"
+	"github.com/bendiamant/leash-gateway/internal/modules/chatcontent"
 	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/tenants"
 	"go.uber.org/zap"
 )
 
+// tenantHeader carries the tenant ID, which is anonymized like tenant_id
+const tenantHeader = "x-tenant-id"
+
 // Logger implements a structured logging module
 type Logger struct {
 	name        string
@@ -21,6 +29,10 @@ type Logger struct {
 	logger      *zap.SugaredLogger
 	status      *interfaces.ModuleStatus
 	startTime   time.Time
+	captures    *captureBuffer
+	output      io.Writer
+	anonymizer  *tenants.Anonymizer
+	encryptor   *envelope.Encryptor
 }
 
 // LoggerConfig represents logger module configuration
@@ -29,6 +41,12 @@ type LoggerConfig struct {
 	LogRequests  bool             `yaml:"log_requests" json:"log_requests"`
 	LogResponses bool             `yaml:"log_responses" json:"log_responses"`
 	RedactPII    bool             `yaml:"redact_pii" json:"redact_pii"`
+
+	// Error-triggered capture retains recent requests and logs their full
+	// detail only when they fail or are blocked
+	CaptureOnError      bool `yaml:"capture_on_error" json:"capture_on_error"`
+	CaptureBufferSize   int  `yaml:"capture_buffer_size" json:"capture_buffer_size"`
+	CaptureMaxBodyBytes int  `yaml:"capture_max_body_bytes" json:"capture_max_body_bytes"` // 0 keeps whole bodies
 }
 
 // LogDestination represents a log destination
@@ -56,6 +74,7 @@ func NewLogger(logger *zap.SugaredLogger) *Logger {
 		description: "Structured request/response logger with multiple destinations",
 		author:      "Leash Security",
 		logger:      logger,
+		output:      os.Stdout,
 		status: &interfaces.ModuleStatus{
 			State:             interfaces.ModuleStateReady,
 			RequestsProcessed: 0,
@@ -64,6 +83,23 @@ func NewLogger(logger *zap.SugaredLogger) *Logger {
 	}
 }
 
+// SetOutput redirects stdout destinations, e.g. for tests
+func (l *Logger) SetOutput(w io.Writer) {
+	l.output = w
+}
+
+// SetTenantAnonymizer makes log entries carry tenant pseudonyms instead of
+// tenant IDs
+func (l *Logger) SetTenantAnonymizer(anonymizer *tenants.Anonymizer) {
+	l.anonymizer = anonymizer
+}
+
+// SetBodyEncryptor makes captured request and response bodies be written as
+// envelopes sealed with the tenant's key instead of in the clear
+func (l *Logger) SetBodyEncryptor(encryptor *envelope.Encryptor) {
+	l.encryptor = encryptor
+}
+
 // Metadata methods
 func (l *Logger) Name() string                    { return l.name }
 func (l *Logger) Version() string                 { return l.version }
@@ -78,9 +114,12 @@ func (l *Logger) Initialize(ctx context.Context, config *interfaces.ModuleConfig
 
 	// Parse configuration
 	loggerConfig := &LoggerConfig{
-		LogRequests:  true,
-		LogResponses: false, // Default to false for PII safety
-		RedactPII:    true,
+		LogRequests:         true,
+		LogResponses:        false, // Default to false for PII safety
+		RedactPII:           true,
+		CaptureOnError:      false,
+		CaptureBufferSize:   100,
+		CaptureMaxBodyBytes: 16384,
 		Destinations: []LogDestination{
 			{
 				Type:   "stdout",
@@ -119,9 +158,19 @@ func (l *Logger) Initialize(ctx context.Context, config *interfaces.ModuleConfig
 		if redactPII, ok := config.Config["redact_pii"].(bool); ok {
 			loggerConfig.RedactPII = redactPII
 		}
+		if captureOnError, ok := config.Config["capture_on_error"].(bool); ok {
+			loggerConfig.CaptureOnError = captureOnError
+		}
+		if bufferSize, ok := config.Config["capture_buffer_size"].(int); ok && bufferSize > 0 {
+			loggerConfig.CaptureBufferSize = bufferSize
+		}
+		if maxBodyBytes, ok := config.Config["capture_max_body_bytes"].(int); ok && maxBodyBytes >= 0 {
+			loggerConfig.CaptureMaxBodyBytes = maxBodyBytes
+		}
 	}
 
 	l.config = loggerConfig
+	l.captures = newCaptureBuffer(loggerConfig.CaptureBufferSize)
 	l.startTime = time.Now()
 	l.status.State = interfaces.ModuleStateReady
 
@@ -180,6 +229,10 @@ func (l *Logger) Metrics() map[string]interface{} {
 // Processing methods
 func (l *Logger) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequestContext) (*interfaces.ProcessRequestResult, error) {
 	start := time.Now()
+
+	if l.config.CaptureOnError {
+		l.captureRequest(req)
+	}
 	
 	if !l.config.LogRequests {
 		return &interfaces.ProcessRequestResult{
@@ -192,7 +245,7 @@ func (l *Logger) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequ
 	logEntry := map[string]interface{}{
 		"timestamp":   req.Timestamp,
 		"request_id":  req.RequestID,
-		"tenant_id":   req.TenantID,
+		"tenant_id":   l.anonymizer.TenantID(req.TenantID),
 		"provider":    req.Provider,
 		"model":       req.Model,
 		"method":      req.Method,
@@ -203,6 +256,14 @@ func (l *Logger) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequ
 		"type":        "request",
 	}
 
+	// Add message content shape, including multi-modal image parts
+	if summary, ok := chatcontent.ParseRequest(req.Body); ok && summary.Messages > 0 {
+		logEntry["message_count"] = summary.Messages
+		logEntry["text_parts"] = summary.TextParts
+		logEntry["image_parts"] = len(summary.Images)
+		logEntry["image_bytes"] = summary.ImageBytes
+	}
+
 	// Add headers (excluding sensitive ones)
 	if headers := l.filterHeaders(req.Headers); len(headers) > 0 {
 		logEntry["headers"] = headers
@@ -231,6 +292,19 @@ func (l *Logger) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequ
 func (l *Logger) ProcessResponse(ctx context.Context, resp *interfaces.ProcessResponseContext) (*interfaces.ProcessResponseResult, error) {
 	start := time.Now()
 
+	// Failed requests are logged in full; the capture of any other is discarded
+	if l.config.CaptureOnError {
+		if resp.StatusCode >= http.StatusBadRequest {
+			entry := l.captureEntry(resp.ProcessRequestContext, "error")
+			entry["status_code"] = resp.StatusCode
+			l.setBody(entry, "response_body", resp.TenantID, l.redactBody(resp.ResponseBody))
+			entry["response_headers"] = l.filterHeaders(resp.ResponseHeaders)
+			l.logToDestinations(entry)
+		} else {
+			l.captures.take(resp.RequestID)
+		}
+	}
+
 	if !l.config.LogResponses {
 		return &interfaces.ProcessResponseResult{
 			Action:         interfaces.ActionContinue,
@@ -242,7 +316,7 @@ func (l *Logger) ProcessResponse(ctx context.Context, resp *interfaces.ProcessRe
 	logEntry := map[string]interface{}{
 		"timestamp":        time.Now(),
 		"request_id":       resp.RequestID,
-		"tenant_id":        resp.TenantID,
+		"tenant_id":        l.anonymizer.TenantID(resp.TenantID),
 		"provider":         resp.Provider,
 		"model":            resp.Model,
 		"status_code":      resp.StatusCode,
@@ -258,6 +332,7 @@ func (l *Logger) ProcessResponse(ctx context.Context, resp *interfaces.ProcessRe
 			"prompt":     resp.TokensUsed.PromptTokens,
 			"completion": resp.TokensUsed.CompletionTokens,
 			"total":      resp.TokensUsed.TotalTokens,
+			"reasoning":  resp.TokensUsed.ReasoningTokens,
 		}
 	}
 
@@ -283,6 +358,21 @@ func (l *Logger) ProcessResponse(ctx context.Context, resp *interfaces.ProcessRe
 	}, nil
 }
 
+// ObserveBlock logs the full detail of a request blocked before reaching the
+// provider when error-triggered capture is enabled
+func (l *Logger) ObserveBlock(ctx context.Context, req *interfaces.ProcessRequestContext, result *interfaces.ProcessRequestResult) {
+	if !l.config.CaptureOnError {
+		return
+	}
+
+	entry := l.captureEntry(req, "blocked")
+	entry["block_reason"] = result.BlockReason
+	if statusCode, ok := result.Metadata["status_code"]; ok {
+		entry["status_code"] = statusCode
+	}
+	l.logToDestinations(entry)
+}
+
 // Configuration methods
 func (l *Logger) ValidateConfig(config *interfaces.ModuleConfig) error {
 	if config == nil {
@@ -307,10 +397,13 @@ func (l *Logger) GetConfig() *interfaces.ModuleConfig {
 		Enabled:  l.status.State == interfaces.ModuleStateRunning,
 		Priority: 1000, // Low priority for logging (run last)
 		Config: map[string]interface{}{
-			"destinations":  l.config.Destinations,
-			"log_requests":  l.config.LogRequests,
-			"log_responses": l.config.LogResponses,
-			"redact_pii":    l.config.RedactPII,
+			"destinations":           l.config.Destinations,
+			"log_requests":           l.config.LogRequests,
+			"log_responses":          l.config.LogResponses,
+			"redact_pii":             l.config.RedactPII,
+			"capture_on_error":       l.config.CaptureOnError,
+			"capture_buffer_size":    l.config.CaptureBufferSize,
+			"capture_max_body_bytes": l.config.CaptureMaxBodyBytes,
 		},
 	}
 }
@@ -337,10 +430,10 @@ func (l *Logger) logToStdout(entry map[string]interface{}, format string) {
 	switch format {
 	case "json":
 		if jsonBytes, err := json.Marshal(entry); err == nil {
-			fmt.Fprintln(os.Stdout, string(jsonBytes))
+			fmt.Fprintln(l.output, string(jsonBytes))
 		}
 	case "text":
-		fmt.Fprintf(os.Stdout, "[%s] %s %s %s %s - %v\n",
+		fmt.Fprintf(l.output, "[%s] %s %s %s %s - %v\n",
 			entry["timestamp"],
 			entry["request_id"],
 			entry["tenant_id"],
@@ -370,6 +463,8 @@ func (l *Logger) filterHeaders(headers map[string]string) map[string]string {
 	for key, value := range headers {
 		if sensitiveHeaders[key] {
 			filtered[key] = "[REDACTED]"
+		} else if key == tenantHeader {
+			filtered[key] = l.anonymizer.TenantID(value)
 		} else {
 			filtered[key] = value
 		}
@@ -0,0 +1,309 @@
+package modelpolicy
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"go.uber.org/zap"
+)
+
+// ModelPolicy implements a per-tenant model allow/deny policy module
+type ModelPolicy struct {
+	name        string
+	version     string
+	description string
+	author      string
+	config      *ModelPolicyConfig
+	logger      *zap.SugaredLogger
+	status      *interfaces.ModuleStatus
+	startTime   time.Time
+	mu          sync.RWMutex
+}
+
+// ModelPolicyConfig represents model policy configuration
+type ModelPolicyConfig struct {
+	Tenants map[string]TenantModelRules `yaml:"tenants" json:"tenants"`
+	Default TenantModelRules            `yaml:"default" json:"default"` // applied to tenants without rules
+}
+
+// TenantModelRules represents the model rules for a single tenant.
+// Entries may be exact model names or glob patterns (e.g. "gpt-4o*").
+type TenantModelRules struct {
+	AllowedModels []string `yaml:"allowed_models" json:"allowed_models"` // empty means all models allowed
+	DeniedModels  []string `yaml:"denied_models" json:"denied_models"`   // evaluated before allowed_models
+}
+
+// NewModelPolicy creates a new model policy module
+func NewModelPolicy(logger *zap.SugaredLogger) *ModelPolicy {
+	return &ModelPolicy{
+		name:        "model-policy",
+		version:     "1.0.0",
+		description: "Per-tenant model allow/deny policy enforced before routing",
+		author:      "Leash Security",
+		logger:      logger,
+		status: &interfaces.ModuleStatus{
+			State:             interfaces.ModuleStateReady,
+			RequestsProcessed: 0,
+			ErrorCount:        0,
+		},
+	}
+}
+
+// Metadata methods
+func (mp *ModelPolicy) Name() string                { return mp.name }
+func (mp *ModelPolicy) Version() string             { return mp.version }
+func (mp *ModelPolicy) Type() interfaces.ModuleType { return interfaces.ModuleTypePolicy }
+func (mp *ModelPolicy) Description() string         { return mp.description }
+func (mp *ModelPolicy) Author() string              { return mp.author }
+func (mp *ModelPolicy) Dependencies() []string      { return []string{} }
+
+// Lifecycle methods
+func (mp *ModelPolicy) Initialize(ctx context.Context, config *interfaces.ModuleConfig) error {
+	mp.logger.Infof("Initializing model policy module")
+
+	policyConfig := &ModelPolicyConfig{
+		Tenants: make(map[string]TenantModelRules),
+	}
+
+	// Override with provided config
+	if config != nil && config.Config != nil {
+		if tenants, ok := config.Config["tenants"].(map[string]interface{}); ok {
+			for tenantID, rules := range tenants {
+				if rulesMap, ok := rules.(map[string]interface{}); ok {
+					policyConfig.Tenants[tenantID] = parseRules(rulesMap)
+				}
+			}
+		}
+		if defaults, ok := config.Config["default"].(map[string]interface{}); ok {
+			policyConfig.Default = parseRules(defaults)
+		}
+	}
+
+	mp.mu.Lock()
+	mp.config = policyConfig
+	mp.mu.Unlock()
+
+	mp.startTime = time.Now()
+	mp.status.State = interfaces.ModuleStateReady
+
+	mp.logger.Infof("Model policy initialized with rules for %d tenants", len(policyConfig.Tenants))
+	return nil
+}
+
+func (mp *ModelPolicy) Start(ctx context.Context) error {
+	mp.status.State = interfaces.ModuleStateRunning
+	mp.status.StartTime = time.Now()
+	mp.logger.Infof("Model policy module started")
+	return nil
+}
+
+func (mp *ModelPolicy) Stop(ctx context.Context) error {
+	mp.status.State = interfaces.ModuleStateDraining
+	mp.logger.Infof("Model policy module stopping")
+	return nil
+}
+
+func (mp *ModelPolicy) Shutdown(ctx context.Context) error {
+	mp.status.State = interfaces.ModuleStateStopped
+	mp.logger.Infof("Model policy module shutdown")
+	return nil
+}
+
+// Health and status methods
+func (mp *ModelPolicy) Health(ctx context.Context) (*interfaces.HealthStatus, error) {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+
+	return &interfaces.HealthStatus{
+		Status:        interfaces.HealthStateHealthy,
+		Message:       "Model policy is healthy",
+		LastCheck:     time.Now(),
+		CheckDuration: time.Millisecond,
+		Details: map[string]interface{}{
+			"tenants_with_rules": len(mp.config.Tenants),
+		},
+	}, nil
+}
+
+func (mp *ModelPolicy) Status() *interfaces.ModuleStatus {
+	status := *mp.status
+	status.LastActivity = time.Now()
+	return &status
+}
+
+func (mp *ModelPolicy) Metrics() map[string]interface{} {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+
+	return map[string]interface{}{
+		"requests_processed": mp.status.RequestsProcessed,
+		"errors":             mp.status.ErrorCount,
+		"tenants_with_rules": len(mp.config.Tenants),
+		"uptime_seconds":     time.Since(mp.startTime).Seconds(),
+	}
+}
+
+// Processing methods
+func (mp *ModelPolicy) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequestContext) (*interfaces.ProcessRequestResult, error) {
+	start := time.Now()
+	mp.status.RequestsProcessed++
+	mp.status.LastActivity = time.Now()
+
+	allowed, reason := mp.IsModelAllowed(req.TenantID, req.Model)
+	if !allowed {
+		mp.logger.Warnf("Blocking request %s: %s", req.RequestID, reason)
+		return &interfaces.ProcessRequestResult{
+			Action:         interfaces.ActionBlock,
+			BlockReason:    reason,
+			ProcessingTime: time.Since(start),
+			Annotations: map[string]interface{}{
+				"model_denied": true,
+				"model":        req.Model,
+			},
+		}, nil
+	}
+
+	return &interfaces.ProcessRequestResult{
+		Action:         interfaces.ActionContinue,
+		ProcessingTime: time.Since(start),
+		Annotations: map[string]interface{}{
+			"model_policy_checked": true,
+		},
+	}, nil
+}
+
+func (mp *ModelPolicy) ProcessResponse(ctx context.Context, resp *interfaces.ProcessResponseContext) (*interfaces.ProcessResponseResult, error) {
+	// Model policy doesn't need to process responses
+	return &interfaces.ProcessResponseResult{
+		Action: interfaces.ActionContinue,
+	}, nil
+}
+
+// Configuration methods
+func (mp *ModelPolicy) ValidateConfig(config *interfaces.ModuleConfig) error {
+	if config == nil {
+		return fmt.Errorf("config cannot be nil")
+	}
+
+	if configMap := config.Config; configMap != nil {
+		if tenants, ok := configMap["tenants"]; ok {
+			tenantsMap, ok := tenants.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("tenants must be a map of tenant rules")
+			}
+			for tenantID, rules := range tenantsMap {
+				rulesMap, ok := rules.(map[string]interface{})
+				if !ok {
+					return fmt.Errorf("rules for tenant %s must be a map", tenantID)
+				}
+				if err := validatePatterns(parseRules(rulesMap)); err != nil {
+					return fmt.Errorf("tenant %s: %w", tenantID, err)
+				}
+			}
+		}
+		if defaults, ok := configMap["default"].(map[string]interface{}); ok {
+			if err := validatePatterns(parseRules(defaults)); err != nil {
+				return fmt.Errorf("default rules: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (mp *ModelPolicy) UpdateConfig(ctx context.Context, config *interfaces.ModuleConfig) error {
+	if err := mp.ValidateConfig(config); err != nil {
+		return err
+	}
+
+	return mp.Initialize(ctx, config)
+}
+
+func (mp *ModelPolicy) GetConfig() *interfaces.ModuleConfig {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+
+	return &interfaces.ModuleConfig{
+		Name:     mp.name,
+		Type:     mp.Type().String(),
+		Enabled:  mp.status.State == interfaces.ModuleStateRunning,
+		Priority: 50, // Runs before rate limiting so denied models never consume quota
+		Config: map[string]interface{}{
+			"tenants": mp.config.Tenants,
+			"default": mp.config.Default,
+		},
+	}
+}
+
+// IsModelAllowed reports whether a tenant may use a model, and the block reason if not
+func (mp *ModelPolicy) IsModelAllowed(tenantID, model string) (bool, string) {
+	mp.mu.RLock()
+	rules, exists := mp.config.Tenants[tenantID]
+	if !exists {
+		rules = mp.config.Default
+	}
+	mp.mu.RUnlock()
+
+	if matchesAny(rules.DeniedModels, model) {
+		return false, fmt.Sprintf("model %s is denied for tenant %s", model, tenantID)
+	}
+
+	if len(rules.AllowedModels) > 0 && !matchesAny(rules.AllowedModels, model) {
+		return false, fmt.Sprintf("model %s is not in the allowed models for tenant %s", model, tenantID)
+	}
+
+	return true, ""
+}
+
+// parseRules converts a raw config map into tenant model rules
+func parseRules(rulesMap map[string]interface{}) TenantModelRules {
+	return TenantModelRules{
+		AllowedModels: toStringSlice(rulesMap["allowed_models"]),
+		DeniedModels:  toStringSlice(rulesMap["denied_models"]),
+	}
+}
+
+// toStringSlice converts a config list into a string slice
+func toStringSlice(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if str, ok := item.(string); ok {
+				result = append(result, str)
+			}
+		}
+		return result
+	default:
+		return nil
+	}
+}
+
+// validatePatterns checks that all model patterns are valid globs
+func validatePatterns(rules TenantModelRules) error {
+	for _, pattern := range append(append([]string{}, rules.AllowedModels...), rules.DeniedModels...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid model pattern %s: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// matchesAny reports whether the model matches any of the patterns
+func matchesAny(patterns []string, model string) bool {
+	for _, pattern := range patterns {
+		if pattern == model {
+			return true
+		}
+		if matched, err := path.Match(pattern, model); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
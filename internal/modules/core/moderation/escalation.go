@@ -0,0 +1,162 @@
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"go.uber.org/zap"
+)
+
+// EscalateAnnotation marks a request the moderation inspector flagged with
+// the block action
+const EscalateAnnotation = "moderation_escalate"
+
+// BlockReason is the reason given for requests blocked on moderation scores
+const BlockReason = "moderation_flagged"
+
+// Escalation implements the policy blocking requests the moderation
+// inspector flagged with the block action. Inspectors only annotate, so a
+// block on moderation scores needs a policy stage.
+type Escalation struct {
+	name        string
+	version     string
+	description string
+	author      string
+	logger      *zap.SugaredLogger
+	status      *interfaces.ModuleStatus
+	startTime   time.Time
+}
+
+// NewEscalation creates a new moderation escalation policy module
+func NewEscalation(logger *zap.SugaredLogger) *Escalation {
+	return &Escalation{
+		name:        "moderation-escalation",
+		version:     "1.0.0",
+		description: "Blocks requests flagged by the moderation inspector",
+		author:      "Leash Security",
+		logger:      logger,
+		status: &interfaces.ModuleStatus{
+			State:             interfaces.ModuleStateReady,
+			RequestsProcessed: 0,
+			ErrorCount:        0,
+		},
+	}
+}
+
+// Metadata methods
+func (e *Escalation) Name() string                { return e.name }
+func (e *Escalation) Version() string             { return e.version }
+func (e *Escalation) Type() interfaces.ModuleType { return interfaces.ModuleTypePolicy }
+func (e *Escalation) Description() string         { return e.description }
+func (e *Escalation) Author() string              { return e.author }
+func (e *Escalation) Dependencies() []string      { return []string{"moderation"} }
+
+// Lifecycle methods
+func (e *Escalation) Initialize(ctx context.Context, config *interfaces.ModuleConfig) error {
+	e.startTime = time.Now()
+	e.status.State = interfaces.ModuleStateReady
+	e.logger.Infof("Moderation escalation initialized")
+	return nil
+}
+
+func (e *Escalation) Start(ctx context.Context) error {
+	e.status.State = interfaces.ModuleStateRunning
+	e.status.StartTime = time.Now()
+	e.logger.Infof("Moderation escalation module started")
+	return nil
+}
+
+func (e *Escalation) Stop(ctx context.Context) error {
+	e.status.State = interfaces.ModuleStateDraining
+	e.logger.Infof("Moderation escalation module stopping")
+	return nil
+}
+
+func (e *Escalation) Shutdown(ctx context.Context) error {
+	e.status.State = interfaces.ModuleStateStopped
+	e.logger.Infof("Moderation escalation module shutdown")
+	return nil
+}
+
+// Health and status methods
+func (e *Escalation) Health(ctx context.Context) (*interfaces.HealthStatus, error) {
+	return &interfaces.HealthStatus{
+		Status:        interfaces.HealthStateHealthy,
+		Message:       "Moderation escalation is healthy",
+		LastCheck:     time.Now(),
+		CheckDuration: time.Millisecond,
+	}, nil
+}
+
+func (e *Escalation) Status() *interfaces.ModuleStatus {
+	status := *e.status
+	status.LastActivity = time.Now()
+	return &status
+}
+
+func (e *Escalation) Metrics() map[string]interface{} {
+	return map[string]interface{}{
+		"requests_processed": e.status.RequestsProcessed,
+		"errors":             e.status.ErrorCount,
+		"uptime_seconds":     time.Since(e.startTime).Seconds(),
+	}
+}
+
+// Processing methods
+func (e *Escalation) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequestContext) (*interfaces.ProcessRequestResult, error) {
+	start := time.Now()
+	e.status.RequestsProcessed++
+	e.status.LastActivity = time.Now()
+
+	if req.Annotations[EscalateAnnotation] != true {
+		return &interfaces.ProcessRequestResult{
+			Action:         interfaces.ActionContinue,
+			ProcessingTime: time.Since(start),
+		}, nil
+	}
+
+	e.logger.Warnf("Blocking request %s flagged by moderation for %v", req.RequestID, req.Annotations["moderation_categories"])
+	return &interfaces.ProcessRequestResult{
+		Action:         interfaces.ActionBlock,
+		BlockReason:    BlockReason,
+		ProcessingTime: time.Since(start),
+		Annotations: map[string]interface{}{
+			"moderation_blocked": true,
+		},
+	}, nil
+}
+
+func (e *Escalation) ProcessResponse(ctx context.Context, resp *interfaces.ProcessResponseContext) (*interfaces.ProcessResponseResult, error) {
+	// Moderation escalation doesn't need to process responses
+	return &interfaces.ProcessResponseResult{
+		Action: interfaces.ActionContinue,
+	}, nil
+}
+
+// Configuration methods
+func (e *Escalation) ValidateConfig(config *interfaces.ModuleConfig) error {
+	if config == nil {
+		return fmt.Errorf("config cannot be nil")
+	}
+	return nil
+}
+
+func (e *Escalation) UpdateConfig(ctx context.Context, config *interfaces.ModuleConfig) error {
+	if err := e.ValidateConfig(config); err != nil {
+		return err
+	}
+
+	return e.Initialize(ctx, config)
+}
+
+func (e *Escalation) GetConfig() *interfaces.ModuleConfig {
+	return &interfaces.ModuleConfig{
+		Name:     e.name,
+		Type:     e.Type().String(),
+		Enabled:  e.status.State == interfaces.ModuleStateRunning,
+		Priority: 250, // Before the content filter, which the scores supersede
+		Config:   map[string]interface{}{},
+	}
+}
@@ -0,0 +1,533 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/circuitbreaker"
+	"github.com/bendiamant/leash-gateway/internal/metrics"
+	"github.com/bendiamant/leash-gateway/internal/modules/chatcontent"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"go.uber.org/zap"
+)
+
+// Actions taken on content scoring at or above a threshold
+const (
+	ActionAnnotate = "annotate" // annotate the flagged categories only
+	ActionBlock    = "block"    // also mark the request for the escalation policy
+)
+
+// Results of a moderation check, as recorded in leash_moderation_checks_total
+const (
+	ResultClean   = "clean"   // no category reached its threshold
+	ResultFlagged = "flagged" // a category reached its threshold
+	ResultFailed  = "failed"  // the moderation API call failed
+	ResultSkipped = "skipped" // the circuit was open, so the API was not called
+)
+
+// maxResponseBytes bounds the size of a moderation API response
+const maxResponseBytes = 1 << 20
+
+// Moderation implements an inspector sending request content to an
+// OpenAI-compatible moderation API and annotating the category scores it
+// returns. Categories scoring at or above their threshold flag the request;
+// with the block action the moderation-escalation policy then blocks it.
+type Moderation struct {
+	name        string
+	version     string
+	description string
+	author      string
+	config      *ModerationConfig
+	logger      *zap.SugaredLogger
+	status      *interfaces.ModuleStatus
+	startTime   time.Time
+	metrics     *metrics.Registry
+	client      *http.Client
+	breaker     *circuitbreaker.CircuitBreaker
+	apiKey      string
+}
+
+// ModerationConfig represents moderation integration configuration
+type ModerationConfig struct {
+	Endpoint         string               `yaml:"endpoint" json:"endpoint"`
+	Model            string               `yaml:"model" json:"model"`
+	APIKeyEnv        string               `yaml:"api_key_env" json:"api_key_env"` // env var holding a bearer token
+	Timeout          time.Duration        `yaml:"timeout" json:"timeout"`
+	RequestScope     chatcontent.Scope    `yaml:"request_scope" json:"request_scope"`
+	MaxInputChars    int                  `yaml:"max_input_chars" json:"max_input_chars"`     // longer content is truncated; 0 sends it all
+	Action           string               `yaml:"action" json:"action"`                       // annotate, block
+	DefaultThreshold float64              `yaml:"default_threshold" json:"default_threshold"` // for unlisted categories; 0 leaves them unflagged
+	Thresholds       map[string]float64   `yaml:"thresholds" json:"thresholds"`
+	CircuitBreaker   CircuitBreakerConfig `yaml:"circuit_breaker" json:"circuit_breaker"`
+}
+
+// CircuitBreakerConfig controls when calls to the moderation API stop after
+// failures
+type CircuitBreakerConfig struct {
+	FailureRate  int           `yaml:"failure_rate" json:"failure_rate"`   // percentage of failed calls opening the circuit
+	MinRequests  int           `yaml:"min_requests" json:"min_requests"`   // calls made before the rate is judged
+	ResetTimeout time.Duration `yaml:"reset_timeout" json:"reset_timeout"` // open time before a probe call
+}
+
+// moderationResponse is the part of an OpenAI moderation response used
+type moderationResponse struct {
+	Results []struct {
+		CategoryScores map[string]float64 `json:"category_scores"`
+	} `json:"results"`
+}
+
+// NewModeration creates a new moderation module
+func NewModeration(logger *zap.SugaredLogger) *Moderation {
+	m := &Moderation{
+		name:        "moderation",
+		version:     "1.0.0",
+		description: "Scores request content with a provider moderation API",
+		author:      "Leash Security",
+		config:      defaultConfig(),
+		logger:      logger,
+		status: &interfaces.ModuleStatus{
+			State:             interfaces.ModuleStateReady,
+			RequestsProcessed: 0,
+			ErrorCount:        0,
+		},
+	}
+	m.client = &http.Client{Timeout: m.config.Timeout}
+	m.breaker = m.newBreaker(m.config.CircuitBreaker)
+	return m
+}
+
+// SetMetrics enables the moderation check counter
+func (m *Moderation) SetMetrics(registry *metrics.Registry) {
+	m.metrics = registry
+}
+
+// Metadata methods
+func (m *Moderation) Name() string                { return m.name }
+func (m *Moderation) Version() string             { return m.version }
+func (m *Moderation) Type() interfaces.ModuleType { return interfaces.ModuleTypeInspector }
+func (m *Moderation) Description() string         { return m.description }
+func (m *Moderation) Author() string              { return m.author }
+func (m *Moderation) Dependencies() []string      { return []string{} }
+
+// Lifecycle methods
+func (m *Moderation) Initialize(ctx context.Context, config *interfaces.ModuleConfig) error {
+	m.logger.Infof("Initializing moderation module")
+
+	moderationConfig, err := parseConfig(config)
+	if err != nil {
+		return err
+	}
+
+	m.config = moderationConfig
+	m.client = &http.Client{Timeout: moderationConfig.Timeout}
+	m.breaker = m.newBreaker(moderationConfig.CircuitBreaker)
+	m.apiKey = ""
+	if moderationConfig.APIKeyEnv != "" {
+		m.apiKey = os.Getenv(moderationConfig.APIKeyEnv)
+	}
+	m.startTime = time.Now()
+	m.status.State = interfaces.ModuleStateReady
+
+	m.logger.Infof("Moderation initialized with endpoint=%s, model=%s, action=%s, timeout=%v",
+		moderationConfig.Endpoint, moderationConfig.Model, moderationConfig.Action, moderationConfig.Timeout)
+	return nil
+}
+
+func (m *Moderation) Start(ctx context.Context) error {
+	m.status.State = interfaces.ModuleStateRunning
+	m.status.StartTime = time.Now()
+	m.logger.Infof("Moderation module started")
+	return nil
+}
+
+func (m *Moderation) Stop(ctx context.Context) error {
+	m.status.State = interfaces.ModuleStateDraining
+	m.logger.Infof("Moderation module stopping")
+	return nil
+}
+
+func (m *Moderation) Shutdown(ctx context.Context) error {
+	m.status.State = interfaces.ModuleStateStopped
+	m.logger.Infof("Moderation module shutdown")
+	return nil
+}
+
+// Health and status methods
+func (m *Moderation) Health(ctx context.Context) (*interfaces.HealthStatus, error) {
+	state := m.breaker.GetState()
+	health := &interfaces.HealthStatus{
+		Status:        interfaces.HealthStateHealthy,
+		Message:       "Moderation is healthy",
+		LastCheck:     time.Now(),
+		CheckDuration: time.Millisecond,
+		Details: map[string]interface{}{
+			"endpoint": m.config.Endpoint,
+			"circuit":  state.String(),
+		},
+	}
+	if state != circuitbreaker.StateClosed {
+		health.Status = interfaces.HealthStateDegraded
+		health.Message = "Moderation API circuit is " + state.String() + ", requests are not moderated"
+	}
+	return health, nil
+}
+
+func (m *Moderation) Status() *interfaces.ModuleStatus {
+	status := *m.status
+	status.LastActivity = time.Now()
+	return &status
+}
+
+func (m *Moderation) Metrics() map[string]interface{} {
+	return map[string]interface{}{
+		"requests_processed": m.status.RequestsProcessed,
+		"errors":             m.status.ErrorCount,
+		"uptime_seconds":     time.Since(m.startTime).Seconds(),
+		"circuit":            m.breaker.GetState().String(),
+	}
+}
+
+// Processing methods
+
+// ProcessRequest scores the request's content and annotates the scores and
+// any categories reaching their threshold. A failed call is returned as an
+// error, so the pipeline's retries and timeout handling apply; while the
+// circuit is open the API is not called and the request is annotated
+// moderation_skipped instead.
+func (m *Moderation) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequestContext) (*interfaces.ProcessRequestResult, error) {
+	start := time.Now()
+	m.status.RequestsProcessed++
+	m.status.LastActivity = time.Now()
+
+	content := string(req.Body)
+	if summary, ok := chatcontent.ParseRequestScope(req.Body, m.config.RequestScope); ok {
+		content = summary.Text
+	}
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return &interfaces.ProcessRequestResult{
+			Action:         interfaces.ActionContinue,
+			ProcessingTime: time.Since(start),
+		}, nil
+	}
+	if m.config.MaxInputChars > 0 {
+		if runes := []rune(content); len(runes) > m.config.MaxInputChars {
+			content = string(runes[:m.config.MaxInputChars])
+		}
+	}
+
+	var scores map[string]float64
+	called := false
+	err := m.breaker.Call(func() error {
+		called = true
+		var err error
+		scores, err = m.moderate(ctx, content)
+		return err
+	})
+	if !called {
+		m.record(ResultSkipped)
+		return &interfaces.ProcessRequestResult{
+			Action:         interfaces.ActionContinue,
+			ProcessingTime: time.Since(start),
+			Annotations: map[string]interface{}{
+				"moderation_skipped": "circuit_open",
+			},
+		}, nil
+	}
+	if err != nil {
+		m.status.ErrorCount++
+		m.record(ResultFailed)
+		return nil, fmt.Errorf("moderation request failed: %w", err)
+	}
+
+	annotations := map[string]interface{}{
+		"moderation_scores":  scores,
+		"moderation_flagged": false,
+	}
+	if categories := m.flagged(scores); len(categories) > 0 {
+		m.record(ResultFlagged)
+		annotations["moderation_flagged"] = true
+		annotations["moderation_categories"] = categories
+		if m.config.Action == ActionBlock {
+			annotations[EscalateAnnotation] = true
+		}
+		m.logger.Warnf("Request %s flagged by moderation for %v", req.RequestID, categories)
+	} else {
+		m.record(ResultClean)
+	}
+
+	return &interfaces.ProcessRequestResult{
+		Action:         interfaces.ActionContinue,
+		ProcessingTime: time.Since(start),
+		Annotations:    annotations,
+	}, nil
+}
+
+func (m *Moderation) ProcessResponse(ctx context.Context, resp *interfaces.ProcessResponseContext) (*interfaces.ProcessResponseResult, error) {
+	// Moderation only inspects requests
+	return &interfaces.ProcessResponseResult{
+		Action: interfaces.ActionContinue,
+	}, nil
+}
+
+// moderate calls the moderation API and returns its category scores
+func (m *Moderation) moderate(ctx context.Context, content string) (map[string]float64, error) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"model": m.config.Model,
+		"input": content,
+	})
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, m.config.Endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if m.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+m.apiKey)
+	}
+
+	resp, err := m.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("moderation API returned status %d", resp.StatusCode)
+	}
+
+	var moderated moderationResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&moderated); err != nil {
+		return nil, fmt.Errorf("invalid moderation response: %w", err)
+	}
+	if len(moderated.Results) == 0 {
+		return nil, fmt.Errorf("moderation response has no results")
+	}
+	return moderated.Results[0].CategoryScores, nil
+}
+
+// newBreaker creates the circuit breaker guarding the moderation API
+func (m *Moderation) newBreaker(config CircuitBreakerConfig) *circuitbreaker.CircuitBreaker {
+	return circuitbreaker.NewCircuitBreaker(circuitbreaker.Config{
+		Name:         m.name,
+		MaxFailures:  config.FailureRate,
+		MinRequests:  config.MinRequests,
+		ResetTimeout: config.ResetTimeout,
+		OnTransition: func(transition circuitbreaker.Transition) {
+			m.logger.Warnw("Moderation API circuit changed state", transition.Fields()...)
+		},
+	})
+}
+
+// flagged returns the categories scoring at or above their threshold, sorted
+func (m *Moderation) flagged(scores map[string]float64) []string {
+	var categories []string
+	for category, score := range scores {
+		threshold, listed := m.config.Thresholds[category]
+		if !listed {
+			threshold = m.config.DefaultThreshold
+		}
+		if threshold > 0 && score >= threshold {
+			categories = append(categories, category)
+		}
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+func (m *Moderation) record(result string) {
+	if m.metrics != nil {
+		m.metrics.RecordModerationCheck(result)
+	}
+}
+
+// Configuration methods
+func (m *Moderation) ValidateConfig(config *interfaces.ModuleConfig) error {
+	if config == nil {
+		return fmt.Errorf("config cannot be nil")
+	}
+
+	_, err := parseConfig(config)
+	return err
+}
+
+func (m *Moderation) UpdateConfig(ctx context.Context, config *interfaces.ModuleConfig) error {
+	if err := m.ValidateConfig(config); err != nil {
+		return err
+	}
+
+	return m.Initialize(ctx, config)
+}
+
+func (m *Moderation) GetConfig() *interfaces.ModuleConfig {
+	return &interfaces.ModuleConfig{
+		Name:     m.name,
+		Type:     m.Type().String(),
+		Enabled:  m.status.State == interfaces.ModuleStateRunning,
+		Priority: 50,
+		Config: map[string]interface{}{
+			"endpoint":          m.config.Endpoint,
+			"model":             m.config.Model,
+			"api_key_env":       m.config.APIKeyEnv,
+			"timeout":           m.config.Timeout.String(),
+			"request_scope":     m.config.RequestScope,
+			"max_input_chars":   m.config.MaxInputChars,
+			"action":            m.config.Action,
+			"default_threshold": m.config.DefaultThreshold,
+			"thresholds":        m.config.Thresholds,
+			"circuit_breaker": map[string]interface{}{
+				"failure_rate":  m.config.CircuitBreaker.FailureRate,
+				"min_requests":  m.config.CircuitBreaker.MinRequests,
+				"reset_timeout": m.config.CircuitBreaker.ResetTimeout.String(),
+			},
+		},
+	}
+}
+
+// defaultConfig returns the configuration used when none is given
+func defaultConfig() *ModerationConfig {
+	return &ModerationConfig{
+		Endpoint:         "https://api.openai.com/v1/moderations",
+		Model:            "omni-moderation-latest",
+		APIKeyEnv:        "OPENAI_API_KEY",
+		Timeout:          2 * time.Second,
+		RequestScope:     chatcontent.ScopeAll,
+		MaxInputChars:    20000,
+		Action:           ActionAnnotate,
+		DefaultThreshold: 0.8,
+		Thresholds:       map[string]float64{},
+		CircuitBreaker: CircuitBreakerConfig{
+			FailureRate:  50,
+			MinRequests:  10,
+			ResetTimeout: 30 * time.Second,
+		},
+	}
+}
+
+// parseConfig parses and checks a module config over the defaults
+func parseConfig(config *interfaces.ModuleConfig) (*ModerationConfig, error) {
+	moderationConfig := defaultConfig()
+	if config == nil || config.Config == nil {
+		return moderationConfig, nil
+	}
+	configMap := config.Config
+
+	for key, target := range map[string]*string{
+		"endpoint":    &moderationConfig.Endpoint,
+		"model":       &moderationConfig.Model,
+		"api_key_env": &moderationConfig.APIKeyEnv,
+		"action":      &moderationConfig.Action,
+	} {
+		if value, exists := configMap[key]; exists {
+			str, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s must be a string, got %v", key, value)
+			}
+			*target = str
+		}
+	}
+	if moderationConfig.Endpoint == "" {
+		return nil, fmt.Errorf("endpoint is required")
+	}
+	switch moderationConfig.Action {
+	case ActionAnnotate, ActionBlock:
+	default:
+		return nil, fmt.Errorf("invalid action: %s", moderationConfig.Action)
+	}
+
+	if value, exists := configMap["timeout"]; exists {
+		str, _ := value.(string)
+		duration, err := time.ParseDuration(str)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("timeout must be a positive duration, got %v", value)
+		}
+		moderationConfig.Timeout = duration
+	}
+
+	if scope, ok := configMap["request_scope"].(string); ok && scope != "" {
+		if !chatcontent.ValidScope(chatcontent.Scope(scope)) {
+			return nil, fmt.Errorf("invalid request_scope: %s", scope)
+		}
+		moderationConfig.RequestScope = chatcontent.Scope(scope)
+	}
+
+	if value, exists := configMap["max_input_chars"]; exists {
+		number, ok := toFloat(value)
+		if !ok || number < 0 {
+			return nil, fmt.Errorf("max_input_chars must be a non-negative integer, got %v", value)
+		}
+		moderationConfig.MaxInputChars = int(number)
+	}
+
+	if value, exists := configMap["default_threshold"]; exists {
+		threshold, ok := toFloat(value)
+		if !ok || threshold < 0 || threshold > 1 {
+			return nil, fmt.Errorf("default_threshold must be between 0 and 1, got %v", value)
+		}
+		moderationConfig.DefaultThreshold = threshold
+	}
+	if raw, ok := configMap["thresholds"]; ok {
+		thresholds, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("thresholds must be a map of categories to thresholds")
+		}
+		for category, value := range thresholds {
+			threshold, ok := toFloat(value)
+			if !ok || threshold < 0 || threshold > 1 {
+				return nil, fmt.Errorf("thresholds %s must be between 0 and 1, got %v", category, value)
+			}
+			moderationConfig.Thresholds[category] = threshold
+		}
+	}
+
+	if raw, ok := configMap["circuit_breaker"]; ok {
+		breaker, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("circuit_breaker must be a map")
+		}
+		if value, exists := breaker["failure_rate"]; exists {
+			rate, ok := toFloat(value)
+			if !ok || rate <= 0 || rate > 100 {
+				return nil, fmt.Errorf("circuit_breaker failure_rate must be a percentage above 0, got %v", value)
+			}
+			moderationConfig.CircuitBreaker.FailureRate = int(rate)
+		}
+		if value, exists := breaker["min_requests"]; exists {
+			requests, ok := toFloat(value)
+			if !ok || requests < 1 {
+				return nil, fmt.Errorf("circuit_breaker min_requests must be at least 1, got %v", value)
+			}
+			moderationConfig.CircuitBreaker.MinRequests = int(requests)
+		}
+		if value, exists := breaker["reset_timeout"]; exists {
+			str, _ := value.(string)
+			duration, err := time.ParseDuration(str)
+			if err != nil || duration <= 0 {
+				return nil, fmt.Errorf("circuit_breaker reset_timeout must be a positive duration, got %v", value)
+			}
+			moderationConfig.CircuitBreaker.ResetTimeout = duration
+		}
+	}
+	return moderationConfig, nil
+}
+
+// toFloat reads a numeric config value
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,214 @@
+package postprocess
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"go.uber.org/zap"
+)
+
+// PostProcessor implements a transformer applying configured declarative
+// steps, such as appending a disclaimer or deleting a field, to responses
+type PostProcessor struct {
+	name        string
+	version     string
+	description string
+	author      string
+	config      *PostProcessConfig
+	logger      *zap.SugaredLogger
+	status      *interfaces.ModuleStatus
+	startTime   time.Time
+}
+
+// PostProcessConfig represents response post-processing configuration
+type PostProcessConfig struct {
+	Steps []Step `yaml:"steps" json:"steps"` // applied in order
+}
+
+// NewPostProcessor creates a new response post-processing module
+func NewPostProcessor(logger *zap.SugaredLogger) *PostProcessor {
+	return &PostProcessor{
+		name:        "response-postprocessor",
+		version:     "1.0.0",
+		description: "Applies configured text and field edits to successful responses",
+		author:      "Leash Security",
+		logger:      logger,
+		status: &interfaces.ModuleStatus{
+			State:             interfaces.ModuleStateReady,
+			RequestsProcessed: 0,
+			ErrorCount:        0,
+		},
+	}
+}
+
+// Metadata methods
+func (pp *PostProcessor) Name() string                { return pp.name }
+func (pp *PostProcessor) Version() string             { return pp.version }
+func (pp *PostProcessor) Type() interfaces.ModuleType { return interfaces.ModuleTypeTransformer }
+func (pp *PostProcessor) Description() string         { return pp.description }
+func (pp *PostProcessor) Author() string              { return pp.author }
+func (pp *PostProcessor) Dependencies() []string      { return []string{} }
+
+// Lifecycle methods
+func (pp *PostProcessor) Initialize(ctx context.Context, config *interfaces.ModuleConfig) error {
+	pp.logger.Infof("Initializing response post-processor module")
+
+	postProcessConfig := &PostProcessConfig{}
+
+	// Override with provided config
+	if config != nil && config.Config != nil {
+		if rawSteps, ok := config.Config["steps"]; ok {
+			steps, err := parseSteps(rawSteps)
+			if err != nil {
+				return err
+			}
+			postProcessConfig.Steps = steps
+		}
+	}
+
+	pp.config = postProcessConfig
+	pp.startTime = time.Now()
+	pp.status.State = interfaces.ModuleStateReady
+
+	pp.logger.Infof("Response post-processor initialized with %d steps", len(postProcessConfig.Steps))
+	return nil
+}
+
+func (pp *PostProcessor) Start(ctx context.Context) error {
+	pp.status.State = interfaces.ModuleStateRunning
+	pp.status.StartTime = time.Now()
+	pp.logger.Infof("Response post-processor module started")
+	return nil
+}
+
+func (pp *PostProcessor) Stop(ctx context.Context) error {
+	pp.status.State = interfaces.ModuleStateDraining
+	pp.logger.Infof("Response post-processor module stopping")
+	return nil
+}
+
+func (pp *PostProcessor) Shutdown(ctx context.Context) error {
+	pp.status.State = interfaces.ModuleStateStopped
+	pp.logger.Infof("Response post-processor module shutdown")
+	return nil
+}
+
+// Health and status methods
+func (pp *PostProcessor) Health(ctx context.Context) (*interfaces.HealthStatus, error) {
+	return &interfaces.HealthStatus{
+		Status:        interfaces.HealthStateHealthy,
+		Message:       "Response post-processor is healthy",
+		LastCheck:     time.Now(),
+		CheckDuration: time.Millisecond,
+		Details: map[string]interface{}{
+			"steps": len(pp.config.Steps),
+		},
+	}, nil
+}
+
+func (pp *PostProcessor) Status() *interfaces.ModuleStatus {
+	status := *pp.status
+	status.LastActivity = time.Now()
+	return &status
+}
+
+func (pp *PostProcessor) Metrics() map[string]interface{} {
+	return map[string]interface{}{
+		"requests_processed": pp.status.RequestsProcessed,
+		"errors":             pp.status.ErrorCount,
+		"steps":              len(pp.config.Steps),
+		"uptime_seconds":     time.Since(pp.startTime).Seconds(),
+	}
+}
+
+// Processing methods
+func (pp *PostProcessor) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequestContext) (*interfaces.ProcessRequestResult, error) {
+	// Post-processing applies to the response
+	return &interfaces.ProcessRequestResult{
+		Action: interfaces.ActionContinue,
+	}, nil
+}
+
+// ProcessResponse applies the configured steps, in order, to a successful
+// JSON response. Error responses and bodies that are not a JSON object, such
+// as streams, pass through unchanged.
+func (pp *PostProcessor) ProcessResponse(ctx context.Context, resp *interfaces.ProcessResponseContext) (*interfaces.ProcessResponseResult, error) {
+	start := time.Now()
+	pp.status.RequestsProcessed++
+	pp.status.LastActivity = time.Now()
+
+	var response map[string]interface{}
+	if len(pp.config.Steps) == 0 || resp.StatusCode >= 400 || json.Unmarshal(resp.ResponseBody, &response) != nil || response == nil {
+		return &interfaces.ProcessResponseResult{
+			Action:         interfaces.ActionContinue,
+			ProcessingTime: time.Since(start),
+		}, nil
+	}
+
+	applied := 0
+	for _, step := range pp.config.Steps {
+		if step.apply(response) {
+			applied++
+		}
+	}
+	if applied == 0 {
+		return &interfaces.ProcessResponseResult{
+			Action:         interfaces.ActionContinue,
+			ProcessingTime: time.Since(start),
+		}, nil
+	}
+
+	body, err := json.Marshal(response)
+	if err != nil {
+		pp.status.ErrorCount++
+		return nil, fmt.Errorf("failed to encode post-processed response: %w", err)
+	}
+	return &interfaces.ProcessResponseResult{
+		Action:         interfaces.ActionTransform,
+		ModifiedBody:   body,
+		ProcessingTime: time.Since(start),
+		Annotations: map[string]interface{}{
+			"response_postprocessed": applied,
+		},
+	}, nil
+}
+
+// Configuration methods
+func (pp *PostProcessor) ValidateConfig(config *interfaces.ModuleConfig) error {
+	if config == nil {
+		return fmt.Errorf("config cannot be nil")
+	}
+
+	if configMap := config.Config; configMap != nil {
+		if rawSteps, ok := configMap["steps"]; ok {
+			if _, err := parseSteps(rawSteps); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (pp *PostProcessor) UpdateConfig(ctx context.Context, config *interfaces.ModuleConfig) error {
+	if err := pp.ValidateConfig(config); err != nil {
+		return err
+	}
+
+	return pp.Initialize(ctx, config)
+}
+
+func (pp *PostProcessor) GetConfig() *interfaces.ModuleConfig {
+	return &interfaces.ModuleConfig{
+		Name:     pp.name,
+		Type:     pp.Type().String(),
+		Enabled:  pp.status.State == interfaces.ModuleStateRunning,
+		Priority: 600, // After json-mode validates the provider's output
+		Config: map[string]interface{}{
+			"steps": pp.config.Steps,
+		},
+	}
+}
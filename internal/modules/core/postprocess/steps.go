@@ -0,0 +1,187 @@
+package postprocess
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Post-processing operations
+const (
+	OpAppendText  = "append_text"  // append text to the content of every choice
+	OpSetField    = "set_field"    // set a JSON field, creating missing objects on the path
+	OpDeleteField = "delete_field" // delete a JSON field if present
+)
+
+// Step is one declarative response post-processing operation
+type Step struct {
+	Op    string      `yaml:"op" json:"op"`
+	Text  string      `yaml:"text" json:"text,omitempty"`   // append_text
+	Path  string      `yaml:"path" json:"path,omitempty"`   // set_field and delete_field: dot-separated, numbers index arrays
+	Value interface{} `yaml:"value" json:"value,omitempty"` // set_field
+}
+
+// parseSteps parses and validates the steps config list
+func parseSteps(raw interface{}) ([]Step, error) {
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("steps must be a list")
+	}
+
+	steps := make([]Step, 0, len(list))
+	for i, item := range list {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("step %d must be a map", i)
+		}
+		step := Step{Value: fields["value"]}
+		step.Op, _ = fields["op"].(string)
+		step.Text, _ = fields["text"].(string)
+		step.Path, _ = fields["path"].(string)
+
+		switch step.Op {
+		case OpAppendText:
+			if step.Text == "" {
+				return nil, fmt.Errorf("step %d: append_text requires text", i)
+			}
+		case OpSetField:
+			if _, hasValue := fields["value"]; !hasValue {
+				return nil, fmt.Errorf("step %d: set_field requires a value", i)
+			}
+			fallthrough
+		case OpDeleteField:
+			if err := validatePath(step.Path); err != nil {
+				return nil, fmt.Errorf("step %d: %w", i, err)
+			}
+		default:
+			return nil, fmt.Errorf("step %d: unsupported op %q", i, step.Op)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// validatePath rejects empty paths and empty path segments
+func validatePath(path string) error {
+	if path == "" {
+		return fmt.Errorf("path is required")
+	}
+	for _, segment := range strings.Split(path, ".") {
+		if segment == "" {
+			return fmt.Errorf("invalid path %q", path)
+		}
+	}
+	return nil
+}
+
+// apply runs a step on a decoded response, reporting whether it changed it
+func (s Step) apply(response map[string]interface{}) bool {
+	switch s.Op {
+	case OpAppendText:
+		return appendText(response, s.Text)
+	case OpSetField:
+		return setField(response, strings.Split(s.Path, "."), s.Value)
+	case OpDeleteField:
+		return deleteField(response, strings.Split(s.Path, "."))
+	}
+	return false
+}
+
+// appendText appends text to each OpenAI choice's message content or legacy
+// completion text, and to the last text block of Anthropic-style content
+func appendText(response map[string]interface{}, text string) bool {
+	changed := false
+	if choices, ok := response["choices"].([]interface{}); ok {
+		for _, choice := range choices {
+			choiceMap, ok := choice.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if message, ok := choiceMap["message"].(map[string]interface{}); ok {
+				if content, ok := message["content"].(string); ok {
+					message["content"] = content + text
+					changed = true
+				} else if parts, ok := message["content"].([]interface{}); ok && appendToLastText(parts, text) {
+					changed = true
+				}
+			} else if completion, ok := choiceMap["text"].(string); ok {
+				choiceMap["text"] = completion + text
+				changed = true
+			}
+		}
+	}
+	if content, ok := response["content"].([]interface{}); ok && appendToLastText(content, text) {
+		changed = true
+	}
+	return changed
+}
+
+// appendToLastText appends text to the last text part of a content array
+func appendToLastText(parts []interface{}, text string) bool {
+	for i := len(parts) - 1; i >= 0; i-- {
+		part, ok := parts[i].(map[string]interface{})
+		if !ok || part["type"] != "text" {
+			continue
+		}
+		if existing, ok := part["text"].(string); ok {
+			part["text"] = existing + text
+			return true
+		}
+	}
+	return false
+}
+
+// setField sets the value at path, creating missing objects along it.
+// Array elements are addressed by index and must already exist.
+func setField(node interface{}, path []string, value interface{}) bool {
+	key := path[0]
+	switch container := node.(type) {
+	case map[string]interface{}:
+		if len(path) == 1 {
+			container[key] = value
+			return true
+		}
+		child, exists := container[key]
+		if !exists || child == nil {
+			child = make(map[string]interface{})
+			container[key] = child
+		}
+		return setField(child, path[1:], value)
+	case []interface{}:
+		index, err := strconv.Atoi(key)
+		if err != nil || index < 0 || index >= len(container) {
+			return false
+		}
+		if len(path) == 1 {
+			container[index] = value
+			return true
+		}
+		return setField(container[index], path[1:], value)
+	}
+	return false
+}
+
+// deleteField removes the object field at path. Array elements are not
+// removed, only fields within them.
+func deleteField(node interface{}, path []string) bool {
+	key := path[0]
+	switch container := node.(type) {
+	case map[string]interface{}:
+		child, exists := container[key]
+		if !exists {
+			return false
+		}
+		if len(path) == 1 {
+			delete(container, key)
+			return true
+		}
+		return deleteField(child, path[1:])
+	case []interface{}:
+		index, err := strconv.Atoi(key)
+		if err != nil || index < 0 || index >= len(container) || len(path) == 1 {
+			return false
+		}
+		return deleteField(container[index], path[1:])
+	}
+	return false
+}
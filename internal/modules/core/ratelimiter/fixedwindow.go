@@ -0,0 +1,104 @@
+package ratelimiter
+
+import (
+	"sync"
+	"time"
+)
+
+// Rate limiting algorithms
+const (
+	AlgorithmTokenBucket   = "token_bucket"   // bursts up to burst_size, refilled at refill_rate a second
+	AlgorithmFixedWindow   = "fixed_window"   // default_limit requests per default_window, reset at each window boundary
+	AlgorithmSlidingWindow = "sliding_window" // not implemented yet; limited as token_bucket
+)
+
+// limiter admits requests against a limit, reporting the requests left
+type limiter interface {
+	take() (int64, bool)
+	peek() (int64, bool) // as take, without counting the request
+	limit() int64
+}
+
+// fixedWindow counts requests in windows aligned to multiples of the window
+// length, admitting up to a limit per window. The count resets when a request
+// arrives in a later window.
+type fixedWindow struct {
+	max         int64
+	window      time.Duration
+	windowStart time.Time
+	count       int64
+	rule        string // tenant rule the window enforces, empty for the default limit
+	now         func() time.Time
+	mu          sync.Mutex
+}
+
+// getWindow gets or creates the fixed window for a key, applying the
+// configured limit and window length to an existing one
+func (rl *RateLimiter) getWindow(key, rule string, limit int64, length time.Duration) *fixedWindow {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	window, exists := rl.windows[key]
+	if !exists {
+		window = &fixedWindow{rule: rule, now: rl.now}
+		rl.windows[key] = window
+	}
+	window.resize(limit, length)
+	return window
+}
+
+// take counts a request if the current window has room, returning the
+// requests left in it
+func (fw *fixedWindow) take() (int64, bool) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	if start := fw.now().Truncate(fw.window); !start.Equal(fw.windowStart) {
+		fw.windowStart = start
+		fw.count = 0
+	}
+	if fw.count >= fw.max {
+		return 0, false
+	}
+	fw.count++
+	return fw.max - fw.count, true
+}
+
+// peek reports the requests a request would leave in the current window
+// without counting it
+func (fw *fixedWindow) peek() (int64, bool) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	count := fw.count
+	if start := fw.now().Truncate(fw.window); !start.Equal(fw.windowStart) {
+		count = 0
+	}
+	if count >= fw.max {
+		return 0, false
+	}
+	return fw.max - count - 1, true
+}
+
+// limit returns the requests admitted per window
+func (fw *fixedWindow) limit() int64 {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	return fw.max
+}
+
+// resize applies a limit and window length, reporting whether either
+// changed; a changed length starts a new window on the next request
+func (fw *fixedWindow) resize(limit int64, length time.Duration) bool {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if fw.max == limit && fw.window == length {
+		return false
+	}
+	if fw.window != length {
+		fw.windowStart = time.Time{}
+	}
+	fw.max = limit
+	fw.window = length
+	return true
+}
@@ -3,35 +3,52 @@ package ratelimiter
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/tenants"
 	"go.uber.org/zap"
 )
 
-// RateLimiter implements a token bucket rate limiter module
+// RateLimiter implements a token bucket or fixed window rate limiter module
 type RateLimiter struct {
-	name         string
-	version      string
-	description  string
-	author       string
-	config       *RateLimiterConfig
-	buckets      map[string]*TokenBucket
-	mu           sync.RWMutex
-	logger       *zap.SugaredLogger
-	status       *interfaces.ModuleStatus
-	startTime    time.Time
+	name        string
+	version     string
+	description string
+	author      string
+	config      *RateLimiterConfig
+	buckets     map[string]*TokenBucket
+	windows     map[string]*fixedWindow // fixed_window counters by bucket key
+	now         func() time.Time        // places requests in fixed windows
+	mu          sync.RWMutex
+	logger      *zap.SugaredLogger
+	status      *interfaces.ModuleStatus
+	startTime   time.Time
+	anonymizer  *tenants.Anonymizer
+
+	// Usage written to a shared store in batches
+	store     UsageStore
+	pending   map[string]int64 // admitted requests per bucket not yet written
+	stopFlush chan struct{}
+	flushDone chan struct{}
+	usageMu   sync.Mutex
 }
 
 // RateLimiterConfig represents rate limiter configuration
 type RateLimiterConfig struct {
-	Algorithm      string        `yaml:"algorithm" json:"algorithm"`           // token_bucket, fixed_window, sliding_window
-	DefaultLimit   int64         `yaml:"default_limit" json:"default_limit"`   // requests per window
-	DefaultWindow  time.Duration `yaml:"default_window" json:"default_window"` // time window
-	Storage        string        `yaml:"storage" json:"storage"`               // memory, redis
-	BurstSize      int64         `yaml:"burst_size" json:"burst_size"`         // max burst allowed
-	RefillRate     int64         `yaml:"refill_rate" json:"refill_rate"`       // tokens per second
+	Algorithm      string            `yaml:"algorithm" json:"algorithm"`               // token_bucket, fixed_window, sliding_window (limited as token_bucket)
+	DefaultLimit   int64             `yaml:"default_limit" json:"default_limit"`       // requests per window under fixed_window
+	DefaultWindow  time.Duration     `yaml:"default_window" json:"default_window"`     // fixed_window length
+	Storage        string            `yaml:"storage" json:"storage"`                   // memory, redis
+	BurstSize      int64             `yaml:"burst_size" json:"burst_size"`             // max burst allowed
+	RefillRate     int64             `yaml:"refill_rate" json:"refill_rate"`           // tokens per second
+	SoftLimitRatio float64           `yaml:"soft_limit_ratio" json:"soft_limit_ratio"` // fraction of the limit used before warning, 0 disables
+	WarningHeader  string            `yaml:"warning_header" json:"warning_header"`     // header carrying remaining capacity past the soft limit
+	Tenants        map[string][]Rule `yaml:"tenants" json:"tenants"`                   // named rules per tenant, first match applies
+	FlushInterval  time.Duration     `yaml:"flush_interval" json:"flush_interval"`     // how often admitted usage is written to the shared store
+	DrainTimeout   time.Duration     `yaml:"drain_timeout" json:"drain_timeout"`       // longest Shutdown waits to write pending usage
 }
 
 // TokenBucket represents a token bucket for rate limiting
@@ -40,6 +57,8 @@ type TokenBucket struct {
 	tokens      int64
 	refillRate  int64
 	lastRefill  time.Time
+	period      time.Duration // interval in which refillRate tokens are added, a second when zero
+	rule        string        // tenant rule the bucket enforces, empty for the default limit
 	mu          sync.Mutex
 }
 
@@ -51,6 +70,8 @@ func NewRateLimiter(logger *zap.SugaredLogger) *RateLimiter {
 		description: "Token bucket rate limiter for request throttling",
 		author:      "Leash Security",
 		buckets:     make(map[string]*TokenBucket),
+		windows:     make(map[string]*fixedWindow),
+		now:         time.Now,
 		logger:      logger,
 		status: &interfaces.ModuleStatus{
 			State:             interfaces.ModuleStateReady,
@@ -60,6 +81,20 @@ func NewRateLimiter(logger *zap.SugaredLogger) *RateLimiter {
 	}
 }
 
+// SetTenantAnonymizer makes logs and annotations carry tenant pseudonyms
+// instead of tenant IDs
+func (rl *RateLimiter) SetTenantAnonymizer(anonymizer *tenants.Anonymizer) {
+	rl.anonymizer = anonymizer
+}
+
+// SetClock replaces the clock used to place requests in fixed windows, for
+// tests; it applies to windows created afterwards
+func (rl *RateLimiter) SetClock(now func() time.Time) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.now = now
+}
+
 // Metadata methods
 func (rl *RateLimiter) Name() string        { return rl.name }
 func (rl *RateLimiter) Version() string     { return rl.version }
@@ -72,46 +107,19 @@ func (rl *RateLimiter) Dependencies() []string { return []string{} }
 func (rl *RateLimiter) Initialize(ctx context.Context, config *interfaces.ModuleConfig) error {
 	rl.logger.Infof("Initializing rate limiter module")
 
-	// Parse configuration
-	rateLimiterConfig := &RateLimiterConfig{
-		Algorithm:     "token_bucket",
-		DefaultLimit:  1000,
-		DefaultWindow: time.Hour,
-		Storage:       "memory",
-		BurstSize:     100,
-		RefillRate:    1000, // 1000 tokens per second
-	}
-
-	// Override with provided config
-	if config != nil && config.Config != nil {
-		if algorithm, ok := config.Config["algorithm"].(string); ok {
-			rateLimiterConfig.Algorithm = algorithm
-		}
-		if limit, ok := config.Config["default_limit"].(int); ok {
-			rateLimiterConfig.DefaultLimit = int64(limit)
-		}
-		if window, ok := config.Config["default_window"].(string); ok {
-			if duration, err := time.ParseDuration(window); err == nil {
-				rateLimiterConfig.DefaultWindow = duration
-			}
-		}
-		if storage, ok := config.Config["storage"].(string); ok {
-			rateLimiterConfig.Storage = storage
-		}
-		if burstSize, ok := config.Config["burst_size"].(int); ok {
-			rateLimiterConfig.BurstSize = int64(burstSize)
-		}
-		if refillRate, ok := config.Config["refill_rate"].(int); ok {
-			rateLimiterConfig.RefillRate = int64(refillRate)
-		}
-	}
+	rateLimiterConfig := rl.parseConfig(config)
 
+	rl.mu.Lock()
 	rl.config = rateLimiterConfig
+	rl.mu.Unlock()
 	rl.startTime = time.Now()
 	rl.status.State = interfaces.ModuleStateReady
 
 	rl.logger.Infof("Rate limiter initialized with algorithm=%s, limit=%d, window=%v", 
 		rateLimiterConfig.Algorithm, rateLimiterConfig.DefaultLimit, rateLimiterConfig.DefaultWindow)
+	if rateLimiterConfig.Algorithm == AlgorithmSlidingWindow {
+		rl.logger.Warnf("Rate limiter algorithm %s is not implemented yet; limiting as %s", AlgorithmSlidingWindow, AlgorithmTokenBucket)
+	}
 
 	return nil
 }
@@ -119,31 +127,43 @@ func (rl *RateLimiter) Initialize(ctx context.Context, config *interfaces.Module
 func (rl *RateLimiter) Start(ctx context.Context) error {
 	rl.status.State = interfaces.ModuleStateRunning
 	rl.status.StartTime = time.Now()
+	rl.startFlushing(rl.config.FlushInterval)
 	rl.logger.Infof("Rate limiter module started")
 	return nil
 }
 
 func (rl *RateLimiter) Stop(ctx context.Context) error {
+	// Requests still in flight are limited as before while draining
 	rl.status.State = interfaces.ModuleStateDraining
 	rl.logger.Infof("Rate limiter module stopping")
 	return nil
 }
 
+// Shutdown writes pending usage to the shared store, if any, within the
+// drain timeout so shutdown does not under-count admitted requests
 func (rl *RateLimiter) Shutdown(ctx context.Context) error {
+	err := rl.drainUsage(ctx)
 	rl.status.State = interfaces.ModuleStateStopped
+	if err != nil {
+		rl.logger.Errorf("Rate limiter shutdown: %v", err)
+		return err
+	}
 	rl.logger.Infof("Rate limiter module shutdown")
 	return nil
 }
 
 // Health and status methods
 func (rl *RateLimiter) Health(ctx context.Context) (*interfaces.HealthStatus, error) {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+
 	return &interfaces.HealthStatus{
 		Status:        interfaces.HealthStateHealthy,
 		Message:       "Rate limiter is healthy",
 		LastCheck:     time.Now(),
 		CheckDuration: time.Millisecond,
 		Details: map[string]interface{}{
-			"active_buckets": len(rl.buckets),
+			"active_buckets": len(rl.buckets) + len(rl.windows),
 			"algorithm":      rl.config.Algorithm,
 			"default_limit":  rl.config.DefaultLimit,
 		},
@@ -166,7 +186,8 @@ func (rl *RateLimiter) Metrics() map[string]interface{} {
 	return map[string]interface{}{
 		"requests_processed": rl.status.RequestsProcessed,
 		"errors":            rl.status.ErrorCount,
-		"active_buckets":    len(rl.buckets),
+		"active_buckets":    len(rl.buckets) + len(rl.windows),
+		"pending_writes":    rl.pendingWrites(),
 		"uptime_seconds":    time.Since(rl.startTime).Seconds(),
 	}
 }
@@ -174,37 +195,98 @@ func (rl *RateLimiter) Metrics() map[string]interface{} {
 // Processing methods
 func (rl *RateLimiter) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequestContext) (*interfaces.ProcessRequestResult, error) {
 	start := time.Now()
+	rl.mu.Lock()
 	rl.status.RequestsProcessed++
 	rl.status.LastActivity = time.Now()
+	limit := rl.config.DefaultLimit
+	algorithm := rl.config.Algorithm
+	window := rl.config.DefaultWindow
+	softLimitRatio := rl.config.SoftLimitRatio
+	warningHeader := rl.config.WarningHeader
+	rl.mu.Unlock()
 
 	// Create bucket key (tenant-based)
 	bucketKey := fmt.Sprintf("%s:%s", req.TenantID, req.Provider)
 	
-	bucket := rl.getBucket(bucketKey)
+	// A matching tenant rule replaces the default limit with its own bucket
+	// or window
+	rule, ruled := rl.matchRule(req)
+	var bucket limiter
+	if ruled {
+		bucketKey = fmt.Sprintf("%s:%s", bucketKey, rule.Name)
+		limit = rule.Limit
+		window = rule.Window
+	}
+	switch {
+	case req.DryRun:
+		bucket = rl.peekLimiter(bucketKey, algorithm, rule, ruled, limit, window)
+	case algorithm == AlgorithmFixedWindow:
+		bucket = rl.getWindow(bucketKey, rule.Name, limit, window)
+	case ruled:
+		bucket = rl.getRuleBucket(bucketKey, rule)
+	default:
+		bucket = rl.getBucket(bucketKey)
+	}
 	
-	if !bucket.Allow() {
-		rl.logger.Warnf("Rate limit exceeded for tenant %s, provider %s", req.TenantID, req.Provider)
-		return &interfaces.ProcessRequestResult{
+	// Logs and annotations name the tenant by pseudonym when anonymizing
+	tenant := rl.anonymizer.TenantID(req.TenantID)
+	annotatedKey := tenant + strings.TrimPrefix(bucketKey, req.TenantID)
+
+	// take reports the tokens this request left under the bucket lock, so the
+	// tokens_remaining annotation never reads the bucket unlocked. Dry runs
+	// are checked against the limit without consuming from it.
+	take := bucket.take
+	if req.DryRun {
+		take = bucket.peek
+	}
+	remaining, allowed := take()
+	if !allowed {
+		rl.logger.Warnf("Rate limit exceeded for tenant %s, provider %s", tenant, req.Provider)
+		result := &interfaces.ProcessRequestResult{
 			Action:         interfaces.ActionBlock,
 			BlockReason:    "rate_limit_exceeded",
 			ProcessingTime: time.Since(start),
 			Annotations: map[string]interface{}{
 				"rate_limit_exceeded": true,
-				"bucket_key":          bucketKey,
-				"limit":               rl.config.DefaultLimit,
+				"bucket_key":          annotatedKey,
+				"limit":               limit,
 			},
-		}, nil
+		}
+		if ruled {
+			result.Annotations["rate_limit_rule"] = rule.Name
+		}
+		return result, nil
+	}
+	if !req.DryRun {
+		rl.recordUsage(bucketKey)
 	}
 
-	return &interfaces.ProcessRequestResult{
+	result := &interfaces.ProcessRequestResult{
 		Action:         interfaces.ActionContinue,
 		ProcessingTime: time.Since(start),
 		Annotations: map[string]interface{}{
 			"rate_limit_checked": true,
-			"bucket_key":         bucketKey,
-			"tokens_remaining":   bucket.tokens,
+			"bucket_key":         annotatedKey,
+			"tokens_remaining":   remaining,
 		},
-	}, nil
+	}
+	if ruled {
+		result.Annotations["rate_limit_rule"] = rule.Name
+	}
+
+	// Past the soft limit the request continues with advance notice of the
+	// remaining capacity so clients can throttle before being blocked
+	if capacity := bucket.limit(); pastSoftLimit(softLimitRatio, remaining, capacity) {
+		rl.logger.Debugf("Soft rate limit reached for tenant %s, provider %s: %d of %d remaining",
+			tenant, req.Provider, remaining, capacity)
+		result.Annotations["rate_limit_warning"] = true
+		result.Annotations["rate_limit_remaining"] = remaining
+		result.AdditionalHeaders = map[string]string{
+			warningHeader: fmt.Sprintf("remaining=%d, limit=%d", remaining, capacity),
+		}
+	}
+
+	return result, nil
 }
 
 func (rl *RateLimiter) ProcessResponse(ctx context.Context, resp *interfaces.ProcessResponseContext) (*interfaces.ProcessResponseResult, error) {
@@ -232,43 +314,169 @@ func (rl *RateLimiter) ValidateConfig(config *interfaces.ModuleConfig) error {
 			}
 		}
 
+		if storage, ok := configMap["storage"].(string); ok {
+			if storage != "memory" && storage != "redis" {
+				return fmt.Errorf("unsupported storage: %s", storage)
+			}
+		}
+
 		// Validate limits
 		if limit, ok := configMap["default_limit"].(int); ok {
 			if limit <= 0 {
 				return fmt.Errorf("default_limit must be positive, got %d", limit)
 			}
 		}
+		if ratio, ok := configMap["soft_limit_ratio"].(float64); ok {
+			if ratio < 0 || ratio >= 1 {
+				return fmt.Errorf("soft_limit_ratio must be in [0, 1), got %v", ratio)
+			}
+		}
+		if tenants, ok := configMap["tenants"]; ok {
+			if _, err := parseTenantRules(tenants); err != nil {
+				return err
+			}
+		}
+		for _, key := range []string{"default_window", "flush_interval", "drain_timeout"} {
+			if value, ok := configMap[key].(string); ok {
+				if duration, err := time.ParseDuration(value); err != nil || duration <= 0 {
+					return fmt.Errorf("%s must be a positive duration, got %q", key, value)
+				}
+			}
+		}
 	}
 
 	return nil
 }
 
+// UpdateConfig applies a new configuration without discarding bucket state.
+// Buckets whose limits are unchanged keep their token counts; buckets whose
+// capacity or refill rate changed are rescaled proportionally so a reload
+// never grants every tenant a fresh burst allowance. Fixed windows take the
+// new limit at once, keeping their count unless the window length changed.
 func (rl *RateLimiter) UpdateConfig(ctx context.Context, config *interfaces.ModuleConfig) error {
 	if err := rl.ValidateConfig(config); err != nil {
 		return err
 	}
 
-	// Re-initialize with new config
-	return rl.Initialize(ctx, config)
+	newConfig := rl.parseConfig(config)
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rescaled := 0
+	for _, bucket := range rl.buckets {
+		if bucket.rule != "" {
+			continue // rule buckets follow their rule when next used
+		}
+		if bucket.rescale(newConfig.BurstSize, newConfig.RefillRate, 0) {
+			rescaled++
+		}
+	}
+	for _, window := range rl.windows {
+		if window.rule != "" {
+			continue // rule windows follow their rule when next used
+		}
+		if window.resize(newConfig.DefaultLimit, newConfig.DefaultWindow) {
+			rescaled++
+		}
+	}
+	rl.config = newConfig
+
+	rl.logger.Infof("Rate limiter config updated: algorithm=%s, limit=%d, window=%v (%d of %d buckets rescaled)",
+		newConfig.Algorithm, newConfig.DefaultLimit, newConfig.DefaultWindow, rescaled, len(rl.buckets)+len(rl.windows))
+
+	return nil
 }
 
 func (rl *RateLimiter) GetConfig() *interfaces.ModuleConfig {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+
 	return &interfaces.ModuleConfig{
 		Name:     rl.name,
 		Type:     rl.Type().String(),
 		Enabled:  rl.status.State == interfaces.ModuleStateRunning,
 		Priority: 100, // High priority for rate limiting
 		Config: map[string]interface{}{
-			"algorithm":      rl.config.Algorithm,
-			"default_limit":  rl.config.DefaultLimit,
-			"default_window": rl.config.DefaultWindow.String(),
-			"storage":        rl.config.Storage,
-			"burst_size":     rl.config.BurstSize,
-			"refill_rate":    rl.config.RefillRate,
+			"algorithm":        rl.config.Algorithm,
+			"default_limit":    rl.config.DefaultLimit,
+			"default_window":   rl.config.DefaultWindow.String(),
+			"storage":          rl.config.Storage,
+			"burst_size":       rl.config.BurstSize,
+			"refill_rate":      rl.config.RefillRate,
+			"soft_limit_ratio": rl.config.SoftLimitRatio,
+			"warning_header":   rl.config.WarningHeader,
+			"tenants":          rl.config.Tenants,
+			"flush_interval":   rl.config.FlushInterval.String(),
+			"drain_timeout":    rl.config.DrainTimeout.String(),
 		},
 	}
 }
 
+// parseConfig builds a rate limiter configuration from module config, applying defaults
+func (rl *RateLimiter) parseConfig(config *interfaces.ModuleConfig) *RateLimiterConfig {
+	rateLimiterConfig := &RateLimiterConfig{
+		Algorithm:     "token_bucket",
+		DefaultLimit:  1000,
+		DefaultWindow: time.Hour,
+		Storage:       "memory",
+		BurstSize:     100,
+		RefillRate:    1000, // 1000 tokens per second
+		WarningHeader: "X-Leash-RateLimit-Warning",
+		FlushInterval: time.Second,
+		DrainTimeout:  5 * time.Second,
+	}
+
+	// Override with provided config
+	if config != nil && config.Config != nil {
+		if algorithm, ok := config.Config["algorithm"].(string); ok {
+			rateLimiterConfig.Algorithm = algorithm
+		}
+		if limit, ok := config.Config["default_limit"].(int); ok {
+			rateLimiterConfig.DefaultLimit = int64(limit)
+		}
+		if window, ok := config.Config["default_window"].(string); ok {
+			if duration, err := time.ParseDuration(window); err == nil && duration > 0 {
+				rateLimiterConfig.DefaultWindow = duration
+			}
+		}
+		if storage, ok := config.Config["storage"].(string); ok {
+			rateLimiterConfig.Storage = storage
+		}
+		if burstSize, ok := config.Config["burst_size"].(int); ok {
+			rateLimiterConfig.BurstSize = int64(burstSize)
+		}
+		if refillRate, ok := config.Config["refill_rate"].(int); ok {
+			rateLimiterConfig.RefillRate = int64(refillRate)
+		}
+		if ratio, ok := config.Config["soft_limit_ratio"].(float64); ok {
+			rateLimiterConfig.SoftLimitRatio = ratio
+		}
+		if warningHeader, ok := config.Config["warning_header"].(string); ok && warningHeader != "" {
+			rateLimiterConfig.WarningHeader = warningHeader
+		}
+		if interval, ok := config.Config["flush_interval"].(string); ok {
+			if duration, err := time.ParseDuration(interval); err == nil && duration > 0 {
+				rateLimiterConfig.FlushInterval = duration
+			}
+		}
+		if timeout, ok := config.Config["drain_timeout"].(string); ok {
+			if duration, err := time.ParseDuration(timeout); err == nil && duration > 0 {
+				rateLimiterConfig.DrainTimeout = duration
+			}
+		}
+		if tenants, ok := config.Config["tenants"]; ok {
+			if rules, err := parseTenantRules(tenants); err == nil {
+				rateLimiterConfig.Tenants = rules
+			} else {
+				rl.logger.Warnf("Ignoring invalid tenant rate limits: %v", err)
+			}
+		}
+	}
+
+	return rateLimiterConfig
+}
+
 // getBucket gets or creates a token bucket for a key
 func (rl *RateLimiter) getBucket(key string) *TokenBucket {
 	rl.mu.Lock()
@@ -276,38 +484,182 @@ func (rl *RateLimiter) getBucket(key string) *TokenBucket {
 
 	bucket, exists := rl.buckets[key]
 	if !exists {
-		bucket = &TokenBucket{
-			capacity:   rl.config.BurstSize,
-			tokens:     rl.config.BurstSize,
-			refillRate: rl.config.RefillRate,
-			lastRefill: time.Now(),
-		}
+		bucket = NewTokenBucket(rl.config.BurstSize, rl.config.RefillRate)
 		rl.buckets[key] = bucket
 	}
 
 	return bucket
 }
 
+// getRuleBucket gets or creates the token bucket enforcing a tenant rule. The
+// bucket holds up to the rule's limit and regains it over the rule's window;
+// an existing bucket is rescaled if the rule changed since it was created.
+func (rl *RateLimiter) getRuleBucket(key string, rule Rule) *TokenBucket {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	bucket, exists := rl.buckets[key]
+	if !exists {
+		bucket = newRuleBucket(rule)
+		rl.buckets[key] = bucket
+		return bucket
+	}
+
+	bucket.rescale(rule.Limit, 1, rule.refillPeriod())
+	return bucket
+}
+
+// newRuleBucket creates a full bucket enforcing a tenant rule
+func newRuleBucket(rule Rule) *TokenBucket {
+	return &TokenBucket{
+		capacity:   rule.Limit,
+		tokens:     rule.Limit,
+		refillRate: 1,
+		lastRefill: time.Now(),
+		period:     rule.refillPeriod(),
+		rule:       rule.Name,
+	}
+}
+
+// peekLimiter returns the bucket or window for a key without creating one; a
+// key without one gets a fresh limiter that is not stored, as the first
+// request for the key would. Dry runs are checked against it.
+func (rl *RateLimiter) peekLimiter(key, algorithm string, rule Rule, ruled bool, limit int64, length time.Duration) limiter {
+	rl.mu.RLock()
+	burstSize, refillRate, now := rl.config.BurstSize, rl.config.RefillRate, rl.now
+	if algorithm == AlgorithmFixedWindow {
+		if window, exists := rl.windows[key]; exists {
+			rl.mu.RUnlock()
+			return window
+		}
+	} else if bucket, exists := rl.buckets[key]; exists {
+		rl.mu.RUnlock()
+		return bucket
+	}
+	rl.mu.RUnlock()
+
+	switch {
+	case algorithm == AlgorithmFixedWindow:
+		window := &fixedWindow{now: now}
+		window.resize(limit, length)
+		return window
+	case ruled:
+		return newRuleBucket(rule)
+	default:
+		return NewTokenBucket(burstSize, refillRate)
+	}
+}
+
+// NewTokenBucket creates a full bucket holding up to capacity tokens and
+// refilling refillRate tokens a second
+func NewTokenBucket(capacity, refillRate int64) *TokenBucket {
+	return &TokenBucket{
+		capacity:   capacity,
+		tokens:     capacity,
+		refillRate: refillRate,
+		lastRefill: time.Now(),
+	}
+}
+
 // Allow checks if a request is allowed by the token bucket
 func (tb *TokenBucket) Allow() bool {
+	_, allowed := tb.take()
+	return allowed
+}
+
+// Tokens returns the tokens currently available without consuming one. It is
+// safe to call concurrently with Allow; a caller that consumes a token and
+// needs the count left by that request should use the count take returns,
+// as other requests may consume tokens in between.
+func (tb *TokenBucket) Tokens() int64 {
 	tb.mu.Lock()
 	defer tb.mu.Unlock()
 
-	now := time.Now()
-	elapsed := now.Sub(tb.lastRefill)
-	
-	// Refill tokens based on elapsed time
-	tokensToAdd := int64(elapsed.Seconds()) * tb.refillRate
-	tb.tokens = min(tb.capacity, tb.tokens+tokensToAdd)
-	tb.lastRefill = now
+	tb.refill()
+	return tb.tokens
+}
+
+// take consumes a token if one is available, returning the tokens left
+func (tb *TokenBucket) take() (int64, bool) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.refill()
 
 	// Check if we have tokens available
 	if tb.tokens > 0 {
 		tb.tokens--
-		return true
+		return tb.tokens, true
+	}
+
+	return 0, false
+}
+
+// peek reports the tokens a request would leave without consuming one
+func (tb *TokenBucket) peek() (int64, bool) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.refill()
+	if tb.tokens > 0 {
+		return tb.tokens - 1, true
+	}
+	return 0, false
+}
+
+// refill adds the tokens due since the last refill; the caller holds tb.mu
+func (tb *TokenBucket) refill() {
+	period := tb.period
+	if period <= 0 {
+		period = time.Second
+	}
+
+	// Refill tokens for each whole period elapsed, carrying the remainder
+	// over so frequent requests do not starve the bucket
+	periods := int64(time.Since(tb.lastRefill) / period)
+	if periods > 0 {
+		tb.tokens = min(tb.capacity, tb.tokens+periods*tb.refillRate)
+		tb.lastRefill = tb.lastRefill.Add(time.Duration(periods) * period)
 	}
+}
 
-	return false
+// limit returns the bucket's capacity
+func (tb *TokenBucket) limit() int64 {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	return tb.capacity
+}
+
+// pastSoftLimit reports whether a bucket with remaining of capacity tokens
+// left has used at least ratio of its capacity
+func pastSoftLimit(ratio float64, remaining, capacity int64) bool {
+	if ratio <= 0 || capacity <= 0 {
+		return false
+	}
+	used := capacity - remaining
+	return float64(used) >= ratio*float64(capacity)
+}
+
+// rescale adjusts the bucket to new limits, preserving the fraction of
+// remaining tokens. It reports whether the bucket's limits changed.
+func (tb *TokenBucket) rescale(capacity, refillRate int64, period time.Duration) bool {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	if tb.capacity == capacity && tb.refillRate == refillRate && tb.period == period {
+		return false
+	}
+
+	if tb.capacity > 0 {
+		tb.tokens = tb.tokens * capacity / tb.capacity
+	} else {
+		tb.tokens = capacity
+	}
+	tb.tokens = min(capacity, tb.tokens)
+	tb.capacity = capacity
+	tb.refillRate = refillRate
+	tb.period = period
+	return true
 }
 
 // min returns the minimum of two int64 values
@@ -0,0 +1,38 @@
+package ratelimiter
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisUsageStore is the UsageStore gateway instances share through Redis.
+// Each bucket is a key incremented with INCRBY, so batches from every
+// instance add up without coordination.
+type RedisUsageStore struct {
+	client redis.Cmdable
+	prefix string
+	ttl    time.Duration
+}
+
+// NewRedisUsageStore creates a usage store keeping bucket counts under prefix
+// in Redis. A bucket's count expires ttl after its last write.
+func NewRedisUsageStore(client redis.Cmdable, prefix string, ttl time.Duration) *RedisUsageStore {
+	return &RedisUsageStore{client: client, prefix: prefix, ttl: ttl}
+}
+
+// IncrBy adds a batch of bucket counts in one round trip
+func (s *RedisUsageStore) IncrBy(ctx context.Context, counts map[string]int64) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for bucketKey, count := range counts {
+			key := s.prefix + bucketKey
+			pipe.IncrBy(ctx, key, count)
+			if s.ttl > 0 {
+				pipe.Expire(ctx, key, s.ttl)
+			}
+		}
+		return nil
+	})
+	return err
+}
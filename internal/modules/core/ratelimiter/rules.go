@@ -0,0 +1,142 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+)
+
+// Rule is a named per-tenant rate limit. A rule applies to requests matching
+// all of its conditions, or to every request of the tenant when it has none.
+type Rule struct {
+	Name       string                 `yaml:"name" json:"name"`
+	Limit      int64                  `yaml:"limit" json:"limit"`   // requests per window
+	Window     time.Duration          `yaml:"window" json:"window"` // time window
+	Conditions []interfaces.Condition `yaml:"conditions" json:"conditions"`
+}
+
+// matches reports whether the rule applies to a request
+func (r Rule) matches(req *interfaces.ProcessRequestContext) bool {
+	for _, condition := range r.Conditions {
+		if !condition.Matches(req) {
+			return false
+		}
+	}
+	return true
+}
+
+// refillPeriod is the interval in which the rule's bucket regains one token,
+// spreading the limit evenly over the window
+func (r Rule) refillPeriod() time.Duration {
+	return max(r.Window/time.Duration(r.Limit), time.Nanosecond)
+}
+
+// validate checks a rule's limit, window and conditions
+func (r Rule) validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("rate limit rule name is required")
+	}
+	if r.Limit <= 0 {
+		return fmt.Errorf("rate limit rule %s: limit must be positive, got %d", r.Name, r.Limit)
+	}
+	if r.Window <= 0 {
+		return fmt.Errorf("rate limit rule %s: window must be a positive duration", r.Name)
+	}
+	for _, condition := range r.Conditions {
+		if condition.Field == "" {
+			return fmt.Errorf("rate limit rule %s: condition field is required", r.Name)
+		}
+		if !condition.KnownOperator() {
+			return fmt.Errorf("rate limit rule %s: unsupported condition operator %q", r.Name, condition.Operator)
+		}
+	}
+	return nil
+}
+
+// matchRule returns the first of a tenant's rules matching the request
+func (rl *RateLimiter) matchRule(req *interfaces.ProcessRequestContext) (Rule, bool) {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+
+	for _, rule := range rl.config.Tenants[req.TenantID] {
+		if rule.matches(req) {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// parseTenantRules reads per-tenant rules from the "tenants" config option, a
+// map of tenant ID to a map holding a "rate_limits" list
+func parseTenantRules(value interface{}) (map[string][]Rule, error) {
+	tenantsMap, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("tenants must be a map of tenant rate limits")
+	}
+
+	tenants := make(map[string][]Rule, len(tenantsMap))
+	for tenantID, tenantConfig := range tenantsMap {
+		tenantMap, ok := tenantConfig.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("rate limits for tenant %s must be a map", tenantID)
+		}
+		names := make(map[string]bool)
+		for _, ruleMap := range toMapSlice(tenantMap["rate_limits"]) {
+			rule, err := parseRule(ruleMap)
+			if err != nil {
+				return nil, fmt.Errorf("tenant %s: %w", tenantID, err)
+			}
+			if names[rule.Name] {
+				return nil, fmt.Errorf("tenant %s: duplicate rate limit rule %s", tenantID, rule.Name)
+			}
+			names[rule.Name] = true
+			tenants[tenantID] = append(tenants[tenantID], rule)
+		}
+	}
+	return tenants, nil
+}
+
+// parseRule builds and validates a rule from its config map
+func parseRule(ruleMap map[string]interface{}) (Rule, error) {
+	var rule Rule
+	rule.Name, _ = ruleMap["name"].(string)
+	if limit, ok := ruleMap["limit"].(int); ok {
+		rule.Limit = int64(limit)
+	}
+	if window, ok := ruleMap["window"].(string); ok {
+		duration, err := time.ParseDuration(window)
+		if err != nil {
+			return rule, fmt.Errorf("rate limit rule %s: invalid window %q", rule.Name, window)
+		}
+		rule.Window = duration
+	}
+	for _, conditionMap := range toMapSlice(ruleMap["conditions"]) {
+		field, _ := conditionMap["field"].(string)
+		operator, _ := conditionMap["operator"].(string)
+		rule.Conditions = append(rule.Conditions, interfaces.Condition{
+			Field:    field,
+			Operator: operator,
+			Value:    conditionMap["value"],
+		})
+	}
+	return rule, rule.validate()
+}
+
+// toMapSlice converts a config list into a slice of maps
+func toMapSlice(value interface{}) []map[string]interface{} {
+	switch v := value.(type) {
+	case []map[string]interface{}:
+		return v
+	case []interface{}:
+		result := make([]map[string]interface{}, 0, len(v))
+		for _, item := range v {
+			if itemMap, ok := item.(map[string]interface{}); ok {
+				result = append(result, itemMap)
+			}
+		}
+		return result
+	default:
+		return nil
+	}
+}
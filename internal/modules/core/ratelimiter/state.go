@@ -0,0 +1,149 @@
+package ratelimiter
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// stateVersion is the version of the exported rate limiter state format
+const stateVersion = 1
+
+// State is the exported rate limiter state
+type State struct {
+	Version int                    `json:"version"`
+	Buckets map[string]BucketState `json:"buckets"`           // keyed by tenant:provider, plus :rule for tenant rules
+	Windows map[string]WindowState `json:"windows,omitempty"` // fixed windows, keyed as buckets
+}
+
+// BucketState is the exported state of one token bucket
+type BucketState struct {
+	Capacity     int64         `json:"capacity"`
+	Tokens       int64         `json:"tokens"`
+	RefillRate   int64         `json:"refill_rate"`
+	LastRefill   time.Time     `json:"last_refill"`
+	RefillPeriod time.Duration `json:"refill_period,omitempty"` // a second when zero
+	Rule         string        `json:"rule,omitempty"`          // tenant rule the bucket enforces
+}
+
+// WindowState is the exported state of one fixed window
+type WindowState struct {
+	Limit       int64         `json:"limit"`
+	Window      time.Duration `json:"window"`
+	WindowStart time.Time     `json:"window_start,omitempty"` // zero until the first request
+	Count       int64         `json:"count"`
+	Rule        string        `json:"rule,omitempty"` // tenant rule the window enforces
+}
+
+// ExportState returns the current token buckets and fixed windows as JSON
+func (rl *RateLimiter) ExportState() (json.RawMessage, error) {
+	rl.mu.RLock()
+	state := State{Version: stateVersion, Buckets: make(map[string]BucketState, len(rl.buckets))}
+	for key, bucket := range rl.buckets {
+		bucket.mu.Lock()
+		state.Buckets[key] = BucketState{
+			Capacity:     bucket.capacity,
+			Tokens:       bucket.tokens,
+			RefillRate:   bucket.refillRate,
+			LastRefill:   bucket.lastRefill,
+			RefillPeriod: bucket.period,
+			Rule:         bucket.rule,
+		}
+		bucket.mu.Unlock()
+	}
+	if len(rl.windows) > 0 {
+		state.Windows = make(map[string]WindowState, len(rl.windows))
+	}
+	for key, window := range rl.windows {
+		window.mu.Lock()
+		state.Windows[key] = WindowState{
+			Limit:       window.max,
+			Window:      window.window,
+			WindowStart: window.windowStart,
+			Count:       window.count,
+			Rule:        window.rule,
+		}
+		window.mu.Unlock()
+	}
+	rl.mu.RUnlock()
+
+	return json.Marshal(state)
+}
+
+// ImportState validates exported state and replaces all token buckets and
+// fixed windows with it
+func (rl *RateLimiter) ImportState(data json.RawMessage) error {
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("invalid rate limiter state: %w", err)
+	}
+	if state.Version != stateVersion {
+		return fmt.Errorf("unsupported rate limiter state version %d", state.Version)
+	}
+
+	buckets := make(map[string]*TokenBucket, len(state.Buckets))
+	for key, bucket := range state.Buckets {
+		if err := bucket.validate(key); err != nil {
+			return err
+		}
+		buckets[key] = &TokenBucket{
+			capacity:   bucket.Capacity,
+			tokens:     bucket.Tokens,
+			refillRate: bucket.RefillRate,
+			lastRefill: bucket.LastRefill,
+			period:     bucket.RefillPeriod,
+			rule:       bucket.Rule,
+		}
+	}
+
+	windows := make(map[string]*fixedWindow, len(state.Windows))
+	for key, window := range state.Windows {
+		if err := window.validate(key); err != nil {
+			return err
+		}
+		windows[key] = &fixedWindow{
+			max:         window.Limit,
+			window:      window.Window,
+			windowStart: window.WindowStart,
+			count:       window.Count,
+			rule:        window.Rule,
+		}
+	}
+
+	rl.mu.Lock()
+	for _, window := range windows {
+		window.now = rl.now
+	}
+	rl.buckets = buckets
+	rl.windows = windows
+	rl.mu.Unlock()
+
+	rl.logger.Infof("Rate limiter state imported with %d buckets and %d windows", len(buckets), len(windows))
+	return nil
+}
+
+func (b BucketState) validate(key string) error {
+	switch {
+	case key == "":
+		return fmt.Errorf("invalid rate limiter state: empty bucket key")
+	case b.Capacity < 0 || b.RefillRate < 0 || b.RefillPeriod < 0:
+		return fmt.Errorf("invalid rate limiter state: bucket %s has negative limits", key)
+	case b.Tokens < 0 || b.Tokens > b.Capacity:
+		return fmt.Errorf("invalid rate limiter state: bucket %s has %d tokens outside [0, %d]", key, b.Tokens, b.Capacity)
+	case b.LastRefill.IsZero():
+		return fmt.Errorf("invalid rate limiter state: bucket %s has no last refill time", key)
+	}
+	return nil
+}
+
+func (w WindowState) validate(key string) error {
+	switch {
+	case key == "":
+		return fmt.Errorf("invalid rate limiter state: empty window key")
+	case w.Limit < 0 || w.Count < 0:
+		return fmt.Errorf("invalid rate limiter state: window %s has negative counts", key)
+	case w.Window <= 0:
+		return fmt.Errorf("invalid rate limiter state: window %s has non-positive length", key)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package ratelimiter
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// UsageStore is a shared store counting the requests each bucket admitted
+// across gateway instances, e.g. Redis INCRBY on a key per bucket. Writes
+// are batched: IncrBy receives the admitted requests per bucket key since
+// the last write.
+type UsageStore interface {
+	IncrBy(ctx context.Context, counts map[string]int64) error
+}
+
+// SetUsageStore makes the limiter write the usage it admits to a shared
+// store in batches every flush_interval. Limits are always enforced by the
+// local buckets, so a slow or unavailable store never admits extra requests.
+func (rl *RateLimiter) SetUsageStore(store UsageStore) {
+	rl.usageMu.Lock()
+	defer rl.usageMu.Unlock()
+	rl.store = store
+}
+
+// recordUsage queues an admitted request for the next batch
+func (rl *RateLimiter) recordUsage(bucketKey string) {
+	rl.usageMu.Lock()
+	defer rl.usageMu.Unlock()
+	if rl.store == nil {
+		return
+	}
+	if rl.pending == nil {
+		rl.pending = make(map[string]int64)
+	}
+	rl.pending[bucketKey]++
+}
+
+// pendingWrites returns the admitted requests not yet written to the store
+func (rl *RateLimiter) pendingWrites() int64 {
+	rl.usageMu.Lock()
+	defer rl.usageMu.Unlock()
+	var total int64
+	for _, count := range rl.pending {
+		total += count
+	}
+	return total
+}
+
+// startFlushing writes batches to the usage store until stopFlushing
+func (rl *RateLimiter) startFlushing(interval time.Duration) {
+	rl.usageMu.Lock()
+	defer rl.usageMu.Unlock()
+	if rl.store == nil || rl.stopFlush != nil {
+		return
+	}
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	rl.stopFlush, rl.flushDone = stop, done
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), interval)
+				if err := rl.flushUsage(ctx); err != nil {
+					rl.logger.Warnf("Failed to write rate limiter usage, retrying next flush: %v", err)
+				}
+				cancel()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// stopFlushing stops periodic writes, waiting for one in progress
+func (rl *RateLimiter) stopFlushing() {
+	rl.usageMu.Lock()
+	stop, done := rl.stopFlush, rl.flushDone
+	rl.stopFlush, rl.flushDone = nil, nil
+	rl.usageMu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// flushUsage writes the pending batch to the usage store. A failed batch is
+// merged back into the pending counts so no admitted request goes uncounted.
+func (rl *RateLimiter) flushUsage(ctx context.Context) error {
+	rl.usageMu.Lock()
+	store, batch := rl.store, rl.pending
+	rl.pending = nil
+	rl.usageMu.Unlock()
+
+	if store == nil || len(batch) == 0 {
+		return nil
+	}
+	if err := store.IncrBy(ctx, batch); err != nil {
+		rl.usageMu.Lock()
+		if rl.pending == nil {
+			rl.pending = make(map[string]int64, len(batch))
+		}
+		for key, count := range batch {
+			rl.pending[key] += count
+		}
+		rl.usageMu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// drainUsage writes every pending batch before shutdown, giving up at the
+// drain timeout or the context's deadline, whichever is first
+func (rl *RateLimiter) drainUsage(ctx context.Context) error {
+	rl.stopFlushing()
+
+	ctx, cancel := context.WithTimeout(ctx, rl.config.DrainTimeout)
+	defer cancel()
+	if err := rl.flushUsage(ctx); err != nil {
+		return fmt.Errorf("rate limiter lost %d uncounted requests on shutdown: %w", rl.pendingWrites(), err)
+	}
+	return nil
+}
@@ -0,0 +1,298 @@
+package redactionaudit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/core/contentfilter"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/tenants"
+	"go.uber.org/zap"
+)
+
+// RedactionAuditor implements a sink writing a compliance trail of content
+// redactions. Records carry the rule, location and hash of what was redacted,
+// never the redacted text.
+type RedactionAuditor struct {
+	name        string
+	version     string
+	description string
+	author      string
+	config      *RedactionAuditConfig
+	logger      *zap.SugaredLogger
+	status      *interfaces.ModuleStatus
+	startTime   time.Time
+	mu          sync.Mutex
+	output      io.Writer
+	file        *os.File
+	anonymizer  *tenants.Anonymizer
+	written     int64
+}
+
+// RedactionAuditConfig represents redaction audit configuration
+type RedactionAuditConfig struct {
+	Path string `yaml:"path" json:"path"` // JSON lines file the trail is appended to; stdout when empty
+}
+
+// Record is one redaction in the audit trail, written as one JSON line
+type Record struct {
+	Timestamp time.Time `json:"timestamp"`
+	RequestID string    `json:"request_id"`
+	TenantID  string    `json:"tenant_id"` // pseudonym when tenant anonymization is enabled
+	Phase     string    `json:"phase"`     // request or response
+	contentfilter.Redaction
+}
+
+// NewRedactionAuditor creates a new redaction audit module
+func NewRedactionAuditor(logger *zap.SugaredLogger) *RedactionAuditor {
+	return &RedactionAuditor{
+		name:        "redaction-audit",
+		version:     "1.0.0",
+		description: "Audit trail of content redactions without the redacted values",
+		author:      "Leash Security",
+		logger:      logger,
+		status: &interfaces.ModuleStatus{
+			State:             interfaces.ModuleStateReady,
+			RequestsProcessed: 0,
+			ErrorCount:        0,
+		},
+	}
+}
+
+// SetOutput makes records be written to w instead of the configured path
+func (r *RedactionAuditor) SetOutput(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.output = w
+}
+
+// SetTenantAnonymizer makes records carry tenant pseudonyms instead of
+// tenant IDs
+func (r *RedactionAuditor) SetTenantAnonymizer(anonymizer *tenants.Anonymizer) {
+	r.anonymizer = anonymizer
+}
+
+// Metadata methods
+func (r *RedactionAuditor) Name() string                { return r.name }
+func (r *RedactionAuditor) Version() string             { return r.version }
+func (r *RedactionAuditor) Type() interfaces.ModuleType { return interfaces.ModuleTypeSink }
+func (r *RedactionAuditor) Description() string         { return r.description }
+func (r *RedactionAuditor) Author() string              { return r.author }
+func (r *RedactionAuditor) Dependencies() []string      { return []string{} }
+
+// Lifecycle methods
+func (r *RedactionAuditor) Initialize(ctx context.Context, config *interfaces.ModuleConfig) error {
+	r.logger.Infof("Initializing redaction audit module")
+
+	auditConfig := &RedactionAuditConfig{}
+	if config != nil && config.Config != nil {
+		if path, ok := config.Config["path"].(string); ok {
+			auditConfig.Path = path
+		}
+	}
+
+	r.mu.Lock()
+	r.config = auditConfig
+	r.mu.Unlock()
+
+	r.startTime = time.Now()
+	r.status.State = interfaces.ModuleStateReady
+
+	r.logger.Infof("Redaction audit module initialized with path=%q", auditConfig.Path)
+	return nil
+}
+
+func (r *RedactionAuditor) Start(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.output == nil {
+		if r.config.Path == "" {
+			r.output = os.Stdout
+		} else {
+			file, err := os.OpenFile(r.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+			if err != nil {
+				return fmt.Errorf("failed to open redaction audit file: %w", err)
+			}
+			r.file = file
+			r.output = file
+		}
+	}
+
+	r.status.State = interfaces.ModuleStateRunning
+	r.status.StartTime = time.Now()
+	r.logger.Infof("Redaction audit module started")
+	return nil
+}
+
+func (r *RedactionAuditor) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.status.State = interfaces.ModuleStateDraining
+	r.logger.Infof("Redaction audit module stopping")
+	return nil
+}
+
+func (r *RedactionAuditor) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file != nil {
+		if err := r.file.Close(); err != nil {
+			r.logger.Warnf("Failed to close redaction audit file: %v", err)
+		}
+		r.file = nil
+		r.output = nil
+	}
+
+	r.status.State = interfaces.ModuleStateStopped
+	r.logger.Infof("Redaction audit module shutdown")
+	return nil
+}
+
+// Health and status methods
+func (r *RedactionAuditor) Health(ctx context.Context) (*interfaces.HealthStatus, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return &interfaces.HealthStatus{
+		Status:        interfaces.HealthStateHealthy,
+		Message:       "Redaction audit module is healthy",
+		LastCheck:     time.Now(),
+		CheckDuration: time.Millisecond,
+		Details: map[string]interface{}{
+			"records_written": r.written,
+			"path":            r.config.Path,
+		},
+	}, nil
+}
+
+func (r *RedactionAuditor) Status() *interfaces.ModuleStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	status := *r.status
+	status.LastActivity = time.Now()
+	return &status
+}
+
+func (r *RedactionAuditor) Metrics() map[string]interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return map[string]interface{}{
+		"requests_processed": r.status.RequestsProcessed,
+		"errors":             r.status.ErrorCount,
+		"records_written":    r.written,
+		"uptime_seconds":     time.Since(r.startTime).Seconds(),
+	}
+}
+
+// Processing methods
+func (r *RedactionAuditor) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequestContext) (*interfaces.ProcessRequestResult, error) {
+	start := time.Now()
+
+	redactions, _ := req.Annotations[contentfilter.RedactionAuditAnnotation].([]contentfilter.Redaction)
+	r.write(req, "request", redactions)
+
+	return &interfaces.ProcessRequestResult{
+		Action:         interfaces.ActionContinue,
+		ProcessingTime: time.Since(start),
+	}, nil
+}
+
+func (r *RedactionAuditor) ProcessResponse(ctx context.Context, resp *interfaces.ProcessResponseContext) (*interfaces.ProcessResponseResult, error) {
+	start := time.Now()
+
+	redactions, _ := resp.Annotations[contentfilter.ResponseRedactionAuditAnnotation].([]contentfilter.Redaction)
+	r.write(resp.ProcessRequestContext, "response", redactions)
+
+	return &interfaces.ProcessResponseResult{
+		Action:         interfaces.ActionContinue,
+		ProcessingTime: time.Since(start),
+	}, nil
+}
+
+// Configuration methods
+func (r *RedactionAuditor) ValidateConfig(config *interfaces.ModuleConfig) error {
+	if config == nil {
+		return fmt.Errorf("config cannot be nil")
+	}
+
+	if configMap := config.Config; configMap != nil {
+		if path, ok := configMap["path"]; ok {
+			if _, isString := path.(string); !isString {
+				return fmt.Errorf("path must be a string")
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *RedactionAuditor) UpdateConfig(ctx context.Context, config *interfaces.ModuleConfig) error {
+	if err := r.ValidateConfig(config); err != nil {
+		return err
+	}
+
+	return r.Initialize(ctx, config)
+}
+
+func (r *RedactionAuditor) GetConfig() *interfaces.ModuleConfig {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return &interfaces.ModuleConfig{
+		Name:     r.name,
+		Type:     r.Type().String(),
+		Enabled:  r.status.State == interfaces.ModuleStateRunning,
+		Priority: 950, // Runs alongside other sinks near the end
+		Config: map[string]interface{}{
+			"path": r.config.Path,
+		},
+	}
+}
+
+// write appends a record for each redaction of a request or response
+func (r *RedactionAuditor) write(req *interfaces.ProcessRequestContext, phase string, redactions []contentfilter.Redaction) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.status.RequestsProcessed++
+	r.status.LastActivity = time.Now()
+	if len(redactions) == 0 {
+		return
+	}
+
+	tenantID := r.anonymizer.TenantID(req.TenantID)
+	now := time.Now()
+	if r.output == nil {
+		r.logger.Warnf("Dropping %d redaction audit records for request %s: module not started", len(redactions), req.RequestID)
+		r.status.ErrorCount++
+		return
+	}
+	for _, redaction := range redactions {
+		line, err := json.Marshal(Record{
+			Timestamp: now,
+			RequestID: req.RequestID,
+			TenantID:  tenantID,
+			Phase:     phase,
+			Redaction: redaction,
+		})
+		if err == nil {
+			_, err = r.output.Write(append(line, '\n'))
+		}
+		if err != nil {
+			r.logger.Warnf("Failed to write redaction audit record for request %s: %v", req.RequestID, err)
+			r.status.ErrorCount++
+			continue
+		}
+		r.written++
+	}
+}
@@ -0,0 +1,270 @@
+package requestvalidator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"go.uber.org/zap"
+)
+
+// RequestValidator implements a policy rejecting malformed request bodies
+type RequestValidator struct {
+	name        string
+	version     string
+	description string
+	author      string
+	config      *RequestValidatorConfig
+	logger      *zap.SugaredLogger
+	status      *interfaces.ModuleStatus
+	startTime   time.Time
+}
+
+// RequestValidatorConfig represents request validator configuration
+type RequestValidatorConfig struct {
+	StrictJSON       bool `yaml:"strict_json" json:"strict_json"`             // Block bodies declared as JSON that fail to parse
+	SchemaValidation bool `yaml:"schema_validation" json:"schema_validation"` // Block requests that do not match the target provider's schema
+}
+
+// NewRequestValidator creates a new request validator module
+func NewRequestValidator(logger *zap.SugaredLogger) *RequestValidator {
+	return &RequestValidator{
+		name:        "request-validator",
+		version:     "1.0.0",
+		description: "Rejects requests whose body does not match its declared content type or provider schema",
+		author:      "Leash Security",
+		logger:      logger,
+		status: &interfaces.ModuleStatus{
+			State:             interfaces.ModuleStateReady,
+			RequestsProcessed: 0,
+			ErrorCount:        0,
+		},
+	}
+}
+
+// Metadata methods
+func (rv *RequestValidator) Name() string                { return rv.name }
+func (rv *RequestValidator) Version() string             { return rv.version }
+func (rv *RequestValidator) Type() interfaces.ModuleType { return interfaces.ModuleTypePolicy }
+func (rv *RequestValidator) Description() string         { return rv.description }
+func (rv *RequestValidator) Author() string              { return rv.author }
+func (rv *RequestValidator) Dependencies() []string      { return []string{} }
+
+// Lifecycle methods
+func (rv *RequestValidator) Initialize(ctx context.Context, config *interfaces.ModuleConfig) error {
+	rv.logger.Infof("Initializing request validator module")
+
+	validatorConfig := &RequestValidatorConfig{
+		StrictJSON:       false,
+		SchemaValidation: false,
+	}
+
+	// Override with provided config
+	if config != nil && config.Config != nil {
+		if strictJSON, ok := config.Config["strict_json"].(bool); ok {
+			validatorConfig.StrictJSON = strictJSON
+		}
+		if schemaValidation, ok := config.Config["schema_validation"].(bool); ok {
+			validatorConfig.SchemaValidation = schemaValidation
+		}
+	}
+
+	rv.config = validatorConfig
+	rv.startTime = time.Now()
+	rv.status.State = interfaces.ModuleStateReady
+
+	rv.logger.Infof("Request validator initialized with strict_json=%t, schema_validation=%t", validatorConfig.StrictJSON, validatorConfig.SchemaValidation)
+	return nil
+}
+
+func (rv *RequestValidator) Start(ctx context.Context) error {
+	rv.status.State = interfaces.ModuleStateRunning
+	rv.status.StartTime = time.Now()
+	rv.logger.Infof("Request validator module started")
+	return nil
+}
+
+func (rv *RequestValidator) Stop(ctx context.Context) error {
+	rv.status.State = interfaces.ModuleStateDraining
+	rv.logger.Infof("Request validator module stopping")
+	return nil
+}
+
+func (rv *RequestValidator) Shutdown(ctx context.Context) error {
+	rv.status.State = interfaces.ModuleStateStopped
+	rv.logger.Infof("Request validator module shutdown")
+	return nil
+}
+
+// Health and status methods
+func (rv *RequestValidator) Health(ctx context.Context) (*interfaces.HealthStatus, error) {
+	return &interfaces.HealthStatus{
+		Status:        interfaces.HealthStateHealthy,
+		Message:       "Request validator is healthy",
+		LastCheck:     time.Now(),
+		CheckDuration: time.Millisecond,
+		Details: map[string]interface{}{
+			"strict_json":       rv.config.StrictJSON,
+			"schema_validation": rv.config.SchemaValidation,
+		},
+	}, nil
+}
+
+func (rv *RequestValidator) Status() *interfaces.ModuleStatus {
+	status := *rv.status
+	status.LastActivity = time.Now()
+	return &status
+}
+
+func (rv *RequestValidator) Metrics() map[string]interface{} {
+	return map[string]interface{}{
+		"requests_processed": rv.status.RequestsProcessed,
+		"errors":             rv.status.ErrorCount,
+		"uptime_seconds":     time.Since(rv.startTime).Seconds(),
+	}
+}
+
+// Processing methods
+func (rv *RequestValidator) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequestContext) (*interfaces.ProcessRequestResult, error) {
+	start := time.Now()
+	rv.status.RequestsProcessed++
+	rv.status.LastActivity = time.Now()
+
+	if rv.config.SchemaValidation {
+		if result := rv.validateSchema(req, start); result != nil {
+			return result, nil
+		}
+	}
+
+	if !rv.config.StrictJSON || len(req.Body) == 0 || !declaresJSON(req.Headers) {
+		return &interfaces.ProcessRequestResult{
+			Action:         interfaces.ActionContinue,
+			ProcessingTime: time.Since(start),
+		}, nil
+	}
+
+	var parsed interface{}
+	err := json.Unmarshal(req.Body, &parsed)
+	if err == nil {
+		return &interfaces.ProcessRequestResult{
+			Action:         interfaces.ActionContinue,
+			ProcessingTime: time.Since(start),
+		}, nil
+	}
+
+	reason := fmt.Sprintf("malformed JSON request body: %v", err)
+	rv.logger.Warnf("Blocking request %s: %s", req.RequestID, reason)
+
+	return &interfaces.ProcessRequestResult{
+		Action:         interfaces.ActionBlock,
+		BlockReason:    reason,
+		ProcessingTime: time.Since(start),
+		Annotations: map[string]interface{}{
+			"malformed_json": true,
+		},
+		Metadata: map[string]string{
+			"status_code": strconv.Itoa(http.StatusBadRequest),
+		},
+	}, nil
+}
+
+// validateSchema blocks a request whose body does not match the schema of
+// the provider endpoint it targets, or returns nil to let it continue.
+// Bodies that are not JSON are left to strict_json.
+func (rv *RequestValidator) validateSchema(req *interfaces.ProcessRequestContext, start time.Time) *interfaces.ProcessRequestResult {
+	target := schemaFor(req)
+	if target == nil || len(req.Body) == 0 || !json.Valid(req.Body) {
+		return nil
+	}
+
+	violations := target.validate(req.Body)
+	if len(violations) == 0 {
+		return nil
+	}
+
+	reason := schemaBlockReason(target, violations)
+	rv.logger.Warnf("Blocking request %s: %s", req.RequestID, reason)
+
+	return &interfaces.ProcessRequestResult{
+		Action:         interfaces.ActionBlock,
+		BlockReason:    reason,
+		ProcessingTime: time.Since(start),
+		Annotations: map[string]interface{}{
+			"schema_invalid":    true,
+			"schema":            target.name,
+			"schema_violations": violations,
+		},
+		Metadata: map[string]string{
+			"status_code": strconv.Itoa(http.StatusBadRequest),
+		},
+	}
+}
+
+func (rv *RequestValidator) ProcessResponse(ctx context.Context, resp *interfaces.ProcessResponseContext) (*interfaces.ProcessResponseResult, error) {
+	// Request validator doesn't need to process responses
+	return &interfaces.ProcessResponseResult{
+		Action: interfaces.ActionContinue,
+	}, nil
+}
+
+// Configuration methods
+func (rv *RequestValidator) ValidateConfig(config *interfaces.ModuleConfig) error {
+	if config == nil {
+		return fmt.Errorf("config cannot be nil")
+	}
+
+	if configMap := config.Config; configMap != nil {
+		for _, key := range []string{"strict_json", "schema_validation"} {
+			if value, exists := configMap[key]; exists {
+				if _, ok := value.(bool); !ok {
+					return fmt.Errorf("%s must be a boolean, got %T", key, value)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (rv *RequestValidator) UpdateConfig(ctx context.Context, config *interfaces.ModuleConfig) error {
+	if err := rv.ValidateConfig(config); err != nil {
+		return err
+	}
+
+	return rv.Initialize(ctx, config)
+}
+
+func (rv *RequestValidator) GetConfig() *interfaces.ModuleConfig {
+	return &interfaces.ModuleConfig{
+		Name:     rv.name,
+		Type:     rv.Type().String(),
+		Enabled:  rv.status.State == interfaces.ModuleStateRunning,
+		Priority: 150, // After rate limiting, before any module that parses the body
+		Config: map[string]interface{}{
+			"strict_json":       rv.config.StrictJSON,
+			"schema_validation": rv.config.SchemaValidation,
+		},
+	}
+}
+
+// declaresJSON reports whether the Content-Type header names a JSON media
+// type (application/json or a +json suffix)
+func declaresJSON(headers map[string]string) bool {
+	for key, value := range headers {
+		if !strings.EqualFold(key, "Content-Type") {
+			continue
+		}
+		mediaType, _, err := mime.ParseMediaType(value)
+		if err != nil {
+			return false
+		}
+		return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+package requestvalidator
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+)
+
+// maxReportedViolations caps the violations listed in a block reason
+const maxReportedViolations = 5
+
+// schema is the request body a provider endpoint expects
+type schema struct {
+	name     string
+	required []string              // top-level fields that must be present
+	messages string                // field holding the role-tagged message list, if any
+	input    string                // field holding a string or list input, if any
+	roles    map[string]bool       // valid message roles
+	ranges   map[string]paramRange // numeric parameter bounds
+}
+
+// paramRange bounds a numeric parameter; integer parameters must be whole
+type paramRange struct {
+	min, max float64
+	integer  bool
+}
+
+var (
+	openAIChatSchema = &schema{
+		name:     "openai chat completions",
+		required: []string{"model", "messages"},
+		messages: "messages",
+		roles: map[string]bool{
+			"system": true, "developer": true, "user": true, "assistant": true, "tool": true, "function": true,
+		},
+		ranges: map[string]paramRange{
+			"temperature":           {min: 0, max: 2},
+			"top_p":                 {min: 0, max: 1},
+			"n":                     {min: 1, max: 128, integer: true},
+			"max_tokens":            {min: 1, max: math.MaxInt32, integer: true},
+			"max_completion_tokens": {min: 1, max: math.MaxInt32, integer: true},
+			"presence_penalty":      {min: -2, max: 2},
+			"frequency_penalty":     {min: -2, max: 2},
+			"top_logprobs":          {min: 0, max: 20, integer: true},
+		},
+	}
+
+	openAIResponsesSchema = &schema{
+		name:     "openai responses",
+		required: []string{"model", "input"},
+		input:    "input",
+		ranges: map[string]paramRange{
+			"temperature":       {min: 0, max: 2},
+			"top_p":             {min: 0, max: 1},
+			"max_output_tokens": {min: 1, max: math.MaxInt32, integer: true},
+		},
+	}
+
+	anthropicMessagesSchema = &schema{
+		name:     "anthropic messages",
+		required: []string{"model", "messages", "max_tokens"},
+		messages: "messages",
+		roles:    map[string]bool{"user": true, "assistant": true},
+		ranges: map[string]paramRange{
+			"temperature": {min: 0, max: 1},
+			"top_p":       {min: 0, max: 1},
+			"top_k":       {min: 0, max: math.MaxInt32, integer: true},
+			"max_tokens":  {min: 1, max: math.MaxInt32, integer: true},
+		},
+	}
+)
+
+// schemaFor returns the schema of the endpoint a request targets: by path
+// when it names a generation endpoint, otherwise by provider. Requests to
+// other endpoints (models, embeddings) have none.
+func schemaFor(req *interfaces.ProcessRequestContext) *schema {
+	path := strings.TrimSuffix(req.Path, "/")
+	switch {
+	case strings.HasSuffix(path, "/chat/completions"):
+		return openAIChatSchema
+	case strings.HasSuffix(path, "/responses"):
+		return openAIResponsesSchema
+	case strings.HasSuffix(path, "/messages"):
+		return anthropicMessagesSchema
+	case path != "":
+		return nil
+	}
+	if req.Provider == "anthropic" {
+		return anthropicMessagesSchema
+	}
+	return openAIChatSchema
+}
+
+// validate returns the ways a request body violates the schema, or nil when
+// it conforms
+func (s *schema) validate(body []byte) []string {
+	var request map[string]interface{}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return []string{"request body must be a JSON object"}
+	}
+
+	var violations []string
+	for _, field := range s.required {
+		if value, ok := request[field]; !ok || value == nil {
+			violations = append(violations, fmt.Sprintf("%s is required", field))
+		}
+	}
+	if model, ok := request["model"]; ok && model != nil {
+		if name, isString := model.(string); !isString || name == "" {
+			violations = append(violations, "model must be a non-empty string")
+		}
+	}
+	if s.input != "" {
+		switch request[s.input].(type) {
+		case nil, string, []interface{}:
+		default:
+			violations = append(violations, fmt.Sprintf("%s must be a string or a list", s.input))
+		}
+	}
+	if s.messages != "" {
+		if raw, ok := request[s.messages]; ok && raw != nil {
+			violations = append(violations, s.validateMessages(raw)...)
+		}
+	}
+	for _, field := range sortedKeys(s.ranges) {
+		raw, ok := request[field]
+		if !ok || raw == nil {
+			continue
+		}
+		bounds := s.ranges[field]
+		value, isNumber := raw.(float64)
+		switch {
+		case !isNumber:
+			violations = append(violations, fmt.Sprintf("%s must be a number", field))
+		case bounds.integer && value != math.Trunc(value):
+			violations = append(violations, fmt.Sprintf("%s must be an integer", field))
+		case value < bounds.min || value > bounds.max:
+			violations = append(violations, fmt.Sprintf("%s must be between %s and %s, got %s", field, formatBound(bounds.min), formatBound(bounds.max), formatBound(value)))
+		}
+	}
+	return violations
+}
+
+// validateMessages checks the message list is non-empty and every message is
+// an object with a valid role
+func (s *schema) validateMessages(raw interface{}) []string {
+	messages, ok := raw.([]interface{})
+	if !ok {
+		return []string{fmt.Sprintf("%s must be a list", s.messages)}
+	}
+	if len(messages) == 0 {
+		return []string{fmt.Sprintf("%s must not be empty", s.messages)}
+	}
+
+	var violations []string
+	for i, item := range messages {
+		message, ok := item.(map[string]interface{})
+		if !ok {
+			violations = append(violations, fmt.Sprintf("%s[%d] must be an object", s.messages, i))
+			continue
+		}
+		role, _ := message["role"].(string)
+		switch {
+		case role == "":
+			violations = append(violations, fmt.Sprintf("%s[%d].role is required", s.messages, i))
+		case !s.roles[role]:
+			violations = append(violations, fmt.Sprintf("%s[%d].role %q is not one of %s", s.messages, i, role, strings.Join(sortedKeys(s.roles), ", ")))
+		}
+	}
+	return violations
+}
+
+// schemaBlockReason describes a request's violations for the client
+func schemaBlockReason(s *schema, violations []string) string {
+	reported := violations
+	if len(reported) > maxReportedViolations {
+		reported = reported[:maxReportedViolations]
+	}
+	reason := fmt.Sprintf("invalid %s request: %s", s.name, strings.Join(reported, "; "))
+	if more := len(violations) - len(reported); more > 0 {
+		reason += fmt.Sprintf(" (and %d more)", more)
+	}
+	return reason
+}
+
+// sortedKeys returns a map's keys in order, so violations are reported
+// deterministically
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatBound formats a bound without trailing zeros
+func formatBound(value float64) string {
+	return fmt.Sprintf("%g", value)
+}
@@ -0,0 +1,133 @@
+package sanitizer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// report records what sanitizing a request changed
+type report struct {
+	controlChars int
+	truncated    []string // paths of truncated fields
+}
+
+func (r *report) changed() bool {
+	return r.controlChars > 0 || len(r.truncated) > 0
+}
+
+// sanitizeValue sanitizes the strings in a decoded JSON value at path
+func (s *Sanitizer) sanitizeValue(value interface{}, path []string, r *report) interface{} {
+	switch v := value.(type) {
+	case string:
+		sanitized := s.sanitizeText(v, r)
+		if limit := s.limitFor(path); limit > 0 && len(sanitized) > limit {
+			sanitized = truncate(sanitized, limit)
+			r.truncated = append(r.truncated, strings.Join(path, "."))
+		}
+		return sanitized
+	case map[string]interface{}:
+		sanitized := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			sanitized[s.sanitizeText(key, r)] = s.sanitizeValue(child, append(path[:len(path):len(path)], key), r)
+		}
+		return sanitized
+	case []interface{}:
+		for i, child := range v {
+			v[i] = s.sanitizeValue(child, append(path[:len(path):len(path)], strconv.Itoa(i)), r)
+		}
+		return v
+	default:
+		return value
+	}
+}
+
+// sanitizeText strips or escapes the control characters in text. Tabs,
+// newlines and carriage returns are kept.
+func (s *Sanitizer) sanitizeText(text string, r *report) string {
+	if strings.IndexFunc(text, isControl) < 0 {
+		return text
+	}
+
+	var b strings.Builder
+	b.Grow(len(text))
+	for _, c := range text {
+		if !isControl(c) {
+			b.WriteRune(c)
+			continue
+		}
+		r.controlChars++
+		if s.config.ControlChars == ControlEscape {
+			fmt.Fprintf(&b, `\u%04x`, c)
+		}
+	}
+	return b.String()
+}
+
+// isControl reports whether c is a C0 or C1 control character, or DEL, other
+// than the whitespace characters that are part of normal text
+func isControl(c rune) bool {
+	switch {
+	case c == '\t' || c == '\n' || c == '\r':
+		return false
+	case c < 0x20 || c == 0x7f:
+		return true
+	default:
+		return c >= 0x80 && c <= 0x9f
+	}
+}
+
+// limitFor returns the byte cap of the field at path: the most specific
+// matching field limit, or max_field_bytes. 0 leaves the field uncapped.
+func (s *Sanitizer) limitFor(path []string) int {
+	limit, wildcards := s.config.MaxFieldBytes, len(path)+1
+	for pattern, patternLimit := range s.config.FieldLimits {
+		if n, ok := matchPath(pattern, path); ok && (n < wildcards || n == wildcards && patternLimit < limit) {
+			limit, wildcards = patternLimit, n
+		}
+	}
+	return limit
+}
+
+// matchPath matches a dot-separated pattern against path, * matching any one
+// key or index, and returns how many wildcards it used
+func matchPath(pattern string, path []string) (int, bool) {
+	segments := strings.Split(pattern, ".")
+	if len(segments) != len(path) {
+		return 0, false
+	}
+	wildcards := 0
+	for i, segment := range segments {
+		switch segment {
+		case "*":
+			wildcards++
+		case path[i]:
+		default:
+			return 0, false
+		}
+	}
+	return wildcards, true
+}
+
+// truncate cuts text to at most limit bytes without splitting a character
+func truncate(text string, limit int) string {
+	for limit > 0 && !utf8.RuneStart(text[limit]) {
+		limit--
+	}
+	return text[:limit]
+}
+
+// encode marshals a sanitized body without escaping HTML characters, which
+// prompts often contain
+func encode(document interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(document); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
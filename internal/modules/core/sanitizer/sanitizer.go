@@ -0,0 +1,280 @@
+package sanitizer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"go.uber.org/zap"
+)
+
+// Control character handling
+const (
+	ControlStrip  = "strip"  // remove control characters
+	ControlEscape = "escape" // replace them with a visible \uXXXX escape
+)
+
+// Sanitizer implements a transformer removing control characters from, and
+// capping the size of, the string fields of request bodies
+type Sanitizer struct {
+	name        string
+	version     string
+	description string
+	author      string
+	config      *SanitizerConfig
+	logger      *zap.SugaredLogger
+	status      *interfaces.ModuleStatus
+	startTime   time.Time
+}
+
+// SanitizerConfig represents request sanitization configuration
+type SanitizerConfig struct {
+	ControlChars  string         `yaml:"control_chars" json:"control_chars"`     // strip, escape
+	MaxFieldBytes int            `yaml:"max_field_bytes" json:"max_field_bytes"` // cap on every string field; 0 disables
+	FieldLimits   map[string]int `yaml:"field_limits" json:"field_limits"`       // caps by dot-separated path, * matching any key or index
+}
+
+// NewSanitizer creates a new request sanitization module
+func NewSanitizer(logger *zap.SugaredLogger) *Sanitizer {
+	return &Sanitizer{
+		name:        "request-sanitizer",
+		version:     "1.0.0",
+		description: "Removes control characters from and caps the size of request body fields",
+		author:      "Leash Security",
+		logger:      logger,
+		status: &interfaces.ModuleStatus{
+			State:             interfaces.ModuleStateReady,
+			RequestsProcessed: 0,
+			ErrorCount:        0,
+		},
+	}
+}
+
+// Metadata methods
+func (s *Sanitizer) Name() string                { return s.name }
+func (s *Sanitizer) Version() string             { return s.version }
+func (s *Sanitizer) Type() interfaces.ModuleType { return interfaces.ModuleTypeTransformer }
+func (s *Sanitizer) Description() string         { return s.description }
+func (s *Sanitizer) Author() string              { return s.author }
+func (s *Sanitizer) Dependencies() []string      { return []string{} }
+
+// Lifecycle methods
+func (s *Sanitizer) Initialize(ctx context.Context, config *interfaces.ModuleConfig) error {
+	s.logger.Infof("Initializing request sanitizer module")
+
+	sanitizerConfig := &SanitizerConfig{
+		ControlChars:  ControlStrip,
+		MaxFieldBytes: 1 << 20,
+	}
+
+	// Override with provided config
+	if config != nil && config.Config != nil {
+		if controlChars, ok := config.Config["control_chars"].(string); ok {
+			sanitizerConfig.ControlChars = controlChars
+		}
+		if maxFieldBytes, ok := config.Config["max_field_bytes"].(int); ok {
+			sanitizerConfig.MaxFieldBytes = maxFieldBytes
+		}
+		if rawLimits, ok := config.Config["field_limits"]; ok {
+			limits, err := parseFieldLimits(rawLimits)
+			if err != nil {
+				return err
+			}
+			sanitizerConfig.FieldLimits = limits
+		}
+	}
+	if sanitizerConfig.ControlChars != ControlStrip && sanitizerConfig.ControlChars != ControlEscape {
+		return fmt.Errorf("unsupported control_chars handling: %s", sanitizerConfig.ControlChars)
+	}
+
+	s.config = sanitizerConfig
+	s.startTime = time.Now()
+	s.status.State = interfaces.ModuleStateReady
+
+	s.logger.Infof("Request sanitizer initialized with control_chars=%s, max_field_bytes=%d, %d field limits",
+		sanitizerConfig.ControlChars, sanitizerConfig.MaxFieldBytes, len(sanitizerConfig.FieldLimits))
+	return nil
+}
+
+func (s *Sanitizer) Start(ctx context.Context) error {
+	s.status.State = interfaces.ModuleStateRunning
+	s.status.StartTime = time.Now()
+	s.logger.Infof("Request sanitizer module started")
+	return nil
+}
+
+func (s *Sanitizer) Stop(ctx context.Context) error {
+	s.status.State = interfaces.ModuleStateDraining
+	s.logger.Infof("Request sanitizer module stopping")
+	return nil
+}
+
+func (s *Sanitizer) Shutdown(ctx context.Context) error {
+	s.status.State = interfaces.ModuleStateStopped
+	s.logger.Infof("Request sanitizer module shutdown")
+	return nil
+}
+
+// Health and status methods
+func (s *Sanitizer) Health(ctx context.Context) (*interfaces.HealthStatus, error) {
+	return &interfaces.HealthStatus{
+		Status:        interfaces.HealthStateHealthy,
+		Message:       "Request sanitizer is healthy",
+		LastCheck:     time.Now(),
+		CheckDuration: time.Millisecond,
+		Details: map[string]interface{}{
+			"control_chars": s.config.ControlChars,
+		},
+	}, nil
+}
+
+func (s *Sanitizer) Status() *interfaces.ModuleStatus {
+	status := *s.status
+	status.LastActivity = time.Now()
+	return &status
+}
+
+func (s *Sanitizer) Metrics() map[string]interface{} {
+	return map[string]interface{}{
+		"requests_processed": s.status.RequestsProcessed,
+		"errors":             s.status.ErrorCount,
+		"uptime_seconds":     time.Since(s.startTime).Seconds(),
+	}
+}
+
+// Processing methods
+
+// ProcessRequest sanitizes every string in a JSON request body, object keys
+// included. Bodies that are not JSON have their control characters handled
+// as a whole but no field caps. Bodies needing no change are left untouched.
+func (s *Sanitizer) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequestContext) (*interfaces.ProcessRequestResult, error) {
+	start := time.Now()
+	s.status.RequestsProcessed++
+	s.status.LastActivity = time.Now()
+
+	if len(req.Body) == 0 {
+		return &interfaces.ProcessRequestResult{
+			Action:         interfaces.ActionContinue,
+			ProcessingTime: time.Since(start),
+		}, nil
+	}
+
+	report := &report{}
+	var body []byte
+	var document interface{}
+	decoder := json.NewDecoder(bytes.NewReader(req.Body))
+	decoder.UseNumber()
+	if decoder.Decode(&document) == nil && !decoder.More() {
+		document = s.sanitizeValue(document, nil, report)
+		if report.changed() {
+			var err error
+			if body, err = encode(document); err != nil {
+				s.status.ErrorCount++
+				return nil, fmt.Errorf("failed to encode sanitized request: %w", err)
+			}
+		}
+	} else {
+		body = []byte(s.sanitizeText(string(req.Body), report))
+	}
+
+	if !report.changed() {
+		return &interfaces.ProcessRequestResult{
+			Action:         interfaces.ActionContinue,
+			ProcessingTime: time.Since(start),
+		}, nil
+	}
+
+	sort.Strings(report.truncated)
+	s.logger.Infof("Sanitized request %s: %d control characters, %d truncated fields",
+		req.RequestID, report.controlChars, len(report.truncated))
+
+	annotations := map[string]interface{}{
+		"request_sanitized":       true,
+		"sanitized_control_chars": report.controlChars,
+	}
+	if len(report.truncated) > 0 {
+		annotations["truncated_fields"] = report.truncated
+	}
+	return &interfaces.ProcessRequestResult{
+		Action:         interfaces.ActionTransform,
+		ModifiedBody:   body,
+		ProcessingTime: time.Since(start),
+		Annotations:    annotations,
+	}, nil
+}
+
+func (s *Sanitizer) ProcessResponse(ctx context.Context, resp *interfaces.ProcessResponseContext) (*interfaces.ProcessResponseResult, error) {
+	// Sanitization applies to the request
+	return &interfaces.ProcessResponseResult{
+		Action: interfaces.ActionContinue,
+	}, nil
+}
+
+// Configuration methods
+func (s *Sanitizer) ValidateConfig(config *interfaces.ModuleConfig) error {
+	if config == nil {
+		return fmt.Errorf("config cannot be nil")
+	}
+
+	if configMap := config.Config; configMap != nil {
+		if controlChars, ok := configMap["control_chars"].(string); ok {
+			if controlChars != ControlStrip && controlChars != ControlEscape {
+				return fmt.Errorf("unsupported control_chars handling: %s", controlChars)
+			}
+		}
+		if maxFieldBytes, ok := configMap["max_field_bytes"].(int); ok && maxFieldBytes < 0 {
+			return fmt.Errorf("max_field_bytes cannot be negative, got %d", maxFieldBytes)
+		}
+		if rawLimits, ok := configMap["field_limits"]; ok {
+			if _, err := parseFieldLimits(rawLimits); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *Sanitizer) UpdateConfig(ctx context.Context, config *interfaces.ModuleConfig) error {
+	if err := s.ValidateConfig(config); err != nil {
+		return err
+	}
+
+	return s.Initialize(ctx, config)
+}
+
+func (s *Sanitizer) GetConfig() *interfaces.ModuleConfig {
+	return &interfaces.ModuleConfig{
+		Name:     s.name,
+		Type:     s.Type().String(),
+		Enabled:  s.status.State == interfaces.ModuleStateRunning,
+		Priority: 450,
+		Config: map[string]interface{}{
+			"control_chars":   s.config.ControlChars,
+			"max_field_bytes": s.config.MaxFieldBytes,
+			"field_limits":    s.config.FieldLimits,
+		},
+	}
+}
+
+// parseFieldLimits parses the field_limits map of paths to byte caps
+func parseFieldLimits(raw interface{}) (map[string]int, error) {
+	rawMap, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("field_limits must be a map of field paths to byte limits")
+	}
+
+	limits := make(map[string]int, len(rawMap))
+	for path, value := range rawMap {
+		limit, ok := value.(int)
+		if !ok || limit < 0 {
+			return nil, fmt.Errorf("field_limits %s must be a non-negative integer, got %v", path, value)
+		}
+		limits[path] = limit
+	}
+	return limits, nil
+}
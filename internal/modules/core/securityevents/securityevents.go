@@ -0,0 +1,515 @@
+package securityevents
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/redact"
+	"github.com/bendiamant/leash-gateway/internal/tenants"
+	"go.uber.org/zap"
+)
+
+// Security event types
+const (
+	EventBlock = "block" // a module blocked the request
+	EventFlag  = "flag"  // a flag annotation was set but the request was let through
+)
+
+// SecurityEvents implements a sink keeping blocked and flagged requests for
+// security review: a bounded in-memory store of events with their redacted
+// request context and the deciding module, purged after a retention period
+// and queried through Handler.
+type SecurityEvents struct {
+	name        string
+	version     string
+	description string
+	author      string
+	config      *SecurityEventsConfig
+	logger      *zap.SugaredLogger
+	status      *interfaces.ModuleStatus
+	startTime   time.Time
+	anonymizer  *tenants.Anonymizer
+
+	mu      sync.Mutex
+	now     func() time.Time
+	events  []Event // oldest first
+	nextID  int64
+	evicted int64
+	purged  int64
+}
+
+// SecurityEventsConfig represents security event capture configuration
+type SecurityEventsConfig struct {
+	Events          []string               `yaml:"events" json:"events"`                     // block, flag
+	FlagAnnotations map[string]interface{} `yaml:"flag_annotations" json:"flag_annotations"` // annotation values that flag a request
+	MaxEvents       int                    `yaml:"max_events" json:"max_events"`             // the oldest event is evicted beyond this
+	Retention       time.Duration          `yaml:"retention" json:"retention"`
+	MaxBodyBytes    int                    `yaml:"max_body_bytes" json:"max_body_bytes"` // redacted body excerpt; 0 leaves bodies out
+}
+
+// Event is a blocked or flagged request kept for review
+type Event struct {
+	ID        int64             `json:"id"`
+	Type      string            `json:"type"` // block, flag
+	Timestamp time.Time         `json:"timestamp"`
+	RequestID string            `json:"request_id"`
+	TenantID  string            `json:"tenant_id"` // pseudonym when tenant anonymization is enabled
+	Provider  string            `json:"provider,omitempty"`
+	Model     string            `json:"model,omitempty"`
+	Method    string            `json:"method,omitempty"`
+	Path      string            `json:"path,omitempty"`
+	Module    string            `json:"module,omitempty"` // the module that blocked the request
+	Reason    string            `json:"reason,omitempty"`
+	Flags     []string          `json:"flags,omitempty"` // flag annotations the request carried
+	Headers   map[string]string `json:"headers,omitempty"`
+	Body      string            `json:"body,omitempty"`
+}
+
+// Query selects stored events; zero fields match every event
+type Query struct {
+	TenantID string
+	Type     string
+	Since    time.Time
+	Until    time.Time
+	Limit    int
+}
+
+// NewSecurityEvents creates a new security events module
+func NewSecurityEvents(logger *zap.SugaredLogger) *SecurityEvents {
+	return &SecurityEvents{
+		name:        "security-events",
+		version:     "1.0.0",
+		description: "Keeps blocked and flagged requests for security review",
+		author:      "Leash Security",
+		config:      defaultConfig(),
+		logger:      logger,
+		now:         time.Now,
+		status: &interfaces.ModuleStatus{
+			State:             interfaces.ModuleStateReady,
+			RequestsProcessed: 0,
+			ErrorCount:        0,
+		},
+	}
+}
+
+// SetTenantAnonymizer makes events carry tenant pseudonyms instead of tenant
+// IDs
+func (se *SecurityEvents) SetTenantAnonymizer(anonymizer *tenants.Anonymizer) {
+	se.anonymizer = anonymizer
+}
+
+// SetClock replaces the source of the current time, e.g. with a fixed clock
+// in tests
+func (se *SecurityEvents) SetClock(now func() time.Time) {
+	se.mu.Lock()
+	defer se.mu.Unlock()
+	se.now = now
+}
+
+// Metadata methods
+func (se *SecurityEvents) Name() string                { return se.name }
+func (se *SecurityEvents) Version() string             { return se.version }
+func (se *SecurityEvents) Type() interfaces.ModuleType { return interfaces.ModuleTypeSink }
+func (se *SecurityEvents) Description() string         { return se.description }
+func (se *SecurityEvents) Author() string              { return se.author }
+func (se *SecurityEvents) Dependencies() []string      { return []string{} }
+
+// Lifecycle methods
+func (se *SecurityEvents) Initialize(ctx context.Context, config *interfaces.ModuleConfig) error {
+	se.logger.Infof("Initializing security events module")
+
+	eventsConfig, err := parseConfig(config)
+	if err != nil {
+		return err
+	}
+
+	se.mu.Lock()
+	se.config = eventsConfig
+	if excess := len(se.events) - eventsConfig.MaxEvents; excess > 0 {
+		se.events = append([]Event(nil), se.events[excess:]...)
+	}
+	se.mu.Unlock()
+
+	se.startTime = time.Now()
+	se.status.State = interfaces.ModuleStateReady
+
+	se.logger.Infof("Security events initialized with events=%v, max_events=%d, retention=%v",
+		eventsConfig.Events, eventsConfig.MaxEvents, eventsConfig.Retention)
+	return nil
+}
+
+func (se *SecurityEvents) Start(ctx context.Context) error {
+	se.status.State = interfaces.ModuleStateRunning
+	se.status.StartTime = time.Now()
+	se.logger.Infof("Security events module started")
+	return nil
+}
+
+func (se *SecurityEvents) Stop(ctx context.Context) error {
+	se.status.State = interfaces.ModuleStateDraining
+	se.logger.Infof("Security events module stopping")
+	return nil
+}
+
+func (se *SecurityEvents) Shutdown(ctx context.Context) error {
+	se.status.State = interfaces.ModuleStateStopped
+	se.logger.Infof("Security events module shutdown")
+	return nil
+}
+
+// Health and status methods
+func (se *SecurityEvents) Health(ctx context.Context) (*interfaces.HealthStatus, error) {
+	se.mu.Lock()
+	defer se.mu.Unlock()
+
+	return &interfaces.HealthStatus{
+		Status:        interfaces.HealthStateHealthy,
+		Message:       "Security events is healthy",
+		LastCheck:     time.Now(),
+		CheckDuration: time.Millisecond,
+		Details: map[string]interface{}{
+			"stored":  len(se.events),
+			"evicted": se.evicted,
+			"purged":  se.purged,
+		},
+	}, nil
+}
+
+func (se *SecurityEvents) Status() *interfaces.ModuleStatus {
+	se.mu.Lock()
+	defer se.mu.Unlock()
+
+	status := *se.status
+	status.LastActivity = time.Now()
+	return &status
+}
+
+func (se *SecurityEvents) Metrics() map[string]interface{} {
+	se.mu.Lock()
+	defer se.mu.Unlock()
+
+	return map[string]interface{}{
+		"requests_processed": se.status.RequestsProcessed,
+		"errors":             se.status.ErrorCount,
+		"events_stored":      len(se.events),
+		"events_evicted":     se.evicted,
+		"events_purged":      se.purged,
+		"uptime_seconds":     time.Since(se.startTime).Seconds(),
+	}
+}
+
+// Processing methods
+
+// ProcessRequest stores a flag event for a request let through with any of
+// the configured flag annotations
+func (se *SecurityEvents) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequestContext) (*interfaces.ProcessRequestResult, error) {
+	start := time.Now()
+
+	var flags []string
+	for annotation, flagged := range se.config.FlagAnnotations {
+		if value, exists := req.Annotations[annotation]; exists && value == flagged {
+			flags = append(flags, annotation)
+		}
+	}
+	if len(flags) > 0 && se.captures(EventFlag) {
+		sort.Strings(flags)
+		event := se.event(req, EventFlag)
+		event.Flags = flags
+		se.store(event)
+	} else {
+		se.store()
+	}
+
+	return &interfaces.ProcessRequestResult{
+		Action:         interfaces.ActionContinue,
+		ProcessingTime: time.Since(start),
+	}, nil
+}
+
+func (se *SecurityEvents) ProcessResponse(ctx context.Context, resp *interfaces.ProcessResponseContext) (*interfaces.ProcessResponseResult, error) {
+	// Security events are captured on requests only
+	return &interfaces.ProcessResponseResult{
+		Action: interfaces.ActionContinue,
+	}, nil
+}
+
+// ObserveBlock stores a block event with the module that blocked the request
+func (se *SecurityEvents) ObserveBlock(ctx context.Context, req *interfaces.ProcessRequestContext, result *interfaces.ProcessRequestResult) {
+	if !se.captures(EventBlock) {
+		se.store()
+		return
+	}
+
+	event := se.event(req, EventBlock)
+	event.Module = interfaces.BlockingModule(ctx)
+	event.Reason = result.BlockReason
+	se.store(event)
+}
+
+// Query returns the stored events matching q, newest first
+func (se *SecurityEvents) Query(q Query) []Event {
+	se.mu.Lock()
+	defer se.mu.Unlock()
+	se.purge(se.now())
+
+	var events []Event
+	for i := len(se.events) - 1; i >= 0; i-- {
+		event := se.events[i]
+		if (q.TenantID != "" && event.TenantID != q.TenantID) ||
+			(q.Type != "" && event.Type != q.Type) ||
+			(!q.Since.IsZero() && event.Timestamp.Before(q.Since)) ||
+			(!q.Until.IsZero() && !event.Timestamp.Before(q.Until)) {
+			continue
+		}
+		events = append(events, event)
+		if q.Limit > 0 && len(events) == q.Limit {
+			break
+		}
+	}
+	return events
+}
+
+// Handler serves stored events: GET returns {"events": [...]} newest first,
+// filtered by ?tenant=, ?action= (block or flag), ?since= and ?until=
+// (RFC 3339) and capped by ?limit=. ?tenant= takes the tenant ID, which is
+// matched against the pseudonym events carry when anonymization is enabled.
+func (se *SecurityEvents) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query, err := parseQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		query.TenantID = se.anonymizer.TenantID(query.TenantID)
+		events := se.Query(query)
+		if events == nil {
+			events = []Event{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"events": events})
+	})
+}
+
+// parseQuery reads the event filters of a query request
+func parseQuery(r *http.Request) (Query, error) {
+	values := r.URL.Query()
+	query := Query{TenantID: values.Get("tenant"), Type: values.Get("action")}
+
+	switch query.Type {
+	case "", EventBlock, EventFlag:
+	default:
+		return query, fmt.Errorf("invalid action: %s", query.Type)
+	}
+	for key, target := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+		if value := values.Get(key); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return query, fmt.Errorf("invalid %s: %s", key, value)
+			}
+			*target = parsed
+		}
+	}
+	if value := values.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return query, fmt.Errorf("invalid limit: %s", value)
+		}
+		query.Limit = limit
+	}
+	return query, nil
+}
+
+// event builds an event with the request's redacted context
+func (se *SecurityEvents) event(req *interfaces.ProcessRequestContext, eventType string) *Event {
+	event := &Event{
+		Type:      eventType,
+		RequestID: req.RequestID,
+		TenantID:  se.anonymizer.TenantID(req.TenantID),
+		Provider:  req.Provider,
+		Model:     req.Model,
+		Method:    req.Method,
+		Path:      req.Path,
+		Headers:   redact.Headers(req.Headers),
+	}
+	if max := se.config.MaxBodyBytes; max > 0 && len(req.Body) > 0 {
+		body := redact.Body(req.Body)
+		if len(body) > max {
+			body = append(body[:max:max], "...[truncated]"...)
+		}
+		event.Body = string(body)
+	}
+	return event
+}
+
+// captures reports whether an event type is configured to be stored
+func (se *SecurityEvents) captures(eventType string) bool {
+	for _, configured := range se.config.Events {
+		if configured == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// store counts a processed request and stores its event, if any, evicting
+// the oldest event at capacity
+func (se *SecurityEvents) store(events ...*Event) {
+	se.mu.Lock()
+	defer se.mu.Unlock()
+
+	se.status.RequestsProcessed++
+	se.status.LastActivity = time.Now()
+	now := se.now()
+	se.purge(now)
+	for _, event := range events {
+		se.nextID++
+		event.ID = se.nextID
+		event.Timestamp = now.UTC()
+		if len(se.events) >= se.config.MaxEvents {
+			se.events = se.events[1:]
+			se.evicted++
+		}
+		se.events = append(se.events, *event)
+		se.logger.Debugf("Stored %s security event for request %s", event.Type, event.RequestID)
+	}
+}
+
+// purge drops events older than the retention period. Callers must hold
+// se.mu.
+func (se *SecurityEvents) purge(now time.Time) {
+	cutoff := now.Add(-se.config.Retention)
+	expired := sort.Search(len(se.events), func(i int) bool {
+		return se.events[i].Timestamp.After(cutoff)
+	})
+	if expired > 0 {
+		se.events = append([]Event(nil), se.events[expired:]...)
+		se.purged += int64(expired)
+	}
+}
+
+// Configuration methods
+func (se *SecurityEvents) ValidateConfig(config *interfaces.ModuleConfig) error {
+	if config == nil {
+		return fmt.Errorf("config cannot be nil")
+	}
+
+	_, err := parseConfig(config)
+	return err
+}
+
+func (se *SecurityEvents) UpdateConfig(ctx context.Context, config *interfaces.ModuleConfig) error {
+	if err := se.ValidateConfig(config); err != nil {
+		return err
+	}
+
+	return se.Initialize(ctx, config)
+}
+
+func (se *SecurityEvents) GetConfig() *interfaces.ModuleConfig {
+	return &interfaces.ModuleConfig{
+		Name:     se.name,
+		Type:     se.Type().String(),
+		Enabled:  se.status.State == interfaces.ModuleStateRunning,
+		Priority: 945, // Runs alongside other sinks near the end
+		Config: map[string]interface{}{
+			"events":           se.config.Events,
+			"flag_annotations": se.config.FlagAnnotations,
+			"max_events":       se.config.MaxEvents,
+			"retention":        se.config.Retention.String(),
+			"max_body_bytes":   se.config.MaxBodyBytes,
+		},
+	}
+}
+
+// defaultConfig returns the configuration used when none is given
+func defaultConfig() *SecurityEventsConfig {
+	return &SecurityEventsConfig{
+		Events: []string{EventBlock, EventFlag},
+		FlagAnnotations: map[string]interface{}{
+			"content_safe":        false,
+			"moderation_flagged":  true,
+			"fingerprint_anomaly": true,
+		},
+		MaxEvents:    10000,
+		Retention:    7 * 24 * time.Hour,
+		MaxBodyBytes: 2048,
+	}
+}
+
+// parseConfig parses and checks a module config over the defaults
+func parseConfig(config *interfaces.ModuleConfig) (*SecurityEventsConfig, error) {
+	eventsConfig := defaultConfig()
+	if config == nil || config.Config == nil {
+		return eventsConfig, nil
+	}
+	configMap := config.Config
+
+	if events, ok := configMap["events"].([]interface{}); ok {
+		eventsConfig.Events = eventsConfig.Events[:0]
+		for _, event := range events {
+			eventType, _ := event.(string)
+			switch eventType {
+			case EventBlock, EventFlag:
+				eventsConfig.Events = append(eventsConfig.Events, eventType)
+			default:
+				return nil, fmt.Errorf("unsupported security event: %v", event)
+			}
+		}
+	}
+	if raw, exists := configMap["flag_annotations"]; exists {
+		annotations, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("flag_annotations must be a map of annotations to values")
+		}
+		eventsConfig.FlagAnnotations = annotations
+	}
+
+	if value, exists := configMap["max_events"]; exists {
+		number, ok := toFloat(value)
+		if !ok || number < 1 {
+			return nil, fmt.Errorf("max_events must be at least 1, got %v", value)
+		}
+		eventsConfig.MaxEvents = int(number)
+	}
+	if value, exists := configMap["max_body_bytes"]; exists {
+		number, ok := toFloat(value)
+		if !ok || number < 0 {
+			return nil, fmt.Errorf("max_body_bytes must be a non-negative integer, got %v", value)
+		}
+		eventsConfig.MaxBodyBytes = int(number)
+	}
+	if value, exists := configMap["retention"]; exists {
+		str, _ := value.(string)
+		duration, err := time.ParseDuration(str)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("retention must be a positive duration, got %v", value)
+		}
+		eventsConfig.Retention = duration
+	}
+	return eventsConfig, nil
+}
+
+// toFloat reads a numeric config value
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
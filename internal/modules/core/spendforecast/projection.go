@@ -0,0 +1,102 @@
+package spendforecast
+
+import (
+	"time"
+)
+
+// Budget periods
+const (
+	PeriodDaily   = "daily"
+	PeriodWeekly  = "weekly" // weeks start on Monday
+	PeriodMonthly = "monthly"
+)
+
+var validPeriods = map[string]bool{
+	PeriodDaily:   true,
+	PeriodWeekly:  true,
+	PeriodMonthly: true,
+}
+
+// Forecast is a tenant's projected spend for the current budget period
+type Forecast struct {
+	TenantID    string    `json:"tenant_id"`
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	SpendUSD    float64   `json:"spend_usd"`
+	BudgetUSD   float64   `json:"budget_usd"`
+	// VelocityUSDPerHour is the average spend rate since tracking began
+	VelocityUSDPerHour float64 `json:"velocity_usd_per_hour"`
+	ProjectedUSD       float64 `json:"projected_usd"` // spend at period end at the current rate
+	// ExhaustsAt is when the budget runs out at the current rate; zero when
+	// it lasts the period
+	ExhaustsAt time.Time `json:"exhausts_at,omitempty"`
+	OverBudget bool      `json:"over_budget"` // the projection exceeds the budget
+}
+
+// tenantSpend is a tenant's spend in one budget period
+type tenantSpend struct {
+	periodStart time.Time
+	periodEnd   time.Time
+	since       time.Time // when spend started being observed in the period
+	spend       float64
+	alerted     bool // an alert was raised for the period
+}
+
+// periodBounds returns the start and end of the budget period containing t,
+// with boundaries at midnight in location
+func periodBounds(t time.Time, period string, location *time.Location) (start, end time.Time) {
+	local := t.In(location)
+	year, month, day := local.Date()
+	switch period {
+	case PeriodDaily:
+		start = time.Date(year, month, day, 0, 0, 0, 0, location)
+		end = start.AddDate(0, 0, 1)
+	case PeriodWeekly:
+		offset := (int(local.Weekday()) + 6) % 7 // days since Monday
+		start = time.Date(year, month, day-offset, 0, 0, 0, 0, location)
+		end = start.AddDate(0, 0, 7)
+	default:
+		start = time.Date(year, month, 1, 0, 0, 0, 0, location)
+		end = start.AddDate(0, 1, 0)
+	}
+	return start, end
+}
+
+// project extrapolates a tenant's spend to the end of its period at the
+// average rate observed up to now. It reports false until minElapsed of
+// history has been observed, as a few early requests say little about a trend.
+func project(tenantID string, spend *tenantSpend, budget float64, now time.Time, minElapsed time.Duration) (*Forecast, bool) {
+	elapsed := now.Sub(spend.since)
+	if elapsed <= 0 || elapsed < minElapsed {
+		return nil, false
+	}
+
+	velocity := spend.spend / elapsed.Hours()
+	remaining := spend.periodEnd.Sub(now)
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	forecast := &Forecast{
+		TenantID:           tenantID,
+		PeriodStart:        spend.periodStart,
+		PeriodEnd:          spend.periodEnd,
+		SpendUSD:           spend.spend,
+		BudgetUSD:          budget,
+		VelocityUSDPerHour: velocity,
+		ProjectedUSD:       spend.spend + velocity*remaining.Hours(),
+	}
+	if budget <= 0 {
+		return forecast, true
+	}
+	forecast.OverBudget = forecast.ProjectedUSD > budget
+
+	switch {
+	case spend.spend >= budget:
+		forecast.ExhaustsAt = now
+	case forecast.OverBudget && velocity > 0:
+		hours := (budget - spend.spend) / velocity
+		forecast.ExhaustsAt = now.Add(time.Duration(hours * float64(time.Hour))).Round(time.Second)
+	}
+	return forecast, true
+}
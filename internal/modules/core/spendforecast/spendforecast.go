@@ -0,0 +1,371 @@
+package spendforecast
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/metrics"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"go.uber.org/zap"
+)
+
+// SpendForecast implements a sink projecting each tenant's spend to the end
+// of its budget period and alerting when the projection overruns the budget,
+// before the budget is actually spent
+type SpendForecast struct {
+	name        string
+	version     string
+	description string
+	author      string
+	config      *SpendForecastConfig
+	logger      *zap.SugaredLogger
+	status      *interfaces.ModuleStatus
+	startTime   time.Time
+	metrics     *metrics.Registry
+
+	mu            sync.Mutex
+	now           func() time.Time
+	location      *time.Location
+	trackingSince time.Time // spend before this was not observed
+	tenants       map[string]*tenantSpend
+}
+
+// SpendForecastConfig represents spend forecasting configuration
+type SpendForecastConfig struct {
+	BudgetUSD     float64            `yaml:"budget_usd" json:"budget_usd"`         // budget per period for tenants without their own; 0 disables alerts
+	TenantBudgets map[string]float64 `yaml:"tenant_budgets" json:"tenant_budgets"` // budgets per period by tenant
+	Period        string             `yaml:"period" json:"period"`                 // daily, weekly, monthly
+	Timezone      string             `yaml:"timezone" json:"timezone"`             // IANA timezone periods start at midnight in
+	MinElapsed    time.Duration      `yaml:"min_elapsed" json:"min_elapsed"`       // history needed before projecting
+}
+
+// NewSpendForecast creates a new spend forecasting module
+func NewSpendForecast(logger *zap.SugaredLogger) *SpendForecast {
+	return &SpendForecast{
+		name:        "spend-forecast",
+		version:     "1.0.0",
+		description: "Projects tenant spend to the end of the budget period and alerts on forecast overruns",
+		author:      "Leash Security",
+		logger:      logger,
+		status: &interfaces.ModuleStatus{
+			State:             interfaces.ModuleStateReady,
+			RequestsProcessed: 0,
+			ErrorCount:        0,
+		},
+		now:     time.Now,
+		tenants: make(map[string]*tenantSpend),
+	}
+}
+
+// SetMetrics enables the projected spend gauge and forecast alert counter
+func (sf *SpendForecast) SetMetrics(registry *metrics.Registry) {
+	sf.metrics = registry
+}
+
+// SetClock replaces the source of the current time, e.g. with a fixed clock
+// in tests. Spend is observed from the time the clock is set.
+func (sf *SpendForecast) SetClock(now func() time.Time) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.now = now
+	sf.trackingSince = now()
+}
+
+// Metadata methods
+func (sf *SpendForecast) Name() string                { return sf.name }
+func (sf *SpendForecast) Version() string             { return sf.version }
+func (sf *SpendForecast) Type() interfaces.ModuleType { return interfaces.ModuleTypeSink }
+func (sf *SpendForecast) Description() string         { return sf.description }
+func (sf *SpendForecast) Author() string              { return sf.author }
+func (sf *SpendForecast) Dependencies() []string      { return []string{} }
+
+// Lifecycle methods
+func (sf *SpendForecast) Initialize(ctx context.Context, config *interfaces.ModuleConfig) error {
+	sf.logger.Infof("Initializing spend forecast module")
+
+	forecastConfig, err := parseConfig(config)
+	if err != nil {
+		return err
+	}
+	location, err := time.LoadLocation(forecastConfig.Timezone)
+	if err != nil {
+		return fmt.Errorf("invalid timezone %s: %w", forecastConfig.Timezone, err)
+	}
+
+	sf.mu.Lock()
+	sf.config = forecastConfig
+	sf.location = location
+	if sf.trackingSince.IsZero() {
+		sf.trackingSince = sf.now()
+	}
+	sf.mu.Unlock()
+
+	sf.startTime = time.Now()
+	sf.status.State = interfaces.ModuleStateReady
+
+	sf.logger.Infof("Spend forecast initialized with period=%s (%s), budget=$%.2f, %d tenant budgets, min_elapsed=%v",
+		forecastConfig.Period, forecastConfig.Timezone, forecastConfig.BudgetUSD, len(forecastConfig.TenantBudgets), forecastConfig.MinElapsed)
+	return nil
+}
+
+func (sf *SpendForecast) Start(ctx context.Context) error {
+	sf.status.State = interfaces.ModuleStateRunning
+	sf.status.StartTime = time.Now()
+	sf.logger.Infof("Spend forecast module started")
+	return nil
+}
+
+func (sf *SpendForecast) Stop(ctx context.Context) error {
+	sf.status.State = interfaces.ModuleStateDraining
+	sf.logger.Infof("Spend forecast module stopping")
+	return nil
+}
+
+func (sf *SpendForecast) Shutdown(ctx context.Context) error {
+	sf.status.State = interfaces.ModuleStateStopped
+	sf.logger.Infof("Spend forecast module shutdown")
+	return nil
+}
+
+// Health and status methods
+func (sf *SpendForecast) Health(ctx context.Context) (*interfaces.HealthStatus, error) {
+	sf.mu.Lock()
+	tenants := len(sf.tenants)
+	sf.mu.Unlock()
+
+	return &interfaces.HealthStatus{
+		Status:        interfaces.HealthStateHealthy,
+		Message:       "Spend forecast is healthy",
+		LastCheck:     time.Now(),
+		CheckDuration: time.Millisecond,
+		Details: map[string]interface{}{
+			"period":          sf.config.Period,
+			"tenants_tracked": tenants,
+		},
+	}, nil
+}
+
+func (sf *SpendForecast) Status() *interfaces.ModuleStatus {
+	status := *sf.status
+	status.LastActivity = time.Now()
+	return &status
+}
+
+func (sf *SpendForecast) Metrics() map[string]interface{} {
+	return map[string]interface{}{
+		"requests_processed": sf.status.RequestsProcessed,
+		"errors":             sf.status.ErrorCount,
+		"uptime_seconds":     time.Since(sf.startTime).Seconds(),
+	}
+}
+
+// Processing methods
+func (sf *SpendForecast) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequestContext) (*interfaces.ProcessRequestResult, error) {
+	// Spend is known once the response arrives
+	return &interfaces.ProcessRequestResult{
+		Action: interfaces.ActionContinue,
+	}, nil
+}
+
+// ProcessResponse adds the response cost to the tenant's period spend and
+// re-projects it, alerting the first time in a period the projection exceeds
+// the tenant's budget
+func (sf *SpendForecast) ProcessResponse(ctx context.Context, resp *interfaces.ProcessResponseContext) (*interfaces.ProcessResponseResult, error) {
+	start := time.Now()
+	sf.status.RequestsProcessed++
+	sf.status.LastActivity = time.Now()
+
+	if resp.CostUSD <= 0 || resp.ProcessRequestContext == nil {
+		return &interfaces.ProcessResponseResult{
+			Action:         interfaces.ActionContinue,
+			ProcessingTime: time.Since(start),
+		}, nil
+	}
+
+	sf.mu.Lock()
+	now := sf.now()
+	spend := sf.currentSpend(resp.TenantID, now)
+	spend.spend += resp.CostUSD
+	forecast, ok := project(resp.TenantID, spend, sf.budgetFor(resp.TenantID), now, sf.config.MinElapsed)
+	alert := ok && forecast.OverBudget && !spend.alerted
+	if alert {
+		spend.alerted = true
+	}
+	sf.mu.Unlock()
+
+	if !ok {
+		return &interfaces.ProcessResponseResult{
+			Action:         interfaces.ActionContinue,
+			ProcessingTime: time.Since(start),
+		}, nil
+	}
+
+	if sf.metrics != nil {
+		sf.metrics.RecordSpendForecast(resp.TenantID, forecast.ProjectedUSD)
+	}
+	annotations := map[string]interface{}{
+		"projected_spend_usd": forecast.ProjectedUSD,
+	}
+	if forecast.OverBudget {
+		annotations["spend_forecast_exceeded"] = true
+		annotations["budget_exhausted_at"] = forecast.ExhaustsAt.In(sf.location).Format(time.RFC3339)
+	}
+	if alert {
+		sf.logger.Warnf("SPEND FORECAST ALERT: tenant %s is projected to spend $%.2f of its $%.2f budget by %s, exhausting it on %s (spent $%.2f so far)",
+			resp.TenantID, forecast.ProjectedUSD, forecast.BudgetUSD, forecast.PeriodEnd.Format("2006-01-02"),
+			forecast.ExhaustsAt.In(sf.location).Format("2006-01-02"), forecast.SpendUSD)
+		if sf.metrics != nil {
+			sf.metrics.RecordSpendForecastAlert(resp.TenantID)
+		}
+	}
+
+	return &interfaces.ProcessResponseResult{
+		Action:         interfaces.ActionContinue,
+		ProcessingTime: time.Since(start),
+		Annotations:    annotations,
+	}, nil
+}
+
+// Forecast returns the tenant's current spend projection, or false until
+// min_elapsed of its period has been observed
+func (sf *SpendForecast) Forecast(tenantID string) (*Forecast, bool) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+
+	now := sf.now()
+	return project(tenantID, sf.currentSpend(tenantID, now), sf.budgetFor(tenantID), now, sf.config.MinElapsed)
+}
+
+// currentSpend returns the tenant's spend in the period containing now,
+// starting a new period when the last one has ended. A period is observed
+// from its start unless tracking began part way through it. Callers must
+// hold sf.mu.
+func (sf *SpendForecast) currentSpend(tenantID string, now time.Time) *tenantSpend {
+	spend, exists := sf.tenants[tenantID]
+	if exists && now.Before(spend.periodEnd) {
+		return spend
+	}
+
+	periodStart, periodEnd := periodBounds(now, sf.config.Period, sf.location)
+	since := periodStart
+	if sf.trackingSince.After(since) {
+		since = sf.trackingSince
+	}
+	spend = &tenantSpend{periodStart: periodStart, periodEnd: periodEnd, since: since}
+	sf.tenants[tenantID] = spend
+	return spend
+}
+
+// budgetFor returns the tenant's budget per period
+func (sf *SpendForecast) budgetFor(tenantID string) float64 {
+	if budget, ok := sf.config.TenantBudgets[tenantID]; ok {
+		return budget
+	}
+	return sf.config.BudgetUSD
+}
+
+// Configuration methods
+func (sf *SpendForecast) ValidateConfig(config *interfaces.ModuleConfig) error {
+	if config == nil {
+		return fmt.Errorf("config cannot be nil")
+	}
+
+	forecastConfig, err := parseConfig(config)
+	if err != nil {
+		return err
+	}
+	if _, err := time.LoadLocation(forecastConfig.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone %s: %w", forecastConfig.Timezone, err)
+	}
+	return nil
+}
+
+func (sf *SpendForecast) UpdateConfig(ctx context.Context, config *interfaces.ModuleConfig) error {
+	if err := sf.ValidateConfig(config); err != nil {
+		return err
+	}
+
+	return sf.Initialize(ctx, config)
+}
+
+func (sf *SpendForecast) GetConfig() *interfaces.ModuleConfig {
+	return &interfaces.ModuleConfig{
+		Name:     sf.name,
+		Type:     sf.Type().String(),
+		Enabled:  sf.status.State == interfaces.ModuleStateRunning,
+		Priority: 910,
+		Config: map[string]interface{}{
+			"budget_usd":     sf.config.BudgetUSD,
+			"tenant_budgets": sf.config.TenantBudgets,
+			"period":         sf.config.Period,
+			"timezone":       sf.config.Timezone,
+			"min_elapsed":    sf.config.MinElapsed.String(),
+		},
+	}
+}
+
+// parseConfig parses and checks a module config over the defaults
+func parseConfig(config *interfaces.ModuleConfig) (*SpendForecastConfig, error) {
+	forecastConfig := &SpendForecastConfig{
+		Period:     PeriodMonthly,
+		Timezone:   "UTC",
+		MinElapsed: time.Hour,
+	}
+	if config == nil || config.Config == nil {
+		return forecastConfig, nil
+	}
+	configMap := config.Config
+
+	if raw, ok := configMap["budget_usd"]; ok {
+		budget, ok := toFloat(raw)
+		if !ok || budget < 0 {
+			return nil, fmt.Errorf("budget_usd must be a non-negative number, got %v", raw)
+		}
+		forecastConfig.BudgetUSD = budget
+	}
+	if raw, ok := configMap["tenant_budgets"]; ok {
+		rawBudgets, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("tenant_budgets must be a map of tenant IDs to budgets")
+		}
+		forecastConfig.TenantBudgets = make(map[string]float64, len(rawBudgets))
+		for tenantID, value := range rawBudgets {
+			budget, ok := toFloat(value)
+			if !ok || budget < 0 {
+				return nil, fmt.Errorf("tenant_budgets %s must be a non-negative number, got %v", tenantID, value)
+			}
+			forecastConfig.TenantBudgets[tenantID] = budget
+		}
+	}
+	if period, ok := configMap["period"].(string); ok {
+		if !validPeriods[period] {
+			return nil, fmt.Errorf("unsupported period: %s", period)
+		}
+		forecastConfig.Period = period
+	}
+	if timezone, ok := configMap["timezone"].(string); ok {
+		forecastConfig.Timezone = timezone
+	}
+	if minElapsed, ok := configMap["min_elapsed"].(string); ok {
+		duration, err := time.ParseDuration(minElapsed)
+		if err != nil || duration < 0 {
+			return nil, fmt.Errorf("invalid min_elapsed: %s", minElapsed)
+		}
+		forecastConfig.MinElapsed = duration
+	}
+	return forecastConfig, nil
+}
+
+// toFloat reads a numeric config value
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,583 @@
+package tenanthealth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/metrics"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/tenants"
+	"go.uber.org/zap"
+)
+
+// Score components
+const (
+	ComponentErrorRate = "error_rate"
+	ComponentLatency   = "latency"
+	ComponentRateLimit = "rate_limit"
+	ComponentCostLimit = "cost_limit"
+)
+
+// windowBuckets is the number of buckets a tenant's signal window is split
+// into; signals expire one bucket at a time
+const windowBuckets = 10
+
+// CostSource reports how close a tenant is to its cost limits
+type CostSource interface {
+	// LimitProximity returns the tenant's spend as a fraction of its nearest
+	// cost limit, 0 for tenants without limits
+	LimitProximity(tenantID string) float64
+}
+
+// TenantHealth implements a sink scoring each tenant's health from 0 to 100
+// over a sliding window, combining its error rate, latency, rate-limit
+// pressure and cost-limit proximity with configurable weights
+type TenantHealth struct {
+	name        string
+	version     string
+	description string
+	author      string
+	config      *TenantHealthConfig
+	logger      *zap.SugaredLogger
+	status      *interfaces.ModuleStatus
+	startTime   time.Time
+	metrics     *metrics.Registry
+	costSource  CostSource
+	anonymizer  *tenants.Anonymizer
+
+	mu      sync.Mutex
+	now     func() time.Time
+	tenants map[string]*tenantSignals
+}
+
+// TenantHealthConfig represents tenant health scoring configuration
+type TenantHealthConfig struct {
+	Window        time.Duration `yaml:"window" json:"window"`                 // signals older than this are forgotten
+	LatencyTarget time.Duration `yaml:"latency_target" json:"latency_target"` // mean latency at or below this scores fully
+	Weights       Weights       `yaml:"weights" json:"weights"`
+}
+
+// Weights are the relative weights of the score components; a zero weight
+// leaves a component out of the score
+type Weights struct {
+	ErrorRate float64 `yaml:"error_rate" json:"error_rate"`
+	Latency   float64 `yaml:"latency" json:"latency"`
+	RateLimit float64 `yaml:"rate_limit" json:"rate_limit"`
+	CostLimit float64 `yaml:"cost_limit" json:"cost_limit"`
+}
+
+// Score is a tenant's health. Components range from 0 (fully degraded) to 1
+// (healthy); the score is their weighted mean scaled to 0-100.
+type Score struct {
+	TenantID   string             `json:"tenant_id"`
+	Score      float64            `json:"score"`
+	Components map[string]float64 `json:"components"`
+	Requests   int64              `json:"requests"`
+}
+
+// tenantSignals holds a tenant's signals per window bucket
+type tenantSignals struct {
+	buckets [windowBuckets]signalBucket
+}
+
+// signalBucket counts the signals observed in one slot of the window
+type signalBucket struct {
+	slot        int64
+	requests    int64 // requests seen, including blocked ones
+	responses   int64
+	errors      int64 // responses with a 5xx status
+	latency     time.Duration
+	rateLimited int64 // requests blocked by a rate limit or answered 429
+	costBlocked int64 // requests blocked by a cost limit
+}
+
+// NewTenantHealth creates a new tenant health module
+func NewTenantHealth(logger *zap.SugaredLogger) *TenantHealth {
+	return &TenantHealth{
+		name:        "tenant-health",
+		version:     "1.0.0",
+		description: "Scores tenant health from error rate, latency, rate-limit pressure and cost-limit proximity",
+		author:      "Leash Security",
+		config:      defaultConfig(),
+		logger:      logger,
+		status: &interfaces.ModuleStatus{
+			State:             interfaces.ModuleStateReady,
+			RequestsProcessed: 0,
+			ErrorCount:        0,
+		},
+		now:     time.Now,
+		tenants: make(map[string]*tenantSignals),
+	}
+}
+
+// SetMetrics enables the tenant health score gauge
+func (th *TenantHealth) SetMetrics(registry *metrics.Registry) {
+	th.metrics = registry
+}
+
+// SetTenantAnonymizer makes the handler report tenant pseudonyms instead of
+// tenant IDs
+func (th *TenantHealth) SetTenantAnonymizer(anonymizer *tenants.Anonymizer) {
+	th.anonymizer = anonymizer
+}
+
+// SetCostSource sets the source of cost-limit proximity, e.g. the cost
+// tracker. Without one, a tenant's cost component only drops when its
+// requests are blocked by a cost limit.
+func (th *TenantHealth) SetCostSource(source CostSource) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	th.costSource = source
+}
+
+// SetClock replaces the source of the current time, e.g. with a fixed clock
+// in tests
+func (th *TenantHealth) SetClock(now func() time.Time) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	th.now = now
+}
+
+// Metadata methods
+func (th *TenantHealth) Name() string                { return th.name }
+func (th *TenantHealth) Version() string             { return th.version }
+func (th *TenantHealth) Type() interfaces.ModuleType { return interfaces.ModuleTypeSink }
+func (th *TenantHealth) Description() string         { return th.description }
+func (th *TenantHealth) Author() string              { return th.author }
+func (th *TenantHealth) Dependencies() []string      { return []string{} }
+
+// Lifecycle methods
+func (th *TenantHealth) Initialize(ctx context.Context, config *interfaces.ModuleConfig) error {
+	th.logger.Infof("Initializing tenant health module")
+
+	healthConfig, err := parseConfig(config)
+	if err != nil {
+		return err
+	}
+
+	th.mu.Lock()
+	if healthConfig.Window != th.config.Window {
+		// Buckets are sized by the window, so signals cannot carry over
+		th.tenants = make(map[string]*tenantSignals)
+	}
+	th.config = healthConfig
+	th.mu.Unlock()
+
+	th.startTime = time.Now()
+	th.status.State = interfaces.ModuleStateReady
+
+	weights := healthConfig.Weights
+	th.logger.Infof("Tenant health initialized with window=%v, latency_target=%v, weights error_rate=%.2f latency=%.2f rate_limit=%.2f cost_limit=%.2f",
+		healthConfig.Window, healthConfig.LatencyTarget, weights.ErrorRate, weights.Latency, weights.RateLimit, weights.CostLimit)
+	return nil
+}
+
+func (th *TenantHealth) Start(ctx context.Context) error {
+	th.status.State = interfaces.ModuleStateRunning
+	th.status.StartTime = time.Now()
+	th.logger.Infof("Tenant health module started")
+	return nil
+}
+
+func (th *TenantHealth) Stop(ctx context.Context) error {
+	th.status.State = interfaces.ModuleStateDraining
+	th.logger.Infof("Tenant health module stopping")
+	return nil
+}
+
+func (th *TenantHealth) Shutdown(ctx context.Context) error {
+	th.status.State = interfaces.ModuleStateStopped
+	th.logger.Infof("Tenant health module shutdown")
+	return nil
+}
+
+// Health and status methods
+func (th *TenantHealth) Health(ctx context.Context) (*interfaces.HealthStatus, error) {
+	th.mu.Lock()
+	tenants := len(th.tenants)
+	th.mu.Unlock()
+
+	return &interfaces.HealthStatus{
+		Status:        interfaces.HealthStateHealthy,
+		Message:       "Tenant health is healthy",
+		LastCheck:     time.Now(),
+		CheckDuration: time.Millisecond,
+		Details: map[string]interface{}{
+			"window":          th.config.Window.String(),
+			"tenants_tracked": tenants,
+		},
+	}, nil
+}
+
+func (th *TenantHealth) Status() *interfaces.ModuleStatus {
+	status := *th.status
+	status.LastActivity = time.Now()
+	return &status
+}
+
+func (th *TenantHealth) Metrics() map[string]interface{} {
+	return map[string]interface{}{
+		"requests_processed": th.status.RequestsProcessed,
+		"errors":             th.status.ErrorCount,
+		"uptime_seconds":     time.Since(th.startTime).Seconds(),
+	}
+}
+
+// Processing methods
+
+// ProcessRequest counts a request that passed the policies
+func (th *TenantHealth) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequestContext) (*interfaces.ProcessRequestResult, error) {
+	start := time.Now()
+	th.status.RequestsProcessed++
+	th.status.LastActivity = time.Now()
+
+	th.observe(req.TenantID, func(b *signalBucket) {
+		b.requests++
+	})
+
+	return &interfaces.ProcessRequestResult{
+		Action:         interfaces.ActionContinue,
+		ProcessingTime: time.Since(start),
+	}, nil
+}
+
+// ProcessResponse counts the response's status and latency
+func (th *TenantHealth) ProcessResponse(ctx context.Context, resp *interfaces.ProcessResponseContext) (*interfaces.ProcessResponseResult, error) {
+	start := time.Now()
+
+	if resp.ProcessRequestContext != nil {
+		th.observe(resp.TenantID, func(b *signalBucket) {
+			b.responses++
+			b.latency += resp.TotalLatency
+			if resp.StatusCode >= http.StatusInternalServerError {
+				b.errors++
+			}
+			if resp.StatusCode == http.StatusTooManyRequests {
+				b.rateLimited++
+			}
+		})
+	}
+
+	return &interfaces.ProcessResponseResult{
+		Action:         interfaces.ActionContinue,
+		ProcessingTime: time.Since(start),
+	}, nil
+}
+
+// ObserveBlock counts a request blocked before reaching this module, noting
+// blocks by the rate limiter and cost tracker
+func (th *TenantHealth) ObserveBlock(ctx context.Context, req *interfaces.ProcessRequestContext, result *interfaces.ProcessRequestResult) {
+	th.observe(req.TenantID, func(b *signalBucket) {
+		b.requests++
+		switch result.BlockReason {
+		case "rate_limit_exceeded":
+			b.rateLimited++
+		case "cost_limit_exceeded":
+			b.costBlocked++
+		}
+	})
+}
+
+// observe records a signal in the tenant's current bucket and refreshes its
+// score gauge
+func (th *TenantHealth) observe(tenantID string, record func(b *signalBucket)) {
+	if tenantID == "" {
+		return
+	}
+
+	th.mu.Lock()
+	signals, exists := th.tenants[tenantID]
+	if !exists {
+		signals = &tenantSignals{}
+		th.tenants[tenantID] = signals
+	}
+	now := th.now()
+	record(th.currentBucket(signals, now))
+	score := th.score(tenantID, signals, now)
+	th.mu.Unlock()
+
+	if th.metrics != nil {
+		th.metrics.RecordTenantHealthScore(tenantID, score.Score)
+	}
+}
+
+// TenantScore returns a tenant's health score, or false when none of its
+// requests were seen within the window
+func (th *TenantHealth) TenantScore(tenantID string) (*Score, bool) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+
+	signals, exists := th.tenants[tenantID]
+	if !exists {
+		return nil, false
+	}
+	score := th.score(tenantID, signals, th.now())
+	if score.Requests == 0 {
+		delete(th.tenants, tenantID)
+		if th.metrics != nil {
+			th.metrics.ForgetTenantHealthScore(tenantID)
+		}
+		return nil, false
+	}
+	return score, true
+}
+
+// Scores returns the health score of every tenant seen within the window,
+// ordered by tenant ID, forgetting tenants idle for longer
+func (th *TenantHealth) Scores() []*Score {
+	th.mu.Lock()
+	tenantIDs := make([]string, 0, len(th.tenants))
+	for tenantID := range th.tenants {
+		tenantIDs = append(tenantIDs, tenantID)
+	}
+	th.mu.Unlock()
+	sort.Strings(tenantIDs)
+
+	scores := make([]*Score, 0, len(tenantIDs))
+	for _, tenantID := range tenantIDs {
+		if score, ok := th.TenantScore(tenantID); ok {
+			scores = append(scores, score)
+		}
+	}
+	return scores
+}
+
+// Handler serves tenant health scores: GET lists every tracked tenant's
+// score, GET ?tenant= returns one tenant's
+func (th *TenantHealth) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var body interface{}
+		if tenantID := r.URL.Query().Get("tenant"); tenantID != "" {
+			score, ok := th.TenantScore(tenantID)
+			if !ok {
+				http.Error(w, "tenant not tracked", http.StatusNotFound)
+				return
+			}
+			score.TenantID = th.anonymizer.TenantID(score.TenantID)
+			body = score
+		} else {
+			scores := th.Scores()
+			for _, score := range scores {
+				score.TenantID = th.anonymizer.TenantID(score.TenantID)
+			}
+			body = map[string]interface{}{"tenants": scores}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+	})
+}
+
+// currentBucket returns the tenant's bucket for now, clearing it when it
+// last held an older slot. Callers must hold th.mu.
+func (th *TenantHealth) currentBucket(signals *tenantSignals, now time.Time) *signalBucket {
+	slot := th.slot(now)
+	bucket := &signals.buckets[slot%windowBuckets]
+	if bucket.slot != slot {
+		*bucket = signalBucket{slot: slot}
+	}
+	return bucket
+}
+
+// slot returns the index of the bucket-sized slot of time containing now
+func (th *TenantHealth) slot(now time.Time) int64 {
+	width := th.config.Window / windowBuckets
+	if width <= 0 {
+		width = 1
+	}
+	return now.UnixNano() / int64(width)
+}
+
+// score computes a tenant's score over the window ending now. Callers must
+// hold th.mu.
+func (th *TenantHealth) score(tenantID string, signals *tenantSignals, now time.Time) *Score {
+	var total signalBucket
+	current := th.slot(now)
+	for _, bucket := range signals.buckets {
+		if bucket.slot <= current-windowBuckets || bucket.slot > current {
+			continue
+		}
+		total.requests += bucket.requests
+		total.responses += bucket.responses
+		total.errors += bucket.errors
+		total.latency += bucket.latency
+		total.rateLimited += bucket.rateLimited
+		total.costBlocked += bucket.costBlocked
+	}
+
+	components := map[string]float64{
+		ComponentErrorRate: 1,
+		ComponentLatency:   1,
+		ComponentRateLimit: 1,
+		ComponentCostLimit: 1,
+	}
+	if total.responses > 0 {
+		components[ComponentErrorRate] = 1 - float64(total.errors)/float64(total.responses)
+		mean := total.latency / time.Duration(total.responses)
+		if mean > th.config.LatencyTarget {
+			components[ComponentLatency] = float64(th.config.LatencyTarget) / float64(mean)
+		}
+	}
+	if total.requests > 0 {
+		components[ComponentRateLimit] = 1 - clamp(float64(total.rateLimited)/float64(total.requests))
+	}
+	if th.costSource != nil {
+		components[ComponentCostLimit] = 1 - clamp(th.costSource.LimitProximity(tenantID))
+	} else if total.costBlocked > 0 {
+		components[ComponentCostLimit] = 0
+	}
+
+	weights := th.config.Weights
+	weighted := weights.ErrorRate*components[ComponentErrorRate] +
+		weights.Latency*components[ComponentLatency] +
+		weights.RateLimit*components[ComponentRateLimit] +
+		weights.CostLimit*components[ComponentCostLimit]
+	return &Score{
+		TenantID:   tenantID,
+		Score:      100 * weighted / weights.total(),
+		Components: components,
+		Requests:   total.requests,
+	}
+}
+
+// clamp limits a fraction to [0, 1]
+func clamp(fraction float64) float64 {
+	switch {
+	case fraction < 0:
+		return 0
+	case fraction > 1:
+		return 1
+	default:
+		return fraction
+	}
+}
+
+// total returns the sum of the weights
+func (w Weights) total() float64 {
+	return w.ErrorRate + w.Latency + w.RateLimit + w.CostLimit
+}
+
+// Configuration methods
+func (th *TenantHealth) ValidateConfig(config *interfaces.ModuleConfig) error {
+	if config == nil {
+		return fmt.Errorf("config cannot be nil")
+	}
+
+	_, err := parseConfig(config)
+	return err
+}
+
+func (th *TenantHealth) UpdateConfig(ctx context.Context, config *interfaces.ModuleConfig) error {
+	if err := th.ValidateConfig(config); err != nil {
+		return err
+	}
+
+	return th.Initialize(ctx, config)
+}
+
+func (th *TenantHealth) GetConfig() *interfaces.ModuleConfig {
+	weights := th.config.Weights
+	return &interfaces.ModuleConfig{
+		Name:     th.name,
+		Type:     th.Type().String(),
+		Enabled:  th.status.State == interfaces.ModuleStateRunning,
+		Priority: 920,
+		Config: map[string]interface{}{
+			"window":         th.config.Window.String(),
+			"latency_target": th.config.LatencyTarget.String(),
+			"weights": map[string]interface{}{
+				ComponentErrorRate: weights.ErrorRate,
+				ComponentLatency:   weights.Latency,
+				ComponentRateLimit: weights.RateLimit,
+				ComponentCostLimit: weights.CostLimit,
+			},
+		},
+	}
+}
+
+// defaultConfig returns the configuration used when none is given
+func defaultConfig() *TenantHealthConfig {
+	return &TenantHealthConfig{
+		Window:        5 * time.Minute,
+		LatencyTarget: 2 * time.Second,
+		Weights: Weights{
+			ErrorRate: 0.4,
+			Latency:   0.2,
+			RateLimit: 0.2,
+			CostLimit: 0.2,
+		},
+	}
+}
+
+// parseConfig parses and checks a module config over the defaults
+func parseConfig(config *interfaces.ModuleConfig) (*TenantHealthConfig, error) {
+	healthConfig := defaultConfig()
+	if config == nil || config.Config == nil {
+		return healthConfig, nil
+	}
+	configMap := config.Config
+
+	for key, target := range map[string]*time.Duration{
+		"window":         &healthConfig.Window,
+		"latency_target": &healthConfig.LatencyTarget,
+	} {
+		if value, exists := configMap[key]; exists {
+			str, _ := value.(string)
+			duration, err := time.ParseDuration(str)
+			if err != nil || duration <= 0 {
+				return nil, fmt.Errorf("%s must be a positive duration, got %v", key, value)
+			}
+			*target = duration
+		}
+	}
+
+	if raw, ok := configMap["weights"]; ok {
+		rawWeights, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("weights must be a map of components to weights")
+		}
+		targets := map[string]*float64{
+			ComponentErrorRate: &healthConfig.Weights.ErrorRate,
+			ComponentLatency:   &healthConfig.Weights.Latency,
+			ComponentRateLimit: &healthConfig.Weights.RateLimit,
+			ComponentCostLimit: &healthConfig.Weights.CostLimit,
+		}
+		for component, value := range rawWeights {
+			target, known := targets[component]
+			if !known {
+				return nil, fmt.Errorf("unknown weights component: %s", component)
+			}
+			weight, ok := toFloat(value)
+			if !ok || weight < 0 {
+				return nil, fmt.Errorf("weights %s must be a non-negative number, got %v", component, value)
+			}
+			*target = weight
+		}
+	}
+	if healthConfig.Weights.total() <= 0 {
+		return nil, fmt.Errorf("at least one weight must be positive")
+	}
+	return healthConfig, nil
+}
+
+// toFloat reads a numeric config value
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
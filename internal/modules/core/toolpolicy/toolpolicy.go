@@ -0,0 +1,336 @@
+package toolpolicy
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/chatcontent"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"go.uber.org/zap"
+)
+
+// ToolPolicy implements a per-tenant allow/deny policy on the tools and
+// functions a request declares to the model
+type ToolPolicy struct {
+	name        string
+	version     string
+	description string
+	author      string
+	config      *ToolPolicyConfig
+	logger      *zap.SugaredLogger
+	status      *interfaces.ModuleStatus
+	startTime   time.Time
+	mu          sync.RWMutex
+}
+
+// ToolPolicyConfig represents tool policy configuration
+type ToolPolicyConfig struct {
+	Tenants map[string]TenantToolRules `yaml:"tenants" json:"tenants"`
+	Default TenantToolRules            `yaml:"default" json:"default"` // applied to tenants without rules
+}
+
+// TenantToolRules represents the tool rules for a single tenant. Entries may
+// be exact tool names or glob patterns (e.g. "delete_*"); built-in tools
+// without a name (e.g. web_search) are matched by their type.
+type TenantToolRules struct {
+	AllowedTools []string `yaml:"allowed_tools" json:"allowed_tools"` // empty means all tools allowed
+	DeniedTools  []string `yaml:"denied_tools" json:"denied_tools"`   // evaluated before allowed_tools
+}
+
+// NewToolPolicy creates a new tool policy module
+func NewToolPolicy(logger *zap.SugaredLogger) *ToolPolicy {
+	return &ToolPolicy{
+		name:        "tool-policy",
+		version:     "1.0.0",
+		description: "Per-tenant allow/deny policy on the tools and functions requests declare",
+		author:      "Leash Security",
+		logger:      logger,
+		status: &interfaces.ModuleStatus{
+			State:             interfaces.ModuleStateReady,
+			RequestsProcessed: 0,
+			ErrorCount:        0,
+		},
+	}
+}
+
+// Metadata methods
+func (tp *ToolPolicy) Name() string                { return tp.name }
+func (tp *ToolPolicy) Version() string             { return tp.version }
+func (tp *ToolPolicy) Type() interfaces.ModuleType { return interfaces.ModuleTypePolicy }
+func (tp *ToolPolicy) Description() string         { return tp.description }
+func (tp *ToolPolicy) Author() string              { return tp.author }
+func (tp *ToolPolicy) Dependencies() []string      { return []string{} }
+
+// Lifecycle methods
+func (tp *ToolPolicy) Initialize(ctx context.Context, config *interfaces.ModuleConfig) error {
+	tp.logger.Infof("Initializing tool policy module")
+
+	policyConfig := &ToolPolicyConfig{
+		Tenants: make(map[string]TenantToolRules),
+	}
+
+	// Override with provided config
+	if config != nil && config.Config != nil {
+		if tenants, ok := config.Config["tenants"].(map[string]interface{}); ok {
+			for tenantID, rules := range tenants {
+				if rulesMap, ok := rules.(map[string]interface{}); ok {
+					policyConfig.Tenants[tenantID] = parseRules(rulesMap)
+				}
+			}
+		}
+		if defaults, ok := config.Config["default"].(map[string]interface{}); ok {
+			policyConfig.Default = parseRules(defaults)
+		}
+	}
+
+	tp.mu.Lock()
+	tp.config = policyConfig
+	tp.mu.Unlock()
+
+	tp.startTime = time.Now()
+	tp.status.State = interfaces.ModuleStateReady
+
+	tp.logger.Infof("Tool policy initialized with rules for %d tenants", len(policyConfig.Tenants))
+	return nil
+}
+
+func (tp *ToolPolicy) Start(ctx context.Context) error {
+	tp.status.State = interfaces.ModuleStateRunning
+	tp.status.StartTime = time.Now()
+	tp.logger.Infof("Tool policy module started")
+	return nil
+}
+
+func (tp *ToolPolicy) Stop(ctx context.Context) error {
+	tp.status.State = interfaces.ModuleStateDraining
+	tp.logger.Infof("Tool policy module stopping")
+	return nil
+}
+
+func (tp *ToolPolicy) Shutdown(ctx context.Context) error {
+	tp.status.State = interfaces.ModuleStateStopped
+	tp.logger.Infof("Tool policy module shutdown")
+	return nil
+}
+
+// Health and status methods
+func (tp *ToolPolicy) Health(ctx context.Context) (*interfaces.HealthStatus, error) {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	return &interfaces.HealthStatus{
+		Status:        interfaces.HealthStateHealthy,
+		Message:       "Tool policy is healthy",
+		LastCheck:     time.Now(),
+		CheckDuration: time.Millisecond,
+		Details: map[string]interface{}{
+			"tenants_with_rules": len(tp.config.Tenants),
+		},
+	}, nil
+}
+
+func (tp *ToolPolicy) Status() *interfaces.ModuleStatus {
+	status := *tp.status
+	status.LastActivity = time.Now()
+	return &status
+}
+
+func (tp *ToolPolicy) Metrics() map[string]interface{} {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	return map[string]interface{}{
+		"requests_processed": tp.status.RequestsProcessed,
+		"errors":             tp.status.ErrorCount,
+		"tenants_with_rules": len(tp.config.Tenants),
+		"uptime_seconds":     time.Since(tp.startTime).Seconds(),
+	}
+}
+
+// Processing methods
+
+// ProcessRequest blocks requests declaring any tool the tenant may not use.
+// Requests declaring no tools, or whose bodies are not JSON, pass through.
+func (tp *ToolPolicy) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequestContext) (*interfaces.ProcessRequestResult, error) {
+	start := time.Now()
+	tp.status.RequestsProcessed++
+	tp.status.LastActivity = time.Now()
+
+	summary, ok := chatcontent.ParseRequest(req.Body)
+	if !ok || len(summary.Tools) == 0 {
+		return &interfaces.ProcessRequestResult{
+			Action:         interfaces.ActionContinue,
+			ProcessingTime: time.Since(start),
+		}, nil
+	}
+
+	names := make([]string, len(summary.Tools))
+	var denied []string
+	reason := ""
+	for i, tool := range summary.Tools {
+		names[i] = tool.Name
+		if allowed, why := tp.IsToolAllowed(req.TenantID, tool.Name); !allowed {
+			denied = append(denied, tool.Name)
+			if reason == "" {
+				reason = why
+			}
+		}
+	}
+
+	if len(denied) > 0 {
+		tp.logger.Warnf("Blocking request %s: %s", req.RequestID, reason)
+		return &interfaces.ProcessRequestResult{
+			Action:         interfaces.ActionBlock,
+			BlockReason:    reason,
+			ProcessingTime: time.Since(start),
+			Annotations: map[string]interface{}{
+				"tool_denied":  true,
+				"denied_tools": denied,
+			},
+		}, nil
+	}
+
+	return &interfaces.ProcessRequestResult{
+		Action:         interfaces.ActionContinue,
+		ProcessingTime: time.Since(start),
+		Annotations: map[string]interface{}{
+			"tool_policy_checked": true,
+			"declared_tools":      names,
+		},
+	}, nil
+}
+
+func (tp *ToolPolicy) ProcessResponse(ctx context.Context, resp *interfaces.ProcessResponseContext) (*interfaces.ProcessResponseResult, error) {
+	// Tool policy only applies to the tools a request declares
+	return &interfaces.ProcessResponseResult{
+		Action: interfaces.ActionContinue,
+	}, nil
+}
+
+// Configuration methods
+func (tp *ToolPolicy) ValidateConfig(config *interfaces.ModuleConfig) error {
+	if config == nil {
+		return fmt.Errorf("config cannot be nil")
+	}
+
+	if configMap := config.Config; configMap != nil {
+		if tenants, ok := configMap["tenants"]; ok {
+			tenantsMap, ok := tenants.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("tenants must be a map of tenant rules")
+			}
+			for tenantID, rules := range tenantsMap {
+				rulesMap, ok := rules.(map[string]interface{})
+				if !ok {
+					return fmt.Errorf("rules for tenant %s must be a map", tenantID)
+				}
+				if err := validatePatterns(parseRules(rulesMap)); err != nil {
+					return fmt.Errorf("tenant %s: %w", tenantID, err)
+				}
+			}
+		}
+		if defaults, ok := configMap["default"].(map[string]interface{}); ok {
+			if err := validatePatterns(parseRules(defaults)); err != nil {
+				return fmt.Errorf("default rules: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (tp *ToolPolicy) UpdateConfig(ctx context.Context, config *interfaces.ModuleConfig) error {
+	if err := tp.ValidateConfig(config); err != nil {
+		return err
+	}
+
+	return tp.Initialize(ctx, config)
+}
+
+func (tp *ToolPolicy) GetConfig() *interfaces.ModuleConfig {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	return &interfaces.ModuleConfig{
+		Name:     tp.name,
+		Type:     tp.Type().String(),
+		Enabled:  tp.status.State == interfaces.ModuleStateRunning,
+		Priority: 60, // After the model policy, before rate limiting so denied tools never consume quota
+		Config: map[string]interface{}{
+			"tenants": tp.config.Tenants,
+			"default": tp.config.Default,
+		},
+	}
+}
+
+// IsToolAllowed reports whether a tenant may declare a tool, and the block reason if not
+func (tp *ToolPolicy) IsToolAllowed(tenantID, tool string) (bool, string) {
+	tp.mu.RLock()
+	rules, exists := tp.config.Tenants[tenantID]
+	if !exists {
+		rules = tp.config.Default
+	}
+	tp.mu.RUnlock()
+
+	if matchesAny(rules.DeniedTools, tool) {
+		return false, fmt.Sprintf("tool %s is denied for tenant %s", tool, tenantID)
+	}
+
+	if len(rules.AllowedTools) > 0 && !matchesAny(rules.AllowedTools, tool) {
+		return false, fmt.Sprintf("tool %s is not in the allowed tools for tenant %s", tool, tenantID)
+	}
+
+	return true, ""
+}
+
+// parseRules converts a raw config map into tenant tool rules
+func parseRules(rulesMap map[string]interface{}) TenantToolRules {
+	return TenantToolRules{
+		AllowedTools: toStringSlice(rulesMap["allowed_tools"]),
+		DeniedTools:  toStringSlice(rulesMap["denied_tools"]),
+	}
+}
+
+// toStringSlice converts a config list into a string slice
+func toStringSlice(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if str, ok := item.(string); ok {
+				result = append(result, str)
+			}
+		}
+		return result
+	default:
+		return nil
+	}
+}
+
+// validatePatterns checks that all tool patterns are valid globs
+func validatePatterns(rules TenantToolRules) error {
+	for _, pattern := range append(append([]string{}, rules.AllowedTools...), rules.DeniedTools...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid tool pattern %s: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// matchesAny reports whether the tool matches any of the patterns
+func matchesAny(patterns []string, tool string) bool {
+	for _, pattern := range patterns {
+		if pattern == tool {
+			return true
+		}
+		if matched, err := path.Match(pattern, tool); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package interfaces
+
+import "fmt"
+
+// KnownOperator reports whether the condition's operator is supported
+func (c Condition) KnownOperator() bool {
+	switch c.Operator {
+	case "eq", "ne", "in", "not_in":
+		return true
+	}
+	return false
+}
+
+// Matches reports whether a request satisfies the condition. Fields other
+// than tenant, provider, model, method and path are read from the request
+// annotations. Unknown operators match.
+func (c Condition) Matches(req *ProcessRequestContext) bool {
+	var fieldValue interface{}
+
+	// Extract field value based on field name
+	switch c.Field {
+	case "tenant":
+		fieldValue = req.TenantID
+	case "provider":
+		fieldValue = req.Provider
+	case "model":
+		fieldValue = req.Model
+	case "method":
+		fieldValue = req.Method
+	case "path":
+		fieldValue = req.Path
+	default:
+		// Check in annotations
+		if req.Annotations != nil {
+			fieldValue = req.Annotations[c.Field]
+		}
+	}
+
+	// Evaluate condition based on operator
+	switch c.Operator {
+	case "eq":
+		return fmt.Sprintf("%v", fieldValue) == fmt.Sprintf("%v", c.Value)
+	case "ne":
+		return fmt.Sprintf("%v", fieldValue) != fmt.Sprintf("%v", c.Value)
+	case "in":
+		return containsValue(c.Value, fieldValue)
+	case "not_in":
+		return !containsValue(c.Value, fieldValue)
+	default:
+		return true
+	}
+}
+
+// containsValue reports whether a list value holds fieldValue
+func containsValue(list, fieldValue interface{}) bool {
+	// Value should be a slice
+	switch values := list.(type) {
+	case []interface{}:
+		for _, v := range values {
+			if fmt.Sprintf("%v", fieldValue) == fmt.Sprintf("%v", v) {
+				return true
+			}
+		}
+	case []string:
+		for _, v := range values {
+			if fmt.Sprintf("%v", fieldValue) == v {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -2,6 +2,7 @@ package interfaces
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 )
 
@@ -36,6 +37,47 @@ type Module interface {
 	GetConfig() *ModuleConfig
 }
 
+// StatefulModule is implemented by modules whose in-memory state can be
+// exported and restored, e.g. to reproduce a tenant's state elsewhere or to
+// carry it across replicas during a rolling restart
+type StatefulModule interface {
+	ExportState() (json.RawMessage, error)
+	// ImportState validates and replaces the module's state; invalid state
+	// leaves the current state untouched
+	ImportState(state json.RawMessage) error
+}
+
+// BlockObserver is implemented by sinks that need to see requests blocked by
+// a policy. Sinks otherwise only run for requests that proceed. The context
+// names the module that blocked the request, see BlockingModule.
+type BlockObserver interface {
+	ObserveBlock(ctx context.Context, req *ProcessRequestContext, result *ProcessRequestResult)
+}
+
+// blockingModuleKey carries the name of the module that blocked a request
+type blockingModuleKey struct{}
+
+// WithBlockingModule returns a context naming the module that blocked a
+// request, for block observers
+func WithBlockingModule(ctx context.Context, module string) context.Context {
+	return context.WithValue(ctx, blockingModuleKey{}, module)
+}
+
+// BlockingModule returns the module that blocked the request a block
+// observer is notified of, or "" when it is not known
+func BlockingModule(ctx context.Context) string {
+	module, _ := ctx.Value(blockingModuleKey{}).(string)
+	return module
+}
+
+// WarmableModule is implemented by modules with structures that are
+// expensive to build, such as tokenizers, so the first request need not pay
+// for them. The host calls Warmup once the module has started and holds
+// readiness until it returns.
+type WarmableModule interface {
+	Warmup(ctx context.Context) error
+}
+
 // ModuleType represents the type of module
 type ModuleType int
 
@@ -120,6 +162,20 @@ type ProcessRequestContext struct {
 	
 	// Configuration
 	ModuleConfig *ModuleConfig `json:"module_config,omitempty"`
+
+	// DryRun marks synthetic requests (e.g. startup self-test) that must not
+	// trigger side effects such as sinks. It is set by in-process callers or
+	// by the pipeline for a trusted principal allowed dry runs, never decoded
+	// from a client request.
+	DryRun bool `json:"-"`
+
+	// BypassModules is set by the pipeline when a trusted internal principal
+	// is validated; those modules are skipped for this request
+	BypassModules []string `json:"bypass_modules,omitempty"`
+
+	// ProviderOverride is set by the pipeline when a trusted internal
+	// principal forces the provider for this request
+	ProviderOverride string `json:"provider_override,omitempty"`
 }
 
 // ProcessResponseContext represents the context for response processing
@@ -146,6 +202,7 @@ type TokenUsage struct {
 	PromptTokens     int64 `json:"prompt_tokens"`
 	CompletionTokens int64 `json:"completion_tokens"`
 	TotalTokens      int64 `json:"total_tokens"`
+	ReasoningTokens  int64 `json:"reasoning_tokens,omitempty"` // part of completion tokens
 }
 
 // ProcessRequestResult represents the result of request processing
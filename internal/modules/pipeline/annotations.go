@@ -0,0 +1,92 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+)
+
+// AnnotationsDroppedAnnotation is the request annotation counting, per
+// module, the annotations dropped for exceeding the annotation limits. It is
+// never dropped itself.
+const AnnotationsDroppedAnnotation = "leash_annotations_dropped"
+
+// AnnotationLimits caps the annotations modules add to a request, so a
+// misbehaving module cannot bloat logs and memory. Annotations beyond a cap
+// are dropped and counted; replacing an existing annotation always succeeds
+// when the new value fits. Zero disables a cap.
+type AnnotationLimits struct {
+	MaxCount      int // annotations one request may carry
+	MaxValueBytes int // JSON size of one annotation value
+}
+
+// SetAnnotationLimits caps the annotations modules add to each request
+func (p *Pipeline) SetAnnotationLimits(limits AnnotationLimits) {
+	p.update(func(s *snapshot) {
+		s.annotations = limits
+	})
+}
+
+// mergeModuleAnnotations merges a module's annotations into the request
+// within the snapshot's limits. Annotations are taken in key order, so the
+// same ones are kept every time a module overflows.
+func (p *Pipeline) mergeModuleAnnotations(s *snapshot, req *interfaces.ProcessRequestContext, module interfaces.Module, annotations map[string]interface{}) {
+	limits := s.annotations
+	if limits.MaxCount <= 0 && limits.MaxValueBytes <= 0 {
+		p.mergeAnnotations(req, annotations)
+		return
+	}
+	if len(annotations) == 0 {
+		return
+	}
+	if req.Annotations == nil {
+		req.Annotations = make(map[string]interface{})
+	}
+
+	keys := make([]string, 0, len(annotations))
+	for key := range annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	dropped := 0
+	for _, key := range keys {
+		value := annotations[key]
+		_, exists := req.Annotations[key]
+		if !exists && limits.MaxCount > 0 && len(req.Annotations) >= limits.MaxCount {
+			dropped++
+			continue
+		}
+		if limits.MaxValueBytes > 0 && annotationSize(value) > limits.MaxValueBytes {
+			dropped++
+			continue
+		}
+		req.Annotations[key] = value
+	}
+	if dropped == 0 {
+		return
+	}
+
+	counts, _ := req.Annotations[AnnotationsDroppedAnnotation].(map[string]int)
+	if counts == nil {
+		counts = make(map[string]int)
+		req.Annotations[AnnotationsDroppedAnnotation] = counts
+	}
+	counts[module.Name()] += dropped
+	p.logger.Warnf("Module %s overflowed the annotation limits on request %s: dropped %d of %d annotations",
+		module.Name(), req.RequestID, dropped, len(annotations))
+	if registry := s.metrics; registry != nil {
+		registry.RecordAnnotationsDropped(module.Name(), dropped)
+	}
+}
+
+// annotationSize returns the JSON size of an annotation value; values that
+// cannot be encoded count as unlimited
+func annotationSize(value interface{}) int {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return int(^uint(0) >> 1)
+	}
+	return len(encoded)
+}
@@ -0,0 +1,202 @@
+package pipeline
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+)
+
+// DefaultBypassHeader carries the internal service token
+const DefaultBypassHeader = "X-Leash-Internal-Token"
+
+// DefaultProviderOverrideHeader names the provider a trusted principal forces
+const DefaultProviderOverrideHeader = "X-Leash-Provider"
+
+// DefaultDryRunHeader marks a trusted principal's request as a dry run
+const DefaultDryRunHeader = "X-Leash-Dry-Run"
+
+// ProviderOverrideMetadata is the request result metadata key carrying a
+// validated provider override to the data plane
+const ProviderOverrideMetadata = "provider_override"
+
+// TrustedPrincipal is an internal service whose requests may skip designated
+// modules. Only the SHA-256 of its token is configured.
+type TrustedPrincipal struct {
+	Name                  string
+	TokenSHA256           string
+	BypassModules         []string
+	AllowProviderOverride bool // may force the provider with the override header
+	AllowDryRun           bool // may mark requests as dry runs with the dry-run header
+}
+
+// BypassConfig configures trusted-principal module bypass
+type BypassConfig struct {
+	Header                 string
+	ProviderOverrideHeader string
+	DryRunHeader           string
+	Principals             []TrustedPrincipal
+}
+
+// SetBypass configures trusted principals allowed to skip modules
+func (p *Pipeline) SetBypass(config BypassConfig) {
+	config = bypassDefaults(config)
+	p.update(func(s *snapshot) {
+		s.bypass = config
+	})
+}
+
+// bypassDefaults fills in the default header names
+func bypassDefaults(config BypassConfig) BypassConfig {
+	if config.Header == "" {
+		config.Header = DefaultBypassHeader
+	}
+	if config.ProviderOverrideHeader == "" {
+		config.ProviderOverrideHeader = DefaultProviderOverrideHeader
+	}
+	if config.DryRunHeader == "" {
+		config.DryRunHeader = DefaultDryRunHeader
+	}
+	return config
+}
+
+// applyBypass validates the internal token on a request, if any, and returns
+// the principal it belongs to. The token header is always removed so modules
+// and sinks never see it; a valid token records the principal and its
+// bypassed modules in annotations for audit.
+func (p *Pipeline) applyBypass(req *interfaces.ProcessRequestContext, config BypassConfig) *TrustedPrincipal {
+	// Only a validated token grants a bypass
+	req.BypassModules = nil
+	headerName := config.Header
+	if headerName == "" {
+		headerName = DefaultBypassHeader
+	}
+
+	header := strings.ToLower(headerName)
+	token, ok := req.Headers[header]
+	if !ok {
+		return nil
+	}
+	delete(req.Headers, header)
+	if len(config.Principals) == 0 {
+		return nil
+	}
+
+	sum := sha256.Sum256([]byte(token))
+	tokenHash := hex.EncodeToString(sum[:])
+
+	for i := range config.Principals {
+		principal := &config.Principals[i]
+		if subtle.ConstantTimeCompare([]byte(tokenHash), []byte(strings.ToLower(principal.TokenSHA256))) != 1 {
+			continue
+		}
+
+		req.BypassModules = principal.BypassModules
+
+		p.mergeAnnotations(req, map[string]interface{}{
+			"trusted_principal": principal.Name,
+			"bypassed_modules":  principal.BypassModules,
+		})
+		p.logger.Infof("Request %s from trusted principal %s bypasses modules %v",
+			req.RequestID, principal.Name, principal.BypassModules)
+		return principal
+	}
+
+	p.logger.Warnf("Request %s carried an invalid internal token", req.RequestID)
+	p.mergeAnnotations(req, map[string]interface{}{"invalid_internal_token": true})
+	return nil
+}
+
+// applyProviderOverride honors the provider override header when the request
+// comes from a principal allowed to use it, replacing the routed provider.
+// The header is always removed; from anyone else it is ignored and the
+// attempt is recorded in annotations. Whether the provider serves the model
+// is checked where the request is routed.
+func (p *Pipeline) applyProviderOverride(req *interfaces.ProcessRequestContext, config BypassConfig, principal *TrustedPrincipal) {
+	headerName := config.ProviderOverrideHeader
+	if headerName == "" {
+		headerName = DefaultProviderOverrideHeader
+	}
+
+	req.ProviderOverride = ""
+	header := strings.ToLower(headerName)
+	provider, ok := req.Headers[header]
+	if !ok {
+		return
+	}
+	delete(req.Headers, header)
+	provider = strings.TrimSpace(provider)
+	if provider == "" {
+		return
+	}
+
+	if principal == nil || !principal.AllowProviderOverride {
+		p.logger.Warnf("Request %s carried a provider override from an untrusted caller, ignoring it", req.RequestID)
+		p.mergeAnnotations(req, map[string]interface{}{"provider_override_ignored": provider})
+		return
+	}
+
+	req.ProviderOverride = provider
+	req.Provider = provider
+	p.mergeAnnotations(req, map[string]interface{}{"provider_override": provider})
+	p.logger.Infof("Request %s from trusted principal %s overrides its provider to %s",
+		req.RequestID, principal.Name, provider)
+}
+
+// applyDryRun honors the dry-run header when the request comes from a
+// principal allowed to use it, so the request runs without side effects. The
+// header is always removed; from anyone else it is ignored and the attempt is
+// recorded in annotations. Requests marked as dry runs by in-process callers,
+// such as the startup self-test, stay dry runs.
+func (p *Pipeline) applyDryRun(req *interfaces.ProcessRequestContext, config BypassConfig, principal *TrustedPrincipal) {
+	headerName := config.DryRunHeader
+	if headerName == "" {
+		headerName = DefaultDryRunHeader
+	}
+
+	header := strings.ToLower(headerName)
+	value, ok := req.Headers[header]
+	if !ok {
+		return
+	}
+	delete(req.Headers, header)
+	if dryRun, err := strconv.ParseBool(strings.TrimSpace(value)); err != nil || !dryRun {
+		return
+	}
+
+	if principal == nil || !principal.AllowDryRun {
+		p.logger.Warnf("Request %s asked for a dry run from an untrusted caller, ignoring it", req.RequestID)
+		p.mergeAnnotations(req, map[string]interface{}{"dry_run_ignored": true})
+		return
+	}
+
+	req.DryRun = true
+	p.mergeAnnotations(req, map[string]interface{}{"dry_run": true})
+	p.logger.Infof("Request %s from trusted principal %s is a dry run", req.RequestID, principal.Name)
+}
+
+// providerOverrideMetadata returns the result metadata carrying a request's
+// provider override, or nil when it has none
+func providerOverrideMetadata(req *interfaces.ProcessRequestContext) map[string]string {
+	if req.ProviderOverride == "" {
+		return nil
+	}
+	return map[string]string{ProviderOverrideMetadata: req.ProviderOverride}
+}
+
+// bypassed reports whether a validated grant lets the request skip a module.
+// Sinks are never bypassed so trusted traffic stays audited.
+func bypassed(module interfaces.Module, req *interfaces.ProcessRequestContext) bool {
+	if module.Type() == interfaces.ModuleTypeSink {
+		return false
+	}
+	for _, name := range req.BypassModules {
+		if name == module.Name() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,208 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/deadletter"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+)
+
+// deadLetterQueue keeps sink events that failed to deliver for replay
+type deadLetterQueue struct {
+	store       deadletter.Store
+	maxAttempts int // replays before an event is left parked in the store; 0 is unlimited
+	replayMu    sync.Mutex
+	stop        chan struct{}
+	stopped     chan struct{}
+}
+
+// SetDeadLetter makes failed sink deliveries go to a dead-letter store
+// instead of being dropped. Events are delivered again by ReplayDeadLetters;
+// those that have failed maxAttempts times (when positive) stay in the store
+// for inspection but are no longer replayed.
+func (p *Pipeline) SetDeadLetter(store deadletter.Store, maxAttempts int) {
+	var queue *deadLetterQueue
+	if store != nil {
+		queue = &deadLetterQueue{store: store, maxAttempts: maxAttempts}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.deadLetters = queue
+}
+
+// deadLetter stores a failed sink delivery; resp is nil for request sinks
+func (p *Pipeline) deadLetter(module interfaces.Module, req *interfaces.ProcessRequestContext, resp *interfaces.ProcessResponseContext, err error) {
+	p.mu.RLock()
+	queue := p.deadLetters
+	p.mu.RUnlock()
+	if queue == nil {
+		return
+	}
+
+	event := deadletter.Event{
+		Sink:     module.Name(),
+		Phase:    deadletter.PhaseRequest,
+		Reason:   err.Error(),
+		Attempts: 1,
+		FailedAt: time.Now(),
+	}
+	if resp != nil {
+		event.Phase = deadletter.PhaseResponse
+		event.Response = copyResponse(resp)
+	} else {
+		event.Request = copyRequest(req)
+	}
+
+	if err := queue.store.Append(event); err != nil {
+		p.logger.Errorf("Failed to dead-letter sink %s event for request %s: %v", event.Sink, event.RequestID(), err)
+	}
+}
+
+// ReplayDeadLetters delivers dead-lettered events to their sinks again and
+// returns how many were delivered. Events that fail again go back to the
+// store with their attempt count raised.
+func (p *Pipeline) ReplayDeadLetters(ctx context.Context) (int, error) {
+	p.mu.RLock()
+	queue := p.deadLetters
+	p.mu.RUnlock()
+	if queue == nil {
+		return 0, fmt.Errorf("dead-letter store is not configured")
+	}
+
+	// One replay at a time, so an event is never delivered twice concurrently
+	queue.replayMu.Lock()
+	defer queue.replayMu.Unlock()
+
+	events, err := queue.store.Take()
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for _, event := range events {
+		if queue.maxAttempts > 0 && event.Attempts >= queue.maxAttempts {
+			p.requeue(queue, event)
+			continue
+		}
+
+		if err := p.redeliver(ctx, event); err != nil {
+			event.Attempts++
+			event.Reason = err.Error()
+			event.FailedAt = time.Now()
+			p.requeue(queue, event)
+			continue
+		}
+		delivered++
+	}
+
+	if delivered > 0 || len(events) > 0 {
+		p.logger.Infof("Replayed dead-lettered sink events: %d of %d delivered", delivered, len(events))
+	}
+	return delivered, nil
+}
+
+// redeliver runs the event's sink on its stored request or response
+func (p *Pipeline) redeliver(ctx context.Context, event deadletter.Event) error {
+	module := p.findSink(event.Sink)
+	if module == nil {
+		return fmt.Errorf("sink %s not found", event.Sink)
+	}
+
+	switch event.Phase {
+	case deadletter.PhaseResponse:
+		if event.Response == nil || event.Response.ProcessRequestContext == nil {
+			return fmt.Errorf("dead-letter event has no response")
+		}
+		_, err := p.runResponseModuleWithTimeout(ctx, module, event.Response)
+		return err
+	default:
+		if event.Request == nil {
+			return fmt.Errorf("dead-letter event has no request")
+		}
+		_, err := p.runModuleWithTimeout(ctx, module, event.Request)
+		return err
+	}
+}
+
+// requeue returns an undelivered event to the store
+func (p *Pipeline) requeue(queue *deadLetterQueue, event deadletter.Event) {
+	if err := queue.store.Append(event); err != nil {
+		p.logger.Errorf("Failed to requeue dead-lettered sink %s event for request %s: %v", event.Sink, event.RequestID(), err)
+	}
+}
+
+// findSink returns the sink with the given name, or nil
+func (p *Pipeline) findSink(name string) interfaces.Module {
+	for _, sink := range p.current().sinks {
+		if sink.Name() == name {
+			return sink
+		}
+	}
+	return nil
+}
+
+// StartDeadLetterRetry replays dead-lettered events in the background every
+// interval until StopDeadLetterRetry is called
+func (p *Pipeline) StartDeadLetterRetry(interval time.Duration) {
+	p.mu.Lock()
+	queue := p.deadLetters
+	if queue == nil || queue.stop != nil || interval <= 0 {
+		p.mu.Unlock()
+		return
+	}
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	queue.stop, queue.stopped = stop, stopped
+	p.mu.Unlock()
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := p.ReplayDeadLetters(context.Background()); err != nil {
+					p.logger.Errorf("Dead-letter replay failed: %v", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopDeadLetterRetry stops background replay, waiting for a replay in
+// progress to finish
+func (p *Pipeline) StopDeadLetterRetry() {
+	p.mu.Lock()
+	queue := p.deadLetters
+	if queue == nil || queue.stop == nil {
+		p.mu.Unlock()
+		return
+	}
+	stop, stopped := queue.stop, queue.stopped
+	queue.stop = nil
+	p.mu.Unlock()
+
+	close(stop)
+	<-stopped
+}
+
+// copyRequest copies a request for storage, without the per-module config
+func copyRequest(req *interfaces.ProcessRequestContext) *interfaces.ProcessRequestContext {
+	copied := *req
+	copied.ModuleConfig = nil
+	return &copied
+}
+
+// copyResponse copies a response and its request for storage
+func copyResponse(resp *interfaces.ProcessResponseContext) *interfaces.ProcessResponseContext {
+	copied := *resp
+	copied.ProcessRequestContext = copyRequest(resp.ProcessRequestContext)
+	return &copied
+}
@@ -0,0 +1,152 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+)
+
+// DecisionSummaryAnnotation is the request annotation holding the
+// DecisionSummary when decision summaries are enabled
+const DecisionSummaryAnnotation = "leash_decision"
+
+// DecisionSummary consolidates the outcome of every module that ran on a
+// request, so downstream systems need not interpret per-module annotations
+type DecisionSummary struct {
+	Action           string           `json:"action"` // block, transform or continue
+	BlockedBy        string           `json:"blocked_by,omitempty"`
+	Reason           string           `json:"reason,omitempty"`
+	Modules          []ModuleDecision `json:"modules"`    // modules that acted, flagged the request or failed
+	RiskScore        float64          `json:"risk_score"` // highest confidence reported by any module
+	EstimatedCostUSD float64          `json:"estimated_cost_usd,omitempty"`
+}
+
+// ModuleDecision is one module's contribution to a DecisionSummary
+type ModuleDecision struct {
+	Module     string  `json:"module"`
+	Type       string  `json:"type"`
+	Action     string  `json:"action"` // the module's action, or "error" when it failed
+	Confidence float64 `json:"confidence,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// decisionTrace collects the module decisions of one request
+type decisionTrace struct {
+	mu        sync.Mutex
+	modules   []ModuleDecision
+	blockedBy string
+}
+
+// decisionTraceKey carries a request's decisionTrace in its context
+type decisionTraceKey struct{}
+
+// SetDecisionSummary makes the pipeline attach a DecisionSummary to every
+// request decision under the leash_decision annotation. Sinks and block
+// observers see it alongside the other annotations.
+func (p *Pipeline) SetDecisionSummary(enabled bool) {
+	p.update(func(s *snapshot) {
+		s.decisionSummary = enabled
+	})
+}
+
+// traceDecisions returns a context collecting module decisions, or ctx and
+// nil when decision summaries are disabled
+func (p *Pipeline) traceDecisions(ctx context.Context) (context.Context, *decisionTrace) {
+	if !p.snapshotOf(ctx).decisionSummary {
+		return ctx, nil
+	}
+	trace := &decisionTrace{}
+	return context.WithValue(ctx, decisionTraceKey{}, trace), trace
+}
+
+// recordDecision adds a module's result or error to the request's trace, if
+// decisions are being collected
+func recordDecision(ctx context.Context, module interfaces.Module, result *interfaces.ProcessRequestResult, err error) {
+	trace, _ := ctx.Value(decisionTraceKey{}).(*decisionTrace)
+	if trace == nil {
+		return
+	}
+
+	decision := ModuleDecision{Module: module.Name(), Type: module.Type().String()}
+	switch {
+	case err != nil:
+		decision.Action = "error"
+		decision.Error = err.Error()
+	case result != nil:
+		decision.Action = result.Action.String()
+		decision.Confidence = resultConfidence(result)
+	default:
+		decision.Action = interfaces.ActionContinue.String()
+	}
+
+	trace.mu.Lock()
+	trace.modules = append(trace.modules, decision)
+	trace.mu.Unlock()
+}
+
+// recordBlocker notes the module that blocked the request; the first wins
+func recordBlocker(ctx context.Context, module interfaces.Module) {
+	trace, _ := ctx.Value(decisionTraceKey{}).(*decisionTrace)
+	if trace == nil {
+		return
+	}
+	trace.mu.Lock()
+	if trace.blockedBy == "" {
+		trace.blockedBy = module.Name()
+	}
+	trace.mu.Unlock()
+}
+
+// resultConfidence is the confidence a module reported, either on its result
+// or, as the content filter does, in a confidence annotation
+func resultConfidence(result *interfaces.ProcessRequestResult) float64 {
+	confidence := result.Confidence
+	if annotated, ok := result.Annotations["confidence"].(float64); ok && annotated > confidence {
+		confidence = annotated
+	}
+	return confidence
+}
+
+// summarize builds the summary of a request decided with action
+func (t *decisionTrace) summarize(req *interfaces.ProcessRequestContext, action interfaces.Action, reason string) DecisionSummary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	summary := DecisionSummary{
+		Action:    action.String(),
+		BlockedBy: t.blockedBy,
+		Reason:    reason,
+		Modules:   make([]ModuleDecision, 0, len(t.modules)),
+	}
+	for _, decision := range t.modules {
+		contributed := decision.Error != "" || decision.Confidence > 0 ||
+			decision.Action != interfaces.ActionContinue.String() || decision.Module == t.blockedBy
+		if !contributed {
+			continue
+		}
+		summary.Modules = append(summary.Modules, decision)
+		if decision.Confidence > summary.RiskScore {
+			summary.RiskScore = decision.Confidence
+		}
+		if action != interfaces.ActionBlock && decision.Action == interfaces.ActionTransform.String() {
+			summary.Action = interfaces.ActionTransform.String()
+		}
+	}
+	if cost, ok := req.Annotations["estimated_cost_usd"].(float64); ok {
+		summary.EstimatedCostUSD = cost
+	}
+	return summary
+}
+
+// summarizeBlock attaches the decision summary to a blocked result. It must
+// run before block observers are notified.
+func summarizeBlock(trace *decisionTrace, req *interfaces.ProcessRequestContext, result *interfaces.ProcessRequestResult) {
+	if trace == nil {
+		return
+	}
+	if result.Annotations == nil {
+		result.Annotations = make(map[string]interface{})
+	}
+	result.Annotations[DecisionSummaryAnnotation] = trace.summarize(req, interfaces.ActionBlock, result.BlockReason)
+}
@@ -0,0 +1,169 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+)
+
+// DegradedAnnotation marks requests processed while the pipeline is degraded
+const DegradedAnnotation = "pipeline_degraded"
+
+// DegradedConfig configures degraded mode: once a module fails
+// FailureThreshold times in a row, as when a store or external classifier it
+// depends on is down, the NonEssential modules are skipped so traffic keeps
+// flowing. Every other module still runs, and policies among them still fail
+// closed. The pipeline recovers once Cooldown passes without a module
+// failure.
+type DegradedConfig struct {
+	FailureThreshold int           // consecutive failures of one module; 0 disables degraded mode
+	Cooldown         time.Duration // time without failures before leaving degraded mode
+	NonEssential     []string      // modules skipped while degraded
+}
+
+// DegradedStatus reports whether the pipeline is degraded and why
+type DegradedStatus struct {
+	Degraded    bool      `json:"degraded"`
+	Module      string    `json:"module,omitempty"` // the failing module that degraded the pipeline
+	Reason      string    `json:"reason,omitempty"`
+	Since       time.Time `json:"since,omitempty"`
+	LastFailure time.Time `json:"last_failure,omitempty"`
+}
+
+// degradedMode tracks consecutive module failures and the degraded state
+// they lead to. A module's failure count is kept until it succeeds, so after
+// the cooldown a single further failure degrades the pipeline again.
+type degradedMode struct {
+	config       DegradedConfig
+	nonEssential map[string]bool
+
+	mu       sync.Mutex
+	failures map[string]int
+	status   DegradedStatus
+}
+
+// SetDegradedMode configures degraded mode; a zero FailureThreshold
+// disables it. The pipeline starts out healthy.
+func (p *Pipeline) SetDegradedMode(config DegradedConfig) {
+	degraded := newDegradedMode(config)
+	p.update(func(s *snapshot) {
+		s.degraded = degraded
+	})
+	p.recordDegraded(false)
+}
+
+// newDegradedMode returns the tracker for config, or nil when disabled
+func newDegradedMode(config DegradedConfig) *degradedMode {
+	if config.FailureThreshold <= 0 {
+		return nil
+	}
+	d := &degradedMode{
+		config:       config,
+		nonEssential: make(map[string]bool, len(config.NonEssential)),
+		failures:     make(map[string]int),
+	}
+	for _, name := range config.NonEssential {
+		d.nonEssential[name] = true
+	}
+	return d
+}
+
+// DegradedStatus returns the pipeline's degraded state
+func (p *Pipeline) DegradedStatus() DegradedStatus {
+	d := p.current().degraded
+	if d == nil {
+		return DegradedStatus{}
+	}
+	p.checkRecovered(d)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.status
+}
+
+// observeOutcome counts a module's failure toward degrading the pipeline, or
+// clears its count on success. Failures caused by the request's own context
+// ending say nothing about the module's dependencies and are ignored.
+func (p *Pipeline) observeOutcome(ctx context.Context, module interfaces.Module, err error) {
+	d := p.snapshotOf(ctx).degraded
+	if d == nil || (err != nil && ctx.Err() != nil) {
+		return
+	}
+
+	d.mu.Lock()
+	if err == nil {
+		delete(d.failures, module.Name())
+		d.mu.Unlock()
+		return
+	}
+	d.failures[module.Name()]++
+	entered := false
+	now := time.Now()
+	if d.status.Degraded {
+		d.status.LastFailure = now
+	} else if d.failures[module.Name()] >= d.config.FailureThreshold {
+		d.status = DegradedStatus{
+			Degraded:    true,
+			Module:      module.Name(),
+			Reason:      err.Error(),
+			Since:       now,
+			LastFailure: now,
+		}
+		entered = true
+	}
+	failures := d.failures[module.Name()]
+	d.mu.Unlock()
+
+	if entered {
+		p.logger.Warnf("Pipeline degraded after %d consecutive failures of module %s, bypassing non-essential modules %v: %v",
+			failures, module.Name(), d.config.NonEssential, err)
+		p.recordDegraded(true)
+	}
+}
+
+// degradedBypass reports whether a module is skipped because the pipeline
+// is degraded
+func (p *Pipeline) degradedBypass(ctx context.Context, module interfaces.Module) bool {
+	d := p.snapshotOf(ctx).degraded
+	if d == nil || !d.nonEssential[module.Name()] {
+		return false
+	}
+	return p.checkRecovered(d)
+}
+
+// applyDegraded annotates a request processed while the pipeline is degraded
+func (p *Pipeline) applyDegraded(s *snapshot, req *interfaces.ProcessRequestContext) {
+	if s.degraded != nil && p.checkRecovered(s.degraded) {
+		p.mergeAnnotations(req, map[string]interface{}{DegradedAnnotation: true})
+	}
+}
+
+// checkRecovered leaves degraded mode once the cooldown has passed since the
+// last failure, and reports whether the pipeline is still degraded
+func (p *Pipeline) checkRecovered(d *degradedMode) bool {
+	d.mu.Lock()
+	if !d.status.Degraded {
+		d.mu.Unlock()
+		return false
+	}
+	if time.Since(d.status.LastFailure) < d.config.Cooldown {
+		d.mu.Unlock()
+		return true
+	}
+	recovered := d.status
+	d.status = DegradedStatus{}
+	d.mu.Unlock()
+
+	p.logger.Infof("Pipeline recovered from degraded mode entered on module %s failures, degraded for %v",
+		recovered.Module, time.Since(recovered.Since).Round(time.Millisecond))
+	p.recordDegraded(false)
+	return false
+}
+
+// recordDegraded sets the degraded gauge if metrics are enabled
+func (p *Pipeline) recordDegraded(degraded bool) {
+	if registry := p.current().metrics; registry != nil {
+		registry.RecordPipelineDegraded(degraded)
+	}
+}
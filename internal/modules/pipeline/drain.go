@@ -0,0 +1,44 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrDraining is returned for requests that arrive after Drain has started
+var ErrDraining = errors.New("pipeline is draining")
+
+// begin registers an in-flight request or response, failing once the
+// pipeline is draining. Callers must call p.inflight.Done when finished.
+func (p *Pipeline) begin() error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.draining {
+		return ErrDraining
+	}
+	p.inflight.Add(1)
+	return nil
+}
+
+// Drain stops the pipeline accepting new work and waits for in-flight
+// requests, responses and asynchronous sinks to finish, or for ctx to end
+func (p *Pipeline) Drain(ctx context.Context) error {
+	p.mu.Lock()
+	p.draining = true
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.logger.Infof("Pipeline drained")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("pipeline drain interrupted: %w", ctx.Err())
+	}
+}
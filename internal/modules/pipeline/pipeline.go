@@ -3,32 +3,51 @@ package pipeline
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/bendiamant/leash-gateway/internal/gatewayerrors"
+	"github.com/bendiamant/leash-gateway/internal/killswitch"
+	"github.com/bendiamant/leash-gateway/internal/metrics"
 	"github.com/bendiamant/leash-gateway/internal/modules/interface"
 	"go.uber.org/zap"
 )
 
-// Pipeline manages the execution of modules in the correct order
+// Pipeline manages the execution of modules in the correct order. Its
+// modules and options form an immutable snapshot that every change replaces
+// atomically, so requests read them without locking and always see one
+// consistent configuration.
 type Pipeline struct {
-	inspectors   []interfaces.Module
-	policies     []interfaces.Module
-	transformers []interfaces.Module
-	sinks        []interfaces.Module
-	logger       *zap.SugaredLogger
-	mu           sync.RWMutex
+	snapshot    atomic.Pointer[snapshot]
+	logger      *zap.SugaredLogger
+	deadLetters *deadLetterQueue
+	draining    bool
+	inflight    sync.WaitGroup // in-flight requests, responses and async sinks
+	mu          sync.RWMutex   // serializes changes; guards deadLetters and draining
 }
 
 // NewPipeline creates a new module pipeline
 func NewPipeline(logger *zap.SugaredLogger) *Pipeline {
-	return &Pipeline{
-		inspectors:   make([]interfaces.Module, 0),
-		policies:     make([]interfaces.Module, 0),
-		transformers: make([]interfaces.Module, 0),
-		sinks:        make([]interfaces.Module, 0),
-		logger:       logger,
-	}
+	p := &Pipeline{logger: logger}
+	p.snapshot.Store(&snapshot{})
+	return p
+}
+
+// SetMetrics enables module error metrics for the pipeline
+func (p *Pipeline) SetMetrics(registry *metrics.Registry) {
+	p.update(func(s *snapshot) {
+		s.metrics = registry
+	})
+}
+
+// SetKillSwitch makes the pipeline block requests matching engaged kill-switch
+// rules before any module runs
+func (p *Pipeline) SetKillSwitch(ks *killswitch.Switch) {
+	p.update(func(s *snapshot) {
+		s.killSwitch = ks
+	})
 }
 
 // AddModule adds a module to the appropriate pipeline stage
@@ -36,211 +55,403 @@ func (p *Pipeline) AddModule(module interfaces.Module) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	switch module.Type() {
-	case interfaces.ModuleTypeInspector:
-		p.inspectors = append(p.inspectors, module)
-	case interfaces.ModuleTypePolicy:
-		p.policies = append(p.policies, module)
-	case interfaces.ModuleTypeTransformer:
-		p.transformers = append(p.transformers, module)
-	case interfaces.ModuleTypeSink:
-		p.sinks = append(p.sinks, module)
-	default:
-		return fmt.Errorf("unknown module type: %s", module.Type().String())
+	next := *p.current()
+	if err := next.addModule(module); err != nil {
+		return err
 	}
+	next.generation++
+	p.snapshot.Store(&next)
 
 	p.logger.Infof("Added module %s to %s pipeline", module.Name(), module.Type().String())
 	return nil
 }
 
-// RemoveModule removes a module from the pipeline
-func (p *Pipeline) RemoveModule(name string) error {
+// ReplaceModule swaps the module of the same name for module in a single
+// change, so no request runs against a pipeline holding neither
+func (p *Pipeline) ReplaceModule(module interfaces.Module) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	// Remove from all pipeline stages
-	p.inspectors = p.removeModuleFromSlice(p.inspectors, name)
-	p.policies = p.removeModuleFromSlice(p.policies, name)
-	p.transformers = p.removeModuleFromSlice(p.transformers, name)
-	p.sinks = p.removeModuleFromSlice(p.sinks, name)
+	name := module.Name()
+	next := *p.current()
+	next.inspectors = p.removeModuleFromSlice(next.inspectors, name)
+	next.policies = p.removeModuleFromSlice(next.policies, name)
+	next.transformers = p.removeModuleFromSlice(next.transformers, name)
+	next.sinks = p.removeModuleFromSlice(next.sinks, name)
+	if err := next.addModule(module); err != nil {
+		return err
+	}
+	next.generation++
+	p.snapshot.Store(&next)
+
+	p.logger.Infof("Replaced module %s in %s pipeline", name, module.Type().String())
+	return nil
+}
+
+// RemoveModule removes a module from the pipeline
+func (p *Pipeline) RemoveModule(name string) error {
+	p.update(func(s *snapshot) {
+		// Remove from all pipeline stages
+		s.inspectors = p.removeModuleFromSlice(s.inspectors, name)
+		s.policies = p.removeModuleFromSlice(s.policies, name)
+		s.transformers = p.removeModuleFromSlice(s.transformers, name)
+		s.sinks = p.removeModuleFromSlice(s.sinks, name)
+	})
 
 	p.logger.Infof("Removed module %s from pipeline", name)
 	return nil
 }
 
-// removeModuleFromSlice removes a module from a slice by name
+// removeModuleFromSlice returns a copy of a slice without the named module
 func (p *Pipeline) removeModuleFromSlice(modules []interfaces.Module, name string) []interfaces.Module {
 	for i, module := range modules {
 		if module.Name() == name {
-			return append(modules[:i], modules[i+1:]...)
+			return append(append(make([]interfaces.Module, 0, len(modules)-1), modules[:i]...), modules[i+1:]...)
 		}
 	}
 	return modules
 }
 
+// appendModule returns a copy of a slice with the module added, leaving the
+// slice held by in-flight requests untouched
+func appendModule(modules []interfaces.Module, module interfaces.Module) []interfaces.Module {
+	return append(modules[:len(modules):len(modules)], module)
+}
+
 // ProcessRequest processes a request through the module pipeline
 func (p *Pipeline) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequestContext) (*interfaces.ProcessRequestResult, error) {
 	start := time.Now()
+	if err := p.begin(); err != nil {
+		return nil, err
+	}
+	defer p.inflight.Done()
+	s := p.current()
+	ctx = withSnapshot(ctx, s)
+	ctx, timings := p.trackTimings(ctx)
+	defer p.checkSlowRequest(req, "request", start, timings, 0, 0)
+	ctx, trace := p.traceDecisions(ctx)
 	
 	p.logger.Debugf("Processing request %s through pipeline", req.RequestID)
 
-	// Phase 1: Run inspectors in parallel (fail-open)
-	inspectionResults := p.runInspectorsParallel(ctx, req)
+	// The kill switch is evaluated first and cannot be bypassed
+	if ks := s.killSwitch; ks != nil {
+		if rule := ks.Match(req.TenantID, req.Model); rule != nil {
+			p.logger.Warnf("Request %s blocked by kill switch %s", req.RequestID, rule.ID)
+			return &interfaces.ProcessRequestResult{
+				Action:         interfaces.ActionBlock,
+				BlockReason:    rule.Message,
+				ProcessingTime: time.Since(start),
+				Annotations: map[string]interface{}{
+					"kill_switch": rule.ID,
+				},
+				Metadata: map[string]string{
+					"status_code": "503",
+				},
+			}, nil
+		}
+	}
+
+	// Trusted internal services may skip designated modules, force the
+	// provider and ask for a dry run
+	principal := p.applyBypass(req, s.bypass)
+	p.applyProviderOverride(req, s.bypass, principal)
+	p.applyDryRun(req, s.bypass, principal)
+	p.applyDegraded(s, req)
+
+	// Fast path: when no module would run, nothing can change the request
+	if p.skipsAll(ctx, req) {
+		if trace != nil {
+			p.mergeAnnotations(req, map[string]interface{}{DecisionSummaryAnnotation: trace.summarize(req, interfaces.ActionContinue, "")})
+		}
+		return &interfaces.ProcessRequestResult{
+			Action:         interfaces.ActionContinue,
+			ProcessingTime: time.Since(start),
+			Annotations:    req.Annotations,
+			Metadata:       providerOverrideMetadata(req),
+		}, nil
+	}
+
+	// Phase 1: Run inspectors in parallel (fail-open unless configured to
+	// fail closed on timeout)
+	inspectionResults, blocked, blocker := p.runInspectorsParallel(ctx, req)
+	if blocked != nil {
+		summarizeBlock(trace, req, blocked)
+		p.notifyBlocked(ctx, req, blocked, blocker)
+		return blocked, nil
+	}
 	
 	// Merge inspection annotations
 	if req.Annotations == nil {
 		req.Annotations = make(map[string]interface{})
 	}
-	for _, result := range inspectionResults {
-		for key, value := range result.Annotations {
-			req.Annotations[key] = value
-		}
+	var headers map[string]string
+	for _, inspection := range inspectionResults {
+		p.mergeModuleAnnotations(s, req, inspection.module, inspection.result.Annotations)
+		headers = mergeHeaders(headers, inspection.result.AdditionalHeaders)
 	}
 
 	// Phase 2: Run policies sequentially (fail-closed)
-	p.mu.RLock()
-	policies := make([]interfaces.Module, len(p.policies))
-	copy(policies, p.policies)
-	p.mu.RUnlock()
-
-	for _, policy := range policies {
-		if !p.shouldRunModule(policy, req) {
+	for _, policy := range s.policies {
+		if !p.shouldRunModule(ctx, policy, req) {
 			continue
 		}
 
 		result, err := p.runModuleWithTimeout(ctx, policy, req)
 		if err != nil {
+			p.recordModuleError(policy, req, err)
+			if !s.failsClosed(policy, err) {
+				p.logger.Warnf("Policy %s failed open: %v", policy.Name(), err)
+				continue
+			}
 			p.logger.Errorf("Policy %s failed: %v", policy.Name(), err)
-			return &interfaces.ProcessRequestResult{
+			blocked := &interfaces.ProcessRequestResult{
 				Action:      interfaces.ActionBlock,
 				BlockReason: fmt.Sprintf("Policy %s failed: %v", policy.Name(), err),
-			}, nil
+			}
+			recordBlocker(ctx, policy)
+			summarizeBlock(trace, req, blocked)
+			p.notifyBlocked(ctx, req, blocked, policy.Name())
+			return blocked, nil
 		}
 
 		if result.Action == interfaces.ActionBlock {
 			p.logger.Warnf("Request %s blocked by policy %s: %s", 
 				req.RequestID, policy.Name(), result.BlockReason)
+			recordBlocker(ctx, policy)
+			summarizeBlock(trace, req, result)
+			p.notifyBlocked(ctx, req, result, policy.Name())
 			return result, nil
 		}
 
+		// Policies may enforce by rewriting the request (e.g. truncation, redaction)
+		if result.Action == interfaces.ActionTransform && len(result.ModifiedBody) > 0 {
+			p.recordTransformDiff(s, req, policy, "request", req.Body, result.ModifiedBody)
+			req.Body = result.ModifiedBody
+			p.logger.Debugf("Request %s transformed by policy %s", req.RequestID, policy.Name())
+		}
+
 		// Merge annotations
-		p.mergeAnnotations(req, result.Annotations)
+		p.mergeModuleAnnotations(s, req, policy, result.Annotations)
+		headers = mergeHeaders(headers, result.AdditionalHeaders)
 	}
 
 	// Phase 3: Run transformers sequentially
-	p.mu.RLock()
-	transformers := make([]interfaces.Module, len(p.transformers))
-	copy(transformers, p.transformers)
-	p.mu.RUnlock()
-
-	for _, transformer := range transformers {
-		if !p.shouldRunModule(transformer, req) {
+	for _, transformer := range s.transformers {
+		if !p.shouldRunModule(ctx, transformer, req) {
 			continue
 		}
 
 		result, err := p.runModuleWithTimeout(ctx, transformer, req)
 		if err != nil {
+			p.recordModuleError(transformer, req, err)
+			if s.failsClosed(transformer, err) {
+				p.logger.Errorf("Transformer %s failed closed: %v", transformer.Name(), err)
+				blocked := &interfaces.ProcessRequestResult{
+					Action:      interfaces.ActionBlock,
+					BlockReason: fmt.Sprintf("Transformer %s failed: %v", transformer.Name(), err),
+				}
+				recordBlocker(ctx, transformer)
+				summarizeBlock(trace, req, blocked)
+				p.notifyBlocked(ctx, req, blocked, transformer.Name())
+				return blocked, nil
+			}
 			// Log error but continue (non-critical)
 			p.logger.Warnf("Transformer %s failed: %v", transformer.Name(), err)
 			continue
 		}
 
 		if result.Action == interfaces.ActionTransform && len(result.ModifiedBody) > 0 {
+			p.recordTransformDiff(s, req, transformer, "request", req.Body, result.ModifiedBody)
 			req.Body = result.ModifiedBody
 			p.logger.Debugf("Request %s transformed by %s", req.RequestID, transformer.Name())
 		}
 
 		// Merge annotations
-		p.mergeAnnotations(req, result.Annotations)
+		p.mergeModuleAnnotations(s, req, transformer, result.Annotations)
+		headers = mergeHeaders(headers, result.AdditionalHeaders)
+	}
+
+	// Summarize before sinks start reading the annotations
+	if trace != nil {
+		p.mergeAnnotations(req, map[string]interface{}{DecisionSummaryAnnotation: trace.summarize(req, interfaces.ActionContinue, "")})
 	}
 
-	// Phase 4: Run sinks (fire-and-forget)
-	go p.runSinksAsync(context.Background(), req)
+	// Phase 4: Run sinks (fire-and-forget); dry runs have no side effects
+	if !req.DryRun {
+		p.inflight.Add(1)
+		go p.runSinksAsync(withSnapshot(context.Background(), s), req)
+	}
 
 	processingTime := time.Since(start)
 	p.logger.Debugf("Request %s processed through pipeline in %v", req.RequestID, processingTime)
 
 	return &interfaces.ProcessRequestResult{
-		Action:         interfaces.ActionContinue,
-		ProcessingTime: processingTime,
-		Annotations:    req.Annotations,
+		Action:            interfaces.ActionContinue,
+		ProcessingTime:    processingTime,
+		Annotations:       req.Annotations,
+		AdditionalHeaders: headers,
+		Metadata:          providerOverrideMetadata(req),
 	}, nil
 }
 
 // ProcessResponse processes a response through the module pipeline
 func (p *Pipeline) ProcessResponse(ctx context.Context, resp *interfaces.ProcessResponseContext) (*interfaces.ProcessResponseResult, error) {
 	start := time.Now()
+	if err := p.begin(); err != nil {
+		return nil, err
+	}
+	defer p.inflight.Done()
+	s := p.current()
+	ctx = withSnapshot(ctx, s)
+	ctx, timings := p.trackTimings(ctx)
+	defer p.checkSlowRequest(resp.ProcessRequestContext, "response", start, timings, resp.ProviderLatency, resp.TotalLatency)
 	
 	p.logger.Debugf("Processing response %s through pipeline", resp.RequestID)
 
 	// Run response transformers
-	p.mu.RLock()
-	transformers := make([]interfaces.Module, len(p.transformers))
-	copy(transformers, p.transformers)
-	p.mu.RUnlock()
-
-	for _, transformer := range transformers {
-		if !p.shouldRunModuleForResponse(transformer, resp) {
+	var headers map[string]string
+	var decision *interfaces.ProcessResponseResult
+	for _, transformer := range s.transformers {
+		if !p.shouldRunModuleForResponse(ctx, transformer, resp) {
 			continue
 		}
 
 		result, err := p.runResponseModuleWithTimeout(ctx, transformer, resp)
 		if err != nil {
+			p.recordModuleError(transformer, resp.ProcessRequestContext, err)
+			if s.failsClosed(transformer, err) {
+				p.logger.Errorf("Response transformer %s failed closed: %v", transformer.Name(), err)
+				decision = &interfaces.ProcessResponseResult{
+					Action: interfaces.ActionBlock,
+					Metadata: map[string]string{
+						"status_code":  "502",
+						"block_reason": fmt.Sprintf("Response transformer %s failed: %v", transformer.Name(), err),
+					},
+				}
+				break
+			}
 			p.logger.Warnf("Response transformer %s failed: %v", transformer.Name(), err)
 			continue
 		}
 
 		if result.Action == interfaces.ActionTransform && len(result.ModifiedBody) > 0 {
+			p.recordTransformDiff(s, resp.ProcessRequestContext, transformer, "response", resp.ResponseBody, result.ModifiedBody)
 			resp.ResponseBody = result.ModifiedBody
 			p.logger.Debugf("Response %s transformed by %s", resp.RequestID, transformer.Name())
 		}
 
 		// Merge annotations
-		p.mergeAnnotations(resp.ProcessRequestContext, result.Annotations)
+		p.mergeModuleAnnotations(s, resp.ProcessRequestContext, transformer, result.Annotations)
+		headers = mergeHeaders(headers, result.ModifiedHeaders)
+
+		// A transformer rejecting the response (e.g. invalid structured
+		// output) ends the phase; sinks still see the original response
+		if result.Action == interfaces.ActionRetry || result.Action == interfaces.ActionBlock {
+			p.logger.Warnf("Response %s rejected by %s with action %s", resp.RequestID, transformer.Name(), result.Action)
+			decision = result
+			break
+		}
 	}
 
+	p.recordTokens(resp)
+
 	// Run response sinks
-	go p.runResponseSinksAsync(context.Background(), resp)
+	p.inflight.Add(1)
+	go p.runResponseSinksAsync(withSnapshot(context.Background(), s), resp)
 
 	processingTime := time.Since(start)
 	p.logger.Debugf("Response %s processed through pipeline in %v", resp.RequestID, processingTime)
 
+	if decision != nil {
+		return &interfaces.ProcessResponseResult{
+			Action:          decision.Action,
+			ModifiedBody:    decision.ModifiedBody,
+			ProcessingTime:  processingTime,
+			Annotations:     resp.Annotations,
+			ModifiedHeaders: headers,
+			Metadata:        decision.Metadata,
+		}, nil
+	}
+
 	return &interfaces.ProcessResponseResult{
-		Action:         interfaces.ActionContinue,
-		ProcessingTime: processingTime,
-		Annotations:    resp.Annotations,
+		Action:          interfaces.ActionContinue,
+		ProcessingTime:  processingTime,
+		Annotations:     resp.Annotations,
+		ModifiedHeaders: headers,
 	}, nil
 }
 
-// runInspectorsParallel runs inspectors in parallel for better performance
-func (p *Pipeline) runInspectorsParallel(ctx context.Context, req *interfaces.ProcessRequestContext) []*interfaces.ProcessRequestResult {
-	p.mu.RLock()
-	inspectors := make([]interfaces.Module, len(p.inspectors))
-	copy(inspectors, p.inspectors)
-	p.mu.RUnlock()
+// inspection is the result of one inspector
+type inspection struct {
+	order  int // the inspector's position in the stage
+	module interfaces.Module
+	result *interfaces.ProcessRequestResult
+}
 
-	results := make([]*interfaces.ProcessRequestResult, 0, len(inspectors))
-	resultsChan := make(chan *interfaces.ProcessRequestResult, len(inspectors))
+// runInspectorsParallel runs inspectors in parallel for better performance.
+// A failed inspector is skipped unless it fails closed, in which case the
+// block result is returned with the inspector's name. Results are in stage
+// order, whatever order the inspectors finished in.
+func (p *Pipeline) runInspectorsParallel(ctx context.Context, req *interfaces.ProcessRequestContext) ([]inspection, *interfaces.ProcessRequestResult, string) {
+	s := p.snapshotOf(ctx)
+	inspectors, cache := s.inspectors, s.resultCache
+
+	results := make([]inspection, 0, len(inspectors))
+	resultsChan := make(chan inspection, len(inspectors))
+	var blockOnce sync.Once
+	var blocked *interfaces.ProcessRequestResult
+	var blocker string
 	
 	var wg sync.WaitGroup
+	var hash string
 
-	for _, inspector := range inspectors {
-		if !p.shouldRunModule(inspector, req) {
+	for order, inspector := range inspectors {
+		if !p.shouldRunModule(ctx, inspector, req) {
 			continue
 		}
 
+		// Cached inspectors reuse their result for identical requests
+		cached := cache.caches(inspector.Name())
+		if cached {
+			if hash == "" {
+				hash = requestHash(req)
+			}
+			if result := cache.get(inspector.Name(), hash); result != nil {
+				p.logger.Debugf("Inspector %s result reused for request %s", inspector.Name(), req.RequestID)
+				recordDecision(ctx, inspector, result, nil)
+				results = append(results, inspection{order: order, module: inspector, result: result})
+				continue
+			}
+		}
+
 		wg.Add(1)
-		go func(module interfaces.Module) {
+		go func(order int, module interfaces.Module) {
 			defer wg.Done()
 			
 			result, err := p.runModuleWithTimeout(ctx, module, req)
 			if err != nil {
+				p.recordModuleError(module, req, err)
+				if s.failsClosed(module, err) {
+					p.logger.Errorf("Inspector %s failed closed: %v", module.Name(), err)
+					blockOnce.Do(func() {
+						recordBlocker(ctx, module)
+						blocker = module.Name()
+						blocked = &interfaces.ProcessRequestResult{
+							Action:      interfaces.ActionBlock,
+							BlockReason: fmt.Sprintf("Inspector %s failed: %v", module.Name(), err),
+						}
+					})
+					return
+				}
 				p.logger.Warnf("Inspector %s failed: %v", module.Name(), err)
 				return
 			}
+			if cached {
+				cache.put(module.Name(), hash, result)
+			}
 			
-			resultsChan <- result
-		}(inspector)
+			resultsChan <- inspection{order: order, module: module, result: result}
+		}(order, inspector)
 	}
 
 	// Wait for all inspectors to complete
@@ -253,60 +464,102 @@ func (p *Pipeline) runInspectorsParallel(ctx context.Context, req *interfaces.Pr
 	for result := range resultsChan {
 		results = append(results, result)
 	}
+	sort.Slice(results, func(i, j int) bool { return results[i].order < results[j].order })
 
-	return results
+	return results, blocked, blocker
 }
 
-// runSinksAsync runs sinks asynchronously
+// runSinksAsync runs the sinks of the snapshot in ctx asynchronously; the
+// caller adds it to p.inflight
 func (p *Pipeline) runSinksAsync(ctx context.Context, req *interfaces.ProcessRequestContext) {
-	p.mu.RLock()
-	sinks := make([]interfaces.Module, len(p.sinks))
-	copy(sinks, p.sinks)
-	p.mu.RUnlock()
+	defer p.inflight.Done()
 
-	for _, sink := range sinks {
-		if !p.shouldRunModule(sink, req) {
+	for _, sink := range p.snapshotOf(ctx).sinks {
+		if !p.shouldRunModule(ctx, sink, req) {
 			continue
 		}
 
+		p.inflight.Add(1)
 		go func(module interfaces.Module) {
+			defer p.inflight.Done()
 			_, err := p.runModuleWithTimeout(ctx, module, req)
 			if err != nil {
+				p.recordModuleError(module, req, err)
 				p.logger.Warnf("Sink %s failed: %v", module.Name(), err)
+				p.deadLetter(module, req, nil, err)
 			}
 		}(sink)
 	}
 }
 
-// runResponseSinksAsync runs response sinks asynchronously
+// notifyBlocked tells sinks observing blocks about a request blocker
+// blocked. Like sinks, observers run in the background and not for dry runs.
+func (p *Pipeline) notifyBlocked(ctx context.Context, req *interfaces.ProcessRequestContext, result *interfaces.ProcessRequestResult, blocker string) {
+	if req.DryRun {
+		return
+	}
+	observeCtx := interfaces.WithBlockingModule(context.Background(), blocker)
+
+	for _, sink := range p.snapshotOf(ctx).sinks {
+		observer, ok := sink.(interfaces.BlockObserver)
+		if !ok || !p.shouldRunModule(ctx, sink, req) {
+			continue
+		}
+
+		p.inflight.Add(1)
+		go func() {
+			defer p.inflight.Done()
+			observer.ObserveBlock(observeCtx, req, result)
+		}()
+	}
+}
+
+// runResponseSinksAsync runs the sinks of the snapshot in ctx asynchronously
+// on a response; the caller adds it to p.inflight
 func (p *Pipeline) runResponseSinksAsync(ctx context.Context, resp *interfaces.ProcessResponseContext) {
-	p.mu.RLock()
-	sinks := make([]interfaces.Module, len(p.sinks))
-	copy(sinks, p.sinks)
-	p.mu.RUnlock()
+	defer p.inflight.Done()
 
-	for _, sink := range sinks {
-		if !p.shouldRunModuleForResponse(sink, resp) {
+	for _, sink := range p.snapshotOf(ctx).sinks {
+		if !p.shouldRunModuleForResponse(ctx, sink, resp) {
 			continue
 		}
 
+		p.inflight.Add(1)
 		go func(module interfaces.Module) {
+			defer p.inflight.Done()
 			_, err := p.runResponseModuleWithTimeout(ctx, module, resp)
 			if err != nil {
+				p.recordModuleError(module, resp.ProcessRequestContext, err)
 				p.logger.Warnf("Response sink %s failed: %v", module.Name(), err)
+				p.deadLetter(module, nil, resp, err)
 			}
 		}(sink)
 	}
 }
 
-// runModuleWithTimeout runs a module with timeout protection
+// runModuleWithTimeout runs a module with timeout protection, retrying
+// failed attempts under the module's retry policy
 func (p *Pipeline) runModuleWithTimeout(ctx context.Context, module interfaces.Module, req *interfaces.ProcessRequestContext) (*interfaces.ProcessRequestResult, error) {
+	defer recordModuleTiming(ctx, module, time.Now())
+
 	// Create timeout context
-	timeout := 2 * time.Second // Default timeout
+	timeout := p.moduleTimeout(module)
 	if req.ModuleConfig != nil && req.ModuleConfig.Timeouts != nil && req.ModuleConfig.Timeouts.Processing > 0 {
 		timeout = req.ModuleConfig.Timeouts.Processing
 	}
 
+	var result *interfaces.ProcessRequestResult
+	err := p.withRetry(ctx, module, func() (err error) {
+		result, err = p.attemptModule(ctx, module, req, timeout)
+		return err
+	})
+	p.observeOutcome(ctx, module, err)
+	recordDecision(ctx, module, result, err)
+	return result, err
+}
+
+// attemptModule runs one attempt of a module within its timeout
+func (p *Pipeline) attemptModule(ctx context.Context, module interfaces.Module, req *interfaces.ProcessRequestContext, timeout time.Duration) (*interfaces.ProcessRequestResult, error) {
 	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
@@ -330,13 +583,27 @@ func (p *Pipeline) runModuleWithTimeout(ctx context.Context, module interfaces.M
 	case err := <-errorChan:
 		return nil, err
 	case <-timeoutCtx.Done():
-		return nil, fmt.Errorf("module %s timed out after %v", module.Name(), timeout)
+		return nil, p.timeoutError(ctx, module, timeout)
 	}
 }
 
-// runResponseModuleWithTimeout runs a response module with timeout protection
+// runResponseModuleWithTimeout runs a response module with timeout
+// protection, retrying failed attempts under the module's retry policy
 func (p *Pipeline) runResponseModuleWithTimeout(ctx context.Context, module interfaces.Module, resp *interfaces.ProcessResponseContext) (*interfaces.ProcessResponseResult, error) {
-	timeout := 2 * time.Second // Default timeout
+	defer recordModuleTiming(ctx, module, time.Now())
+	timeout := p.moduleTimeout(module)
+
+	var result *interfaces.ProcessResponseResult
+	err := p.withRetry(ctx, module, func() (err error) {
+		result, err = p.attemptResponseModule(ctx, module, resp, timeout)
+		return err
+	})
+	p.observeOutcome(ctx, module, err)
+	return result, err
+}
+
+// attemptResponseModule runs one attempt of a response module within its timeout
+func (p *Pipeline) attemptResponseModule(ctx context.Context, module interfaces.Module, resp *interfaces.ProcessResponseContext, timeout time.Duration) (*interfaces.ProcessResponseResult, error) {
 	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
@@ -358,85 +625,140 @@ func (p *Pipeline) runResponseModuleWithTimeout(ctx context.Context, module inte
 	case err := <-errorChan:
 		return nil, err
 	case <-timeoutCtx.Done():
-		return nil, fmt.Errorf("module %s timed out after %v", module.Name(), timeout)
+		return nil, p.timeoutError(ctx, module, timeout)
+	}
+}
+
+// moduleTimeout returns the processing timeout configured for a module
+func (p *Pipeline) moduleTimeout(module interfaces.Module) time.Duration {
+	timeout := 2 * time.Second // Default timeout
+	if config := module.GetConfig(); config != nil && config.Timeouts != nil && config.Timeouts.Processing > 0 {
+		timeout = config.Timeouts.Processing
+	}
+	return timeout
+}
+
+// timeoutError distinguishes a module exceeding its own budget from the
+// caller's context ending first
+func (p *Pipeline) timeoutError(ctx context.Context, module interfaces.Module, timeout time.Duration) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("module %s aborted: %w", module.Name(), ctx.Err())
+	}
+	return &gatewayerrors.ModuleTimeoutError{Module: module.Name(), Timeout: timeout}
+}
+
+// recordModuleError records a classified module error metric if metrics are enabled
+func (p *Pipeline) recordModuleError(module interfaces.Module, req *interfaces.ProcessRequestContext, err error) {
+	if registry := p.current().metrics; registry != nil {
+		registry.RecordModuleFailure(module.Name(), module.Type().String(), req.TenantID, err)
+	}
+}
+
+// recordModuleSkip records a skipped module execution if metrics are enabled
+func (p *Pipeline) recordModuleSkip(module interfaces.Module, reason string) {
+	if registry := p.current().metrics; registry != nil {
+		registry.RecordModuleSkipped(module.Name(), module.Type().String(), reason)
+	}
+}
+
+// recordTokens records a response's token usage if metrics are enabled
+func (p *Pipeline) recordTokens(resp *interfaces.ProcessResponseContext) {
+	if registry := p.current().metrics; registry != nil && resp.TokensUsed != nil {
+		usage := resp.TokensUsed
+		registry.RecordTokens(resp.TenantID, resp.Provider, resp.Model, usage.PromptTokens, usage.CompletionTokens, usage.ReasoningTokens)
+	}
+}
+
+// Reasons a module is skipped, the reason label of leash_module_skipped_total
+const (
+	SkipReasonDisabled        = "disabled"
+	SkipReasonDraining        = "draining"
+	SkipReasonBypassed        = "bypassed"
+	SkipReasonConditionNotMet = "condition-not-met"
+	SkipReasonDegraded        = "degraded"
+)
+
+// shouldRunModule checks if a module should run based on conditions,
+// counting the skip when it should not
+func (p *Pipeline) shouldRunModule(ctx context.Context, module interfaces.Module, req *interfaces.ProcessRequestContext) bool {
+	reason := p.skipReason(ctx, module, req)
+	if reason == "" {
+		return true
 	}
+	p.recordModuleSkip(module, reason)
+	return false
 }
 
-// shouldRunModule checks if a module should run based on conditions
-func (p *Pipeline) shouldRunModule(module interfaces.Module, req *interfaces.ProcessRequestContext) bool {
+// skipReason returns why a module does not run for a request, or empty if
+// it runs
+func (p *Pipeline) skipReason(ctx context.Context, module interfaces.Module, req *interfaces.ProcessRequestContext) string {
 	config := module.GetConfig()
 	if config == nil || !config.Enabled {
-		return false
+		// Modules report disabled while stopping; tell draining apart
+		if status := module.Status(); status != nil && status.State == interfaces.ModuleStateDraining {
+			return SkipReasonDraining
+		}
+		return SkipReasonDisabled
+	}
+	if bypassed(module, req) {
+		return SkipReasonBypassed
+	}
+	if p.degradedBypass(ctx, module) {
+		return SkipReasonDegraded
 	}
 
 	// Check conditions
 	for _, condition := range config.Conditions {
 		if !p.evaluateCondition(condition, req) {
-			return false
+			return SkipReasonConditionNotMet
+		}
+	}
+
+	return ""
+}
+
+// skipsAll reports whether no module in any stage would run for a request.
+// Annotation-based conditions are evaluated before any module has run, which
+// is exact: if nothing runs, nothing adds annotations.
+func (p *Pipeline) skipsAll(ctx context.Context, req *interfaces.ProcessRequestContext) bool {
+	s := p.snapshotOf(ctx)
+	stages := [...][]interfaces.Module{s.inspectors, s.policies, s.transformers, s.sinks}
+
+	var reasons []string
+	for _, modules := range stages {
+		for _, module := range modules {
+			reason := p.skipReason(ctx, module, req)
+			if reason == "" {
+				return false
+			}
+			reasons = append(reasons, reason)
 		}
 	}
 
+	// Count the skips only now: when some module runs, the stages evaluate
+	// every module again
+	i := 0
+	for _, modules := range stages {
+		for _, module := range modules {
+			p.recordModuleSkip(module, reasons[i])
+			i++
+		}
+	}
 	return true
 }
 
 // shouldRunModuleForResponse checks if a module should run for response processing
-func (p *Pipeline) shouldRunModuleForResponse(module interfaces.Module, resp *interfaces.ProcessResponseContext) bool {
-	return p.shouldRunModule(module, resp.ProcessRequestContext)
+func (p *Pipeline) shouldRunModuleForResponse(ctx context.Context, module interfaces.Module, resp *interfaces.ProcessResponseContext) bool {
+	return p.shouldRunModule(ctx, module, resp.ProcessRequestContext)
 }
 
 // evaluateCondition evaluates a single condition
 func (p *Pipeline) evaluateCondition(condition interfaces.Condition, req *interfaces.ProcessRequestContext) bool {
-	var fieldValue interface{}
-
-	// Extract field value based on field name
-	switch condition.Field {
-	case "tenant":
-		fieldValue = req.TenantID
-	case "provider":
-		fieldValue = req.Provider
-	case "model":
-		fieldValue = req.Model
-	case "method":
-		fieldValue = req.Method
-	case "path":
-		fieldValue = req.Path
-	default:
-		// Check in annotations
-		if req.Annotations != nil {
-			fieldValue = req.Annotations[condition.Field]
-		}
-	}
-
-	// Evaluate condition based on operator
-	switch condition.Operator {
-	case "eq":
-		return fmt.Sprintf("%v", fieldValue) == fmt.Sprintf("%v", condition.Value)
-	case "ne":
-		return fmt.Sprintf("%v", fieldValue) != fmt.Sprintf("%v", condition.Value)
-	case "in":
-		// Value should be a slice
-		if valueSlice, ok := condition.Value.([]interface{}); ok {
-			for _, v := range valueSlice {
-				if fmt.Sprintf("%v", fieldValue) == fmt.Sprintf("%v", v) {
-					return true
-				}
-			}
-		}
-		return false
-	case "not_in":
-		// Value should be a slice
-		if valueSlice, ok := condition.Value.([]interface{}); ok {
-			for _, v := range valueSlice {
-				if fmt.Sprintf("%v", fieldValue) == fmt.Sprintf("%v", v) {
-					return false
-				}
-			}
-		}
-		return true
-	default:
+	if !condition.KnownOperator() {
 		p.logger.Warnf("Unknown condition operator: %s", condition.Operator)
 		return true // Default to allow
 	}
+	return condition.Matches(req)
 }
 
 // mergeAnnotations merges annotations from module results
@@ -450,33 +772,44 @@ func (p *Pipeline) mergeAnnotations(req *interfaces.ProcessRequestContext, annot
 	}
 }
 
+// mergeHeaders adds module-provided headers to the accumulated set; later
+// modules win on conflicts
+func mergeHeaders(dst, src map[string]string) map[string]string {
+	if len(src) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[string]string, len(src))
+	}
+	for key, value := range src {
+		dst[key] = value
+	}
+	return dst
+}
+
 // GetPipelineStatus returns the current pipeline configuration
 func (p *Pipeline) GetPipelineStatus() map[string]interface{} {
-	p.mu.RLock()
-	defer p.mu.RUnlock()
+	s := p.current()
 
 	return map[string]interface{}{
-		"inspectors":   len(p.inspectors),
-		"policies":     len(p.policies),
-		"transformers": len(p.transformers),
-		"sinks":        len(p.sinks),
-		"total_modules": len(p.inspectors) + len(p.policies) + len(p.transformers) + len(p.sinks),
+		"inspectors":   len(s.inspectors),
+		"policies":     len(s.policies),
+		"transformers": len(s.transformers),
+		"sinks":        len(s.sinks),
+		"total_modules": len(s.inspectors) + len(s.policies) + len(s.transformers) + len(s.sinks),
+		"generation":   s.generation,
 	}
 }
 
 // ValidatePipeline validates the current pipeline configuration
 func (p *Pipeline) ValidatePipeline() error {
-	p.mu.RLock()
-	defer p.mu.RUnlock()
-
 	// Check for at least one module
-	totalModules := len(p.inspectors) + len(p.policies) + len(p.transformers) + len(p.sinks)
-	if totalModules == 0 {
+	allModules := p.current().modules()
+	if len(allModules) == 0 {
 		return fmt.Errorf("pipeline has no modules configured")
 	}
 
 	// Validate each module
-	allModules := append(append(append(p.inspectors, p.policies...), p.transformers...), p.sinks...)
 	for _, module := range allModules {
 		config := module.GetConfig()
 		if err := module.ValidateConfig(config); err != nil {
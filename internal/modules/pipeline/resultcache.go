@@ -0,0 +1,109 @@
+package pipeline
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+)
+
+// maxCachedResults bounds the inspector result cache; expired entries are
+// swept when it is reached
+const maxCachedResults = 10000
+
+// resultCache holds inspector results for repeated identical requests
+type resultCache struct {
+	ttls    map[string]time.Duration // module name -> TTL
+	mu      sync.Mutex
+	entries map[string]cachedResult
+}
+
+// cachedResult is an inspector result and when it stops being reused
+type cachedResult struct {
+	result  *interfaces.ProcessRequestResult
+	expires time.Time
+}
+
+// SetResultCaching enables result caching for the named inspectors, which
+// must be idempotent: a repeated identical request reuses an inspector's
+// annotations and headers for the TTL instead of running it again. Requests
+// are identical when their tenant, provider, model, method, path and body
+// match. Non-inspector modules are unaffected.
+func (p *Pipeline) SetResultCaching(ttls map[string]time.Duration) {
+	cache := newResultCache(ttls)
+	p.update(func(s *snapshot) {
+		s.resultCache = cache
+	})
+}
+
+// newResultCache returns an empty cache for the modules with a positive TTL,
+// or nil if there are none
+func newResultCache(ttls map[string]time.Duration) *resultCache {
+	enabled := make(map[string]time.Duration, len(ttls))
+	for name, ttl := range ttls {
+		if ttl > 0 {
+			enabled[name] = ttl
+		}
+	}
+	if len(enabled) == 0 {
+		return nil
+	}
+	return &resultCache{ttls: enabled, entries: make(map[string]cachedResult)}
+}
+
+// caches reports whether a module's results are cached
+func (c *resultCache) caches(module string) bool {
+	return c != nil && c.ttls[module] > 0
+}
+
+// get returns a module's unexpired cached result for a request hash
+func (c *resultCache) get(module, hash string) *interfaces.ProcessRequestResult {
+	key := module + ":" + hash
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil
+	}
+	return entry.result
+}
+
+// put stores a module's result for a request hash
+func (c *resultCache) put(module, hash string, result *interfaces.ProcessRequestResult) {
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= maxCachedResults {
+		for key, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, key)
+			}
+		}
+		if len(c.entries) >= maxCachedResults {
+			return
+		}
+	}
+	c.entries[module+":"+hash] = cachedResult{result: result, expires: now.Add(c.ttls[module])}
+}
+
+// requestHash identifies identical requests for result caching. Headers are
+// left out: they carry per-request values such as request IDs and
+// credentials that would make every request unique, so only inspectors whose
+// verdict does not depend on headers should cache their results.
+func requestHash(req *interfaces.ProcessRequestContext) string {
+	hash := sha256.New()
+	for _, field := range []string{req.TenantID, req.Provider, req.Model, req.Method, req.Path} {
+		hash.Write([]byte(field))
+		hash.Write([]byte{0})
+	}
+	hash.Write(req.Body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,80 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+)
+
+// RetryPolicy retries a module's failed executions. It is separate from
+// provider retries: only the module is run again, not the upstream request.
+type RetryPolicy struct {
+	MaxAttempts       int           // total attempts, including the first; 0 or 1 disables retries
+	Backoff           time.Duration // wait before the first retry
+	BackoffMultiplier float64       // applied to the wait after each retry; values below 1 keep it constant
+	MaxBackoff        time.Duration // caps the wait; 0 leaves it uncapped
+}
+
+// SetModuleRetries makes failed executions of the named modules retry with
+// their policy before the pipeline gives up on them. Errors and timeouts are
+// retried; a cancelled request is not.
+func (p *Pipeline) SetModuleRetries(policies map[string]RetryPolicy) {
+	enabled := enabledRetries(policies)
+	p.update(func(s *snapshot) {
+		s.retries = enabled
+	})
+}
+
+// enabledRetries returns the policies that retry at all
+func enabledRetries(policies map[string]RetryPolicy) map[string]RetryPolicy {
+	enabled := make(map[string]RetryPolicy, len(policies))
+	for name, policy := range policies {
+		if policy.MaxAttempts > 1 {
+			enabled[name] = policy
+		}
+	}
+	return enabled
+}
+
+// withRetry runs attempt until it succeeds or the module's retry policy is
+// exhausted, returning the last error
+func (p *Pipeline) withRetry(ctx context.Context, module interfaces.Module, attempt func() error) error {
+	policy := p.snapshotOf(ctx).retries[module.Name()]
+
+	delay := policy.Backoff
+	for n := 1; ; n++ {
+		err := attempt()
+		if err == nil || n >= policy.MaxAttempts || ctx.Err() != nil {
+			return err
+		}
+
+		p.logger.Debugf("Module %s failed on attempt %d of %d, retrying in %v: %v",
+			module.Name(), n, policy.MaxAttempts, delay, err)
+		p.recordModuleRetry(module)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+		delay = policy.nextDelay(delay)
+	}
+}
+
+// nextDelay applies the backoff multiplier, capped at MaxBackoff
+func (r RetryPolicy) nextDelay(delay time.Duration) time.Duration {
+	if r.BackoffMultiplier > 1 {
+		delay = time.Duration(float64(delay) * r.BackoffMultiplier)
+	}
+	if r.MaxBackoff > 0 && delay > r.MaxBackoff {
+		delay = r.MaxBackoff
+	}
+	return delay
+}
+
+// recordModuleRetry records a retried module execution if metrics are enabled
+func (p *Pipeline) recordModuleRetry(module interfaces.Module) {
+	if registry := p.current().metrics; registry != nil {
+		registry.RecordModuleRetry(module.Name(), module.Type().String())
+	}
+}
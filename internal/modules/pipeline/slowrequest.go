@@ -0,0 +1,102 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+)
+
+// moduleTimings records how long each module took in one pipeline phase
+type moduleTimings struct {
+	threshold time.Duration
+	mu        sync.Mutex
+	modules   map[string]time.Duration
+}
+
+// moduleTimingsKey carries a phase's moduleTimings in its context
+type moduleTimingsKey struct{}
+
+// SetSlowRequestThreshold makes the pipeline log a per-module timing
+// breakdown and count leash_slow_requests_total for requests slower than
+// threshold. Zero disables slow-request detection.
+func (p *Pipeline) SetSlowRequestThreshold(threshold time.Duration) {
+	p.update(func(s *snapshot) {
+		s.slowThreshold = threshold
+	})
+}
+
+// trackTimings returns a context collecting module timings, or ctx and nil
+// when slow-request detection is disabled
+func (p *Pipeline) trackTimings(ctx context.Context) (context.Context, *moduleTimings) {
+	threshold := p.snapshotOf(ctx).slowThreshold
+	if threshold <= 0 {
+		return ctx, nil
+	}
+	timings := &moduleTimings{threshold: threshold, modules: make(map[string]time.Duration)}
+	return context.WithValue(ctx, moduleTimingsKey{}, timings), timings
+}
+
+// recordModuleTiming adds a module's run time to the phase's timings, if
+// they are being collected
+func recordModuleTiming(ctx context.Context, module interfaces.Module, started time.Time) {
+	timings, _ := ctx.Value(moduleTimingsKey{}).(*moduleTimings)
+	if timings == nil {
+		return
+	}
+	elapsed := time.Since(started)
+	timings.mu.Lock()
+	timings.modules[module.Name()] += elapsed
+	timings.mu.Unlock()
+}
+
+// checkSlowRequest logs and counts a request phase whose latency exceeded
+// the threshold. Response latency is the caller-reported total when set, and
+// otherwise provider latency plus the pipeline's own time.
+func (p *Pipeline) checkSlowRequest(req *interfaces.ProcessRequestContext, phase string, started time.Time, timings *moduleTimings, providerLatency, totalLatency time.Duration) {
+	if timings == nil {
+		return
+	}
+	pipelineLatency := time.Since(started)
+	latency := totalLatency
+	if latency <= 0 {
+		latency = providerLatency + pipelineLatency
+	}
+
+	threshold := timings.threshold
+	if latency <= threshold {
+		return
+	}
+
+	timings.mu.Lock()
+	modules := make(map[string]float64, len(timings.modules))
+	for name, elapsed := range timings.modules {
+		modules[name] = milliseconds(elapsed)
+	}
+	timings.mu.Unlock()
+
+	fields := []interface{}{
+		"request_id", req.RequestID,
+		"phase", phase,
+		"provider", req.Provider,
+		"model", req.Model,
+		"latency_ms", milliseconds(latency),
+		"threshold_ms", milliseconds(threshold),
+		"pipeline_ms", milliseconds(pipelineLatency),
+		"module_ms", modules,
+	}
+	if providerLatency > 0 {
+		fields = append(fields, "provider_ms", milliseconds(providerLatency))
+	}
+	p.logger.Warnw("Slow request", fields...)
+
+	if registry := p.current().metrics; registry != nil {
+		registry.RecordSlowRequest(phase, req.Provider, req.Model)
+	}
+}
+
+// milliseconds converts a duration to fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
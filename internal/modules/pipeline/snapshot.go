@@ -0,0 +1,155 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/killswitch"
+	"github.com/bendiamant/leash-gateway/internal/metrics"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+)
+
+// snapshot is one immutable configuration of the pipeline: its modules by
+// stage and the options governing how they run. A request or response loads
+// the current snapshot once and uses it throughout, so a change never
+// applies to part of one; changes build a new snapshot and swap it in.
+type snapshot struct {
+	inspectors      []interfaces.Module
+	policies        []interfaces.Module
+	transformers    []interfaces.Module
+	sinks           []interfaces.Module
+	metrics         *metrics.Registry
+	bypass          BypassConfig
+	killSwitch      *killswitch.Switch
+	resultCache     *resultCache
+	retries         map[string]RetryPolicy // module name -> retry policy
+	timeoutModes    map[string]TimeoutMode // module name -> behaviour on timeout
+	slowThreshold   time.Duration          // requests slower than this are logged with timings; 0 disables
+	decisionSummary bool                   // attach a leash_decision summary to request results
+	transformDiff   bool                   // record a leash_transform_diff of rewritten bodies
+	annotations     AnnotationLimits       // caps on the annotations modules add
+	degraded        *degradedMode          // nil when degraded mode is disabled
+	generation      uint64                 // incremented by every change
+}
+
+// Config is a complete pipeline configuration, applied as a whole by Reload.
+// Options are interpreted as by their individual setters.
+type Config struct {
+	Modules              []interfaces.Module
+	Bypass               BypassConfig
+	KillSwitch           *killswitch.Switch
+	ResultCacheTTLs      map[string]time.Duration
+	ModuleRetries        map[string]RetryPolicy
+	TimeoutModes         map[string]TimeoutMode
+	SlowRequestThreshold time.Duration
+	DecisionSummary      bool
+	TransformDiff        bool
+	AnnotationLimits     AnnotationLimits
+	DegradedMode         DegradedConfig
+}
+
+// snapshotKey carries the snapshot a request runs against in its context
+type snapshotKey struct{}
+
+// Reload replaces the pipeline's modules and options with config in one
+// atomic swap. Requests in flight finish against the snapshot they started
+// with; requests arriving after Reload returns use the new one. Nothing is
+// applied if config is invalid. Metrics and the dead-letter store are kept.
+func (p *Pipeline) Reload(config Config) error {
+	next := &snapshot{
+		bypass:          bypassDefaults(config.Bypass),
+		killSwitch:      config.KillSwitch,
+		resultCache:     newResultCache(config.ResultCacheTTLs),
+		retries:         enabledRetries(config.ModuleRetries),
+		timeoutModes:    knownTimeoutModes(config.TimeoutModes),
+		slowThreshold:   config.SlowRequestThreshold,
+		decisionSummary: config.DecisionSummary,
+		transformDiff:   config.TransformDiff,
+		annotations:     config.AnnotationLimits,
+		degraded:        newDegradedMode(config.DegradedMode),
+	}
+	names := make(map[string]bool, len(config.Modules))
+	for _, module := range config.Modules {
+		if names[module.Name()] {
+			return fmt.Errorf("module %s is configured more than once", module.Name())
+		}
+		names[module.Name()] = true
+		if err := next.addModule(module); err != nil {
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	current := p.current()
+	next.metrics = current.metrics
+	next.generation = current.generation + 1
+	p.snapshot.Store(next)
+	p.mu.Unlock()
+
+	p.logger.Infof("Pipeline reloaded with %d modules (generation %d)", len(config.Modules), next.generation)
+	return nil
+}
+
+// Generation returns a number incremented by every change to the pipeline's
+// modules or options
+func (p *Pipeline) Generation() uint64 {
+	return p.current().generation
+}
+
+// current returns the snapshot new requests run against
+func (p *Pipeline) current() *snapshot {
+	return p.snapshot.Load()
+}
+
+// update applies change to a copy of the current snapshot and swaps it in.
+// Changes are serialized; requests never wait for them.
+func (p *Pipeline) update(change func(s *snapshot)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	next := *p.current()
+	change(&next)
+	next.generation++
+	p.snapshot.Store(&next)
+}
+
+// withSnapshot returns a context running module calls against s
+func withSnapshot(ctx context.Context, s *snapshot) context.Context {
+	return context.WithValue(ctx, snapshotKey{}, s)
+}
+
+// snapshotOf returns the snapshot a request's context runs against, or the
+// current one outside a request (e.g. dead-letter replay)
+func (p *Pipeline) snapshotOf(ctx context.Context) *snapshot {
+	if s, ok := ctx.Value(snapshotKey{}).(*snapshot); ok {
+		return s
+	}
+	return p.current()
+}
+
+// addModule adds a module to its stage. The snapshot must not have been
+// published yet.
+func (s *snapshot) addModule(module interfaces.Module) error {
+	switch module.Type() {
+	case interfaces.ModuleTypeInspector:
+		s.inspectors = appendModule(s.inspectors, module)
+	case interfaces.ModuleTypePolicy:
+		s.policies = appendModule(s.policies, module)
+	case interfaces.ModuleTypeTransformer:
+		s.transformers = appendModule(s.transformers, module)
+	case interfaces.ModuleTypeSink:
+		s.sinks = appendModule(s.sinks, module)
+	default:
+		return fmt.Errorf("unknown module type: %s", module.Type().String())
+	}
+	return nil
+}
+
+// modules returns every module in stage order
+func (s *snapshot) modules() []interfaces.Module {
+	all := make([]interfaces.Module, 0, len(s.inspectors)+len(s.policies)+len(s.transformers)+len(s.sinks))
+	for _, stage := range [...][]interfaces.Module{s.inspectors, s.policies, s.transformers, s.sinks} {
+		all = append(all, stage...)
+	}
+	return all
+}
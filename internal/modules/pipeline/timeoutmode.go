@@ -0,0 +1,52 @@
+package pipeline
+
+import (
+	"errors"
+
+	"github.com/bendiamant/leash-gateway/internal/gatewayerrors"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+)
+
+// TimeoutMode decides whether a module timing out blocks the request
+type TimeoutMode string
+
+// Timeout modes
+const (
+	TimeoutFailOpen   TimeoutMode = "fail-open"   // skip the module and continue
+	TimeoutFailClosed TimeoutMode = "fail-closed" // block the request (or reject the response)
+)
+
+// SetTimeoutModes overrides how the named modules' timeouts are handled.
+// Without an override a timeout is treated like any other module error:
+// policies fail closed and inspectors and transformers fail open. Sinks run
+// in the background and always fail open.
+func (p *Pipeline) SetTimeoutModes(modes map[string]TimeoutMode) {
+	configured := knownTimeoutModes(modes)
+	p.update(func(s *snapshot) {
+		s.timeoutModes = configured
+	})
+}
+
+// knownTimeoutModes returns the modes that are fail-open or fail-closed
+func knownTimeoutModes(modes map[string]TimeoutMode) map[string]TimeoutMode {
+	configured := make(map[string]TimeoutMode, len(modes))
+	for name, mode := range modes {
+		if mode == TimeoutFailOpen || mode == TimeoutFailClosed {
+			configured[name] = mode
+		}
+	}
+	return configured
+}
+
+// failsClosed reports whether a module error should block the request:
+// timeouts follow the module's timeout mode when one is set, and otherwise
+// only policies fail closed
+func (s *snapshot) failsClosed(module interfaces.Module, err error) bool {
+	var timeout *gatewayerrors.ModuleTimeoutError
+	if errors.As(err, &timeout) {
+		if mode, ok := s.timeoutModes[module.Name()]; ok {
+			return mode == TimeoutFailClosed
+		}
+	}
+	return module.Type() == interfaces.ModuleTypePolicy
+}
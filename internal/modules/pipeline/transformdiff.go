@@ -0,0 +1,228 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+)
+
+// TransformDiffAnnotation is the request annotation listing the BodyDiff of
+// every module that rewrote the request or response body, when transform
+// diffs are enabled
+const TransformDiffAnnotation = "leash_transform_diff"
+
+// Diff operations
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// maxDiffValueBytes caps the JSON size of a value recorded in a diff; larger
+// values are recorded as their truncated JSON text
+const maxDiffValueBytes = 1024
+
+// maxArrayDiffCells bounds the work aligning two arrays; larger arrays are
+// compared index by index
+const maxArrayDiffCells = 250000
+
+// BodyDiff is the change one module made to a body
+type BodyDiff struct {
+	Module  string       `json:"module"`
+	Stage   string       `json:"stage"` // request or response
+	Changes []BodyChange `json:"changes"`
+}
+
+// BodyChange is one added, removed or changed JSON path. Paths start at $,
+// e.g. $.messages[0].content; a body that is not JSON changes at $.
+type BodyChange struct {
+	Op     string      `json:"op"`
+	Path   string      `json:"path"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// SetTransformDiff makes the pipeline record a BodyDiff under the
+// leash_transform_diff annotation whenever a policy or transformer rewrites a
+// body. Diffs hold body content, so this is a debugging aid only.
+func (p *Pipeline) SetTransformDiff(enabled bool) {
+	p.update(func(s *snapshot) {
+		s.transformDiff = enabled
+	})
+}
+
+// recordTransformDiff adds the diff between a body before and after a module
+// rewrote it to the request's annotations
+func (p *Pipeline) recordTransformDiff(s *snapshot, req *interfaces.ProcessRequestContext, module interfaces.Module, stage string, before, after []byte) {
+	if !s.transformDiff {
+		return
+	}
+	changes := diffBodies(before, after)
+	if len(changes) == 0 {
+		return
+	}
+
+	if req.Annotations == nil {
+		req.Annotations = make(map[string]interface{})
+	}
+	diffs, _ := req.Annotations[TransformDiffAnnotation].([]BodyDiff)
+	req.Annotations[TransformDiffAnnotation] = append(diffs, BodyDiff{Module: module.Name(), Stage: stage, Changes: changes})
+	p.logger.Debugf("Request %s %s body changed by %s at %d paths", req.RequestID, stage, module.Name(), len(changes))
+}
+
+// diffBodies returns the paths at which two bodies differ
+func diffBodies(before, after []byte) []BodyChange {
+	var beforeValue, afterValue interface{}
+	if json.Unmarshal(before, &beforeValue) != nil || json.Unmarshal(after, &afterValue) != nil {
+		if string(before) == string(after) {
+			return nil
+		}
+		return []BodyChange{{Op: DiffChanged, Path: "$", Before: diffValue(string(before)), After: diffValue(string(after))}}
+	}
+
+	var changes []BodyChange
+	diffValues("$", beforeValue, afterValue, &changes)
+	return changes
+}
+
+// diffValues appends the changes between two decoded JSON values
+func diffValues(path string, before, after interface{}, changes *[]BodyChange) {
+	switch b := before.(type) {
+	case map[string]interface{}:
+		if a, ok := after.(map[string]interface{}); ok {
+			diffObjects(path, b, a, changes)
+			return
+		}
+	case []interface{}:
+		if a, ok := after.([]interface{}); ok {
+			diffArrays(path, b, a, changes)
+			return
+		}
+	}
+	if !reflect.DeepEqual(before, after) {
+		*changes = append(*changes, BodyChange{Op: DiffChanged, Path: path, Before: diffValue(before), After: diffValue(after)})
+	}
+}
+
+// diffObjects compares two objects key by key, in key order
+func diffObjects(path string, before, after map[string]interface{}, changes *[]BodyChange) {
+	keys := make([]string, 0, len(before)+len(after))
+	for key := range before {
+		keys = append(keys, key)
+	}
+	for key := range after {
+		if _, ok := before[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		beforeValue, inBefore := before[key]
+		afterValue, inAfter := after[key]
+		keyPath := objectPath(path, key)
+		switch {
+		case !inBefore:
+			*changes = append(*changes, BodyChange{Op: DiffAdded, Path: keyPath, After: diffValue(afterValue)})
+		case !inAfter:
+			*changes = append(*changes, BodyChange{Op: DiffRemoved, Path: keyPath, Before: diffValue(beforeValue)})
+		default:
+			diffValues(keyPath, beforeValue, afterValue, changes)
+		}
+	}
+}
+
+// diffArrays aligns two arrays on their longest common subsequence, so an
+// element inserted or removed is reported once rather than as a change to
+// every element after it. Unaligned elements between two aligned ones are
+// compared pairwise; the surplus is reported as added or removed. Paths of
+// added and changed elements use their index after the change, paths of
+// removed elements their index before it.
+func diffArrays(path string, before, after []interface{}, changes *[]BodyChange) {
+	if len(before)*len(after) > maxArrayDiffCells {
+		for i := 0; i < len(before) || i < len(after); i++ {
+			switch {
+			case i >= len(before):
+				*changes = append(*changes, BodyChange{Op: DiffAdded, Path: indexPath(path, i), After: diffValue(after[i])})
+			case i >= len(after):
+				*changes = append(*changes, BodyChange{Op: DiffRemoved, Path: indexPath(path, i), Before: diffValue(before[i])})
+			default:
+				diffValues(indexPath(path, i), before[i], after[i], changes)
+			}
+		}
+		return
+	}
+
+	// common[i][j] is the length of the longest common subsequence of
+	// before[i:] and after[j:]
+	common := make([][]int, len(before)+1)
+	for i := range common {
+		common[i] = make([]int, len(after)+1)
+	}
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			if reflect.DeepEqual(before[i], after[j]) {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	var removed, added []int
+	flush := func() {
+		paired := min(len(removed), len(added))
+		for k := 0; k < paired; k++ {
+			diffValues(indexPath(path, added[k]), before[removed[k]], after[added[k]], changes)
+		}
+		for _, index := range removed[paired:] {
+			*changes = append(*changes, BodyChange{Op: DiffRemoved, Path: indexPath(path, index), Before: diffValue(before[index])})
+		}
+		for _, index := range added[paired:] {
+			*changes = append(*changes, BodyChange{Op: DiffAdded, Path: indexPath(path, index), After: diffValue(after[index])})
+		}
+		removed, added = removed[:0], added[:0]
+	}
+	for i < len(before) || j < len(after) {
+		switch {
+		case i < len(before) && j < len(after) && reflect.DeepEqual(before[i], after[j]):
+			flush()
+			i++
+			j++
+		case j < len(after) && (i == len(before) || common[i][j+1] >= common[i+1][j]):
+			added = append(added, j)
+			j++
+		default:
+			removed = append(removed, i)
+			i++
+		}
+	}
+	flush()
+}
+
+// objectPath returns the path of an object member
+func objectPath(path, key string) string {
+	if key != "" && !strings.ContainsAny(key, `.[]"' `) {
+		return path + "." + key
+	}
+	return fmt.Sprintf("%s[%q]", path, key)
+}
+
+// indexPath returns the path of an array element
+func indexPath(path string, index int) string {
+	return fmt.Sprintf("%s[%d]", path, index)
+}
+
+// diffValue returns a value as recorded in a diff, truncated when large
+func diffValue(value interface{}) interface{} {
+	encoded, err := json.Marshal(value)
+	if err != nil || len(encoded) <= maxDiffValueBytes {
+		return value
+	}
+	return string(encoded[:maxDiffValueBytes]) + "..."
+}
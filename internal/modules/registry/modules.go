@@ -0,0 +1,198 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+)
+
+// Optional sections of the module listing, selected with ?include=
+const (
+	IncludeHealth = "health" // each module's Health() result
+	IncludeConfig = "config" // each module's effective config, with secrets masked
+)
+
+// RedactedValue replaces secret config values in the module listing
+const RedactedValue = "[REDACTED]"
+
+// moduleHealthTimeout bounds the health checks of an enriched listing
+const moduleHealthTimeout = 5 * time.Second
+
+// sensitiveConfigKeys are key segments marking a config value as a secret,
+// e.g. "secret", "hmac_key" or "bearer_token"; "api_key_env", which names an
+// environment variable, is not masked
+var sensitiveConfigKeys = map[string]bool{
+	"secret":      true,
+	"password":    true,
+	"passwd":      true,
+	"token":       true,
+	"key":         true,
+	"apikey":      true,
+	"credential":  true,
+	"credentials": true,
+	"dsn":         true,
+}
+
+// ModulesHandler lists the registered modules by name with their version,
+// type, status and metrics. ?include=health adds each module's health and
+// ?include=config its effective config with secrets masked; both may be
+// given, comma-separated or repeated, so one request shows everything.
+func (r *ModuleRegistry) ModulesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		include := make(map[string]bool)
+		for _, value := range req.URL.Query()["include"] {
+			for _, section := range strings.Split(value, ",") {
+				switch section = strings.TrimSpace(section); section {
+				case IncludeHealth, IncludeConfig:
+					include[section] = true
+				default:
+					http.Error(w, fmt.Sprintf("invalid include %q: must be %s or %s", section, IncludeHealth, IncludeConfig), http.StatusBadRequest)
+					return
+				}
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(req.Context(), moduleHealthTimeout)
+		defer cancel()
+
+		modules := r.List()
+		sort.Slice(modules, func(i, j int) bool { return modules[i].Name() < modules[j].Name() })
+		moduleInfo := make([]map[string]interface{}, len(modules))
+		for i, module := range modules {
+			moduleInfo[i] = map[string]interface{}{
+				"name":        module.Name(),
+				"version":     module.Version(),
+				"type":        module.Type().String(),
+				"description": module.Description(),
+				"status":      module.Status(),
+				"metrics":     module.Metrics(),
+			}
+			if include[IncludeHealth] {
+				moduleInfo[i]["health"] = moduleHealth(ctx, module)
+			}
+			if include[IncludeConfig] {
+				moduleInfo[i]["config"] = RedactModuleConfig(module.GetConfig())
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"modules": moduleInfo,
+			"count":   len(modules),
+		})
+	})
+}
+
+// moduleHealth returns a module's health, reporting a failed check as
+// unhealthy
+func moduleHealth(ctx context.Context, module interfaces.Module) *interfaces.HealthStatus {
+	health, err := module.Health(ctx)
+	if err != nil {
+		return &interfaces.HealthStatus{
+			Status:        interfaces.HealthStateUnhealthy,
+			Message:       fmt.Sprintf("Health check failed: %v", err),
+			LastCheck:     time.Now(),
+			CheckDuration: 0,
+		}
+	}
+	return health
+}
+
+// RedactModuleConfig returns a copy of config whose secret values, at any
+// depth of its Config map, are replaced with RedactedValue. Empty values are
+// kept so an unset secret still shows as unset.
+func RedactModuleConfig(config *interfaces.ModuleConfig) *interfaces.ModuleConfig {
+	if config == nil {
+		return nil
+	}
+	redacted := *config
+	if config.Config != nil {
+		redacted.Config = redactConfigMap(config.Config)
+	}
+	return &redacted
+}
+
+// redactConfigMap copies a config map, masking the values of sensitive keys
+func redactConfigMap(config map[string]interface{}) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(config))
+	for key, value := range config {
+		if isSensitiveConfigKey(key) && !isEmptyConfigValue(value) {
+			redacted[key] = RedactedValue
+		} else {
+			redacted[key] = redactConfigValue(value)
+		}
+	}
+	return redacted
+}
+
+// redactConfigValue masks sensitive keys within nested maps and lists
+func redactConfigValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return redactConfigMap(v)
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted[fmt.Sprint(key)] = item
+		}
+		return redactConfigMap(converted)
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = redactConfigValue(item)
+		}
+		return redacted
+	default:
+		return value
+	}
+}
+
+// isSensitiveConfigKey reports whether any segment of a snake, kebab or
+// dotted key names a secret
+func isSensitiveConfigKey(key string) bool {
+	segments := strings.FieldsFunc(strings.ToLower(key), func(c rune) bool {
+		return c == '_' || c == '-' || c == '.'
+	})
+	for i, segment := range segments {
+		if !sensitiveConfigKeys[segment] {
+			continue
+		}
+		// A trailing qualifier such as "_env" or "_file" names where the
+		// secret lives rather than holding it
+		if i == len(segments)-1 || !isSecretReference(segments[len(segments)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSecretReference reports whether a key suffix marks a reference to a
+// secret rather than the secret itself
+func isSecretReference(segment string) bool {
+	switch segment {
+	case "env", "file", "path", "header", "headers", "ttl", "rotation":
+		return true
+	}
+	return false
+}
+
+// isEmptyConfigValue reports whether a config value is unset
+func isEmptyConfigValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	}
+	return false
+}
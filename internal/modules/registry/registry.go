@@ -2,6 +2,7 @@ package registry
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -10,43 +11,122 @@ import (
 	"go.uber.org/zap"
 )
 
+// Policies for registering a module under a name that is already taken
+const (
+	DuplicatePolicyError   = "error"   // reject the new module
+	DuplicatePolicyReplace = "replace" // stop the registered module and register the new one
+	DuplicatePolicySkip    = "skip"    // keep the registered module and log a warning
+)
+
+// Errors returned when registering a module whose name is already taken
+var (
+	ErrDuplicateModule  = errors.New("module already registered")             // under the error policy
+	ErrDuplicateSkipped = errors.New("duplicate module registration skipped") // under the skip policy
+)
+
 // ModuleRegistry implements the Registry interface
 type ModuleRegistry struct {
-	modules map[string]interfaces.Module
-	mu      sync.RWMutex
-	logger  *zap.SugaredLogger
+	modules         map[string]interfaces.Module
+	mu              sync.RWMutex
+	logger          *zap.SugaredLogger
+	duplicatePolicy string
+	replaceHook     func(old, replacement interfaces.Module) error
+	warmup          *warmupState
 }
 
 // NewModuleRegistry creates a new module registry
 func NewModuleRegistry(logger *zap.SugaredLogger) *ModuleRegistry {
 	return &ModuleRegistry{
-		modules: make(map[string]interfaces.Module),
-		logger:  logger,
+		modules:         make(map[string]interfaces.Module),
+		logger:          logger,
+		duplicatePolicy: DuplicatePolicyError,
 	}
 }
 
-// Register registers a module in the registry
-func (r *ModuleRegistry) Register(module interfaces.Module) error {
+// SetDuplicatePolicy sets how Register handles a name that is already taken
+func (r *ModuleRegistry) SetDuplicatePolicy(policy string) error {
+	switch policy {
+	case "":
+		policy = DuplicatePolicyError
+	case DuplicatePolicyError, DuplicatePolicyReplace, DuplicatePolicySkip:
+	default:
+		return fmt.Errorf("unsupported duplicate module policy: %s", policy)
+	}
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	r.duplicatePolicy = policy
+	return nil
+}
+
+// SetReplaceHook sets a function Register calls when a module replaces a
+// registered one, before the replaced module is stopped, e.g. to swap it out
+// of the pipeline so new requests never reach it stopped. An error from the
+// hook keeps the registered module.
+func (r *ModuleRegistry) SetReplaceHook(hook func(old, replacement interfaces.Module) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.replaceHook = hook
+}
+
+// Register registers a module in the registry. A name that is already taken
+// is handled by the duplicate policy: under skip the registered module is
+// kept and ErrDuplicateSkipped is returned, so callers leave the new module
+// out of the pipeline; under replace the new one takes its place, the
+// replace hook runs, and the registered module is then stopped and shut
+// down outside the registry lock.
+func (r *ModuleRegistry) Register(module interfaces.Module) error {
+	r.mu.Lock()
 
 	name := module.Name()
 	if name == "" {
+		r.mu.Unlock()
 		return fmt.Errorf("module name cannot be empty")
 	}
 
 	// Check if module already exists
-	if _, exists := r.modules[name]; exists {
-		return fmt.Errorf("module %s already registered", name)
+	existing, exists := r.modules[name]
+	if exists {
+		switch r.duplicatePolicy {
+		case DuplicatePolicySkip:
+			r.mu.Unlock()
+			r.logger.Warnf("Module %s already registered, skipping duplicate registration", name)
+			return fmt.Errorf("module %s: %w", name, ErrDuplicateSkipped)
+		case DuplicatePolicyReplace:
+		default:
+			r.mu.Unlock()
+			return fmt.Errorf("module %s: %w", name, ErrDuplicateModule)
+		}
 	}
 
 	// Validate module
 	if err := r.ValidateModule(module); err != nil {
+		r.mu.Unlock()
 		return fmt.Errorf("module validation failed: %w", err)
 	}
 
 	// Register module
 	r.modules[name] = module
+	hook := r.replaceHook
+	r.mu.Unlock()
+
+	// Only a valid module replaces a registered one
+	if exists {
+		r.logger.Warnf("Module %s already registered, replacing version %s with %s",
+			name, existing.Version(), module.Version())
+		if hook != nil {
+			if err := hook(existing, module); err != nil {
+				r.mu.Lock()
+				if r.modules[name] == module {
+					r.modules[name] = existing
+				}
+				r.mu.Unlock()
+				return fmt.Errorf("failed to replace module %s: %w", name, err)
+			}
+		}
+		r.stopModule(existing)
+	}
+
 	r.logger.Infof("Module %s (type: %s, version: %s) registered successfully", 
 		name, module.Type().String(), module.Version())
 
@@ -64,21 +144,26 @@ func (r *ModuleRegistry) Unregister(name string) error {
 	}
 
 	// Stop module before unregistering
+	r.stopModule(module)
+
+	delete(r.modules, name)
+	r.logger.Infof("Module %s unregistered successfully", name)
+
+	return nil
+}
+
+// stopModule stops and shuts down a module leaving the registry
+func (r *ModuleRegistry) stopModule(module interfaces.Module) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	if err := module.Stop(ctx); err != nil {
-		r.logger.Warnf("Error stopping module %s: %v", name, err)
+		r.logger.Warnf("Error stopping module %s: %v", module.Name(), err)
 	}
 
 	if err := module.Shutdown(ctx); err != nil {
-		r.logger.Warnf("Error shutting down module %s: %v", name, err)
+		r.logger.Warnf("Error shutting down module %s: %v", module.Name(), err)
 	}
-
-	delete(r.modules, name)
-	r.logger.Infof("Module %s unregistered successfully", name)
-
-	return nil
 }
 
 // Get retrieves a module by name
@@ -144,11 +229,47 @@ func (r *ModuleRegistry) Reload(name string) error {
 	if err := module.Start(ctx); err != nil {
 		return fmt.Errorf("failed to restart module %s: %w", name, err)
 	}
+	r.warmModule(ctx, module)
 
 	r.logger.Infof("Module %s reloaded successfully", name)
 	return nil
 }
 
+// shutdownOrder is the order module types are stopped in: sinks first so
+// they can flush what the other stages produced
+var shutdownOrder = []interfaces.ModuleType{
+	interfaces.ModuleTypeSink,
+	interfaces.ModuleTypeTransformer,
+	interfaces.ModuleTypePolicy,
+	interfaces.ModuleTypeInspector,
+}
+
+// Shutdown stops and shuts down every registered module, sinks first, within
+// the deadline of ctx. Modules not reached before the deadline are reported
+// in the returned error.
+func (r *ModuleRegistry) Shutdown(ctx context.Context) error {
+	var errs []error
+	for _, moduleType := range shutdownOrder {
+		for _, module := range r.GetModulesByPriority(moduleType) {
+			if err := ctx.Err(); err != nil {
+				errs = append(errs, fmt.Errorf("module %s not shut down: %w", module.Name(), err))
+				continue
+			}
+
+			if err := module.Stop(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("failed to stop module %s: %w", module.Name(), err))
+			}
+			if err := module.Shutdown(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("failed to shut down module %s: %w", module.Name(), err))
+				continue
+			}
+			r.logger.Infof("Module %s shut down", module.Name())
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
 // ValidateModule validates a module before registration
 func (r *ModuleRegistry) ValidateModule(module interfaces.Module) error {
 	// Check required fields
@@ -216,17 +337,7 @@ func (r *ModuleRegistry) HealthCheck(ctx context.Context) map[string]*interfaces
 	results := make(map[string]*interfaces.HealthStatus)
 	
 	for name, module := range r.modules {
-		health, err := module.Health(ctx)
-		if err != nil {
-			results[name] = &interfaces.HealthStatus{
-				Status:        interfaces.HealthStateUnhealthy,
-				Message:       fmt.Sprintf("Health check failed: %v", err),
-				LastCheck:     time.Now(),
-				CheckDuration: 0,
-			}
-		} else {
-			results[name] = health
-		}
+		results[name] = moduleHealth(ctx, module)
 	}
 
 	return results
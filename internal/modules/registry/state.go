@@ -0,0 +1,131 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+)
+
+// maxSnapshotBytes bounds the size of a snapshot imported over HTTP
+const maxSnapshotBytes = 64 << 20
+
+// Snapshot is the exported state of every stateful module, keyed by module name
+type Snapshot struct {
+	Modules map[string]json.RawMessage `json:"modules"`
+}
+
+// ExportState exports the state of the named stateful modules, or of all
+// stateful modules when no names are given
+func (r *ModuleRegistry) ExportState(names ...string) (*Snapshot, error) {
+	snapshot := &Snapshot{Modules: make(map[string]json.RawMessage)}
+
+	modules, err := r.statefulModules(names)
+	if err != nil {
+		return nil, err
+	}
+	for name, module := range modules {
+		state, err := module.ExportState()
+		if err != nil {
+			return nil, fmt.Errorf("failed to export state of module %s: %w", name, err)
+		}
+		snapshot.Modules[name] = state
+	}
+	return snapshot, nil
+}
+
+// ImportState restores module state from a snapshot. Every named module must
+// be registered and stateful before any state is imported; each module then
+// validates its own state and keeps its current state if that fails.
+func (r *ModuleRegistry) ImportState(snapshot *Snapshot) error {
+	names := make([]string, 0, len(snapshot.Modules))
+	for name := range snapshot.Modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	modules, err := r.statefulModules(names)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := modules[name].ImportState(snapshot.Modules[name]); err != nil {
+			return fmt.Errorf("failed to import state of module %s: %w", name, err)
+		}
+		r.logger.Infof("Imported state of module %s", name)
+	}
+	return nil
+}
+
+// statefulModules resolves module names to stateful modules; no names
+// selects every stateful module
+func (r *ModuleRegistry) statefulModules(names []string) (map[string]interfaces.StatefulModule, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	modules := make(map[string]interfaces.StatefulModule)
+	if len(names) == 0 {
+		for name, module := range r.modules {
+			if stateful, ok := module.(interfaces.StatefulModule); ok {
+				modules[name] = stateful
+			}
+		}
+		return modules, nil
+	}
+
+	for _, name := range names {
+		module, exists := r.modules[name]
+		if !exists {
+			return nil, fmt.Errorf("module %s not found", name)
+		}
+		stateful, ok := module.(interfaces.StatefulModule)
+		if !ok {
+			return nil, fmt.Errorf("module %s has no exportable state", name)
+		}
+		modules[name] = stateful
+	}
+	return modules, nil
+}
+
+// StateHandler serves module state for debugging and migration: GET exports
+// a snapshot (optionally limited with ?module=name) and POST imports one of
+// up to 64 MiB. It exposes per-tenant usage and replaces it wholesale, so it
+// must only be served behind the admin token.
+func (r *ModuleRegistry) StateHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+			snapshot, err := r.ExportState(req.URL.Query()["module"]...)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(snapshot)
+
+		case http.MethodPost:
+			var snapshot Snapshot
+			body := http.MaxBytesReader(w, req.Body, maxSnapshotBytes)
+			if err := json.NewDecoder(body).Decode(&snapshot); err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					http.Error(w, fmt.Sprintf("snapshot exceeds %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+					return
+				}
+				http.Error(w, fmt.Sprintf("invalid snapshot: %v", err), http.StatusBadRequest)
+				return
+			}
+			if err := r.ImportState(&snapshot); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
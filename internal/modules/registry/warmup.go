@@ -0,0 +1,148 @@
+package registry
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+)
+
+// WarmupReport is the progress of warming up the registered modules
+type WarmupReport struct {
+	Done     bool              `json:"done"`
+	Pending  []string          `json:"pending,omitempty"` // modules still warming up
+	Failed   map[string]string `json:"failed,omitempty"`  // module -> warmup error or timeout
+	Duration time.Duration     `json:"duration"`
+}
+
+// warmupState tracks a warmup in progress
+type warmupState struct {
+	mu      sync.Mutex
+	report  WarmupReport
+	pending map[string]bool
+}
+
+// Warmup calls Warmup on every registered module implementing
+// interfaces.WarmableModule, concurrently, and waits for them all or for ctx
+// to end. Modules that fail or are still warming when ctx ends are reported
+// and logged; they build their structures on first use instead, so warmup
+// always completes.
+func (r *ModuleRegistry) Warmup(ctx context.Context) *WarmupReport {
+	start := time.Now()
+	state := &warmupState{pending: make(map[string]bool)}
+	warmable := make(map[string]interfaces.WarmableModule)
+	for _, module := range r.List() {
+		if warmableModule, ok := module.(interfaces.WarmableModule); ok {
+			warmable[module.Name()] = warmableModule
+			state.pending[module.Name()] = true
+		}
+	}
+
+	r.mu.Lock()
+	r.warmup = state
+	r.mu.Unlock()
+
+	r.logger.Infof("Warming up %d modules", len(warmable))
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for name, module := range warmable {
+		wg.Add(1)
+		go func(name string, module interfaces.WarmableModule) {
+			defer wg.Done()
+			moduleStart := time.Now()
+			err := module.Warmup(ctx)
+
+			state.mu.Lock()
+			defer state.mu.Unlock()
+			if !state.pending[name] {
+				return
+			}
+			delete(state.pending, name)
+			if err != nil {
+				state.fail(name, err.Error())
+				r.logger.Warnf("Module %s failed to warm up, it will initialize on first use: %v", name, err)
+				return
+			}
+			r.logger.Infof("Module %s warmed up in %v", name, time.Since(moduleStart))
+		}(name, module)
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+
+	state.mu.Lock()
+	for name := range state.pending {
+		state.fail(name, "warmup timed out")
+		r.logger.Warnf("Module %s did not warm up in time, it will initialize on first use", name)
+	}
+	state.pending = make(map[string]bool)
+	state.report.Done = true
+	state.report.Duration = time.Since(start)
+	report := state.snapshot()
+	state.mu.Unlock()
+
+	r.logger.Infof("Module warmup completed in %v: %d warmed up, %d failed",
+		report.Duration, len(warmable)-len(report.Failed), len(report.Failed))
+	return report
+}
+
+// WarmupStatus returns the progress of the last warmup, or a report not yet
+// done when warmup has not started
+func (r *ModuleRegistry) WarmupStatus() *WarmupReport {
+	r.mu.RLock()
+	state := r.warmup
+	r.mu.RUnlock()
+	if state == nil {
+		return &WarmupReport{}
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return state.snapshot()
+}
+
+// warmModule warms up a module that has just been restarted
+func (r *ModuleRegistry) warmModule(ctx context.Context, module interfaces.Module) {
+	warmable, ok := module.(interfaces.WarmableModule)
+	if !ok {
+		return
+	}
+	if err := warmable.Warmup(ctx); err != nil {
+		r.logger.Warnf("Module %s failed to warm up, it will initialize on first use: %v", module.Name(), err)
+	}
+}
+
+func (s *warmupState) fail(name, reason string) {
+	if s.report.Failed == nil {
+		s.report.Failed = make(map[string]string)
+	}
+	s.report.Failed[name] = reason
+}
+
+// snapshot copies the report with the modules still pending
+func (s *warmupState) snapshot() *WarmupReport {
+	report := s.report
+	report.Pending = make([]string, 0, len(s.pending))
+	for name := range s.pending {
+		report.Pending = append(report.Pending, name)
+	}
+	sort.Strings(report.Pending)
+	if len(report.Pending) == 0 {
+		report.Pending = nil
+	}
+	if s.report.Failed != nil {
+		report.Failed = make(map[string]string, len(s.report.Failed))
+		for name, reason := range s.report.Failed {
+			report.Failed[name] = reason
+		}
+	}
+	return &report
+}
@@ -0,0 +1,260 @@
+package pricing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/metrics"
+	"github.com/bendiamant/leash-gateway/internal/providers/base"
+	"go.uber.org/zap"
+)
+
+// Results of a pricing refresh, as recorded in leash_pricing_updates_total
+const (
+	ResultApplied  = "applied"  // the feed's prices are in use
+	ResultRejected = "rejected" // the feed was malformed; prior prices kept
+	ResultFailed   = "failed"   // the feed could not be fetched; prior prices kept
+)
+
+// maxFeedBytes bounds the size of a pricing feed
+const maxFeedBytes = 10 << 20
+
+// ErrInvalidFeed is returned for a feed that is not a valid price list
+var ErrInvalidFeed = errors.New("invalid pricing feed")
+
+// Config configures where prices come from and how often they refresh
+type Config struct {
+	Source   string        // http(s) URL or file path of the feed
+	Interval time.Duration // between refreshes
+	Timeout  time.Duration // for fetching the feed
+	MaxAge   time.Duration // prices not refreshed for this long revert to the configured ones; 0 keeps them
+}
+
+// feedPrice is a price as listed in a feed; input and output are required
+type feedPrice struct {
+	Input       *float64 `json:"cost_per_1k_input_tokens"`
+	Output      *float64 `json:"cost_per_1k_output_tokens"`
+	CachedInput float64  `json:"cost_per_1k_cached_input_tokens"`
+	Reasoning   float64  `json:"cost_per_1k_reasoning_tokens"`
+}
+
+// Parse validates a pricing feed, a JSON document listing prices per 1k
+// tokens by provider and model:
+//
+//	{"providers": {"openai": {"gpt-4o": {
+//	    "cost_per_1k_input_tokens": 0.0025,
+//	    "cost_per_1k_output_tokens": 0.01}}}}
+//
+// Every price needs input and output rates; rates must be finite and not
+// negative, and unknown fields are rejected so a misspelled rate cannot
+// silently price a model at zero.
+func Parse(data []byte) (map[string]map[string]base.ModelPrice, error) {
+	var feed struct {
+		Providers map[string]map[string]feedPrice `json:"providers"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&feed); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFeed, err)
+	}
+
+	prices := make(map[string]map[string]base.ModelPrice, len(feed.Providers))
+	for provider, models := range feed.Providers {
+		prices[provider] = make(map[string]base.ModelPrice, len(models))
+		for model, listed := range models {
+			if listed.Input == nil || listed.Output == nil {
+				return nil, fmt.Errorf("%w: %s/%s needs input and output prices", ErrInvalidFeed, provider, model)
+			}
+			price := base.ModelPrice{
+				Input:       *listed.Input,
+				Output:      *listed.Output,
+				CachedInput: listed.CachedInput,
+				Reasoning:   listed.Reasoning,
+			}
+			for _, rate := range []float64{price.Input, price.Output, price.CachedInput, price.Reasoning} {
+				if rate < 0 || math.IsNaN(rate) || math.IsInf(rate, 0) {
+					return nil, fmt.Errorf("%w: %s/%s has an invalid price %v", ErrInvalidFeed, provider, model, rate)
+				}
+			}
+			prices[provider][model] = price
+		}
+	}
+	if len(prices) == 0 {
+		return nil, fmt.Errorf("%w: no prices listed", ErrInvalidFeed)
+	}
+	return prices, nil
+}
+
+// Updater keeps a price table current from a pricing feed. A feed that
+// cannot be fetched or parsed leaves the table's prices as they were.
+type Updater struct {
+	config  Config
+	table   *base.PriceTable
+	client  *http.Client
+	metrics *metrics.Registry
+	logger  *zap.SugaredLogger
+	now     func() time.Time
+
+	mu          sync.Mutex
+	lastApplied time.Time
+	stop        chan struct{}
+	done        chan struct{}
+}
+
+// NewUpdater creates an updater filling table from the configured feed
+func NewUpdater(config Config, table *base.PriceTable, logger *zap.SugaredLogger) *Updater {
+	if config.Interval <= 0 {
+		config.Interval = time.Hour
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	return &Updater{
+		config: config,
+		table:  table,
+		client: &http.Client{Timeout: config.Timeout},
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// SetMetrics enables the pricing update counter
+func (u *Updater) SetMetrics(registry *metrics.Registry) {
+	u.metrics = registry
+}
+
+// SetClock replaces the clock used to age prices, for tests
+func (u *Updater) SetClock(now func() time.Time) {
+	u.now = now
+}
+
+// Refresh fetches the feed and, when it is valid, replaces the table's prices
+// with it. Prices older than the maximum age revert to the configured ones
+// when the refresh fails.
+func (u *Updater) Refresh(ctx context.Context) error {
+	data, err := u.fetch(ctx)
+	if err != nil {
+		u.record(ResultFailed)
+		u.expire()
+		return fmt.Errorf("failed to fetch pricing feed: %w", err)
+	}
+	prices, err := Parse(data)
+	if err != nil {
+		u.record(ResultRejected)
+		u.expire()
+		return err
+	}
+
+	u.table.Replace(prices)
+	u.mu.Lock()
+	u.lastApplied = u.now()
+	u.mu.Unlock()
+	u.record(ResultApplied)
+	u.logger.Infof("Applied pricing feed with %d model prices", u.table.Len())
+	return nil
+}
+
+// Start refreshes the prices now and then at every interval until Stop
+func (u *Updater) Start(ctx context.Context) {
+	u.mu.Lock()
+	if u.stop != nil {
+		u.mu.Unlock()
+		return
+	}
+	u.stop = make(chan struct{})
+	u.done = make(chan struct{})
+	stop, done := u.stop, u.done
+	u.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(u.config.Interval)
+		defer ticker.Stop()
+		for {
+			if err := u.Refresh(ctx); err != nil {
+				u.logger.Warnf("Pricing feed not applied, keeping current prices: %v", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the refresh loop
+func (u *Updater) Stop() {
+	u.mu.Lock()
+	stop, done := u.stop, u.done
+	u.stop, u.done = nil, nil
+	u.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+// fetch reads the feed from its URL or file
+func (u *Updater) fetch(ctx context.Context) ([]byte, error) {
+	source := u.config.Source
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		file, err := os.Open(strings.TrimPrefix(source, "file://"))
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return io.ReadAll(io.LimitReader(file, maxFeedBytes))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("feed returned status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxFeedBytes))
+}
+
+// expire reverts to the configured prices once the feed's prices are older
+// than the maximum age
+func (u *Updater) expire() {
+	if u.config.MaxAge <= 0 {
+		return
+	}
+	u.mu.Lock()
+	stale := !u.lastApplied.IsZero() && u.now().Sub(u.lastApplied) > u.config.MaxAge
+	if stale {
+		u.lastApplied = time.Time{}
+	}
+	u.mu.Unlock()
+	if stale {
+		u.table.Replace(nil)
+		u.logger.Warnf("Pricing feed prices are older than %v, reverting to configured prices", u.config.MaxAge)
+	}
+}
+
+func (u *Updater) record(result string) {
+	if u.metrics != nil {
+		u.metrics.RecordPricingUpdate(result)
+	}
+}
@@ -5,11 +5,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/bendiamant/leash-gateway/internal/circuitbreaker"
+	"github.com/bendiamant/leash-gateway/internal/gatewayerrors"
 	"github.com/bendiamant/leash-gateway/internal/providers/base"
 	"go.uber.org/zap"
 )
@@ -20,6 +21,7 @@ type AnthropicProvider struct {
 	config         *base.ProviderConfig
 	client         *http.Client
 	circuitBreaker *circuitbreaker.CircuitBreaker
+	compressor     *base.RequestCompressor
 	logger         *zap.SugaredLogger
 	lastHealth     *base.ProviderHealth
 	healthTicker   *time.Ticker
@@ -37,6 +39,19 @@ type AnthropicRequest struct {
 	StopSequences []string             `json:"stop_sequences,omitempty"`
 }
 
+// DefaultParameterMapping maps OpenAI-format parameters to the Messages API;
+// provider configuration is merged over it
+var DefaultParameterMapping = base.ParameterMapping{
+	Rename: map[string]string{
+		"stop": "stop_sequences",
+	},
+	Unsupported: []string{
+		"frequency_penalty", "presence_penalty", "logit_bias", "logprobs",
+		"top_logprobs", "n", "seed", "response_format", "user",
+	},
+	OnUnsupported: base.UnsupportedParameterDrop,
+}
+
 // AnthropicResponse represents an Anthropic API response
 type AnthropicResponse struct {
 	ID           string    `json:"id"`
@@ -57,31 +72,40 @@ type Content struct {
 
 // Usage represents token usage in Anthropic response
 type Usage struct {
-	InputTokens  int `json:"input_tokens"`
-	OutputTokens int `json:"output_tokens"`
+	InputTokens          int `json:"input_tokens"`
+	OutputTokens         int `json:"output_tokens"`
+	CacheReadInputTokens int `json:"cache_read_input_tokens,omitempty"` // not included in input_tokens
 }
 
 // NewAnthropicProvider creates a new Anthropic provider
 func NewAnthropicProvider(config *base.ProviderConfig, cbManager *circuitbreaker.Manager, logger *zap.SugaredLogger) *AnthropicProvider {
-	client := &http.Client{
-		Timeout: config.Timeout,
+	client := base.NewHTTPClient(config)
+	if err := config.TLS.Validate(); err != nil {
+		logger.Errorf("Provider %s has invalid TLS settings, its requests will fail: %v", config.Name, err)
 	}
 
 	// Create circuit breaker
 	cb := cbManager.GetOrCreate(config.Name, circuitbreaker.Config{
-		MaxFailures:  config.CircuitBreaker.FailureThreshold,
-		MinRequests:  config.CircuitBreaker.MinRequests,
-		ResetTimeout: config.CircuitBreaker.Timeout,
-		OnStateChange: func(name string, from, to circuitbreaker.State) {
-			logger.Infof("Circuit breaker %s state changed from %s to %s", name, from, to)
+		MaxFailures:    config.CircuitBreaker.FailureThreshold,
+		MinRequests:    config.CircuitBreaker.MinRequests,
+		ResetTimeout:   config.CircuitBreaker.Timeout,
+		HalfOpenProbes: config.CircuitBreaker.HalfOpenProbes,
+		ErrorSamples:   config.CircuitBreaker.ErrorSamples,
+		OnTransition: func(transition circuitbreaker.Transition) {
+			base.LogCircuitTransition(logger, transition)
 		},
 	})
 
+	compressor := &base.RequestCompressor{OnRejected: func() {
+		logger.Warnf("Provider %s rejected a gzip-encoded request body; sending its requests uncompressed", config.Name)
+	}}
+
 	provider := &AnthropicProvider{
 		name:           config.Name,
 		config:         config,
 		client:         client,
 		circuitBreaker: cb,
+		compressor:     compressor,
 		logger:         logger,
 		stopHealth:     make(chan struct{}),
 	}
@@ -113,7 +137,8 @@ func (p *AnthropicProvider) Health(ctx context.Context) (*base.ProviderHealth, e
 	// Use circuit breaker for health check
 	var err error
 	healthErr := p.circuitBreaker.Call(func() error {
-		// Anthropic doesn't have a simple health endpoint, so we'll use a minimal request
+		// Anthropic doesn't have a simple health endpoint, so unless one is
+		// configured we use a minimal request
 		testReq := &AnthropicRequest{
 			Model:     "claude-3-haiku-20240307",
 			Messages:  []base.Message{{Role: "user", Content: "Hi"}},
@@ -125,12 +150,15 @@ func (p *AnthropicProvider) Health(ctx context.Context) (*base.ProviderHealth, e
 			return marshalErr
 		}
 
-		req, reqErr := http.NewRequestWithContext(ctx, "POST", p.config.Endpoint+"/messages", bytes.NewReader(reqBody))
+		req, reqErr := p.config.HealthCheck.NewHealthCheckRequest(ctx, p.config.Endpoint, base.HealthCheckProbe{
+			Method: http.MethodPost,
+			Path:   "/messages",
+			Body:   reqBody,
+		})
 		if reqErr != nil {
 			return reqErr
 		}
 
-		req.Header.Set("Content-Type", "application/json")
 		req.Header.Set("anthropic-version", "2023-06-01")
 
 		resp, respErr := p.client.Do(req)
@@ -183,6 +211,15 @@ func (p *AnthropicProvider) IsHealthy() bool {
 func (p *AnthropicProvider) ProcessRequest(ctx context.Context, req *base.ProviderRequest) (*base.ProviderResponse, error) {
 	start := time.Now()
 
+	// Map OpenAI-format parameters to Anthropic's names
+	params, dropped, err := DefaultParameterMapping.Merge(p.config.Parameters).Apply(req.Parameters)
+	if err != nil {
+		return nil, err
+	}
+	if stop, ok := params["stop_sequences"].(string); ok {
+		params["stop_sequences"] = []string{stop}
+	}
+
 	// Convert to Anthropic format
 	anthropicReq := &AnthropicRequest{
 		Model:     req.Model,
@@ -192,45 +229,64 @@ func (p *AnthropicProvider) ProcessRequest(ctx context.Context, req *base.Provid
 	}
 
 	// Add parameters
-	if temp, ok := req.Parameters["temperature"].(float64); ok {
+	if temp, ok := params["temperature"].(float64); ok {
 		anthropicReq.Temperature = &temp
 	}
-	if maxTokens, ok := req.Parameters["max_tokens"].(int); ok {
+	if maxTokens, ok := params["max_tokens"].(int); ok {
 		anthropicReq.MaxTokens = maxTokens
 	}
-	if topP, ok := req.Parameters["top_p"].(float64); ok {
+	if topP, ok := params["top_p"].(float64); ok {
 		anthropicReq.TopP = &topP
 	}
 
 	// Marshal request
-	reqBody, err := json.Marshal(anthropicReq)
+	reqBody, err := base.EncodeRequestBody(anthropicReq, params)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	var response *base.ProviderResponse
-	
-	// Use circuit breaker
-	callErr := p.circuitBreaker.Call(func() error {
-		resp, err := p.makeRequest(ctx, "POST", "/messages", reqBody, req.Headers)
-		if err != nil {
-			return err
-		}
-		response = resp
-		return nil
+	headers, err := p.config.OutboundHeaders(req)
+	if err != nil {
+		return nil, err
+	}
+	p.config.SetIdempotencyKey(headers, req, reqBody)
+
+	// Retry retryable failures; each attempt goes through the circuit breaker,
+	// which counts retryable statuses as failures
+	response, callErr := p.config.WithRetry(ctx, func() (*base.ProviderResponse, error) {
+		var attempt *base.ProviderResponse
+		err := p.circuitBreaker.Call(func() error {
+			resp, err := p.makeRequest(ctx, "POST", p.config.ModelPath(req.Model, "/messages"), reqBody, headers)
+			if err != nil {
+				return err
+			}
+			attempt = resp
+			return p.config.CheckStatus(resp)
+		})
+		return attempt, err
 	})
 
 	if callErr != nil {
+		p.logger.Debugf("Provider %s request %s failed: %v", p.name, req.RequestID, callErr)
 		return nil, callErr
 	}
+	response.RequestID = req.RequestID
+	if len(dropped) > 0 {
+		p.logger.Debugf("Provider %s request %s dropped unsupported parameters: %v", p.name, req.RequestID, dropped)
+		response.Metadata[base.DroppedParametersMetadata] = strings.Join(dropped, ",")
+	}
 
 	// Calculate cost
 	if response.Usage != nil {
-		cost := p.calculateCost(req.Model, response.Usage)
-		response.Cost = cost
+		response.Cost, response.ReconciledCost = p.calculateCost(req.Model, response.Usage)
+	}
+
+	if trace := p.config.CaptureTraceHeaders(response.Headers, response.Metadata); len(trace) > 0 {
+		p.logger.Debugf("Provider %s request %s correlates with upstream %v", p.name, req.RequestID, trace)
 	}
 
 	response.Latency = time.Since(start)
+	p.logger.Debugf("Provider %s request %s completed with status %d in %v", p.name, req.RequestID, response.StatusCode, response.Latency)
 	return response, nil
 }
 
@@ -242,8 +298,18 @@ func (p *AnthropicProvider) ProcessStreamingRequest(ctx context.Context, req *ba
 
 // Configuration methods
 func (p *AnthropicProvider) UpdateConfig(config *base.ProviderConfig) error {
+	if _, err := base.ParseHeaderTemplates(config.Headers); err != nil {
+		return err
+	}
+	if err := config.Parameters.Validate(); err != nil {
+		return err
+	}
+	if err := config.TLS.Validate(); err != nil {
+		return err
+	}
 	p.config = config
-	p.client.Timeout = config.Timeout
+	p.client.CloseIdleConnections()
+	p.client = base.NewHTTPClient(config)
 	return nil
 }
 
@@ -267,19 +333,28 @@ func (p *AnthropicProvider) makeRequest(ctx context.Context, method, path string
 	for key, value := range headers {
 		req.Header.Set(key, value)
 	}
-	for key, value := range p.config.Headers {
-		req.Header.Set(key, value)
-	}
 
-	resp, err := p.client.Do(req)
+	resp, err := p.compressor.Do(p.client, p.config.RequestCompression, req, body)
 	if err != nil {
-		return nil, err
+		return nil, gatewayerrors.WrapProviderError(p.name, p.config.Timeout, err)
 	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
+	respBody, stream, err := p.config.ReadResponseBody(resp.StatusCode, resp.Body)
 	if err != nil {
-		return nil, err
+		return nil, gatewayerrors.WrapProviderError(p.name, p.config.Timeout, err)
+	}
+	if stream != nil {
+		// Too large to buffer: passed through without usage, which is only
+		// known from the parsed body
+		p.logger.Warnf("Provider %s response exceeds %d bytes; passing it through unbuffered", p.name, p.config.MaxResponseBytes)
+		return &base.ProviderResponse{
+			StatusCode: resp.StatusCode,
+			Headers:    p.convertHeaders(resp.Header),
+			BodyStream: stream,
+			Metadata: map[string]string{
+				"provider":                p.name,
+				base.StreamedBodyMetadata: "true",
+			},
+		}, nil
 	}
 
 	// Parse Anthropic response for usage information
@@ -287,10 +362,18 @@ func (p *AnthropicProvider) makeRequest(ctx context.Context, method, path string
 	if resp.StatusCode == 200 {
 		var anthropicResp AnthropicResponse
 		if json.Unmarshal(respBody, &anthropicResp) == nil {
+			// Cache reads are reported apart from input tokens; they are
+			// folded in as cached prompt tokens, as OpenAI reports them
+			promptTokens := anthropicResp.Usage.InputTokens + anthropicResp.Usage.CacheReadInputTokens
 			usage = &base.TokenUsage{
-				PromptTokens:     int64(anthropicResp.Usage.InputTokens),
+				PromptTokens:     int64(promptTokens),
 				CompletionTokens: int64(anthropicResp.Usage.OutputTokens),
-				TotalTokens:      int64(anthropicResp.Usage.InputTokens + anthropicResp.Usage.OutputTokens),
+				TotalTokens:      int64(promptTokens + anthropicResp.Usage.OutputTokens),
+			}
+			if anthropicResp.Usage.CacheReadInputTokens > 0 {
+				usage.PromptTokensDetails = &base.PromptTokensDetails{
+					CachedTokens: int64(anthropicResp.Usage.CacheReadInputTokens),
+				}
 			}
 		}
 	}
@@ -316,21 +399,8 @@ func (p *AnthropicProvider) convertHeaders(headers http.Header) map[string]strin
 	return result
 }
 
-func (p *AnthropicProvider) calculateCost(model string, usage *base.TokenUsage) float64 {
-	if usage == nil {
-		return 0
-	}
-
-	// Find model config
-	for _, modelConfig := range p.config.Models {
-		if modelConfig.Name == model {
-			inputCost := float64(usage.PromptTokens) / 1000.0 * modelConfig.CostPer1kInputTokens
-			outputCost := float64(usage.CompletionTokens) / 1000.0 * modelConfig.CostPer1kOutputTokens
-			return inputCost + outputCost
-		}
-	}
-
-	return 0 // Unknown model
+func (p *AnthropicProvider) calculateCost(model string, usage *base.TokenUsage) (float64, float64) {
+	return p.config.Cost(model, usage)
 }
 
 func (p *AnthropicProvider) startHealthMonitoring() {
@@ -0,0 +1,65 @@
+package base
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Oversize response handling, for responses larger than MaxResponseBytes
+const (
+	OversizeResponseError  = "error"  // fail the request (default)
+	OversizeResponseStream = "stream" // pass the body through unbuffered as BodyStream
+)
+
+// StreamedBodyMetadata marks a response whose body was too large to buffer
+// and is passed through as BodyStream
+const StreamedBodyMetadata = "body_streamed"
+
+// ResponseTooLargeError reports an upstream response body over the
+// configured buffering limit
+type ResponseTooLargeError struct {
+	Provider string
+	Limit    int64
+}
+
+func (e *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("provider %s response exceeds the %d byte buffering limit", e.Provider, e.Limit)
+}
+
+// ReadResponseBody reads an upstream response body, buffering at most
+// MaxResponseBytes (unlimited when 0). A larger successful body is returned
+// as a stream over the whole body when oversize responses stream, and is an
+// error otherwise; error responses are never streamed. ReadResponseBody
+// closes body unless it returns a stream, which the caller must close.
+func (c *ProviderConfig) ReadResponseBody(statusCode int, body io.ReadCloser) ([]byte, io.ReadCloser, error) {
+	if c.MaxResponseBytes <= 0 {
+		defer body.Close()
+		data, err := io.ReadAll(body)
+		return data, nil, err
+	}
+
+	// Read one byte past the limit to tell a body at the limit from a larger one
+	data, err := io.ReadAll(io.LimitReader(body, c.MaxResponseBytes+1))
+	if err != nil || int64(len(data)) <= c.MaxResponseBytes {
+		body.Close()
+		return data, nil, err
+	}
+
+	if c.OversizeResponse == OversizeResponseStream && statusCode < 400 {
+		return nil, &streamedBody{Reader: io.MultiReader(bytes.NewReader(data), body), body: body}, nil
+	}
+	body.Close()
+	return nil, nil, &ResponseTooLargeError{Provider: c.Name, Limit: c.MaxResponseBytes}
+}
+
+// streamedBody reads the already-buffered prefix followed by the rest of the
+// upstream body, and closes the upstream body
+type streamedBody struct {
+	io.Reader
+	body io.Closer
+}
+
+func (s *streamedBody) Close() error {
+	return s.body.Close()
+}
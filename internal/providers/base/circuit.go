@@ -0,0 +1,17 @@
+package base
+
+import (
+	"github.com/bendiamant/leash-gateway/internal/circuitbreaker"
+	"go.uber.org/zap"
+)
+
+// LogCircuitTransition logs a provider circuit breaker's state change with
+// the failure rate, counts and recent errors that led to it. Opening is
+// logged as a warning, other changes as information.
+func LogCircuitTransition(logger *zap.SugaredLogger, transition circuitbreaker.Transition) {
+	if transition.To == circuitbreaker.StateOpen {
+		logger.Warnw("Circuit breaker opened", transition.Fields()...)
+		return
+	}
+	logger.Infow("Circuit breaker state changed", transition.Fields()...)
+}
@@ -0,0 +1,89 @@
+package base
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+// DefaultCompressionMinBytes is the smallest request body compressed when no
+// minimum is configured
+const DefaultCompressionMinBytes = 64 * 1024
+
+// CompressionConfig gzips large request bodies for providers that
+// accept Content-Encoding: gzip, e.g. long documents in a prompt
+type CompressionConfig struct {
+	Enabled  bool `yaml:"enabled" json:"enabled"`
+	MinBytes int  `yaml:"min_bytes,omitempty" json:"min_bytes,omitempty"` // Smaller bodies are sent uncompressed; defaults to 64KB
+}
+
+// minBytes returns the smallest body compressed
+func (c CompressionConfig) minBytes() int {
+	if c.MinBytes > 0 {
+		return c.MinBytes
+	}
+	return DefaultCompressionMinBytes
+}
+
+// RequestCompressor sends a provider's request bodies gzip-encoded. A
+// provider answering 415 Unsupported Media Type does not accept compressed
+// bodies: the request is resent uncompressed and no later request to the
+// provider is compressed.
+type RequestCompressor struct {
+	OnRejected func() // called once, when the provider first rejects a compressed body
+	rejected   atomic.Bool
+}
+
+// Rejected reports whether the provider has rejected a compressed body
+func (c *RequestCompressor) Rejected() bool {
+	return c.rejected.Load()
+}
+
+// Do sends req, whose body is body, compressing the body when config calls
+// for it and the provider has not rejected compression
+func (c *RequestCompressor) Do(client *http.Client, config CompressionConfig, req *http.Request, body []byte) (*http.Response, error) {
+	if !config.Enabled || len(body) < config.minBytes() || c.rejected.Load() || req.Header.Get("Content-Encoding") != "" {
+		return client.Do(req)
+	}
+
+	compressed, err := gzipBody(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress request body: %w", err)
+	}
+	gzipped := req.Clone(req.Context())
+	gzipped.Body = io.NopCloser(bytes.NewReader(compressed))
+	gzipped.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(compressed)), nil
+	}
+	gzipped.ContentLength = int64(len(compressed))
+	gzipped.Header.Set("Content-Encoding", "gzip")
+
+	resp, err := client.Do(gzipped)
+	if err != nil || resp.StatusCode != http.StatusUnsupportedMediaType {
+		return resp, err
+	}
+
+	// The provider cannot decode gzip: resend the original body
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if c.rejected.CompareAndSwap(false, true) && c.OnRejected != nil {
+		c.OnRejected()
+	}
+	return client.Do(req)
+}
+
+// gzipBody returns body gzip-compressed
+func gzipBody(body []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write(body); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,80 @@
+package base
+
+// PromptTokensDetails breaks down prompt tokens the provider billed
+// differently, in the OpenAI usage format
+type PromptTokensDetails struct {
+	CachedTokens int64 `json:"cached_tokens"`
+}
+
+// CompletionTokensDetails breaks down completion tokens, in the OpenAI usage
+// format. Reasoning tokens are billed as completion tokens but never appear
+// in the response.
+type CompletionTokensDetails struct {
+	ReasoningTokens int64 `json:"reasoning_tokens"`
+}
+
+// CachedTokens returns the prompt tokens served from the provider's cache
+func (u *TokenUsage) CachedTokens() int64 {
+	if u == nil || u.PromptTokensDetails == nil {
+		return 0
+	}
+	return u.PromptTokensDetails.CachedTokens
+}
+
+// ReasoningTokens returns the completion tokens the model spent reasoning
+func (u *TokenUsage) ReasoningTokens() int64 {
+	if u == nil || u.CompletionTokensDetails == nil {
+		return 0
+	}
+	return u.CompletionTokensDetails.ReasoningTokens
+}
+
+// Cost prices a response's usage for a model. The estimate bills every
+// prompt token at the input rate and every completion token, reasoning
+// included, at the output rate; the reconciled cost follows the provider's
+// usage breakdown, billing cached prompt tokens and reasoning tokens at the
+// model's cached input and reasoning rates when configured. Current prices
+// in the Prices table take precedence over configured ones. Unknown models
+// cost nothing.
+func (c *ProviderConfig) Cost(model string, usage *TokenUsage) (estimated, reconciled float64) {
+	if usage == nil {
+		return 0, 0
+	}
+
+	for _, modelConfig := range c.Models {
+		if modelConfig.Name != model {
+			continue
+		}
+		price, ok := c.Prices.Price(c.Name, model)
+		if !ok {
+			price = configuredPrice(modelConfig)
+		}
+		inputCost := float64(usage.PromptTokens) / 1000.0 * price.Input
+		outputCost := float64(usage.CompletionTokens) / 1000.0 * price.Output
+		estimated = inputCost + outputCost
+
+		cached := usage.CachedTokens()
+		if cached > usage.PromptTokens {
+			cached = usage.PromptTokens
+		}
+		if cached > 0 && price.CachedInput > 0 {
+			uncachedCost := float64(usage.PromptTokens-cached) / 1000.0 * price.Input
+			cachedCost := float64(cached) / 1000.0 * price.CachedInput
+			inputCost = uncachedCost + cachedCost
+		}
+
+		// Reasoning tokens are counted within completion tokens
+		reasoning := usage.ReasoningTokens()
+		if reasoning > usage.CompletionTokens {
+			reasoning = usage.CompletionTokens
+		}
+		if reasoning > 0 && price.Reasoning > 0 {
+			answerCost := float64(usage.CompletionTokens-reasoning) / 1000.0 * price.Output
+			reasoningCost := float64(reasoning) / 1000.0 * price.Reasoning
+			outputCost = answerCost + reasoningCost
+		}
+		return estimated, inputCost + outputCost
+	}
+
+	return 0, 0
+}
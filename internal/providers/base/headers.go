@@ -0,0 +1,93 @@
+package base
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// HeaderTemplateData is the data available to templated header values,
+// e.g. "{{.Model}}" or "team-{{.TenantID}}"
+type HeaderTemplateData struct {
+	RequestID string
+	TenantID  string
+	Model     string
+	Streaming bool
+	Metadata  map[string]string
+}
+
+// ParseHeaderTemplates parses the templated values of a header map, returning
+// an error naming the first header whose value is not a valid template.
+// Values without template actions are returned as nil entries.
+func ParseHeaderTemplates(headers map[string]string) (map[string]*template.Template, error) {
+	templates := make(map[string]*template.Template, len(headers))
+	for key, value := range headers {
+		if !strings.Contains(value, "{{") {
+			templates[key] = nil
+			continue
+		}
+
+		tmpl, err := template.New(key).Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template for header %s: %w", key, err)
+		}
+		if _, err := renderHeader(tmpl, HeaderTemplateData{Metadata: map[string]string{}}); err != nil {
+			return nil, fmt.Errorf("invalid template for header %s: %w", key, err)
+		}
+		templates[key] = tmpl
+	}
+	return templates, nil
+}
+
+// ResolveHeaders returns the provider's configured headers with templated
+// values resolved against the request
+func (c *ProviderConfig) ResolveHeaders(req *ProviderRequest) (map[string]string, error) {
+	templates, err := ParseHeaderTemplates(c.Headers)
+	if err != nil {
+		return nil, err
+	}
+
+	data := HeaderTemplateData{
+		RequestID: req.RequestID,
+		TenantID:  req.TenantID,
+		Model:     req.Model,
+		Streaming: req.Streaming,
+		Metadata:  req.Metadata,
+	}
+	if data.Metadata == nil {
+		data.Metadata = map[string]string{}
+	}
+
+	resolved := make(map[string]string, len(c.Headers))
+	for key, value := range c.Headers {
+		if tmpl := templates[key]; tmpl != nil {
+			if value, err = renderHeader(tmpl, data); err != nil {
+				return nil, fmt.Errorf("failed to resolve header %s: %w", key, err)
+			}
+		}
+		resolved[key] = value
+	}
+	return resolved, nil
+}
+
+// OutboundHeaders returns the headers to send upstream for a request: the
+// request's own headers overlaid with the provider's resolved headers
+func (c *ProviderConfig) OutboundHeaders(req *ProviderRequest) (map[string]string, error) {
+	headers := req.OutboundHeaders()
+	configured, err := c.ResolveHeaders(req)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range configured {
+		headers[key] = value
+	}
+	return headers, nil
+}
+
+func renderHeader(tmpl *template.Template, data HeaderTemplateData) (string, error) {
+	var value strings.Builder
+	if err := tmpl.Execute(&value, data); err != nil {
+		return "", err
+	}
+	return value.String(), nil
+}
@@ -0,0 +1,47 @@
+package base
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// HealthCheckProbe is a provider's built-in health check request, used for
+// whatever the health check config leaves unset
+type HealthCheckProbe struct {
+	Method string
+	Path   string
+	Body   []byte
+}
+
+// NewHealthCheckRequest builds the health check request for an endpoint. The
+// configured path, method and body override the provider's default probe; a
+// configured path without a method is requested with GET, and the default
+// body is only sent to the default path and method.
+func (c HealthCheckConfig) NewHealthCheckRequest(ctx context.Context, endpoint string, probe HealthCheckProbe) (*http.Request, error) {
+	method, path, body := probe.Method, probe.Path, probe.Body
+	if c.Path != "" {
+		method, path, body = http.MethodGet, c.Path, nil
+	}
+	if c.Method != "" {
+		method, body = strings.ToUpper(c.Method), nil
+	}
+	if c.Body != "" {
+		body = []byte(c.Body)
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(endpoint, "/")+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
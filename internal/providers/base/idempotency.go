@@ -0,0 +1,36 @@
+package base
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// DefaultIdempotencyHeader is the header OpenAI reads idempotency keys from
+const DefaultIdempotencyHeader = "Idempotency-Key"
+
+// IdempotencyKey derives a request's idempotency key from its ID and encoded
+// body, so every attempt at the same request carries the same key while
+// distinct requests, even with identical bodies, get distinct ones
+func IdempotencyKey(req *ProviderRequest, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(req.RequestID))
+	hash.Write([]byte{0})
+	hash.Write(body)
+	return "leash-" + hex.EncodeToString(hash.Sum(nil))[:32]
+}
+
+// SetIdempotencyKey adds the request's idempotency key to outbound headers
+// when the provider has an idempotency header configured. A key the client
+// already sent under that header is passed through unchanged.
+func (c *ProviderConfig) SetIdempotencyKey(headers map[string]string, req *ProviderRequest, body []byte) {
+	if c.IdempotencyHeader == "" {
+		return
+	}
+	for key := range headers {
+		if strings.EqualFold(key, c.IdempotencyHeader) {
+			return
+		}
+	}
+	headers[c.IdempotencyHeader] = IdempotencyKey(req, body)
+}
@@ -0,0 +1,115 @@
+package base
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Actions for request parameters a provider does not support
+const (
+	UnsupportedParameterDrop  = "drop"
+	UnsupportedParameterError = "error"
+)
+
+// DroppedParametersMetadata is the response metadata key listing request
+// parameters dropped because the provider does not support them
+const DroppedParametersMetadata = "dropped_parameters"
+
+// ErrUnsupportedParameter is returned for unsupported request parameters when
+// the provider's mapping is configured to error on them
+var ErrUnsupportedParameter = errors.New("unsupported parameter")
+
+// ParameterMapping translates gateway (OpenAI-format) request parameters to a
+// provider's names. Parameters not listed pass through unchanged.
+type ParameterMapping struct {
+	Rename        map[string]string `yaml:"rename,omitempty" json:"rename,omitempty"`                 // gateway name -> provider name
+	Unsupported   []string          `yaml:"unsupported,omitempty" json:"unsupported,omitempty"`       // parameters the provider rejects
+	OnUnsupported string            `yaml:"on_unsupported,omitempty" json:"on_unsupported,omitempty"` // drop (default), error
+}
+
+// Merge returns the mapping with override's renames and unsupported
+// parameters added; override's action wins when set
+func (m ParameterMapping) Merge(override ParameterMapping) ParameterMapping {
+	merged := ParameterMapping{
+		Rename:        make(map[string]string, len(m.Rename)+len(override.Rename)),
+		Unsupported:   append(append([]string{}, m.Unsupported...), override.Unsupported...),
+		OnUnsupported: m.OnUnsupported,
+	}
+	for from, to := range m.Rename {
+		merged.Rename[from] = to
+	}
+	for from, to := range override.Rename {
+		merged.Rename[from] = to
+	}
+	if override.OnUnsupported != "" {
+		merged.OnUnsupported = override.OnUnsupported
+	}
+	return merged
+}
+
+// Validate checks the unsupported-parameter action
+func (m ParameterMapping) Validate() error {
+	switch m.OnUnsupported {
+	case "", UnsupportedParameterDrop, UnsupportedParameterError:
+		return nil
+	default:
+		return fmt.Errorf("invalid on_unsupported action: %s", m.OnUnsupported)
+	}
+}
+
+// Apply maps request parameters to the provider's names, returning the mapped
+// parameters and the sorted names of dropped unsupported ones. With the error
+// action, any unsupported parameter fails with ErrUnsupportedParameter.
+func (m ParameterMapping) Apply(params map[string]interface{}) (map[string]interface{}, []string, error) {
+	unsupported := make(map[string]bool, len(m.Unsupported))
+	for _, name := range m.Unsupported {
+		unsupported[name] = true
+	}
+
+	mapped := make(map[string]interface{}, len(params))
+	var dropped []string
+	for name, value := range params {
+		if unsupported[name] {
+			dropped = append(dropped, name)
+			continue
+		}
+		if renamed, ok := m.Rename[name]; ok {
+			name = renamed
+		}
+		mapped[name] = value
+	}
+	sort.Strings(dropped)
+
+	if len(dropped) > 0 && m.OnUnsupported == UnsupportedParameterError {
+		return nil, nil, fmt.Errorf("%w: %s", ErrUnsupportedParameter, strings.Join(dropped, ", "))
+	}
+	return mapped, dropped, nil
+}
+
+// reservedParameters are request body fields set by the provider itself that
+// request parameters may not override
+var reservedParameters = map[string]bool{"model": true, "messages": true, "stream": true}
+
+// EncodeRequestBody marshals a provider request with mapped parameters
+// overlaid, so parameters without a dedicated request field still reach the
+// provider
+func EncodeRequestBody(request interface{}, params map[string]interface{}) ([]byte, error) {
+	encoded, err := json.Marshal(request)
+	if err != nil || len(params) == 0 {
+		return encoded, err
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(encoded, &body); err != nil {
+		return nil, err
+	}
+	for name, value := range params {
+		if !reservedParameters[name] {
+			body[name] = value
+		}
+	}
+	return json.Marshal(body)
+}
@@ -0,0 +1,64 @@
+package base
+
+import "sync"
+
+// ModelPrice is a model's price per 1k tokens, in the units of ModelConfig
+type ModelPrice struct {
+	Input       float64 `json:"cost_per_1k_input_tokens"`
+	Output      float64 `json:"cost_per_1k_output_tokens"`
+	CachedInput float64 `json:"cost_per_1k_cached_input_tokens,omitempty"` // 0 bills cached tokens at the input rate
+	Reasoning   float64 `json:"cost_per_1k_reasoning_tokens,omitempty"`    // 0 bills reasoning tokens at the output rate
+}
+
+// configuredPrice returns the price configured for a model
+func configuredPrice(model ModelConfig) ModelPrice {
+	return ModelPrice{
+		Input:       model.CostPer1kInputTokens,
+		Output:      model.CostPer1kOutputTokens,
+		CachedInput: model.CostPer1kCachedInputTokens,
+		Reasoning:   model.CostPer1kReasoningTokens,
+	}
+}
+
+// PriceTable holds current model prices, e.g. from a pricing feed, that
+// take precedence over the prices configured for a provider's models.
+// Models without a current price are billed at their configured price.
+type PriceTable struct {
+	mu     sync.RWMutex
+	prices map[string]map[string]ModelPrice // provider -> model -> price
+}
+
+// NewPriceTable creates a price table holding no prices
+func NewPriceTable() *PriceTable {
+	return &PriceTable{}
+}
+
+// Replace swaps in a complete set of prices; nil reverts every model to its
+// configured price
+func (t *PriceTable) Replace(prices map[string]map[string]ModelPrice) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.prices = prices
+}
+
+// Price returns the current price of a provider's model, if the table has one
+func (t *PriceTable) Price(provider, model string) (ModelPrice, bool) {
+	if t == nil {
+		return ModelPrice{}, false
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	price, ok := t.prices[provider][model]
+	return price, ok
+}
+
+// Len returns the number of models the table prices
+func (t *PriceTable) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	count := 0
+	for _, models := range t.prices {
+		count += len(models)
+	}
+	return count
+}
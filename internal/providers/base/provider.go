@@ -2,7 +2,12 @@ package base
 
 import (
 	"context"
+	"io"
+	"net/url"
+	"strings"
 	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/correlation"
 )
 
 // Provider represents the base interface for all LLM providers
@@ -60,18 +65,34 @@ func (h HealthStatus) String() string {
 
 // ProviderConfig represents provider configuration
 type ProviderConfig struct {
-	Name                   string                 `yaml:"name" json:"name"`
-	Endpoint               string                 `yaml:"endpoint" json:"endpoint"`
-	Timeout                time.Duration          `yaml:"timeout" json:"timeout"`
-	RetryAttempts          int                    `yaml:"retry_attempts" json:"retry_attempts"`
-	RetryDelay             time.Duration          `yaml:"retry_delay" json:"retry_delay"`
-	RetryBackoffMultiplier float64                `yaml:"retry_backoff_multiplier" json:"retry_backoff_multiplier"`
-	MaxRetryDelay          time.Duration          `yaml:"max_retry_delay" json:"max_retry_delay"`
-	CircuitBreaker         CircuitBreakerConfig   `yaml:"circuit_breaker" json:"circuit_breaker"`
-	HealthCheck            HealthCheckConfig      `yaml:"health_check" json:"health_check"`
-	Models                 []ModelConfig          `yaml:"models" json:"models"`
-	Headers                map[string]string      `yaml:"headers,omitempty" json:"headers,omitempty"`
-	RateLimits             *RateLimitConfig       `yaml:"rate_limits,omitempty" json:"rate_limits,omitempty"`
+	Name                    string               `yaml:"name" json:"name"`
+	Type                    string               `yaml:"type,omitempty" json:"type,omitempty"` // Implementation (openai, anthropic), defaults to the name
+	Endpoint                string               `yaml:"endpoint" json:"endpoint"`
+	Timeout                 time.Duration        `yaml:"timeout" json:"timeout"`
+	RetryAttempts           int                  `yaml:"retry_attempts" json:"retry_attempts"`
+	RetryDelay              time.Duration        `yaml:"retry_delay" json:"retry_delay"`
+	RetryBackoffMultiplier  float64              `yaml:"retry_backoff_multiplier" json:"retry_backoff_multiplier"`
+	MaxRetryDelay           time.Duration        `yaml:"max_retry_delay" json:"max_retry_delay"`
+	RetryableStatusCodes    []int                `yaml:"retryable_status_codes,omitempty" json:"retryable_status_codes,omitempty"`         // Added to the default retryable set
+	NonRetryableStatusCodes []int                `yaml:"non_retryable_status_codes,omitempty" json:"non_retryable_status_codes,omitempty"` // Removed from the default retryable set
+	CircuitBreaker          CircuitBreakerConfig `yaml:"circuit_breaker" json:"circuit_breaker"`
+	HealthCheck             HealthCheckConfig    `yaml:"health_check" json:"health_check"`
+	Models                  []ModelConfig        `yaml:"models" json:"models"`
+	Headers                 map[string]string    `yaml:"headers,omitempty" json:"headers,omitempty"`
+	Parameters              ParameterMapping     `yaml:"parameters,omitempty" json:"parameters,omitempty"` // Merged over the provider's built-in mapping
+	TLS                     TLSConfig            `yaml:"tls,omitempty" json:"tls,omitempty"`
+	Shadow                  ShadowConfig         `yaml:"shadow,omitempty" json:"shadow,omitempty"`
+	StreamFormat            string               `yaml:"stream_format,omitempty" json:"stream_format,omitempty"` // passthrough (default) or canonical
+	StreamHeartbeat         time.Duration        `yaml:"stream_heartbeat,omitempty" json:"stream_heartbeat,omitempty"` // Keepalive comment sent after this long without stream data; 0 disables
+	RateLimits              *RateLimitConfig     `yaml:"rate_limits,omitempty" json:"rate_limits,omitempty"`
+	IdempotencyHeader       string               `yaml:"idempotency_header,omitempty" json:"idempotency_header,omitempty"` // Header carrying a key reused across retries; empty sends none
+	MaxResponseBytes        int64                `yaml:"max_response_bytes,omitempty" json:"max_response_bytes,omitempty"` // Largest non-streaming body buffered; 0 is unlimited
+	OversizeResponse        string               `yaml:"oversize_response,omitempty" json:"oversize_response,omitempty"`   // error (default) or stream, for bodies over MaxResponseBytes
+	TraceHeaders            []string             `yaml:"trace_headers,omitempty" json:"trace_headers,omitempty"`           // Upstream correlation headers returned to clients as X-Leash-Provider-<name>
+	RequestCompression      CompressionConfig    `yaml:"request_compression,omitempty" json:"request_compression,omitempty"`
+	StreamIdleTimeout       time.Duration        `yaml:"stream_idle_timeout,omitempty" json:"stream_idle_timeout,omitempty"`
+	StreamMaxDuration       time.Duration        `yaml:"stream_max_duration,omitempty" json:"stream_max_duration,omitempty"`
+	Prices                  *PriceTable          `yaml:"-" json:"-"`
 }
 
 // CircuitBreakerConfig represents circuit breaker configuration
@@ -80,6 +101,17 @@ type CircuitBreakerConfig struct {
 	SuccessThreshold int           `yaml:"success_threshold" json:"success_threshold"`
 	Timeout          time.Duration `yaml:"timeout" json:"timeout"`
 	MinRequests      int           `yaml:"min_requests" json:"min_requests"`
+	HalfOpenProbes   int           `yaml:"half_open_max_probes" json:"half_open_max_probes"` // concurrent probes while half-open, default 1
+	ErrorSamples     int           `yaml:"error_samples" json:"error_samples"`               // recent errors logged with state changes, default 5
+}
+
+// ShadowConfig mirrors a fraction of a provider's requests to another
+// provider for comparison. The shadow's responses are recorded, never returned.
+type ShadowConfig struct {
+	Provider string        `yaml:"provider" json:"provider"`                   // shadow provider name; empty disables mirroring
+	Fraction float64       `yaml:"fraction" json:"fraction"`                   // share of requests mirrored, 0-1
+	Model    string        `yaml:"model,omitempty" json:"model,omitempty"`     // model sent to the shadow, defaults to the request's
+	Timeout  time.Duration `yaml:"timeout,omitempty" json:"timeout,omitempty"` // per shadow request, default 30s
 }
 
 // HealthCheckConfig represents health check configuration
@@ -87,17 +119,34 @@ type HealthCheckConfig struct {
 	Enabled  bool          `yaml:"enabled" json:"enabled"`
 	Interval time.Duration `yaml:"interval" json:"interval"`
 	Timeout  time.Duration `yaml:"timeout" json:"timeout"`
-	Path     string        `yaml:"path" json:"path"`
-	Method   string        `yaml:"method" json:"method"`
+	Path     string        `yaml:"path" json:"path"`     // relative to the endpoint, defaults to the provider's probe
+	Method   string        `yaml:"method" json:"method"` // defaults to GET when a path is set
+	Body     string        `yaml:"body" json:"body"`     // optional JSON request body
 }
 
 // ModelConfig represents model configuration and pricing
 type ModelConfig struct {
-	Name                  string  `yaml:"name" json:"name"`
-	CostPer1kInputTokens  float64 `yaml:"cost_per_1k_input_tokens" json:"cost_per_1k_input_tokens"`
-	CostPer1kOutputTokens float64 `yaml:"cost_per_1k_output_tokens" json:"cost_per_1k_output_tokens"`
-	MaxTokens             int     `yaml:"max_tokens,omitempty" json:"max_tokens,omitempty"`
-	SupportsStreaming     bool    `yaml:"supports_streaming" json:"supports_streaming"`
+	Name                       string  `yaml:"name" json:"name"`
+	CostPer1kInputTokens       float64 `yaml:"cost_per_1k_input_tokens" json:"cost_per_1k_input_tokens"`
+	CostPer1kOutputTokens      float64 `yaml:"cost_per_1k_output_tokens" json:"cost_per_1k_output_tokens"`
+	CostPer1kCachedInputTokens float64 `yaml:"cost_per_1k_cached_input_tokens,omitempty" json:"cost_per_1k_cached_input_tokens,omitempty"` // 0 bills cached tokens at the input rate
+	CostPer1kReasoningTokens   float64 `yaml:"cost_per_1k_reasoning_tokens,omitempty" json:"cost_per_1k_reasoning_tokens,omitempty"`       // 0 bills reasoning tokens at the output rate
+	MaxTokens                  int     `yaml:"max_tokens,omitempty" json:"max_tokens,omitempty"`
+	RoutingWeight              float64 `yaml:"routing_weight,omitempty" json:"routing_weight,omitempty"` // Share of the model's traffic when several providers serve it
+	SupportsStreaming          bool    `yaml:"supports_streaming" json:"supports_streaming"`
+	Path                       string  `yaml:"path,omitempty" json:"path,omitempty"` // Path template relative to the endpoint, e.g. /v1/models/{model}/chat
+}
+
+// ModelPath returns the request path for a model, expanding the model's path
+// template ({model} is replaced with the escaped model name) when one is
+// configured and falling back to defaultPath otherwise
+func (c *ProviderConfig) ModelPath(model, defaultPath string) string {
+	for _, modelConfig := range c.Models {
+		if modelConfig.Name == model && modelConfig.Path != "" {
+			return strings.ReplaceAll(modelConfig.Path, "{model}", url.PathEscape(model))
+		}
+	}
+	return defaultPath
 }
 
 // RateLimitConfig represents provider-specific rate limiting
@@ -119,6 +168,19 @@ type ProviderRequest struct {
 	Metadata    map[string]string `json:"metadata"`
 }
 
+// OutboundHeaders returns the headers to send upstream, including the
+// request's correlation ID so provider-side logs can be matched to it
+func (r *ProviderRequest) OutboundHeaders() map[string]string {
+	headers := make(map[string]string, len(r.Headers)+1)
+	for key, value := range r.Headers {
+		headers[key] = value
+	}
+	if r.RequestID != "" {
+		headers[correlation.Header] = r.RequestID
+	}
+	return headers
+}
+
 // Message represents a chat message
 type Message struct {
 	Role    string `json:"role"`
@@ -127,15 +189,17 @@ type Message struct {
 
 // ProviderResponse represents a response from a provider
 type ProviderResponse struct {
-	RequestID    string            `json:"request_id"`
-	StatusCode   int               `json:"status_code"`
-	Headers      map[string]string `json:"headers"`
-	Body         []byte            `json:"body"`
-	Model        string            `json:"model"`
-	Usage        *TokenUsage       `json:"usage,omitempty"`
-	Cost         float64           `json:"cost,omitempty"`
-	Latency      time.Duration     `json:"latency"`
-	Metadata     map[string]string `json:"metadata"`
+	RequestID      string            `json:"request_id"`
+	StatusCode     int               `json:"status_code"`
+	Headers        map[string]string `json:"headers"`
+	Body           []byte            `json:"body"`
+	BodyStream     io.ReadCloser     `json:"-"` // set instead of Body for an oversize body passed through; the caller must close it
+	Model          string            `json:"model"`
+	Usage          *TokenUsage       `json:"usage,omitempty"`
+	Cost           float64           `json:"cost,omitempty"`            // estimated at list prices
+	ReconciledCost float64           `json:"reconciled_cost,omitempty"` // following the provider's usage breakdown
+	Latency        time.Duration     `json:"latency"`
+	Metadata       map[string]string `json:"metadata"`
 }
 
 // StreamingResponse represents a streaming response
@@ -146,19 +210,25 @@ type StreamingResponse struct {
 	Metadata  map[string]string `json:"metadata"`
 }
 
-// StreamChunk represents a chunk in a streaming response
+// StreamChunk represents a chunk in a streaming response. The final chunk
+// carries the stream's usage and cost, estimated if the stream failed.
 type StreamChunk struct {
-	Data      []byte            `json:"data"`
-	Done      bool              `json:"done"`
-	Error     error             `json:"error,omitempty"`
-	Metadata  map[string]string `json:"metadata,omitempty"`
+	Data           []byte            `json:"data"`
+	Done           bool              `json:"done"`
+	Error          error             `json:"error,omitempty"`
+	Usage          *TokenUsage       `json:"usage,omitempty"`
+	Cost           float64           `json:"cost,omitempty"`
+	ReconciledCost float64           `json:"reconciled_cost,omitempty"`
+	Metadata       map[string]string `json:"metadata,omitempty"`
 }
 
 // TokenUsage represents token usage information
 type TokenUsage struct {
-	PromptTokens     int64 `json:"prompt_tokens"`
-	CompletionTokens int64 `json:"completion_tokens"`
-	TotalTokens      int64 `json:"total_tokens"`
+	PromptTokens            int64                    `json:"prompt_tokens"`
+	CompletionTokens        int64                    `json:"completion_tokens"`
+	TotalTokens             int64                    `json:"total_tokens"`
+	PromptTokensDetails     *PromptTokensDetails     `json:"prompt_tokens_details,omitempty"`
+	CompletionTokensDetails *CompletionTokensDetails `json:"completion_tokens_details,omitempty"`
 }
 
 // ProviderRegistry manages multiple providers
@@ -0,0 +1,104 @@
+package base
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// DefaultRetryableStatusCodes are upstream statuses retried unless overridden
+var DefaultRetryableStatusCodes = []int{429, 500, 502, 503, 504}
+
+// StatusError reports an upstream response whose status is retryable. It is
+// returned inside circuit breaker calls so those responses count as failures.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("HTTP %d", e.StatusCode)
+}
+
+// IsRetryableStatus reports whether an upstream status should be retried and
+// counted as a provider failure. Configured non-retryable codes win over
+// configured retryable codes, which win over the defaults.
+func (c *ProviderConfig) IsRetryableStatus(statusCode int) bool {
+	for _, code := range c.NonRetryableStatusCodes {
+		if code == statusCode {
+			return false
+		}
+	}
+	for _, code := range c.RetryableStatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	for _, code := range DefaultRetryableStatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckStatus converts a retryable upstream response into a StatusError
+func (c *ProviderConfig) CheckStatus(resp *ProviderResponse) error {
+	if resp != nil && c.IsRetryableStatus(resp.StatusCode) {
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// WithRetry runs call up to 1+RetryAttempts times, backing off between
+// attempts while the error is retryable. If the last attempt still got a
+// retryable status, that upstream response is returned to the caller.
+func (c *ProviderConfig) WithRetry(ctx context.Context, call func() (*ProviderResponse, error)) (*ProviderResponse, error) {
+	delay := c.RetryDelay
+	attempts := c.RetryAttempts + 1
+
+	var resp *ProviderResponse
+	var err error
+	for attempt := 1; ; attempt++ {
+		resp, err = call()
+		if err == nil || attempt >= attempts || !isRetryable(err) {
+			break
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		delay = c.nextDelay(delay)
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && resp != nil {
+		return resp, nil
+	}
+	return resp, err
+}
+
+// nextDelay applies the backoff multiplier, capped at MaxRetryDelay
+func (c *ProviderConfig) nextDelay(delay time.Duration) time.Duration {
+	if c.RetryBackoffMultiplier > 1 {
+		delay = time.Duration(float64(delay) * c.RetryBackoffMultiplier)
+	}
+	if c.MaxRetryDelay > 0 && delay > c.MaxRetryDelay {
+		delay = c.MaxRetryDelay
+	}
+	return delay
+}
+
+// isRetryable reports whether an attempt error is worth retrying: retryable
+// statuses and network errors are, anything else (e.g. an open circuit) is not
+func isRetryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
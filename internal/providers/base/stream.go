@@ -0,0 +1,203 @@
+package base
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// PartialUsageMetadata is the stream chunk metadata key set when usage was
+// estimated because the stream failed before the provider reported it
+const PartialUsageMetadata = "partial_usage"
+
+// ErrStreamInterrupted is returned when a provider stream ends before its
+// completion marker
+var ErrStreamInterrupted = errors.New("provider stream ended before completion")
+
+// ErrStreamIdleTimeout is returned when a provider stream sends nothing for
+// longer than its idle timeout
+var ErrStreamIdleTimeout = errors.New("provider stream idle timeout exceeded")
+
+// ErrStreamMaxDuration is returned when a provider stream stays open longer
+// than its maximum duration
+var ErrStreamMaxDuration = errors.New("provider stream maximum duration exceeded")
+
+// StreamDeadline ends a provider stream that hangs without a terminal event,
+// closing its body once the provider has sent nothing for the idle timeout
+// or the stream has been open for the maximum duration. The blocked read
+// then fails, so the reading goroutine and connection are released. The
+// idle clock only runs while waiting on the provider: time spent handing
+// data to a slow client does not count. Zero disables either limit.
+type StreamDeadline struct {
+	mu        sync.Mutex
+	body      io.Closer
+	idle      time.Duration
+	idleTimer *time.Timer
+	maxTimer  *time.Timer
+	err       error
+}
+
+// NewStreamDeadline starts the maximum duration of a stream read from body
+func NewStreamDeadline(body io.Closer, idleTimeout, maxDuration time.Duration) *StreamDeadline {
+	d := &StreamDeadline{body: body, idle: idleTimeout}
+	if maxDuration > 0 {
+		d.maxTimer = time.AfterFunc(maxDuration, func() { d.expire(ErrStreamMaxDuration) })
+	}
+	return d
+}
+
+// Waiting starts the idle clock before a read from the provider
+func (d *StreamDeadline) Waiting() {
+	if d.idle <= 0 {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return
+	}
+	if d.idleTimer == nil {
+		d.idleTimer = time.AfterFunc(d.idle, func() { d.expire(ErrStreamIdleTimeout) })
+		return
+	}
+	d.idleTimer.Reset(d.idle)
+}
+
+// Received stops the idle clock once the provider has sent data
+func (d *StreamDeadline) Received() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.idleTimer != nil {
+		d.idleTimer.Stop()
+	}
+}
+
+// Stop releases the timers once the stream has ended
+func (d *StreamDeadline) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.idleTimer != nil {
+		d.idleTimer.Stop()
+	}
+	if d.maxTimer != nil {
+		d.maxTimer.Stop()
+	}
+}
+
+// Err returns the limit that ended the stream, nil when none did
+func (d *StreamDeadline) Err() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.err
+}
+
+// expire closes the stream's body on reaching a limit
+func (d *StreamDeadline) expire(err error) {
+	d.mu.Lock()
+	if d.err != nil {
+		d.mu.Unlock()
+		return
+	}
+	d.err = err
+	d.mu.Unlock()
+	d.body.Close()
+}
+
+// StreamUsage follows an OpenAI-format server-sent event stream so usage can
+// be reported for it. The provider's own usage is used when the stream
+// carries it; otherwise usage is estimated at four characters per token from
+// the request messages and the output received so far.
+type StreamUsage struct {
+	promptTokens int64
+	outputChars  int
+	reported     *TokenUsage
+	done         bool
+	pending      []byte // incomplete trailing line of the last chunk
+}
+
+// NewStreamUsage creates usage tracking for a streaming request
+func NewStreamUsage(req *ProviderRequest) *StreamUsage {
+	chars := 0
+	for _, message := range req.Messages {
+		chars += len(message.Content)
+	}
+	return &StreamUsage{promptTokens: int64(chars / 4)}
+}
+
+// Observe consumes raw stream bytes, which may split events at any point
+func (u *StreamUsage) Observe(data []byte) {
+	u.pending = append(u.pending, data...)
+	for {
+		end := bytes.IndexByte(u.pending, '\n')
+		if end < 0 {
+			return
+		}
+		u.observeLine(bytes.TrimSpace(u.pending[:end]))
+		u.pending = u.pending[end+1:]
+	}
+}
+
+// observeLine reads one SSE line. Only data lines carry events; comments
+// such as keepalive pings, event names and blank separators are skipped.
+func (u *StreamUsage) observeLine(line []byte) {
+	payload, ok := bytes.CutPrefix(line, []byte("data:"))
+	if !ok {
+		return
+	}
+	payload = bytes.TrimSpace(payload)
+	if string(payload) == "[DONE]" {
+		u.done = true
+		return
+	}
+
+	var event struct {
+		Choices []struct {
+			Delta struct {
+				Content string `json:"content"`
+			} `json:"delta"`
+		} `json:"choices"`
+		Usage *TokenUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return
+	}
+	for _, choice := range event.Choices {
+		u.outputChars += len(choice.Delta.Content)
+	}
+	if event.Usage != nil {
+		u.reported = event.Usage
+	}
+}
+
+// Done reports whether the stream's completion marker was seen
+func (u *StreamUsage) Done() bool {
+	return u.done
+}
+
+// Usage returns the stream's usage and whether it is an estimate
+func (u *StreamUsage) Usage() (*TokenUsage, bool) {
+	if u.reported != nil {
+		return u.reported, false
+	}
+	completionTokens := int64(u.outputChars / 4)
+	return &TokenUsage{
+		PromptTokens:     u.promptTokens,
+		CompletionTokens: completionTokens,
+		TotalTokens:      u.promptTokens + completionTokens,
+	}, true
+}
+
+// StreamErrorEvent encodes a terminal server-sent event telling the client
+// the stream failed, so it is not left with a silently truncated response
+func StreamErrorEvent(err error) []byte {
+	event, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]string{
+			"message": err.Error(),
+			"type":    "stream_error",
+		},
+	})
+	return append(append([]byte("data: "), event...), "\n\n"...)
+}
@@ -0,0 +1,112 @@
+package base
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ErrCertificateNotPinned is returned when a provider presents a certificate
+// chain containing none of the pinned fingerprints
+var ErrCertificateNotPinned = errors.New("provider certificate does not match any pinned fingerprint")
+
+// TLSConfig represents provider connection TLS settings
+type TLSConfig struct {
+	MinVersion   string   `yaml:"min_version,omitempty" json:"min_version,omitempty"`     // 1.2 (default), 1.3
+	PinnedSHA256 []string `yaml:"pinned_sha256,omitempty" json:"pinned_sha256,omitempty"` // hex SHA-256 fingerprints of accepted certificates, colons optional
+	CAFile       string   `yaml:"ca_file,omitempty" json:"ca_file,omitempty"`             // PEM bundle trusted in addition to the system roots
+}
+
+var tlsVersions = map[string]uint16{
+	"":    tls.VersionTLS12,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Validate checks the TLS settings, including that the CA file loads
+func (c TLSConfig) Validate() error {
+	_, err := c.ClientConfig()
+	return err
+}
+
+// ClientConfig builds the tls.Config for provider connections. Pinning is
+// checked after normal chain verification: a connection succeeds only if
+// some certificate in the presented chain matches a pinned fingerprint.
+func (c TLSConfig) ClientConfig() (*tls.Config, error) {
+	minVersion, ok := tlsVersions[c.MinVersion]
+	if !ok {
+		return nil, fmt.Errorf("invalid TLS min_version: %s (supported: 1.2, 1.3)", c.MinVersion)
+	}
+	config := &tls.Config{MinVersion: minVersion}
+
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS ca_file: %w", err)
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in TLS ca_file %s", c.CAFile)
+		}
+		config.RootCAs = roots
+	}
+
+	if len(c.PinnedSHA256) > 0 {
+		pins := make(map[string]bool, len(c.PinnedSHA256))
+		for _, pin := range c.PinnedSHA256 {
+			normalized := strings.ToLower(strings.ReplaceAll(pin, ":", ""))
+			if decoded, err := hex.DecodeString(normalized); err != nil || len(decoded) != sha256.Size {
+				return nil, fmt.Errorf("invalid pinned SHA-256 fingerprint: %s", pin)
+			}
+			pins[normalized] = true
+		}
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			for _, cert := range state.PeerCertificates {
+				fingerprint := sha256.Sum256(cert.Raw)
+				if pins[hex.EncodeToString(fingerprint[:])] {
+					return nil
+				}
+			}
+			return ErrCertificateNotPinned
+		}
+	}
+
+	return config, nil
+}
+
+// NewHTTPClient creates the HTTP client for provider calls with the
+// provider's timeout and TLS settings. Invalid TLS settings yield a client
+// that fails every request, so a misconfigured provider never connects
+// without them.
+func NewHTTPClient(config *ProviderConfig) *http.Client {
+	client := &http.Client{Timeout: config.Timeout}
+
+	tlsConfig, err := config.TLS.ClientConfig()
+	if err != nil {
+		client.Transport = failingTransport{err: err}
+		return client
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	client.Transport = transport
+	return client
+}
+
+// failingTransport rejects every request with a configuration error
+type failingTransport struct {
+	err error
+}
+
+func (t failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, t.err
+}
@@ -0,0 +1,52 @@
+package base
+
+import (
+	"net/http"
+	"strings"
+)
+
+// TraceHeaderPrefix namespaces the provider correlation headers returned to
+// clients, e.g. OpenAI's x-request-id comes back as X-Leash-Provider-X-Request-Id
+const TraceHeaderPrefix = "X-Leash-Provider-"
+
+// TraceMetadataPrefix prefixes the response metadata keys of captured
+// correlation headers, e.g. provider_x_request_id
+const TraceMetadataPrefix = "provider_"
+
+// CaptureTraceHeaders copies the provider's configured correlation headers,
+// such as the provider-side request ID its support asks for, from upstream
+// response headers into response metadata and namespaced response headers.
+// It returns the captured values by header name.
+func (c *ProviderConfig) CaptureTraceHeaders(headers, metadata map[string]string) map[string]string {
+	if len(c.TraceHeaders) == 0 || headers == nil {
+		return nil
+	}
+
+	captured := make(map[string]string, len(c.TraceHeaders))
+	for _, name := range c.TraceHeaders {
+		value, ok := lookupHeader(headers, name)
+		if !ok || value == "" {
+			continue
+		}
+		name = strings.ToLower(name)
+		captured[name] = value
+		headers[TraceHeaderPrefix+http.CanonicalHeaderKey(name)] = value
+		if metadata != nil {
+			metadata[TraceMetadataPrefix+strings.ReplaceAll(name, "-", "_")] = value
+		}
+	}
+	return captured
+}
+
+// lookupHeader finds a header by case-insensitive name
+func lookupHeader(headers map[string]string, name string) (string, bool) {
+	if value, ok := headers[http.CanonicalHeaderKey(name)]; ok {
+		return value, true
+	}
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+	return "", false
+}
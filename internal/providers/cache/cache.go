@@ -0,0 +1,291 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/featureflags"
+	"github.com/bendiamant/leash-gateway/internal/metrics"
+	"github.com/bendiamant/leash-gateway/internal/providers/base"
+	"go.uber.org/zap"
+)
+
+// Cache tiers reported in response metadata
+const (
+	TierExact    = "exact"
+	TierSemantic = "semantic"
+)
+
+// Config configures the provider response cache
+type Config struct {
+	TTL        time.Duration
+	MaxEntries int
+
+	// SemanticEnabled adds an embedding lookup after an exact-match miss;
+	// entries within SimilarityThreshold (cosine) of the prompt are served
+	SemanticEnabled     bool
+	SimilarityThreshold float64
+}
+
+// entry is a cached provider response
+type entry struct {
+	key       string
+	scope     string
+	response  *base.ProviderResponse
+	embedding []float64
+	expiresAt time.Time
+}
+
+// Cache caches provider responses keyed by the normalized prompt. Exact
+// matches are the fast path; with semantic caching enabled, near-duplicate
+// prompts are matched by embedding similarity within the same scope
+// (tenant, provider, model and parameters).
+type Cache struct {
+	config   Config
+	embedder Embedder
+	logger   *zap.SugaredLogger
+	metrics  *metrics.Registry
+	flags    *featureflags.Set // nil caches for every tenant
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	order   []string            // insertion order for eviction
+	scopes  map[string][]*entry // semantic index by scope
+}
+
+// NewCache creates a response cache; embedder may be nil when semantic
+// caching is disabled
+func NewCache(config Config, embedder Embedder, logger *zap.SugaredLogger) *Cache {
+	if config.TTL <= 0 {
+		config.TTL = 5 * time.Minute
+	}
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = 1000
+	}
+	if config.SimilarityThreshold <= 0 {
+		config.SimilarityThreshold = 0.95
+	}
+	if embedder == nil {
+		config.SemanticEnabled = false
+	}
+
+	return &Cache{
+		config:   config,
+		embedder: embedder,
+		logger:   logger,
+		entries:  make(map[string]*entry),
+		scopes:   make(map[string][]*entry),
+	}
+}
+
+// SetMetrics enables cache operation metrics
+func (c *Cache) SetMetrics(registry *metrics.Registry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.metrics = registry
+}
+
+// SetFeatureFlags limits caching to tenants whose flags enable it
+func (c *Cache) SetFeatureFlags(flags *featureflags.Set) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.flags = flags
+}
+
+// EnabledFor reports whether a tenant's requests are cached
+func (c *Cache) EnabledFor(tenantID string) bool {
+	c.mu.Lock()
+	flags := c.flags
+	c.mu.Unlock()
+	return flags == nil || flags.For(tenantID).Caching
+}
+
+// Get returns a cached response for the request and the tier that matched,
+// or nil on a miss. The embedding computed for a semantic miss is returned
+// so Set can reuse it.
+func (c *Cache) Get(ctx context.Context, providerName string, req *base.ProviderRequest) (*base.ProviderResponse, string, []float64) {
+	prompt := NormalizePrompt(req.Messages)
+	scope := requestScope(providerName, req)
+	key := cacheKey(scope, prompt)
+	now := time.Now()
+
+	c.mu.Lock()
+	if cached, ok := c.entries[key]; ok && now.Before(cached.expiresAt) {
+		c.mu.Unlock()
+		c.record("get", "hit")
+		return cached.response, TierExact, nil
+	}
+	c.mu.Unlock()
+	c.record("get", "miss")
+
+	if !c.config.SemanticEnabled {
+		return nil, "", nil
+	}
+
+	embedding, err := c.embedder.Embed(ctx, prompt)
+	if err != nil {
+		c.logger.Warnf("Semantic cache embedding failed for request %s: %v", req.RequestID, err)
+		c.record("semantic_get", "error")
+		return nil, "", nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var best *entry
+	bestScore := c.config.SimilarityThreshold
+	for _, candidate := range c.scopes[scope] {
+		if !now.Before(candidate.expiresAt) {
+			continue
+		}
+		if score := cosineSimilarity(embedding, candidate.embedding); score >= bestScore {
+			best, bestScore = candidate, score
+		}
+	}
+	if best == nil {
+		c.recordLocked("semantic_get", "miss")
+		return nil, "", embedding
+	}
+
+	c.recordLocked("semantic_get", "hit")
+	c.logger.Debugf("Semantic cache hit for request %s (similarity %.4f)", req.RequestID, bestScore)
+	return best.response, TierSemantic, nil
+}
+
+// Set caches a successful provider response. embedding may be nil, in which
+// case it is computed when semantic caching is enabled.
+func (c *Cache) Set(ctx context.Context, providerName string, req *base.ProviderRequest, resp *base.ProviderResponse, embedding []float64) {
+	if resp == nil || resp.StatusCode != 200 {
+		return
+	}
+
+	prompt := NormalizePrompt(req.Messages)
+	scope := requestScope(providerName, req)
+
+	if c.config.SemanticEnabled && embedding == nil {
+		var err error
+		if embedding, err = c.embedder.Embed(ctx, prompt); err != nil {
+			c.logger.Warnf("Semantic cache embedding failed for request %s: %v", req.RequestID, err)
+		}
+	}
+
+	cached := &entry{
+		key:       cacheKey(scope, prompt),
+		scope:     scope,
+		response:  resp,
+		embedding: embedding,
+		expiresAt: time.Now().Add(c.config.TTL),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.entries[cached.key]; exists {
+		c.removeLocked(cached.key)
+	}
+	for len(c.entries) >= c.config.MaxEntries && len(c.order) > 0 {
+		c.removeLocked(c.order[0])
+	}
+
+	c.entries[cached.key] = cached
+	c.order = append(c.order, cached.key)
+	if cached.embedding != nil {
+		c.scopes[scope] = append(c.scopes[scope], cached)
+	}
+	c.recordLocked("set", "success")
+}
+
+// Len returns the number of cached entries
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// removeLocked drops an entry from the map, eviction order and semantic index
+func (c *Cache) removeLocked(key string) {
+	cached, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	delete(c.entries, key)
+
+	for i, k := range c.order {
+		if k == key {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+
+	indexed := c.scopes[cached.scope]
+	for i, candidate := range indexed {
+		if candidate == cached {
+			c.scopes[cached.scope] = append(indexed[:i], indexed[i+1:]...)
+			break
+		}
+	}
+	if len(c.scopes[cached.scope]) == 0 {
+		delete(c.scopes, cached.scope)
+	}
+}
+
+func (c *Cache) record(operation, result string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.recordLocked(operation, result)
+}
+
+func (c *Cache) recordLocked(operation, result string) {
+	if c.metrics != nil {
+		c.metrics.CacheOperations.WithLabelValues(operation, result).Inc()
+	}
+}
+
+// NormalizePrompt renders messages as lower-cased "role: content" lines with
+// whitespace collapsed, so formatting-only differences share a cache key
+func NormalizePrompt(messages []base.Message) string {
+	lines := make([]string, len(messages))
+	for i, message := range messages {
+		content := strings.Join(strings.Fields(strings.ToLower(message.Content)), " ")
+		lines[i] = strings.ToLower(message.Role) + ": " + content
+	}
+	return strings.Join(lines, "\n")
+}
+
+// requestScope identifies requests whose responses are interchangeable apart
+// from the prompt
+func requestScope(providerName string, req *base.ProviderRequest) string {
+	params, _ := json.Marshal(req.Parameters) // map keys are sorted
+	return strings.Join([]string{req.TenantID, providerName, req.Model, string(params)}, "\x00")
+}
+
+// cacheKey hashes a scope and normalized prompt into an exact-match key
+func cacheKey(scope, prompt string) string {
+	sum := sha256.Sum256([]byte(scope + "\x00" + prompt))
+	return hex.EncodeToString(sum[:])
+}
+
+// cosineSimilarity returns the cosine similarity of two vectors, or 0 when
+// they differ in length or either is zero
+func cosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
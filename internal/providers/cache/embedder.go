@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Embedder computes embedding vectors for semantic cache lookups
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float64, error)
+}
+
+// HTTPEmbedder calls an OpenAI-compatible /embeddings endpoint
+type HTTPEmbedder struct {
+	endpoint string
+	model    string
+	headers  map[string]string
+	client   *http.Client
+}
+
+// NewHTTPEmbedder creates an embedder for an OpenAI-compatible API
+func NewHTTPEmbedder(endpoint, model string, headers map[string]string, timeout time.Duration) *HTTPEmbedder {
+	return &HTTPEmbedder{
+		endpoint: endpoint,
+		model:    model,
+		headers:  headers,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+// embeddingResponse is the subset of the embeddings response we use
+type embeddingResponse struct {
+	Data []struct {
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
+}
+
+// Embed returns the embedding of text
+func (e *HTTPEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"model": e.model,
+		"input": text,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embedding request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedding response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embedding request failed with status %d", resp.StatusCode)
+	}
+
+	var parsed embeddingResponse
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		return nil, fmt.Errorf("invalid embedding response: %w", err)
+	}
+	if len(parsed.Data) == 0 || len(parsed.Data[0].Embedding) == 0 {
+		return nil, fmt.Errorf("embedding response contained no vectors")
+	}
+	return parsed.Data[0].Embedding, nil
+}
@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/providers/base"
+)
+
+// Provider wraps a provider with the response cache. Streaming requests,
+// non-200 responses and tenants whose feature flags disable caching are
+// never cached.
+type Provider struct {
+	base.Provider
+	cache *Cache
+}
+
+// Wrap returns provider with response caching
+func Wrap(provider base.Provider, cache *Cache) *Provider {
+	return &Provider{Provider: provider, cache: cache}
+}
+
+// Unwrap returns the underlying provider
+func (p *Provider) Unwrap() base.Provider { return p.Provider }
+
+// ProcessRequest serves cached responses and caches successful ones
+func (p *Provider) ProcessRequest(ctx context.Context, req *base.ProviderRequest) (*base.ProviderResponse, error) {
+	if !p.cache.EnabledFor(req.TenantID) {
+		p.cache.record("get", "bypass")
+		return p.Provider.ProcessRequest(ctx, req)
+	}
+
+	start := time.Now()
+
+	cached, tier, embedding := p.cache.Get(ctx, p.Name(), req)
+	if cached != nil {
+		return cachedResponse(cached, req, tier, time.Since(start)), nil
+	}
+
+	resp, err := p.Provider.ProcessRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Bodies too large to buffer are passed through, never cached
+	if resp.BodyStream == nil {
+		p.cache.Set(ctx, p.Name(), req, resp, embedding)
+	}
+	return resp, nil
+}
+
+// Shutdown stops the underlying provider
+func (p *Provider) Shutdown() error {
+	if shutdowner, ok := p.Provider.(interface{ Shutdown() error }); ok {
+		return shutdowner.Shutdown()
+	}
+	return nil
+}
+
+// cachedResponse copies a cached response for a new request. Cost is zero
+// since no upstream call was made.
+func cachedResponse(cached *base.ProviderResponse, req *base.ProviderRequest, tier string, latency time.Duration) *base.ProviderResponse {
+	resp := *cached
+	resp.RequestID = req.RequestID
+	resp.Cost = 0
+	resp.Latency = latency
+
+	resp.Metadata = make(map[string]string, len(cached.Metadata)+1)
+	for key, value := range cached.Metadata {
+		resp.Metadata[key] = value
+	}
+	resp.Metadata["cache"] = tier
+	return &resp
+}
@@ -0,0 +1,142 @@
+package providers
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/circuitbreaker"
+	"github.com/bendiamant/leash-gateway/internal/providers/base"
+)
+
+// Routing strategies for models served by several providers
+const (
+	StrategyWeighted = "weighted" // split traffic by routing_weight
+	StrategyCost     = "cost"     // send traffic to the cheapest healthy provider
+	StrategyLatency  = "latency"  // send traffic to the lowest-latency healthy provider
+)
+
+// RoutingConfig selects how a model's provider is chosen. With the cost
+// strategy, SwitchMargin and MinDwell keep routing from flapping: a provider
+// is only replaced by one at least SwitchMargin (a fraction of its price)
+// cheaper, and not within MinDwell of being chosen, unless it becomes
+// unhealthy.
+//
+// With the latency strategy, LatencySmoothing is the weight of each new
+// response time in a provider's moving average, and ExploreFraction the share
+// of requests sent to a slower provider to keep its average current.
+type RoutingConfig struct {
+	Strategy         string
+	SwitchMargin     float64
+	MinDwell         time.Duration
+	LatencySmoothing float64
+	ExploreFraction  float64
+}
+
+// pricedRoute is a provider serving a model at a blended price per 1k tokens
+type pricedRoute struct {
+	provider string
+	cost     float64
+}
+
+// costChoice is the provider currently serving a model under the cost strategy
+type costChoice struct {
+	provider string
+	since    time.Time
+}
+
+// SetRouting sets the routing strategy
+func (r *Registry) SetRouting(config RoutingConfig) error {
+	switch config.Strategy {
+	case "", StrategyWeighted, StrategyCost, StrategyLatency:
+	default:
+		return fmt.Errorf("unsupported routing strategy: %s", config.Strategy)
+	}
+	if config.SwitchMargin < 0 || config.MinDwell < 0 {
+		return fmt.Errorf("routing switch_margin and min_dwell cannot be negative")
+	}
+	if config.LatencySmoothing < 0 || config.LatencySmoothing > 1 {
+		return fmt.Errorf("routing latency_smoothing must be between 0 and 1, got %v", config.LatencySmoothing)
+	}
+	if config.ExploreFraction < 0 || config.ExploreFraction >= 1 {
+		return fmt.Errorf("routing explore_fraction must be in [0, 1), got %v", config.ExploreFraction)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.routing = config
+	r.costChoices = make(map[string]costChoice)
+	return nil
+}
+
+// buildPricedRoutes lists, for each model, the registered providers pricing
+// it, cheapest first. A provider's price is the sum of its input and output
+// prices per 1k tokens.
+func (r *Registry) buildPricedRoutes(configs map[string]*base.ProviderConfig, names []string) map[string][]pricedRoute {
+	priced := make(map[string][]pricedRoute)
+	for _, name := range names {
+		if _, registered := r.providers[name]; !registered {
+			continue
+		}
+		for _, model := range configs[name].Models {
+			cost := model.CostPer1kInputTokens + model.CostPer1kOutputTokens
+			if cost <= 0 {
+				continue
+			}
+			priced[model.Name] = append(priced[model.Name], pricedRoute{provider: name, cost: cost})
+		}
+	}
+	for _, targets := range priced {
+		sort.SliceStable(targets, func(i, j int) bool { return targets[i].cost < targets[j].cost })
+	}
+	return priced
+}
+
+// pickCheapest chooses the cheapest available provider for a model, keeping
+// the current choice unless it is unavailable or a cheaper provider clears
+// the switch margin after the minimum dwell time
+func (r *Registry) pickCheapest(model string, targets []pricedRoute) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var cheapest, current *pricedRoute
+	choice, chosen := r.costChoices[model]
+	for i := range targets {
+		if !r.availableLocked(targets[i].provider) {
+			continue
+		}
+		if cheapest == nil {
+			cheapest = &targets[i]
+		}
+		if chosen && targets[i].provider == choice.provider {
+			current = &targets[i]
+		}
+	}
+
+	switch {
+	case cheapest == nil:
+		// Nothing is available; let the cheapest provider's breaker reject it
+		return targets[0].provider
+	case current == nil:
+	case current.provider == cheapest.provider:
+		return current.provider
+	case time.Since(choice.since) < r.routing.MinDwell,
+		cheapest.cost > current.cost*(1-r.routing.SwitchMargin):
+		return current.provider
+	}
+
+	if chosen {
+		r.logger.Infof("Routing model %s from provider %s to %s (%.4f per 1k tokens)", model, choice.provider, cheapest.provider, cheapest.cost)
+	}
+	r.costChoices[model] = costChoice{provider: cheapest.provider, since: time.Now()}
+	return cheapest.provider
+}
+
+// availableLocked reports whether a provider may take traffic: its circuit is
+// not open and its last health check did not find it unhealthy
+func (r *Registry) availableLocked(name string) bool {
+	if breaker, err := r.cbManager.Get(name); err == nil && breaker.GetState() == circuitbreaker.StateOpen {
+		return false
+	}
+	return r.health[name] != base.HealthStatusUnhealthy
+}
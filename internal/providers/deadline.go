@@ -0,0 +1,123 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/gatewayerrors"
+	"github.com/bendiamant/leash-gateway/internal/providers/base"
+)
+
+// DefaultClientTimeoutHeader is the request header clients set to the time
+// they are willing to wait for a response
+const DefaultClientTimeoutHeader = "X-Request-Timeout"
+
+// ClientDeadlineConfig propagates a client's timeout to provider calls, so a
+// request the client has given up on is not worked on until the provider's
+// own timeout. The timeout is read from Header as a duration ("1500ms") or
+// seconds ("1.5") and bounded by MaxTimeout and the provider's timeout; it
+// can only shorten a call. A deadline already on the request's context is
+// honoured whether or not client deadlines are enabled. Streaming requests are
+// bounded by the provider's stream limits instead.
+type ClientDeadlineConfig struct {
+	Enabled    bool
+	Header     string        // defaults to X-Request-Timeout
+	MaxTimeout time.Duration // longest client timeout honoured; 0 leaves only the provider's timeout
+}
+
+// SetClientDeadline configures how client timeouts bound provider calls
+func (r *Registry) SetClientDeadline(config ClientDeadlineConfig) error {
+	if config.MaxTimeout < 0 {
+		return fmt.Errorf("client deadline max_timeout cannot be negative")
+	}
+	if config.Header == "" {
+		config.Header = DefaultClientTimeoutHeader
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deadlines = config
+	return nil
+}
+
+// ParseClientTimeout parses a client timeout given as a Go duration or as a
+// number of seconds
+func ParseClientTimeout(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, parseErr := strconv.ParseFloat(value, 64)
+		if parseErr != nil {
+			return 0, fmt.Errorf("invalid client timeout %q: want a duration or seconds", value)
+		}
+		timeout = time.Duration(seconds * float64(time.Second))
+	}
+	if timeout <= 0 {
+		return 0, fmt.Errorf("invalid client timeout %q: must be positive", value)
+	}
+	return timeout, nil
+}
+
+// clientDeadline returns ctx bounded by the client timeout the request
+// carries, and that timeout; without one, ctx is returned unchanged with a
+// zero timeout. Unparseable timeouts are ignored rather than failing the
+// request.
+func (r *Registry) clientDeadline(ctx context.Context, req *base.ProviderRequest, provider base.Provider) (context.Context, context.CancelFunc, time.Duration) {
+	r.mu.RLock()
+	config := r.deadlines
+	r.mu.RUnlock()
+	if !config.Enabled {
+		return ctx, func() {}, 0
+	}
+
+	var value string
+	for key, headerValue := range req.Headers {
+		if strings.EqualFold(key, config.Header) {
+			value = headerValue
+			break
+		}
+	}
+	if value == "" {
+		return ctx, func() {}, 0
+	}
+	timeout, err := ParseClientTimeout(value)
+	if err != nil {
+		r.logger.Debugf("Request %s: ignoring %s: %v", req.RequestID, config.Header, err)
+		return ctx, func() {}, 0
+	}
+
+	if config.MaxTimeout > 0 && timeout > config.MaxTimeout {
+		timeout = config.MaxTimeout
+	}
+	if providerConfig := provider.GetConfig(); providerConfig != nil && providerConfig.Timeout > 0 && timeout > providerConfig.Timeout {
+		timeout = providerConfig.Timeout
+	}
+	deadlineCtx, cancel := context.WithTimeout(ctx, timeout)
+	return deadlineCtx, cancel, timeout
+}
+
+// cancelOnClose releases a client deadline once the body it bounds is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// clientDeadlineError reports a call cut short by the client's timeout as a
+// provider timeout after that timeout, rather than after the provider's own
+func clientDeadlineError(provider string, deadlineCtx, ctx context.Context, timeout time.Duration, err error) error {
+	if err == nil || timeout == 0 || ctx.Err() != nil || !errors.Is(deadlineCtx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	return &gatewayerrors.ProviderTimeoutError{Provider: provider, Timeout: timeout, Err: context.DeadlineExceeded}
+}
@@ -0,0 +1,57 @@
+package providers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/bendiamant/leash-gateway/internal/gatewayerrors"
+	"github.com/bendiamant/leash-gateway/internal/providers/base"
+)
+
+// UpstreamStatusKey is the response metadata key holding the provider's own
+// status code when an error envelope replaced its response
+const UpstreamStatusKey = "upstream_status"
+
+// SetErrorEnvelope makes RouteRequest answer provider failures with the
+// structured error envelope of package gatewayerrors: non-2xx upstream
+// bodies are replaced by a provider error, and failed calls return a
+// gatewayerrors.ResponseError carrying the response for the client
+func (r *Registry) SetErrorEnvelope(enabled bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.envelopes = enabled
+}
+
+// envelopeProviderError rewrites a provider failure into its error envelope
+func envelopeProviderError(provider string, resp *base.ProviderResponse, err error) (*base.ProviderResponse, error) {
+	if err != nil {
+		var responseErr *gatewayerrors.ResponseError
+		if errors.As(err, &responseErr) {
+			return resp, err
+		}
+		return resp, &gatewayerrors.ResponseError{Response: gatewayerrors.ProviderFailure(provider, err), Err: err}
+	}
+	if resp == nil || resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+
+	envelope := gatewayerrors.ProviderStatus(provider, resp.StatusCode)
+	envelope.RequestID = resp.RequestID
+	if resp.BodyStream != nil {
+		resp.BodyStream.Close()
+		resp.BodyStream = nil
+	}
+	if resp.Headers == nil {
+		resp.Headers = make(map[string]string)
+	}
+	delete(resp.Headers, "Content-Length")
+	delete(resp.Headers, "Content-Encoding")
+	resp.Headers["Content-Type"] = "application/json"
+	if resp.Metadata == nil {
+		resp.Metadata = make(map[string]string)
+	}
+	resp.Metadata[UpstreamStatusKey] = strconv.Itoa(resp.StatusCode)
+	resp.StatusCode = envelope.Status
+	resp.Body = envelope.JSON()
+	return resp, nil
+}
@@ -0,0 +1,113 @@
+package providers
+
+import (
+	"hash/fnv"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/providers/base"
+)
+
+// defaultLatencySmoothing is the weight of the newest latency sample when
+// none is configured
+const defaultLatencySmoothing = 0.2
+
+// latencyKey identifies a provider's latency estimate for a model
+type latencyKey struct {
+	model    string
+	provider string
+}
+
+// buildServingRoutes lists, for each model, the registered providers
+// configuring it, in name order
+func (r *Registry) buildServingRoutes(configs map[string]*base.ProviderConfig, names []string) map[string][]string {
+	serving := make(map[string][]string)
+	for _, name := range names {
+		if _, registered := r.providers[name]; !registered {
+			continue
+		}
+		for _, model := range configs[name].Models {
+			serving[model.Name] = append(serving[model.Name], name)
+		}
+	}
+	return serving
+}
+
+// RecordLatency folds a provider's response time for a model into its
+// exponentially weighted moving average
+func (r *Registry) RecordLatency(provider, model string, latency time.Duration) {
+	sample := float64(latency) / float64(time.Millisecond)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := latencyKey{model: model, provider: provider}
+	estimate, measured := r.latency[key]
+	if !measured {
+		r.latency[key] = sample
+		return
+	}
+	smoothing := r.routing.LatencySmoothing
+	if smoothing <= 0 {
+		smoothing = defaultLatencySmoothing
+	}
+	r.latency[key] = smoothing*sample + (1-smoothing)*estimate
+}
+
+// Latency returns a provider's latency estimate for a model, and whether it
+// has been measured
+func (r *Registry) Latency(provider, model string) (time.Duration, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	estimate, measured := r.latency[latencyKey{model: model, provider: provider}]
+	return time.Duration(estimate * float64(time.Millisecond)), measured
+}
+
+// pickFastest chooses the available provider with the lowest latency
+// estimate for a model. Providers not yet measured are tried first, and a
+// fraction of requests, chosen by a hash of the request ID so retries stay
+// put, probe another available provider to keep its estimate fresh.
+func (r *Registry) pickFastest(model string, candidates []string, requestID string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	available := make([]string, 0, len(candidates))
+	for _, name := range candidates {
+		if r.availableLocked(name) {
+			available = append(available, name)
+		}
+	}
+	if len(available) == 0 {
+		// Nothing is available; let the first provider's breaker reject it
+		return candidates[0]
+	}
+
+	fastest := ""
+	var lowest float64
+	for _, name := range available {
+		estimate, measured := r.latency[latencyKey{model: model, provider: name}]
+		if !measured {
+			return name
+		}
+		if fastest == "" || estimate < lowest {
+			fastest, lowest = name, estimate
+		}
+	}
+	if len(available) == 1 {
+		return fastest
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(requestID))
+	point := hash.Sum32()
+	if float64(point%10000)/10000 >= r.routing.ExploreFraction {
+		return fastest
+	}
+
+	others := make([]string, 0, len(available)-1)
+	for _, name := range available {
+		if name != fastest {
+			others = append(others, name)
+		}
+	}
+	return others[int(point/10000)%len(others)]
+}
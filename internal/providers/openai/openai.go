@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/bendiamant/leash-gateway/internal/circuitbreaker"
+	"github.com/bendiamant/leash-gateway/internal/gatewayerrors"
 	"github.com/bendiamant/leash-gateway/internal/providers/base"
 	"go.uber.org/zap"
 )
@@ -21,6 +22,7 @@ type OpenAIProvider struct {
 	config         *base.ProviderConfig
 	client         *http.Client
 	circuitBreaker *circuitbreaker.CircuitBreaker
+	compressor     *base.RequestCompressor
 	logger         *zap.SugaredLogger
 	lastHealth     *base.ProviderHealth
 	healthTicker   *time.Ticker
@@ -56,34 +58,69 @@ type Choice struct {
 	FinishReason string  `json:"finish_reason"`
 }
 
-// Usage represents token usage in OpenAI response
+// Usage represents token usage in OpenAI response. Responses API responses
+// report input and output tokens instead of prompt and completion tokens.
 type Usage struct {
-	PromptTokens     int `json:"prompt_tokens"`
-	CompletionTokens int `json:"completion_tokens"`
-	TotalTokens      int `json:"total_tokens"`
+	PromptTokens            int                           `json:"prompt_tokens"`
+	CompletionTokens        int                           `json:"completion_tokens"`
+	TotalTokens             int                           `json:"total_tokens"`
+	PromptTokensDetails     *base.PromptTokensDetails     `json:"prompt_tokens_details,omitempty"`
+	CompletionTokensDetails *base.CompletionTokensDetails `json:"completion_tokens_details,omitempty"`
+	InputTokens             int                           `json:"input_tokens,omitempty"`
+	OutputTokens            int                           `json:"output_tokens,omitempty"`
+	InputTokensDetails      *base.PromptTokensDetails     `json:"input_tokens_details,omitempty"`
+	OutputTokensDetails     *base.CompletionTokensDetails `json:"output_tokens_details,omitempty"`
+}
+
+// tokenUsage converts either usage format to the gateway's token usage
+func (u Usage) tokenUsage() *base.TokenUsage {
+	if u.PromptTokens == 0 && u.CompletionTokens == 0 && (u.InputTokens > 0 || u.OutputTokens > 0) {
+		return &base.TokenUsage{
+			PromptTokens:            int64(u.InputTokens),
+			CompletionTokens:        int64(u.OutputTokens),
+			TotalTokens:             int64(u.TotalTokens),
+			PromptTokensDetails:     u.InputTokensDetails,
+			CompletionTokensDetails: u.OutputTokensDetails,
+		}
+	}
+	return &base.TokenUsage{
+		PromptTokens:            int64(u.PromptTokens),
+		CompletionTokens:        int64(u.CompletionTokens),
+		TotalTokens:             int64(u.TotalTokens),
+		PromptTokensDetails:     u.PromptTokensDetails,
+		CompletionTokensDetails: u.CompletionTokensDetails,
+	}
 }
 
 // NewOpenAIProvider creates a new OpenAI provider
 func NewOpenAIProvider(config *base.ProviderConfig, cbManager *circuitbreaker.Manager, logger *zap.SugaredLogger) *OpenAIProvider {
-	client := &http.Client{
-		Timeout: config.Timeout,
+	client := base.NewHTTPClient(config)
+	if err := config.TLS.Validate(); err != nil {
+		logger.Errorf("Provider %s has invalid TLS settings, its requests will fail: %v", config.Name, err)
 	}
 
 	// Create circuit breaker
 	cb := cbManager.GetOrCreate(config.Name, circuitbreaker.Config{
-		MaxFailures:  config.CircuitBreaker.FailureThreshold,
-		MinRequests:  config.CircuitBreaker.MinRequests,
-		ResetTimeout: config.CircuitBreaker.Timeout,
-		OnStateChange: func(name string, from, to circuitbreaker.State) {
-			logger.Infof("Circuit breaker %s state changed from %s to %s", name, from, to)
+		MaxFailures:    config.CircuitBreaker.FailureThreshold,
+		MinRequests:    config.CircuitBreaker.MinRequests,
+		ResetTimeout:   config.CircuitBreaker.Timeout,
+		HalfOpenProbes: config.CircuitBreaker.HalfOpenProbes,
+		ErrorSamples:   config.CircuitBreaker.ErrorSamples,
+		OnTransition: func(transition circuitbreaker.Transition) {
+			base.LogCircuitTransition(logger, transition)
 		},
 	})
 
+	compressor := &base.RequestCompressor{OnRejected: func() {
+		logger.Warnf("Provider %s rejected a gzip-encoded request body; sending its requests uncompressed", config.Name)
+	}}
+
 	provider := &OpenAIProvider{
 		name:           config.Name,
 		config:         config,
 		client:         client,
 		circuitBreaker: cb,
+		compressor:     compressor,
 		logger:         logger,
 		stopHealth:     make(chan struct{}),
 	}
@@ -115,7 +152,10 @@ func (p *OpenAIProvider) Health(ctx context.Context) (*base.ProviderHealth, erro
 	// Use circuit breaker for health check
 	var err error
 	healthErr := p.circuitBreaker.Call(func() error {
-		req, reqErr := http.NewRequestWithContext(ctx, "GET", p.config.Endpoint+"/models", nil)
+		req, reqErr := p.config.HealthCheck.NewHealthCheckRequest(ctx, p.config.Endpoint, base.HealthCheckProbe{
+			Method: http.MethodGet,
+			Path:   "/models",
+		})
 		if reqErr != nil {
 			return reqErr
 		}
@@ -170,82 +210,64 @@ func (p *OpenAIProvider) IsHealthy() bool {
 func (p *OpenAIProvider) ProcessRequest(ctx context.Context, req *base.ProviderRequest) (*base.ProviderResponse, error) {
 	start := time.Now()
 
-	// Convert to OpenAI format
-	openaiReq := &OpenAIRequest{
-		Model:    req.Model,
-		Messages: req.Messages,
-		Stream:   false,
-	}
-
-	// Add parameters
-	if temp, ok := req.Parameters["temperature"].(float64); ok {
-		openaiReq.Temperature = &temp
-	}
-	if maxTokens, ok := req.Parameters["max_tokens"].(int); ok {
-		openaiReq.MaxTokens = &maxTokens
-	}
-	if topP, ok := req.Parameters["top_p"].(float64); ok {
-		openaiReq.TopP = &topP
-	}
-	if user, ok := req.Parameters["user"].(string); ok {
-		openaiReq.User = user
+	reqBody, dropped, err := p.encodeRequest(req, false)
+	if err != nil {
+		return nil, err
 	}
 
-	// Marshal request
-	reqBody, err := json.Marshal(openaiReq)
+	headers, err := p.config.OutboundHeaders(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+		return nil, err
 	}
+	p.config.SetIdempotencyKey(headers, req, reqBody)
 
-	var response *base.ProviderResponse
-	
-	// Use circuit breaker
-	callErr := p.circuitBreaker.Call(func() error {
-		resp, err := p.makeRequest(ctx, "POST", "/chat/completions", reqBody, req.Headers)
-		if err != nil {
-			return err
-		}
-		response = resp
-		return nil
+	// Retry retryable failures; each attempt goes through the circuit breaker,
+	// which counts retryable statuses as failures
+	response, callErr := p.config.WithRetry(ctx, func() (*base.ProviderResponse, error) {
+		var attempt *base.ProviderResponse
+		err := p.circuitBreaker.Call(func() error {
+			resp, err := p.makeRequest(ctx, "POST", p.chatPath(req.Model), reqBody, headers)
+			if err != nil {
+				return err
+			}
+			attempt = resp
+			return p.config.CheckStatus(resp)
+		})
+		return attempt, err
 	})
 
 	if callErr != nil {
+		p.logger.Debugf("Provider %s request %s failed: %v", p.name, req.RequestID, callErr)
 		return nil, callErr
 	}
+	response.RequestID = req.RequestID
+	if len(dropped) > 0 {
+		p.logger.Debugf("Provider %s request %s dropped unsupported parameters: %v", p.name, req.RequestID, dropped)
+		response.Metadata[base.DroppedParametersMetadata] = strings.Join(dropped, ",")
+	}
 
 	// Calculate cost
 	if response.Usage != nil {
-		cost := p.calculateCost(req.Model, response.Usage)
-		response.Cost = cost
+		response.Cost, response.ReconciledCost = p.calculateCost(req.Model, response.Usage)
+	}
+
+	if trace := p.config.CaptureTraceHeaders(response.Headers, response.Metadata); len(trace) > 0 {
+		p.logger.Debugf("Provider %s request %s correlates with upstream %v", p.name, req.RequestID, trace)
 	}
 
 	response.Latency = time.Since(start)
+	p.logger.Debugf("Provider %s request %s completed with status %d in %v", p.name, req.RequestID, response.StatusCode, response.Latency)
 	return response, nil
 }
 
 func (p *OpenAIProvider) ProcessStreamingRequest(ctx context.Context, req *base.ProviderRequest) (*base.StreamingResponse, error) {
-	// Convert to OpenAI format with streaming enabled
-	openaiReq := &OpenAIRequest{
-		Model:    req.Model,
-		Messages: req.Messages,
-		Stream:   true,
-	}
-
-	// Add parameters
-	if temp, ok := req.Parameters["temperature"].(float64); ok {
-		openaiReq.Temperature = &temp
-	}
-	if maxTokens, ok := req.Parameters["max_tokens"].(int); ok {
-		openaiReq.MaxTokens = &maxTokens
-	}
-
-	reqBody, err := json.Marshal(openaiReq)
+	reqBody, dropped, err := p.encodeRequest(req, true)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal streaming request: %w", err)
+		return nil, err
 	}
 
 	// Create streaming request
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.config.Endpoint+"/chat/completions", bytes.NewReader(reqBody))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.ChatCompletionsURL(req.Model), bytes.NewReader(reqBody))
 	if err != nil {
 		return nil, err
 	}
@@ -253,20 +275,25 @@ func (p *OpenAIProvider) ProcessStreamingRequest(ctx context.Context, req *base.
 	// Set headers
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("Accept", "text/event-stream")
-	for key, value := range req.Headers {
+	headers, err := p.config.OutboundHeaders(req)
+	if err != nil {
+		return nil, err
+	}
+	p.config.SetIdempotencyKey(headers, req, reqBody)
+	for key, value := range headers {
 		httpReq.Header.Set(key, value)
 	}
 
 	// Make streaming request with circuit breaker
 	var httpResp *http.Response
 	callErr := p.circuitBreaker.Call(func() error {
-		resp, err := p.client.Do(httpReq)
+		resp, err := p.compressor.Do(p.client, p.config.RequestCompression, httpReq, reqBody)
 		if err != nil {
-			return err
+			return gatewayerrors.WrapProviderError(p.name, p.config.Timeout, err)
 		}
 		if resp.StatusCode >= 400 {
 			resp.Body.Close()
-			return fmt.Errorf("HTTP %d", resp.StatusCode)
+			return &base.StatusError{StatusCode: resp.StatusCode}
 		}
 		httpResp = resp
 		return nil
@@ -278,9 +305,9 @@ func (p *OpenAIProvider) ProcessStreamingRequest(ctx context.Context, req *base.
 
 	// Create streaming response
 	streamChan := make(chan base.StreamChunk, 10)
-	go p.processStreamingResponse(httpResp, streamChan)
+	go p.processStreamingResponse(req, httpResp, streamChan)
 
-	return &base.StreamingResponse{
+	streaming := &base.StreamingResponse{
 		RequestID: req.RequestID,
 		Headers:   p.convertHeaders(httpResp.Header),
 		Stream:    streamChan,
@@ -288,13 +315,68 @@ func (p *OpenAIProvider) ProcessStreamingRequest(ctx context.Context, req *base.
 			"provider": p.name,
 			"model":    req.Model,
 		},
-	}, nil
+	}
+	if len(dropped) > 0 {
+		p.logger.Debugf("Provider %s stream %s dropped unsupported parameters: %v", p.name, req.RequestID, dropped)
+		streaming.Metadata[base.DroppedParametersMetadata] = strings.Join(dropped, ",")
+	}
+	if trace := p.config.CaptureTraceHeaders(streaming.Headers, streaming.Metadata); len(trace) > 0 {
+		p.logger.Debugf("Provider %s stream %s correlates with upstream %v", p.name, req.RequestID, trace)
+	}
+	return streaming, nil
+}
+
+// encodeRequest maps the request's parameters per the provider's configured
+// mapping and encodes the OpenAI request body, returning the names of
+// dropped unsupported parameters
+func (p *OpenAIProvider) encodeRequest(req *base.ProviderRequest, stream bool) ([]byte, []string, error) {
+	params, dropped, err := p.config.Parameters.Apply(req.Parameters)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Convert to OpenAI format
+	openaiReq := &OpenAIRequest{
+		Model:    req.Model,
+		Messages: req.Messages,
+		Stream:   stream,
+	}
+
+	// Add parameters
+	if temp, ok := params["temperature"].(float64); ok {
+		openaiReq.Temperature = &temp
+	}
+	if maxTokens, ok := params["max_tokens"].(int); ok {
+		openaiReq.MaxTokens = &maxTokens
+	}
+	if topP, ok := params["top_p"].(float64); ok {
+		openaiReq.TopP = &topP
+	}
+	if user, ok := params["user"].(string); ok {
+		openaiReq.User = user
+	}
+
+	reqBody, err := base.EncodeRequestBody(openaiReq, params)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	return reqBody, dropped, nil
 }
 
 // Configuration methods
 func (p *OpenAIProvider) UpdateConfig(config *base.ProviderConfig) error {
+	if _, err := base.ParseHeaderTemplates(config.Headers); err != nil {
+		return err
+	}
+	if err := config.Parameters.Validate(); err != nil {
+		return err
+	}
+	if err := config.TLS.Validate(); err != nil {
+		return err
+	}
 	p.config = config
-	p.client.Timeout = config.Timeout
+	p.client.CloseIdleConnections()
+	p.client = base.NewHTTPClient(config)
 	
 	// Update circuit breaker if needed
 	// This would typically involve recreating the circuit breaker
@@ -306,7 +388,17 @@ func (p *OpenAIProvider) GetConfig() *base.ProviderConfig {
 	return p.config
 }
 
+// ChatCompletionsURL returns the chat completions URL for a model, honoring
+// per-model path templates for OpenAI-compatible self-hosted deployments
+func (p *OpenAIProvider) ChatCompletionsURL(model string) string {
+	return p.config.Endpoint + p.chatPath(model)
+}
+
 // Helper methods
+func (p *OpenAIProvider) chatPath(model string) string {
+	return p.config.ModelPath(model, "/chat/completions")
+}
+
 func (p *OpenAIProvider) makeRequest(ctx context.Context, method, path string, body []byte, headers map[string]string) (*base.ProviderResponse, error) {
 	url := p.config.Endpoint + path
 	
@@ -320,19 +412,28 @@ func (p *OpenAIProvider) makeRequest(ctx context.Context, method, path string, b
 	for key, value := range headers {
 		req.Header.Set(key, value)
 	}
-	for key, value := range p.config.Headers {
-		req.Header.Set(key, value)
-	}
 
-	resp, err := p.client.Do(req)
+	resp, err := p.compressor.Do(p.client, p.config.RequestCompression, req, body)
 	if err != nil {
-		return nil, err
+		return nil, gatewayerrors.WrapProviderError(p.name, p.config.Timeout, err)
 	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
+	respBody, stream, err := p.config.ReadResponseBody(resp.StatusCode, resp.Body)
 	if err != nil {
-		return nil, err
+		return nil, gatewayerrors.WrapProviderError(p.name, p.config.Timeout, err)
+	}
+	if stream != nil {
+		// Too large to buffer: passed through without usage, which is only
+		// known from the parsed body
+		p.logger.Warnf("Provider %s response exceeds %d bytes; passing it through unbuffered", p.name, p.config.MaxResponseBytes)
+		return &base.ProviderResponse{
+			StatusCode: resp.StatusCode,
+			Headers:    p.convertHeaders(resp.Header),
+			BodyStream: stream,
+			Metadata: map[string]string{
+				"provider":                p.name,
+				base.StreamedBodyMetadata: "true",
+			},
+		}, nil
 	}
 
 	// Parse OpenAI response for usage information
@@ -340,11 +441,7 @@ func (p *OpenAIProvider) makeRequest(ctx context.Context, method, path string, b
 	if resp.StatusCode == 200 {
 		var openaiResp OpenAIResponse
 		if json.Unmarshal(respBody, &openaiResp) == nil {
-			usage = &base.TokenUsage{
-				PromptTokens:     int64(openaiResp.Usage.PromptTokens),
-				CompletionTokens: int64(openaiResp.Usage.CompletionTokens),
-				TotalTokens:      int64(openaiResp.Usage.TotalTokens),
-			}
+			usage = openaiResp.Usage.tokenUsage()
 		}
 	}
 
@@ -359,33 +456,56 @@ func (p *OpenAIProvider) makeRequest(ctx context.Context, method, path string, b
 	}, nil
 }
 
-func (p *OpenAIProvider) processStreamingResponse(resp *http.Response, streamChan chan base.StreamChunk) {
+func (p *OpenAIProvider) processStreamingResponse(req *base.ProviderRequest, resp *http.Response, streamChan chan base.StreamChunk) {
 	defer resp.Body.Close()
 	defer close(streamChan)
 
-	scanner := io.Reader(resp.Body)
+	usage := base.NewStreamUsage(req)
 	buffer := make([]byte, 4096)
+	deadline := base.NewStreamDeadline(resp.Body, p.config.StreamIdleTimeout, p.config.StreamMaxDuration)
+	defer deadline.Stop()
 
 	for {
-		n, err := scanner.Read(buffer)
-		if err != nil {
-			if err != io.EOF {
-				streamChan <- base.StreamChunk{
-					Error: err,
-					Done:  true,
-				}
-			} else {
-				streamChan <- base.StreamChunk{
-					Done: true,
-				}
+		deadline.Waiting()
+		n, err := resp.Body.Read(buffer)
+		deadline.Received()
+		if expired := deadline.Err(); expired != nil && err != nil {
+			// The read failed because the deadline closed the body
+			err = expired
+		}
+		if n > 0 {
+			data := append([]byte(nil), buffer[:n]...)
+			usage.Observe(data)
+			streamChan <- base.StreamChunk{
+				Data: data,
+				Done: false,
 			}
-			break
+		}
+		if err == nil {
+			continue
 		}
 
-		streamChan <- base.StreamChunk{
-			Data: buffer[:n],
-			Done: false,
+		if err == io.EOF && !usage.Done() {
+			err = base.ErrStreamInterrupted
+		}
+		final, partial := usage.Usage()
+		chunk := base.StreamChunk{
+			Done:  true,
+			Usage: final,
+		}
+		chunk.Cost, chunk.ReconciledCost = p.calculateCost(req.Model, final)
+		if err != io.EOF {
+			// Input was consumed and output partly delivered, so report what
+			// was used and end the stream with an explicit error event
+			p.logger.Warnf("Stream for request %s failed after %d output tokens: %v", req.RequestID, final.CompletionTokens, err)
+			chunk.Error = err
+			chunk.Data = base.StreamErrorEvent(err)
 		}
+		if partial {
+			chunk.Metadata = map[string]string{base.PartialUsageMetadata: "true"}
+		}
+		streamChan <- chunk
+		return
 	}
 }
 
@@ -399,21 +519,8 @@ func (p *OpenAIProvider) convertHeaders(headers http.Header) map[string]string {
 	return result
 }
 
-func (p *OpenAIProvider) calculateCost(model string, usage *base.TokenUsage) float64 {
-	if usage == nil {
-		return 0
-	}
-
-	// Find model config
-	for _, modelConfig := range p.config.Models {
-		if modelConfig.Name == model {
-			inputCost := float64(usage.PromptTokens) / 1000.0 * modelConfig.CostPer1kInputTokens
-			outputCost := float64(usage.CompletionTokens) / 1000.0 * modelConfig.CostPer1kOutputTokens
-			return inputCost + outputCost
-		}
-	}
-
-	return 0 // Unknown model
+func (p *OpenAIProvider) calculateCost(model string, usage *base.TokenUsage) (float64, float64) {
+	return p.config.Cost(model, usage)
 }
 
 func (p *OpenAIProvider) startHealthMonitoring() {
@@ -8,29 +8,86 @@ import (
 	"time"
 
 	"github.com/bendiamant/leash-gateway/internal/circuitbreaker"
+	"github.com/bendiamant/leash-gateway/internal/featureflags"
+	"github.com/bendiamant/leash-gateway/internal/metrics"
 	"github.com/bendiamant/leash-gateway/internal/providers/anthropic"
 	"github.com/bendiamant/leash-gateway/internal/providers/base"
+	"github.com/bendiamant/leash-gateway/internal/providers/cache"
 	"github.com/bendiamant/leash-gateway/internal/providers/openai"
+	"github.com/bendiamant/leash-gateway/internal/providers/shadow"
+	"github.com/bendiamant/leash-gateway/internal/providers/stream"
 	"go.uber.org/zap"
 )
 
 // Registry implements the ProviderRegistry interface
 type Registry struct {
-	providers     map[string]base.Provider
-	cbManager     *circuitbreaker.Manager
-	logger        *zap.SugaredLogger
-	mu            sync.RWMutex
-	healthTicker  *time.Ticker
-	stopHealth    chan struct{}
+	providers    map[string]base.Provider
+	routes       map[string][]route       // model -> weighted providers
+	priced       map[string][]pricedRoute // model -> priced providers, cheapest first
+	serving      map[string][]string      // model -> providers configuring it
+	routing      RoutingConfig
+	costChoices  map[string]costChoice
+	latency      map[latencyKey]float64       // moving average response time in ms
+	health       map[string]base.HealthStatus // last health check results
+	cbManager    *circuitbreaker.Manager
+	cache        *cache.Cache
+	metrics      *metrics.Registry // nil records no provider errors
+	flags        *featureflags.Set // nil allows streaming for every tenant
+	logger       *zap.SugaredLogger
+	mu           sync.RWMutex
+	healthTicker *time.Ticker
+	stopHealth   chan struct{}
+	envelopes    bool
+	deadlines    ClientDeadlineConfig
 }
 
 // NewRegistry creates a new provider registry
 func NewRegistry(logger *zap.SugaredLogger) *Registry {
 	return &Registry{
-		providers:  make(map[string]base.Provider),
-		cbManager:  circuitbreaker.NewManager(),
-		logger:     logger,
-		stopHealth: make(chan struct{}),
+		providers:   make(map[string]base.Provider),
+		costChoices: make(map[string]costChoice),
+		latency:     make(map[latencyKey]float64),
+		health:      make(map[string]base.HealthStatus),
+		cbManager:   circuitbreaker.NewManager(),
+		logger:      logger,
+		stopHealth:  make(chan struct{}),
+	}
+}
+
+// SetResponseCache makes providers initialized from config serve and store
+// responses through the cache
+func (r *Registry) SetResponseCache(responseCache *cache.Cache) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cache = responseCache
+}
+
+// SetFeatureFlags limits streaming to tenants whose flags enable it
+func (r *Registry) SetFeatureFlags(flags *featureflags.Set) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.flags = flags
+}
+
+// SetMetrics records provider call errors by cause and circuit breaker state
+// changes. Breakers of providers initialized before it is called are not
+// recorded.
+func (r *Registry) SetMetrics(registry *metrics.Registry) {
+	r.mu.Lock()
+	r.metrics = registry
+	r.mu.Unlock()
+	r.cbManager.SetOnTransition(func(transition circuitbreaker.Transition) {
+		registry.RecordCircuitBreakerTransition(transition.Name, transition.From.String(), transition.To.String(), int(transition.To))
+	})
+}
+
+// recordError records a failed provider call, classified by its cause
+func (r *Registry) recordError(provider, model string, err error) {
+	r.mu.RLock()
+	registry := r.metrics
+	r.mu.RUnlock()
+	if registry != nil && err != nil {
+		registry.RecordProviderError(provider, model, err)
 	}
 }
 
@@ -149,6 +206,12 @@ func (r *Registry) HealthCheck(ctx context.Context) map[string]*base.ProviderHea
 		}
 	}
 
+	r.mu.Lock()
+	for name, health := range results {
+		r.health[name] = health.Status
+	}
+	r.mu.Unlock()
+
 	return results
 }
 
@@ -186,25 +249,103 @@ func (r *Registry) GetProviderForModel(model string) (base.Provider, error) {
 func (r *Registry) InitializeFromConfig(configs map[string]*base.ProviderConfig) error {
 	for name, config := range configs {
 		config.Name = name
+		if _, err := base.ParseHeaderTemplates(config.Headers); err != nil {
+			return fmt.Errorf("provider %s: %w", name, err)
+		}
+		if err := config.Parameters.Validate(); err != nil {
+			return fmt.Errorf("provider %s: %w", name, err)
+		}
+		if err := config.TLS.Validate(); err != nil {
+			return fmt.Errorf("provider %s: %w", name, err)
+		}
 		
 		var provider base.Provider
-		var err error
 
-		switch name {
+		providerType := config.Type
+		if providerType == "" {
+			providerType = name
+		}
+		switch providerType {
 		case "openai":
 			provider = openai.NewOpenAIProvider(config, r.cbManager, r.logger)
 		case "anthropic":
 			provider = anthropic.NewAnthropicProvider(config, r.cbManager, r.logger)
 		default:
-			r.logger.Warnf("Unknown provider type: %s", name)
+			r.logger.Warnf("Unknown provider type: %s", providerType)
 			continue
 		}
 
+		switch config.StreamFormat {
+		case "", stream.FormatPassthrough:
+		case stream.FormatCanonical:
+			normalized, err := stream.Wrap(provider, providerType)
+			if err != nil {
+				return fmt.Errorf("provider %s: %w", name, err)
+			}
+			provider = normalized
+		default:
+			return fmt.Errorf("provider %s: unsupported stream format: %s", name, config.StreamFormat)
+		}
+		if config.StreamHeartbeat < 0 {
+			return fmt.Errorf("provider %s: stream_heartbeat cannot be negative", name)
+		}
+		if config.StreamIdleTimeout < 0 || config.StreamMaxDuration < 0 {
+			return fmt.Errorf("provider %s: stream_idle_timeout and stream_max_duration cannot be negative", name)
+		}
+		if config.StreamHeartbeat > 0 {
+			// Outside the normalizer, which would drop the comments
+			provider = stream.WrapHeartbeat(provider, config.StreamHeartbeat)
+		}
+
+		r.mu.RLock()
+		responseCache := r.cache
+		r.mu.RUnlock()
+		if responseCache != nil {
+			provider = cache.Wrap(provider, responseCache)
+		}
+
 		if err := r.Register(provider); err != nil {
 			return fmt.Errorf("failed to register provider %s: %w", name, err)
 		}
 	}
 
+	// Shadows are wired once every provider they may refer to is registered
+	for name, config := range configs {
+		if config.Shadow.Provider == "" {
+			continue
+		}
+		if err := r.setShadow(name, config.Shadow); err != nil {
+			return fmt.Errorf("provider %s: %w", name, err)
+		}
+	}
+
+	return r.buildRoutes(configs)
+}
+
+// setShadow wraps a registered provider to mirror requests to its shadow
+func (r *Registry) setShadow(name string, config base.ShadowConfig) error {
+	if config.Fraction < 0 || config.Fraction > 1 {
+		return fmt.Errorf("shadow fraction must be between 0 and 1, got %v", config.Fraction)
+	}
+	if config.Provider == name {
+		return fmt.Errorf("provider cannot shadow itself")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	primary, exists := r.providers[name]
+	if !exists {
+		// Unknown provider types are skipped above
+		return nil
+	}
+	shadowProvider, exists := r.providers[config.Provider]
+	if !exists {
+		return fmt.Errorf("shadow provider %s not found", config.Provider)
+	}
+
+	r.providers[name] = shadow.Wrap(primary, shadowProvider, config, r.logger)
+	r.logger.Infof("Mirroring %.1f%% of provider %s requests to shadow provider %s", config.Fraction*100, name, config.Provider)
 	return nil
 }
 
@@ -244,6 +385,13 @@ func (r *Registry) Shutdown() error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	// Let mirrored requests finish before any shadow provider stops
+	for _, provider := range r.providers {
+		if mirroring, ok := provider.(interface{ Wait() }); ok {
+			mirroring.Wait()
+		}
+	}
+
 	for name, provider := range r.providers {
 		if shutdowner, ok := provider.(interface{ Shutdown() error }); ok {
 			if err := shutdowner.Shutdown(); err != nil {
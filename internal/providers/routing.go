@@ -0,0 +1,251 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/circuitbreaker"
+	"github.com/bendiamant/leash-gateway/internal/providers/base"
+)
+
+// RoutedProviderKey is the request and response metadata key naming the
+// provider a request was routed to, for comparing providers downstream
+const RoutedProviderKey = "routed_provider"
+
+// ErrStreamingDisabled is returned for streaming requests from tenants whose
+// feature flags disable streaming
+var ErrStreamingDisabled = errors.New("streaming is disabled")
+
+// ProviderOverrideKey is the request metadata key naming a provider forced
+// by a trusted caller, replacing model-based routing
+const ProviderOverrideKey = "provider_override"
+
+// route is a provider serving a weighted share of a model's traffic
+type route struct {
+	provider string
+	weight   float64
+}
+
+// buildRoutes splits each model's traffic across the registered providers
+// that configure a routing weight for it
+func (r *Registry) buildRoutes(configs map[string]*base.ProviderConfig) error {
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	routes := make(map[string][]route)
+	for _, name := range names {
+		for _, model := range configs[name].Models {
+			if model.RoutingWeight < 0 {
+				return fmt.Errorf("provider %s: model %s routing weight cannot be negative", name, model.Name)
+			}
+			if model.RoutingWeight == 0 {
+				continue
+			}
+			if _, registered := r.providers[name]; !registered {
+				// Unknown provider types are skipped at registration
+				continue
+			}
+			routes[model.Name] = append(routes[model.Name], route{provider: name, weight: model.RoutingWeight})
+		}
+	}
+
+	for model, targets := range routes {
+		for _, target := range targets {
+			r.logger.Infof("Routing model %s to provider %s with weight %v", model, target.provider, target.weight)
+		}
+	}
+	r.routes = routes
+	r.priced = r.buildPricedRoutes(configs, names)
+	r.serving = r.buildServingRoutes(configs, names)
+	return nil
+}
+
+// SelectProvider picks the provider for a request and tags the request's
+// metadata with its name. Models with routing weights split traffic across
+// their providers by a hash of the request ID, so a request and its retries
+// stay on one provider while the split converges on the weights. Providers
+// whose circuit is open are skipped while another is available. With the cost
+// strategy, models priced by any provider go to the cheapest available one
+// instead, and with the latency strategy, models configured by several
+// providers go to the fastest available one. Other models are served by
+// GetProviderForModel. A provider override in the request's metadata takes
+// precedence over all of these, provided that provider serves the model.
+func (r *Registry) SelectProvider(req *base.ProviderRequest) (base.Provider, error) {
+	if override := req.Metadata[ProviderOverrideKey]; override != "" {
+		provider, err := r.overrideProvider(override, req.Model)
+		if err != nil {
+			return nil, err
+		}
+		r.logger.Debugf("Request %s routed to overridden provider %s", req.RequestID, provider.Name())
+		req.Metadata[RoutedProviderKey] = provider.Name()
+		return provider, nil
+	}
+
+	r.mu.RLock()
+	targets := r.routes[req.Model]
+	priced := r.priced[req.Model]
+	serving := r.serving[req.Model]
+	strategy := r.routing.Strategy
+	r.mu.RUnlock()
+
+	var provider base.Provider
+	if strategy == StrategyCost && len(priced) > 0 {
+		selected, err := r.Get(r.pickCheapest(req.Model, priced))
+		if err != nil {
+			return nil, err
+		}
+		provider = selected
+	} else if strategy == StrategyLatency && len(serving) > 1 {
+		selected, err := r.Get(r.pickFastest(req.Model, serving, req.RequestID))
+		if err != nil {
+			return nil, err
+		}
+		provider = selected
+	} else if len(targets) > 0 {
+		name := r.pickRoute(targets, req.RequestID)
+		selected, err := r.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		provider = selected
+	} else {
+		selected, err := r.GetProviderForModel(req.Model)
+		if err != nil {
+			return nil, err
+		}
+		provider = selected
+	}
+
+	if req.Metadata == nil {
+		req.Metadata = make(map[string]string)
+	}
+	req.Metadata[RoutedProviderKey] = provider.Name()
+	return provider, nil
+}
+
+// RouteRequest sends a request to the provider SelectProvider picks and tags
+// the response with it. Response times of successful upstream calls feed
+// latency routing. With client deadlines enabled, the call is cancelled once
+// the client's timeout passes. With error envelopes set, provider failures
+// come back in the envelope.
+func (r *Registry) RouteRequest(ctx context.Context, req *base.ProviderRequest) (*base.ProviderResponse, error) {
+	provider, err := r.SelectProvider(req)
+	if err != nil {
+		return nil, err
+	}
+
+	deadlineCtx, cancel, timeout := r.clientDeadline(ctx, req, provider)
+	start := time.Now()
+	resp, err := provider.ProcessRequest(deadlineCtx, req)
+	err = clientDeadlineError(provider.Name(), deadlineCtx, ctx, timeout, err)
+	r.recordError(provider.Name(), req.Model, err)
+	if resp != nil && resp.BodyStream != nil {
+		// The client's deadline keeps bounding a body passed through unread
+		resp.BodyStream = &cancelOnClose{ReadCloser: resp.BodyStream, cancel: cancel}
+	} else {
+		cancel()
+	}
+	if err == nil && resp != nil && resp.Metadata["cache"] == "" {
+		// Cache hits say nothing about the provider's latency
+		r.RecordLatency(provider.Name(), req.Model, time.Since(start))
+	}
+	if resp != nil {
+		if resp.Metadata == nil {
+			resp.Metadata = make(map[string]string)
+		}
+		resp.Metadata[RoutedProviderKey] = provider.Name()
+	}
+	r.mu.RLock()
+	envelopes := r.envelopes
+	r.mu.RUnlock()
+	if envelopes {
+		return envelopeProviderError(provider.Name(), resp, err)
+	}
+	return resp, err
+}
+
+// RouteStreamingRequest streams a request from the provider SelectProvider
+// picks and tags the response with it. Tenants whose feature flags disable
+// streaming are refused.
+func (r *Registry) RouteStreamingRequest(ctx context.Context, req *base.ProviderRequest) (*base.StreamingResponse, error) {
+	r.mu.RLock()
+	flags := r.flags
+	r.mu.RUnlock()
+	if flags != nil && !flags.For(req.TenantID).Streaming {
+		return nil, fmt.Errorf("%w for tenant %s", ErrStreamingDisabled, req.TenantID)
+	}
+
+	provider, err := r.SelectProvider(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := provider.ProcessStreamingRequest(ctx, req)
+	r.recordError(provider.Name(), req.Model, err)
+	if resp != nil {
+		if resp.Metadata == nil {
+			resp.Metadata = make(map[string]string)
+		}
+		resp.Metadata[RoutedProviderKey] = provider.Name()
+	}
+	return resp, err
+}
+
+// overrideProvider returns the named provider if it serves model, either by
+// configuring it or by being the provider the model maps to by default
+func (r *Registry) overrideProvider(name, model string) (base.Provider, error) {
+	provider, err := r.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("provider override: %w", err)
+	}
+	for _, supported := range provider.SupportedModels() {
+		if supported == model {
+			return provider, nil
+		}
+	}
+	if fallback, err := r.GetProviderForModel(model); err == nil && fallback.Name() == name {
+		return provider, nil
+	}
+	return nil, fmt.Errorf("provider override: provider %s does not serve model %s", name, model)
+}
+
+// pickRoute chooses a provider by weight from a hash of the request ID
+func (r *Registry) pickRoute(targets []route, requestID string) string {
+	available := make([]route, 0, len(targets))
+	for _, target := range targets {
+		if breaker, err := r.cbManager.Get(target.provider); err == nil && breaker.GetState() == circuitbreaker.StateOpen {
+			continue
+		}
+		available = append(available, target)
+	}
+	if len(available) == 0 {
+		// Every circuit is open; let the chosen provider's breaker reject it
+		available = targets
+	}
+
+	var total float64
+	for _, target := range available {
+		total += target.weight
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(requestID))
+	point := float64(hash.Sum32()%10000) / 10000 * total
+	for _, target := range available {
+		if point < target.weight {
+			return target.provider
+		}
+		point -= target.weight
+	}
+	return available[len(available)-1].provider
+}
@@ -0,0 +1,183 @@
+package shadow
+
+import (
+	"bytes"
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/providers/base"
+	"go.uber.org/zap"
+)
+
+// DefaultTimeout bounds each shadow request when none is configured
+const DefaultTimeout = 30 * time.Second
+
+// maxResults is the number of recent comparisons kept in memory
+const maxResults = 1000
+
+// Result compares a primary response with its shadow counterpart
+type Result struct {
+	RequestID      string        `json:"request_id"`
+	Primary        string        `json:"primary"`
+	Shadow         string        `json:"shadow"`
+	Model          string        `json:"model"`
+	PrimaryStatus  int           `json:"primary_status"`
+	ShadowStatus   int           `json:"shadow_status"`
+	PrimaryLatency time.Duration `json:"primary_latency"`
+	ShadowLatency  time.Duration `json:"shadow_latency"`
+	PrimaryCost    float64       `json:"primary_cost"`
+	ShadowCost     float64       `json:"shadow_cost"`
+	BodiesMatch    bool          `json:"bodies_match"`
+	Error          string        `json:"error,omitempty"` // shadow request failure
+	Timestamp      time.Time     `json:"timestamp"`
+}
+
+// Provider wraps a provider, mirroring a deterministic fraction of its
+// requests to a shadow provider in the background. Clients only ever see the
+// primary's response; shadow outcomes are recorded for comparison.
+type Provider struct {
+	base.Provider
+	shadow   base.Provider
+	config   base.ShadowConfig
+	logger   *zap.SugaredLogger
+	inflight sync.WaitGroup
+	mu       sync.Mutex
+	results  []Result
+}
+
+// Wrap returns provider mirroring requests to shadow per config
+func Wrap(provider, shadow base.Provider, config base.ShadowConfig, logger *zap.SugaredLogger) *Provider {
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultTimeout
+	}
+	return &Provider{Provider: provider, shadow: shadow, config: config, logger: logger}
+}
+
+// Unwrap returns the underlying provider
+func (p *Provider) Unwrap() base.Provider { return p.Provider }
+
+// ProcessRequest serves the request from the primary provider and mirrors
+// sampled requests to the shadow
+func (p *Provider) ProcessRequest(ctx context.Context, req *base.ProviderRequest) (*base.ProviderResponse, error) {
+	start := time.Now()
+	resp, err := p.Provider.ProcessRequest(ctx, req)
+	if err != nil || !p.sampled(req.RequestID) {
+		return resp, err
+	}
+
+	p.inflight.Add(1)
+	go p.mirror(shadowRequest(req, p.config.Model), resp, time.Since(start))
+	return resp, nil
+}
+
+// sampled selects requests by a hash of their ID, so a request is mirrored
+// consistently and the mirrored share converges on the configured fraction
+func (p *Provider) sampled(requestID string) bool {
+	if p.config.Fraction <= 0 {
+		return false
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(requestID))
+	return float64(hash.Sum32()%10000) < p.config.Fraction*10000
+}
+
+// mirror sends a request to the shadow and records the comparison
+func (p *Provider) mirror(req *base.ProviderRequest, primary *base.ProviderResponse, primaryLatency time.Duration) {
+	defer p.inflight.Done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.config.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	resp, err := p.shadow.ProcessRequest(ctx, req)
+
+	result := Result{
+		RequestID:      req.RequestID,
+		Primary:        p.Name(),
+		Shadow:         p.shadow.Name(),
+		Model:          req.Model,
+		PrimaryStatus:  primary.StatusCode,
+		PrimaryLatency: primaryLatency,
+		PrimaryCost:    primary.Cost,
+		ShadowLatency:  time.Since(start),
+		Timestamp:      time.Now(),
+	}
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		if resp.BodyStream != nil {
+			resp.BodyStream.Close()
+		}
+		result.ShadowStatus = resp.StatusCode
+		result.ShadowCost = resp.Cost
+		result.BodiesMatch = bytes.Equal(primary.Body, resp.Body)
+	}
+
+	p.logger.Infow("Shadow request completed",
+		"request_id", result.RequestID,
+		"primary", result.Primary,
+		"shadow", result.Shadow,
+		"primary_status", result.PrimaryStatus,
+		"shadow_status", result.ShadowStatus,
+		"primary_latency_ms", result.PrimaryLatency.Milliseconds(),
+		"shadow_latency_ms", result.ShadowLatency.Milliseconds(),
+		"primary_cost", result.PrimaryCost,
+		"shadow_cost", result.ShadowCost,
+		"error", result.Error,
+	)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.results) == maxResults {
+		p.results = p.results[1:]
+	}
+	p.results = append(p.results, result)
+}
+
+// Results returns the recorded comparisons, oldest first
+func (p *Provider) Results() []Result {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Result(nil), p.results...)
+}
+
+// Wait blocks until in-flight shadow requests finish
+func (p *Provider) Wait() {
+	p.inflight.Wait()
+}
+
+// Shutdown waits for shadow requests, then stops the underlying provider.
+// The shadow provider is registered on its own and shut down separately.
+func (p *Provider) Shutdown() error {
+	p.Wait()
+	if shutdowner, ok := p.Provider.(interface{ Shutdown() error }); ok {
+		return shutdowner.Shutdown()
+	}
+	return nil
+}
+
+// shadowRequest copies a request for the shadow so the two calls share no
+// mutable state
+func shadowRequest(req *base.ProviderRequest, model string) *base.ProviderRequest {
+	mirrored := *req
+	if model != "" {
+		mirrored.Model = model
+	}
+	mirrored.Messages = append([]base.Message(nil), req.Messages...)
+	mirrored.Parameters = make(map[string]interface{}, len(req.Parameters))
+	for key, value := range req.Parameters {
+		mirrored.Parameters[key] = value
+	}
+	mirrored.Headers = make(map[string]string, len(req.Headers))
+	for key, value := range req.Headers {
+		mirrored.Headers[key] = value
+	}
+	mirrored.Metadata = make(map[string]string, len(req.Metadata)+1)
+	for key, value := range req.Metadata {
+		mirrored.Metadata[key] = value
+	}
+	mirrored.Metadata["shadow"] = "true"
+	return &mirrored
+}
@@ -0,0 +1,109 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/providers/base"
+)
+
+// HeartbeatComment is the SSE comment sent to keep an idle client stream
+// open. Clients ignore comment lines, so it never reaches an event handler.
+var HeartbeatComment = []byte(": keepalive\n\n")
+
+// HeartbeatProvider wraps a provider so its streams carry a heartbeat
+// comment whenever the upstream has been silent for the interval, keeping
+// proxies between the gateway and the client from dropping the connection
+// during long generations. Non-streaming requests are unaffected.
+type HeartbeatProvider struct {
+	base.Provider
+	interval time.Duration
+}
+
+// WrapHeartbeat returns provider with heartbeats on its streams
+func WrapHeartbeat(provider base.Provider, interval time.Duration) *HeartbeatProvider {
+	return &HeartbeatProvider{Provider: provider, interval: interval}
+}
+
+// Unwrap returns the underlying provider
+func (p *HeartbeatProvider) Unwrap() base.Provider { return p.Provider }
+
+// ProcessStreamingRequest streams the upstream response with heartbeats
+func (p *HeartbeatProvider) ProcessStreamingRequest(ctx context.Context, req *base.ProviderRequest) (*base.StreamingResponse, error) {
+	resp, err := p.Provider.ProcessStreamingRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	withHeartbeat := *resp
+	withHeartbeat.Stream = Heartbeat(resp.Stream, p.interval)
+	return &withHeartbeat, nil
+}
+
+// Heartbeat forwards a stream's chunks, adding a HeartbeatComment chunk after
+// each interval without one. Heartbeats only go between events, never
+// inside an event a chunk left incomplete.
+func Heartbeat(in <-chan base.StreamChunk, interval time.Duration) <-chan base.StreamChunk {
+	out := make(chan base.StreamChunk, cap(in))
+	go func() {
+		defer close(out)
+		timer := time.NewTimer(interval)
+		defer timer.Stop()
+
+		boundary := eventBoundary{}
+		for {
+			select {
+			case chunk, ok := <-in:
+				if !ok {
+					return
+				}
+				boundary.observe(chunk.Data)
+				out <- chunk
+				if chunk.Done {
+					return
+				}
+			case <-timer.C:
+				if boundary.between() {
+					out <- base.StreamChunk{Data: HeartbeatComment}
+				}
+			}
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(interval)
+		}
+	}()
+	return out
+}
+
+// eventBoundary tracks whether the bytes sent so far end between events:
+// nothing sent yet, or a blank line ending the last event
+type eventBoundary struct {
+	tail []byte // last bytes sent
+}
+
+func (b *eventBoundary) observe(data []byte) {
+	b.tail = append(b.tail, data...)
+	if len(b.tail) > 4 {
+		b.tail = append(b.tail[:0], b.tail[len(b.tail)-4:]...)
+	}
+}
+
+func (b *eventBoundary) between() bool {
+	return len(b.tail) == 0 ||
+		bytes.HasSuffix(b.tail, []byte("\n\n")) ||
+		bytes.HasSuffix(b.tail, []byte("\r\n\r\n")) ||
+		bytes.HasSuffix(b.tail, []byte("\r\r"))
+}
+
+// Shutdown stops the underlying provider
+func (p *HeartbeatProvider) Shutdown() error {
+	if shutdowner, ok := p.Provider.(interface{ Shutdown() error }); ok {
+		return shutdowner.Shutdown()
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bendiamant/leash-gateway/internal/providers/base"
+)
+
+// Stream formats served to clients
+const (
+	FormatPassthrough = "passthrough" // the provider's own events, unchanged
+	FormatCanonical   = "canonical"   // provider-agnostic Event payloads
+)
+
+// Provider stream formats that can be normalized
+const (
+	SourceOpenAI    = "openai"
+	SourceAnthropic = "anthropic"
+)
+
+// doneEvent ends every completed canonical stream
+var doneEvent = []byte("data: [DONE]\n\n")
+
+// Event is the canonical streaming event. Each server-sent event carries one
+// of a text delta, the finish reason, the usage or an error, in that order
+// over a stream, followed by "data: [DONE]" when the stream completes.
+type Event struct {
+	Delta        string           `json:"delta,omitempty"`
+	FinishReason string           `json:"finish_reason,omitempty"` // stop, length, tool_calls, content_filter
+	Usage        *base.TokenUsage `json:"usage,omitempty"`
+	Error        *EventError      `json:"error,omitempty"`
+}
+
+// EventError describes a stream that failed
+type EventError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+}
+
+// anthropicFinishReasons maps Anthropic stop reasons to canonical ones
+var anthropicFinishReasons = map[string]string{
+	"end_turn":      "stop",
+	"stop_sequence": "stop",
+	"max_tokens":    "length",
+	"tool_use":      "tool_calls",
+}
+
+// Normalizer converts a provider's server-sent events into canonical ones.
+// Input may split events at any point; incomplete lines are held until the
+// rest arrives.
+type Normalizer struct {
+	source  string
+	pending []byte
+	usage   base.TokenUsage // accumulated from Anthropic's start and delta events
+}
+
+// NewNormalizer creates a normalizer for a provider stream format
+func NewNormalizer(source string) (*Normalizer, error) {
+	switch source {
+	case SourceOpenAI, SourceAnthropic:
+		return &Normalizer{source: source}, nil
+	default:
+		return nil, fmt.Errorf("unsupported stream source format: %s", source)
+	}
+}
+
+// Normalize returns the canonical events for the complete lines in data
+func (n *Normalizer) Normalize(data []byte) []byte {
+	n.pending = append(n.pending, data...)
+
+	var out []byte
+	for {
+		end := bytes.IndexByte(n.pending, '\n')
+		if end < 0 {
+			return out
+		}
+		out = append(out, n.normalizeLine(bytes.TrimSpace(n.pending[:end]))...)
+		n.pending = n.pending[end+1:]
+	}
+}
+
+// Flush normalizes a final line left without a trailing newline
+func (n *Normalizer) Flush() []byte {
+	line := bytes.TrimSpace(n.pending)
+	n.pending = nil
+	return n.normalizeLine(line)
+}
+
+// normalizeLine converts one SSE line. Only data lines carry events; event
+// names, comments and blank separators are regenerated in canonical form.
+func (n *Normalizer) normalizeLine(line []byte) []byte {
+	payload, ok := bytes.CutPrefix(line, []byte("data:"))
+	if !ok {
+		return nil
+	}
+	payload = bytes.TrimSpace(payload)
+
+	var events []Event
+	done := false
+	if n.source == SourceAnthropic {
+		events, done = n.anthropicEvents(payload)
+	} else {
+		events, done = n.openAIEvents(payload)
+	}
+
+	var out []byte
+	for _, event := range events {
+		encoded, err := json.Marshal(event)
+		if err != nil {
+			continue
+		}
+		out = append(out, "data: "...)
+		out = append(out, encoded...)
+		out = append(out, "\n\n"...)
+	}
+	if done {
+		out = append(out, doneEvent...)
+	}
+	return out
+}
+
+// openAIEvents converts an OpenAI chat completion chunk
+func (n *Normalizer) openAIEvents(payload []byte) ([]Event, bool) {
+	if string(payload) == "[DONE]" {
+		return nil, true
+	}
+
+	var chunk struct {
+		Choices []struct {
+			Delta struct {
+				Content string `json:"content"`
+			} `json:"delta"`
+			FinishReason *string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage *base.TokenUsage `json:"usage"`
+		Error *EventError      `json:"error"`
+	}
+	if err := json.Unmarshal(payload, &chunk); err != nil {
+		return nil, false
+	}
+
+	var events []Event
+	if chunk.Error != nil {
+		events = append(events, Event{Error: chunk.Error})
+	}
+	for _, choice := range chunk.Choices {
+		if choice.Delta.Content != "" {
+			events = append(events, Event{Delta: choice.Delta.Content})
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			events = append(events, Event{FinishReason: *choice.FinishReason})
+		}
+	}
+	if chunk.Usage != nil {
+		events = append(events, Event{Usage: chunk.Usage})
+	}
+	return events, false
+}
+
+// anthropicEvents converts an Anthropic messages stream event. Usage arrives
+// split across message_start and message_delta and is reported once the
+// message stops.
+func (n *Normalizer) anthropicEvents(payload []byte) ([]Event, bool) {
+	var event struct {
+		Type    string `json:"type"`
+		Message struct {
+			Usage anthropicUsage `json:"usage"`
+		} `json:"message"`
+		Delta struct {
+			Type       string `json:"type"`
+			Text       string `json:"text"`
+			StopReason string `json:"stop_reason"`
+		} `json:"delta"`
+		Usage anthropicUsage `json:"usage"`
+		Error *EventError    `json:"error"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, false
+	}
+
+	switch event.Type {
+	case "message_start":
+		n.usage.PromptTokens = event.Message.Usage.InputTokens + event.Message.Usage.CacheReadInputTokens
+		if cached := event.Message.Usage.CacheReadInputTokens; cached > 0 {
+			n.usage.PromptTokensDetails = &base.PromptTokensDetails{CachedTokens: cached}
+		}
+	case "content_block_delta":
+		if event.Delta.Type == "text_delta" && event.Delta.Text != "" {
+			return []Event{{Delta: event.Delta.Text}}, false
+		}
+	case "message_delta":
+		n.usage.CompletionTokens = event.Usage.OutputTokens
+		if reason := event.Delta.StopReason; reason != "" {
+			if canonical, ok := anthropicFinishReasons[reason]; ok {
+				reason = canonical
+			}
+			return []Event{{FinishReason: reason}}, false
+		}
+	case "message_stop":
+		usage := n.usage
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+		return []Event{{Usage: &usage}}, true
+	default:
+		// Anthropic error events and the gateway's own stream error events
+		if event.Error != nil {
+			return []Event{{Error: event.Error}}, false
+		}
+	}
+	return nil, false
+}
+
+// anthropicUsage is the usage block of Anthropic stream events
+type anthropicUsage struct {
+	InputTokens          int64 `json:"input_tokens"`
+	CacheReadInputTokens int64 `json:"cache_read_input_tokens"`
+	OutputTokens         int64 `json:"output_tokens"`
+}
@@ -0,0 +1,78 @@
+package stream
+
+import (
+	"context"
+
+	"github.com/bendiamant/leash-gateway/internal/providers/base"
+)
+
+// FormatMetadata is the streaming response metadata key naming the format
+// served to the client
+const FormatMetadata = "stream_format"
+
+// Provider wraps a provider so its streams are served in the canonical
+// format. Non-streaming requests are unaffected.
+type Provider struct {
+	base.Provider
+	source string
+}
+
+// Wrap returns provider serving canonical streams, converting from the
+// source format its upstream streams in
+func Wrap(provider base.Provider, source string) (*Provider, error) {
+	if _, err := NewNormalizer(source); err != nil {
+		return nil, err
+	}
+	return &Provider{Provider: provider, source: source}, nil
+}
+
+// Unwrap returns the underlying provider
+func (p *Provider) Unwrap() base.Provider { return p.Provider }
+
+// ProcessStreamingRequest streams the upstream response as canonical events.
+// Chunk usage, cost, errors and metadata pass through unchanged.
+func (p *Provider) ProcessStreamingRequest(ctx context.Context, req *base.ProviderRequest) (*base.StreamingResponse, error) {
+	resp, err := p.Provider.ProcessStreamingRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	normalizer, _ := NewNormalizer(p.source)
+	normalized := *resp
+	normalized.Stream = Normalize(resp.Stream, normalizer)
+	normalized.Metadata = make(map[string]string, len(resp.Metadata)+1)
+	for key, value := range resp.Metadata {
+		normalized.Metadata[key] = value
+	}
+	normalized.Metadata[FormatMetadata] = FormatCanonical
+	return &normalized, nil
+}
+
+// Normalize converts a stream's chunks to canonical events as they arrive.
+// Chunks whose data holds no complete event are dropped unless they end the
+// stream.
+func Normalize(in <-chan base.StreamChunk, normalizer *Normalizer) <-chan base.StreamChunk {
+	out := make(chan base.StreamChunk, cap(in))
+	go func() {
+		defer close(out)
+		for chunk := range in {
+			chunk.Data = normalizer.Normalize(chunk.Data)
+			if chunk.Done {
+				chunk.Data = append(chunk.Data, normalizer.Flush()...)
+			}
+			if len(chunk.Data) == 0 && !chunk.Done {
+				continue
+			}
+			out <- chunk
+		}
+	}()
+	return out
+}
+
+// Shutdown stops the underlying provider
+func (p *Provider) Shutdown() error {
+	if shutdowner, ok := p.Provider.(interface{ Shutdown() error }); ok {
+		return shutdowner.Shutdown()
+	}
+	return nil
+}
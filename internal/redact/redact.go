@@ -0,0 +1,45 @@
+package redact
+
+import "regexp"
+
+// Patterns masked in captured bodies
+var (
+	emailPattern  = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	numberPattern = regexp.MustCompile(`\b(?:\d[ -]?){8,18}\d\b`) // card, account and phone numbers
+)
+
+// credentialHeaders are never captured
+var credentialHeaders = map[string]bool{
+	"authorization": true,
+	"x-api-key":     true,
+	"cookie":        true,
+	"set-cookie":    true,
+}
+
+// Body returns a copy of a captured body with email addresses and card,
+// account and phone numbers masked
+func Body(body []byte) []byte {
+	body = emailPattern.ReplaceAll(body, []byte("[REDACTED_EMAIL]"))
+	return numberPattern.ReplaceAll(body, []byte("[REDACTED_NUMBER]"))
+}
+
+// Headers returns a copy of captured headers without credentials or any of
+// the lower-case header names in drop
+func Headers(headers map[string]string, drop ...string) map[string]string {
+	kept := make(map[string]string, len(headers))
+	for key, value := range headers {
+		if !credentialHeaders[key] && !contains(drop, key) {
+			kept[key] = value
+		}
+	}
+	return kept
+}
+
+func contains(names []string, name string) bool {
+	for _, candidate := range names {
+		if candidate == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package replay
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/redact"
+	"github.com/bendiamant/leash-gateway/internal/tenants"
+)
+
+// Record is a captured request and the decision the gateway made for it,
+// written as one JSON line
+type Record struct {
+	CapturedAt  time.Time         `json:"captured_at"`
+	RequestID   string            `json:"request_id"`
+	TenantID    string            `json:"tenant_id"` // pseudonym when tenant anonymization is enabled
+	Provider    string            `json:"provider,omitempty"`
+	Model       string            `json:"model,omitempty"`
+	Method      string            `json:"method,omitempty"`
+	Path        string            `json:"path,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Body        string            `json:"body,omitempty"`
+	Action      string            `json:"action"`
+	BlockReason string            `json:"block_reason,omitempty"`
+	LatencyMS   float64           `json:"latency_ms"`
+}
+
+// Recorder writes a sample of requests to a capture file. Captured requests
+// are anonymized: credentials are dropped, PII in bodies is masked and tenant
+// IDs are replaced by pseudonyms when an anonymizer is set.
+type Recorder struct {
+	mu         sync.Mutex
+	output     io.Writer
+	sampleRate float64
+	anonymizer *tenants.Anonymizer
+	recorded   int
+}
+
+// NewRecorder creates a recorder capturing sampleRate (0 to 1] of requests
+func NewRecorder(output io.Writer, sampleRate float64, anonymizer *tenants.Anonymizer) (*Recorder, error) {
+	if sampleRate <= 0 || sampleRate > 1 {
+		return nil, fmt.Errorf("capture sample rate must be in (0, 1], got %v", sampleRate)
+	}
+	return &Recorder{output: output, sampleRate: sampleRate, anonymizer: anonymizer}, nil
+}
+
+// Record captures a processed request if it is sampled. Dry runs, such as
+// self-tests and replays, are never captured.
+func (r *Recorder) Record(req *interfaces.ProcessRequestContext, result *interfaces.ProcessRequestResult, latency time.Duration) error {
+	if req.DryRun || (r.sampleRate < 1 && rand.Float64() >= r.sampleRate) {
+		return nil
+	}
+
+	headers := redact.Headers(req.Headers, "x-tenant-id") // the tenant is captured as a pseudonym
+	body := redact.Body(req.Body)
+
+	line, err := json.Marshal(Record{
+		CapturedAt:  time.Now(),
+		RequestID:   req.RequestID,
+		TenantID:    r.anonymizer.TenantID(req.TenantID),
+		Provider:    req.Provider,
+		Model:       req.Model,
+		Method:      req.Method,
+		Path:        req.Path,
+		Headers:     headers,
+		Body:        string(body),
+		Action:      result.Action.String(),
+		BlockReason: result.BlockReason,
+		LatencyMS:   float64(latency) / float64(time.Millisecond),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode capture: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.output.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write capture: %w", err)
+	}
+	r.recorded++
+	return nil
+}
+
+// Recorded returns how many requests have been captured
+func (r *Recorder) Recorded() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.recorded
+}
+
+// ReadRecords reads a capture file's records in order
+func ReadRecords(input io.Reader) ([]Record, error) {
+	var records []Record
+	decoder := json.NewDecoder(input)
+	for decoder.More() {
+		var record Record
+		if err := decoder.Decode(&record); err != nil {
+			return nil, fmt.Errorf("invalid capture record %d: %w", len(records)+1, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
@@ -0,0 +1,188 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+)
+
+// Replayer drives captured requests through a target gateway's HTTP
+// ProcessRequest endpoint and compares its decisions with the captured ones
+type Replayer struct {
+	Target  string            // URL of the target's /process endpoint
+	Rate    float64           // requests per second; 0 sends as fast as the target answers
+	Tenant  string            // sends every request as this tenant instead of the captured one
+	Headers map[string]string // added to every request, e.g. the target's API key
+	DryRun  bool              // asks for dry runs so target sinks are not triggered; Headers must carry a trusted principal token allowing them
+	Client  *http.Client
+}
+
+// Difference is a replayed request whose decision differs from the capture
+type Difference struct {
+	RequestID      string `json:"request_id"` // as captured
+	Action         string `json:"action"`
+	ReplayedAction string `json:"replayed_action"`
+	BlockReason    string `json:"block_reason,omitempty"`
+	ReplayedReason string `json:"replayed_block_reason,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// Report summarizes a replay
+type Report struct {
+	Total               int          `json:"total"`
+	Matched             int          `json:"matched"`
+	Errors              int          `json:"errors"`
+	Differences         []Difference `json:"differences,omitempty"`
+	CapturedLatencyMS   float64      `json:"captured_latency_ms"` // mean pipeline latency
+	ReplayedLatencyMS   float64      `json:"replayed_latency_ms"`
+	LatencyDifferenceMS float64      `json:"latency_difference_ms"` // replayed minus captured
+}
+
+// decision is the part of a ProcessRequest response that is compared
+type decision struct {
+	Action           string  `json:"action"`
+	BlockReason      string  `json:"block_reason"`
+	ProcessingTimeMS float64 `json:"processing_time_ms"`
+	Error            string  `json:"error"`
+}
+
+// Run replays records in order at the configured rate. It stops early, with
+// the report so far, when ctx is done.
+func (r *Replayer) Run(ctx context.Context, records []Record) (*Report, error) {
+	client := r.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	var interval time.Duration
+	if r.Rate > 0 {
+		interval = time.Duration(float64(time.Second) / r.Rate)
+	}
+
+	report := &Report{}
+	var capturedLatency, replayedLatency float64
+	next := time.Now()
+	for _, record := range records {
+		if wait := time.Until(next); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return report.finish(capturedLatency, replayedLatency), ctx.Err()
+			}
+		}
+		next = next.Add(interval)
+
+		report.Total++
+		replayed, err := r.send(ctx, client, record)
+		if err != nil {
+			report.Errors++
+			report.Differences = append(report.Differences, Difference{
+				RequestID: record.RequestID,
+				Action:    record.Action,
+				Error:     err.Error(),
+			})
+			continue
+		}
+
+		capturedLatency += record.LatencyMS
+		replayedLatency += replayed.ProcessingTimeMS
+		if replayed.Action == record.Action && replayed.BlockReason == record.BlockReason {
+			report.Matched++
+			continue
+		}
+		report.Differences = append(report.Differences, Difference{
+			RequestID:      record.RequestID,
+			Action:         record.Action,
+			ReplayedAction: replayed.Action,
+			BlockReason:    record.BlockReason,
+			ReplayedReason: replayed.BlockReason,
+		})
+	}
+	return report.finish(capturedLatency, replayedLatency), nil
+}
+
+// send replays one record and decodes the target's decision
+func (r *Replayer) send(ctx context.Context, client *http.Client, record Record) (*decision, error) {
+	tenantID := record.TenantID
+	if r.Tenant != "" {
+		tenantID = r.Tenant
+	}
+	headers := make(map[string]string, len(record.Headers)+len(r.Headers))
+	for key, value := range record.Headers {
+		headers[key] = value
+	}
+	for key, value := range r.Headers {
+		headers[key] = value
+	}
+	if r.DryRun {
+		headers[pipeline.DefaultDryRunHeader] = "true"
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"tenant_id": tenantID,
+		"provider":  record.Provider,
+		"model":     record.Model,
+		"method":    record.Method,
+		"path":      record.Path,
+		"headers":   headers,
+		"body":      record.Body,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.Target, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var replayed decision
+	if err := json.Unmarshal(body, &replayed); err != nil {
+		return nil, fmt.Errorf("invalid response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("target returned %d: %s", resp.StatusCode, replayed.Error)
+	}
+	return &replayed, nil
+}
+
+// finish computes mean latencies over the requests that were answered
+func (r *Report) finish(capturedLatency, replayedLatency float64) *Report {
+	if answered := r.Total - r.Errors; answered > 0 {
+		r.CapturedLatencyMS = capturedLatency / float64(answered)
+		r.ReplayedLatencyMS = replayedLatency / float64(answered)
+		r.LatencyDifferenceMS = r.ReplayedLatencyMS - r.CapturedLatencyMS
+	}
+	return r
+}
+
+// Write prints a human-readable summary of the report
+func (r *Report) Write(w io.Writer) {
+	fmt.Fprintf(w, "Replayed %d requests: %d matched, %d differed, %d failed\n",
+		r.Total, r.Matched, len(r.Differences)-r.Errors, r.Errors)
+	fmt.Fprintf(w, "Mean latency: captured %.2fms, replayed %.2fms (%+.2fms)\n",
+		r.CapturedLatencyMS, r.ReplayedLatencyMS, r.LatencyDifferenceMS)
+	for _, d := range r.Differences {
+		if d.Error != "" {
+			fmt.Fprintf(w, "  %s: failed: %s\n", d.RequestID, d.Error)
+			continue
+		}
+		fmt.Fprintf(w, "  %s: %s %q -> %s %q\n", d.RequestID, d.Action, d.BlockReason, d.ReplayedAction, d.ReplayedReason)
+	}
+}
@@ -0,0 +1,224 @@
+package selftest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/config"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"github.com/bendiamant/leash-gateway/internal/modules/registry"
+	"github.com/bendiamant/leash-gateway/internal/providers"
+	"github.com/bendiamant/leash-gateway/internal/providers/base"
+	"go.uber.org/zap"
+)
+
+// Check names and groups accepted in fatal_checks
+const (
+	CheckPipeline       = "pipeline"
+	CheckProviders      = "providers"
+	checkProviderPrefix = "provider:"
+)
+
+// SyntheticTenant is the tenant used for the synthetic pipeline request
+const SyntheticTenant = "__self_test__"
+
+// CheckResult represents the outcome of a single self-test check
+type CheckResult struct {
+	Name     string        `json:"name"`
+	Passed   bool          `json:"passed"`
+	Fatal    bool          `json:"fatal"`
+	Message  string        `json:"message"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Report represents the outcome of a self-test run
+type Report struct {
+	Ready       bool          `json:"ready"`
+	Checks      []CheckResult `json:"checks"`
+	CompletedAt time.Time     `json:"completed_at"`
+}
+
+// Warmup reports the progress of module warmup
+type Warmup interface {
+	WarmupStatus() *registry.WarmupReport
+}
+
+// Runner performs the startup self-test and gates readiness on its result
+type Runner struct {
+	providers *providers.Registry
+	pipeline  *pipeline.Pipeline
+	config    config.SelfTestConfig
+	logger    *zap.SugaredLogger
+	warmup    Warmup
+
+	mu     sync.RWMutex
+	report *Report
+}
+
+// NewRunner creates a new self-test runner
+func NewRunner(providerRegistry *providers.Registry, modulePipeline *pipeline.Pipeline, cfg config.SelfTestConfig, logger *zap.SugaredLogger) *Runner {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &Runner{
+		providers: providerRegistry,
+		pipeline:  modulePipeline,
+		config:    cfg,
+		logger:    logger,
+	}
+}
+
+// SetWarmup holds readiness until module warmup has completed
+func (r *Runner) SetWarmup(warmup Warmup) {
+	r.warmup = warmup
+}
+
+// Run executes all checks and records the report used for readiness
+func (r *Runner) Run(ctx context.Context) *Report {
+	ctx, cancel := context.WithTimeout(ctx, r.config.Timeout)
+	defer cancel()
+
+	r.logger.Infof("Running startup self-test")
+
+	var checks []CheckResult
+	if r.providers != nil {
+		checks = append(checks, r.checkProviders(ctx)...)
+	}
+	if r.pipeline != nil {
+		checks = append(checks, r.checkPipeline(ctx))
+	}
+
+	report := &Report{Ready: true, Checks: checks, CompletedAt: time.Now()}
+	for i := range report.Checks {
+		check := &report.Checks[i]
+		check.Fatal = r.isFatal(check.Name)
+		if check.Passed {
+			continue
+		}
+		if check.Fatal {
+			report.Ready = false
+			r.logger.Errorf("Self-test check %s failed: %s", check.Name, check.Message)
+		} else {
+			r.logger.Warnf("Self-test check %s failed (non-fatal): %s", check.Name, check.Message)
+		}
+	}
+
+	r.mu.Lock()
+	r.report = report
+	r.mu.Unlock()
+
+	r.logger.Infof("Startup self-test completed: ready=%t checks=%d", report.Ready, len(report.Checks))
+	return report
+}
+
+// Report returns the last self-test report, or nil if none has run
+func (r *Runner) Report() *Report {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.report
+}
+
+// Ready reports whether the host may receive traffic. When the self-test is
+// enabled the host stays not ready until a run has passed all fatal checks,
+// and with a warmup set until module warmup has completed.
+func (r *Runner) Ready() bool {
+	if r.warmup != nil && !r.warmup.WarmupStatus().Done {
+		return false
+	}
+	if !r.config.Enabled {
+		return true
+	}
+	report := r.Report()
+	return report != nil && report.Ready
+}
+
+// ReadyHTTP handles readiness probes
+func (r *Runner) ReadyHTTP(w http.ResponseWriter, req *http.Request) {
+	if !r.Ready() {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		body := map[string]interface{}{
+			"status":    "not_ready",
+			"self_test": r.Report(),
+		}
+		if r.warmup != nil {
+			body["warmup"] = r.warmup.WarmupStatus()
+		}
+		json.NewEncoder(w).Encode(body)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("READY"))
+}
+
+// checkProviders health-checks every registered provider
+func (r *Runner) checkProviders(ctx context.Context) []CheckResult {
+	start := time.Now()
+	health := r.providers.HealthCheck(ctx)
+	duration := time.Since(start)
+
+	names := make([]string, 0, len(health))
+	for name := range health {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make([]CheckResult, 0, len(names))
+	for _, name := range names {
+		providerHealth := health[name]
+		results = append(results, CheckResult{
+			Name:     checkProviderPrefix + name,
+			Passed:   providerHealth.Status == base.HealthStatusHealthy,
+			Message:  providerHealth.Message,
+			Duration: duration,
+		})
+	}
+	return results
+}
+
+// checkPipeline runs a synthetic dry-run request through the module pipeline
+func (r *Runner) checkPipeline(ctx context.Context) CheckResult {
+	start := time.Now()
+	check := CheckResult{Name: CheckPipeline}
+
+	result, err := r.pipeline.ProcessRequest(ctx, &interfaces.ProcessRequestContext{
+		RequestID: fmt.Sprintf("self_test_%d", start.UnixNano()),
+		Timestamp: start,
+		TenantID:  SyntheticTenant,
+		Method:    http.MethodPost,
+		Path:      "/v1/chat/completions",
+		Headers:   map[string]string{"content-type": "application/json"},
+		Body:      []byte(`{"messages":[{"role":"user","content":"self-test"}]}`),
+		DryRun:    true,
+	})
+	check.Duration = time.Since(start)
+
+	switch {
+	case err != nil:
+		check.Message = fmt.Sprintf("pipeline error: %v", err)
+	case result.Action == interfaces.ActionBlock:
+		check.Message = fmt.Sprintf("synthetic request blocked: %s", result.BlockReason)
+	default:
+		check.Passed = true
+		check.Message = "synthetic request processed"
+	}
+	return check
+}
+
+// isFatal reports whether a failing check should fail readiness
+func (r *Runner) isFatal(name string) bool {
+	for _, fatal := range r.config.FatalChecks {
+		if fatal == name || (fatal == CheckProviders && strings.HasPrefix(name, checkProviderPrefix)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package tenants
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/bendiamant/leash-gateway/internal/admin"
+)
+
+// pseudonymPrefix marks anonymized tenant IDs in logs and metrics
+const pseudonymPrefix = "tenant_"
+
+// Anonymizer replaces tenant IDs with stable pseudonyms for logs, metric
+// labels and annotations. A pseudonym is a keyed hash of the tenant ID, so a
+// tenant always gets the same one for a given salt and it cannot be reversed
+// without the salt. The pseudonym-to-tenant mapping is held only in memory and
+// resolved through LookupHandler for holders of an authorized token.
+//
+// A nil Anonymizer leaves tenant IDs unchanged.
+type Anonymizer struct {
+	key     []byte
+	lookup  *admin.TokenAuth // tokens allowed to resolve pseudonyms
+	mu      sync.RWMutex
+	tenants map[string]string // pseudonym -> tenant ID
+}
+
+// NewAnonymizer creates an anonymizer keyed by salt. lookupTokenSHA256 lists
+// the SHA-256 of the tokens allowed to resolve pseudonyms; with none, the
+// mapping cannot be looked up at all.
+func NewAnonymizer(salt string, lookupTokenSHA256 []string) (*Anonymizer, error) {
+	if salt == "" {
+		return nil, fmt.Errorf("tenant anonymization requires a salt")
+	}
+	return &Anonymizer{
+		key:     []byte(salt),
+		lookup:  admin.NewTokenAuth(lookupTokenSHA256),
+		tenants: make(map[string]string),
+	}, nil
+}
+
+// TenantID returns the pseudonym for a tenant ID, recording it for
+// authorized lookups. Empty IDs stay empty.
+func (a *Anonymizer) TenantID(tenantID string) string {
+	if a == nil || tenantID == "" {
+		return tenantID
+	}
+
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(tenantID))
+	pseudonym := pseudonymPrefix + hex.EncodeToString(mac.Sum(nil))[:16]
+
+	a.mu.RLock()
+	_, known := a.tenants[pseudonym]
+	a.mu.RUnlock()
+	if !known {
+		a.mu.Lock()
+		a.tenants[pseudonym] = tenantID
+		a.mu.Unlock()
+	}
+	return pseudonym
+}
+
+// Resolve returns the tenant ID behind a pseudonym seen by this process
+func (a *Anonymizer) Resolve(pseudonym string) (string, bool) {
+	if a == nil {
+		return "", false
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	tenantID, ok := a.tenants[pseudonym]
+	return tenantID, ok
+}
+
+// LookupHandler serves authorized pseudonym lookups: GET ?pseudonym= returns
+// {"pseudonym", "tenant_id"} for requests bearing an allowed token
+func (a *Anonymizer) LookupHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !a.lookup.Authorized(r) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		pseudonym := r.URL.Query().Get("pseudonym")
+		tenantID, ok := a.Resolve(pseudonym)
+		if !ok {
+			http.Error(w, "pseudonym not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"pseudonym": pseudonym, "tenant_id": tenantID})
+	})
+}
@@ -0,0 +1,54 @@
+package tenants
+
+import (
+	"context"
+	"crypto/subtle"
+	"sort"
+
+	"github.com/bendiamant/leash-gateway/internal/config"
+)
+
+// ConfigStore is a read-only tenant store backed by the `tenants` config map
+type ConfigStore struct {
+	tenants map[string]*Tenant
+}
+
+// NewConfigStore creates a tenant store from tenant configuration
+func NewConfigStore(configured map[string]config.Tenant) *ConfigStore {
+	tenants := make(map[string]*Tenant, len(configured))
+	for tenantID, tenant := range configured {
+		tenants[tenantID] = &Tenant{ID: tenantID, Tenant: tenant}
+	}
+	return &ConfigStore{tenants: tenants}
+}
+
+// GetTenant returns the configured tenant with the given ID
+func (s *ConfigStore) GetTenant(ctx context.Context, tenantID string) (*Tenant, error) {
+	tenant, exists := s.tenants[tenantID]
+	if !exists {
+		return nil, ErrTenantNotFound
+	}
+	return tenant, nil
+}
+
+// ListTenants returns all configured tenants ordered by ID
+func (s *ConfigStore) ListTenants(ctx context.Context) ([]*Tenant, error) {
+	tenants := make([]*Tenant, 0, len(s.tenants))
+	for _, tenant := range s.tenants {
+		tenants = append(tenants, tenant)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].ID < tenants[j].ID })
+	return tenants, nil
+}
+
+// ResolveByAPIKey returns the tenant whose api_keys contain the key
+func (s *ConfigStore) ResolveByAPIKey(ctx context.Context, apiKey string) (*Tenant, error) {
+	for _, tenant := range s.tenants {
+		for _, key := range tenant.APIKeys {
+			if subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) == 1 {
+				return tenant, nil
+			}
+		}
+	}
+	return nil, ErrUnknownAPIKey
+}
@@ -0,0 +1,121 @@
+package tenants
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// DBStore is a tenant store backed by a SQL database, so tenants can be
+// onboarded without a config change. It expects two tables:
+//
+//	tenants(id, name, description, settings)  -- settings is a JSON object
+//	                                          -- using the `tenants` config keys
+//	tenant_api_keys(key_hash, tenant_id)      -- hex SHA-256 of the API key
+//
+// Queries use ? placeholders for MySQL and $n placeholders (PostgreSQL)
+// for every other driver.
+type DBStore struct {
+	db          *sql.DB
+	placeholder string
+}
+
+const tenantColumns = "t.id, t.name, t.description, t.settings"
+
+// NewDBStore creates a tenant store on a database opened with driver
+func NewDBStore(db *sql.DB, driver string) *DBStore {
+	placeholder := "$1"
+	if driver == "mysql" {
+		placeholder = "?"
+	}
+	return &DBStore{db: db, placeholder: placeholder}
+}
+
+// GetTenant loads a tenant by ID
+func (s *DBStore) GetTenant(ctx context.Context, tenantID string) (*Tenant, error) {
+	row := s.db.QueryRowContext(ctx,
+		"SELECT "+tenantColumns+" FROM tenants t WHERE t.id = "+s.placeholder, tenantID)
+	return scanTenant(row, ErrTenantNotFound)
+}
+
+// ListTenants loads all tenants ordered by ID
+func (s *DBStore) ListTenants(ctx context.Context) ([]*Tenant, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+tenantColumns+" FROM tenants t ORDER BY t.id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tenants: %w", err)
+	}
+	defer rows.Close()
+
+	var tenants []*Tenant
+	for rows.Next() {
+		tenant, err := scanTenant(rows, ErrTenantNotFound)
+		if err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, tenant)
+	}
+	return tenants, rows.Err()
+}
+
+// ResolveByAPIKey loads the tenant owning an API key, matched by its hash
+func (s *DBStore) ResolveByAPIKey(ctx context.Context, apiKey string) (*Tenant, error) {
+	row := s.db.QueryRowContext(ctx,
+		"SELECT "+tenantColumns+" FROM tenants t JOIN tenant_api_keys k ON k.tenant_id = t.id WHERE k.key_hash = "+s.placeholder,
+		HashAPIKey(apiKey))
+	return scanTenant(row, ErrUnknownAPIKey)
+}
+
+// HashAPIKey returns the hex SHA-256 digest stored in tenant_api_keys
+func HashAPIKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// scanner is satisfied by *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTenant reads a tenant row, returning notFound when there is no row
+func scanTenant(row scanner, notFound error) (*Tenant, error) {
+	var (
+		tenant   Tenant
+		settings sql.NullString
+	)
+	err := row.Scan(&tenant.ID, &tenant.Name, &tenant.Description, &settings)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, notFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tenant: %w", err)
+	}
+
+	if settings.Valid && settings.String != "" {
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(settings.String), &fields); err != nil {
+			return nil, fmt.Errorf("invalid settings for tenant %s: %w", tenant.ID, err)
+		}
+		decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+			Result:           &tenant.Tenant,
+			WeaklyTypedInput: true,
+			DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		name, description := tenant.Name, tenant.Description
+		if err := decoder.Decode(fields); err != nil {
+			return nil, fmt.Errorf("invalid settings for tenant %s: %w", tenant.ID, err)
+		}
+		// Columns win over any name/description repeated in settings
+		tenant.Name, tenant.Description = name, description
+	}
+
+	return &tenant, nil
+}
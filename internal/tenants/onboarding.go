@@ -0,0 +1,146 @@
+package tenants
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bendiamant/leash-gateway/internal/config"
+)
+
+// DefaultMaxOnboarded bounds the tenants onboarded when max_onboarded is unset
+const DefaultMaxOnboarded = 1000
+
+// Onboarder creates a tenant the store does not know for a request whose API
+// key authorizes onboarding
+type Onboarder interface {
+	// Onboard returns the tenant onboarded for tenantID, creating it on
+	// first use; apiKey must be an onboarding key or ErrUnknownAPIKey is
+	// returned
+	Onboard(ctx context.Context, tenantID, apiKey string) (*Tenant, error)
+}
+
+// OnboardingStore wraps a tenant store, creating a tenant from a template the
+// first time a request authenticated by an onboarding key names an unknown
+// tenant ID. Onboarded tenants live in memory until they are added to the
+// underlying store, and at most maxTenants are held.
+type OnboardingStore struct {
+	TenantStore
+	template   config.Tenant
+	keys       []string // SHA-256 hex digests of the onboarding keys
+	maxTenants int
+	onboard    func(*Tenant)
+	mu         sync.RWMutex
+	onboarded  map[string]*Tenant
+}
+
+// NewOnboardingStore creates a store onboarding unknown tenants from the
+// configured template. onboard, if set, is called once for each tenant
+// created.
+func NewOnboardingStore(store TenantStore, config config.TenantStoreConfig, onboard func(*Tenant)) *OnboardingStore {
+	keys := make([]string, 0, len(config.OnboardingKeys))
+	for _, key := range config.OnboardingKeys {
+		if key = strings.ToLower(strings.TrimSpace(key)); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	maxTenants := config.MaxOnboarded
+	if maxTenants <= 0 {
+		maxTenants = DefaultMaxOnboarded
+	}
+	return &OnboardingStore{
+		TenantStore: store,
+		template:    config.Template,
+		keys:        keys,
+		maxTenants:  maxTenants,
+		onboard:     onboard,
+		onboarded:   make(map[string]*Tenant),
+	}
+}
+
+// GetTenant returns the tenant from the underlying store or, failing that, an
+// already onboarded tenant; a bare tenant ID never onboards one
+func (s *OnboardingStore) GetTenant(ctx context.Context, tenantID string) (*Tenant, error) {
+	tenant, err := s.TenantStore.GetTenant(ctx, tenantID)
+	if !errors.Is(err, ErrTenantNotFound) {
+		return tenant, err
+	}
+
+	s.mu.RLock()
+	tenant, exists := s.onboarded[tenantID]
+	s.mu.RUnlock()
+	if !exists {
+		return nil, err
+	}
+	return tenant, nil
+}
+
+// Onboard creates tenantID from the template for a request authenticated by
+// an onboarding key. A tenant the underlying store knows is not onboarded:
+// its own API keys must be used. Once maxTenants are onboarded, new tenants
+// are refused with ErrOnboardingLimit.
+func (s *OnboardingStore) Onboard(ctx context.Context, tenantID, apiKey string) (*Tenant, error) {
+	if !s.onboardingKey(apiKey) {
+		return nil, ErrUnknownAPIKey
+	}
+	if _, err := s.TenantStore.GetTenant(ctx, tenantID); err == nil {
+		return nil, fmt.Errorf("%w %s", ErrTenantMismatch, tenantID)
+	} else if !errors.Is(err, ErrTenantNotFound) {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if tenant, exists := s.onboarded[tenantID]; exists {
+		s.mu.Unlock()
+		return tenant, nil
+	}
+	if len(s.onboarded) >= s.maxTenants {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("%w (%d)", ErrOnboardingLimit, s.maxTenants)
+	}
+	tenant := &Tenant{ID: tenantID, Tenant: s.template}
+	if tenant.Name == "" {
+		tenant.Name = tenantID
+	}
+	tenant.APIKeys = nil // template keys must not resolve to every onboarded tenant
+	s.onboarded[tenantID] = tenant
+	s.mu.Unlock()
+
+	if s.onboard != nil {
+		s.onboard(tenant)
+	}
+	return tenant, nil
+}
+
+// onboardingKey reports whether apiKey is one of the onboarding keys
+func (s *OnboardingStore) onboardingKey(apiKey string) bool {
+	keyHash := HashAPIKey(apiKey)
+	for _, key := range s.keys {
+		if subtle.ConstantTimeCompare([]byte(keyHash), []byte(key)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// ListTenants returns the underlying store's tenants and the onboarded
+// tenants ordered by ID
+func (s *OnboardingStore) ListTenants(ctx context.Context) ([]*Tenant, error) {
+	tenants, err := s.TenantStore.ListTenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	for _, tenant := range s.onboarded {
+		tenants = append(tenants, tenant)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].ID < tenants[j].ID })
+	return tenants, nil
+}
@@ -0,0 +1,88 @@
+package tenants
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bendiamant/leash-gateway/internal/config"
+)
+
+// Errors returned by tenant stores and the resolver
+var (
+	ErrTenantNotFound  = errors.New("tenant not found")
+	ErrUnknownAPIKey   = errors.New("unknown API key")
+	ErrTenantRequired  = errors.New("tenant_id is required")
+	ErrTenantMismatch  = errors.New("API key does not belong to tenant")
+	ErrOnboardingLimit = errors.New("onboarded tenant limit reached")
+)
+
+// Tenant is a resolved tenant and its configuration
+type Tenant struct {
+	ID string
+	config.Tenant
+}
+
+// TenantStore looks up tenants. The config-backed store serves the static
+// `tenants` map; other implementations (e.g. DBStore) allow tenants to be
+// managed without a config reload.
+type TenantStore interface {
+	// GetTenant returns the tenant with the given ID or ErrTenantNotFound
+	GetTenant(ctx context.Context, tenantID string) (*Tenant, error)
+
+	// ListTenants returns all tenants ordered by ID
+	ListTenants(ctx context.Context) ([]*Tenant, error)
+
+	// ResolveByAPIKey returns the tenant owning an API key or ErrUnknownAPIKey
+	ResolveByAPIKey(ctx context.Context, apiKey string) (*Tenant, error)
+}
+
+// Resolver resolves the tenant of a request from its API key header or its
+// explicit tenant ID
+type Resolver struct {
+	store      TenantStore
+	headerName string
+	prefix     string
+}
+
+// NewResolver creates a tenant resolver reading API keys as configured
+func NewResolver(store TenantStore, apiKeys config.APIKeysConfig) *Resolver {
+	headerName := apiKeys.HeaderName
+	if headerName == "" {
+		headerName = "X-API-Key"
+	}
+	return &Resolver{
+		store:      store,
+		headerName: strings.ToLower(headerName),
+		prefix:     apiKeys.Prefix,
+	}
+}
+
+// Store returns the underlying tenant store
+func (r *Resolver) Store() TenantStore { return r.store }
+
+// Resolve returns the request tenant. An API key takes precedence and must
+// agree with the tenant ID when both are given; otherwise the tenant ID must
+// name a known tenant. An unknown API key onboards the tenant ID if the store
+// is an Onboarder accepting it. Header names are expected in lower case.
+func (r *Resolver) Resolve(ctx context.Context, tenantID string, headers map[string]string) (*Tenant, error) {
+	if apiKey := strings.TrimPrefix(headers[r.headerName], r.prefix); apiKey != "" {
+		tenant, err := r.store.ResolveByAPIKey(ctx, apiKey)
+		if onboarder, ok := r.store.(Onboarder); ok && tenantID != "" && errors.Is(err, ErrUnknownAPIKey) {
+			return onboarder.Onboard(ctx, tenantID, apiKey)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if tenantID != "" && tenantID != tenant.ID {
+			return nil, fmt.Errorf("%w %s", ErrTenantMismatch, tenantID)
+		}
+		return tenant, nil
+	}
+
+	if tenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	return r.store.GetTenant(ctx, tenantID)
+}
@@ -0,0 +1,115 @@
+package tokens
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sync"
+	"unicode/utf8"
+)
+
+// DegradedAnnotation is set on requests whose token counts were estimated
+// because no tokenizer was available for the model
+const DegradedAnnotation = "token_estimate_degraded"
+
+// charsPerToken is the heuristic used when no tokenizer is available
+const charsPerToken = 4
+
+// Tokenizer counts the tokens a model's tokenizer produces for text
+type Tokenizer interface {
+	Count(text string) int
+}
+
+// Loader loads a tokenizer, e.g. from its vocabulary files
+type Loader func() (Tokenizer, error)
+
+// tokenizerEntry is a registered tokenizer, loaded on first use
+type tokenizerEntry struct {
+	pattern   string
+	load      Loader
+	once      sync.Once
+	tokenizer Tokenizer
+	err       error
+}
+
+// Counter counts tokens with the tokenizer registered for a model. Models
+// without one, or whose tokenizer fails to load, fall back to estimating four
+// characters per token and are reported as degraded rather than failing.
+type Counter struct {
+	mu      sync.RWMutex
+	entries []*tokenizerEntry
+}
+
+// NewCounter creates a counter with no tokenizers registered
+func NewCounter() *Counter {
+	return &Counter{}
+}
+
+// Register adds a tokenizer for models matching a path.Match pattern such as
+// "gpt-4o*". Patterns are tried in registration order.
+func (c *Counter) Register(pattern string, load Loader) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid tokenizer model pattern %q: %w", pattern, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = append(c.entries, &tokenizerEntry{pattern: pattern, load: load})
+	return nil
+}
+
+// Warmup loads every registered tokenizer now rather than on first use,
+// returning the errors of those that failed to load
+func (c *Counter) Warmup() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var errs []error
+	for _, entry := range c.entries {
+		if _, err := entry.get(); err != nil {
+			errs = append(errs, fmt.Errorf("tokenizer %q failed to load: %w", entry.pattern, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Count returns the tokens in text for a model and whether the count is a
+// heuristic estimate because no tokenizer was available
+func (c *Counter) Count(model, text string) (int, bool) {
+	if tokenizer := c.tokenizer(model); tokenizer != nil {
+		return tokenizer.Count(text), false
+	}
+	return Estimate(text), true
+}
+
+// tokenizer returns the loaded tokenizer for a model, or nil if none is
+// registered or it failed to load
+func (c *Counter) tokenizer(model string) Tokenizer {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, entry := range c.entries {
+		if matched, err := path.Match(entry.pattern, model); err != nil || !matched {
+			continue
+		}
+		tokenizer, err := entry.get()
+		if err != nil {
+			return nil
+		}
+		return tokenizer
+	}
+	return nil
+}
+
+// get loads the tokenizer on first use
+func (e *tokenizerEntry) get() (Tokenizer, error) {
+	e.once.Do(func() {
+		e.tokenizer, e.err = e.load()
+	})
+	return e.tokenizer, e.err
+}
+
+// Estimate returns the four-characters-per-token estimate for text
+func Estimate(text string) int {
+	return utf8.RuneCountInString(text) / charsPerToken
+}
@@ -0,0 +1,229 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/config"
+	"github.com/bendiamant/leash-gateway/internal/modulehost"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"github.com/bendiamant/leash-gateway/internal/tenants"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// gateModule holds requests until released and records the order they ran in
+type gateModule struct {
+	*stubModule
+	mu    sync.Mutex
+	order []string
+	gate  chan struct{}
+}
+
+func (g *gateModule) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequestContext) (*interfaces.ProcessRequestResult, error) {
+	g.mu.Lock()
+	g.order = append(g.order, req.TenantID)
+	g.mu.Unlock()
+
+	select {
+	case <-g.gate:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return &interfaces.ProcessRequestResult{Action: interfaces.ActionContinue}, nil
+}
+
+func (g *gateModule) admitted() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]string(nil), g.order...)
+}
+
+func TestAdmissionPriority(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	store := tenants.NewConfigStore(map[string]config.Tenant{
+		"batch":       {Name: "batch", Priority: 1},
+		"interactive": {Name: "interactive", Priority: 10},
+	})
+
+	newService := func(t *testing.T, admission modulehost.AdmissionConfig) (*modulehost.Service, *gateModule) {
+		t.Helper()
+		gate := &gateModule{stubModule: newStubModule("gate", interfaces.ModuleTypeInspector), gate: make(chan struct{})}
+		p := pipeline.NewPipeline(sugar)
+		p.AddModule(gate)
+
+		service := modulehost.NewService(p, sugar)
+		service.SetTenantResolver(tenants.NewResolver(store, config.APIKeysConfig{}))
+		if err := service.SetAdmission(admission); err != nil {
+			t.Fatalf("Failed to set admission: %v", err)
+		}
+		return service, gate
+	}
+
+	process := func(service *modulehost.Service, tenantID string, n int) error {
+		req, _ := structpb.NewStruct(map[string]interface{}{
+			"request_id": fmt.Sprintf("%s-%d", tenantID, n),
+			"tenant_id":  tenantID,
+			"body":       map[string]interface{}{"messages": []interface{}{map[string]interface{}{"role": "user", "content": "hi"}}},
+		})
+		_, err := service.ProcessRequest(ctx, req)
+		return err
+	}
+
+	// waitQueued waits until n requests are queued for admission
+	waitQueued := func(t *testing.T, service *modulehost.Service, n int) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for service.QueuedRequests() != n {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected %d queued requests, got %d", n, service.QueuedRequests())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	t.Run("HigherPriorityAdmittedFirst", func(t *testing.T) {
+		service, gate := newService(t, modulehost.AdmissionConfig{MaxConcurrent: 1, MaxQueue: 10, MaxWait: 10 * time.Second})
+
+		var wg sync.WaitGroup
+		run := func(tenantID string, n int) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := process(service, tenantID, n); err != nil {
+					t.Errorf("Request %s-%d failed: %v", tenantID, n, err)
+				}
+			}()
+		}
+
+		// The first request takes the only slot; the rest queue behind it,
+		// low-priority ones first
+		run("batch", 0)
+		deadline := time.Now().Add(5 * time.Second)
+		for len(gate.admitted()) == 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		run("batch", 1)
+		waitQueued(t, service, 1)
+		run("batch", 2)
+		waitQueued(t, service, 2)
+		run("interactive", 3)
+		waitQueued(t, service, 3)
+
+		close(gate.gate)
+		wg.Wait()
+
+		expected := []string{"batch", "interactive", "batch", "batch"}
+		if order := gate.admitted(); fmt.Sprint(order) != fmt.Sprint(expected) {
+			t.Errorf("Expected admission order %v, got %v", expected, order)
+		}
+	})
+
+	t.Run("FullQueueRejected", func(t *testing.T) {
+		service, gate := newService(t, modulehost.AdmissionConfig{MaxConcurrent: 1, MaxQueue: 1, MaxWait: 10 * time.Second})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func(n int) {
+				defer wg.Done()
+				process(service, "batch", n)
+			}(i)
+			waitQueued(t, service, i)
+		}
+
+		err := process(service, "interactive", 2)
+		if status.Code(err) != codes.ResourceExhausted {
+			t.Errorf("Expected a full queue to reject with ResourceExhausted, got %v", err)
+		}
+
+		close(gate.gate)
+		wg.Wait()
+	})
+
+	t.Run("WaitTimesOut", func(t *testing.T) {
+		service, gate := newService(t, modulehost.AdmissionConfig{MaxConcurrent: 1, MaxQueue: 10, MaxWait: 50 * time.Millisecond})
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			process(service, "batch", 0)
+		}()
+		deadline := time.Now().Add(5 * time.Second)
+		for len(gate.admitted()) == 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+
+		start := time.Now()
+		err := process(service, "interactive", 1)
+		if status.Code(err) != codes.ResourceExhausted {
+			t.Errorf("Expected a timed-out wait to fail with ResourceExhausted, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+			t.Errorf("Expected the request to wait for max_wait, returned after %v", elapsed)
+		}
+		if queued := service.QueuedRequests(); queued != 0 {
+			t.Errorf("Expected the timed-out request to leave the queue, got %d queued", queued)
+		}
+
+		close(gate.gate)
+		<-done
+		if err := process(service, "interactive", 2); err != nil {
+			t.Errorf("Expected capacity to be free after release, got %v", err)
+		}
+	})
+	t.Run("RejectionLogsPseudonym", func(t *testing.T) {
+		anonymizer, err := tenants.NewAnonymizer("admission-salt", nil)
+		if err != nil {
+			t.Fatalf("Failed to create anonymizer: %v", err)
+		}
+		gate := &gateModule{stubModule: newStubModule("gate", interfaces.ModuleTypeInspector), gate: make(chan struct{})}
+		p := pipeline.NewPipeline(sugar)
+		p.AddModule(gate)
+
+		core, logs := observer.New(zap.WarnLevel)
+		service := modulehost.NewService(p, zap.New(core).Sugar())
+		service.SetTenantResolver(tenants.NewResolver(store, config.APIKeysConfig{}))
+		service.SetTenantAnonymizer(anonymizer)
+		if err := service.SetAdmission(modulehost.AdmissionConfig{MaxConcurrent: 1, MaxQueue: 10, MaxWait: 10 * time.Millisecond}); err != nil {
+			t.Fatalf("Failed to set admission: %v", err)
+		}
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			process(service, "batch", 0)
+		}()
+		deadline := time.Now().Add(5 * time.Second)
+		for len(gate.admitted()) == 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if err := process(service, "interactive", 1); status.Code(err) != codes.ResourceExhausted {
+			t.Errorf("Expected the request not to be admitted, got %v", err)
+		}
+		close(gate.gate)
+		<-done
+
+		rejected := logs.FilterMessageSnippet("not admitted").All()
+		if len(rejected) != 1 {
+			t.Fatalf("Expected one rejection logged, got %d", len(rejected))
+		}
+		if message := rejected[0].Message; strings.Contains(message, "tenant interactive") || !strings.Contains(message, "tenant "+anonymizer.TenantID("interactive")) {
+			t.Errorf("Expected the rejection to name the tenant by pseudonym, got %q", message)
+		}
+	})
+}
@@ -0,0 +1,191 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bendiamant/leash-gateway/internal/metrics"
+	modulelogger "github.com/bendiamant/leash-gateway/internal/modules/core/logger"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/ratelimiter"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"github.com/bendiamant/leash-gateway/internal/tenants"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestTenantAnonymization(t *testing.T) {
+	ctx := context.Background()
+	const tenantID = "acme-corp"
+
+	newAnonymizer := func(t *testing.T, salt string, lookupTokens ...string) *tenants.Anonymizer {
+		anonymizer, err := tenants.NewAnonymizer(salt, lookupTokens)
+		if err != nil {
+			t.Fatalf("Failed to create anonymizer: %v", err)
+		}
+		return anonymizer
+	}
+
+	t.Run("SameTenantHashesConsistently", func(t *testing.T) {
+		first := newAnonymizer(t, "salt-1")
+		pseudonym := first.TenantID(tenantID)
+
+		if strings.Contains(pseudonym, tenantID) {
+			t.Errorf("Expected the pseudonym to hide the tenant ID, got %s", pseudonym)
+		}
+		if again := first.TenantID(tenantID); again != pseudonym {
+			t.Errorf("Expected a stable pseudonym, got %s then %s", pseudonym, again)
+		}
+		if other := newAnonymizer(t, "salt-1").TenantID(tenantID); other != pseudonym {
+			t.Errorf("Expected the same pseudonym across instances sharing a salt, got %s and %s", pseudonym, other)
+		}
+		if resalted := newAnonymizer(t, "salt-2").TenantID(tenantID); resalted == pseudonym {
+			t.Errorf("Expected a different salt to give a different pseudonym, got %s for both", pseudonym)
+		}
+		if otherTenant := first.TenantID("globex"); otherTenant == pseudonym {
+			t.Errorf("Expected different tenants to get different pseudonyms")
+		}
+		if _, err := tenants.NewAnonymizer("", nil); err == nil {
+			t.Error("Expected an empty salt to be rejected")
+		}
+	})
+
+	t.Run("LogsOmitRawTenantID", func(t *testing.T) {
+		anonymizer := newAnonymizer(t, "log-salt")
+		pseudonym := anonymizer.TenantID(tenantID)
+
+		// Module logs and the logger sink's entries are both checked
+		core, logs := observer.New(zap.DebugLevel)
+		sugar := zap.New(core).Sugar()
+		output := &syncBuffer{}
+
+		sink := modulelogger.NewLogger(sugar)
+		sink.SetOutput(output)
+		sink.SetTenantAnonymizer(anonymizer)
+		if err := sink.Initialize(ctx, &interfaces.ModuleConfig{
+			Name: "logger", Type: "sink", Enabled: true,
+			Config: map[string]interface{}{"log_requests": true, "log_responses": true},
+		}); err != nil {
+			t.Fatalf("Failed to initialize logger: %v", err)
+		}
+		sink.Start(ctx)
+
+		limiter := ratelimiter.NewRateLimiter(sugar)
+		limiter.SetTenantAnonymizer(anonymizer)
+		if err := limiter.Initialize(ctx, &interfaces.ModuleConfig{
+			Name: "rate-limiter", Enabled: true,
+			Config: map[string]interface{}{"burst_size": 1, "refill_rate": 1, "soft_limit_ratio": 0.5},
+		}); err != nil {
+			t.Fatalf("Failed to initialize rate limiter: %v", err)
+		}
+		limiter.Start(ctx)
+
+		p := pipeline.NewPipeline(sugar)
+		p.AddModule(limiter)
+		p.AddModule(sink)
+
+		// The second request exceeds the limit, so the block is logged too
+		for i := 0; i < 2; i++ {
+			req := &interfaces.ProcessRequestContext{
+				RequestID: fmt.Sprintf("anon-%d", i),
+				TenantID:  tenantID,
+				Provider:  "openai",
+				Headers:   map[string]string{"x-tenant-id": tenantID},
+				Body:      chatBody(t, "hello"),
+			}
+			result, err := p.ProcessRequest(ctx, req)
+			if err != nil {
+				t.Fatalf("Pipeline failed: %v", err)
+			}
+			if result.Action != interfaces.ActionBlock {
+				p.ProcessResponse(ctx, &interfaces.ProcessResponseContext{ProcessRequestContext: req, StatusCode: 200})
+			} else if key, _ := result.Annotations["bucket_key"].(string); !strings.HasPrefix(key, pseudonym) {
+				t.Errorf("Expected the bucket_key annotation to carry the pseudonym, got %q", key)
+			}
+		}
+		p.Drain(ctx)
+
+		entries := output.entries(t)
+		if len(entries) == 0 {
+			t.Fatal("Expected the logger sink to write entries")
+		}
+		for _, entry := range entries {
+			if entry["tenant_id"] != pseudonym {
+				t.Errorf("Expected entries to carry the pseudonym, got %v", entry["tenant_id"])
+			}
+		}
+		if sinkOutput, _ := json.Marshal(entries); strings.Contains(string(sinkOutput), tenantID) {
+			t.Errorf("Expected no raw tenant ID in logged entries, got %s", sinkOutput)
+		}
+
+		sawRateLimit := false
+		for _, entry := range logs.All() {
+			line, _ := json.Marshal(entry.ContextMap())
+			if strings.Contains(entry.Message, tenantID) || strings.Contains(string(line), tenantID) {
+				t.Errorf("Expected no raw tenant ID in module logs, got %q %s", entry.Message, line)
+			}
+			if strings.Contains(entry.Message, "Rate limit exceeded for tenant "+pseudonym) {
+				sawRateLimit = true
+			}
+		}
+		if !sawRateLimit {
+			t.Error("Expected the rate limit block to be logged with the pseudonym")
+		}
+	})
+
+	t.Run("MetricLabelsUsePseudonym", func(t *testing.T) {
+		anonymizer := newAnonymizer(t, "metrics-salt")
+		registry := metrics.NewRegistry()
+		if err := registry.SetTenantLabelPolicy(metrics.TenantLabelPolicy{Mode: metrics.TenantLabelAllowlist, Allowlist: []string{tenantID}}); err != nil {
+			t.Fatalf("Failed to set tenant label policy: %v", err)
+		}
+		registry.SetTenantAnonymizer(anonymizer.TenantID)
+
+		if label := registry.TenantLabel(tenantID); label != anonymizer.TenantID(tenantID) {
+			t.Errorf("Expected the allowlisted tenant labelled by pseudonym, got %s", label)
+		}
+		if label := registry.TenantLabel("unlisted"); label != "other" {
+			t.Errorf("Expected unlisted tenants still collapsed, got %s", label)
+		}
+	})
+
+	t.Run("LookupRequiresAuthorizedToken", func(t *testing.T) {
+		sum := sha256.Sum256([]byte("lookup-token"))
+		anonymizer := newAnonymizer(t, "lookup-salt", hex.EncodeToString(sum[:]))
+		pseudonym := anonymizer.TenantID(tenantID)
+		handler := anonymizer.LookupHandler()
+
+		lookup := func(token string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, "/admin/tenant-pseudonyms?pseudonym="+pseudonym, nil)
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			return recorder
+		}
+
+		for _, token := range []string{"", "wrong-token"} {
+			if recorder := lookup(token); recorder.Code != http.StatusUnauthorized || strings.Contains(recorder.Body.String(), tenantID) {
+				t.Errorf("Expected token %q to be refused, got %d %s", token, recorder.Code, recorder.Body)
+			}
+		}
+
+		recorder := lookup("lookup-token")
+		var resolved map[string]string
+		json.Unmarshal(recorder.Body.Bytes(), &resolved)
+		if recorder.Code != http.StatusOK || resolved["tenant_id"] != tenantID {
+			t.Errorf("Expected an authorized lookup to resolve %s, got %d %s", tenantID, recorder.Code, recorder.Body)
+		}
+	})
+}
@@ -0,0 +1,122 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/core/audit"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"go.uber.org/zap"
+)
+
+func TestAuditRetention(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	auditor := audit.NewAuditor(sugar)
+	err := auditor.Initialize(ctx, &interfaces.ModuleConfig{
+		Name: "audit", Type: "sink", Enabled: true,
+		Config: map[string]interface{}{
+			"retention": map[string]interface{}{
+				"tenant_id":   "365d",
+				"model":       "365d",
+				"prompt_hash": "90d",
+				"prompt":      "0d",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to initialize audit module: %v", err)
+	}
+
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, err = auditor.ProcessRequest(ctx, &interfaces.ProcessRequestContext{
+		RequestID: "audit-req",
+		Timestamp: createdAt,
+		TenantID:  "test-tenant",
+		Model:     "gpt-4o-mini",
+		Body:      []byte(`{"messages":[{"role":"user","content":"secret plans"}]}`),
+	})
+	if err != nil {
+		t.Fatalf("Audit module failed: %v", err)
+	}
+
+	t.Run("ZeroRetentionFieldsNeverStored", func(t *testing.T) {
+		record, err := auditor.GetRecord("audit-req")
+		if err != nil {
+			t.Fatalf("Expected audit record: %v", err)
+		}
+		if _, exists := record.Fields["prompt"]; exists {
+			t.Error("Expected raw prompt with 0d retention not to be stored")
+		}
+		if record.Fields["prompt_hash"] == "" {
+			t.Error("Expected prompt hash to be stored")
+		}
+	})
+
+	t.Run("ExpiredFieldsPurged", func(t *testing.T) {
+		auditor.Purge(createdAt.Add(91 * 24 * time.Hour))
+
+		record, err := auditor.GetRecord("audit-req")
+		if err != nil {
+			t.Fatalf("Expected audit record to survive partial purge: %v", err)
+		}
+		if _, exists := record.Fields["prompt_hash"]; exists {
+			t.Error("Expected prompt hash past 90d retention to be purged")
+		}
+		if record.Fields["tenant_id"] != "test-tenant" || record.Fields["model"] != "gpt-4o-mini" {
+			t.Errorf("Expected within-retention fields to remain, got %v", record.Fields)
+		}
+	})
+
+	t.Run("RecordDroppedWhenAllFieldsExpire", func(t *testing.T) {
+		auditor.Purge(createdAt.Add(366 * 24 * time.Hour))
+
+		if _, err := auditor.GetRecord("audit-req"); err == nil {
+			t.Error("Expected record to be removed once every field expired")
+		}
+	})
+
+	t.Run("NonPositivePurgeIntervalRejected", func(t *testing.T) {
+		for _, interval := range []string{"0s", "-1m"} {
+			config := &interfaces.ModuleConfig{
+				Name: "audit", Type: "sink", Enabled: true,
+				Config: map[string]interface{}{"purge_interval": interval},
+			}
+			if err := auditor.ValidateConfig(config); err == nil {
+				t.Errorf("Expected purge_interval %s to fail validation", interval)
+			}
+			if err := audit.NewAuditor(sugar).Initialize(ctx, config); err == nil {
+				t.Errorf("Expected purge_interval %s to fail initialization", interval)
+			}
+		}
+	})
+
+	t.Run("OldestRecordsEvictedAtMaxRecords", func(t *testing.T) {
+		bounded := audit.NewAuditor(sugar)
+		if err := bounded.Initialize(ctx, &interfaces.ModuleConfig{
+			Name: "audit", Type: "sink", Enabled: true,
+			Config: map[string]interface{}{"max_records": 2},
+		}); err != nil {
+			t.Fatalf("Failed to initialize audit module: %v", err)
+		}
+		for _, requestID := range []string{"first", "second", "third"} {
+			bounded.ProcessRequest(ctx, &interfaces.ProcessRequestContext{
+				RequestID: requestID, TenantID: "test-tenant", Timestamp: createdAt,
+			})
+		}
+		if _, err := bounded.GetRecord("first"); err == nil {
+			t.Error("Expected the oldest record evicted beyond max_records")
+		}
+		for _, requestID := range []string{"second", "third"} {
+			if _, err := bounded.GetRecord(requestID); err != nil {
+				t.Errorf("Expected record %s kept: %v", requestID, err)
+			}
+		}
+	})
+}
@@ -1,13 +1,10 @@
+//go:build integration
 // +build integration
 
 package integration
 
 import (
-	"context"
-	"fmt"
-	"net/http"
 	"testing"
-	"time"
 
 	"github.com/bendiamant/leash-gateway/internal/config"
 )
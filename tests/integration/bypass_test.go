@@ -0,0 +1,238 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/core/contentfilter"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"github.com/bendiamant/leash-gateway/internal/providers"
+	"github.com/bendiamant/leash-gateway/internal/providers/base"
+	"go.uber.org/zap"
+)
+
+func TestTrustedPrincipalBypass(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	filter := contentfilter.NewContentFilter(sugar)
+	if err := filter.Initialize(ctx, &interfaces.ModuleConfig{
+		Name: "content-filter",
+		Config: map[string]interface{}{
+			"blocked_keywords": []interface{}{"harmful"},
+			"action":           "block",
+		},
+	}); err != nil {
+		t.Fatalf("Failed to initialize content filter: %v", err)
+	}
+	filter.Start(ctx)
+
+	tokenHash := sha256.Sum256([]byte("internal-secret"))
+	modulePipeline := pipeline.NewPipeline(sugar)
+	modulePipeline.AddModule(filter)
+	modulePipeline.SetBypass(pipeline.BypassConfig{
+		Principals: []pipeline.TrustedPrincipal{{
+			Name:          "batch-evaluator",
+			TokenSHA256:   hex.EncodeToString(tokenHash[:]),
+			BypassModules: []string{"content-filter"},
+		}},
+	})
+
+	newRequest := func(headers map[string]string) *interfaces.ProcessRequestContext {
+		return &interfaces.ProcessRequestContext{
+			RequestID: "bypass-test",
+			TenantID:  "tenant-a",
+			Headers:   headers,
+			Body:      chatBody(t, "this is harmful content"),
+		}
+	}
+
+	t.Run("TrustedRequestBypassesFilter", func(t *testing.T) {
+		req := newRequest(map[string]string{"x-leash-internal-token": "internal-secret"})
+		result, err := modulePipeline.ProcessRequest(ctx, req)
+		if err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		if result.Action != interfaces.ActionContinue {
+			t.Fatalf("Expected trusted request to bypass the content filter, got %s: %s", result.Action, result.BlockReason)
+		}
+		if result.Annotations["trusted_principal"] != "batch-evaluator" {
+			t.Errorf("Expected trusted_principal annotation, got %v", result.Annotations["trusted_principal"])
+		}
+		if _, ok := result.Annotations["bypassed_modules"]; !ok {
+			t.Errorf("Expected bypassed_modules annotation, got %v", result.Annotations)
+		}
+		if _, ok := req.Headers["x-leash-internal-token"]; ok {
+			t.Errorf("Expected internal token header to be stripped")
+		}
+	})
+
+	t.Run("NormalRequestFiltered", func(t *testing.T) {
+		result, err := modulePipeline.ProcessRequest(ctx, newRequest(map[string]string{}))
+		if err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		if result.Action != interfaces.ActionBlock {
+			t.Errorf("Expected normal request to be blocked, got %s", result.Action)
+		}
+	})
+
+	t.Run("InvalidTokenFiltered", func(t *testing.T) {
+		result, err := modulePipeline.ProcessRequest(ctx, newRequest(map[string]string{"x-leash-internal-token": "guess"}))
+		if err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		if result.Action != interfaces.ActionBlock {
+			t.Errorf("Expected request with an invalid token to be blocked, got %s", result.Action)
+		}
+	})
+
+	t.Run("PresetBypassIgnored", func(t *testing.T) {
+		req := newRequest(map[string]string{})
+		req.BypassModules = []string{"content-filter"}
+		result, err := modulePipeline.ProcessRequest(ctx, req)
+		if err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		if result.Action != interfaces.ActionBlock {
+			t.Errorf("Expected bypass without a token to be ignored, got %s", result.Action)
+		}
+	})
+
+	t.Run("TokenStrippedWithoutPrincipals", func(t *testing.T) {
+		unconfigured := pipeline.NewPipeline(sugar)
+		unconfigured.AddModule(filter)
+
+		req := newRequest(map[string]string{"x-leash-internal-token": "internal-secret"})
+		if _, err := unconfigured.ProcessRequest(ctx, req); err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		if _, leaked := req.Headers["x-leash-internal-token"]; leaked {
+			t.Errorf("Expected the internal token stripped without configured principals, got %v", req.Headers)
+		}
+		if req.Annotations["trusted_principal"] != nil {
+			t.Errorf("Expected no principal without configured principals, got %v", req.Annotations)
+		}
+	})
+}
+
+func TestProviderOverrideHeader(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	hash := func(token string) string {
+		sum := sha256.Sum256([]byte(token))
+		return hex.EncodeToString(sum[:])
+	}
+	modulePipeline := pipeline.NewPipeline(sugar)
+	modulePipeline.AddModule(newStubModule("policy", interfaces.ModuleTypePolicy))
+	modulePipeline.SetBypass(pipeline.BypassConfig{
+		Principals: []pipeline.TrustedPrincipal{
+			{Name: "migration-runner", TokenSHA256: hash("migration-secret"), AllowProviderOverride: true},
+			{Name: "batch-evaluator", TokenSHA256: hash("batch-secret")},
+		},
+	})
+
+	// Both OpenAI-compatible providers serve gpt-4o, which is weighted
+	// entirely to openai; anthropic does not serve it
+	providerConfig := func(providerType, model string, weight float64) *base.ProviderConfig {
+		return &base.ProviderConfig{
+			Type:     providerType,
+			Endpoint: "http://127.0.0.1:1",
+			Timeout:  time.Second,
+			CircuitBreaker: base.CircuitBreakerConfig{
+				FailureThreshold: 50,
+				MinRequests:      10,
+				Timeout:          time.Minute,
+			},
+			Models: []base.ModelConfig{{Name: model, RoutingWeight: weight}},
+		}
+	}
+	registry := providers.NewRegistry(sugar)
+	if err := registry.InitializeFromConfig(map[string]*base.ProviderConfig{
+		"openai":    providerConfig("openai", "gpt-4o", 1),
+		"azure":     providerConfig("openai", "gpt-4o", 0),
+		"anthropic": providerConfig("anthropic", "claude-3-5-sonnet", 0),
+	}); err != nil {
+		t.Fatalf("Failed to initialize providers: %v", err)
+	}
+
+	// route runs a request through the pipeline and routes it with the
+	// pipeline's decision metadata, as the data plane does
+	route := func(t *testing.T, headers map[string]string) (*interfaces.ProcessRequestResult, base.Provider, error) {
+		t.Helper()
+		req := &interfaces.ProcessRequestContext{RequestID: "override-test", TenantID: "tenant-a", Model: "gpt-4o", Headers: headers}
+		result, err := modulePipeline.ProcessRequest(ctx, req)
+		if err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		if _, ok := req.Headers["x-leash-provider"]; ok {
+			t.Errorf("Expected the provider override header to be stripped")
+		}
+		provider, err := registry.SelectProvider(&base.ProviderRequest{
+			RequestID: req.RequestID,
+			Model:     req.Model,
+			Metadata:  map[string]string{providers.ProviderOverrideKey: result.Metadata[pipeline.ProviderOverrideMetadata]},
+		})
+		return result, provider, err
+	}
+
+	t.Run("TrustedOverrideReroutes", func(t *testing.T) {
+		result, provider, err := route(t, map[string]string{"x-leash-internal-token": "migration-secret", "x-leash-provider": "azure"})
+		if err != nil {
+			t.Fatalf("Failed to select provider: %v", err)
+		}
+		if provider.Name() != "azure" {
+			t.Errorf("Expected the override to route to azure, got %s", provider.Name())
+		}
+		if result.Annotations["provider_override"] != "azure" {
+			t.Errorf("Expected a provider_override annotation, got %v", result.Annotations)
+		}
+	})
+
+	t.Run("WithoutOverrideRoutesByModel", func(t *testing.T) {
+		_, provider, err := route(t, map[string]string{"x-leash-internal-token": "migration-secret"})
+		if err != nil || provider.Name() != "openai" {
+			t.Errorf("Expected normal routing to openai, got %v (%v)", provider, err)
+		}
+	})
+
+	for name, headers := range map[string]map[string]string{
+		"NoTokenIgnored":        {"x-leash-provider": "azure"},
+		"InvalidTokenIgnored":   {"x-leash-internal-token": "guess", "x-leash-provider": "azure"},
+		"PrincipalWithoutGrant": {"x-leash-internal-token": "batch-secret", "x-leash-provider": "azure"},
+	} {
+		headers := headers
+		t.Run(name, func(t *testing.T) {
+			result, provider, err := route(t, headers)
+			if err != nil {
+				t.Fatalf("Failed to select provider: %v", err)
+			}
+			if provider.Name() != "openai" {
+				t.Errorf("Expected an untrusted override to be ignored, got %s", provider.Name())
+			}
+			if result.Annotations["provider_override_ignored"] != "azure" {
+				t.Errorf("Expected the ignored override to be annotated, got %v", result.Annotations)
+			}
+		})
+	}
+
+	t.Run("ProviderMustServeModel", func(t *testing.T) {
+		for _, override := range []string{"anthropic", "no-such-provider"} {
+			_, _, err := route(t, map[string]string{"x-leash-internal-token": "migration-secret", "x-leash-provider": override})
+			if err == nil || !strings.Contains(err.Error(), "provider override") {
+				t.Errorf("Expected an override to %s to be rejected for gpt-4o, got %v", override, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,233 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/circuitbreaker"
+	"github.com/bendiamant/leash-gateway/internal/featureflags"
+	"github.com/bendiamant/leash-gateway/internal/providers"
+	"github.com/bendiamant/leash-gateway/internal/providers/base"
+	"github.com/bendiamant/leash-gateway/internal/providers/cache"
+	"github.com/bendiamant/leash-gateway/internal/providers/openai"
+	"go.uber.org/zap"
+)
+
+// stubEmbedder embeds prompts as fixed vectors chosen by keyword
+type stubEmbedder struct {
+	calls int
+}
+
+func (e *stubEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	e.calls++
+	switch {
+	case strings.Contains(text, "capital of france"):
+		return []float64{1, 0, 0}, nil
+	case strings.Contains(text, "france's capital"):
+		return []float64{0.99, 0.05, 0}, nil
+	default:
+		return []float64{0, 0, 1}, nil
+	}
+}
+
+func TestProviderResponseCache(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	upstreamCalls := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls++
+		w.Write([]byte(`{"id":"x","choices":[{"message":{"role":"assistant","content":"Paris"}}]}`))
+	}))
+	defer upstream.Close()
+
+	embedder := &stubEmbedder{}
+	responseCache := cache.NewCache(cache.Config{
+		TTL:                 time.Minute,
+		SemanticEnabled:     true,
+		SimilarityThreshold: 0.95,
+	}, embedder, sugar)
+
+	provider := cache.Wrap(openai.NewOpenAIProvider(&base.ProviderConfig{
+		Name:     "openai",
+		Endpoint: upstream.URL,
+		Timeout:  time.Second,
+		CircuitBreaker: base.CircuitBreakerConfig{
+			FailureThreshold: 50,
+			MinRequests:      10,
+			Timeout:          time.Minute,
+		},
+	}, circuitbreaker.NewManager(), sugar), responseCache)
+
+	ask := func(prompt string) *base.ProviderResponse {
+		resp, err := provider.ProcessRequest(ctx, &base.ProviderRequest{
+			RequestID: "cache-test",
+			TenantID:  "tenant-a",
+			Model:     "gpt-4o-mini",
+			Messages:  []base.Message{{Role: "user", Content: prompt}},
+		})
+		if err != nil {
+			t.Fatalf("Provider request failed: %v", err)
+		}
+		return resp
+	}
+
+	resp := ask("What is the capital of France?")
+	if upstreamCalls != 1 || resp.Metadata["cache"] != "" {
+		t.Fatalf("Expected first request to reach the provider, got %d calls and cache %q", upstreamCalls, resp.Metadata["cache"])
+	}
+
+	t.Run("ExactMatchIsFastPath", func(t *testing.T) {
+		embedCalls := embedder.calls
+		resp := ask("  what is the CAPITAL of   France? ")
+		if resp.Metadata["cache"] != cache.TierExact {
+			t.Errorf("Expected exact cache hit, got %q", resp.Metadata["cache"])
+		}
+		if embedder.calls != embedCalls {
+			t.Errorf("Expected exact hit to skip embedding, got %d extra calls", embedder.calls-embedCalls)
+		}
+	})
+
+	t.Run("NearDuplicateHitsSemanticCache", func(t *testing.T) {
+		resp := ask("Tell me France's capital")
+		if resp.Metadata["cache"] != cache.TierSemantic {
+			t.Errorf("Expected semantic cache hit, got %q", resp.Metadata["cache"])
+		}
+		if upstreamCalls != 1 {
+			t.Errorf("Expected no upstream call on a semantic hit, got %d calls", upstreamCalls)
+		}
+		if !strings.Contains(string(resp.Body), "Paris") {
+			t.Errorf("Expected cached body, got %s", resp.Body)
+		}
+	})
+
+	t.Run("DissimilarPromptMisses", func(t *testing.T) {
+		resp := ask("Write a haiku about autumn")
+		if resp.Metadata["cache"] != "" {
+			t.Errorf("Expected cache miss, got %q", resp.Metadata["cache"])
+		}
+		if upstreamCalls != 2 {
+			t.Errorf("Expected dissimilar prompt to reach the provider, got %d calls", upstreamCalls)
+		}
+	})
+}
+
+func TestFeatureFlagOverlay(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	enabled, disabled := true, false
+	flags := featureflags.New(featureflags.Flags{Streaming: true}, map[string]featureflags.Overrides{
+		"rollout":   {Caching: &enabled},
+		"no-stream": {Streaming: &disabled},
+	})
+
+	t.Run("TenantOverridesGlobalFlags", func(t *testing.T) {
+		if got := flags.For("rollout"); !got.Caching || !got.Streaming {
+			t.Errorf("Expected caching enabled over the global streaming flag, got %+v", got)
+		}
+		if got := flags.For("no-stream"); got.Caching || got.Streaming {
+			t.Errorf("Expected streaming disabled and caching inherited, got %+v", got)
+		}
+		if got := flags.For("unlisted"); got != flags.Defaults() {
+			t.Errorf("Expected the global flags for tenants without overrides, got %+v", got)
+		}
+	})
+
+	t.Run("CachingPerTenant", func(t *testing.T) {
+		upstreamCalls := 0
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			upstreamCalls++
+			w.Write([]byte(`{"id":"x","choices":[{"message":{"role":"assistant","content":"Paris"}}]}`))
+		}))
+		defer upstream.Close()
+
+		responseCache := cache.NewCache(cache.Config{TTL: time.Minute}, nil, sugar)
+		responseCache.SetFeatureFlags(flags)
+		provider := cache.Wrap(openai.NewOpenAIProvider(&base.ProviderConfig{
+			Name:           "openai",
+			Endpoint:       upstream.URL,
+			Timeout:        time.Second,
+			CircuitBreaker: base.CircuitBreakerConfig{FailureThreshold: 50, MinRequests: 10, Timeout: time.Minute},
+		}, circuitbreaker.NewManager(), sugar), responseCache)
+
+		ask := func(tenantID string) *base.ProviderResponse {
+			resp, err := provider.ProcessRequest(ctx, &base.ProviderRequest{
+				RequestID: "flags-" + tenantID,
+				TenantID:  tenantID,
+				Model:     "gpt-4o-mini",
+				Messages:  []base.Message{{Role: "user", Content: "What is the capital of France?"}},
+			})
+			if err != nil {
+				t.Fatalf("Provider request failed: %v", err)
+			}
+			return resp
+		}
+
+		ask("rollout")
+		if resp := ask("rollout"); resp.Metadata["cache"] != cache.TierExact || upstreamCalls != 1 {
+			t.Errorf("Expected the rollout tenant served from cache, got cache %q after %d calls", resp.Metadata["cache"], upstreamCalls)
+		}
+
+		for i := 0; i < 2; i++ {
+			if resp := ask("no-stream"); resp.Metadata["cache"] != "" {
+				t.Errorf("Expected a tenant without caching to bypass the cache, got %q", resp.Metadata["cache"])
+			}
+		}
+		if upstreamCalls != 3 {
+			t.Errorf("Expected every uncached request upstream, got %d calls", upstreamCalls)
+		}
+		if responseCache.Len() != 1 {
+			t.Errorf("Expected only the rollout tenant's response cached, got %d entries", responseCache.Len())
+		}
+	})
+
+	t.Run("StreamingPerTenant", func(t *testing.T) {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: [DONE]\n\n"))
+		}))
+		defer upstream.Close()
+
+		registry := providers.NewRegistry(sugar)
+		registry.SetFeatureFlags(flags)
+		if err := registry.InitializeFromConfig(map[string]*base.ProviderConfig{
+			"openai": {
+				Endpoint:       upstream.URL,
+				Timeout:        time.Second,
+				CircuitBreaker: base.CircuitBreakerConfig{FailureThreshold: 50, MinRequests: 10, Timeout: time.Minute},
+				Models:         []base.ModelConfig{{Name: "gpt-4o-mini"}},
+			},
+		}); err != nil {
+			t.Fatalf("Failed to initialize providers: %v", err)
+		}
+
+		stream := func(tenantID string) error {
+			resp, err := registry.RouteStreamingRequest(ctx, &base.ProviderRequest{
+				RequestID: "flags-stream-" + tenantID, TenantID: tenantID, Model: "gpt-4o-mini", Streaming: true,
+				Messages: []base.Message{{Role: "user", Content: "hi"}},
+			})
+			if err == nil {
+				for range resp.Stream {
+				}
+			}
+			return err
+		}
+		if err := stream("rollout"); err != nil {
+			t.Errorf("Expected streaming allowed by the global flag, got %v", err)
+		}
+		if err := stream("no-stream"); !errors.Is(err, providers.ErrStreamingDisabled) {
+			t.Errorf("Expected streaming refused for the tenant, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,158 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/core/contentfilter"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/costtracker"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"go.uber.org/zap"
+)
+
+// choicesBody builds a chat completion response with one choice per content
+func choicesBody(t *testing.T, contents ...string) []byte {
+	t.Helper()
+
+	choices := make([]map[string]interface{}, len(contents))
+	for i, content := range contents {
+		choices[i] = map[string]interface{}{
+			"index":         i,
+			"message":       map[string]string{"role": "assistant", "content": content},
+			"finish_reason": "stop",
+		}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"object":  "chat.completion",
+		"model":   "gpt-4o-mini",
+		"choices": choices,
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal response: %v", err)
+	}
+	return body
+}
+
+func TestMultipleChoiceResponses(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	// n=3: only the last choice contains blocked content
+	body := choicesBody(t, "a friendly answer", "another friendly answer", "a harmful answer")
+	newResponse := func(body []byte, usage *interfaces.TokenUsage) *interfaces.ProcessResponseContext {
+		return &interfaces.ProcessResponseContext{
+			ProcessRequestContext: &interfaces.ProcessRequestContext{
+				RequestID: "choices",
+				TenantID:  "tenant-a",
+				Provider:  "openai",
+				Model:     "gpt-4o-mini",
+			},
+			StatusCode:   200,
+			ResponseBody: body,
+			TokensUsed:   usage,
+		}
+	}
+
+	newFilter := func(t *testing.T, action string) *contentfilter.ContentFilter {
+		filter := contentfilter.NewContentFilter(sugar)
+		if err := filter.Initialize(ctx, &interfaces.ModuleConfig{
+			Name: "content-filter",
+			Config: map[string]interface{}{
+				"blocked_keywords": []interface{}{"harmful"},
+				"action":           action,
+			},
+		}); err != nil {
+			t.Fatalf("Failed to initialize content filter: %v", err)
+		}
+		return filter
+	}
+
+	t.Run("EveryChoiceIsFiltered", func(t *testing.T) {
+		result, err := newFilter(t, "warn").ProcessResponse(ctx, newResponse(body, nil))
+		if err != nil {
+			t.Fatalf("Content filter failed: %v", err)
+		}
+		if result.Annotations["content_safe"] != false {
+			t.Fatalf("Expected the third choice to be flagged, got %v", result.Annotations)
+		}
+
+		result, err = newFilter(t, "redact").ProcessResponse(ctx, newResponse(body, nil))
+		if err != nil {
+			t.Fatalf("Content filter failed: %v", err)
+		}
+		var redacted struct {
+			Choices []struct {
+				Message struct {
+					Content string `json:"content"`
+				} `json:"message"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal(result.ModifiedBody, &redacted); err != nil {
+			t.Fatalf("Failed to parse redacted response: %v", err)
+		}
+		if len(redacted.Choices) != 3 {
+			t.Fatalf("Expected 3 choices after redaction, got %d", len(redacted.Choices))
+		}
+		if content := redacted.Choices[2].Message.Content; strings.Contains(content, "harmful") {
+			t.Errorf("Expected third choice to be redacted, got %q", content)
+		}
+		if content := redacted.Choices[0].Message.Content; content != "a friendly answer" {
+			t.Errorf("Expected first choice to be unchanged, got %q", content)
+		}
+	})
+
+	newTracker := func(t *testing.T) *costtracker.CostTracker {
+		ct := costtracker.NewCostTracker(sugar)
+		if err := ct.Initialize(ctx, &interfaces.ModuleConfig{Name: "cost-tracker", Enabled: true}); err != nil {
+			t.Fatalf("Failed to initialize cost tracker: %v", err)
+		}
+		return ct
+	}
+
+	t.Run("AggregateUsageIsTracked", func(t *testing.T) {
+		ct := newTracker(t)
+		// OpenAI reports completion tokens summed over all choices
+		usage := &interfaces.TokenUsage{PromptTokens: 1000, CompletionTokens: 3000, TotalTokens: 4000}
+		result, err := ct.ProcessResponse(ctx, newResponse(body, usage))
+		if err != nil {
+			t.Fatalf("Cost tracker failed: %v", err)
+		}
+		if result.Annotations["response_choices"] != 3 {
+			t.Errorf("Expected 3 response choices, got %v", result.Annotations["response_choices"])
+		}
+
+		expected := 1000.0/1000*0.0015 + 3000.0/1000*0.002
+		usageSummary, err := ct.GetTenantUsage("tenant-a")
+		if err != nil {
+			t.Fatalf("Failed to get usage: %v", err)
+		}
+		if math.Abs(usageSummary.TotalCost-expected) > 1e-9 {
+			t.Errorf("Expected tracked cost %f, got %f", expected, usageSummary.TotalCost)
+		}
+	})
+
+	t.Run("EstimateCoversEveryChoice", func(t *testing.T) {
+		answer := strings.Repeat("word ", 200)
+		single, err := newTracker(t).ProcessResponse(ctx, newResponse(choicesBody(t, answer), nil))
+		if err != nil {
+			t.Fatalf("Cost tracker failed: %v", err)
+		}
+		multiple, err := newTracker(t).ProcessResponse(ctx, newResponse(choicesBody(t, answer, answer, answer), nil))
+		if err != nil {
+			t.Fatalf("Cost tracker failed: %v", err)
+		}
+
+		singleCost := single.Annotations["actual_cost_usd"].(float64)
+		multipleCost := multiple.Annotations["actual_cost_usd"].(float64)
+		if singleCost <= 0 || math.Abs(multipleCost-3*singleCost) > singleCost*0.01 {
+			t.Errorf("Expected 3 choices to cost three times one choice, got %f and %f", singleCost, multipleCost)
+		}
+	})
+}
@@ -0,0 +1,226 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/circuitbreaker"
+	"github.com/bendiamant/leash-gateway/internal/metrics"
+	"github.com/bendiamant/leash-gateway/internal/providers"
+	"github.com/bendiamant/leash-gateway/internal/providers/base"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestCircuitBreakerHalfOpenProbes(t *testing.T) {
+	const resetTimeout = 50 * time.Millisecond
+
+	// newHalfOpenBreaker trips a breaker and waits until its next call probes
+	newHalfOpenBreaker := func(t *testing.T, probes int) *circuitbreaker.CircuitBreaker {
+		cb := circuitbreaker.NewCircuitBreaker(circuitbreaker.Config{
+			Name:           "probe-test",
+			MaxFailures:    50,
+			MinRequests:    10,
+			ResetTimeout:   resetTimeout,
+			HalfOpenProbes: probes,
+		})
+		for i := 0; i < 10; i++ {
+			cb.Call(func() error { return fmt.Errorf("provider down") })
+		}
+		if cb.GetState() != circuitbreaker.StateOpen {
+			t.Fatalf("Expected breaker to be open, got %s", cb.GetState())
+		}
+		time.Sleep(resetTimeout + 10*time.Millisecond)
+		return cb
+	}
+
+	// startProbes starts n calls that block until their result is sent
+	startProbes := func(cb *circuitbreaker.CircuitBreaker, n int) ([]chan error, chan error) {
+		results := make([]chan error, n)
+		done := make(chan error, n)
+		for i := range results {
+			results[i] = make(chan error)
+			started := make(chan struct{})
+			go func(result chan error) {
+				done <- cb.Call(func() error {
+					close(started)
+					return <-result
+				})
+			}(results[i])
+			<-started
+		}
+		return results, done
+	}
+
+	rejected := func(cb *circuitbreaker.CircuitBreaker) bool {
+		called := false
+		cb.Call(func() error {
+			called = true
+			return nil
+		})
+		return !called
+	}
+
+	t.Run("OnlyConfiguredProbesAdmitted", func(t *testing.T) {
+		cb := newHalfOpenBreaker(t, 2)
+		results, done := startProbes(cb, 2)
+
+		if cb.GetState() != circuitbreaker.StateHalfOpen {
+			t.Fatalf("Expected breaker to be half-open, got %s", cb.GetState())
+		}
+		for i := 0; i < 5; i++ {
+			if !rejected(cb) {
+				t.Fatalf("Expected call %d beyond the probe limit to be rejected", i+1)
+			}
+		}
+
+		// A successful probe closes the breaker and admits everything again
+		results[0] <- nil
+		<-done
+		if cb.GetState() != circuitbreaker.StateClosed {
+			t.Fatalf("Expected successful probe to close the breaker, got %s", cb.GetState())
+		}
+		if rejected(cb) {
+			t.Error("Expected calls to be admitted once the breaker closed")
+		}
+		results[1] <- nil
+		<-done
+	})
+
+	t.Run("FailedProbeReopens", func(t *testing.T) {
+		cb := newHalfOpenBreaker(t, 1)
+		results, done := startProbes(cb, 1)
+
+		if !rejected(cb) {
+			t.Fatal("Expected a second concurrent call to be rejected with the default limit")
+		}
+
+		results[0] <- fmt.Errorf("still down")
+		<-done
+		if cb.GetState() != circuitbreaker.StateOpen {
+			t.Fatalf("Expected failed probe to reopen the breaker, got %s", cb.GetState())
+		}
+		if !rejected(cb) {
+			t.Error("Expected calls to be rejected after the breaker reopened")
+		}
+
+		// After another reset timeout a new probe is admitted
+		time.Sleep(resetTimeout + 10*time.Millisecond)
+		if rejected(cb) {
+			t.Error("Expected a new probe after the reset timeout")
+		}
+		if cb.GetState() != circuitbreaker.StateClosed {
+			t.Errorf("Expected successful probe to close the breaker, got %s", cb.GetState())
+		}
+	})
+
+	t.Run("DefaultsToOneProbe", func(t *testing.T) {
+		cb := newHalfOpenBreaker(t, 0)
+		results, done := startProbes(cb, 1)
+		if !rejected(cb) {
+			t.Error("Expected a single probe by default")
+		}
+		results[0] <- nil
+		<-done
+	})
+}
+
+func TestCircuitBreakerTransitionEvents(t *testing.T) {
+	t.Run("TripCarriesStats", func(t *testing.T) {
+		transitions := make(chan circuitbreaker.Transition, 10)
+		cb := circuitbreaker.NewCircuitBreaker(circuitbreaker.Config{
+			Name:         "upstream",
+			MaxFailures:  50,
+			MinRequests:  10,
+			ResetTimeout: time.Hour,
+			ErrorSamples: 3,
+			OnTransition: func(transition circuitbreaker.Transition) { transitions <- transition },
+		})
+		for i := 0; i < 4; i++ {
+			cb.Call(func() error { return nil })
+		}
+		for i := 1; i <= 6; i++ {
+			cb.Call(func() error { return fmt.Errorf("upstream returned 503 (%d)", i) })
+		}
+
+		var trip circuitbreaker.Transition
+		select {
+		case trip = <-transitions:
+		case <-time.After(time.Second):
+			t.Fatal("Expected a transition event when the breaker tripped")
+		}
+		if trip.Name != "upstream" || trip.From != circuitbreaker.StateClosed || trip.To != circuitbreaker.StateOpen {
+			t.Fatalf("Expected upstream closed -> open, got %s %s -> %s", trip.Name, trip.From, trip.To)
+		}
+		if trip.Stats.Requests != 10 || trip.Stats.Failures != 6 || trip.Stats.FailureRate != 0.6 {
+			t.Errorf("Expected 6 of 10 requests failed at trip time, got %+v", trip.Stats)
+		}
+		if len(trip.RecentErrors) != 3 || trip.RecentErrors[2].Error != "upstream returned 503 (6)" || trip.RecentErrors[0].Error != "upstream returned 503 (4)" {
+			t.Errorf("Expected the last three errors sampled, got %+v", trip.RecentErrors)
+		}
+	})
+
+	t.Run("ProviderTripLoggedAndCounted", func(t *testing.T) {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error":{"message":"internal failure"}}`))
+		}))
+		defer upstream.Close()
+
+		core, logs := observer.New(zap.InfoLevel)
+		metricsRegistry := metrics.NewRegistry()
+		registry := providers.NewRegistry(zap.New(core).Sugar())
+		registry.SetMetrics(metricsRegistry)
+		if err := registry.InitializeFromConfig(map[string]*base.ProviderConfig{
+			"openai": {
+				Type:           "openai",
+				Endpoint:       upstream.URL,
+				Timeout:        time.Second,
+				CircuitBreaker: base.CircuitBreakerConfig{FailureThreshold: 50, MinRequests: 4, Timeout: time.Hour},
+				Models:         []base.ModelConfig{{Name: "gpt-4o-mini"}},
+			},
+		}); err != nil {
+			t.Fatalf("Failed to initialize providers: %v", err)
+		}
+		for i := 0; i < 4; i++ {
+			registry.RouteRequest(context.Background(), &base.ProviderRequest{
+				RequestID: fmt.Sprintf("trip-%d", i),
+				Model:     "gpt-4o-mini",
+				Messages:  []base.Message{{Role: "user", Content: "hi"}},
+			})
+		}
+
+		deadline := time.Now().Add(time.Second)
+		for logs.FilterMessage("Circuit breaker opened").Len() == 0 && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		opened := logs.FilterMessage("Circuit breaker opened").All()
+		if len(opened) != 1 {
+			t.Fatalf("Expected one structured log of the trip, got %d", len(opened))
+		}
+		fields := opened[0].ContextMap()
+		if fields["breaker"] != "openai" || fields["failure_rate"] != 1.0 || fields["requests"] != int64(4) || fields["failures"] != int64(4) {
+			t.Errorf("Expected the trip's failure rate and counts logged, got %v", fields)
+		}
+		if samples, _ := fields["recent_errors"].([]interface{}); len(samples) != 4 {
+			t.Errorf("Expected the four errors sampled, got %v", fields["recent_errors"])
+		}
+		for time.Now().Before(deadline) && testutil.ToFloat64(metricsRegistry.CircuitBreakerTransitions.WithLabelValues("openai", "closed", "open")) == 0 {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if tripped := testutil.ToFloat64(metricsRegistry.CircuitBreakerTransitions.WithLabelValues("openai", "closed", "open")); tripped != 1 {
+			t.Errorf("Expected one closed -> open transition recorded, got %v", tripped)
+		}
+		if state := testutil.ToFloat64(metricsRegistry.CircuitBreakerState.WithLabelValues("openai")); state != 1 {
+			t.Errorf("Expected the state gauge to show open, got %v", state)
+		}
+	})
+}
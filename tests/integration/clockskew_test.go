@@ -0,0 +1,128 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/core/clockskew"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"go.uber.org/zap"
+)
+
+// recordingNonceStore is a shared nonce store recording what it was given
+type recordingNonceStore struct {
+	seen map[string]bool
+}
+
+func (s *recordingNonceStore) Remember(nonce string, expiry time.Time) bool {
+	if s.seen[nonce] {
+		return false
+	}
+	s.seen[nonce] = true
+	return true
+}
+
+func TestClockSkewPolicy(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	newPolicy := func(t *testing.T, config map[string]interface{}) *clockskew.ClockSkew {
+		policy := clockskew.NewClockSkew(sugar)
+		moduleConfig := &interfaces.ModuleConfig{Name: "clock-skew", Enabled: true, Config: config}
+		if err := policy.ValidateConfig(moduleConfig); err != nil {
+			t.Fatalf("Invalid config: %v", err)
+		}
+		policy.Initialize(ctx, moduleConfig)
+		policy.Start(ctx)
+		return policy
+	}
+	send := func(t *testing.T, policy *clockskew.ClockSkew, headers map[string]string) *interfaces.ProcessRequestResult {
+		t.Helper()
+		result, err := policy.ProcessRequest(ctx, &interfaces.ProcessRequestContext{
+			RequestID: "skew",
+			TenantID:  "tenant-a",
+			Headers:   headers,
+		})
+		if err != nil {
+			t.Fatalf("Policy failed: %v", err)
+		}
+		return result
+	}
+	unix := func(offset time.Duration) string {
+		return strconv.FormatInt(time.Now().Add(offset).Unix(), 10)
+	}
+
+	policy := newPolicy(t, map[string]interface{}{"max_skew": "1m"})
+
+	t.Run("InWindowTimestampsPass", func(t *testing.T) {
+		for _, value := range []string{
+			unix(0),
+			unix(-50 * time.Second),
+			unix(50 * time.Second),
+			time.Now().Add(-30 * time.Second).UTC().Format(time.RFC3339),
+		} {
+			if result := send(t, policy, map[string]string{"x-leash-timestamp": value}); result.Action != interfaces.ActionContinue {
+				t.Errorf("Timestamp %s: expected continue, got %s (%s)", value, result.Action, result.BlockReason)
+			}
+		}
+	})
+
+	t.Run("OutOfWindowTimestampsBlocked", func(t *testing.T) {
+		cases := map[string]string{
+			unix(-2 * time.Minute): "stale_timestamp",
+			unix(2 * time.Minute):  "future_timestamp",
+			"yesterday":            "invalid_timestamp",
+		}
+		for value, violation := range cases {
+			result := send(t, policy, map[string]string{"x-leash-timestamp": value})
+			if result.Action != interfaces.ActionBlock || result.Annotations["clock_skew_violation"] != violation {
+				t.Errorf("Timestamp %s: expected %s block, got %s %v", value, violation, result.Action, result.Annotations)
+			}
+			if result.Metadata["status_code"] != "401" {
+				t.Errorf("Timestamp %s: expected status 401, got %v", value, result.Metadata)
+			}
+		}
+	})
+
+	t.Run("MissingTimestamp", func(t *testing.T) {
+		if result := send(t, policy, nil); result.Action != interfaces.ActionContinue {
+			t.Errorf("Expected requests without a timestamp to pass by default, got %s", result.Action)
+		}
+		strict := newPolicy(t, map[string]interface{}{"require_timestamp": true})
+		if result := send(t, strict, nil); result.Action != interfaces.ActionBlock {
+			t.Errorf("Expected a missing timestamp to be blocked when required, got %s", result.Action)
+		}
+	})
+
+	t.Run("ReplayedNonceBlocked", func(t *testing.T) {
+		store := &recordingNonceStore{seen: map[string]bool{}}
+		replay := newPolicy(t, map[string]interface{}{"nonce_header": "X-Leash-Nonce"})
+		replay.SetNonceStore(store)
+
+		headers := map[string]string{"x-leash-timestamp": unix(0), "x-leash-nonce": "abc"}
+		if result := send(t, replay, headers); result.Action != interfaces.ActionContinue {
+			t.Fatalf("Expected first use of a nonce to pass, got %s", result.Action)
+		}
+		if result := send(t, replay, headers); result.Annotations["clock_skew_violation"] != "replayed_nonce" {
+			t.Errorf("Expected replayed nonce to be blocked, got %s %v", result.Action, result.Annotations)
+		}
+		if !store.seen["tenant-a:abc"] {
+			t.Errorf("Expected the shared nonce store to be used, got %v", store.seen)
+		}
+	})
+
+	t.Run("InvalidSkewRejected", func(t *testing.T) {
+		for _, maxSkew := range []string{"soon", "0s"} {
+			err := policy.ValidateConfig(&interfaces.ModuleConfig{Config: map[string]interface{}{"max_skew": maxSkew}})
+			if err == nil {
+				t.Errorf("Expected max_skew %q to be rejected", maxSkew)
+			}
+		}
+	})
+}
@@ -0,0 +1,885 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/core/contentfilter"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/redactionaudit"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"go.uber.org/zap"
+)
+
+// chatBody builds a single-message chat request body
+func chatBody(t testing.TB, content string) []byte {
+	t.Helper()
+
+	body, err := json.Marshal(map[string]interface{}{
+		"model":    "gpt-4o-mini",
+		"messages": []map[string]string{{"role": "user", "content": content}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal body: %v", err)
+	}
+	return body
+}
+
+func TestContentFilterUnicodeNormalization(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	newFilter := func(normalize bool) *contentfilter.ContentFilter {
+		filter := contentfilter.NewContentFilter(sugar)
+		err := filter.Initialize(ctx, &interfaces.ModuleConfig{
+			Name: "content-filter",
+			Config: map[string]interface{}{
+				"blocked_keywords":  []interface{}{"harmful"},
+				"action":            "block",
+				"normalize_unicode": normalize,
+			},
+		})
+		if err != nil {
+			t.Fatalf("Failed to initialize content filter: %v", err)
+		}
+		return filter
+	}
+
+	variants := map[string]string{
+		"ZeroWidthSpace":   "this is harm\u200bful content",
+		"ZeroWidthJoiner":  "h\u200da\u200dr\u200dm\u200df\u200du\u200dl",
+		"SoftHyphen":       "harm\u00adful",
+		"CyrillicA":        "this is h\u0430rmful content",
+		"GreekAndCyrillic": "\u04bb\u0430rmf\u03c5l",
+		"Fullwidth":        "\uff48\uff41\uff52\uff4d\uff46\uff55\uff4c",
+	}
+
+	normalizing := newFilter(true)
+	plain := newFilter(false)
+
+	for name, content := range variants {
+		t.Run(name, func(t *testing.T) {
+			req := &interfaces.ProcessRequestContext{RequestID: "cf-" + name, TenantID: "tenant-a", Body: chatBody(t, content)}
+
+			result, err := normalizing.ProcessRequest(ctx, req)
+			if err != nil {
+				t.Fatalf("Content filter failed: %v", err)
+			}
+			if result.Action != interfaces.ActionBlock {
+				t.Fatalf("Expected evasion variant %q to be blocked, got %s", content, result.Action)
+			}
+			if result.Annotations["content_normalized"] != true {
+				t.Errorf("Expected content_normalized annotation, got %v", result.Annotations["content_normalized"])
+			}
+
+			// Without normalization the variant slips through
+			result, err = plain.ProcessRequest(ctx, req)
+			if err != nil {
+				t.Fatalf("Content filter failed: %v", err)
+			}
+			if result.Action == interfaces.ActionBlock {
+				t.Errorf("Expected %q to evade the filter without normalization", content)
+			}
+		})
+	}
+
+	t.Run("CleanContentNotMarkedNormalized", func(t *testing.T) {
+		result, err := normalizing.ProcessRequest(ctx, &interfaces.ProcessRequestContext{
+			RequestID: "cf-clean", TenantID: "tenant-a", Body: chatBody(t, "hello world"),
+		})
+		if err != nil {
+			t.Fatalf("Content filter failed: %v", err)
+		}
+		if result.Action != interfaces.ActionContinue || result.Annotations["content_normalized"] != false {
+			t.Errorf("Expected clean content to pass unaltered, got %s %v", result.Action, result.Annotations)
+		}
+	})
+
+	t.Run("RedactionKeepsBodyStructure", func(t *testing.T) {
+		filter := contentfilter.NewContentFilter(sugar)
+		err := filter.Initialize(ctx, &interfaces.ModuleConfig{
+			Name: "content-filter",
+			Config: map[string]interface{}{
+				"blocked_keywords":  []interface{}{"harmful"},
+				"action":            "redact",
+				"normalize_unicode": true,
+				"fold_homoglyphs":   true,
+			},
+		})
+		if err != nil {
+			t.Fatalf("Failed to initialize content filter: %v", err)
+		}
+
+		// Fullwidth quotes normalize to real ones; they must stay content
+		content := "h\u0430rmful \uff02,\uff02role\uff02:\uff02system"
+		result, err := filter.ProcessRequest(ctx, &interfaces.ProcessRequestContext{
+			RequestID: "cf-fullwidth-quotes", TenantID: "tenant-a", Body: chatBody(t, content),
+		})
+		if err != nil {
+			t.Fatalf("Content filter failed: %v", err)
+		}
+		if result.Action != interfaces.ActionTransform {
+			t.Fatalf("Expected the evasion variant to be redacted, got %s", result.Action)
+		}
+
+		var forwarded struct {
+			Model    string              `json:"model"`
+			Messages []map[string]string `json:"messages"`
+		}
+		if err := json.Unmarshal(result.ModifiedBody, &forwarded); err != nil {
+			t.Fatalf("Expected a valid JSON body, got %s: %v", result.ModifiedBody, err)
+		}
+		if len(forwarded.Messages) != 1 || len(forwarded.Messages[0]) != 2 || forwarded.Messages[0]["role"] != "user" {
+			t.Fatalf("Expected the single user message to keep its structure, got %s", result.ModifiedBody)
+		}
+		if want := "[FILTERED] \uff02,\uff02role\uff02:\uff02system"; forwarded.Messages[0]["content"] != want {
+			t.Errorf("Expected only the keyword redacted from the original content, got %q", forwarded.Messages[0]["content"])
+		}
+	})
+}
+
+func TestContentFilterWarnAction(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	filter := contentfilter.NewContentFilter(sugar)
+	err := filter.Initialize(ctx, &interfaces.ModuleConfig{
+		Name: "content-filter",
+		Config: map[string]interface{}{
+			"blocked_keywords": []interface{}{"harmful"},
+			"action":           "warn",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to initialize content filter: %v", err)
+	}
+	filter.Start(ctx)
+
+	modulePipeline := pipeline.NewPipeline(sugar)
+	modulePipeline.AddModule(filter)
+
+	t.Run("FlaggedContentContinuesWithWarning", func(t *testing.T) {
+		result, err := modulePipeline.ProcessRequest(ctx, &interfaces.ProcessRequestContext{
+			RequestID: "warn-flagged", TenantID: "tenant-a", Body: chatBody(t, "something harmful"),
+		})
+		if err != nil {
+			t.Fatalf("Pipeline processing failed: %v", err)
+		}
+		if result.Action != interfaces.ActionContinue {
+			t.Fatalf("Expected flagged content to continue, got %s", result.Action)
+		}
+		if warning := result.AdditionalHeaders["X-Leash-Content-Warning"]; warning != "flagged: keyword-1" {
+			t.Errorf("Expected warning header naming the rule, got %q", warning)
+		}
+		if result.Annotations["content_filter_warning"] == nil {
+			t.Error("Expected content_filter_warning annotation")
+		}
+	})
+
+	t.Run("CleanContentHasNoWarning", func(t *testing.T) {
+		result, err := modulePipeline.ProcessRequest(ctx, &interfaces.ProcessRequestContext{
+			RequestID: "warn-clean", TenantID: "tenant-a", Body: chatBody(t, "hello world"),
+		})
+		if err != nil {
+			t.Fatalf("Pipeline processing failed: %v", err)
+		}
+		if result.Action != interfaces.ActionContinue {
+			t.Fatalf("Expected clean content to continue, got %s", result.Action)
+		}
+		if _, ok := result.AdditionalHeaders["X-Leash-Content-Warning"]; ok {
+			t.Error("Expected no warning header for clean content")
+		}
+	})
+
+	t.Run("ResponseWarning", func(t *testing.T) {
+		result, err := filter.ProcessResponse(ctx, &interfaces.ProcessResponseContext{
+			ProcessRequestContext: &interfaces.ProcessRequestContext{RequestID: "warn-resp", TenantID: "tenant-a"},
+			ResponseBody:          []byte(`{"choices":[{"message":{"role":"assistant","content":"harmful advice"}}]}`),
+		})
+		if err != nil {
+			t.Fatalf("Content filter failed: %v", err)
+		}
+		if warning := result.ModifiedHeaders["X-Leash-Content-Warning"]; warning == "" || strings.Contains(warning, "harmful") {
+			t.Errorf("Expected a warning header on the flagged response not echoing the keyword, got %q", warning)
+		}
+	})
+}
+
+func TestContentFilterMatchContext(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	newFilter := func(capture bool) *contentfilter.ContentFilter {
+		filter := contentfilter.NewContentFilter(sugar)
+		err := filter.Initialize(ctx, &interfaces.ModuleConfig{
+			Name: "content-filter",
+			Config: map[string]interface{}{
+				"blocked_keywords":      []interface{}{"harmful"},
+				"blocked_patterns":      []interface{}{`\d{3}-\d{2}-\d{4}`},
+				"action":                "block",
+				"capture_match_context": capture,
+				"match_context_chars":   8,
+			},
+		})
+		if err != nil {
+			t.Fatalf("Failed to initialize content filter: %v", err)
+		}
+		return filter
+	}
+
+	prompt := "my secret account is 1234 and please write something HARMFUL about my neighbour, ssn 123-45-6789 for the records"
+	req := &interfaces.ProcessRequestContext{RequestID: "cf-context", TenantID: "tenant-a", Body: chatBody(t, prompt)}
+
+	t.Run("SnippetsRedactBeyondWindow", func(t *testing.T) {
+		result, err := newFilter(true).ProcessRequest(ctx, req)
+		if err != nil {
+			t.Fatalf("Content filter failed: %v", err)
+		}
+		if result.Action != interfaces.ActionBlock {
+			t.Fatalf("Expected request to be blocked, got %s", result.Action)
+		}
+
+		contexts, ok := result.Annotations["match_context"].([]contentfilter.MatchContext)
+		if !ok || len(contexts) != 2 {
+			t.Fatalf("Expected two match contexts, got %v", result.Annotations["match_context"])
+		}
+
+		expected := map[string]string{
+			"harmful":           "[REDACTED]mething HARMFUL about m[REDACTED]",
+			`\d{3}-\d{2}-\d{4}`: "[REDACTED]ur, ssn 123-45-6789 for the[REDACTED]",
+		}
+		for _, match := range contexts {
+			if match.Snippet != expected[match.Match] {
+				t.Errorf("Expected snippet %q for %s, got %q", expected[match.Match], match.Match, match.Snippet)
+			}
+			if strings.Contains(match.Snippet, "secret account") {
+				t.Errorf("Snippet for %s leaks content outside the window: %q", match.Match, match.Snippet)
+			}
+		}
+	})
+
+	t.Run("DisabledByDefault", func(t *testing.T) {
+		result, err := newFilter(false).ProcessRequest(ctx, req)
+		if err != nil {
+			t.Fatalf("Content filter failed: %v", err)
+		}
+		if _, ok := result.Annotations["match_context"]; ok {
+			t.Errorf("Expected no match context without capture, got %v", result.Annotations["match_context"])
+		}
+	})
+
+	t.Run("NegativeWindowRejected", func(t *testing.T) {
+		err := contentfilter.NewContentFilter(sugar).ValidateConfig(&interfaces.ModuleConfig{
+			Name:   "content-filter",
+			Config: map[string]interface{}{"match_context_chars": -1},
+		})
+		if err == nil {
+			t.Error("Expected negative match_context_chars to be rejected")
+		}
+	})
+}
+
+func TestContentFilterSeverityBands(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	band := func(minConfidence float64, action string) map[string]interface{} {
+		return map[string]interface{}{"min_confidence": minConfidence, "action": action}
+	}
+	confidence := func(match string, confidence float64) map[string]interface{} {
+		return map[string]interface{}{"match": match, "confidence": confidence}
+	}
+	config := map[string]interface{}{
+		"blocked_keywords": []interface{}{"trivial", "mild", "rude", "edgy", "nasty", "vile"},
+		// Listed out of order; bands apply from the highest reached
+		"severity_bands": []interface{}{
+			band(0.6, "warn"),
+			band(0.3, "annotate"),
+			band(0.95, "block"),
+			band(0.8, "redact"),
+		},
+		"match_confidence": []interface{}{
+			confidence("trivial", 0.1),
+			confidence("mild", 0.35),
+			confidence("rude", 0.65),
+			confidence("edgy", 0.6),
+			confidence("nasty", 0.85),
+			confidence("vile", 0.97),
+		},
+	}
+
+	filter := contentfilter.NewContentFilter(sugar)
+	if err := filter.ValidateConfig(&interfaces.ModuleConfig{Name: "content-filter", Config: config}); err != nil {
+		t.Fatalf("Expected severity bands to validate, got %v", err)
+	}
+	if err := filter.Initialize(ctx, &interfaces.ModuleConfig{Name: "content-filter", Config: config}); err != nil {
+		t.Fatalf("Failed to initialize content filter: %v", err)
+	}
+	filter.Start(ctx)
+
+	for _, tc := range []struct {
+		keyword string
+		action  string // annotated action; empty when no band is reached
+		result  interfaces.Action
+	}{
+		{"trivial", "", interfaces.ActionContinue},
+		{"mild", "annotate", interfaces.ActionContinue},
+		{"edgy", "warn", interfaces.ActionContinue},
+		{"rude", "warn", interfaces.ActionContinue},
+		{"nasty", "redact", interfaces.ActionTransform},
+		{"vile", "block", interfaces.ActionBlock},
+	} {
+		t.Run(tc.keyword, func(t *testing.T) {
+			result, err := filter.ProcessRequest(ctx, &interfaces.ProcessRequestContext{
+				RequestID: "band-" + tc.keyword, TenantID: "tenant-a", Body: chatBody(t, "that was "+tc.keyword),
+			})
+			if err != nil {
+				t.Fatalf("Content filter failed: %v", err)
+			}
+			if result.Action != tc.result {
+				t.Errorf("Expected %s, got %s", tc.result, result.Action)
+			}
+			if action, _ := result.Annotations["action"].(string); action != tc.action {
+				t.Errorf("Expected action annotation %q, got %q", tc.action, action)
+			}
+			if _, warned := result.AdditionalHeaders["X-Leash-Content-Warning"]; warned != (tc.action == "warn") {
+				t.Errorf("Expected a warning header only for the warn band, got %v", result.AdditionalHeaders)
+			}
+			if tc.action == "redact" && strings.Contains(string(result.ModifiedBody), tc.keyword) {
+				t.Errorf("Expected %s redacted, got %s", tc.keyword, result.ModifiedBody)
+			}
+		})
+	}
+
+	t.Run("HighestMatchDecides", func(t *testing.T) {
+		result, err := filter.ProcessRequest(ctx, &interfaces.ProcessRequestContext{
+			RequestID: "band-mixed", TenantID: "tenant-a", Body: chatBody(t, "mild but vile"),
+		})
+		if err != nil {
+			t.Fatalf("Content filter failed: %v", err)
+		}
+		if result.Action != interfaces.ActionBlock {
+			t.Errorf("Expected the most severe match to block, got %s", result.Action)
+		}
+	})
+
+	t.Run("InvalidBandRejected", func(t *testing.T) {
+		for _, bands := range [][]interface{}{
+			{band(1.5, "block")},
+			{band(0.5, "quarantine")},
+		} {
+			err := filter.ValidateConfig(&interfaces.ModuleConfig{
+				Name:   "content-filter",
+				Config: map[string]interface{}{"severity_bands": bands},
+			})
+			if err == nil {
+				t.Errorf("Expected severity bands %v to be rejected", bands)
+			}
+		}
+	})
+}
+
+func TestContentFilterAdaptiveThreshold(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	config := map[string]interface{}{
+		"blocked_keywords":   []interface{}{"edgy", "vile"},
+		"severity_threshold": 0.8,
+		"match_confidence": []interface{}{
+			map[string]interface{}{"match": "edgy", "confidence": 0.83},
+			map[string]interface{}{"match": "vile", "confidence": 0.97},
+		},
+		"adaptive_threshold": map[string]interface{}{
+			"enabled":       true,
+			"max_threshold": 0.9,
+			"step":          0.02,
+		},
+	}
+	filter := contentfilter.NewContentFilter(sugar)
+	if err := filter.ValidateConfig(&interfaces.ModuleConfig{Name: "content-filter", Config: config}); err != nil {
+		t.Fatalf("Expected the adaptive threshold to validate, got %v", err)
+	}
+	if err := filter.Initialize(ctx, &interfaces.ModuleConfig{Name: "content-filter", Config: config}); err != nil {
+		t.Fatalf("Failed to initialize content filter: %v", err)
+	}
+	filter.Start(ctx)
+
+	check := func(t *testing.T, tenantID, content string, annotations map[string]interface{}) interfaces.Action {
+		t.Helper()
+		result, err := filter.ProcessRequest(ctx, &interfaces.ProcessRequestContext{
+			RequestID: "adaptive-" + tenantID, TenantID: tenantID, Body: chatBody(t, content), Annotations: annotations,
+		})
+		if err != nil {
+			t.Fatalf("Content filter failed: %v", err)
+		}
+		return result.Action
+	}
+	feedback := func(value string) map[string]interface{} {
+		return map[string]interface{}{contentfilter.DefaultFeedbackAnnotation: value}
+	}
+
+	t.Run("FalsePositivesRaiseThresholdWithinBounds", func(t *testing.T) {
+		if action := check(t, "noisy", "that was edgy", nil); action != interfaces.ActionBlock {
+			t.Fatalf("Expected borderline content blocked at the base threshold, got %s", action)
+		}
+
+		// Two false positives reported by review lift the threshold past 0.83
+		check(t, "noisy", "hello", feedback(contentfilter.FeedbackFalsePositive))
+		if action := check(t, "noisy", "that was edgy", feedback(contentfilter.FeedbackFalsePositive)); action != interfaces.ActionContinue {
+			t.Errorf("Expected borderline content allowed after false positives, got %s", action)
+		}
+		if threshold := filter.Threshold("noisy"); math.Abs(threshold-0.84) > 1e-9 {
+			t.Errorf("Expected threshold 0.84, got %v", threshold)
+		}
+
+		// ...but never past max_threshold
+		for i := 0; i < 20; i++ {
+			if _, err := filter.RecordFeedback("noisy", contentfilter.FeedbackFalsePositive); err != nil {
+				t.Fatalf("Failed to record feedback: %v", err)
+			}
+		}
+		if threshold := filter.Threshold("noisy"); threshold != 0.9 {
+			t.Errorf("Expected the threshold capped at 0.9, got %v", threshold)
+		}
+
+		// Other tenants keep the base threshold
+		if action := check(t, "quiet", "that was edgy", nil); action != interfaces.ActionBlock {
+			t.Errorf("Expected other tenants unaffected, got %s", action)
+		}
+	})
+
+	t.Run("ClearViolationsStillBlocked", func(t *testing.T) {
+		if action := check(t, "noisy", "that was vile", nil); action != interfaces.ActionBlock {
+			t.Errorf("Expected content above max_threshold blocked, got %s", action)
+		}
+	})
+
+	t.Run("ConfirmedViolationsLowerThresholdToFloor", func(t *testing.T) {
+		for i := 0; i < 20; i++ {
+			check(t, "noisy", "hello", feedback(contentfilter.FeedbackConfirmed))
+		}
+		if threshold := filter.Threshold("noisy"); threshold != 0.8 {
+			t.Errorf("Expected the threshold floored at severity_threshold, got %v", threshold)
+		}
+		if _, err := filter.RecordFeedback("noisy", "meh"); err == nil {
+			t.Error("Expected unknown feedback to be rejected")
+		}
+	})
+
+	t.Run("InvalidConfigRejected", func(t *testing.T) {
+		for _, config := range []map[string]interface{}{
+			{"adaptive_threshold": map[string]interface{}{"enabled": true, "min_threshold": 0.9, "max_threshold": 0.85}},
+			{"adaptive_threshold": map[string]interface{}{"enabled": true, "step": 0}},
+			{"adaptive_threshold": map[string]interface{}{"enabled": true, "max_threshold": 1.5}},
+			{
+				"adaptive_threshold": map[string]interface{}{"enabled": true},
+				"severity_bands":     []interface{}{map[string]interface{}{"min_confidence": 0.5, "action": "block"}},
+			},
+		} {
+			if err := filter.ValidateConfig(&interfaces.ModuleConfig{Name: "content-filter", Config: config}); err == nil {
+				t.Errorf("Expected %v to be rejected", config)
+			}
+		}
+	})
+}
+
+func TestContentFilterRedactionAudit(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	const secret = "123-45-6789"
+	const hashKey = "audit-hash-key"
+
+	newModules := func(audit bool) (*contentfilter.ContentFilter, *redactionaudit.RedactionAuditor, *syncBuffer) {
+		filter := contentfilter.NewContentFilter(sugar)
+		err := filter.Initialize(ctx, &interfaces.ModuleConfig{
+			Name: "content-filter",
+			Config: map[string]interface{}{
+				"blocked_keywords":         []interface{}{"confidential"},
+				"blocked_patterns":         []interface{}{`\d{3}-\d{2}-\d{4}`},
+				"action":                   "redact",
+				"redaction_audit":          audit,
+				"redaction_audit_hash_key": hashKey,
+			},
+		})
+		if err != nil {
+			t.Fatalf("Failed to initialize content filter: %v", err)
+		}
+		filter.Start(ctx)
+
+		trail := &syncBuffer{}
+		sink := redactionaudit.NewRedactionAuditor(sugar)
+		sink.SetOutput(trail)
+		if err := sink.Initialize(ctx, &interfaces.ModuleConfig{Name: "redaction-audit"}); err != nil {
+			t.Fatalf("Failed to initialize redaction audit: %v", err)
+		}
+		if err := sink.Start(ctx); err != nil {
+			t.Fatalf("Failed to start redaction audit: %v", err)
+		}
+		return filter, sink, trail
+	}
+	newPipeline := func(audit bool) (*pipeline.Pipeline, *syncBuffer) {
+		filter, sink, trail := newModules(audit)
+		p := pipeline.NewPipeline(sugar)
+		p.AddModule(filter)
+		p.AddModule(sink)
+		return p, trail
+	}
+
+	readTrail := func(trail *syncBuffer) (string, []redactionaudit.Record) {
+		trail.mu.Lock()
+		raw := trail.buf.String()
+		trail.mu.Unlock()
+
+		var records []redactionaudit.Record
+		decoder := json.NewDecoder(strings.NewReader(raw))
+		for decoder.More() {
+			var record redactionaudit.Record
+			if err := decoder.Decode(&record); err != nil {
+				t.Fatalf("Invalid redaction audit record: %v", err)
+			}
+			records = append(records, record)
+		}
+		return raw, records
+	}
+
+	mac := hmac.New(sha256.New, []byte(hashKey))
+	mac.Write([]byte(secret))
+	secretHash := hex.EncodeToString(mac.Sum(nil))
+
+	t.Run("RequestRedactionIsAudited", func(t *testing.T) {
+		p, trail := newPipeline(true)
+		body := chatBody(t, "ssn "+secret+" is Confidential")
+		result, err := p.ProcessRequest(ctx, &interfaces.ProcessRequestContext{RequestID: "redact-req", TenantID: "tenant-a", Body: body})
+		if err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		p.Drain(ctx)
+
+		raw, records := readTrail(trail)
+		if strings.Contains(raw, secret) || strings.Contains(raw, "Confidential") {
+			t.Errorf("Expected no redacted text in the audit trail, got %s", raw)
+		}
+		if encoded, _ := json.Marshal(result.Annotations); bytes.Contains(encoded, []byte(secret)) {
+			t.Errorf("Expected no redacted text in the annotations, got %s", encoded)
+		}
+		if len(records) != 2 {
+			t.Fatalf("Expected 2 redaction records, got %d: %s", len(records), raw)
+		}
+
+		record := records[0]
+		if record.Rule != `pattern:\d{3}-\d{2}-\d{4}` || record.OriginalHash != secretHash || record.HashAlgorithm != "hmac-sha256" {
+			t.Errorf("Expected the pattern rule and the keyed hash of the secret, got %+v", record)
+		}
+		if record.Path != "messages.0.content" || record.Offset != len("ssn ") || record.Length != len(secret) {
+			t.Errorf("Expected the secret's location in the message content, got path %q offset %d length %d", record.Path, record.Offset, record.Length)
+		}
+		if record.RequestID != "redact-req" || record.TenantID != "tenant-a" || record.Phase != "request" {
+			t.Errorf("Expected the request's identity and phase, got %+v", record)
+		}
+		if records[1].Rule != "keyword:confidential" {
+			t.Errorf("Expected the keyword rule, got %s", records[1].Rule)
+		}
+	})
+
+	t.Run("ResponseRedactionIsAudited", func(t *testing.T) {
+		filter, sink, trail := newModules(true)
+		resp := &interfaces.ProcessResponseContext{
+			ProcessRequestContext: &interfaces.ProcessRequestContext{RequestID: "redact-resp", TenantID: "tenant-a"},
+			ResponseBody:          []byte(`{"choices":[{"message":{"role":"assistant","content":"your ssn is ` + secret + `"}}]}`),
+		}
+		result, err := filter.ProcessResponse(ctx, resp)
+		if err != nil {
+			t.Fatalf("Content filter failed: %v", err)
+		}
+		resp.Annotations = result.Annotations
+		if _, err := sink.ProcessResponse(ctx, resp); err != nil {
+			t.Fatalf("Redaction audit failed: %v", err)
+		}
+
+		if bytes.Contains(result.ModifiedBody, []byte(secret)) {
+			t.Errorf("Expected the response to be redacted, got %s", result.ModifiedBody)
+		}
+		raw, records := readTrail(trail)
+		if len(records) != 1 || records[0].Phase != "response" || records[0].OriginalHash != secretHash {
+			t.Fatalf("Expected one response redaction record with the secret's hash, got %s", raw)
+		}
+		if strings.Contains(raw, secret) {
+			t.Errorf("Expected no redacted text in the audit trail, got %s", raw)
+		}
+	})
+
+	t.Run("DisabledByDefault", func(t *testing.T) {
+		p, trail := newPipeline(false)
+		_, err := p.ProcessRequest(ctx, &interfaces.ProcessRequestContext{RequestID: "no-audit", TenantID: "tenant-a", Body: chatBody(t, "ssn "+secret)})
+		if err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		p.Drain(ctx)
+
+		if raw, records := readTrail(trail); len(records) != 0 {
+			t.Errorf("Expected no redaction records with the audit disabled, got %s", raw)
+		}
+	})
+}
+
+// keywordFilters builds a content filter for each keyword matcher with the
+// same keywords, using the annotate action so every match is reported
+func keywordFilters(tb testing.TB, sugar *zap.SugaredLogger, keywords []string, config map[string]interface{}) map[string]*contentfilter.ContentFilter {
+	tb.Helper()
+
+	filters := make(map[string]*contentfilter.ContentFilter)
+	for _, matcher := range []string{contentfilter.MatcherLinear, contentfilter.MatcherAhoCorasick} {
+		moduleConfig := map[string]interface{}{"action": "annotate", "keyword_matcher": matcher}
+		for key, value := range config {
+			moduleConfig[key] = value
+		}
+		blocked := make([]interface{}, len(keywords))
+		for i, keyword := range keywords {
+			blocked[i] = keyword
+		}
+		moduleConfig["blocked_keywords"] = blocked
+
+		filter := contentfilter.NewContentFilter(sugar)
+		if err := filter.Initialize(context.Background(), &interfaces.ModuleConfig{Name: "content-filter", Config: moduleConfig}); err != nil {
+			tb.Fatalf("Failed to initialize %s content filter: %v", matcher, err)
+		}
+		filter.Start(context.Background())
+		filters[matcher] = filter
+	}
+	return filters
+}
+
+func TestContentFilterKeywordMatchers(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	// matches runs content through a filter and returns the reported matches
+	matches := func(t *testing.T, filter *contentfilter.ContentFilter, content string) []string {
+		t.Helper()
+		result, err := filter.ProcessRequest(ctx, &interfaces.ProcessRequestContext{RequestID: "matchers", Body: chatBody(t, content)})
+		if err != nil {
+			t.Fatalf("Content filter failed: %v", err)
+		}
+		found, _ := result.Annotations["matches"].([]string)
+		return found
+	}
+	// same checks that both matchers report the same matches for content
+	same := func(t *testing.T, filters map[string]*contentfilter.ContentFilter, content string) []string {
+		t.Helper()
+		linear := matches(t, filters[contentfilter.MatcherLinear], content)
+		automaton := matches(t, filters[contentfilter.MatcherAhoCorasick], content)
+		if !reflect.DeepEqual(linear, automaton) {
+			t.Errorf("Matchers disagree on %q: linear %v, aho-corasick %v", content, linear, automaton)
+		}
+		return automaton
+	}
+
+	t.Run("OverlappingKeywords", func(t *testing.T) {
+		filters := keywordFilters(t, sugar, []string{"hers", "he", "she", "his", "HE", "he", "ushers"}, nil)
+		got := same(t, filters, "The Ushers arrived")
+		if want := []string{"hers", "he", "she", "HE", "he", "ushers"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected %v in keyword order, got %v", want, got)
+		}
+		for _, content := range []string{"this", "h", "hi s", "shhe", "usher", "his hers"} {
+			same(t, filters, content)
+		}
+	})
+
+	t.Run("CaseSensitive", func(t *testing.T) {
+		filters := keywordFilters(t, sugar, []string{"Secret", "secret", "SECRET"}, map[string]interface{}{"case_sensitive": true})
+		if got := same(t, filters, "a secret and a SECRET"); !reflect.DeepEqual(got, []string{"secret", "SECRET"}) {
+			t.Errorf("Expected only exact-case matches, got %v", got)
+		}
+	})
+
+	t.Run("UnicodeKeywords", func(t *testing.T) {
+		filters := keywordFilters(t, sugar, []string{"café", "naïve", "日本", "password"}, map[string]interface{}{"normalize_unicode": true})
+		for _, content := range []string{"CAFÉ au lait", "a na\u00efve plan", "日本語", "pass\u200bword", "cafe", "パスワード"} {
+			same(t, filters, content)
+		}
+		if got := same(t, filters, "pass\u200bword"); !reflect.DeepEqual(got, []string{"password"}) {
+			t.Errorf("Expected normalized content to match, got %v", got)
+		}
+	})
+
+	t.Run("RandomizedAgreement", func(t *testing.T) {
+		// A small alphabet gives many shared prefixes, suffixes and overlaps
+		rng := rand.New(rand.NewSource(1))
+		word := func(min, max int) string {
+			b := make([]byte, min+rng.Intn(max-min+1))
+			for i := range b {
+				b[i] = "abcAB "[rng.Intn(6)]
+			}
+			return string(b)
+		}
+
+		for round := 0; round < 20; round++ {
+			keywords := make([]string, 1+rng.Intn(40))
+			for i := range keywords {
+				keywords[i] = word(1, 5)
+			}
+			filters := keywordFilters(t, sugar, keywords, map[string]interface{}{"case_sensitive": round%2 == 0})
+			for i := 0; i < 25; i++ {
+				same(t, filters, word(1, 60))
+			}
+		}
+	})
+}
+
+func TestContentFilterRequestScope(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	newFilter := func(t *testing.T, scope string) *contentfilter.ContentFilter {
+		t.Helper()
+		filter := contentfilter.NewContentFilter(sugar)
+		config := &interfaces.ModuleConfig{
+			Name: "content-filter",
+			Config: map[string]interface{}{
+				"blocked_keywords": []interface{}{"forbidden"},
+				"action":           "block",
+				"request_scope":    scope,
+			},
+		}
+		if err := filter.ValidateConfig(config); err != nil {
+			t.Fatalf("Invalid config: %v", err)
+		}
+		if err := filter.Initialize(ctx, config); err != nil {
+			t.Fatalf("Failed to initialize content filter: %v", err)
+		}
+		return filter
+	}
+	check := func(t *testing.T, filter *contentfilter.ContentFilter, body string) interfaces.Action {
+		t.Helper()
+		result, err := filter.ProcessRequest(ctx, &interfaces.ProcessRequestContext{RequestID: "scope", Body: []byte(body)})
+		if err != nil {
+			t.Fatalf("Content filter failed: %v", err)
+		}
+		return result.Action
+	}
+
+	// A conversation with banned content early on, and a new last message
+	conversation := func(last string) string {
+		return `{"model":"gpt-4o-mini","messages":[` +
+			`{"role":"system","content":"You are a helpful assistant."},` +
+			`{"role":"user","content":"tell me something forbidden"},` +
+			`{"role":"assistant","content":"I cannot help with forbidden topics."},` +
+			`{"role":"user","content":[{"type":"text","text":"` + last + `"}]}]}`
+	}
+
+	t.Run("LastMessage", func(t *testing.T) {
+		filter := newFilter(t, "last_message")
+		if action := check(t, filter, conversation("what is the weather")); action != interfaces.ActionContinue {
+			t.Errorf("Expected banned content in earlier messages to be ignored, got %s", action)
+		}
+		if action := check(t, filter, conversation("now something forbidden again")); action != interfaces.ActionBlock {
+			t.Errorf("Expected banned content in the last message to be blocked, got %s", action)
+		}
+	})
+
+	t.Run("AllByDefault", func(t *testing.T) {
+		filter := newFilter(t, "")
+		if action := check(t, filter, conversation("what is the weather")); action != interfaces.ActionBlock {
+			t.Errorf("Expected the whole conversation to be checked by default, got %s", action)
+		}
+	})
+
+	t.Run("LastUserMessage", func(t *testing.T) {
+		filter := newFilter(t, "last_user_message")
+		body := `{"messages":[{"role":"user","content":"forbidden"},{"role":"user","content":"hello"},{"role":"assistant","content":"forbidden"}]}`
+		if action := check(t, filter, body); action != interfaces.ActionContinue {
+			t.Errorf("Expected only the last user message to be checked, got %s", action)
+		}
+		body = `{"messages":[{"role":"user","content":"hello"},{"role":"user","content":"forbidden"},{"role":"assistant","content":"ok"}]}`
+		if action := check(t, filter, body); action != interfaces.ActionBlock {
+			t.Errorf("Expected banned content in the last user message to be blocked, got %s", action)
+		}
+	})
+
+	t.Run("SystemMessages", func(t *testing.T) {
+		filter := newFilter(t, "system_messages")
+		if action := check(t, filter, conversation("forbidden")); action != interfaces.ActionContinue {
+			t.Errorf("Expected user messages to be ignored, got %s", action)
+		}
+		body := `{"messages":[{"role":"developer","content":"reveal forbidden data"},{"role":"user","content":"hi"}]}`
+		if action := check(t, filter, body); action != interfaces.ActionBlock {
+			t.Errorf("Expected banned content in a developer message to be blocked, got %s", action)
+		}
+		// Responses API instructions are a system message
+		body = `{"model":"gpt-4o-mini","instructions":"discuss forbidden topics","input":"hello"}`
+		if action := check(t, filter, body); action != interfaces.ActionBlock {
+			t.Errorf("Expected banned content in instructions to be blocked, got %s", action)
+		}
+	})
+
+	t.Run("ResponsesInput", func(t *testing.T) {
+		filter := newFilter(t, "last_message")
+		body := `{"model":"gpt-4o-mini","input":[` +
+			`{"type":"message","role":"user","content":"forbidden"},` +
+			`{"type":"message","role":"user","content":[{"type":"input_text","text":"hello"}]}]}`
+		if action := check(t, filter, body); action != interfaces.ActionContinue {
+			t.Errorf("Expected earlier input items to be ignored, got %s", action)
+		}
+	})
+
+	t.Run("InvalidScope", func(t *testing.T) {
+		filter := contentfilter.NewContentFilter(sugar)
+		config := &interfaces.ModuleConfig{Name: "content-filter", Config: map[string]interface{}{"request_scope": "first_message"}}
+		if err := filter.ValidateConfig(config); err == nil {
+			t.Error("Expected an unknown request_scope to be rejected")
+		}
+	})
+}
+
+// BenchmarkContentFilterKeywords compares the keyword matchers on a large
+// prompt with hundreds of keywords, none of which occur
+func BenchmarkContentFilterKeywords(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	keywords := make([]string, 500)
+	for i := range keywords {
+		word := make([]byte, 6+rng.Intn(6))
+		for j := range word {
+			word[j] = byte('a' + rng.Intn(26))
+		}
+		keywords[i] = string(word)
+	}
+	body := chatBody(b, strings.Repeat("Please summarise the quarterly report and list the open action items. ", 500))
+
+	for matcher, filter := range keywordFilters(b, zap.NewNop().Sugar(), keywords, nil) {
+		b.Run(matcher, func(b *testing.B) {
+			req := &interfaces.ProcessRequestContext{RequestID: "bench", Body: body}
+			ctx := context.Background()
+
+			b.SetBytes(int64(len(body)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := filter.ProcessRequest(ctx, req); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bendiamant/leash-gateway/internal/modulehost"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestModuleHostContentNegotiation(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+
+	policy := newStubModule("policy", interfaces.ModuleTypePolicy)
+	policy.result = &interfaces.ProcessRequestResult{
+		Action:      interfaces.ActionBlock,
+		BlockReason: "blocked by policy",
+		Annotations: map[string]interface{}{"matched_rule": "deny-all", "score": 0.9},
+	}
+	p := pipeline.NewPipeline(sugar)
+	if err := p.AddModule(policy); err != nil {
+		t.Fatalf("Failed to add module: %v", err)
+	}
+
+	newServer := func(protobufEnabled bool) *httptest.Server {
+		server := httptest.NewServer(modulehost.NewHTTPHandler(modulehost.NewService(p, sugar), protobufEnabled, 0))
+		t.Cleanup(server.Close)
+		return server
+	}
+	server := newServer(true)
+
+	request, err := structpb.NewStruct(map[string]interface{}{
+		"request_id": "neg-1",
+		"tenant_id":  "tenant-a",
+		"model":      "gpt-4o-mini",
+		"body":       map[string]interface{}{"messages": []interface{}{map[string]interface{}{"role": "user", "content": "hi"}}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to build request: %v", err)
+	}
+
+	post := func(t *testing.T, url, contentType, accept string, body []byte) (*http.Response, []byte) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, url+"/process", bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		payload, _ := io.ReadAll(resp.Body)
+		return resp, payload
+	}
+
+	// decision decodes a response body and drops the timing field
+	decision := func(t *testing.T, contentType string, payload []byte) map[string]interface{} {
+		t.Helper()
+		out := &structpb.Struct{}
+		var err error
+		if contentType == modulehost.ContentTypeProtobuf {
+			err = proto.Unmarshal(payload, out)
+		} else {
+			err = out.UnmarshalJSON(payload)
+		}
+		if err != nil {
+			t.Fatalf("Failed to decode %s response: %v", contentType, err)
+		}
+		fields := out.AsMap()
+		delete(fields, "processing_time_ms")
+		return fields
+	}
+
+	jsonBody, _ := request.MarshalJSON()
+	protoBody, _ := proto.Marshal(request)
+
+	jsonResp, jsonPayload := post(t, server.URL, modulehost.ContentTypeJSON, "", jsonBody)
+	if jsonResp.StatusCode != http.StatusOK || jsonResp.Header.Get("Content-Type") != modulehost.ContentTypeJSON {
+		t.Fatalf("Expected 200 JSON response, got %d %s: %s", jsonResp.StatusCode, jsonResp.Header.Get("Content-Type"), jsonPayload)
+	}
+	jsonDecision := decision(t, modulehost.ContentTypeJSON, jsonPayload)
+
+	t.Run("ProtobufRoundTrip", func(t *testing.T) {
+		resp, payload := post(t, server.URL, modulehost.ContentTypeProtobuf, "", protoBody)
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != modulehost.ContentTypeProtobuf {
+			t.Fatalf("Expected 200 protobuf response, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+
+		protoDecision := decision(t, modulehost.ContentTypeProtobuf, payload)
+		if !proto.Equal(mustStruct(t, protoDecision), mustStruct(t, jsonDecision)) {
+			t.Errorf("Expected protobuf decision to match JSON decision\nprotobuf: %v\njson:     %v", protoDecision, jsonDecision)
+		}
+		if protoDecision["action"] != "block" || protoDecision["block_reason"] != "blocked by policy" {
+			t.Errorf("Expected block decision, got %v", protoDecision)
+		}
+	})
+
+	t.Run("AcceptOverridesRequestType", func(t *testing.T) {
+		resp, payload := post(t, server.URL, modulehost.ContentTypeProtobuf, "application/json", protoBody)
+		if resp.Header.Get("Content-Type") != modulehost.ContentTypeJSON {
+			t.Fatalf("Expected JSON response for Accept: application/json, got %s", resp.Header.Get("Content-Type"))
+		}
+		if !proto.Equal(mustStruct(t, decision(t, modulehost.ContentTypeJSON, payload)), mustStruct(t, jsonDecision)) {
+			t.Errorf("Expected JSON decision for protobuf request to match")
+		}
+	})
+
+	t.Run("ErrorsUseNegotiatedType", func(t *testing.T) {
+		invalid, _ := proto.Marshal(&structpb.Struct{Fields: map[string]*structpb.Value{"model": structpb.NewStringValue("gpt-4o-mini")}})
+		resp, payload := post(t, server.URL, modulehost.ContentTypeProtobuf, "", invalid)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("Expected 400 for missing tenant, got %d", resp.StatusCode)
+		}
+		if decision(t, modulehost.ContentTypeProtobuf, payload)["error"] == nil {
+			t.Errorf("Expected protobuf error message")
+		}
+	})
+
+	t.Run("UnsupportedTypes", func(t *testing.T) {
+		if resp, _ := post(t, server.URL, "text/plain", "", jsonBody); resp.StatusCode != http.StatusUnsupportedMediaType {
+			t.Errorf("Expected 415 for text/plain, got %d", resp.StatusCode)
+		}
+		disabled := newServer(false)
+		if resp, _ := post(t, disabled.URL, modulehost.ContentTypeProtobuf, "", protoBody); resp.StatusCode != http.StatusUnsupportedMediaType {
+			t.Errorf("Expected 415 for protobuf when disabled, got %d", resp.StatusCode)
+		}
+	})
+}
+
+// mustStruct converts a decoded decision back into a Struct for comparison
+func mustStruct(t *testing.T, fields map[string]interface{}) *structpb.Struct {
+	t.Helper()
+	s, err := structpb.NewStruct(fields)
+	if err != nil {
+		t.Fatalf("Failed to build struct: %v", err)
+	}
+	return s
+}
@@ -0,0 +1,200 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bendiamant/leash-gateway/internal/metrics"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/contextwindow"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"github.com/bendiamant/leash-gateway/internal/tokens"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+func TestContextWindow(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	// About 250 estimated tokens per filler message
+	filler := strings.Repeat("x", 1000)
+	conversation, _ := json.Marshal(map[string]interface{}{
+		"max_tokens": 100,
+		"messages": []map[string]string{
+			{"role": "system", "content": "You are helpful"},
+			{"role": "user", "content": filler},
+			{"role": "assistant", "content": filler},
+			{"role": "user", "content": "latest question"},
+		},
+	})
+
+	newWindow := func(action string) *pipeline.Pipeline {
+		window := contextwindow.NewContextWindow(sugar)
+		if err := window.Initialize(ctx, &interfaces.ModuleConfig{
+			Name: "context-window", Type: "policy", Enabled: true,
+			Config: map[string]interface{}{
+				"context_windows": map[string]interface{}{
+					"local": map[string]interface{}{"small-model": 512, "large-model": 128000},
+				},
+				"action": action,
+			},
+		}); err != nil {
+			t.Fatalf("Failed to initialize context window: %v", err)
+		}
+		window.Start(ctx)
+
+		modulePipeline := pipeline.NewPipeline(sugar)
+		modulePipeline.AddModule(window)
+		return modulePipeline
+	}
+	request := func(id, model string) *interfaces.ProcessRequestContext {
+		return &interfaces.ProcessRequestContext{RequestID: id, Provider: "local", Model: model, Body: conversation}
+	}
+
+	t.Run("SmallContextBlocked", func(t *testing.T) {
+		result, err := newWindow("block").ProcessRequest(ctx, request("small-req", "small-model"))
+		if err != nil {
+			t.Fatalf("Pipeline processing failed: %v", err)
+		}
+		if result.Action != interfaces.ActionBlock {
+			t.Fatalf("Expected over-context request to be blocked, got %s", result.Action)
+		}
+		if !strings.Contains(result.BlockReason, "512 token context window of small-model") {
+			t.Errorf("Expected reason naming the model's context window, got %q", result.BlockReason)
+		}
+		if result.Annotations["context_estimated_tokens"] != 607 {
+			t.Errorf("Expected 507 prompt + 100 completion tokens, got %v", result.Annotations["context_estimated_tokens"])
+		}
+	})
+
+	t.Run("LargeContextAllowed", func(t *testing.T) {
+		result, err := newWindow("block").ProcessRequest(ctx, request("large-req", "large-model"))
+		if err != nil {
+			t.Fatalf("Pipeline processing failed: %v", err)
+		}
+		if result.Action != interfaces.ActionContinue {
+			t.Errorf("Expected request to fit the large context window, got %s", result.Action)
+		}
+	})
+
+	t.Run("UnknownModelAllowed", func(t *testing.T) {
+		result, err := newWindow("block").ProcessRequest(ctx, request("unknown-req", "other-model"))
+		if err != nil {
+			t.Fatalf("Pipeline processing failed: %v", err)
+		}
+		if result.Action != interfaces.ActionContinue {
+			t.Errorf("Expected a model without a context window to continue, got %s", result.Action)
+		}
+	})
+
+	t.Run("SmallContextTruncated", func(t *testing.T) {
+		req := request("truncate-req", "small-model")
+		result, err := newWindow("truncate").ProcessRequest(ctx, req)
+		if err != nil {
+			t.Fatalf("Pipeline processing failed: %v", err)
+		}
+		if result.Action != interfaces.ActionContinue {
+			t.Fatalf("Expected truncated request to continue, got %s", result.Action)
+		}
+		if req.Annotations["context_truncated"] != true {
+			t.Errorf("Expected truncation annotation, got %v", req.Annotations)
+		}
+
+		var body struct {
+			Messages []map[string]string `json:"messages"`
+		}
+		if err := json.Unmarshal(req.Body, &body); err != nil {
+			t.Fatalf("Truncated body is not valid JSON: %v", err)
+		}
+		if len(body.Messages) != 3 || body.Messages[0]["role"] != "system" || body.Messages[2]["content"] != "latest question" {
+			t.Errorf("Expected the oldest user message dropped, got %v", body.Messages)
+		}
+	})
+}
+
+// wordTokenizer counts whitespace-separated words as tokens
+type wordTokenizer struct{}
+
+func (wordTokenizer) Count(text string) int { return len(strings.Fields(text)) }
+
+func TestContextWindowTokenCounting(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	counter := tokens.NewCounter()
+	if err := counter.Register("known-*", func() (tokens.Tokenizer, error) { return wordTokenizer{}, nil }); err != nil {
+		t.Fatalf("Failed to register tokenizer: %v", err)
+	}
+	if err := counter.Register("broken-*", func() (tokens.Tokenizer, error) { return nil, errors.New("vocabulary missing") }); err != nil {
+		t.Fatalf("Failed to register tokenizer: %v", err)
+	}
+	registry := metrics.NewRegistry()
+
+	window := contextwindow.NewContextWindow(sugar)
+	window.SetTokenCounter(counter)
+	window.SetMetrics(registry)
+	if err := window.Initialize(ctx, &interfaces.ModuleConfig{
+		Name: "context-window", Type: "policy", Enabled: true,
+		Config: map[string]interface{}{
+			"context_windows": map[string]interface{}{
+				"local": map[string]interface{}{"known-model": 1000, "unknown-model": 1000, "broken-model": 1000},
+			},
+		},
+	}); err != nil {
+		t.Fatalf("Failed to initialize context window: %v", err)
+	}
+	window.Start(ctx)
+	modulePipeline := pipeline.NewPipeline(sugar)
+	modulePipeline.AddModule(window)
+
+	// Five words in 39 characters
+	body := []byte(`{"messages":[{"role":"user","content":"tokenizers count differently from chars"}]}`)
+	process := func(t *testing.T, model string) *interfaces.ProcessRequestContext {
+		t.Helper()
+		req := &interfaces.ProcessRequestContext{RequestID: model + "-req", Provider: "local", Model: model, Body: body}
+		result, err := modulePipeline.ProcessRequest(ctx, req)
+		if err != nil || result.Action != interfaces.ActionContinue {
+			t.Fatalf("Expected request to continue, got %v (%v)", result, err)
+		}
+		return req
+	}
+
+	t.Run("KnownModelUsesTokenizer", func(t *testing.T) {
+		req := process(t, "known-model")
+		if req.Annotations["context_estimated_tokens"] != 5 {
+			t.Errorf("Expected the tokenizer's 5 tokens, got %v", req.Annotations["context_estimated_tokens"])
+		}
+		if _, degraded := req.Annotations[tokens.DegradedAnnotation]; degraded {
+			t.Error("Expected no degraded flag for a model with a tokenizer")
+		}
+	})
+
+	t.Run("UnknownModelUsesHeuristic", func(t *testing.T) {
+		req := process(t, "unknown-model")
+		if req.Annotations["context_estimated_tokens"] != 9 {
+			t.Errorf("Expected the 39 / 4 character estimate, got %v", req.Annotations["context_estimated_tokens"])
+		}
+		if req.Annotations[tokens.DegradedAnnotation] != true {
+			t.Errorf("Expected degraded flag, got %v", req.Annotations)
+		}
+		if got := testutil.ToFloat64(registry.TokenEstimatesDegraded.WithLabelValues("unknown-model")); got != 1 {
+			t.Errorf("Expected one degraded estimate recorded, got %v", got)
+		}
+	})
+
+	t.Run("FailedTokenizerLoadDegrades", func(t *testing.T) {
+		req := process(t, "broken-model")
+		if req.Annotations[tokens.DegradedAnnotation] != true {
+			t.Errorf("Expected degraded flag when the tokenizer fails to load, got %v", req.Annotations)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/core/conversationlimit"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"go.uber.org/zap"
+)
+
+func TestConversationLimit(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	longConversation := []byte(`{"model":"gpt-4o-mini","messages":[
+		{"role":"system","content":"You are helpful"},
+		{"role":"user","content":"first"},
+		{"role":"assistant","content":"reply"},
+		{"role":"user","content":"second"},
+		{"role":"user","content":"latest question"}]}`)
+
+	newLimit := func(action string) *pipeline.Pipeline {
+		limit := conversationlimit.NewConversationLimit(sugar)
+		if err := limit.Initialize(ctx, &interfaces.ModuleConfig{
+			Name: "conversation-limit", Type: "policy", Enabled: true,
+			Config: map[string]interface{}{"max_messages": 3, "action": action},
+		}); err != nil {
+			t.Fatalf("Failed to initialize conversation limit: %v", err)
+		}
+		limit.Start(ctx)
+
+		modulePipeline := pipeline.NewPipeline(sugar)
+		modulePipeline.AddModule(limit)
+		return modulePipeline
+	}
+
+	t.Run("UnderLimitPasses", func(t *testing.T) {
+		req := &interfaces.ProcessRequestContext{
+			RequestID: "short-req",
+			Body:      []byte(`{"messages":[{"role":"user","content":"Hello"}]}`),
+		}
+		result, err := newLimit("block").ProcessRequest(ctx, req)
+		if err != nil {
+			t.Fatalf("Pipeline processing failed: %v", err)
+		}
+		if result.Action != interfaces.ActionContinue {
+			t.Errorf("Expected short conversation to continue, got %s", result.Action)
+		}
+	})
+
+	t.Run("OverLimitBlocked", func(t *testing.T) {
+		req := &interfaces.ProcessRequestContext{RequestID: "long-req", Body: longConversation}
+		result, err := newLimit("block").ProcessRequest(ctx, req)
+		if err != nil {
+			t.Fatalf("Pipeline processing failed: %v", err)
+		}
+		if result.Action != interfaces.ActionBlock {
+			t.Fatalf("Expected long conversation to be blocked, got %s", result.Action)
+		}
+		if result.Annotations["conversation_messages"] != 5 {
+			t.Errorf("Expected original size annotation of 5 messages, got %v", result.Annotations["conversation_messages"])
+		}
+	})
+
+	t.Run("OverLimitTruncated", func(t *testing.T) {
+		req := &interfaces.ProcessRequestContext{RequestID: "truncate-req", Body: longConversation}
+		result, err := newLimit("truncate").ProcessRequest(ctx, req)
+		if err != nil {
+			t.Fatalf("Pipeline processing failed: %v", err)
+		}
+		if result.Action != interfaces.ActionContinue {
+			t.Fatalf("Expected truncated conversation to continue, got %s", result.Action)
+		}
+		if req.Annotations["conversation_original_messages"] != 5 {
+			t.Errorf("Expected original message count annotation, got %v", req.Annotations["conversation_original_messages"])
+		}
+
+		var body struct {
+			Messages []map[string]string `json:"messages"`
+		}
+		if err := json.Unmarshal(req.Body, &body); err != nil {
+			t.Fatalf("Truncated body is not valid JSON: %v", err)
+		}
+		if len(body.Messages) != 3 {
+			t.Fatalf("Expected 3 messages after truncation, got %d", len(body.Messages))
+		}
+		if body.Messages[0]["role"] != "system" || body.Messages[2]["content"] != "latest question" {
+			t.Errorf("Expected system prompt and latest message to be kept, got %v", body.Messages)
+		}
+	})
+}
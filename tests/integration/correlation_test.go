@@ -0,0 +1,144 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/circuitbreaker"
+	"github.com/bendiamant/leash-gateway/internal/correlation"
+	"github.com/bendiamant/leash-gateway/internal/modulehost"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"github.com/bendiamant/leash-gateway/internal/providers/base"
+	"github.com/bendiamant/leash-gateway/internal/providers/openai"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestCorrelationMiddleware(t *testing.T) {
+	var seen string
+	handler := correlation.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Get(correlation.Header)
+	}))
+
+	t.Run("IncomingIDReused", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/process", nil)
+		req.Header.Set(correlation.Header, "client-123")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if seen != "client-123" || rec.Header().Get(correlation.Header) != "client-123" {
+			t.Errorf("Expected client-123 to be reused and echoed, handler saw %q, response %q",
+				seen, rec.Header().Get(correlation.Header))
+		}
+	})
+
+	t.Run("MissingIDGenerated", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/process", nil))
+
+		echoed := rec.Header().Get(correlation.Header)
+		if !strings.HasPrefix(echoed, "req_") || seen != echoed {
+			t.Errorf("Expected a generated ID to be used and echoed, handler saw %q, response %q", seen, echoed)
+		}
+	})
+
+	t.Run("InvalidIDReplaced", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/process", nil)
+		req.Header.Set(correlation.Header, "bad id\twith spaces")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if !strings.HasPrefix(rec.Header().Get(correlation.Header), "req_") {
+			t.Errorf("Expected invalid ID to be replaced, got %q", rec.Header().Get(correlation.Header))
+		}
+	})
+}
+
+func TestModuleHostCorrelationID(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	addr := startModuleHost(t, pipeline.NewPipeline(sugar), sugar)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	call := func(fields map[string]interface{}) (string, string) {
+		req, _ := structpb.NewStruct(fields)
+		resp := &structpb.Struct{}
+		var header metadata.MD
+		if err := conn.Invoke(ctx, modulehost.ProcessRequestMethod, req, resp, grpc.Header(&header)); err != nil {
+			t.Fatalf("ProcessRequest failed: %v", err)
+		}
+		echoed := ""
+		if values := header.Get("x-request-id"); len(values) > 0 {
+			echoed = values[0]
+		}
+		return resp.AsMap()["request_id"].(string), echoed
+	}
+
+	requestID, echoed := call(map[string]interface{}{
+		"tenant_id": "tenant-a",
+		"headers":   map[string]interface{}{"X-Request-Id": "client-456"},
+	})
+	if requestID != "client-456" || echoed != "client-456" {
+		t.Errorf("Expected incoming ID to be reused, got decision %q and header %q", requestID, echoed)
+	}
+
+	requestID, echoed = call(map[string]interface{}{"tenant_id": "tenant-a"})
+	if !strings.HasPrefix(requestID, "req_") || echoed != requestID {
+		t.Errorf("Expected generated ID in decision and header, got decision %q and header %q", requestID, echoed)
+	}
+}
+
+func TestProviderCorrelationID(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+
+	var upstreamID string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamID = r.Header.Get(correlation.Header)
+		w.Write([]byte(`{"id":"x","choices":[]}`))
+	}))
+	defer upstream.Close()
+
+	provider := openai.NewOpenAIProvider(&base.ProviderConfig{
+		Name:     "correlated",
+		Endpoint: upstream.URL,
+		Timeout:  time.Second,
+		CircuitBreaker: base.CircuitBreakerConfig{
+			FailureThreshold: 50,
+			MinRequests:      10,
+			Timeout:          time.Minute,
+		},
+	}, circuitbreaker.NewManager(), sugar)
+
+	resp, err := provider.ProcessRequest(context.Background(), &base.ProviderRequest{
+		RequestID: "client-789",
+		Model:     "gpt-4o-mini",
+		Messages:  []base.Message{{Role: "user", Content: "hi"}},
+	})
+	if err != nil {
+		t.Fatalf("Provider request failed: %v", err)
+	}
+	if upstreamID != "client-789" {
+		t.Errorf("Expected request ID to be sent upstream, got %q", upstreamID)
+	}
+	if resp.RequestID != "client-789" {
+		t.Errorf("Expected response to carry the request ID, got %q", resp.RequestID)
+	}
+}
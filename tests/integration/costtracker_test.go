@@ -0,0 +1,671 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/costtracker"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// trackCost records a response cost for a tenant through the cost tracker
+func trackCost(t *testing.T, ct *costtracker.CostTracker, tenantID string, cost float64) {
+	t.Helper()
+
+	_, err := ct.ProcessResponse(context.Background(), &interfaces.ProcessResponseContext{
+		ProcessRequestContext: &interfaces.ProcessRequestContext{
+			RequestID: "cost-" + tenantID,
+			TenantID:  tenantID,
+			Provider:  "openai",
+			Model:     "gpt-4o-mini",
+		},
+		CostUSD: cost,
+	})
+	if err != nil {
+		t.Fatalf("Cost tracker failed: %v", err)
+	}
+}
+
+// windowTotal sums the buckets of a usage window
+func windowTotal(buckets map[string]float64) float64 {
+	total := 0.0
+	for _, cost := range buckets {
+		total += cost
+	}
+	return total
+}
+
+func TestCostTrackerResets(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	newTracker := func(t *testing.T) *costtracker.CostTracker {
+		ct := costtracker.NewCostTracker(sugar)
+		err := ct.Initialize(ctx, &interfaces.ModuleConfig{
+			Name: "cost-tracker",
+			Config: map[string]interface{}{
+				"reset_schedule": map[string]interface{}{
+					"windows":  []interface{}{"daily"},
+					"timezone": "America/New_York",
+				},
+			},
+		})
+		if err != nil {
+			t.Fatalf("Failed to initialize cost tracker: %v", err)
+		}
+		return ct
+	}
+
+	t.Run("ScheduledDailyResetPreservesMonthly", func(t *testing.T) {
+		ct := newTracker(t)
+		trackCost(t, ct, "tenant-a", 1.5)
+
+		location, _ := time.LoadLocation("America/New_York")
+		now := time.Now().In(location)
+		midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, location)
+
+		// No boundary crossed yet
+		if reset := ct.ApplyScheduledResets(now, midnight.Add(-time.Second)); len(reset) != 0 {
+			t.Fatalf("Expected no reset before midnight, got %v", reset)
+		}
+
+		reset := ct.ApplyScheduledResets(midnight.Add(-time.Minute), midnight.Add(time.Second))
+		if len(reset) != 1 || reset[0] != costtracker.WindowDaily {
+			t.Fatalf("Expected daily reset at midnight, got %v", reset)
+		}
+
+		usage, err := ct.GetTenantUsage("tenant-a")
+		if err != nil {
+			t.Fatalf("Expected usage to remain for tenant-a: %v", err)
+		}
+		if daily := windowTotal(usage.DailyUsage); daily != 0 {
+			t.Errorf("Expected daily usage to be cleared, got %v", daily)
+		}
+		if monthly := windowTotal(usage.MonthlyUsage); monthly != 1.5 {
+			t.Errorf("Expected monthly usage to be preserved, got %v", monthly)
+		}
+		if usage.TotalCost != 1.5 {
+			t.Errorf("Expected total cost to be preserved, got %v", usage.TotalCost)
+		}
+	})
+
+	t.Run("ResetWindow", func(t *testing.T) {
+		ct := newTracker(t)
+		trackCost(t, ct, "tenant-a", 2)
+
+		if err := ct.ResetWindow("tenant-a", costtracker.WindowHourly); err != nil {
+			t.Fatalf("Failed to reset hourly window: %v", err)
+		}
+		usage, _ := ct.GetTenantUsage("tenant-a")
+		if windowTotal(usage.HourlyUsage) != 0 || windowTotal(usage.DailyUsage) != 2 {
+			t.Errorf("Expected only hourly usage cleared, got hourly=%v daily=%v", usage.HourlyUsage, usage.DailyUsage)
+		}
+
+		if err := ct.ResetWindow("tenant-a", "weekly"); err == nil {
+			t.Error("Expected unknown window to be rejected")
+		}
+	})
+
+	t.Run("ResetAll", func(t *testing.T) {
+		ct := newTracker(t)
+		for _, tenantID := range []string{"tenant-a", "tenant-b", "tenant-c"} {
+			trackCost(t, ct, tenantID, 1)
+		}
+
+		if count := ct.ResetAll(); count != 3 {
+			t.Errorf("Expected 3 tenants reset, got %d", count)
+		}
+		if usage := ct.GetAllUsage(); len(usage) != 0 {
+			t.Errorf("Expected no tenant usage after ResetAll, got %d tenants", len(usage))
+		}
+	})
+}
+
+func TestCostTrackerWindowTimezone(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	// The server's local time must not affect bucketing
+	local := time.Local
+	time.Local = time.FixedZone("UTC-7", -7*60*60)
+	defer func() { time.Local = local }()
+
+	// 23:30 UTC on March 31st is already April 1st in Tokyo
+	instant := time.Date(2024, time.March, 31, 23, 30, 0, 0, time.UTC)
+
+	newTracker := func(t *testing.T, config map[string]interface{}) *costtracker.CostTracker {
+		t.Helper()
+		ct := costtracker.NewCostTracker(sugar)
+		moduleConfig := &interfaces.ModuleConfig{Name: "cost-tracker", Config: config}
+		if err := ct.ValidateConfig(moduleConfig); err != nil {
+			t.Fatalf("Invalid config: %v", err)
+		}
+		if err := ct.Initialize(ctx, moduleConfig); err != nil {
+			t.Fatalf("Failed to initialize cost tracker: %v", err)
+		}
+		return ct
+	}
+	// expectBuckets checks a tenant's usage is in exactly the given buckets
+	expectBuckets := func(t *testing.T, ct *costtracker.CostTracker, hour, day, month string) {
+		t.Helper()
+		usage, err := ct.GetTenantUsage("tenant-a")
+		if err != nil {
+			t.Fatalf("Expected usage for tenant-a: %v", err)
+		}
+		for window, buckets := range map[string]map[string]float64{hour: usage.HourlyUsage, day: usage.DailyUsage, month: usage.MonthlyUsage} {
+			if _, ok := buckets[window]; !ok || len(buckets) != 1 {
+				t.Errorf("Expected usage bucketed under %s, got %v", window, buckets)
+			}
+		}
+	}
+
+	for _, tc := range []struct {
+		name             string
+		config           map[string]interface{}
+		hour, day, month string
+	}{
+		{"DefaultsToUTC", map[string]interface{}{}, "2024-03-31-23", "2024-03-31", "2024-03"},
+		{"ConfiguredTimezone", map[string]interface{}{"timezone": "Asia/Tokyo"}, "2024-04-01-08", "2024-04-01", "2024-04"},
+		{"ResetScheduleTimezone", map[string]interface{}{
+			"reset_schedule": map[string]interface{}{"timezone": "Asia/Tokyo"},
+		}, "2024-04-01-08", "2024-04-01", "2024-04"},
+		{"TimezoneTakesPrecedence", map[string]interface{}{
+			"timezone":       "UTC",
+			"reset_schedule": map[string]interface{}{"timezone": "Asia/Tokyo"},
+		}, "2024-03-31-23", "2024-03-31", "2024-03"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ct := newTracker(t, tc.config)
+			ct.SetClock(func() time.Time { return instant.In(time.Local) })
+			trackCost(t, ct, "tenant-a", 1)
+			expectBuckets(t, ct, tc.hour, tc.day, tc.month)
+		})
+	}
+
+	t.Run("ClockSteppedBackKeepsWindow", func(t *testing.T) {
+		ct := newTracker(t, map[string]interface{}{})
+		now := instant.Add(time.Hour) // 00:30 on April 1st
+		ct.SetClock(func() time.Time { return now })
+		trackCost(t, ct, "tenant-a", 1)
+
+		// An NTP correction steps the clock back into March
+		now = instant
+		trackCost(t, ct, "tenant-a", 1)
+		expectBuckets(t, ct, "2024-04-01-00", "2024-04-01", "2024-04")
+	})
+
+	t.Run("InvalidTimezoneRejected", func(t *testing.T) {
+		ct := costtracker.NewCostTracker(sugar)
+		config := &interfaces.ModuleConfig{Name: "cost-tracker", Config: map[string]interface{}{"timezone": "Mars/Olympus_Mons"}}
+		if err := ct.ValidateConfig(config); err == nil {
+			t.Error("Expected an unknown timezone to fail validation")
+		}
+		if err := ct.Initialize(ctx, config); err == nil {
+			t.Error("Expected an unknown timezone to fail initialization")
+		}
+	})
+
+	t.Run("NonPositiveCheckIntervalRejected", func(t *testing.T) {
+		for _, interval := range []string{"0s", "-1m"} {
+			ct := costtracker.NewCostTracker(sugar)
+			config := &interfaces.ModuleConfig{Name: "cost-tracker", Config: map[string]interface{}{
+				"reset_schedule": map[string]interface{}{"check_interval": interval},
+			}}
+			if err := ct.ValidateConfig(config); err == nil {
+				t.Errorf("Expected check_interval %s to fail validation", interval)
+			}
+			if err := ct.Initialize(ctx, config); err == nil {
+				t.Errorf("Expected check_interval %s to fail initialization", interval)
+			}
+		}
+	})
+}
+
+// sharedCostStore is an in-memory aggregation store shared by regional trackers
+type sharedCostStore struct {
+	mu     sync.Mutex
+	totals map[string]map[string]float64
+	fail   bool
+}
+
+func (s *sharedCostStore) Add(ctx context.Context, region string, deltas map[string]map[string]float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail {
+		return fmt.Errorf("store unavailable")
+	}
+	if s.totals == nil {
+		s.totals = make(map[string]map[string]float64)
+	}
+	for tenantID, buckets := range deltas {
+		if s.totals[tenantID] == nil {
+			s.totals[tenantID] = make(map[string]float64)
+		}
+		for bucket, cost := range buckets {
+			s.totals[tenantID][bucket] += cost
+		}
+	}
+	return nil
+}
+
+func (s *sharedCostStore) Totals(ctx context.Context, tenantID string, buckets []string) (map[string]float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail {
+		return nil, fmt.Errorf("store unavailable")
+	}
+	totals := make(map[string]float64)
+	for _, bucket := range buckets {
+		totals[bucket] = s.totals[tenantID][bucket]
+	}
+	return totals, nil
+}
+
+func (s *sharedCostStore) Reset(ctx context.Context, tenantID string, buckets []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail {
+		return fmt.Errorf("store unavailable")
+	}
+	for tenant, totals := range s.totals {
+		if tenantID != "" && tenant != tenantID {
+			continue
+		}
+		for _, bucket := range buckets {
+			delete(totals, bucket)
+		}
+	}
+	return nil
+}
+
+// costLimitRequest is a request from a tenant subject to cost limits
+func costLimitRequest(tenantID string) *interfaces.ProcessRequestContext {
+	return &interfaces.ProcessRequestContext{
+		RequestID: "limit-" + tenantID,
+		TenantID:  tenantID,
+		Provider:  "openai",
+		Model:     "gpt-4o-mini",
+		Body:      []byte(`{"model":"gpt-4o-mini","messages":[{"role":"user","content":"hi"}]}`),
+	}
+}
+
+// checkCostLimit runs a request for a tenant through the cost limiter
+// enforcing the tracker's limits
+func checkCostLimit(t *testing.T, ct *costtracker.CostTracker, tenantID string) *interfaces.ProcessRequestResult {
+	t.Helper()
+
+	result, err := costtracker.NewCostLimiter(zap.NewNop().Sugar(), ct).ProcessRequest(context.Background(), costLimitRequest(tenantID))
+	if err != nil {
+		t.Fatalf("Cost limiter failed: %v", err)
+	}
+	return result
+}
+
+func TestCostTrackerGlobalAggregation(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	limits := map[string]interface{}{
+		"tenant-a": map[string]interface{}{"daily_limit_usd": 10},
+	}
+	newTracker := func(t *testing.T, store *sharedCostStore, region string) *costtracker.CostTracker {
+		t.Helper()
+		ct := costtracker.NewCostTracker(sugar)
+		ct.SetAggregationStore(store)
+		moduleConfig := &interfaces.ModuleConfig{
+			Name: "cost-tracker",
+			Config: map[string]interface{}{
+				"limits": limits,
+				"aggregation": map[string]interface{}{
+					"enabled":       true,
+					"region":        region,
+					"sync_interval": "1h",
+					"max_staleness": "2h",
+				},
+			},
+		}
+		if err := ct.ValidateConfig(moduleConfig); err != nil {
+			t.Fatalf("Invalid config: %v", err)
+		}
+		if err := ct.Initialize(ctx, moduleConfig); err != nil {
+			t.Fatalf("Failed to initialize cost tracker: %v", err)
+		}
+		return ct
+	}
+
+	t.Run("GlobalTotalReflectsBothRegions", func(t *testing.T) {
+		store := &sharedCostStore{}
+		east, west := newTracker(t, store, "us-east"), newTracker(t, store, "eu-west")
+
+		trackCost(t, east, "tenant-a", 4)
+		trackCost(t, west, "tenant-a", 5)
+		for _, ct := range []*costtracker.CostTracker{east, west, east} {
+			if err := ct.SyncGlobal(ctx); err != nil {
+				t.Fatalf("Sync failed: %v", err)
+			}
+		}
+
+		daily := 0.0
+		for bucket, cost := range store.totals["tenant-a"] {
+			if len(bucket) == len("2006-01-02") {
+				daily += cost
+			}
+		}
+		if daily != 9 {
+			t.Errorf("Expected a global daily total of $9 from both regions, got $%.2f", daily)
+		}
+
+		// $9 of $10 spent globally, though each region spent less than half
+		for _, ct := range []*costtracker.CostTracker{east, west} {
+			if result := checkCostLimit(t, ct, "tenant-a"); result.Action != interfaces.ActionContinue {
+				t.Fatalf("Expected tenant under its global limit to pass, got %s", result.Action)
+			}
+		}
+
+		trackCost(t, west, "tenant-a", 1.5)
+		result := checkCostLimit(t, west, "tenant-a")
+		if result.Action != interfaces.ActionBlock || result.Annotations["cost_global"] != true {
+			t.Fatalf("Expected the region that crossed the global limit to block on it at once, got %s %v", result.Action, result.Annotations)
+		}
+		if spent := result.Annotations["cost_spent_usd"]; spent != 10.5 {
+			t.Errorf("Expected global spend of $10.50, got %v", spent)
+		}
+
+		// The other region sees the overrun after its next sync
+		if result := checkCostLimit(t, east, "tenant-a"); result.Action != interfaces.ActionContinue {
+			t.Fatalf("Expected the other region to allow until it syncs, got %s", result.Action)
+		}
+		west.SyncGlobal(ctx)
+		east.SyncGlobal(ctx)
+		if result := checkCostLimit(t, east, "tenant-a"); result.Action != interfaces.ActionBlock {
+			t.Errorf("Expected the other region to block after syncing, got %s", result.Action)
+		}
+		if result := checkCostLimit(t, east, "tenant-b"); result.Action != interfaces.ActionContinue {
+			t.Errorf("Expected tenants without limits to pass, got %s", result.Action)
+		}
+	})
+
+	t.Run("FailedPushRetried", func(t *testing.T) {
+		store := &sharedCostStore{fail: true}
+		east := newTracker(t, store, "us-east")
+
+		trackCost(t, east, "tenant-a", 12)
+		if err := east.SyncGlobal(ctx); err == nil {
+			t.Fatal("Expected sync to fail while the store is unavailable")
+		}
+		if result := checkCostLimit(t, east, "tenant-a"); result.Action != interfaces.ActionBlock {
+			t.Errorf("Expected unpushed spend to count toward the limit, got %s", result.Action)
+		}
+
+		store.fail = false
+		if err := east.SyncGlobal(ctx); err != nil {
+			t.Fatalf("Sync failed: %v", err)
+		}
+		west := newTracker(t, store, "eu-west")
+		west.SyncGlobal(ctx)
+		if result := checkCostLimit(t, west, "tenant-a"); result.Action != interfaces.ActionBlock {
+			t.Errorf("Expected the retried push to reach other regions, got %s", result.Action)
+		}
+	})
+
+	t.Run("StaleViewDegradesHealth", func(t *testing.T) {
+		store := &sharedCostStore{}
+		east := newTracker(t, store, "us-east")
+		now := time.Now()
+		east.SetClock(func() time.Time { return now })
+
+		if err := east.SyncGlobal(ctx); err != nil {
+			t.Fatalf("Sync failed: %v", err)
+		}
+		if health, _ := east.Health(ctx); health.Status != interfaces.HealthStateHealthy {
+			t.Fatalf("Expected healthy after a sync, got %s", health.Status)
+		}
+
+		now = now.Add(3 * time.Hour)
+		if health, _ := east.Health(ctx); health.Status != interfaces.HealthStateDegraded {
+			t.Errorf("Expected degraded once the global view exceeds max_staleness, got %s", health.Status)
+		}
+	})
+
+	t.Run("LocalLimitsWithoutAggregation", func(t *testing.T) {
+		ct := costtracker.NewCostTracker(sugar)
+		if err := ct.Initialize(ctx, &interfaces.ModuleConfig{
+			Name:   "cost-tracker",
+			Config: map[string]interface{}{"limits": limits},
+		}); err != nil {
+			t.Fatalf("Failed to initialize cost tracker: %v", err)
+		}
+
+		trackCost(t, ct, "tenant-a", 10)
+		result := checkCostLimit(t, ct, "tenant-a")
+		if result.Action != interfaces.ActionBlock || result.Annotations["cost_limit_window"] != "daily" || result.Annotations["cost_global"] != false {
+			t.Errorf("Expected the local daily limit enforced, got %s %v", result.Action, result.Annotations)
+		}
+	})
+
+	t.Run("PipelineBlocksOverLimit", func(t *testing.T) {
+		ct := costtracker.NewCostTracker(sugar)
+		if err := ct.Initialize(ctx, &interfaces.ModuleConfig{
+			Name:   "cost-tracker",
+			Config: map[string]interface{}{"limits": limits},
+		}); err != nil {
+			t.Fatalf("Failed to initialize cost tracker: %v", err)
+		}
+		limiter := costtracker.NewCostLimiter(sugar, ct)
+		limiter.Initialize(ctx, &interfaces.ModuleConfig{Name: "cost-limiter"})
+		ct.Start(ctx)
+		limiter.Start(ctx)
+		p := pipeline.NewPipeline(sugar)
+		p.AddModule(ct)
+		p.AddModule(limiter)
+
+		result, err := p.ProcessRequest(ctx, costLimitRequest("tenant-a"))
+		if err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		if result.Action != interfaces.ActionContinue {
+			t.Fatalf("Expected a tenant under its limit to pass, got %s", result.Action)
+		}
+
+		trackCost(t, ct, "tenant-a", 10)
+		result, err = p.ProcessRequest(ctx, costLimitRequest("tenant-a"))
+		if err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		if result.Action != interfaces.ActionBlock || result.BlockReason != costtracker.LimitBlockReason {
+			t.Errorf("Expected the pipeline to block a tenant over its limit, got %s %q", result.Action, result.BlockReason)
+		}
+		p.Drain(ctx)
+	})
+
+	t.Run("RedisStore", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		defer client.Close()
+
+		newRedisTracker := func(region string) *costtracker.CostTracker {
+			ct := costtracker.NewCostTracker(sugar)
+			ct.SetAggregationStore(costtracker.NewRedisAggregationStore(client, "leash:cost:"))
+			if err := ct.Initialize(ctx, &interfaces.ModuleConfig{
+				Name: "cost-tracker",
+				Config: map[string]interface{}{
+					"limits":      limits,
+					"aggregation": map[string]interface{}{"enabled": true, "region": region, "sync_interval": "1h", "max_staleness": "2h"},
+				},
+			}); err != nil {
+				t.Fatalf("Failed to initialize cost tracker: %v", err)
+			}
+			return ct
+		}
+		east, west := newRedisTracker("us-east"), newRedisTracker("eu-west")
+
+		trackCost(t, east, "tenant-a", 4)
+		trackCost(t, west, "tenant-a", 7)
+		for _, ct := range []*costtracker.CostTracker{east, west, east} {
+			if err := ct.SyncGlobal(ctx); err != nil {
+				t.Fatalf("Sync failed: %v", err)
+			}
+		}
+
+		result := checkCostLimit(t, east, "tenant-a")
+		if result.Action != interfaces.ActionBlock || result.Annotations["cost_spent_usd"] != 11.0 {
+			t.Errorf("Expected $11 of global spend through Redis to block, got %s %v", result.Action, result.Annotations)
+		}
+		for _, key := range server.Keys() {
+			if server.TTL(key) <= 0 {
+				t.Errorf("Expected bucket key %s to expire", key)
+			}
+			if regions, _ := server.HKeys(key); len(regions) != 2 {
+				t.Errorf("Expected bucket key %s to hold each region's cost, got %v", key, regions)
+			}
+		}
+	})
+
+	t.Run("ReloadRestartsSyncing", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		defer client.Close()
+
+		moduleConfig := func(syncInterval string) *interfaces.ModuleConfig {
+			return &interfaces.ModuleConfig{
+				Name: "cost-tracker",
+				Config: map[string]interface{}{
+					"limits":      limits,
+					"aggregation": map[string]interface{}{"enabled": true, "region": "us-east", "sync_interval": syncInterval, "max_staleness": "2h"},
+				},
+			}
+		}
+		ct := costtracker.NewCostTracker(sugar)
+		ct.SetAggregationStore(costtracker.NewRedisAggregationStore(client, "leash:cost:"))
+		if err := ct.Initialize(ctx, moduleConfig("1h")); err != nil {
+			t.Fatalf("Failed to initialize cost tracker: %v", err)
+		}
+		ct.Start(ctx)
+		defer ct.Stop(ctx)
+
+		// Limits are read while the config is reloaded
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 100; i++ {
+				checkCostLimit(t, ct, "tenant-a")
+				ct.GetConfig()
+			}
+		}()
+		if err := ct.UpdateConfig(ctx, moduleConfig("20ms")); err != nil {
+			t.Fatalf("Failed to update config: %v", err)
+		}
+		<-done
+		if !ct.GetConfig().Enabled {
+			t.Error("Expected the tracker to keep running after a reload")
+		}
+
+		trackCost(t, ct, "tenant-a", 2)
+		deadline := time.Now().Add(2 * time.Second)
+		for len(server.Keys()) == 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if len(server.Keys()) == 0 {
+			t.Error("Expected the reloaded sync interval to push spend without waiting an hour")
+		}
+	})
+
+	t.Run("ResetsClearGlobalSpend", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		defer client.Close()
+
+		newRedisTracker := func(region string) *costtracker.CostTracker {
+			ct := costtracker.NewCostTracker(sugar)
+			ct.SetAggregationStore(costtracker.NewRedisAggregationStore(client, "leash:cost:"))
+			if err := ct.Initialize(ctx, &interfaces.ModuleConfig{
+				Name: "cost-tracker",
+				Config: map[string]interface{}{
+					"limits":      limits,
+					"aggregation": map[string]interface{}{"enabled": true, "region": region, "sync_interval": "1h", "max_staleness": "2h"},
+				},
+			}); err != nil {
+				t.Fatalf("Failed to initialize cost tracker: %v", err)
+			}
+			return ct
+		}
+		east, west := newRedisTracker("us-east"), newRedisTracker("eu-west")
+		syncAll := func() {
+			t.Helper()
+			for _, ct := range []*costtracker.CostTracker{east, west, east} {
+				if err := ct.SyncGlobal(ctx, "tenant-b"); err != nil {
+					t.Fatalf("Sync failed: %v", err)
+				}
+			}
+		}
+
+		trackCost(t, east, "tenant-a", 6)
+		trackCost(t, west, "tenant-a", 6)
+		syncAll()
+		if result := checkCostLimit(t, east, "tenant-a"); result.Action != interfaces.ActionBlock {
+			t.Fatalf("Expected $12 of global spend to block, got %s", result.Action)
+		}
+
+		// The reset clears the global daily total, so syncs do not add the
+		// aggregated spend back
+		if err := east.ResetWindow("tenant-a", costtracker.WindowDaily); err != nil {
+			t.Fatalf("Failed to reset daily window: %v", err)
+		}
+		syncAll()
+		for _, ct := range []*costtracker.CostTracker{east, west} {
+			if result := checkCostLimit(t, ct, "tenant-a"); result.Action != interfaces.ActionContinue {
+				t.Errorf("Expected the reset daily spend to stay cleared after syncing, got %s %v", result.Action, result.Annotations)
+			}
+		}
+
+		// A tenant this replica never tracked is still reset globally
+		trackCost(t, east, "tenant-a", 11)
+		syncAll()
+		if err := west.ResetUsage("tenant-a"); err != nil {
+			t.Fatalf("Failed to reset tenant usage: %v", err)
+		}
+		syncAll()
+		if result := checkCostLimit(t, east, "tenant-a"); result.Action != interfaces.ActionContinue {
+			t.Errorf("Expected the tenant's global spend cleared, got %s %v", result.Action, result.Annotations)
+		}
+
+		trackCost(t, east, "tenant-a", 11)
+		trackCost(t, west, "tenant-b", 3)
+		syncAll()
+		west.ResetAll()
+		syncAll()
+		if result := checkCostLimit(t, east, "tenant-a"); result.Action != interfaces.ActionContinue {
+			t.Errorf("Expected ResetAll to clear global spend, got %s %v", result.Action, result.Annotations)
+		}
+		if keys := server.Keys(); len(keys) != 0 {
+			t.Errorf("Expected every bucket key deleted, got %v", keys)
+		}
+	})
+
+	t.Run("InvalidConfig", func(t *testing.T) {
+		ct := costtracker.NewCostTracker(sugar)
+		for _, config := range []map[string]interface{}{
+			{"aggregation": map[string]interface{}{"enabled": true}},
+			{"aggregation": map[string]interface{}{"sync_interval": "soon"}},
+			{"aggregation": map[string]interface{}{"sync_interval": "1m", "max_staleness": "30s"}},
+			{"limits": map[string]interface{}{"tenant-a": map[string]interface{}{"daily_limit_usd": -1}}},
+		} {
+			if err := ct.ValidateConfig(&interfaces.ModuleConfig{Name: "cost-tracker", Config: config}); err == nil {
+				t.Errorf("Expected %v to be rejected", config)
+			}
+		}
+	})
+}
@@ -0,0 +1,201 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/deadletter"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"go.uber.org/zap"
+)
+
+// flakySink fails deliveries while failing is set and records the requests
+// and responses it delivered
+type flakySink struct {
+	*stubModule
+	mu        sync.Mutex
+	failing   bool
+	requests  []string
+	responses []string
+}
+
+func newFlakySink(name string) *flakySink {
+	return &flakySink{stubModule: newStubModule(name, interfaces.ModuleTypeSink), failing: true}
+}
+
+func (s *flakySink) setFailing(failing bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failing = failing
+}
+
+func (s *flakySink) delivered() (requests, responses []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...), append([]string(nil), s.responses...)
+}
+
+func (s *flakySink) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequestContext) (*interfaces.ProcessRequestResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failing {
+		return nil, errors.New("connection refused")
+	}
+	s.requests = append(s.requests, req.RequestID)
+	return &interfaces.ProcessRequestResult{Action: interfaces.ActionContinue}, nil
+}
+
+func (s *flakySink) ProcessResponse(ctx context.Context, resp *interfaces.ProcessResponseContext) (*interfaces.ProcessResponseResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failing {
+		return nil, errors.New("connection refused")
+	}
+	s.responses = append(s.responses, resp.RequestID)
+	return &interfaces.ProcessResponseResult{Action: interfaces.ActionContinue}, nil
+}
+
+func TestSinkDeadLetter(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	// deliver sends a request and its response through a pipeline and waits
+	// for the sinks to run
+	deliver := func(t *testing.T, p *pipeline.Pipeline, id string) {
+		t.Helper()
+		req := &interfaces.ProcessRequestContext{
+			RequestID: id,
+			TenantID:  "tenant-a",
+			Body:      chatBody(t, "hello"),
+		}
+		if _, err := p.ProcessRequest(ctx, req); err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		p.ProcessResponse(ctx, &interfaces.ProcessResponseContext{
+			ProcessRequestContext: req,
+			StatusCode:            200,
+			ResponseBody:          []byte(`{"choices":[]}`),
+		})
+		p.Drain(ctx)
+	}
+
+	t.Run("FailedEventsLandInFileStore", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "dead-letters.jsonl")
+		sink := newFlakySink("webhook")
+		p := pipeline.NewPipeline(sugar)
+		p.AddModule(sink)
+		p.SetDeadLetter(deadletter.NewFileStore(path), 0)
+
+		deliver(t, p, "dlq-req")
+
+		// A second store on the same file reads what the pipeline wrote
+		events, err := deadletter.NewFileStore(path).Take()
+		if err != nil {
+			t.Fatalf("Failed to read dead letters: %v", err)
+		}
+		if len(events) != 2 {
+			t.Fatalf("Expected request and response events dead-lettered, got %+v", events)
+		}
+		phases := map[string]bool{}
+		for _, event := range events {
+			if event.Sink != "webhook" || event.Reason != "connection refused" || event.Attempts != 1 {
+				t.Errorf("Expected the sink and failure reason recorded, got %+v", event)
+			}
+			if event.RequestID() != "dlq-req" {
+				t.Errorf("Expected the event for dlq-req, got %s", event.RequestID())
+			}
+			phases[event.Phase] = true
+		}
+		if !phases[deadletter.PhaseRequest] || !phases[deadletter.PhaseResponse] {
+			t.Errorf("Expected both phases dead-lettered, got %v", phases)
+		}
+	})
+
+	t.Run("ReplayDeliversToSink", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "dead-letters.jsonl")
+		sink := newFlakySink("webhook")
+		p := pipeline.NewPipeline(sugar)
+		p.AddModule(sink)
+		p.SetDeadLetter(deadletter.NewFileStore(path), 0)
+
+		deliver(t, p, "replay-req")
+
+		// Replaying while the sink is still down keeps the events
+		delivered, err := p.ReplayDeadLetters(ctx)
+		if err != nil || delivered != 0 {
+			t.Fatalf("Expected nothing delivered while the sink fails, got %d (%v)", delivered, err)
+		}
+
+		sink.setFailing(false)
+		delivered, err = p.ReplayDeadLetters(ctx)
+		if err != nil || delivered != 2 {
+			t.Fatalf("Expected both events delivered on replay, got %d (%v)", delivered, err)
+		}
+		requests, responses := sink.delivered()
+		if len(requests) != 1 || requests[0] != "replay-req" || len(responses) != 1 || responses[0] != "replay-req" {
+			t.Errorf("Expected the sink to receive the replayed request and response, got %v and %v", requests, responses)
+		}
+		if remaining, _ := deadletter.NewFileStore(path).Take(); len(remaining) != 0 {
+			t.Errorf("Expected the store emptied after delivery, got %+v", remaining)
+		}
+	})
+
+	t.Run("MaxAttemptsParksEvents", func(t *testing.T) {
+		store := deadletter.NewMemoryStore()
+		sink := newFlakySink("kafka")
+		p := pipeline.NewPipeline(sugar)
+		p.AddModule(sink)
+		p.SetDeadLetter(store, 2)
+
+		deliver(t, p, "parked-req")
+		p.ReplayDeadLetters(ctx) // second failed attempt
+
+		// Parked events are not retried even once the sink recovers
+		sink.setFailing(false)
+		if delivered, _ := p.ReplayDeadLetters(ctx); delivered != 0 {
+			t.Errorf("Expected parked events not replayed, got %d delivered", delivered)
+		}
+		events, _ := store.Take()
+		if len(events) != 2 {
+			t.Fatalf("Expected parked events kept in the store, got %+v", events)
+		}
+		for _, event := range events {
+			if event.Attempts != 2 {
+				t.Errorf("Expected two recorded attempts, got %d", event.Attempts)
+			}
+		}
+	})
+
+	t.Run("BackgroundRetry", func(t *testing.T) {
+		sink := newFlakySink("elasticsearch")
+		p := pipeline.NewPipeline(sugar)
+		p.AddModule(sink)
+		p.SetDeadLetter(deadletter.NewMemoryStore(), 0)
+
+		deliver(t, p, "retried-req")
+		sink.setFailing(false)
+		p.StartDeadLetterRetry(10 * time.Millisecond)
+		defer p.StopDeadLetterRetry()
+
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			requests, responses := sink.delivered()
+			if len(requests) == 1 && len(responses) == 1 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected background retry to deliver the events, got %v and %v", requests, responses)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+}
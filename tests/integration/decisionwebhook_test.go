@@ -0,0 +1,214 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/core/contentfilter"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/decisionwebhook"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"go.uber.org/zap"
+)
+
+// webhookReceiver records the deliveries made to a test webhook
+type webhookReceiver struct {
+	mu         sync.Mutex
+	status     int
+	bodies     [][]byte
+	headers    []http.Header
+	deliveries int
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deliveries++
+	r.bodies = append(r.bodies, body)
+	r.headers = append(r.headers, req.Header.Clone())
+	if r.status != 0 {
+		w.WriteHeader(r.status)
+	}
+}
+
+func TestDecisionWebhook(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	const secret = "soar-shared-secret"
+
+	newPipeline := func(t *testing.T, webhookConfig map[string]interface{}) (*pipeline.Pipeline, *decisionwebhook.DecisionWebhook) {
+		t.Helper()
+		filter := contentfilter.NewContentFilter(sugar)
+		if err := filter.Initialize(ctx, &interfaces.ModuleConfig{
+			Name:   "content-filter",
+			Config: map[string]interface{}{"blocked_keywords": []interface{}{"harmful"}, "action": "block"},
+		}); err != nil {
+			t.Fatalf("Failed to initialize content filter: %v", err)
+		}
+		filter.Start(ctx)
+
+		webhook := decisionwebhook.NewDecisionWebhook(sugar)
+		moduleConfig := &interfaces.ModuleConfig{Name: "decision-webhook", Config: webhookConfig}
+		if err := webhook.ValidateConfig(moduleConfig); err != nil {
+			t.Fatalf("Invalid config: %v", err)
+		}
+		if err := webhook.Initialize(ctx, moduleConfig); err != nil {
+			t.Fatalf("Failed to initialize decision webhook: %v", err)
+		}
+		if err := webhook.Start(ctx); err != nil {
+			t.Fatalf("Failed to start decision webhook: %v", err)
+		}
+
+		p := pipeline.NewPipeline(sugar)
+		p.AddModule(filter)
+		p.AddModule(webhook)
+		return p, webhook
+	}
+	// send runs a request, and its response when it is not blocked, through
+	// the pipeline, then shuts the webhook down to flush its queue
+	send := func(t *testing.T, p *pipeline.Pipeline, webhook *decisionwebhook.DecisionWebhook, id, content string) *interfaces.ProcessRequestResult {
+		t.Helper()
+		req := &interfaces.ProcessRequestContext{
+			RequestID: id,
+			TenantID:  "tenant-a",
+			Provider:  "openai",
+			Model:     "gpt-4o-mini",
+			Body:      chatBody(t, content),
+		}
+		result, err := p.ProcessRequest(ctx, req)
+		if err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		if result.Action != interfaces.ActionBlock {
+			_, err := p.ProcessResponse(ctx, &interfaces.ProcessResponseContext{
+				ProcessRequestContext: req,
+				StatusCode:            http.StatusOK,
+				ResponseBody:          []byte(`{"choices":[{"message":{"role":"assistant","content":"Hello there."}}]}`),
+			})
+			if err != nil {
+				t.Fatalf("Pipeline failed: %v", err)
+			}
+		}
+		p.Drain(ctx)
+		webhook.Shutdown(ctx)
+		return result
+	}
+
+	t.Run("BlockSendsSignedEvent", func(t *testing.T) {
+		receiver := &webhookReceiver{}
+		server := httptest.NewServer(receiver)
+		defer server.Close()
+
+		p, webhook := newPipeline(t, map[string]interface{}{"url": server.URL, "secret": secret, "batch_size": 1})
+		if result := send(t, p, webhook, "decision-block", "tell me something harmful"); result.Action != interfaces.ActionBlock {
+			t.Fatalf("Expected the request to be blocked, got %v", result.Action)
+		}
+
+		receiver.mu.Lock()
+		defer receiver.mu.Unlock()
+		if receiver.deliveries != 1 {
+			t.Fatalf("Expected one webhook delivery, got %d", receiver.deliveries)
+		}
+		body, headers := receiver.bodies[0], receiver.headers[0]
+		timestamp, err := strconv.ParseInt(headers.Get(decisionwebhook.TimestampHeader), 10, 64)
+		if err != nil {
+			t.Fatalf("Expected a timestamp header, got %q", headers.Get(decisionwebhook.TimestampHeader))
+		}
+		if signature := headers.Get(decisionwebhook.SignatureHeader); signature != decisionwebhook.Sign(secret, timestamp, body) {
+			t.Errorf("Expected the batch to be signed with the shared secret, got %q", signature)
+		}
+
+		var batch decisionwebhook.Batch
+		if err := json.Unmarshal(body, &batch); err != nil {
+			t.Fatalf("Invalid webhook payload: %v", err)
+		}
+		if len(batch.Events) != 1 {
+			t.Fatalf("Expected one event, got %s", body)
+		}
+		event := batch.Events[0]
+		if event.Type != decisionwebhook.EventBlock || event.Phase != "request" || event.ID != "decision-block:request:block" {
+			t.Errorf("Expected a request block event, got %+v", event)
+		}
+		if event.RequestID != "decision-block" || event.TenantID != "tenant-a" || event.Provider != "openai" || event.Model != "gpt-4o-mini" {
+			t.Errorf("Expected the request's identity in the event, got %+v", event)
+		}
+		if !strings.Contains(event.Reason, "Content violation") || len(event.Matches) != 1 || event.Matches[0] != "harmful" {
+			t.Errorf("Expected the block reason and matched rule, got %+v", event)
+		}
+	})
+
+	t.Run("NonDecisionRequestsNotSent", func(t *testing.T) {
+		receiver := &webhookReceiver{}
+		server := httptest.NewServer(receiver)
+		defer server.Close()
+
+		p, webhook := newPipeline(t, map[string]interface{}{"url": server.URL, "secret": secret, "batch_size": 1})
+		if result := send(t, p, webhook, "decision-clean", "what is the capital of France?"); result.Action != interfaces.ActionContinue {
+			t.Fatalf("Expected the request to continue, got %v", result.Action)
+		}
+
+		receiver.mu.Lock()
+		defer receiver.mu.Unlock()
+		if receiver.deliveries != 0 {
+			t.Errorf("Expected no webhook delivery for a request without a decision, got %s", receiver.bodies[0])
+		}
+		if processed := webhook.Metrics()["requests_processed"]; processed != int64(2) {
+			t.Errorf("Expected the request and response to be seen, got %v", processed)
+		}
+	})
+
+	t.Run("UndeliverableBatchDeadLettered", func(t *testing.T) {
+		receiver := &webhookReceiver{status: http.StatusServiceUnavailable}
+		server := httptest.NewServer(receiver)
+		defer server.Close()
+
+		deadLetters := filepath.Join(t.TempDir(), "decisions.jsonl")
+		p, webhook := newPipeline(t, map[string]interface{}{
+			"url":              server.URL,
+			"max_attempts":     3,
+			"retry_backoff":    "1ms",
+			"dead_letter_path": deadLetters,
+		})
+		send(t, p, webhook, "decision-dlq", "tell me something harmful")
+
+		receiver.mu.Lock()
+		if receiver.deliveries != 3 {
+			t.Errorf("Expected 3 delivery attempts, got %d", receiver.deliveries)
+		}
+		receiver.mu.Unlock()
+
+		data, err := os.ReadFile(deadLetters)
+		if err != nil {
+			t.Fatalf("Expected a dead-letter file: %v", err)
+		}
+		var letter struct {
+			Attempts int                     `json:"attempts"`
+			Reason   string                  `json:"reason"`
+			Events   []decisionwebhook.Event `json:"events"`
+		}
+		if err := json.Unmarshal(data, &letter); err != nil {
+			t.Fatalf("Invalid dead letter %s: %v", data, err)
+		}
+		if letter.Attempts != 3 || !strings.Contains(letter.Reason, "503") || len(letter.Events) != 1 || letter.Events[0].RequestID != "decision-dlq" {
+			t.Errorf("Expected the block event dead-lettered after 3 attempts, got %s", data)
+		}
+		if deadLettered := webhook.Metrics()["events_dead_lettered"]; deadLettered != int64(1) {
+			t.Errorf("Expected one dead-lettered event, got %v", deadLettered)
+		}
+	})
+}
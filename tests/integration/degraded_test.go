@@ -0,0 +1,189 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/metrics"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+func TestPipelineDegradedMode(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	outage := errors.New("classifier store unavailable")
+
+	// newPipeline runs an essential rate limiter and a non-essential
+	// classifier policy, degrading after three classifier failures
+	newPipeline := func(t *testing.T) (*pipeline.Pipeline, *stubModule, *stubModule, *metrics.Registry) {
+		t.Helper()
+		essential := newStubModule("rate-limiter", interfaces.ModuleTypePolicy)
+		classifier := newStubModule("toxicity-policy", interfaces.ModuleTypePolicy)
+		registry := metrics.NewRegistry()
+
+		p := pipeline.NewPipeline(sugar)
+		p.SetMetrics(registry)
+		p.SetDegradedMode(pipeline.DegradedConfig{
+			FailureThreshold: 3,
+			Cooldown:         200 * time.Millisecond,
+			NonEssential:     []string{"toxicity-policy"},
+		})
+		for _, module := range []interfaces.Module{essential, classifier} {
+			if err := p.AddModule(module); err != nil {
+				t.Fatalf("Failed to add %s: %v", module.Name(), err)
+			}
+		}
+		return p, essential, classifier, registry
+	}
+	process := func(t *testing.T, p *pipeline.Pipeline) (*interfaces.ProcessRequestResult, *interfaces.ProcessRequestContext) {
+		t.Helper()
+		req := &interfaces.ProcessRequestContext{RequestID: "degraded-1", TenantID: "acme"}
+		result, err := p.ProcessRequest(ctx, req)
+		if err != nil {
+			t.Fatalf("ProcessRequest failed: %v", err)
+		}
+		return result, req
+	}
+
+	t.Run("NonEssentialBypassedDuringOutage", func(t *testing.T) {
+		p, essential, classifier, registry := newPipeline(t)
+		classifier.err = outage
+
+		// Below the threshold the failing policy fails closed as usual
+		for i := 0; i < 3; i++ {
+			if result, _ := process(t, p); result.Action != interfaces.ActionBlock {
+				t.Fatalf("Expected failure %d to block before degrading, got %v", i+1, result.Action)
+			}
+		}
+		status := p.DegradedStatus()
+		if !status.Degraded || status.Module != "toxicity-policy" || status.Reason != outage.Error() {
+			t.Fatalf("Expected the pipeline degraded by toxicity-policy, got %+v", status)
+		}
+		if degraded := testutil.ToFloat64(registry.PipelineDegraded.WithLabelValues()); degraded != 1 {
+			t.Errorf("Expected the degraded gauge set, got %v", degraded)
+		}
+
+		// Degraded: the classifier is skipped, the rate limiter still runs
+		essentialCalls, classifierCalls := essential.calls, classifier.calls
+		for i := 0; i < 5; i++ {
+			result, req := process(t, p)
+			if result.Action != interfaces.ActionContinue {
+				t.Fatalf("Expected traffic to flow while degraded, got %v: %s", result.Action, result.BlockReason)
+			}
+			if req.Annotations[pipeline.DegradedAnnotation] != true {
+				t.Errorf("Expected the request annotated as degraded, got %v", req.Annotations)
+			}
+		}
+		if essential.calls != essentialCalls+5 {
+			t.Errorf("Expected the essential policy to run on every request, ran %d times", essential.calls-essentialCalls)
+		}
+		if classifier.calls != classifierCalls {
+			t.Errorf("Expected the non-essential policy bypassed, ran %d times", classifier.calls-classifierCalls)
+		}
+		if skipped := testutil.ToFloat64(registry.ModuleSkips.WithLabelValues("toxicity-policy", "policy", pipeline.SkipReasonDegraded)); skipped != 5 {
+			t.Errorf("Expected five degraded skips counted, got %v", skipped)
+		}
+
+		// Essential policies still fail closed while degraded
+		essential.err = outage
+		if result, _ := process(t, p); result.Action != interfaces.ActionBlock {
+			t.Errorf("Expected a failing essential policy to still block, got %v", result.Action)
+		}
+		essential.err = nil
+	})
+
+	t.Run("RecoversAfterCooldown", func(t *testing.T) {
+		p, _, classifier, registry := newPipeline(t)
+		classifier.err = outage
+		for i := 0; i < 3; i++ {
+			process(t, p)
+		}
+		if !p.DegradedStatus().Degraded {
+			t.Fatal("Expected the pipeline degraded")
+		}
+
+		// Still down after the cooldown: one failure degrades it again
+		time.Sleep(250 * time.Millisecond)
+		if result, _ := process(t, p); result.Action != interfaces.ActionBlock {
+			t.Fatalf("Expected the first request after the cooldown to try the classifier, got %v", result.Action)
+		}
+		if !p.DegradedStatus().Degraded {
+			t.Fatal("Expected a single failure after the cooldown to degrade the pipeline again")
+		}
+
+		// Restored: the classifier runs again and the pipeline recovers
+		classifier.err = nil
+		time.Sleep(250 * time.Millisecond)
+		calls := classifier.calls
+		result, req := process(t, p)
+		if result.Action != interfaces.ActionContinue || classifier.calls != calls+1 {
+			t.Fatalf("Expected the restored classifier to run, got %v after %d calls", result.Action, classifier.calls-calls)
+		}
+		if req.Annotations[pipeline.DegradedAnnotation] != nil {
+			t.Errorf("Expected no degraded annotation after recovery, got %v", req.Annotations)
+		}
+		if status := p.DegradedStatus(); status.Degraded {
+			t.Errorf("Expected the pipeline recovered, got %+v", status)
+		}
+		if degraded := testutil.ToFloat64(registry.PipelineDegraded.WithLabelValues()); degraded != 0 {
+			t.Errorf("Expected the degraded gauge cleared, got %v", degraded)
+		}
+	})
+
+	t.Run("InFlightRequestKeepsDegradedState", func(t *testing.T) {
+		p, _, classifier, _ := newPipeline(t)
+		classifier.err = outage
+		for i := 0; i < 3; i++ {
+			process(t, p)
+		}
+
+		// A request already running when degraded mode is reconfigured keeps
+		// bypassing the classifier under the configuration it started with
+		inspector := newGenerationModule("g1", interfaces.ModuleTypeInspector)
+		inspector.entered = make(chan struct{})
+		inspector.release = make(chan struct{})
+		if err := p.AddModule(inspector); err != nil {
+			t.Fatalf("Failed to add inspector: %v", err)
+		}
+		calls := classifier.calls
+		done := make(chan *interfaces.ProcessRequestResult)
+		go func() {
+			result, _ := p.ProcessRequest(ctx, &interfaces.ProcessRequestContext{RequestID: "degraded-2", TenantID: "acme"})
+			done <- result
+		}()
+		<-inspector.entered
+		p.SetDegradedMode(pipeline.DegradedConfig{})
+		close(inspector.release)
+
+		if result := <-done; result.Action != interfaces.ActionContinue {
+			t.Errorf("Expected the in-flight request to bypass the classifier, got %v: %s", result.Action, result.BlockReason)
+		}
+		if classifier.calls != calls {
+			t.Errorf("Expected the classifier bypassed, ran %d times", classifier.calls-calls)
+		}
+	})
+
+	t.Run("SuccessResetsFailures", func(t *testing.T) {
+		p, _, classifier, _ := newPipeline(t)
+		for i := 0; i < 6; i++ {
+			classifier.err = nil
+			if i%3 != 2 {
+				classifier.err = outage
+			}
+			process(t, p)
+		}
+		if status := p.DegradedStatus(); status.Degraded {
+			t.Errorf("Expected intermittent failures not to degrade the pipeline, got %+v", status)
+		}
+	})
+}
@@ -0,0 +1,185 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/bendiamant/leash-gateway/internal/envelope"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/audit"
+	modulelogger "github.com/bendiamant/leash-gateway/internal/modules/core/logger"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"go.uber.org/zap"
+)
+
+func TestBodyEncryption(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	key := func(id string, fill byte) envelope.Key {
+		return envelope.Key{ID: id, Material: bytes.Repeat([]byte{fill}, 32)}
+	}
+	keystore, err := envelope.NewStaticKeystore(map[string][]envelope.Key{
+		"tenant-a": {key("a-2", 2), key("a-1", 1)},
+		"tenant-b": {key("b-1", 3)},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create keystore: %v", err)
+	}
+	encryptor := envelope.NewEncryptor(keystore)
+
+	prompt := []byte(`{"messages":[{"role":"user","content":"quarterly secret plans"}]}`)
+	response := []byte(`{"error":{"message":"upstream failed on secret plans"}}`)
+
+	t.Run("LoggerCapturesAreCiphertext", func(t *testing.T) {
+		output := &syncBuffer{}
+		sink := modulelogger.NewLogger(sugar)
+		sink.SetOutput(output)
+		sink.SetBodyEncryptor(encryptor)
+		if err := sink.Initialize(ctx, &interfaces.ModuleConfig{
+			Name: "logger", Type: "sink", Enabled: true,
+			Config: map[string]interface{}{
+				"log_requests":     false,
+				"redact_pii":       false,
+				"capture_on_error": true,
+			},
+		}); err != nil {
+			t.Fatalf("Failed to initialize logger: %v", err)
+		}
+
+		req := &interfaces.ProcessRequestContext{RequestID: "enc-req", TenantID: "tenant-a", Body: prompt}
+		sink.ProcessRequest(ctx, req)
+		sink.ProcessResponse(ctx, &interfaces.ProcessResponseContext{
+			ProcessRequestContext: req,
+			StatusCode:            http.StatusBadGateway,
+			ResponseBody:          response,
+		})
+
+		output.mu.Lock()
+		written := output.buf.String()
+		output.mu.Unlock()
+		if written == "" {
+			t.Fatal("Expected the failed request to be captured")
+		}
+		if strings.Contains(written, "secret plans") {
+			t.Fatalf("Expected bodies to be written encrypted, got %s", written)
+		}
+
+		var entry struct {
+			RequestBody  *envelope.Envelope `json:"request_body"`
+			ResponseBody *envelope.Envelope `json:"response_body"`
+		}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(written)), &entry); err != nil {
+			t.Fatalf("Invalid capture %q: %v", written, err)
+		}
+		for _, body := range []struct {
+			sealed    *envelope.Envelope
+			plaintext []byte
+		}{{entry.RequestBody, prompt}, {entry.ResponseBody, response}} {
+			if body.sealed == nil || body.sealed.KeyID != "a-2" {
+				t.Fatalf("Expected an envelope under the tenant's current key, got %+v", body.sealed)
+			}
+			decrypted, err := encryptor.Decrypt("tenant-a", body.sealed)
+			if err != nil {
+				t.Fatalf("Failed to decrypt with the tenant key: %v", err)
+			}
+			if !bytes.Equal(decrypted, body.plaintext) {
+				t.Errorf("Expected %s to round-trip, got %s", body.plaintext, decrypted)
+			}
+			if _, err := encryptor.Decrypt("tenant-b", body.sealed); err == nil {
+				t.Error("Expected another tenant to be unable to decrypt the body")
+			}
+		}
+	})
+
+	t.Run("AuditBodiesAreCiphertext", func(t *testing.T) {
+		auditor := audit.NewAuditor(sugar)
+		auditor.SetBodyEncryptor(encryptor)
+		if err := auditor.Initialize(ctx, &interfaces.ModuleConfig{
+			Name: "audit", Type: "sink", Enabled: true,
+			Config: map[string]interface{}{
+				"retention": map[string]interface{}{"prompt": "30d", "response": "30d"},
+			},
+		}); err != nil {
+			t.Fatalf("Failed to initialize audit module: %v", err)
+		}
+
+		req := &interfaces.ProcessRequestContext{RequestID: "enc-audit", TenantID: "tenant-b", Body: prompt}
+		auditor.ProcessRequest(ctx, req)
+		auditor.ProcessResponse(ctx, &interfaces.ProcessResponseContext{
+			ProcessRequestContext: req,
+			StatusCode:            http.StatusOK,
+			ResponseBody:          response,
+		})
+
+		record, err := auditor.GetRecord("enc-audit")
+		if err != nil {
+			t.Fatalf("Expected audit record: %v", err)
+		}
+		for field, plaintext := range map[string][]byte{audit.FieldPrompt: prompt, audit.FieldResponse: response} {
+			sealed, ok := record.Fields[field].(*envelope.Envelope)
+			if !ok {
+				t.Fatalf("Expected %s to be stored as an envelope, got %T", field, record.Fields[field])
+			}
+			if bytes.Contains(sealed.Ciphertext, []byte("secret plans")) {
+				t.Errorf("Expected %s ciphertext not to contain the body", field)
+			}
+			decrypted, err := encryptor.Decrypt("tenant-b", sealed)
+			if err != nil || !bytes.Equal(decrypted, plaintext) {
+				t.Errorf("Expected %s to round-trip, got %s (%v)", field, decrypted, err)
+			}
+		}
+	})
+
+	t.Run("TenantWithoutKeyIsNotStored", func(t *testing.T) {
+		auditor := audit.NewAuditor(sugar)
+		auditor.SetBodyEncryptor(encryptor)
+		auditor.Initialize(ctx, &interfaces.ModuleConfig{
+			Name: "audit", Type: "sink", Enabled: true,
+			Config: map[string]interface{}{
+				"retention": map[string]interface{}{"prompt": "30d", "response": "30d"},
+			},
+		})
+		auditor.ProcessRequest(ctx, &interfaces.ProcessRequestContext{RequestID: "no-key", TenantID: "tenant-c", Body: prompt})
+
+		record, err := auditor.GetRecord("no-key")
+		if err != nil {
+			t.Fatalf("Expected audit record: %v", err)
+		}
+		if _, exists := record.Fields[audit.FieldPrompt]; exists {
+			t.Errorf("Expected the prompt of a tenant without a key to be left out, got %v", record.Fields[audit.FieldPrompt])
+		}
+		if _, err := encryptor.Encrypt("tenant-c", prompt); !errors.Is(err, envelope.ErrNoTenantKey) {
+			t.Errorf("Expected ErrNoTenantKey, got %v", err)
+		}
+	})
+
+	t.Run("RetiredKeyStillDecrypts", func(t *testing.T) {
+		before, _ := envelope.NewStaticKeystore(map[string][]envelope.Key{"tenant-a": {key("a-1", 1)}})
+		sealed, err := envelope.NewEncryptor(before).Encrypt("tenant-a", prompt)
+		if err != nil {
+			t.Fatalf("Failed to encrypt: %v", err)
+		}
+		decrypted, err := encryptor.Decrypt("tenant-a", sealed)
+		if err != nil || !bytes.Equal(decrypted, prompt) {
+			t.Errorf("Expected a body under a retired key to decrypt after rotation, got %s (%v)", decrypted, err)
+		}
+	})
+
+	t.Run("InvalidKeysRejected", func(t *testing.T) {
+		if _, err := envelope.NewStaticKeystore(map[string][]envelope.Key{"tenant-a": {{ID: "short", Material: []byte("short")}}}); err == nil {
+			t.Error("Expected a key that is not 256 bits to be rejected")
+		}
+		if _, err := envelope.ParseKey("bad", "not base64!"); err == nil {
+			t.Error("Expected a key that is not base64 to be rejected")
+		}
+	})
+}
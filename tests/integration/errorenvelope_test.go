@@ -0,0 +1,197 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/gatewayerrors"
+	"github.com/bendiamant/leash-gateway/internal/modulehost"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"github.com/bendiamant/leash-gateway/internal/providers"
+	"github.com/bendiamant/leash-gateway/internal/providers/base"
+	"go.uber.org/zap"
+)
+
+// envelopeOf decodes the {"error": {...}} envelope of a response body
+func envelopeOf(t *testing.T, body []byte) gatewayerrors.ErrorResponse {
+	t.Helper()
+	var envelope struct {
+		Error *gatewayerrors.ErrorResponse `json:"error"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil || envelope.Error == nil {
+		t.Fatalf("Expected an error envelope, got %s (%v)", body, err)
+	}
+	return *envelope.Error
+}
+
+func TestStructuredErrorResponses(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+
+	newServer := func(t *testing.T, p *pipeline.Pipeline, envelopes bool) *httptest.Server {
+		service := modulehost.NewService(p, sugar)
+		service.SetErrorEnvelope(envelopes)
+		server := httptest.NewServer(modulehost.NewHTTPHandler(service, false, 0))
+		t.Cleanup(server.Close)
+		return server
+	}
+	post := func(t *testing.T, server *httptest.Server, body string) (int, []byte) {
+		t.Helper()
+		resp, err := http.Post(server.URL+"/process", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		payload, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, payload
+	}
+	request := `{"request_id":"env-1","tenant_id":"tenant-a","model":"gpt-4o-mini"}`
+
+	t.Run("PolicyBlock", func(t *testing.T) {
+		for reason, expected := range map[string]gatewayerrors.ErrorResponse{
+			"rate_limit_exceeded":                          {Source: "policy", Code: "rate_limit_exceeded", Status: http.StatusTooManyRequests},
+			"Content violation: matched keywords [secret]": {Source: "policy", Code: "policy_violation", Status: http.StatusForbidden},
+		} {
+			policy := newStubModule("policy", interfaces.ModuleTypePolicy)
+			policy.result = &interfaces.ProcessRequestResult{Action: interfaces.ActionBlock, BlockReason: reason}
+			p := pipeline.NewPipeline(sugar)
+			if err := p.AddModule(policy); err != nil {
+				t.Fatalf("Failed to add module: %v", err)
+			}
+
+			status, body := post(t, newServer(t, p, true), request)
+			if status != http.StatusOK {
+				t.Fatalf("Expected the block decision with 200, got %d: %s", status, body)
+			}
+			var decision map[string]interface{}
+			json.Unmarshal(body, &decision)
+			if decision["action"] != "block" || decision["block_reason"] != reason {
+				t.Errorf("Expected the block decision to be kept, got %v", decision)
+			}
+			blocked := envelopeOf(t, body)
+			if blocked.Source != expected.Source || blocked.Code != expected.Code || blocked.Status != expected.Status {
+				t.Errorf("Block %q: expected %s/%s/%d, got %+v", reason, expected.Source, expected.Code, expected.Status, blocked)
+			}
+			if blocked.RequestID != "env-1" || blocked.Message == "" || strings.Contains(blocked.Message, "secret") {
+				t.Errorf("Block %q: expected a client-safe message for env-1, got %+v", reason, blocked)
+			}
+		}
+	})
+
+	t.Run("ProviderUnavailable", func(t *testing.T) {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":{"message":"upstream overloaded on shard us-east-7"}}`))
+		}))
+		defer upstream.Close()
+
+		newRegistry := func(t *testing.T, envelopes bool) *providers.Registry {
+			registry := providers.NewRegistry(sugar)
+			registry.SetErrorEnvelope(envelopes)
+			if err := registry.InitializeFromConfig(map[string]*base.ProviderConfig{
+				"openai": {
+					Type:     "openai",
+					Endpoint: upstream.URL,
+					Timeout:  time.Second,
+					CircuitBreaker: base.CircuitBreakerConfig{
+						FailureThreshold: 50,
+						Timeout:          time.Minute,
+					},
+					Models: []base.ModelConfig{{Name: "gpt-4o-mini"}},
+				},
+			}); err != nil {
+				t.Fatalf("Failed to initialize providers: %v", err)
+			}
+			return registry
+		}
+		route := func(t *testing.T, registry *providers.Registry) *base.ProviderResponse {
+			t.Helper()
+			resp, err := registry.RouteRequest(context.Background(), &base.ProviderRequest{
+				RequestID: "env-2",
+				Model:     "gpt-4o-mini",
+				Messages:  []base.Message{{Role: "user", Content: "hi"}},
+			})
+			if err != nil {
+				t.Fatalf("Expected the upstream response, got %v", err)
+			}
+			return resp
+		}
+
+		resp := route(t, newRegistry(t, true))
+		if resp.StatusCode != http.StatusBadGateway || resp.Metadata[providers.UpstreamStatusKey] != "503" {
+			t.Errorf("Expected the provider 503 answered as 502, got %d (%v)", resp.StatusCode, resp.Metadata)
+		}
+		failed := envelopeOf(t, resp.Body)
+		if failed.Source != gatewayerrors.SourceProvider || failed.Code != gatewayerrors.CodeProviderUnavailable {
+			t.Errorf("Expected a provider_unavailable provider error, got %+v", failed)
+		}
+		if strings.Contains(failed.Message, "shard") || !strings.Contains(failed.Message, "openai") {
+			t.Errorf("Expected a client-safe message naming the provider, got %q", failed.Message)
+		}
+		if resp.Headers["Content-Type"] != "application/json" {
+			t.Errorf("Expected a JSON envelope, got headers %v", resp.Headers)
+		}
+
+		// Without envelopes the upstream response passes through
+		resp = route(t, newRegistry(t, false))
+		if resp.StatusCode != http.StatusServiceUnavailable || !bytes.Contains(resp.Body, []byte("shard")) {
+			t.Errorf("Expected the upstream 503 unchanged, got %d: %s", resp.StatusCode, resp.Body)
+		}
+	})
+
+	t.Run("InternalGatewayError", func(t *testing.T) {
+		p := pipeline.NewPipeline(sugar)
+		if err := p.Drain(context.Background()); err != nil {
+			t.Fatalf("Failed to drain pipeline: %v", err)
+		}
+
+		status, body := post(t, newServer(t, p, true), request)
+		if status != http.StatusInternalServerError {
+			t.Fatalf("Expected 500 from a failing pipeline, got %d: %s", status, body)
+		}
+		failed := envelopeOf(t, body)
+		if failed.Source != gatewayerrors.SourceGateway || failed.Code != gatewayerrors.CodeInternal || failed.Status != http.StatusInternalServerError {
+			t.Errorf("Expected a gateway internal_error, got %+v", failed)
+		}
+		if strings.Contains(failed.Message, "drain") {
+			t.Errorf("Expected internal detail kept out of the message, got %q", failed.Message)
+		}
+
+		// Client errors keep their message and carry the gateway source
+		status, body = post(t, newServer(t, p, true), `{"tenant_id":`)
+		if invalid := envelopeOf(t, body); status != http.StatusBadRequest || invalid.Code != gatewayerrors.CodeInvalidRequest {
+			t.Errorf("Expected a 400 invalid_request, got %d %+v", status, invalid)
+		}
+		resp, err := http.Get(newServer(t, p, true).URL + "/process")
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		payload, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if notAllowed := envelopeOf(t, payload); resp.StatusCode != http.StatusMethodNotAllowed || notAllowed.Code != gatewayerrors.CodeMethodNotAllowed {
+			t.Errorf("Expected a 405 method_not_allowed, got %d %+v", resp.StatusCode, notAllowed)
+		}
+
+		// Without envelopes errors keep the plain message
+		_, body = post(t, newServer(t, p, false), request)
+		var plain map[string]interface{}
+		if err := json.Unmarshal(body, &plain); err != nil {
+			t.Fatalf("Failed to decode error: %v", err)
+		}
+		if _, ok := plain["error"].(string); !ok {
+			t.Errorf("Expected a plain error message, got %s", body)
+		}
+	})
+}
@@ -0,0 +1,152 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/metrics"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/fingerprint"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+func TestRequestFingerprint(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	now := time.Date(2026, time.October, 16, 12, 0, 0, 0, time.UTC)
+	newModule := func(t *testing.T, config map[string]interface{}) (*fingerprint.RequestFingerprint, *metrics.Registry) {
+		t.Helper()
+		module := fingerprint.NewRequestFingerprint(sugar)
+		registry := metrics.NewRegistry()
+		module.SetMetrics(registry)
+		module.SetClock(func() time.Time { return now })
+		if err := module.Initialize(ctx, &interfaces.ModuleConfig{
+			Name: "request-fingerprint", Type: "inspector", Enabled: true, Config: config,
+		}); err != nil {
+			t.Fatalf("Failed to initialize request fingerprint: %v", err)
+		}
+		module.Start(ctx)
+		return module, registry
+	}
+	request := func(ip, agent, tenant, key string) *interfaces.ProcessRequestContext {
+		return &interfaces.ProcessRequestContext{
+			RequestID: fmt.Sprintf("%s-%s", tenant, key),
+			TenantID:  tenant,
+			ClientIP:  ip,
+			UserAgent: agent,
+			Headers:   map[string]string{"authorization": "Bearer " + key},
+		}
+	}
+	process := func(t *testing.T, module *fingerprint.RequestFingerprint, req *interfaces.ProcessRequestContext) map[string]interface{} {
+		t.Helper()
+		result, err := module.ProcessRequest(ctx, req)
+		if err != nil {
+			t.Fatalf("ProcessRequest failed: %v", err)
+		}
+		if result.Action != interfaces.ActionContinue {
+			t.Fatalf("Expected requests to continue, got %v", result.Action)
+		}
+		return result.Annotations
+	}
+	config := map[string]interface{}{"window": "10m", "max_tenants": 3, "max_keys": 3}
+
+	t.Run("OneClientAcrossManyTenantsIsFlagged", func(t *testing.T) {
+		module, registry := newModule(t, config)
+
+		var annotations map[string]interface{}
+		for i := 1; i <= 4; i++ {
+			key := fmt.Sprintf("sk-proj-%032d", i)
+			annotations = process(t, module, request("203.0.113.9", "python-requests/2.31", fmt.Sprintf("tenant-%d", i), key))
+			if i <= 3 && annotations["fingerprint_anomaly"] != nil {
+				t.Fatalf("Expected no flag within the limit at tenant %d, got %v", i, annotations)
+			}
+		}
+		if annotations["fingerprint_anomaly"] != true || annotations["fingerprint_tenants"] != 4 || annotations["fingerprint_keys"] != 4 {
+			t.Fatalf("Expected the fourth tenant and key flagged, got %v", annotations)
+		}
+		if reasons, _ := annotations["fingerprint_anomaly_reasons"].([]string); len(reasons) != 2 {
+			t.Errorf("Expected tenant and key reasons, got %v", annotations["fingerprint_anomaly_reasons"])
+		}
+		for _, reason := range []string{fingerprint.ReasonTenants, fingerprint.ReasonKeys} {
+			if flagged := testutil.ToFloat64(registry.FingerprintAnomalies.WithLabelValues(reason)); flagged != 1 {
+				t.Errorf("Expected one %s anomaly recorded, got %v", reason, flagged)
+			}
+		}
+
+		// Keys of the same issuer and length share a fingerprint, and keys
+		// are never annotated
+		first := process(t, module, request("203.0.113.9", "python-requests/2.31", "tenant-1", fmt.Sprintf("sk-proj-%032d", 1)))
+		if first["request_fingerprint"] != annotations["request_fingerprint"] {
+			t.Errorf("Expected one fingerprint across keys, got %v and %v", first["request_fingerprint"], annotations["request_fingerprint"])
+		}
+		for name, value := range first {
+			if text, ok := value.(string); ok && len(text) > 16 {
+				t.Errorf("Expected only the short fingerprint annotated, got %s=%q", name, text)
+			}
+		}
+
+		// Tenants outside the window are forgotten
+		now = now.Add(11 * time.Minute)
+		defer func() { now = now.Add(-11 * time.Minute) }()
+		if later := process(t, module, request("203.0.113.9", "python-requests/2.31", "tenant-9", fmt.Sprintf("sk-proj-%032d", 9))); later["fingerprint_anomaly"] != nil {
+			t.Errorf("Expected the window to have expired, got %v", later)
+		}
+	})
+
+	t.Run("NormalDiversityIsNotFlagged", func(t *testing.T) {
+		module, registry := newModule(t, config)
+
+		// Many clients each using their own tenant and key
+		for i := 1; i <= 20; i++ {
+			annotations := process(t, module, request(fmt.Sprintf("198.51.100.%d", i), "openai-python/1.40",
+				fmt.Sprintf("tenant-%d", i), fmt.Sprintf("sk-proj-%032d", i)))
+			if annotations["fingerprint_anomaly"] != nil {
+				t.Fatalf("Expected client %d not flagged, got %v", i, annotations)
+			}
+		}
+		// One client making many requests for its own tenant
+		for i := 0; i < 50; i++ {
+			if annotations := process(t, module, request("198.51.100.1", "openai-python/1.40", "tenant-1", fmt.Sprintf("sk-proj-%032d", 1))); annotations["fingerprint_anomaly"] != nil {
+				t.Fatalf("Expected repeated requests not flagged, got %v", annotations)
+			}
+		}
+		// A shared egress IP whose clients differ by user agent and key issuer
+		for i, client := range []struct{ agent, key string }{
+			{"openai-python/1.40", "sk-proj-aaaaaaaaaaaaaaaa"},
+			{"anthropic-sdk-go/0.2", "sk-ant-REDACTED"},
+			{"curl/8.5", "AIzaSyCcccccccccccccccccccccccccc"},
+			{"langchain/0.2", "sk-ant-REDACTED"},
+		} {
+			if annotations := process(t, module, request("192.0.2.1", client.agent, fmt.Sprintf("team-%d", i), client.key)); annotations["fingerprint_anomaly"] != nil {
+				t.Fatalf("Expected distinct clients behind one IP not flagged, got %v", annotations)
+			}
+		}
+		for _, reason := range []string{fingerprint.ReasonTenants, fingerprint.ReasonKeys} {
+			if flagged := testutil.ToFloat64(registry.FingerprintAnomalies.WithLabelValues(reason)); flagged != 0 {
+				t.Errorf("Expected no %s anomalies recorded, got %v", reason, flagged)
+			}
+		}
+	})
+
+	t.Run("InvalidConfig", func(t *testing.T) {
+		module := fingerprint.NewRequestFingerprint(sugar)
+		for name, invalid := range map[string]map[string]interface{}{
+			"UnknownComponent": {"components": []interface{}{"client_ip", "tls_ja3"}},
+			"NoComponents":     {"components": []interface{}{}},
+			"NegativeLimit":    {"max_tenants": -1},
+			"ZeroWindow":       {"window": "0s"},
+		} {
+			if err := module.ValidateConfig(&interfaces.ModuleConfig{Name: "request-fingerprint", Config: invalid}); err == nil {
+				t.Errorf("%s: expected the config rejected", name)
+			}
+		}
+	})
+}
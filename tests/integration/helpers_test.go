@@ -0,0 +1,94 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+)
+
+// stubModule is a configurable module for exercising pipeline behaviour
+type stubModule struct {
+	name       string
+	moduleType interfaces.ModuleType
+	priority   int
+	delay      time.Duration
+	timeout    time.Duration
+	result     *interfaces.ProcessRequestResult
+	err        error
+	conditions []interfaces.Condition
+	calls      int
+}
+
+// newStubModule creates a running stub module that continues every request
+func newStubModule(name string, moduleType interfaces.ModuleType) *stubModule {
+	return &stubModule{
+		name:       name,
+		moduleType: moduleType,
+		priority:   100,
+		result:     &interfaces.ProcessRequestResult{Action: interfaces.ActionContinue},
+	}
+}
+
+func (s *stubModule) Name() string                { return s.name }
+func (s *stubModule) Version() string             { return "0.0.0" }
+func (s *stubModule) Type() interfaces.ModuleType { return s.moduleType }
+func (s *stubModule) Description() string         { return "test stub" }
+func (s *stubModule) Author() string              { return "test" }
+func (s *stubModule) Dependencies() []string      { return []string{} }
+
+func (s *stubModule) Initialize(ctx context.Context, config *interfaces.ModuleConfig) error {
+	return nil
+}
+func (s *stubModule) Start(ctx context.Context) error    { return nil }
+func (s *stubModule) Stop(ctx context.Context) error     { return nil }
+func (s *stubModule) Shutdown(ctx context.Context) error { return nil }
+
+func (s *stubModule) Health(ctx context.Context) (*interfaces.HealthStatus, error) {
+	return &interfaces.HealthStatus{Status: interfaces.HealthStateHealthy, LastCheck: time.Now()}, nil
+}
+func (s *stubModule) Status() *interfaces.ModuleStatus {
+	return &interfaces.ModuleStatus{State: interfaces.ModuleStateRunning}
+}
+func (s *stubModule) Metrics() map[string]interface{} { return map[string]interface{}{} }
+
+func (s *stubModule) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequestContext) (*interfaces.ProcessRequestResult, error) {
+	s.calls++
+	if s.delay > 0 {
+		select {
+		case <-time.After(s.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.result, nil
+}
+
+func (s *stubModule) ProcessResponse(ctx context.Context, resp *interfaces.ProcessResponseContext) (*interfaces.ProcessResponseResult, error) {
+	return &interfaces.ProcessResponseResult{Action: interfaces.ActionContinue}, nil
+}
+
+func (s *stubModule) ValidateConfig(config *interfaces.ModuleConfig) error { return nil }
+func (s *stubModule) UpdateConfig(ctx context.Context, config *interfaces.ModuleConfig) error {
+	return nil
+}
+
+func (s *stubModule) GetConfig() *interfaces.ModuleConfig {
+	config := &interfaces.ModuleConfig{
+		Name:       s.name,
+		Type:       s.moduleType.String(),
+		Enabled:    true,
+		Priority:   s.priority,
+		Conditions: s.conditions,
+	}
+	if s.timeout > 0 {
+		config.Timeouts = &interfaces.Timeouts{Processing: s.timeout}
+	}
+	return config
+}
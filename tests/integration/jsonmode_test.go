@@ -0,0 +1,125 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/core/jsonmode"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"go.uber.org/zap"
+)
+
+func TestJSONModeEnforcement(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	jsonRequest := []byte(`{"model":"gpt-4o-mini","response_format":{"type":"json_object"},"messages":[{"role":"user","content":"reply in JSON"}]}`)
+	plainRequest := []byte(`{"model":"gpt-4o-mini","messages":[{"role":"user","content":"hello"}]}`)
+
+	// newPipeline runs the JSON mode module with the given config
+	newPipeline := func(t *testing.T, config map[string]interface{}) *pipeline.Pipeline {
+		module := jsonmode.NewJSONMode(sugar)
+		moduleConfig := &interfaces.ModuleConfig{Name: "json-mode", Enabled: true, Config: config}
+		if err := module.ValidateConfig(moduleConfig); err != nil {
+			t.Fatalf("Invalid config: %v", err)
+		}
+		module.Initialize(ctx, moduleConfig)
+		module.Start(ctx)
+
+		p := pipeline.NewPipeline(sugar)
+		p.AddModule(module)
+		return p
+	}
+	respond := func(t *testing.T, p *pipeline.Pipeline, request []byte, headers map[string]string, body []byte) *interfaces.ProcessResponseResult {
+		t.Helper()
+		result, err := p.ProcessResponse(ctx, &interfaces.ProcessResponseContext{
+			ProcessRequestContext: &interfaces.ProcessRequestContext{
+				RequestID: "json-mode",
+				TenantID:  "tenant-a",
+				Headers:   headers,
+				Body:      request,
+			},
+			StatusCode:   200,
+			ResponseBody: body,
+		})
+		if err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		return result
+	}
+
+	valid := choicesBody(t, `{"answer": 42}`)
+	invalid := choicesBody(t, `{"answer": 42}`, `Sure! {"answer": 42}`)
+
+	t.Run("ValidJSONPasses", func(t *testing.T) {
+		result := respond(t, newPipeline(t, nil), jsonRequest, nil, valid)
+		if result.Action != interfaces.ActionContinue || result.Annotations["json_mode_valid"] != true {
+			t.Errorf("Expected valid JSON to continue, got %s %v", result.Action, result.Annotations)
+		}
+	})
+
+	t.Run("NonJSONModeRequestsIgnored", func(t *testing.T) {
+		result := respond(t, newPipeline(t, nil), plainRequest, nil, invalid)
+		if result.Action != interfaces.ActionContinue || result.Annotations["json_mode_valid"] != nil {
+			t.Errorf("Expected requests without JSON mode to be ignored, got %s %v", result.Action, result.Annotations)
+		}
+	})
+
+	t.Run("InvalidJSONReturnsError", func(t *testing.T) {
+		result := respond(t, newPipeline(t, map[string]interface{}{"on_invalid": "error"}), jsonRequest, nil, invalid)
+		if result.Action != interfaces.ActionBlock || result.Metadata["status_code"] != "502" {
+			t.Fatalf("Expected a 502 block, got %s %v", result.Action, result.Metadata)
+		}
+		var body struct {
+			Error struct {
+				Type string `json:"type"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(result.ModifiedBody, &body); err != nil || body.Error.Type != "invalid_json_response" {
+			t.Errorf("Expected a normalized error body, got %s", result.ModifiedBody)
+		}
+		if choices, _ := result.Annotations["json_mode_invalid"].([]int); len(choices) != 1 || choices[0] != 1 {
+			t.Errorf("Expected choice 1 to be reported invalid, got %v", result.Annotations["json_mode_invalid"])
+		}
+	})
+
+	t.Run("InvalidJSONRetriesThenErrors", func(t *testing.T) {
+		p := newPipeline(t, map[string]interface{}{"on_invalid": "retry", "max_retries": 2})
+
+		headers := map[string]string{}
+		for attempt := 1; attempt <= 2; attempt++ {
+			result := respond(t, p, jsonRequest, headers, invalid)
+			if result.Action != interfaces.ActionRetry {
+				t.Fatalf("Attempt %d: expected retry, got %s", attempt, result.Action)
+			}
+			next := result.ModifiedHeaders[jsonmode.RetryAttemptHeader]
+			if next != strconv.Itoa(attempt) {
+				t.Fatalf("Attempt %d: expected retry header %d, got %q", attempt, attempt, next)
+			}
+			headers = map[string]string{"x-leash-retry-attempt": next}
+		}
+
+		if result := respond(t, p, jsonRequest, headers, invalid); result.Action != interfaces.ActionBlock {
+			t.Errorf("Expected an error once retries are exhausted, got %s", result.Action)
+		}
+		if result := respond(t, p, jsonRequest, headers, valid); result.Action != interfaces.ActionContinue {
+			t.Errorf("Expected a valid retried response to continue, got %s", result.Action)
+		}
+	})
+
+	t.Run("InvalidConfigRejected", func(t *testing.T) {
+		module := jsonmode.NewJSONMode(sugar)
+		for _, config := range []map[string]interface{}{{"on_invalid": "ignore"}, {"max_retries": -1}} {
+			if err := module.ValidateConfig(&interfaces.ModuleConfig{Config: config}); err == nil {
+				t.Errorf("Expected config %v to be rejected", config)
+			}
+		}
+	})
+}
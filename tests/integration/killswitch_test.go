@@ -0,0 +1,134 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bendiamant/leash-gateway/internal/admin"
+	"github.com/bendiamant/leash-gateway/internal/killswitch"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"go.uber.org/zap"
+)
+
+func TestKillSwitch(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	stub := newStubModule("stub-policy", interfaces.ModuleTypePolicy)
+	killSwitch := killswitch.New("")
+	modulePipeline := pipeline.NewPipeline(sugar)
+	modulePipeline.AddModule(stub)
+	modulePipeline.SetKillSwitch(killSwitch)
+
+	process := func(tenant, model string) *interfaces.ProcessRequestResult {
+		result, err := modulePipeline.ProcessRequest(ctx, &interfaces.ProcessRequestContext{
+			RequestID: "kill-switch-test",
+			TenantID:  tenant,
+			Model:     model,
+		})
+		if err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		return result
+	}
+
+	t.Run("GlobalBlocksAllRequests", func(t *testing.T) {
+		killSwitch.Engage(killswitch.Rule{Message: "incident in progress"})
+		defer killSwitch.ReleaseAll()
+
+		calls := stub.calls
+		for _, tenant := range []string{"tenant-a", "tenant-b"} {
+			result := process(tenant, "gpt-4o")
+			if result.Action != interfaces.ActionBlock || result.BlockReason != "incident in progress" {
+				t.Errorf("Expected %s to be blocked by the global kill switch, got %s: %s", tenant, result.Action, result.BlockReason)
+			}
+			if result.Annotations["kill_switch"] != "global" {
+				t.Errorf("Expected kill_switch annotation, got %v", result.Annotations)
+			}
+		}
+		if stub.calls != calls {
+			t.Errorf("Expected modules not to run while the kill switch is engaged")
+		}
+	})
+
+	t.Run("TenantScopedBlocksOnlyThatTenant", func(t *testing.T) {
+		killSwitch.Engage(killswitch.Rule{Tenant: "tenant-a"})
+		defer killSwitch.ReleaseAll()
+
+		if result := process("tenant-a", "gpt-4o"); result.Action != interfaces.ActionBlock || result.BlockReason != killswitch.DefaultMessage {
+			t.Errorf("Expected tenant-a to be blocked with the default message, got %s: %s", result.Action, result.BlockReason)
+		}
+		if result := process("tenant-b", "gpt-4o"); result.Action != interfaces.ActionContinue {
+			t.Errorf("Expected tenant-b to continue, got %s: %s", result.Action, result.BlockReason)
+		}
+	})
+
+	t.Run("ModelScopedGlob", func(t *testing.T) {
+		killSwitch.Engage(killswitch.Rule{Model: "gpt-4*"})
+		defer killSwitch.ReleaseAll()
+
+		if result := process("tenant-b", "gpt-4o-mini"); result.Action != interfaces.ActionBlock {
+			t.Errorf("Expected gpt-4o-mini to be blocked, got %s", result.Action)
+		}
+		if result := process("tenant-b", "claude-3-haiku"); result.Action != interfaces.ActionContinue {
+			t.Errorf("Expected claude-3-haiku to continue, got %s", result.Action)
+		}
+	})
+
+	t.Run("AdminAPI", func(t *testing.T) {
+		tokenHash := sha256.Sum256([]byte("admin-secret"))
+		auth := admin.NewTokenAuth([]string{hex.EncodeToString(tokenHash[:])})
+		server := httptest.NewServer(auth.Require(killSwitch.Handler()))
+		defer server.Close()
+		send := func(method, url, body, token string) *http.Response {
+			t.Helper()
+			req, _ := http.NewRequest(method, url, strings.NewReader(body))
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Admin request failed: %v", err)
+			}
+			resp.Body.Close()
+			return resp
+		}
+
+		engage := `{"tenant": "tenant-b", "message": "tenant suspended"}`
+		for _, token := range []string{"", "wrong-secret"} {
+			if resp := send(http.MethodPost, server.URL, engage, token); resp.StatusCode != http.StatusUnauthorized {
+				t.Errorf("Expected engaging with token %q to be unauthorized, got %d", token, resp.StatusCode)
+			}
+		}
+		if rules := killSwitch.Rules(); len(rules) != 0 {
+			t.Fatalf("Expected no rule engaged without a valid token, got %v", rules)
+		}
+
+		if resp := send(http.MethodPost, server.URL, engage, "admin-secret"); resp.StatusCode != http.StatusOK {
+			t.Fatalf("Failed to engage kill switch: %d", resp.StatusCode)
+		}
+		if result := process("tenant-b", "gpt-4o"); result.BlockReason != "tenant suspended" {
+			t.Errorf("Expected tenant-b to be blocked via the admin API, got %s: %s", result.Action, result.BlockReason)
+		}
+
+		if resp := send(http.MethodDelete, server.URL+"?all=true", "", ""); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected releasing without a token to be unauthorized, got %d", resp.StatusCode)
+		}
+		if resp := send(http.MethodDelete, server.URL+"?id=tenant:tenant-b", "", "admin-secret"); resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("Failed to release kill switch: %d", resp.StatusCode)
+		}
+		if result := process("tenant-b", "gpt-4o"); result.Action != interfaces.ActionContinue {
+			t.Errorf("Expected tenant-b to continue after release, got %s", result.Action)
+		}
+	})
+}
@@ -0,0 +1,178 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	modulelogger "github.com/bendiamant/leash-gateway/internal/modules/core/logger"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"go.uber.org/zap"
+)
+
+// syncBuffer collects log lines written from concurrent sinks
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// entries decodes the JSON log lines written so far
+func (b *syncBuffer) entries(t *testing.T) []map[string]interface{} {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Invalid log line %q: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestLoggerErrorCapture(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	newCapturePipeline := func(t *testing.T) (*pipeline.Pipeline, *stubModule, *syncBuffer) {
+		output := &syncBuffer{}
+		sink := modulelogger.NewLogger(sugar)
+		sink.SetOutput(output)
+		if err := sink.Initialize(ctx, &interfaces.ModuleConfig{
+			Name: "logger", Type: "sink", Enabled: true,
+			Config: map[string]interface{}{
+				"log_requests":     true,
+				"log_responses":    true,
+				"redact_pii":       true,
+				"capture_on_error": true,
+			},
+		}); err != nil {
+			t.Fatalf("Failed to initialize logger: %v", err)
+		}
+		sink.Start(ctx)
+
+		policy := newStubModule("guard", interfaces.ModuleTypePolicy)
+		p := pipeline.NewPipeline(sugar)
+		p.AddModule(policy)
+		p.AddModule(sink)
+		return p, policy, output
+	}
+	request := func(t *testing.T, id string) *interfaces.ProcessRequestContext {
+		return &interfaces.ProcessRequestContext{
+			RequestID: id,
+			TenantID:  "tenant-a",
+			Headers:   map[string]string{"authorization": "Bearer secret"},
+			Body:      chatBody(t, "contact me at jane@example.com"),
+		}
+	}
+	// roundTrip sends a request and, unless it is blocked, a response with
+	// the given status
+	roundTrip := func(t *testing.T, p *pipeline.Pipeline, req *interfaces.ProcessRequestContext, status int) {
+		t.Helper()
+		result, err := p.ProcessRequest(ctx, req)
+		if err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		if result.Action != interfaces.ActionBlock {
+			p.ProcessResponse(ctx, &interfaces.ProcessResponseContext{
+				ProcessRequestContext: req,
+				StatusCode:            status,
+				ResponseBody:          []byte(`{"error":{"message":"upstream failed"}}`),
+			})
+		}
+		p.Drain(ctx)
+	}
+	captures := func(entries []map[string]interface{}) []map[string]interface{} {
+		var found []map[string]interface{}
+		for _, entry := range entries {
+			if entry["type"] == "capture" {
+				found = append(found, entry)
+			}
+		}
+		return found
+	}
+
+	t.Run("SuccessLogsSummaryOnly", func(t *testing.T) {
+		p, _, output := newCapturePipeline(t)
+		roundTrip(t, p, request(t, "ok-req"), 200)
+
+		entries := output.entries(t)
+		if len(captures(entries)) != 0 {
+			t.Fatalf("Expected no full capture for a successful request, got %v", entries)
+		}
+		for _, entry := range entries {
+			if _, hasBody := entry["request_body"]; hasBody {
+				t.Errorf("Expected summaries without bodies, got %v", entry)
+			}
+		}
+		if len(entries) != 2 {
+			t.Errorf("Expected request and response summaries, got %d entries", len(entries))
+		}
+	})
+
+	t.Run("FailedRequestLogsFullDetail", func(t *testing.T) {
+		p, _, output := newCapturePipeline(t)
+		roundTrip(t, p, request(t, "failed-req"), 502)
+
+		found := captures(output.entries(t))
+		if len(found) != 1 {
+			t.Fatalf("Expected one full capture, got %v", found)
+		}
+		capture := found[0]
+		body, _ := capture["request_body"].(string)
+		if capture["outcome"] != "error" || capture["status_code"] != float64(502) {
+			t.Errorf("Expected an error capture with the status code, got %v", capture)
+		}
+		if !strings.Contains(body, "contact me at [REDACTED_EMAIL]") || strings.Contains(body, "jane@example.com") {
+			t.Errorf("Expected the redacted request body, got %q", body)
+		}
+		if !strings.Contains(capture["response_body"].(string), "upstream failed") {
+			t.Errorf("Expected the response body, got %v", capture["response_body"])
+		}
+		if headers, _ := capture["request_headers"].(map[string]interface{}); headers["authorization"] != "[REDACTED]" {
+			t.Errorf("Expected sensitive headers redacted, got %v", capture["request_headers"])
+		}
+	})
+
+	t.Run("BlockedRequestLogsFullDetail", func(t *testing.T) {
+		p, policy, output := newCapturePipeline(t)
+		policy.result = &interfaces.ProcessRequestResult{
+			Action:      interfaces.ActionBlock,
+			BlockReason: "denied by guard",
+			Metadata:    map[string]string{"status_code": "403"},
+		}
+		roundTrip(t, p, request(t, "blocked-req"), 0)
+
+		found := captures(output.entries(t))
+		if len(found) != 1 {
+			t.Fatalf("Expected one full capture, got %v", found)
+		}
+		capture := found[0]
+		if capture["outcome"] != "blocked" || capture["block_reason"] != "denied by guard" || capture["status_code"] != "403" {
+			t.Errorf("Expected a blocked capture with the reason, got %v", capture)
+		}
+		if body, _ := capture["request_body"].(string); !strings.Contains(body, "[REDACTED_EMAIL]") {
+			t.Errorf("Expected the redacted request body, got %q", body)
+		}
+	})
+}
@@ -0,0 +1,70 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"testing"
+
+	"github.com/bendiamant/leash-gateway/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTenantLabelPolicy(t *testing.T) {
+	t.Run("AllowlistCollapsesUnknownTenants", func(t *testing.T) {
+		registry := metrics.NewRegistry()
+		if err := registry.SetTenantLabelPolicy(metrics.TenantLabelPolicy{
+			Mode:      metrics.TenantLabelAllowlist,
+			Allowlist: []string{"tenant-a"},
+		}); err != nil {
+			t.Fatalf("Failed to set tenant label policy: %v", err)
+		}
+
+		registry.RecordModuleError("content-filter", "policy", "tenant-a", "error")
+		registry.RecordModuleError("content-filter", "policy", "ephemeral-1", "error")
+		registry.RecordModuleError("content-filter", "policy", "ephemeral-2", "error")
+
+		if got := testutil.ToFloat64(registry.ModuleErrors.WithLabelValues("content-filter", "policy", "tenant-a", "error")); got != 1 {
+			t.Errorf("Expected allowlisted tenant to keep its label, got %v", got)
+		}
+		if got := testutil.ToFloat64(registry.ModuleErrors.WithLabelValues("content-filter", "policy", "other", "error")); got != 2 {
+			t.Errorf("Expected unknown tenants to collapse to other, got %v", got)
+		}
+		if got := testutil.CollectAndCount(registry.ModuleErrors); got != 2 {
+			t.Errorf("Expected 2 series, got %d", got)
+		}
+	})
+
+	t.Run("HashBucketsUnknownTenants", func(t *testing.T) {
+		registry := metrics.NewRegistry()
+		if err := registry.SetTenantLabelPolicy(metrics.TenantLabelPolicy{
+			Mode:      metrics.TenantLabelHash,
+			Allowlist: []string{"tenant-a"},
+			Buckets:   4,
+		}); err != nil {
+			t.Fatalf("Failed to set tenant label policy: %v", err)
+		}
+
+		if label := registry.TenantLabel("tenant-a"); label != "tenant-a" {
+			t.Errorf("Expected allowlisted tenant to keep its label, got %s", label)
+		}
+		label := registry.TenantLabel("ephemeral-1")
+		if label != registry.TenantLabel("ephemeral-1") {
+			t.Errorf("Expected hashing to be stable")
+		}
+
+		for i := 0; i < 100; i++ {
+			registry.RecordBusinessMetrics("ephemeral-"+string(rune('a'+i%26))+string(rune('0'+i/26)), "openai", "gpt-4o", 1, 1, 0.01)
+		}
+		if got := testutil.CollectAndCount(registry.CostAccrued); got > 4 {
+			t.Errorf("Expected at most 4 tenant buckets, got %d series", got)
+		}
+	})
+
+	t.Run("InvalidPolicyRejected", func(t *testing.T) {
+		registry := metrics.NewRegistry()
+		if err := registry.SetTenantLabelPolicy(metrics.TenantLabelPolicy{Mode: metrics.TenantLabelHash}); err == nil {
+			t.Errorf("Expected hash mode without buckets to be rejected")
+		}
+	})
+}
@@ -0,0 +1,88 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/core/modelpolicy"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"go.uber.org/zap"
+)
+
+func TestModelPolicy(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	policy := modelpolicy.NewModelPolicy(sugar)
+	err := policy.Initialize(ctx, &interfaces.ModuleConfig{
+		Name: "model-policy", Type: "policy", Enabled: true, Priority: 50,
+		Config: map[string]interface{}{
+			"tenants": map[string]interface{}{
+				"tenant-a": map[string]interface{}{
+					"denied_models": []interface{}{"gpt-4o"},
+				},
+				"tenant-c": map[string]interface{}{
+					"allowed_models": []interface{}{"gpt-4o-mini", "claude-3-*"},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to initialize model policy: %v", err)
+	}
+	policy.Start(ctx)
+
+	modulePipeline := pipeline.NewPipeline(sugar)
+	modulePipeline.AddModule(policy)
+
+	t.Run("DeniedModelBlockedForTenantA", func(t *testing.T) {
+		req := &interfaces.ProcessRequestContext{
+			RequestID: "model-req-a",
+			TenantID:  "tenant-a",
+			Provider:  "openai",
+			Model:     "gpt-4o",
+		}
+
+		result, err := modulePipeline.ProcessRequest(ctx, req)
+		if err != nil {
+			t.Fatalf("Pipeline processing failed: %v", err)
+		}
+		if result.Action != interfaces.ActionBlock {
+			t.Fatalf("Expected gpt-4o to be blocked for tenant-a, got %s", result.Action)
+		}
+		if result.BlockReason != "model gpt-4o is denied for tenant tenant-a" {
+			t.Errorf("Unexpected block reason: %s", result.BlockReason)
+		}
+	})
+
+	t.Run("SameModelAllowedForTenantB", func(t *testing.T) {
+		req := &interfaces.ProcessRequestContext{
+			RequestID: "model-req-b",
+			TenantID:  "tenant-b",
+			Provider:  "openai",
+			Model:     "gpt-4o",
+		}
+
+		result, err := modulePipeline.ProcessRequest(ctx, req)
+		if err != nil {
+			t.Fatalf("Pipeline processing failed: %v", err)
+		}
+		if result.Action != interfaces.ActionContinue {
+			t.Errorf("Expected gpt-4o to be allowed for tenant-b, got %s: %s", result.Action, result.BlockReason)
+		}
+	})
+
+	t.Run("AllowListWithGlob", func(t *testing.T) {
+		if allowed, _ := policy.IsModelAllowed("tenant-c", "claude-3-sonnet-20240229"); !allowed {
+			t.Error("Expected claude-3 model to match the allowed glob")
+		}
+		if allowed, reason := policy.IsModelAllowed("tenant-c", "gpt-4o"); allowed || reason == "" {
+			t.Error("Expected gpt-4o to be rejected by tenant-c allow list")
+		}
+	})
+}
@@ -0,0 +1,226 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bendiamant/leash-gateway/internal/metrics"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/moderation"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+// moderationStub serves OpenAI-style moderation responses, scoring content
+// containing "attack" high for violence
+type moderationStub struct {
+	server *httptest.Server
+	calls  atomic.Int32
+	status atomic.Int32
+	inputs chan string
+}
+
+func newModerationStub(t *testing.T) *moderationStub {
+	stub := &moderationStub{inputs: make(chan string, 100)}
+	stub.status.Store(http.StatusOK)
+	stub.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stub.calls.Add(1)
+		if status := int(stub.status.Load()); status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		var body struct {
+			Model string `json:"model"`
+			Input string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		stub.inputs <- body.Input
+
+		scores := map[string]float64{"violence": 0.02, "harassment": 0.01, "self-harm": 0.001}
+		if strings.Contains(body.Input, "attack") {
+			scores["violence"] = 0.93
+			scores["harassment"] = 0.4
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":    "modr-1",
+			"model": body.Model,
+			"results": []map[string]interface{}{{
+				"flagged":         scores["violence"] > 0.5,
+				"category_scores": scores,
+			}},
+		})
+	}))
+	t.Cleanup(stub.server.Close)
+	return stub
+}
+
+func TestModerationIntegration(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	newPipeline := func(t *testing.T, config map[string]interface{}) (*pipeline.Pipeline, *metrics.Registry) {
+		t.Helper()
+		registry := metrics.NewRegistry()
+		inspector := moderation.NewModeration(sugar)
+		inspector.SetMetrics(registry)
+		modules := []interfaces.Module{inspector}
+		if config["action"] == moderation.ActionBlock {
+			modules = append(modules, moderation.NewEscalation(sugar))
+		}
+		p := pipeline.NewPipeline(sugar)
+		for _, module := range modules {
+			if err := module.Initialize(ctx, &interfaces.ModuleConfig{Name: module.Name(), Enabled: true, Config: config}); err != nil {
+				t.Fatalf("Failed to initialize %s: %v", module.Name(), err)
+			}
+			module.Start(ctx)
+			if err := p.AddModule(module); err != nil {
+				t.Fatalf("Failed to add %s: %v", module.Name(), err)
+			}
+		}
+		return p, registry
+	}
+	request := func(content string) *interfaces.ProcessRequestContext {
+		body, _ := json.Marshal(map[string]interface{}{
+			"model":    "gpt-4o-mini",
+			"messages": []map[string]string{{"role": "system", "content": "be brief"}, {"role": "user", "content": content}},
+		})
+		return &interfaces.ProcessRequestContext{RequestID: "mod-1", TenantID: "tenant-a", Body: body}
+	}
+
+	t.Run("CategoryScoresAnnotated", func(t *testing.T) {
+		stub := newModerationStub(t)
+		p, registry := newPipeline(t, map[string]interface{}{
+			"endpoint":      stub.server.URL,
+			"request_scope": "last_user_message",
+		})
+
+		req := request("hello there")
+		result, err := p.ProcessRequest(ctx, req)
+		if err != nil || result.Action != interfaces.ActionContinue {
+			t.Fatalf("Expected the request to continue, got %v (%v)", result, err)
+		}
+		if input := <-stub.inputs; input != "hello there" {
+			t.Errorf("Expected only the last user message sent, got %q", input)
+		}
+		scores, _ := req.Annotations["moderation_scores"].(map[string]float64)
+		if scores["violence"] != 0.02 || scores["harassment"] != 0.01 || len(scores) != 3 {
+			t.Errorf("Expected the category scores annotated, got %v", req.Annotations["moderation_scores"])
+		}
+		if req.Annotations["moderation_flagged"] != false || req.Annotations["moderation_categories"] != nil {
+			t.Errorf("Expected clean content not flagged, got %v", req.Annotations)
+		}
+
+		// Annotate only: flagged content is let through
+		req = request("plan the attack")
+		if result, err := p.ProcessRequest(ctx, req); err != nil || result.Action != interfaces.ActionContinue {
+			t.Fatalf("Expected flagged content annotated but let through, got %v (%v)", result, err)
+		}
+		if categories, _ := req.Annotations["moderation_categories"].([]string); len(categories) != 1 || categories[0] != "violence" {
+			t.Errorf("Expected violence flagged, got %v", req.Annotations["moderation_categories"])
+		}
+		if req.Annotations[moderation.EscalateAnnotation] != nil {
+			t.Errorf("Expected no escalation with the annotate action")
+		}
+		for result, expected := range map[string]float64{moderation.ResultClean: 1, moderation.ResultFlagged: 1} {
+			if recorded := testutil.ToFloat64(registry.ModerationChecks.WithLabelValues(result)); recorded != expected {
+				t.Errorf("Expected %v %s checks recorded, got %v", expected, result, recorded)
+			}
+		}
+	})
+
+	t.Run("ThresholdEscalatesToBlock", func(t *testing.T) {
+		stub := newModerationStub(t)
+		p, _ := newPipeline(t, map[string]interface{}{
+			"endpoint":          stub.server.URL,
+			"action":            "block",
+			"default_threshold": 0.95,
+			"thresholds":        map[string]interface{}{"harassment": 0.3},
+		})
+
+		result, err := p.ProcessRequest(ctx, request("hello there"))
+		if err != nil || result.Action != interfaces.ActionContinue {
+			t.Fatalf("Expected scores under the thresholds to continue, got %v (%v)", result, err)
+		}
+
+		// Violence at 0.93 is under the default 0.95; harassment at 0.4 is
+		// over its own 0.3
+		req := request("plan the attack")
+		result, err = p.ProcessRequest(ctx, req)
+		if err != nil {
+			t.Fatalf("ProcessRequest failed: %v", err)
+		}
+		if result.Action != interfaces.ActionBlock || result.BlockReason != moderation.BlockReason {
+			t.Fatalf("Expected the request blocked by moderation, got %v %q", result.Action, result.BlockReason)
+		}
+		if categories, _ := req.Annotations["moderation_categories"].([]string); len(categories) != 1 || categories[0] != "harassment" {
+			t.Errorf("Expected only harassment over its threshold, got %v", req.Annotations["moderation_categories"])
+		}
+	})
+
+	t.Run("CircuitOpensOnFailures", func(t *testing.T) {
+		stub := newModerationStub(t)
+		stub.status.Store(http.StatusInternalServerError)
+		p, registry := newPipeline(t, map[string]interface{}{
+			"endpoint": stub.server.URL,
+			"action":   "block",
+			"circuit_breaker": map[string]interface{}{
+				"failure_rate":  50,
+				"min_requests":  3,
+				"reset_timeout": "1h",
+			},
+		})
+
+		// Failures fail open, as inspector errors do
+		for i := 0; i < 3; i++ {
+			req := request("plan the attack")
+			if result, err := p.ProcessRequest(ctx, req); err != nil || result.Action != interfaces.ActionContinue {
+				t.Fatalf("Expected a failed check to fail open, got %v (%v)", result, err)
+			}
+		}
+		if calls := stub.calls.Load(); calls != 3 {
+			t.Fatalf("Expected three calls before the circuit opened, got %d", calls)
+		}
+
+		// With the circuit open the API is not called at all
+		req := request("plan the attack")
+		if result, err := p.ProcessRequest(ctx, req); err != nil || result.Action != interfaces.ActionContinue {
+			t.Fatalf("Expected the request to continue unmoderated, got %v (%v)", result, err)
+		}
+		if calls := stub.calls.Load(); calls != 3 {
+			t.Errorf("Expected no call while the circuit is open, got %d calls", calls)
+		}
+		if req.Annotations["moderation_skipped"] != "circuit_open" {
+			t.Errorf("Expected the request annotated as skipped, got %v", req.Annotations)
+		}
+		if failed := testutil.ToFloat64(registry.ModerationChecks.WithLabelValues(moderation.ResultFailed)); failed != 3 {
+			t.Errorf("Expected three failed checks recorded, got %v", failed)
+		}
+		if skipped := testutil.ToFloat64(registry.ModerationChecks.WithLabelValues(moderation.ResultSkipped)); skipped != 1 {
+			t.Errorf("Expected one skipped check recorded, got %v", skipped)
+		}
+	})
+
+	t.Run("InvalidConfig", func(t *testing.T) {
+		module := moderation.NewModeration(sugar)
+		for name, invalid := range map[string]map[string]interface{}{
+			"UnknownAction":     {"action": "quarantine"},
+			"ThresholdAboveOne": {"thresholds": map[string]interface{}{"violence": 1.5}},
+			"NoEndpoint":        {"endpoint": ""},
+			"BadScope":          {"request_scope": "first_message"},
+		} {
+			if err := module.ValidateConfig(&interfaces.ModuleConfig{Name: "moderation", Config: invalid}); err == nil {
+				t.Errorf("%s: expected the config rejected", name)
+			}
+		}
+	})
+}
@@ -0,0 +1,205 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/health"
+	"github.com/bendiamant/leash-gateway/internal/modulehost"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/modelpolicy"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// startModuleHost serves the module host gRPC API on a local port
+func startModuleHost(t *testing.T, modulePipeline *pipeline.Pipeline, sugar *zap.SugaredLogger) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	server := modulehost.NewGRPCServer(modulehost.NewService(modulePipeline, sugar), health.NewServer())
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	return listener.Addr().String()
+}
+
+func TestModuleHostCall(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	policy := modelpolicy.NewModelPolicy(sugar)
+	policy.Initialize(ctx, &interfaces.ModuleConfig{
+		Name: "model-policy",
+		Config: map[string]interface{}{
+			"tenants": map[string]interface{}{
+				"tenant-a": map[string]interface{}{"denied_models": []interface{}{"gpt-4o"}},
+			},
+		},
+	})
+	policy.Start(ctx)
+
+	modulePipeline := pipeline.NewPipeline(sugar)
+	modulePipeline.AddModule(policy)
+	addr := startModuleHost(t, modulePipeline, sugar)
+
+	t.Run("AllowedRequest", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		err := modulehost.RunCall([]string{"--addr", addr, "--tenant", "tenant-a", "--model", "gpt-4o-mini"}, &stdout, &stderr)
+		if err != nil {
+			t.Fatalf("Call failed: %v (%s)", err, stderr.String())
+		}
+		if !strings.Contains(stdout.String(), "action: continue") {
+			t.Errorf("Expected continue decision, got:\n%s", stdout.String())
+		}
+	})
+
+	t.Run("BlockedRequestFromFile", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "request.json")
+		content := `{"tenant_id": "tenant-a", "model": "gpt-4o", "body": {"messages": [{"role": "user", "content": "hi"}]}}`
+		if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+			t.Fatalf("Failed to write request file: %v", err)
+		}
+
+		var stdout, stderr bytes.Buffer
+		if err := modulehost.RunCall([]string{"--addr", addr, "--file", file}, &stdout, &stderr); err != nil {
+			t.Fatalf("Call failed: %v (%s)", err, stderr.String())
+		}
+		output := stdout.String()
+		if !strings.Contains(output, "action: block") {
+			t.Errorf("Expected block decision, got:\n%s", output)
+		}
+		if !strings.Contains(output, "block_reason: model gpt-4o is denied for tenant tenant-a") {
+			t.Errorf("Expected block reason in output, got:\n%s", output)
+		}
+	})
+
+	t.Run("MissingTenantRejected", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		err := modulehost.RunCall([]string{"--addr", addr, "--model", "gpt-4o"}, &stdout, &stderr)
+		if err == nil || !strings.Contains(err.Error(), "tenant_id is required") {
+			t.Errorf("Expected missing tenant error, got %v", err)
+		}
+	})
+
+	t.Run("ReflectionListsService", func(t *testing.T) {
+		dialCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+
+		conn, err := grpc.DialContext(dialCtx, addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			t.Fatalf("Failed to dial: %v", err)
+		}
+		defer conn.Close()
+
+		stream, err := grpc_reflection_v1alpha.NewServerReflectionClient(conn).ServerReflectionInfo(dialCtx)
+		if err != nil {
+			t.Fatalf("Failed to open reflection stream: %v", err)
+		}
+		if err := stream.Send(&grpc_reflection_v1alpha.ServerReflectionRequest{
+			MessageRequest: &grpc_reflection_v1alpha.ServerReflectionRequest_FileContainingSymbol{
+				FileContainingSymbol: modulehost.ServiceName,
+			},
+		}); err != nil {
+			t.Fatalf("Failed to send reflection request: %v", err)
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Reflection request failed: %v", err)
+		}
+		if resp.GetFileDescriptorResponse() == nil {
+			t.Errorf("Expected service descriptor, got %v", resp.GetErrorResponse())
+		}
+	})
+}
+
+func TestModuleHostBypassRoutes(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	policy := newStubModule("policy", interfaces.ModuleTypePolicy)
+	modulePipeline := pipeline.NewPipeline(sugar)
+	modulePipeline.AddModule(policy)
+
+	service := modulehost.NewService(modulePipeline, sugar)
+	if err := service.SetBypassRoutes([]modulehost.BypassRoute{
+		{Method: "OPTIONS", Path: "/**"},
+		{Method: "GET", Path: "/health"},
+	}); err != nil {
+		t.Fatalf("Failed to set bypass routes: %v", err)
+	}
+
+	process := func(t *testing.T, method, path string) map[string]interface{} {
+		t.Helper()
+
+		req, _ := structpb.NewStruct(map[string]interface{}{
+			"tenant_id": "tenant-a",
+			"method":    method,
+			"path":      path,
+		})
+		resp, err := service.ProcessRequest(ctx, req)
+		if err != nil {
+			t.Fatalf("ProcessRequest failed: %v", err)
+		}
+		return resp.AsMap()
+	}
+
+	for _, tc := range []struct{ method, path string }{
+		{"OPTIONS", "/v1/chat/completions"},
+		{"options", "/v1/chat/completions"},
+		{"GET", "/health"},
+		{"GET", "/health?probe=1"},
+	} {
+		decision := process(t, tc.method, tc.path)
+		annotations, _ := decision["annotations"].(map[string]interface{})
+		if decision["action"] != "continue" || annotations["pipeline_bypassed"] != true {
+			t.Errorf("Expected %s %s to bypass modules, got %v", tc.method, tc.path, decision)
+		}
+	}
+	if policy.calls != 0 {
+		t.Fatalf("Expected bypassed requests to skip modules, policy ran %d times", policy.calls)
+	}
+
+	// Bypassed requests need no tenant
+	req, _ := structpb.NewStruct(map[string]interface{}{"method": "GET", "path": "/health"})
+	if _, err := service.ProcessRequest(ctx, req); err != nil {
+		t.Errorf("Expected health ping without a tenant to bypass, got %v", err)
+	}
+
+	for _, tc := range []struct{ method, path string }{
+		{"POST", "/v1/chat/completions"},
+		{"POST", "/health"},
+		{"GET", "/healthz"},
+	} {
+		decision := process(t, tc.method, tc.path)
+		if annotations, _ := decision["annotations"].(map[string]interface{}); annotations["pipeline_bypassed"] == true {
+			t.Errorf("Expected %s %s to run through modules", tc.method, tc.path)
+		}
+	}
+	if policy.calls != 3 {
+		t.Errorf("Expected the policy to process 3 requests, got %d", policy.calls)
+	}
+
+	if err := service.SetBypassRoutes([]modulehost.BypassRoute{{Method: "GET", Path: "/[health"}}); err == nil {
+		t.Error("Expected an invalid path pattern to be rejected")
+	}
+}
@@ -0,0 +1,140 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/chatcontent"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/contentfilter"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/costtracker"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"go.uber.org/zap"
+)
+
+// multimodalBody builds a chat request whose user message is a content array
+// holding a text part and an inline image part
+func multimodalBody(t *testing.T, text string, image []byte) []byte {
+	t.Helper()
+
+	body, err := json.Marshal(map[string]interface{}{
+		"model": "gpt-4o",
+		"messages": []interface{}{
+			map[string]interface{}{"role": "system", "content": "You are a helpful assistant"},
+			map[string]interface{}{
+				"role": "user",
+				"content": []interface{}{
+					map[string]interface{}{"type": "text", "text": text},
+					map[string]interface{}{
+						"type": "image_url",
+						"image_url": map[string]interface{}{
+							"url":    "data:image/png;base64," + base64.StdEncoding.EncodeToString(image),
+							"detail": "high",
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal body: %v", err)
+	}
+	return body
+}
+
+func TestMultiModalContent(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	image := []byte(strings.Repeat("\x89PNG", 4096))
+
+	t.Run("PartsExtracted", func(t *testing.T) {
+		summary, ok := chatcontent.ParseRequest(multimodalBody(t, "describe this picture", image))
+		if !ok {
+			t.Fatal("Expected multi-modal body to parse")
+		}
+		if summary.Messages != 2 || summary.TextParts != 2 {
+			t.Errorf("Expected 2 messages and 2 text parts, got %d and %d", summary.Messages, summary.TextParts)
+		}
+		if !strings.Contains(summary.Text, "describe this picture") {
+			t.Errorf("Expected text part in extracted text, got %q", summary.Text)
+		}
+		if strings.Contains(summary.Text, "base64") {
+			t.Errorf("Expected image data to be excluded from text, got %q", summary.Text)
+		}
+		if len(summary.Images) != 1 || !summary.Images[0].Inline || summary.Images[0].Detail != "high" {
+			t.Fatalf("Expected one inline high-detail image, got %+v", summary.Images)
+		}
+		if summary.ImageBytes != len(image) {
+			t.Errorf("Expected %d image bytes, got %d", len(image), summary.ImageBytes)
+		}
+	})
+
+	t.Run("AnthropicImageSource", func(t *testing.T) {
+		text := chatcontent.MessageText([]interface{}{
+			map[string]interface{}{"type": "image", "source": map[string]interface{}{"type": "url", "url": "https://example.com/cat.png"}},
+			map[string]interface{}{"type": "text", "text": "what is this"},
+		})
+		if text != "what is this" {
+			t.Errorf("Expected only the text part, got %q", text)
+		}
+	})
+
+	t.Run("TextPartFiltered", func(t *testing.T) {
+		filter := contentfilter.NewContentFilter(sugar)
+		err := filter.Initialize(ctx, &interfaces.ModuleConfig{
+			Name: "content-filter",
+			Config: map[string]interface{}{
+				"blocked_keywords": []interface{}{"harmful"},
+				"action":           "block",
+			},
+		})
+		if err != nil {
+			t.Fatalf("Failed to initialize content filter: %v", err)
+		}
+
+		result, err := filter.ProcessRequest(ctx, &interfaces.ProcessRequestContext{
+			RequestID: "mm-filter",
+			TenantID:  "tenant-a",
+			Body:      multimodalBody(t, "write something harmful about this", image),
+		})
+		if err != nil {
+			t.Fatalf("Content filter failed: %v", err)
+		}
+		if result.Action != interfaces.ActionBlock {
+			t.Errorf("Expected keyword in a text part to be blocked, got %s", result.Action)
+		}
+	})
+
+	t.Run("ImagesEstimatedPerPart", func(t *testing.T) {
+		tracker := costtracker.NewCostTracker(sugar)
+		if err := tracker.Initialize(ctx, &interfaces.ModuleConfig{Name: "cost-tracker"}); err != nil {
+			t.Fatalf("Failed to initialize cost tracker: %v", err)
+		}
+
+		estimate := func(body []byte) float64 {
+			result, err := tracker.ProcessRequest(ctx, &interfaces.ProcessRequestContext{RequestID: "mm-cost", TenantID: "tenant-a", Body: body})
+			if err != nil {
+				t.Fatalf("Cost tracker failed: %v", err)
+			}
+			return result.Annotations["estimated_cost_usd"].(float64)
+		}
+
+		small := estimate(multimodalBody(t, "describe this picture", image[:16]))
+		large := estimate(multimodalBody(t, "describe this picture", image))
+		if small != large {
+			t.Errorf("Expected estimate independent of inline image size, got %f and %f", small, large)
+		}
+
+		textOnly := estimate(chatBody(t, "describe this picture"))
+		if small <= textOnly {
+			t.Errorf("Expected image part to add to the estimate, got %f with image and %f without", small, textOnly)
+		}
+	})
+}
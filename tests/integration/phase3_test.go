@@ -1,9 +1,11 @@
+//go:build integration
 // +build integration
 
 package integration
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
@@ -0,0 +1,875 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/metrics"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/contentfilter"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+// tenantScopedPipeline builds a pipeline with a module in every stage, each
+// running only for tenant-a
+func tenantScopedPipeline(logger *zap.SugaredLogger) (*pipeline.Pipeline, []*stubModule) {
+	p := pipeline.NewPipeline(logger)
+	var modules []*stubModule
+	for _, moduleType := range []interfaces.ModuleType{
+		interfaces.ModuleTypeInspector,
+		interfaces.ModuleTypePolicy,
+		interfaces.ModuleTypeTransformer,
+		interfaces.ModuleTypeSink,
+	} {
+		module := newStubModule(moduleType.String(), moduleType)
+		module.conditions = []interfaces.Condition{{Field: "tenant", Operator: "eq", Value: "tenant-a"}}
+		p.AddModule(module)
+		modules = append(modules, module)
+	}
+	return p, modules
+}
+
+func TestPipelineNoopFastPath(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	totalCalls := func(modules []*stubModule) int {
+		calls := 0
+		for _, module := range modules {
+			calls += module.calls
+		}
+		return calls
+	}
+
+	t.Run("NoMatchingModulesContinues", func(t *testing.T) {
+		p, modules := tenantScopedPipeline(sugar)
+		result, err := p.ProcessRequest(ctx, &interfaces.ProcessRequestContext{
+			RequestID:   "noop",
+			TenantID:    "tenant-b",
+			Annotations: map[string]interface{}{"existing": true},
+		})
+		if err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		p.Drain(ctx)
+
+		if result.Action != interfaces.ActionContinue || result.Annotations["existing"] != true {
+			t.Errorf("Expected continue with the request's annotations, got %s %v", result.Action, result.Annotations)
+		}
+		if calls := totalCalls(modules); calls != 0 {
+			t.Errorf("Expected no module to run, got %d calls", calls)
+		}
+	})
+
+	t.Run("MatchingModulesRunEveryStage", func(t *testing.T) {
+		p, modules := tenantScopedPipeline(sugar)
+		result, err := p.ProcessRequest(ctx, &interfaces.ProcessRequestContext{RequestID: "match", TenantID: "tenant-a"})
+		if err != nil || result.Action != interfaces.ActionContinue {
+			t.Fatalf("Expected continue, got %v (%v)", result, err)
+		}
+		p.Drain(ctx)
+
+		for _, module := range modules {
+			if module.calls != 1 {
+				t.Errorf("Expected %s to run once, got %d", module.name, module.calls)
+			}
+		}
+	})
+
+	t.Run("AnnotationConditionsStillApply", func(t *testing.T) {
+		p := pipeline.NewPipeline(sugar)
+		transformer := newStubModule("flagged", interfaces.ModuleTypeTransformer)
+		transformer.conditions = []interfaces.Condition{{Field: "flagged", Operator: "eq", Value: true}}
+		p.AddModule(transformer)
+
+		for _, annotations := range []map[string]interface{}{nil, {"flagged": true}} {
+			if _, err := p.ProcessRequest(ctx, &interfaces.ProcessRequestContext{RequestID: "flag", TenantID: "tenant-a", Annotations: annotations}); err != nil {
+				t.Fatalf("Pipeline failed: %v", err)
+			}
+		}
+		if transformer.calls != 1 {
+			t.Errorf("Expected the transformer to run only for the flagged request, got %d calls", transformer.calls)
+		}
+	})
+
+	t.Run("ModuleChangesTakeEffect", func(t *testing.T) {
+		p := pipeline.NewPipeline(sugar)
+		first := newStubModule("first", interfaces.ModuleTypePolicy)
+		second := newStubModule("second", interfaces.ModuleTypePolicy)
+		p.AddModule(first)
+		p.AddModule(second)
+
+		send := func() {
+			if _, err := p.ProcessRequest(ctx, &interfaces.ProcessRequestContext{RequestID: "change", TenantID: "tenant-a"}); err != nil {
+				t.Fatalf("Pipeline failed: %v", err)
+			}
+		}
+		send()
+		p.RemoveModule("first")
+		send()
+		p.AddModule(first)
+		send()
+
+		if first.calls != 2 || second.calls != 3 {
+			t.Errorf("Expected calls first=2 second=3, got first=%d second=%d", first.calls, second.calls)
+		}
+	})
+}
+
+// BenchmarkPipelineNoop measures a request no module applies to, which takes
+// the fast path
+func TestPipelineInspectorResultCache(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	newCachedPipeline := func(ttl time.Duration) (*pipeline.Pipeline, *stubModule, *stubModule) {
+		p := pipeline.NewPipeline(sugar)
+		cached := newStubModule("language-detector", interfaces.ModuleTypeInspector)
+		cached.result = &interfaces.ProcessRequestResult{
+			Action:      interfaces.ActionContinue,
+			Annotations: map[string]interface{}{"language": "en"},
+		}
+		uncached := newStubModule("pii-scanner", interfaces.ModuleTypeInspector)
+		p.AddModule(cached)
+		p.AddModule(uncached)
+		p.SetResultCaching(map[string]time.Duration{"language-detector": ttl})
+		return p, cached, uncached
+	}
+	process := func(t *testing.T, p *pipeline.Pipeline, body string) *interfaces.ProcessRequestResult {
+		t.Helper()
+		result, err := p.ProcessRequest(ctx, &interfaces.ProcessRequestContext{
+			RequestID: "cache-req",
+			TenantID:  "tenant-a",
+			Body:      chatBody(t, body),
+		})
+		if err != nil || result.Action != interfaces.ActionContinue {
+			t.Fatalf("Expected continue, got %v (%v)", result, err)
+		}
+		return result
+	}
+
+	t.Run("IdenticalRequestReusesResult", func(t *testing.T) {
+		p, cached, uncached := newCachedPipeline(time.Minute)
+		process(t, p, "bonjour")
+		result := process(t, p, "bonjour")
+
+		if cached.calls != 1 {
+			t.Errorf("Expected the cached inspector to run once, got %d", cached.calls)
+		}
+		if result.Annotations["language"] != "en" {
+			t.Errorf("Expected the cached annotation to be applied, got %v", result.Annotations)
+		}
+		if uncached.calls != 2 {
+			t.Errorf("Expected the inspector without caching to run every time, got %d", uncached.calls)
+		}
+	})
+
+	t.Run("DifferentRequestRecomputes", func(t *testing.T) {
+		p, cached, _ := newCachedPipeline(time.Minute)
+		process(t, p, "bonjour")
+		process(t, p, "hola")
+		if cached.calls != 2 {
+			t.Errorf("Expected a different body to rerun the inspector, got %d calls", cached.calls)
+		}
+	})
+
+	t.Run("ExpiredResultRecomputes", func(t *testing.T) {
+		p, cached, _ := newCachedPipeline(20 * time.Millisecond)
+		process(t, p, "bonjour")
+		time.Sleep(30 * time.Millisecond)
+		process(t, p, "bonjour")
+		if cached.calls != 2 {
+			t.Errorf("Expected the inspector to rerun after the TTL, got %d calls", cached.calls)
+		}
+	})
+}
+
+// stoppingModule is a stub module that has been stopped and is draining
+type stoppingModule struct {
+	*stubModule
+}
+
+func (s *stoppingModule) Status() *interfaces.ModuleStatus {
+	return &interfaces.ModuleStatus{State: interfaces.ModuleStateDraining}
+}
+
+func (s *stoppingModule) GetConfig() *interfaces.ModuleConfig {
+	config := s.stubModule.GetConfig()
+	config.Enabled = false
+	return config
+}
+
+func TestPipelineModuleSkipMetrics(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	skips := func(registry *metrics.Registry, module, moduleType, reason string) float64 {
+		return testutil.ToFloat64(registry.ModuleSkips.WithLabelValues(module, moduleType, reason))
+	}
+
+	t.Run("ConditionExcludesModule", func(t *testing.T) {
+		registry := metrics.NewRegistry()
+		p := pipeline.NewPipeline(sugar)
+		p.SetMetrics(registry)
+
+		scoped := newStubModule("tenant-a-policy", interfaces.ModuleTypePolicy)
+		scoped.conditions = []interfaces.Condition{{Field: "tenant", Operator: "eq", Value: "tenant-a"}}
+		p.AddModule(scoped)
+		p.AddModule(newStubModule("global-policy", interfaces.ModuleTypePolicy))
+
+		for _, tenant := range []string{"tenant-a", "tenant-b", "tenant-b"} {
+			if _, err := p.ProcessRequest(ctx, &interfaces.ProcessRequestContext{RequestID: "skip-" + tenant, TenantID: tenant}); err != nil {
+				t.Fatalf("Pipeline failed: %v", err)
+			}
+		}
+		p.Drain(ctx)
+
+		if count := skips(registry, "tenant-a-policy", "policy", pipeline.SkipReasonConditionNotMet); count != 2 {
+			t.Errorf("Expected 2 condition-not-met skips, got %v", count)
+		}
+		if scoped.calls != 1 {
+			t.Errorf("Expected the scoped policy to run once, got %d", scoped.calls)
+		}
+		if count := skips(registry, "global-policy", "policy", pipeline.SkipReasonConditionNotMet); count != 0 {
+			t.Errorf("Expected the global policy never to be skipped, got %v", count)
+		}
+	})
+
+	t.Run("FastPathCountsEachModuleOnce", func(t *testing.T) {
+		registry := metrics.NewRegistry()
+		p, _ := tenantScopedPipeline(sugar)
+		p.SetMetrics(registry)
+
+		if _, err := p.ProcessRequest(ctx, &interfaces.ProcessRequestContext{RequestID: "skip-all", TenantID: "tenant-b"}); err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		p.Drain(ctx)
+
+		for _, moduleType := range []string{"inspector", "policy", "transformer", "sink"} {
+			if count := skips(registry, moduleType, moduleType, pipeline.SkipReasonConditionNotMet); count != 1 {
+				t.Errorf("Expected the %s to be skipped once, got %v", moduleType, count)
+			}
+		}
+	})
+
+	t.Run("DisabledAndDrainingModules", func(t *testing.T) {
+		registry := metrics.NewRegistry()
+		p := pipeline.NewPipeline(sugar)
+		p.SetMetrics(registry)
+
+		p.AddModule(&stoppingModule{stubModule: newStubModule("stopping-policy", interfaces.ModuleTypePolicy)})
+		p.AddModule(newStubModule("running-policy", interfaces.ModuleTypePolicy))
+
+		if _, err := p.ProcessRequest(ctx, &interfaces.ProcessRequestContext{RequestID: "skip-draining", TenantID: "tenant-a"}); err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		if count := skips(registry, "stopping-policy", "policy", pipeline.SkipReasonDraining); count != 1 {
+			t.Errorf("Expected a draining skip, got %v", count)
+		}
+		if count := skips(registry, "stopping-policy", "policy", pipeline.SkipReasonDisabled); count != 0 {
+			t.Errorf("Expected a draining module not to count as disabled, got %v", count)
+		}
+	})
+}
+
+// flakyModule is a stub module whose first failures executions fail
+type flakyModule struct {
+	*stubModule
+	failures      int
+	responseCalls int
+}
+
+func (f *flakyModule) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequestContext) (*interfaces.ProcessRequestResult, error) {
+	if f.calls < f.failures {
+		f.calls++
+		return nil, errors.New("upstream service unavailable")
+	}
+	return f.stubModule.ProcessRequest(ctx, req)
+}
+
+func (f *flakyModule) ProcessResponse(ctx context.Context, resp *interfaces.ProcessResponseContext) (*interfaces.ProcessResponseResult, error) {
+	f.responseCalls++
+	if f.responseCalls <= f.failures {
+		return nil, errors.New("upstream service unavailable")
+	}
+	return &interfaces.ProcessResponseResult{Action: interfaces.ActionTransform, ModifiedBody: []byte(`{"enriched":true}`)}, nil
+}
+
+func TestPipelineModuleRetry(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	newPipeline := func(failures int, policy pipeline.RetryPolicy) (*pipeline.Pipeline, *flakyModule, *metrics.Registry) {
+		registry := metrics.NewRegistry()
+		p := pipeline.NewPipeline(sugar)
+		p.SetMetrics(registry)
+		p.SetModuleRetries(map[string]pipeline.RetryPolicy{"enricher": policy})
+
+		module := &flakyModule{stubModule: newStubModule("enricher", interfaces.ModuleTypeTransformer), failures: failures}
+		module.result = &interfaces.ProcessRequestResult{
+			Action:       interfaces.ActionTransform,
+			ModifiedBody: []byte(`{"enriched":true}`),
+			Annotations:  map[string]interface{}{"enriched": true},
+		}
+		p.AddModule(module)
+		return p, module, registry
+	}
+	retries := func(registry *metrics.Registry) float64 {
+		return testutil.ToFloat64(registry.ModuleRetries.WithLabelValues("enricher", "transformer"))
+	}
+
+	t.Run("TransientFailureRetried", func(t *testing.T) {
+		p, module, registry := newPipeline(1, pipeline.RetryPolicy{MaxAttempts: 3, Backoff: 10 * time.Millisecond})
+		req := &interfaces.ProcessRequestContext{RequestID: "retry-1", TenantID: "tenant-a", Body: []byte(`{}`)}
+		start := time.Now()
+		if _, err := p.ProcessRequest(ctx, req); err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		if module.calls != 2 {
+			t.Errorf("Expected the transformer to run twice, got %d", module.calls)
+		}
+		if string(req.Body) != `{"enriched":true}` || req.Annotations["enriched"] != true {
+			t.Errorf("Expected the retried result to be applied, got body %s and annotations %v", req.Body, req.Annotations)
+		}
+		if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+			t.Errorf("Expected the retry to wait for its backoff, took %v", elapsed)
+		}
+		if count := retries(registry); count != 1 {
+			t.Errorf("Expected one retry counted, got %v", count)
+		}
+		if count := testutil.CollectAndCount(registry.ModuleErrors); count != 0 {
+			t.Errorf("Expected no module error once the retry succeeded, got %d series", count)
+		}
+	})
+
+	t.Run("ResponseTransformerRetried", func(t *testing.T) {
+		p, module, registry := newPipeline(1, pipeline.RetryPolicy{MaxAttempts: 2})
+		resp := &interfaces.ProcessResponseContext{
+			ProcessRequestContext: &interfaces.ProcessRequestContext{RequestID: "retry-2", TenantID: "tenant-a"},
+			StatusCode:            200,
+			ResponseBody:          []byte(`{}`),
+		}
+		if _, err := p.ProcessResponse(ctx, resp); err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		p.Drain(ctx)
+		if module.responseCalls != 2 || string(resp.ResponseBody) != `{"enriched":true}` {
+			t.Errorf("Expected the retried response transform to be applied, got %d calls and %s", module.responseCalls, resp.ResponseBody)
+		}
+		if count := retries(registry); count != 1 {
+			t.Errorf("Expected one retry counted, got %v", count)
+		}
+	})
+
+	t.Run("GivesUpAfterMaxAttempts", func(t *testing.T) {
+		p, module, registry := newPipeline(5, pipeline.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, BackoffMultiplier: 2})
+		req := &interfaces.ProcessRequestContext{RequestID: "retry-3", TenantID: "tenant-a", Body: []byte(`{}`)}
+		if _, err := p.ProcessRequest(ctx, req); err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		if module.calls != 3 || string(req.Body) != `{}` {
+			t.Errorf("Expected 3 failed attempts and the body unchanged, got %d calls and %s", module.calls, req.Body)
+		}
+		if count := retries(registry); count != 2 {
+			t.Errorf("Expected two retries counted, got %v", count)
+		}
+		if count := testutil.CollectAndCount(registry.ModuleErrors); count != 1 {
+			t.Errorf("Expected the final failure recorded as a module error, got %d series", count)
+		}
+	})
+
+	t.Run("NoPolicyNoRetry", func(t *testing.T) {
+		p, module, registry := newPipeline(1, pipeline.RetryPolicy{MaxAttempts: 1})
+		if _, err := p.ProcessRequest(ctx, &interfaces.ProcessRequestContext{RequestID: "retry-4", TenantID: "tenant-a"}); err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		if module.calls != 1 || retries(registry) != 0 {
+			t.Errorf("Expected a single attempt without a retry policy, got %d calls", module.calls)
+		}
+	})
+}
+
+func BenchmarkPipelineNoop(b *testing.B) {
+	p, _ := tenantScopedPipeline(zap.NewNop().Sugar())
+	req := &interfaces.ProcessRequestContext{RequestID: "bench", TenantID: "tenant-b"}
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.ProcessRequest(ctx, req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkPipelineSinglePolicy measures a request running one policy, for
+// comparison with the no-op case
+func BenchmarkPipelineSinglePolicy(b *testing.B) {
+	p := pipeline.NewPipeline(zap.NewNop().Sugar())
+	p.AddModule(newStubModule("policy", interfaces.ModuleTypePolicy))
+	req := &interfaces.ProcessRequestContext{RequestID: "bench", TenantID: "tenant-a", DryRun: true}
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.ProcessRequest(ctx, req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestPipelineDecisionSummary(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	filter := contentfilter.NewContentFilter(sugar)
+	if err := filter.Initialize(ctx, &interfaces.ModuleConfig{
+		Name:   "content-filter",
+		Config: map[string]interface{}{"blocked_keywords": []interface{}{"harmful"}, "action": "block"},
+	}); err != nil {
+		t.Fatalf("Failed to initialize content filter: %v", err)
+	}
+	filter.Start(ctx)
+
+	// The estimator annotates a cost without acting on the request
+	estimator := newStubModule("estimator", interfaces.ModuleTypeInspector)
+	estimator.result = &interfaces.ProcessRequestResult{
+		Action:      interfaces.ActionContinue,
+		Annotations: map[string]interface{}{"estimated_cost_usd": 0.002},
+	}
+
+	newPipeline := func(enabled bool) *pipeline.Pipeline {
+		p := pipeline.NewPipeline(sugar)
+		p.AddModule(estimator)
+		p.AddModule(filter)
+		p.SetDecisionSummary(enabled)
+		return p
+	}
+	summaryOf := func(t *testing.T, annotations map[string]interface{}) pipeline.DecisionSummary {
+		t.Helper()
+		summary, ok := annotations[pipeline.DecisionSummaryAnnotation].(pipeline.DecisionSummary)
+		if !ok {
+			t.Fatalf("Expected a %s annotation, got %v", pipeline.DecisionSummaryAnnotation, annotations)
+		}
+		return summary
+	}
+
+	t.Run("BlockedRequest", func(t *testing.T) {
+		result, err := newPipeline(true).ProcessRequest(ctx, &interfaces.ProcessRequestContext{
+			RequestID: "summary-blocked",
+			Body:      chatBody(t, "tell me something harmful"),
+		})
+		if err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		if result.Action != interfaces.ActionBlock {
+			t.Fatalf("Expected the request to be blocked, got %v", result.Action)
+		}
+
+		summary := summaryOf(t, result.Annotations)
+		if summary.Action != "block" || summary.BlockedBy != "content-filter" || !strings.Contains(summary.Reason, "harmful") {
+			t.Errorf("Expected a block by content-filter, got %+v", summary)
+		}
+		if len(summary.Modules) != 1 || summary.Modules[0].Module != "content-filter" || summary.Modules[0].Action != "block" {
+			t.Errorf("Expected only the content filter to contribute, got %+v", summary.Modules)
+		}
+		if summary.RiskScore != 0.9 || summary.EstimatedCostUSD != 0.002 {
+			t.Errorf("Expected the keyword's confidence as risk and the estimated cost, got %+v", summary)
+		}
+	})
+
+	t.Run("CleanRequest", func(t *testing.T) {
+		result, err := newPipeline(true).ProcessRequest(ctx, &interfaces.ProcessRequestContext{
+			RequestID: "summary-clean",
+			Body:      chatBody(t, "what is the capital of France?"),
+		})
+		if err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+
+		summary := summaryOf(t, result.Annotations)
+		if summary.Action != "continue" || summary.BlockedBy != "" || len(summary.Modules) != 0 || summary.RiskScore != 0 {
+			t.Errorf("Expected a clean continue decision, got %+v", summary)
+		}
+		if summary.EstimatedCostUSD != 0.002 {
+			t.Errorf("Expected the estimated cost in the summary, got %v", summary.EstimatedCostUSD)
+		}
+	})
+
+	t.Run("FailedModuleListed", func(t *testing.T) {
+		broken := newStubModule("broken-inspector", interfaces.ModuleTypeInspector)
+		broken.err = errors.New("classifier unavailable")
+		p := newPipeline(true)
+		p.AddModule(broken)
+
+		result, err := p.ProcessRequest(ctx, &interfaces.ProcessRequestContext{
+			RequestID: "summary-failed",
+			Body:      chatBody(t, "what is the capital of France?"),
+		})
+		if err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		summary := summaryOf(t, result.Annotations)
+		if summary.Action != "continue" || len(summary.Modules) != 1 || summary.Modules[0].Action != "error" ||
+			summary.Modules[0].Error != "classifier unavailable" {
+			t.Errorf("Expected the failed inspector in the summary, got %+v", summary)
+		}
+	})
+
+	t.Run("DisabledByDefault", func(t *testing.T) {
+		result, err := newPipeline(false).ProcessRequest(ctx, &interfaces.ProcessRequestContext{
+			RequestID: "summary-disabled",
+			Body:      chatBody(t, "tell me something harmful"),
+		})
+		if err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		if _, ok := result.Annotations[pipeline.DecisionSummaryAnnotation]; ok {
+			t.Errorf("Expected no summary when disabled, got %v", result.Annotations)
+		}
+	})
+}
+
+// generationModule annotates every request with the configuration generation
+// it belongs to, optionally holding requests until released
+type generationModule struct {
+	*stubModule
+	generation string
+	entered    chan struct{} // signalled as a request arrives, when set
+	release    chan struct{} // requests wait for it to close, when set
+}
+
+func newGenerationModule(generation string, moduleType interfaces.ModuleType) *generationModule {
+	return &generationModule{
+		stubModule: newStubModule(moduleType.String()+"-"+generation, moduleType),
+		generation: generation,
+	}
+}
+
+func (g *generationModule) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequestContext) (*interfaces.ProcessRequestResult, error) {
+	if g.entered != nil {
+		g.entered <- struct{}{}
+	}
+	if g.release != nil {
+		<-g.release
+	}
+	return &interfaces.ProcessRequestResult{
+		Action:      interfaces.ActionContinue,
+		Annotations: map[string]interface{}{g.moduleType.String(): g.generation},
+	}, nil
+}
+
+func TestPipelineReload(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	// generationConfig builds a configuration whose inspector, policy and
+	// transformer all annotate the request with generation
+	generationConfig := func(generation string) pipeline.Config {
+		var modules []interfaces.Module
+		for _, moduleType := range []interfaces.ModuleType{
+			interfaces.ModuleTypeInspector,
+			interfaces.ModuleTypePolicy,
+			interfaces.ModuleTypeTransformer,
+		} {
+			modules = append(modules, newGenerationModule(generation, moduleType))
+		}
+		return pipeline.Config{Modules: modules}
+	}
+	// generationsOf returns the generation each stage annotated a result with
+	generationsOf := func(result *interfaces.ProcessRequestResult) []interface{} {
+		return []interface{}{
+			result.Annotations[interfaces.ModuleTypeInspector.String()],
+			result.Annotations[interfaces.ModuleTypePolicy.String()],
+			result.Annotations[interfaces.ModuleTypeTransformer.String()],
+		}
+	}
+
+	t.Run("NeverPartiallyApplied", func(t *testing.T) {
+		p := pipeline.NewPipeline(sugar)
+		configs := []pipeline.Config{generationConfig("a"), generationConfig("b")}
+		if err := p.Reload(configs[0]); err != nil {
+			t.Fatalf("Reload failed: %v", err)
+		}
+
+		done := make(chan struct{})
+		var reloads sync.WaitGroup
+		reloads.Add(1)
+		go func() {
+			defer reloads.Done()
+			for i := 1; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if err := p.Reload(configs[i%2]); err != nil {
+					t.Errorf("Reload failed: %v", err)
+					return
+				}
+			}
+		}()
+
+		var traffic sync.WaitGroup
+		for worker := 0; worker < 8; worker++ {
+			traffic.Add(1)
+			go func() {
+				defer traffic.Done()
+				for i := 0; i < 200; i++ {
+					result, err := p.ProcessRequest(ctx, &interfaces.ProcessRequestContext{RequestID: "reload", TenantID: "tenant-a"})
+					if err != nil {
+						t.Errorf("Request failed: %v", err)
+						return
+					}
+					generations := generationsOf(result)
+					if generations[0] == nil || generations[1] != generations[0] || generations[2] != generations[0] {
+						t.Errorf("Expected every stage from one configuration, got %v", generations)
+						return
+					}
+				}
+			}()
+		}
+		traffic.Wait()
+		close(done)
+		reloads.Wait()
+
+		if p.Generation() < 2 {
+			t.Errorf("Expected reloads to advance the generation, got %d", p.Generation())
+		}
+	})
+
+	t.Run("InFlightRequestsKeepOldSnapshot", func(t *testing.T) {
+		p := pipeline.NewPipeline(sugar)
+		old := generationConfig("old")
+		held := old.Modules[1].(*generationModule)
+		held.entered, held.release = make(chan struct{}, 1), make(chan struct{})
+		if err := p.Reload(old); err != nil {
+			t.Fatalf("Reload failed: %v", err)
+		}
+
+		inFlight := make(chan *interfaces.ProcessRequestResult, 1)
+		go func() {
+			result, err := p.ProcessRequest(ctx, &interfaces.ProcessRequestContext{RequestID: "in-flight"})
+			if err != nil {
+				t.Errorf("In-flight request failed: %v", err)
+			}
+			inFlight <- result
+		}()
+
+		// Reload while the request is held in the old policy
+		<-held.entered
+		if err := p.Reload(generationConfig("new")); err != nil {
+			t.Fatalf("Reload failed: %v", err)
+		}
+
+		result, err := p.ProcessRequest(ctx, &interfaces.ProcessRequestContext{RequestID: "after-reload"})
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		for _, generation := range generationsOf(result) {
+			if generation != "new" {
+				t.Errorf("Expected a new request to run against the new configuration, got %v", generationsOf(result))
+				break
+			}
+		}
+
+		close(held.release)
+		result = <-inFlight
+		for _, generation := range generationsOf(result) {
+			if generation != "old" {
+				t.Errorf("Expected the in-flight request to finish against the old configuration, got %v", generationsOf(result))
+				break
+			}
+		}
+	})
+
+	t.Run("InvalidConfigNotApplied", func(t *testing.T) {
+		p := pipeline.NewPipeline(sugar)
+		if err := p.Reload(generationConfig("a")); err != nil {
+			t.Fatalf("Reload failed: %v", err)
+		}
+		generation := p.Generation()
+
+		invalid := generationConfig("b")
+		invalid.Modules = append(invalid.Modules, newGenerationModule("b", interfaces.ModuleTypePolicy))
+		if err := p.Reload(invalid); err == nil {
+			t.Fatal("Expected a configuration naming a module twice to be rejected")
+		}
+		if p.Generation() != generation {
+			t.Errorf("Expected a rejected reload to leave the pipeline unchanged")
+		}
+
+		result, err := p.ProcessRequest(ctx, &interfaces.ProcessRequestContext{RequestID: "after-invalid"})
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		if generations := generationsOf(result); generations[0] != "a" || generations[2] != "a" {
+			t.Errorf("Expected the previous configuration still in use, got %v", generations)
+		}
+	})
+}
+
+func TestPipelineTransformDiff(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	body := []byte(`{"model":"gpt-4o-mini","messages":[{"role":"user","content":"Hi, I'm alice@example.com"}]}`)
+
+	// The prompter inserts a system prompt ahead of the conversation
+	prompter := newStubModule("system-prompt", interfaces.ModuleTypeTransformer)
+	prompter.result = &interfaces.ProcessRequestResult{
+		Action:       interfaces.ActionTransform,
+		ModifiedBody: []byte(`{"model":"gpt-4o-mini","messages":[{"role":"system","content":"Be concise."},{"role":"user","content":"Hi, I'm alice@example.com"}]}`),
+	}
+	// The redactor then redacts the user's message and sets the end user
+	redactor := newStubModule("redactor", interfaces.ModuleTypeTransformer)
+	redactor.priority = 200
+	redactor.result = &interfaces.ProcessRequestResult{
+		Action:       interfaces.ActionTransform,
+		ModifiedBody: []byte(`{"model":"gpt-4o-mini","messages":[{"role":"system","content":"Be concise."},{"role":"user","content":"Hi, I'm [EMAIL]"}],"user":"redacted"}`),
+	}
+
+	newPipeline := func(enabled bool) *pipeline.Pipeline {
+		p := pipeline.NewPipeline(sugar)
+		p.AddModule(prompter)
+		p.AddModule(redactor)
+		p.SetTransformDiff(enabled)
+		return p
+	}
+
+	t.Run("RecordsInsertedSystemPrompt", func(t *testing.T) {
+		result, err := newPipeline(true).ProcessRequest(ctx, &interfaces.ProcessRequestContext{
+			RequestID: "diff-1",
+			TenantID:  "tenant-a",
+			Body:      body,
+		})
+		if err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+
+		diffs, ok := result.Annotations[pipeline.TransformDiffAnnotation].([]pipeline.BodyDiff)
+		if !ok || len(diffs) != 2 {
+			t.Fatalf("Expected a diff from each transformer, got %v", result.Annotations[pipeline.TransformDiffAnnotation])
+		}
+
+		inserted := diffs[0]
+		if inserted.Module != "system-prompt" || inserted.Stage != "request" || len(inserted.Changes) != 1 {
+			t.Fatalf("Expected one change from the system prompt transformer, got %+v", inserted)
+		}
+		change := inserted.Changes[0]
+		message, _ := change.After.(map[string]interface{})
+		if change.Op != pipeline.DiffAdded || change.Path != "$.messages[0]" || message["role"] != "system" || message["content"] != "Be concise." {
+			t.Errorf("Expected the system message added at $.messages[0], got %+v", change)
+		}
+
+		redacted := map[string]pipeline.BodyChange{}
+		for _, change := range diffs[1].Changes {
+			redacted[change.Path] = change
+		}
+		if change := redacted["$.messages[1].content"]; change.Op != pipeline.DiffChanged || change.After != "Hi, I'm [EMAIL]" {
+			t.Errorf("Expected the redacted content recorded as changed, got %+v", diffs[1].Changes)
+		}
+		if change := redacted["$.user"]; change.Op != pipeline.DiffAdded || len(redacted) != 2 {
+			t.Errorf("Expected only the content change and the added user field, got %+v", diffs[1].Changes)
+		}
+	})
+
+	t.Run("DisabledByDefault", func(t *testing.T) {
+		result, err := newPipeline(false).ProcessRequest(ctx, &interfaces.ProcessRequestContext{
+			RequestID: "diff-2",
+			TenantID:  "tenant-a",
+			Body:      body,
+		})
+		if err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		if _, ok := result.Annotations[pipeline.TransformDiffAnnotation]; ok {
+			t.Error("Expected no transform diff unless enabled")
+		}
+	})
+}
+
+func TestPipelineAnnotationLimits(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	// The chatty inspector adds far more annotations than the cap allows
+	chatty := newStubModule("chatty", interfaces.ModuleTypeInspector)
+	chatty.result = &interfaces.ProcessRequestResult{
+		Action:      interfaces.ActionContinue,
+		Annotations: map[string]interface{}{},
+	}
+	for i := 0; i < 10; i++ {
+		chatty.result.Annotations[fmt.Sprintf("chatty_%02d", i)] = i
+	}
+	// The policy replaces a kept annotation and adds an oversized one
+	policy := newStubModule("policy", interfaces.ModuleTypePolicy)
+	policy.result = &interfaces.ProcessRequestResult{
+		Action: interfaces.ActionContinue,
+		Annotations: map[string]interface{}{
+			"chatty_00": "replaced",
+			"chatty_01": strings.Repeat("x", 100),
+		},
+	}
+
+	registry := metrics.NewRegistry()
+	p := pipeline.NewPipeline(sugar)
+	p.SetMetrics(registry)
+	p.AddModule(chatty)
+	p.AddModule(policy)
+	p.SetAnnotationLimits(pipeline.AnnotationLimits{MaxCount: 4, MaxValueBytes: 64})
+
+	result, err := p.ProcessRequest(ctx, &interfaces.ProcessRequestContext{
+		RequestID: "annotations-1",
+		TenantID:  "tenant-a",
+		Body:      []byte(`{}`),
+	})
+	if err != nil {
+		t.Fatalf("Pipeline failed: %v", err)
+	}
+
+	for _, key := range []string{"chatty_00", "chatty_01", "chatty_02", "chatty_03"} {
+		if _, ok := result.Annotations[key]; !ok {
+			t.Errorf("Expected %s kept within the cap", key)
+		}
+	}
+	for _, key := range []string{"chatty_04", "chatty_09"} {
+		if _, ok := result.Annotations[key]; ok {
+			t.Errorf("Expected %s beyond the cap dropped", key)
+		}
+	}
+	if value := result.Annotations["chatty_00"]; value != "replaced" {
+		t.Errorf("Expected an existing annotation replaced at the cap, got %v", value)
+	}
+	if value := result.Annotations["chatty_01"]; value != 1 {
+		t.Errorf("Expected the oversized value dropped, got %v", value)
+	}
+
+	dropped, ok := result.Annotations[pipeline.AnnotationsDroppedAnnotation].(map[string]int)
+	if !ok || dropped["chatty"] != 6 || dropped["policy"] != 1 {
+		t.Errorf("Expected 6 dropped from chatty and 1 from policy, got %v", result.Annotations[pipeline.AnnotationsDroppedAnnotation])
+	}
+	if count := testutil.ToFloat64(registry.AnnotationsDropped.WithLabelValues("chatty")); count != 6 {
+		t.Errorf("Expected 6 drops counted for chatty, got %v", count)
+	}
+}
@@ -0,0 +1,118 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/core/postprocess"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"go.uber.org/zap"
+)
+
+func TestResponsePostProcessing(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	const disclaimer = "\n\nAI-generated content; verify before use."
+	steps := []interface{}{
+		map[string]interface{}{"op": "append_text", "text": disclaimer},
+		map[string]interface{}{"op": "delete_field", "path": "system_fingerprint"},
+		map[string]interface{}{"op": "delete_field", "path": "choices.0.logprobs"},
+		map[string]interface{}{"op": "set_field", "path": "metadata.reviewed", "value": false},
+	}
+
+	newPipeline := func(t *testing.T) *pipeline.Pipeline {
+		module := postprocess.NewPostProcessor(sugar)
+		moduleConfig := &interfaces.ModuleConfig{Name: "response-postprocessor", Enabled: true, Config: map[string]interface{}{"steps": steps}}
+		if err := module.ValidateConfig(moduleConfig); err != nil {
+			t.Fatalf("Invalid config: %v", err)
+		}
+		if err := module.Initialize(ctx, moduleConfig); err != nil {
+			t.Fatalf("Failed to initialize post-processor: %v", err)
+		}
+		module.Start(ctx)
+
+		p := pipeline.NewPipeline(sugar)
+		p.AddModule(module)
+		return p
+	}
+	respond := func(t *testing.T, p *pipeline.Pipeline, status int, body string) *interfaces.ProcessResponseContext {
+		t.Helper()
+		resp := &interfaces.ProcessResponseContext{
+			ProcessRequestContext: &interfaces.ProcessRequestContext{RequestID: "postprocess", TenantID: "tenant-a"},
+			StatusCode:            status,
+			ResponseBody:          []byte(body),
+		}
+		if _, err := p.ProcessResponse(ctx, resp); err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		return resp
+	}
+
+	t.Run("StepsApplyInOrder", func(t *testing.T) {
+		resp := respond(t, newPipeline(t), 200,
+			`{"id":"chatcmpl-1","system_fingerprint":"fp_123","choices":[{"message":{"role":"assistant","content":"Paris."},"logprobs":null}]}`)
+
+		var response struct {
+			ID                string                 `json:"id"`
+			SystemFingerprint *string                `json:"system_fingerprint"`
+			Metadata          map[string]interface{} `json:"metadata"`
+			Choices           []map[string]json.RawMessage
+		}
+		if err := json.Unmarshal(resp.ResponseBody, &response); err != nil {
+			t.Fatalf("Invalid post-processed response: %v", err)
+		}
+		var message struct {
+			Content string `json:"content"`
+		}
+		json.Unmarshal(response.Choices[0]["message"], &message)
+		if message.Content != "Paris."+disclaimer {
+			t.Errorf("Expected the disclaimer appended to the content, got %q", message.Content)
+		}
+		if response.SystemFingerprint != nil {
+			t.Errorf("Expected system_fingerprint deleted, got %s", *response.SystemFingerprint)
+		}
+		if _, present := response.Choices[0]["logprobs"]; present {
+			t.Errorf("Expected choices.0.logprobs deleted, got %s", resp.ResponseBody)
+		}
+		if response.ID != "chatcmpl-1" || response.Metadata["reviewed"] != false {
+			t.Errorf("Expected other fields kept and metadata.reviewed set, got %s", resp.ResponseBody)
+		}
+	})
+
+	t.Run("AnthropicContentGetsDisclaimer", func(t *testing.T) {
+		resp := respond(t, newPipeline(t), 200, `{"content":[{"type":"text","text":"Paris."}]}`)
+		if !strings.Contains(string(resp.ResponseBody), `"text":"Paris.\n\nAI-generated content; verify before use."`) {
+			t.Errorf("Expected the disclaimer appended to the text block, got %s", resp.ResponseBody)
+		}
+	})
+
+	t.Run("ErrorResponsesUnchanged", func(t *testing.T) {
+		body := `{"error":{"message":"rate limited"},"system_fingerprint":"fp_123"}`
+		if resp := respond(t, newPipeline(t), 429, body); string(resp.ResponseBody) != body {
+			t.Errorf("Expected error responses to pass through, got %s", resp.ResponseBody)
+		}
+	})
+
+	t.Run("InvalidStepsRejected", func(t *testing.T) {
+		module := postprocess.NewPostProcessor(sugar)
+		for _, step := range []map[string]interface{}{
+			{"op": "uppercase"},
+			{"op": "append_text"},
+			{"op": "delete_field", "path": "choices..message"},
+			{"op": "set_field", "path": "metadata.reviewed"},
+		} {
+			config := &interfaces.ModuleConfig{Config: map[string]interface{}{"steps": []interface{}{step}}}
+			if err := module.ValidateConfig(config); err == nil {
+				t.Errorf("Expected step %v to be rejected", step)
+			}
+		}
+	})
+}
@@ -0,0 +1,182 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/metrics"
+	"github.com/bendiamant/leash-gateway/internal/pricing"
+	"github.com/bendiamant/leash-gateway/internal/providers"
+	"github.com/bendiamant/leash-gateway/internal/providers/base"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+func TestPricingFeed(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	// 1000 prompt and 1000 completion tokens: the cost is the sum of the rates
+	usage := &base.TokenUsage{PromptTokens: 1000, CompletionTokens: 1000, TotalTokens: 2000}
+	providerConfig := func(prices *base.PriceTable) *base.ProviderConfig {
+		return &base.ProviderConfig{
+			Name:   "openai",
+			Prices: prices,
+			Models: []base.ModelConfig{
+				{Name: "gpt-4o", CostPer1kInputTokens: 0.005, CostPer1kOutputTokens: 0.015},
+				{Name: "gpt-4o-mini", CostPer1kInputTokens: 0.00015, CostPer1kOutputTokens: 0.0006},
+			},
+		}
+	}
+	costOf := func(config *base.ProviderConfig, model string) float64 {
+		estimated, _ := config.Cost(model, usage)
+		return estimated
+	}
+	newUpdater := func(t *testing.T, source string, maxAge time.Duration) (*pricing.Updater, *base.PriceTable, *metrics.Registry) {
+		t.Helper()
+		prices := base.NewPriceTable()
+		registry := metrics.NewRegistry()
+		updater := pricing.NewUpdater(pricing.Config{Source: source, MaxAge: maxAge}, prices, sugar)
+		updater.SetMetrics(registry)
+		return updater, prices, registry
+	}
+	writeFeed := func(t *testing.T, path, feed string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(feed), 0o644); err != nil {
+			t.Fatalf("Failed to write feed: %v", err)
+		}
+	}
+	const feed = `{"providers": {"openai": {"gpt-4o": {"cost_per_1k_input_tokens": 0.0025, "cost_per_1k_output_tokens": 0.01}}}}`
+
+	t.Run("UpdateChangesCost", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "pricing.json")
+		writeFeed(t, path, feed)
+		updater, prices, registry := newUpdater(t, path, 0)
+		config := providerConfig(prices)
+
+		if cost := costOf(config, "gpt-4o"); math.Abs(cost-0.02) > 1e-12 {
+			t.Fatalf("Expected the configured $0.02 before the feed, got %v", cost)
+		}
+		if err := updater.Refresh(ctx); err != nil {
+			t.Fatalf("Failed to apply feed: %v", err)
+		}
+		if cost := costOf(config, "gpt-4o"); math.Abs(cost-0.0125) > 1e-12 {
+			t.Errorf("Expected the feed's $0.0125, got %v", cost)
+		}
+		// Models the feed does not list keep their configured prices
+		if cost := costOf(config, "gpt-4o-mini"); math.Abs(cost-0.00075) > 1e-12 {
+			t.Errorf("Expected the configured $0.00075 for an unlisted model, got %v", cost)
+		}
+		if applied := testutil.ToFloat64(registry.PricingUpdates.WithLabelValues(pricing.ResultApplied)); applied != 1 {
+			t.Errorf("Expected one applied update recorded, got %v", applied)
+		}
+	})
+
+	t.Run("MalformedFeedKeepsPriorPrices", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "pricing.json")
+		writeFeed(t, path, feed)
+		updater, prices, registry := newUpdater(t, path, 0)
+		config := providerConfig(prices)
+		if err := updater.Refresh(ctx); err != nil {
+			t.Fatalf("Failed to apply feed: %v", err)
+		}
+
+		for name, malformed := range map[string]string{
+			"NotJSON":        `{"providers": {"openai": `,
+			"NegativePrice":  `{"providers": {"openai": {"gpt-4o": {"cost_per_1k_input_tokens": -1, "cost_per_1k_output_tokens": 0.01}}}}`,
+			"MissingOutput":  `{"providers": {"openai": {"gpt-4o": {"cost_per_1k_input_tokens": 0.001}}}}`,
+			"MisspelledRate": `{"providers": {"openai": {"gpt-4o": {"cost_per_1k_input_tokens": 0.001, "cost_per_1k_output_tokens": 0.002, "cost_per_1k_cached_tokens": 0.0005}}}}`,
+			"Empty":          `{"providers": {}}`,
+		} {
+			writeFeed(t, path, malformed)
+			if err := updater.Refresh(ctx); !errors.Is(err, pricing.ErrInvalidFeed) {
+				t.Errorf("%s: expected the feed rejected, got %v", name, err)
+			}
+			if cost := costOf(config, "gpt-4o"); math.Abs(cost-0.0125) > 1e-12 {
+				t.Errorf("%s: expected the prior $0.0125 kept, got %v", name, cost)
+			}
+		}
+		if rejected := testutil.ToFloat64(registry.PricingUpdates.WithLabelValues(pricing.ResultRejected)); rejected != 5 {
+			t.Errorf("Expected five rejected updates recorded, got %v", rejected)
+		}
+	})
+
+	t.Run("StaleFeedRevertsToConfiguredPrices", func(t *testing.T) {
+		status := http.StatusOK
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			w.Write([]byte(feed))
+		}))
+		defer server.Close()
+
+		now := time.Date(2026, time.October, 16, 12, 0, 0, 0, time.UTC)
+		updater, prices, _ := newUpdater(t, server.URL, time.Hour)
+		updater.SetClock(func() time.Time { return now })
+		config := providerConfig(prices)
+		if err := updater.Refresh(ctx); err != nil {
+			t.Fatalf("Failed to apply feed: %v", err)
+		}
+
+		status = http.StatusServiceUnavailable
+		now = now.Add(30 * time.Minute)
+		if err := updater.Refresh(ctx); err == nil {
+			t.Fatal("Expected an unavailable feed to fail")
+		}
+		if cost := costOf(config, "gpt-4o"); math.Abs(cost-0.0125) > 1e-12 {
+			t.Errorf("Expected feed prices kept within the maximum age, got %v", cost)
+		}
+
+		now = now.Add(time.Hour)
+		updater.Refresh(ctx)
+		if cost := costOf(config, "gpt-4o"); math.Abs(cost-0.02) > 1e-12 {
+			t.Errorf("Expected the configured $0.02 once feed prices are stale, got %v", cost)
+		}
+	})
+
+	t.Run("ProviderResponsesPricedFromFeed", func(t *testing.T) {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"id":"x","choices":[],"usage":{"prompt_tokens":1000,"completion_tokens":1000,"total_tokens":2000}}`))
+		}))
+		defer upstream.Close()
+
+		path := filepath.Join(t.TempDir(), "pricing.json")
+		writeFeed(t, path, feed)
+		updater, prices, _ := newUpdater(t, path, 0)
+		config := providerConfig(prices)
+		config.Type = "openai"
+		config.Endpoint = upstream.URL
+		config.Timeout = time.Second
+		config.CircuitBreaker = base.CircuitBreakerConfig{FailureThreshold: 5, Timeout: time.Minute}
+		registry := providers.NewRegistry(sugar)
+		if err := registry.InitializeFromConfig(map[string]*base.ProviderConfig{"openai": config}); err != nil {
+			t.Fatalf("Failed to initialize providers: %v", err)
+		}
+		if err := updater.Refresh(ctx); err != nil {
+			t.Fatalf("Failed to apply feed: %v", err)
+		}
+
+		resp, err := registry.RouteRequest(ctx, &base.ProviderRequest{
+			RequestID: "priced",
+			Model:     "gpt-4o",
+			Messages:  []base.Message{{Role: "user", Content: "hi"}},
+		})
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		if math.Abs(resp.Cost-0.0125) > 1e-12 {
+			t.Errorf("Expected the response priced at the feed's $0.0125, got %v", resp.Cost)
+		}
+	})
+}
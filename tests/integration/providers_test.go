@@ -0,0 +1,1810 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/circuitbreaker"
+	"github.com/bendiamant/leash-gateway/internal/gatewayerrors"
+	"github.com/bendiamant/leash-gateway/internal/metrics"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"github.com/bendiamant/leash-gateway/internal/providers"
+	"github.com/bendiamant/leash-gateway/internal/providers/anthropic"
+	"github.com/bendiamant/leash-gateway/internal/providers/base"
+	"github.com/bendiamant/leash-gateway/internal/providers/openai"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+func TestProviderModelPaths(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+
+	var requestedPaths []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestedPaths = append(requestedPaths, r.URL.EscapedPath())
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"x","choices":[],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`))
+	}))
+	defer upstream.Close()
+
+	provider := openai.NewOpenAIProvider(&base.ProviderConfig{
+		Name:     "self-hosted",
+		Endpoint: upstream.URL,
+		Timeout:  time.Second,
+		CircuitBreaker: base.CircuitBreakerConfig{
+			FailureThreshold: 5,
+			Timeout:          time.Minute,
+		},
+		Models: []base.ModelConfig{
+			{Name: "llama-3-70b", Path: "/v1/models/{model}/chat"},
+			{Name: "mistral/7b", Path: "/mistral/{model}/chat/completions"},
+			{Name: "gpt-4o-mini"},
+		},
+	}, circuitbreaker.NewManager(), sugar)
+
+	t.Run("ConstructedURLs", func(t *testing.T) {
+		cases := map[string]string{
+			"llama-3-70b": upstream.URL + "/v1/models/llama-3-70b/chat",
+			"mistral/7b":  upstream.URL + "/mistral/mistral%2F7b/chat/completions",
+			"gpt-4o-mini": upstream.URL + "/chat/completions",
+			"unknown":     upstream.URL + "/chat/completions",
+		}
+		for model, expected := range cases {
+			if url := provider.ChatCompletionsURL(model); url != expected {
+				t.Errorf("Model %s: expected URL %s, got %s", model, expected, url)
+			}
+		}
+	})
+
+	t.Run("RequestRoutedToModelPath", func(t *testing.T) {
+		requestedPaths = nil
+		_, err := provider.ProcessRequest(context.Background(), &base.ProviderRequest{
+			RequestID: "path-req",
+			Model:     "llama-3-70b",
+			Messages:  []base.Message{{Role: "user", Content: "hi"}},
+		})
+		if err != nil {
+			t.Fatalf("Provider request failed: %v", err)
+		}
+		if len(requestedPaths) != 1 || requestedPaths[0] != "/v1/models/llama-3-70b/chat" {
+			t.Errorf("Expected request to per-model path, got %v", requestedPaths)
+		}
+	})
+}
+
+func TestProviderRetryClassification(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+
+	// newFlakyProvider returns a provider whose upstream fails once with status
+	// before succeeding, and a counter of upstream calls
+	newFlakyProvider := func(t *testing.T, status int, retryable, nonRetryable []int) (*openai.OpenAIProvider, *int) {
+		calls := 0
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				w.WriteHeader(status)
+				return
+			}
+			w.Write([]byte(`{"id":"x","choices":[]}`))
+		}))
+		t.Cleanup(upstream.Close)
+
+		provider := openai.NewOpenAIProvider(&base.ProviderConfig{
+			Name:                    "flaky",
+			Endpoint:                upstream.URL,
+			Timeout:                 time.Second,
+			RetryAttempts:           2,
+			RetryDelay:              time.Millisecond,
+			RetryableStatusCodes:    retryable,
+			NonRetryableStatusCodes: nonRetryable,
+			CircuitBreaker: base.CircuitBreakerConfig{
+				FailureThreshold: 50,
+				MinRequests:      10,
+				Timeout:          time.Minute,
+			},
+		}, circuitbreaker.NewManager(), sugar)
+		return provider, &calls
+	}
+
+	request := &base.ProviderRequest{
+		RequestID: "retry-req",
+		Model:     "gpt-4o-mini",
+		Messages:  []base.Message{{Role: "user", Content: "hi"}},
+	}
+
+	t.Run("ExtraRetryableCodeIsRetried", func(t *testing.T) {
+		provider, calls := newFlakyProvider(t, 529, []int{529}, nil)
+
+		resp, err := provider.ProcessRequest(context.Background(), request)
+		if err != nil {
+			t.Fatalf("Provider request failed: %v", err)
+		}
+		if *calls != 2 || resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected 529 to be retried once then succeed, got %d calls and status %d", *calls, resp.StatusCode)
+		}
+	})
+
+	t.Run("UnconfiguredCodeIsNotRetried", func(t *testing.T) {
+		provider, calls := newFlakyProvider(t, 529, nil, nil)
+
+		resp, err := provider.ProcessRequest(context.Background(), request)
+		if err != nil {
+			t.Fatalf("Provider request failed: %v", err)
+		}
+		if *calls != 1 || resp.StatusCode != 529 {
+			t.Errorf("Expected 529 not to be retried by default, got %d calls and status %d", *calls, resp.StatusCode)
+		}
+	})
+
+	t.Run("NonRetryableOverrideIsNotRetried", func(t *testing.T) {
+		provider, calls := newFlakyProvider(t, http.StatusServiceUnavailable, nil, []int{http.StatusServiceUnavailable})
+
+		resp, err := provider.ProcessRequest(context.Background(), request)
+		if err != nil {
+			t.Fatalf("Provider request failed: %v", err)
+		}
+		if *calls != 1 || resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("Expected 503 not to be retried, got %d calls and status %d", *calls, resp.StatusCode)
+		}
+	})
+
+	t.Run("DefaultRetryableCodeIsRetried", func(t *testing.T) {
+		provider, calls := newFlakyProvider(t, http.StatusServiceUnavailable, nil, nil)
+
+		resp, err := provider.ProcessRequest(context.Background(), request)
+		if err != nil {
+			t.Fatalf("Provider request failed: %v", err)
+		}
+		if *calls != 2 || resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected 503 to be retried by default, got %d calls and status %d", *calls, resp.StatusCode)
+		}
+	})
+}
+
+func TestProviderHeaderTemplates(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+
+	var received http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.Write([]byte(`{"id":"x","choices":[]}`))
+	}))
+	defer upstream.Close()
+
+	config := &base.ProviderConfig{
+		Name:     "templated",
+		Endpoint: upstream.URL,
+		Timeout:  time.Second,
+		CircuitBreaker: base.CircuitBreakerConfig{
+			FailureThreshold: 50,
+			MinRequests:      10,
+			Timeout:          time.Minute,
+		},
+		Headers: map[string]string{
+			"X-Static":       "fixed",
+			"X-Model":        "{{.Model}}",
+			"X-Tenant":       "team-{{.TenantID}}",
+			"anthropic-beta": `{{if eq .Model "gpt-4o"}}vision-2024{{end}}`,
+		},
+	}
+	provider := openai.NewOpenAIProvider(config, circuitbreaker.NewManager(), sugar)
+
+	t.Run("ResolvedPerRequest", func(t *testing.T) {
+		for _, model := range []string{"gpt-4o", "gpt-4o-mini"} {
+			_, err := provider.ProcessRequest(context.Background(), &base.ProviderRequest{
+				RequestID: "hdr-" + model,
+				TenantID:  "acme",
+				Model:     model,
+				Messages:  []base.Message{{Role: "user", Content: "hi"}},
+			})
+			if err != nil {
+				t.Fatalf("Provider request failed: %v", err)
+			}
+			if received.Get("X-Model") != model || received.Get("X-Tenant") != "team-acme" || received.Get("X-Static") != "fixed" {
+				t.Errorf("Expected headers resolved for %s/acme, got %v", model, received)
+			}
+		}
+		if received.Get("anthropic-beta") != "" {
+			t.Errorf("Expected conditional header to be empty for gpt-4o-mini, got %q", received.Get("anthropic-beta"))
+		}
+	})
+
+	t.Run("InvalidTemplatesRejected", func(t *testing.T) {
+		for _, value := range []string{"{{.Model", "{{.Unknown}}"} {
+			if _, err := base.ParseHeaderTemplates(map[string]string{"X-Bad": value}); err == nil {
+				t.Errorf("Expected template %q to be rejected", value)
+			}
+			err := provider.UpdateConfig(&base.ProviderConfig{Name: "templated", Headers: map[string]string{"X-Bad": value}})
+			if err == nil {
+				t.Errorf("Expected UpdateConfig to reject template %q", value)
+			}
+		}
+	})
+}
+
+func TestProviderParameterMapping(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+
+	var received map[string]interface{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = nil
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Write([]byte(`{"id":"msg","type":"message","content":[],"usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer upstream.Close()
+
+	newProvider := func(mapping base.ParameterMapping) *anthropic.AnthropicProvider {
+		return anthropic.NewAnthropicProvider(&base.ProviderConfig{
+			Name:       "anthropic",
+			Endpoint:   upstream.URL,
+			Timeout:    time.Second,
+			Parameters: mapping,
+			CircuitBreaker: base.CircuitBreakerConfig{
+				FailureThreshold: 50,
+				MinRequests:      10,
+				Timeout:          time.Minute,
+			},
+		}, circuitbreaker.NewManager(), sugar)
+	}
+
+	request := func() *base.ProviderRequest {
+		return &base.ProviderRequest{
+			RequestID: "params-req",
+			Model:     "claude-3-5-sonnet",
+			Messages:  []base.Message{{Role: "user", Content: "hi"}},
+			Parameters: map[string]interface{}{
+				"temperature":       0.2,
+				"stop":              "END",
+				"top_k":             40.0,
+				"frequency_penalty": 0.5,
+				"logit_bias":        map[string]interface{}{"50256": -100.0},
+			},
+		}
+	}
+
+	t.Run("OpenAIParamsMapped", func(t *testing.T) {
+		resp, err := newProvider(base.ParameterMapping{}).ProcessRequest(context.Background(), request())
+		if err != nil {
+			t.Fatalf("Provider request failed: %v", err)
+		}
+
+		if stop, _ := received["stop_sequences"].([]interface{}); len(stop) != 1 || stop[0] != "END" {
+			t.Errorf("Expected stop to map to stop_sequences [END], got %v", received["stop_sequences"])
+		}
+		if _, ok := received["stop"]; ok {
+			t.Errorf("Expected OpenAI stop parameter not to be sent")
+		}
+		if received["temperature"] != 0.2 || received["top_k"] != 40.0 {
+			t.Errorf("Expected supported parameters to pass through, got %v", received)
+		}
+		for _, name := range []string{"frequency_penalty", "logit_bias"} {
+			if _, ok := received[name]; ok {
+				t.Errorf("Expected unsupported %s to be dropped", name)
+			}
+		}
+		if dropped := resp.Metadata[base.DroppedParametersMetadata]; dropped != "frequency_penalty,logit_bias" {
+			t.Errorf("Expected dropped parameters to be annotated, got %q", dropped)
+		}
+	})
+
+	t.Run("ConfiguredRenameAndUnsupported", func(t *testing.T) {
+		_, err := newProvider(base.ParameterMapping{
+			Rename:      map[string]string{"top_k": "top_k_sampling"},
+			Unsupported: []string{"temperature"},
+		}).ProcessRequest(context.Background(), request())
+		if err != nil {
+			t.Fatalf("Provider request failed: %v", err)
+		}
+		if _, ok := received["top_k_sampling"]; !ok {
+			t.Errorf("Expected configured rename to apply, got %v", received)
+		}
+		if _, ok := received["temperature"]; ok {
+			t.Errorf("Expected configured unsupported parameter to be dropped")
+		}
+	})
+
+	t.Run("ErrorOnUnsupported", func(t *testing.T) {
+		received = nil
+		_, err := newProvider(base.ParameterMapping{OnUnsupported: base.UnsupportedParameterError}).ProcessRequest(context.Background(), request())
+		if !errors.Is(err, base.ErrUnsupportedParameter) {
+			t.Fatalf("Expected ErrUnsupportedParameter, got %v", err)
+		}
+		if !strings.Contains(err.Error(), "frequency_penalty") || received != nil {
+			t.Errorf("Expected error naming the parameter and no upstream call, got %v", err)
+		}
+	})
+
+	t.Run("OpenAIStreamingMapped", func(t *testing.T) {
+		var streamed map[string]interface{}
+		streamUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			streamed = nil
+			json.NewDecoder(r.Body).Decode(&streamed)
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: [DONE]\n\n"))
+		}))
+		defer streamUpstream.Close()
+
+		newStreamingProvider := func(mapping base.ParameterMapping) *openai.OpenAIProvider {
+			return openai.NewOpenAIProvider(&base.ProviderConfig{
+				Name:       "openai",
+				Endpoint:   streamUpstream.URL,
+				Timeout:    time.Second,
+				Parameters: mapping,
+				CircuitBreaker: base.CircuitBreakerConfig{
+					FailureThreshold: 50,
+					MinRequests:      10,
+					Timeout:          time.Minute,
+				},
+			}, circuitbreaker.NewManager(), sugar)
+		}
+
+		stream, err := newStreamingProvider(base.ParameterMapping{
+			Rename:      map[string]string{"top_k": "top_k_sampling"},
+			Unsupported: []string{"logit_bias"},
+		}).ProcessStreamingRequest(context.Background(), request())
+		if err != nil {
+			t.Fatalf("Streaming request failed: %v", err)
+		}
+		for range stream.Stream {
+		}
+
+		if _, ok := streamed["top_k_sampling"]; !ok || streamed["stream"] != true {
+			t.Errorf("Expected configured rename to apply to the streamed request, got %v", streamed)
+		}
+		if _, ok := streamed["logit_bias"]; ok {
+			t.Errorf("Expected configured unsupported parameter to be dropped from the streamed request")
+		}
+		if streamed["frequency_penalty"] != 0.5 || streamed["stop"] != "END" {
+			t.Errorf("Expected other parameters to pass through, got %v", streamed)
+		}
+		if dropped := stream.Metadata[base.DroppedParametersMetadata]; dropped != "logit_bias" {
+			t.Errorf("Expected dropped parameters to be annotated, got %q", dropped)
+		}
+
+		streamed = nil
+		_, err = newStreamingProvider(base.ParameterMapping{
+			Unsupported:   []string{"logit_bias"},
+			OnUnsupported: base.UnsupportedParameterError,
+		}).ProcessStreamingRequest(context.Background(), request())
+		if !errors.Is(err, base.ErrUnsupportedParameter) || streamed != nil {
+			t.Errorf("Expected ErrUnsupportedParameter and no upstream call, got %v", err)
+		}
+	})
+}
+
+func TestProviderTLSPinning(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"x","choices":[]}`))
+	}))
+	upstream.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	upstream.StartTLS()
+	defer upstream.Close()
+
+	// Trust the test server's self-signed certificate through a CA file
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: upstream.Certificate().Raw})
+	if err := os.WriteFile(caFile, certPEM, 0o600); err != nil {
+		t.Fatalf("Failed to write CA file: %v", err)
+	}
+	fingerprint := sha256.Sum256(upstream.Certificate().Raw)
+	serverPin := hex.EncodeToString(fingerprint[:])
+	otherPin := strings.Repeat("ab", sha256.Size)
+
+	call := func(t *testing.T, tlsConfig base.TLSConfig) error {
+		t.Helper()
+		provider := openai.NewOpenAIProvider(&base.ProviderConfig{
+			Name:     "pinned",
+			Endpoint: upstream.URL,
+			Timeout:  time.Second,
+			TLS:      tlsConfig,
+			CircuitBreaker: base.CircuitBreakerConfig{
+				FailureThreshold: 50,
+				MinRequests:      10,
+				Timeout:          time.Minute,
+			},
+		}, circuitbreaker.NewManager(), sugar)
+		_, err := provider.ProcessRequest(context.Background(), &base.ProviderRequest{
+			RequestID: "tls-req",
+			Model:     "gpt-4o-mini",
+			Messages:  []base.Message{{Role: "user", Content: "hi"}},
+		})
+		return err
+	}
+
+	t.Run("AcceptedWithoutPinning", func(t *testing.T) {
+		if err := call(t, base.TLSConfig{CAFile: caFile}); err != nil {
+			t.Errorf("Expected connection to a trusted server to succeed, got %v", err)
+		}
+	})
+
+	t.Run("AcceptedWithMatchingPin", func(t *testing.T) {
+		colonPin := strings.ToUpper(serverPin[:2]) + ":" + serverPin[2:]
+		if err := call(t, base.TLSConfig{CAFile: caFile, PinnedSHA256: []string{otherPin, colonPin}}); err != nil {
+			t.Errorf("Expected pinned certificate to be accepted, got %v", err)
+		}
+	})
+
+	t.Run("RejectedWhenNotPinned", func(t *testing.T) {
+		err := call(t, base.TLSConfig{CAFile: caFile, PinnedSHA256: []string{otherPin}})
+		if err == nil || !strings.Contains(err.Error(), base.ErrCertificateNotPinned.Error()) {
+			t.Errorf("Expected non-pinned certificate to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("RejectedBelowMinVersion", func(t *testing.T) {
+		if err := call(t, base.TLSConfig{CAFile: caFile, MinVersion: "1.3"}); err == nil {
+			t.Error("Expected TLS 1.2 server to be rejected with min_version 1.3")
+		}
+	})
+
+	t.Run("InvalidSettingsRejected", func(t *testing.T) {
+		for name, tlsConfig := range map[string]base.TLSConfig{
+			"MinVersion": {MinVersion: "1.0"},
+			"Pin":        {PinnedSHA256: []string{"not-hex"}},
+			"CAFile":     {CAFile: filepath.Join(t.TempDir(), "missing.pem")},
+		} {
+			if err := tlsConfig.Validate(); err == nil {
+				t.Errorf("%s: expected invalid TLS settings to be rejected", name)
+			}
+		}
+	})
+}
+
+func TestProviderStreamPartialUsage(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+
+	// Each event delivers 20 characters (5 estimated tokens) of output
+	event := `data: {"choices":[{"index":0,"delta":{"content":"twenty characters!!!"}}]}` + "\n\n"
+	newUpstream := func(t *testing.T, complete bool) *httptest.Server {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for i := 0; i < 3; i++ {
+				w.Write([]byte(event))
+				w.(http.Flusher).Flush()
+			}
+			if !complete {
+				// Drop the connection mid-stream
+				if conn, _, err := w.(http.Hijacker).Hijack(); err == nil {
+					conn.Close()
+				}
+				return
+			}
+			w.Write([]byte(`data: {"choices":[],"usage":{"prompt_tokens":7,"completion_tokens":15,"total_tokens":22}}` + "\n\n"))
+			w.Write([]byte("data: [DONE]\n\n"))
+		}))
+		t.Cleanup(upstream.Close)
+		return upstream
+	}
+
+	newProvider := func(endpoint string) *openai.OpenAIProvider {
+		return openai.NewOpenAIProvider(&base.ProviderConfig{
+			Name:     "streaming",
+			Endpoint: endpoint,
+			Timeout:  5 * time.Second,
+			CircuitBreaker: base.CircuitBreakerConfig{
+				FailureThreshold: 50,
+				MinRequests:      10,
+				Timeout:          time.Minute,
+			},
+			Models: []base.ModelConfig{{Name: "gpt-4o-mini", CostPer1kInputTokens: 1, CostPer1kOutputTokens: 2}},
+		}, circuitbreaker.NewManager(), sugar)
+	}
+
+	// 40 characters of prompt estimate to 10 input tokens
+	request := &base.ProviderRequest{
+		RequestID: "stream-req",
+		Model:     "gpt-4o-mini",
+		Messages:  []base.Message{{Role: "user", Content: strings.Repeat("x", 40)}},
+		Streaming: true,
+	}
+
+	// drain collects the stream's data and returns it with the final chunk
+	drain := func(t *testing.T, provider *openai.OpenAIProvider) ([]byte, base.StreamChunk) {
+		t.Helper()
+
+		stream, err := provider.ProcessStreamingRequest(context.Background(), request)
+		if err != nil {
+			t.Fatalf("Streaming request failed: %v", err)
+		}
+		var data []byte
+		for chunk := range stream.Stream {
+			if chunk.Done {
+				return data, chunk
+			}
+			data = append(data, chunk.Data...)
+		}
+		t.Fatal("Stream closed without a final chunk")
+		return nil, base.StreamChunk{}
+	}
+
+	t.Run("ErrorMidStreamReportsPartialUsage", func(t *testing.T) {
+		data, final := drain(t, newProvider(newUpstream(t, false).URL))
+
+		if strings.Count(string(data), "twenty characters") != 3 {
+			t.Errorf("Expected the three delivered events before the failure, got %q", data)
+		}
+		if final.Error == nil {
+			t.Fatal("Expected the final chunk to carry the stream error")
+		}
+		if !strings.Contains(string(final.Data), `"type":"stream_error"`) || !strings.HasPrefix(string(final.Data), "data: ") {
+			t.Errorf("Expected an SSE error event as the terminal chunk, got %q", final.Data)
+		}
+		if final.Metadata[base.PartialUsageMetadata] != "true" {
+			t.Errorf("Expected usage to be marked partial, got %v", final.Metadata)
+		}
+		if final.Usage == nil || final.Usage.PromptTokens != 10 || final.Usage.CompletionTokens != 15 || final.Usage.TotalTokens != 25 {
+			t.Fatalf("Expected 10 input and 15 output tokens, got %+v", final.Usage)
+		}
+		if expected := 10.0/1000*1 + 15.0/1000*2; final.Cost != expected {
+			t.Errorf("Expected partial cost %f, got %f", expected, final.Cost)
+		}
+	})
+
+	t.Run("CompleteStreamUsesReportedUsage", func(t *testing.T) {
+		_, final := drain(t, newProvider(newUpstream(t, true).URL))
+
+		if final.Error != nil || len(final.Data) != 0 {
+			t.Fatalf("Expected a clean end of stream, got error %v and data %q", final.Error, final.Data)
+		}
+		if final.Metadata[base.PartialUsageMetadata] != "" {
+			t.Errorf("Expected provider-reported usage, got %v", final.Metadata)
+		}
+		if final.Usage == nil || final.Usage.PromptTokens != 7 || final.Usage.CompletionTokens != 15 {
+			t.Errorf("Expected the provider's usage, got %+v", final.Usage)
+		}
+	})
+}
+
+func TestProviderHealthCheckProbe(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+
+	type probe struct {
+		method, path, body string
+	}
+	var probes []probe
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		probes = append(probes, probe{r.Method, r.URL.Path, string(body)})
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	providerConfig := func(healthCheck base.HealthCheckConfig) *base.ProviderConfig {
+		return &base.ProviderConfig{
+			Name:     "health-test",
+			Endpoint: upstream.URL,
+			Timeout:  time.Second,
+			CircuitBreaker: base.CircuitBreakerConfig{
+				FailureThreshold: 50,
+				MinRequests:      10,
+				Timeout:          time.Minute,
+			},
+			HealthCheck: healthCheck,
+		}
+	}
+	check := func(t *testing.T, provider base.Provider) (probe, error) {
+		t.Helper()
+		probes = nil
+		_, err := provider.Health(context.Background())
+		if len(probes) != 1 {
+			t.Fatalf("Expected one health check request, got %v", probes)
+		}
+		return probes[0], err
+	}
+
+	t.Run("DefaultProbes", func(t *testing.T) {
+		got, err := check(t, openai.NewOpenAIProvider(providerConfig(base.HealthCheckConfig{}), circuitbreaker.NewManager(), sugar))
+		if err != nil || got.method != http.MethodGet || got.path != "/models" {
+			t.Errorf("Expected OpenAI default GET /models, got %+v (%v)", got, err)
+		}
+		got, err = check(t, anthropic.NewAnthropicProvider(providerConfig(base.HealthCheckConfig{}), circuitbreaker.NewManager(), sugar))
+		if err != nil || got.method != http.MethodPost || got.path != "/messages" || !strings.Contains(got.body, `"max_tokens":1`) {
+			t.Errorf("Expected Anthropic default minimal POST /messages, got %+v (%v)", got, err)
+		}
+	})
+
+	t.Run("ConfiguredPathUsesGet", func(t *testing.T) {
+		for _, provider := range []base.Provider{
+			openai.NewOpenAIProvider(providerConfig(base.HealthCheckConfig{Path: "/healthz"}), circuitbreaker.NewManager(), sugar),
+			anthropic.NewAnthropicProvider(providerConfig(base.HealthCheckConfig{Path: "/healthz"}), circuitbreaker.NewManager(), sugar),
+		} {
+			got, err := check(t, provider)
+			if err != nil || got != (probe{http.MethodGet, "/healthz", ""}) {
+				t.Errorf("Expected GET /healthz without a body, got %+v (%v)", got, err)
+			}
+		}
+	})
+
+	t.Run("ConfiguredMethodAndBody", func(t *testing.T) {
+		provider := openai.NewOpenAIProvider(providerConfig(base.HealthCheckConfig{
+			Path:   "/v1/ping",
+			Method: "post",
+			Body:   `{"probe":true}`,
+		}), circuitbreaker.NewManager(), sugar)
+		got, err := check(t, provider)
+		if err != nil || got != (probe{http.MethodPost, "/v1/ping", `{"probe":true}`}) {
+			t.Errorf("Expected configured POST /v1/ping with body, got %+v (%v)", got, err)
+		}
+	})
+
+	t.Run("FailingProbeUnhealthy", func(t *testing.T) {
+		provider := openai.NewOpenAIProvider(providerConfig(base.HealthCheckConfig{Path: "/down"}), circuitbreaker.NewManager(), sugar)
+		if _, err := check(t, provider); err == nil || provider.IsHealthy() {
+			t.Error("Expected a failing configured probe to mark the provider unhealthy")
+		}
+	})
+}
+
+func TestProviderCostReconciliation(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/messages" {
+			w.Write([]byte(`{"id":"msg","content":[{"type":"text","text":"hi"}],
+				"usage":{"input_tokens":500,"cache_read_input_tokens":1500,"output_tokens":500}}`))
+			return
+		}
+		w.Write([]byte(`{"id":"x","choices":[],"usage":{"prompt_tokens":2000,"completion_tokens":500,"total_tokens":2500,
+			"prompt_tokens_details":{"cached_tokens":1500}}}`))
+	}))
+	defer upstream.Close()
+
+	providerConfig := func(cachedRate float64) *base.ProviderConfig {
+		return &base.ProviderConfig{
+			Name:     "cost-test",
+			Endpoint: upstream.URL,
+			Timeout:  time.Second,
+			CircuitBreaker: base.CircuitBreakerConfig{
+				FailureThreshold: 50,
+				MinRequests:      10,
+				Timeout:          time.Minute,
+			},
+			Models: []base.ModelConfig{{
+				Name:                       "cached-model",
+				CostPer1kInputTokens:       1,
+				CostPer1kOutputTokens:      2,
+				CostPer1kCachedInputTokens: cachedRate,
+			}},
+		}
+	}
+	request := &base.ProviderRequest{
+		RequestID: "cost-req",
+		Model:     "cached-model",
+		Messages:  []base.Message{{Role: "user", Content: "hi"}},
+	}
+	approx := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+	// 2000 prompt tokens, 1500 of them cached, and 500 completion tokens
+	const estimated = 2.0*1 + 0.5*2
+	const reconciled = 0.5*1 + 1.5*0.25 + 0.5*2
+
+	t.Run("CachedTokensDiscounted", func(t *testing.T) {
+		for name, provider := range map[string]base.Provider{
+			"openai":    openai.NewOpenAIProvider(providerConfig(0.25), circuitbreaker.NewManager(), sugar),
+			"anthropic": anthropic.NewAnthropicProvider(providerConfig(0.25), circuitbreaker.NewManager(), sugar),
+		} {
+			resp, err := provider.ProcessRequest(context.Background(), request)
+			if err != nil {
+				t.Fatalf("%s: provider request failed: %v", name, err)
+			}
+			if resp.Usage.PromptTokens != 2000 || resp.Usage.CachedTokens() != 1500 {
+				t.Errorf("%s: expected 2000 prompt tokens with 1500 cached, got %+v", name, resp.Usage)
+			}
+			if !approx(resp.Cost, estimated) || !approx(resp.ReconciledCost, reconciled) {
+				t.Errorf("%s: expected estimated cost %f and reconciled cost %f, got %f and %f",
+					name, estimated, reconciled, resp.Cost, resp.ReconciledCost)
+			}
+		}
+	})
+
+	t.Run("NoCachedRateBillsInputRate", func(t *testing.T) {
+		provider := openai.NewOpenAIProvider(providerConfig(0), circuitbreaker.NewManager(), sugar)
+		resp, err := provider.ProcessRequest(context.Background(), request)
+		if err != nil {
+			t.Fatalf("Provider request failed: %v", err)
+		}
+		if !approx(resp.Cost, estimated) || !approx(resp.ReconciledCost, estimated) {
+			t.Errorf("Expected both costs to be %f without a cached rate, got %f and %f", estimated, resp.Cost, resp.ReconciledCost)
+		}
+	})
+}
+
+func TestProviderWeightedRouting(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+
+	// Each upstream names itself in the response so routing can be checked
+	newUpstream := func(t *testing.T, id string) *httptest.Server {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"id":%q,"choices":[],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`, id)
+		}))
+		t.Cleanup(upstream.Close)
+		return upstream
+	}
+	providerConfig := func(endpoint string, weight float64) *base.ProviderConfig {
+		return &base.ProviderConfig{
+			Type:     "openai",
+			Endpoint: endpoint,
+			Timeout:  time.Second,
+			CircuitBreaker: base.CircuitBreakerConfig{
+				FailureThreshold: 50,
+				MinRequests:      10,
+				Timeout:          time.Minute,
+			},
+			Models: []base.ModelConfig{
+				{Name: "gpt-4o", RoutingWeight: weight},
+				{Name: "gpt-4o-mini"},
+			},
+		}
+	}
+	newRegistry := func(t *testing.T, openaiWeight, azureWeight float64) *providers.Registry {
+		registry := providers.NewRegistry(sugar)
+		if err := registry.InitializeFromConfig(map[string]*base.ProviderConfig{
+			"openai":       providerConfig(newUpstream(t, "openai").URL, openaiWeight),
+			"azure-openai": providerConfig(newUpstream(t, "azure-openai").URL, azureWeight),
+		}); err != nil {
+			t.Fatalf("Failed to initialize providers: %v", err)
+		}
+		return registry
+	}
+
+	t.Run("SplitApproximatesWeights", func(t *testing.T) {
+		registry := newRegistry(t, 70, 30)
+
+		const requests = 4000
+		counts := make(map[string]int)
+		for i := 0; i < requests; i++ {
+			req := &base.ProviderRequest{RequestID: fmt.Sprintf("req-%d", i), Model: "gpt-4o"}
+			provider, err := registry.SelectProvider(req)
+			if err != nil {
+				t.Fatalf("Failed to select provider: %v", err)
+			}
+			if req.Metadata[providers.RoutedProviderKey] != provider.Name() {
+				t.Fatalf("Expected request tagged with %s, got %v", provider.Name(), req.Metadata)
+			}
+			counts[provider.Name()]++
+		}
+
+		share := float64(counts["openai"]) / requests
+		if math.Abs(share-0.7) > 0.03 {
+			t.Errorf("Expected about 70%% of requests routed to openai, got %.1f%% (%v)", share*100, counts)
+		}
+		if counts["openai"]+counts["azure-openai"] != requests {
+			t.Errorf("Expected every request routed to a weighted provider, got %v", counts)
+		}
+	})
+
+	t.Run("RequestAndResponseTagged", func(t *testing.T) {
+		registry := newRegistry(t, 50, 50)
+
+		seen := make(map[string]bool)
+		for i := 0; i < 50; i++ {
+			req := &base.ProviderRequest{
+				RequestID: fmt.Sprintf("tagged-%d", i),
+				Model:     "gpt-4o",
+				Messages:  []base.Message{{Role: "user", Content: "hi"}},
+			}
+			resp, err := registry.RouteRequest(context.Background(), req)
+			if err != nil {
+				t.Fatalf("Routed request failed: %v", err)
+			}
+			routed := resp.Metadata[providers.RoutedProviderKey]
+			if routed == "" || routed != req.Metadata[providers.RoutedProviderKey] {
+				t.Fatalf("Expected request and response tagged with the same provider, got %q and %q",
+					req.Metadata[providers.RoutedProviderKey], routed)
+			}
+			if !strings.Contains(string(resp.Body), fmt.Sprintf("%q", routed)) {
+				t.Errorf("Expected the response from %s, got %s", routed, resp.Body)
+			}
+			seen[routed] = true
+
+			// A retried request stays on the same provider
+			if again, _ := registry.SelectProvider(req); again.Name() != routed {
+				t.Errorf("Expected request %s to stay on %s, got %s", req.RequestID, routed, again.Name())
+			}
+		}
+		if !seen["openai"] || !seen["azure-openai"] {
+			t.Errorf("Expected traffic on both providers, got %v", seen)
+		}
+	})
+
+	t.Run("UnweightedModelUsesDefaultRouting", func(t *testing.T) {
+		registry := newRegistry(t, 50, 50)
+
+		req := &base.ProviderRequest{RequestID: "unweighted", Model: "gpt-4o-mini"}
+		provider, err := registry.SelectProvider(req)
+		if err != nil {
+			t.Fatalf("Failed to select provider: %v", err)
+		}
+		if provider.Name() != "openai" || req.Metadata[providers.RoutedProviderKey] != "openai" {
+			t.Errorf("Expected gpt-4o-mini routed to openai, got %s (%v)", provider.Name(), req.Metadata)
+		}
+	})
+
+	t.Run("NegativeWeightRejected", func(t *testing.T) {
+		registry := providers.NewRegistry(sugar)
+		err := registry.InitializeFromConfig(map[string]*base.ProviderConfig{
+			"openai": providerConfig(newUpstream(t, "openai").URL, -1),
+		})
+		if err == nil {
+			t.Error("Expected a negative routing weight to be rejected")
+		}
+	})
+}
+
+func TestProviderCostRouting(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	// upstream serves health checks that fail while healthy is false
+	type upstream struct {
+		server  *httptest.Server
+		healthy atomic.Bool
+	}
+	newUpstream := func(t *testing.T) *upstream {
+		u := &upstream{}
+		u.healthy.Store(true)
+		u.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !u.healthy.Load() {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"data":[]}`))
+		}))
+		t.Cleanup(u.server.Close)
+		return u
+	}
+	providerConfig := func(endpoint string, inputCost, outputCost float64) *base.ProviderConfig {
+		return &base.ProviderConfig{
+			Type:     "openai",
+			Endpoint: endpoint,
+			Timeout:  time.Second,
+			CircuitBreaker: base.CircuitBreakerConfig{
+				FailureThreshold: 50,
+				MinRequests:      10,
+				Timeout:          time.Minute,
+			},
+			Models: []base.ModelConfig{{Name: "gpt-4o", CostPer1kInputTokens: inputCost, CostPer1kOutputTokens: outputCost}},
+		}
+	}
+	newRegistry := func(t *testing.T, routing providers.RoutingConfig, cheapCost float64) (*providers.Registry, *upstream) {
+		cheap, pricey := newUpstream(t), newUpstream(t)
+		registry := providers.NewRegistry(sugar)
+		if err := registry.SetRouting(routing); err != nil {
+			t.Fatalf("Failed to set routing: %v", err)
+		}
+		if err := registry.InitializeFromConfig(map[string]*base.ProviderConfig{
+			"azure-openai": providerConfig(cheap.server.URL, cheapCost/4, cheapCost*3/4),
+			"openai":       providerConfig(pricey.server.URL, 5, 15),
+		}); err != nil {
+			t.Fatalf("Failed to initialize providers: %v", err)
+		}
+		return registry, cheap
+	}
+	selected := func(t *testing.T, registry *providers.Registry, requestID string) string {
+		t.Helper()
+		req := &base.ProviderRequest{RequestID: requestID, Model: "gpt-4o"}
+		provider, err := registry.SelectProvider(req)
+		if err != nil {
+			t.Fatalf("Failed to select provider: %v", err)
+		}
+		if req.Metadata[providers.RoutedProviderKey] != provider.Name() {
+			t.Fatalf("Expected request tagged with %s, got %v", provider.Name(), req.Metadata)
+		}
+		return provider.Name()
+	}
+
+	t.Run("CheapestHealthyChosen", func(t *testing.T) {
+		registry, _ := newRegistry(t, providers.RoutingConfig{Strategy: providers.StrategyCost}, 10)
+		registry.HealthCheck(ctx)
+
+		for i := 0; i < 20; i++ {
+			if name := selected(t, registry, fmt.Sprintf("cheap-%d", i)); name != "azure-openai" {
+				t.Fatalf("Expected the cheaper provider chosen, got %s", name)
+			}
+		}
+	})
+
+	t.Run("FailoverToPricierHealthyProvider", func(t *testing.T) {
+		registry, cheap := newRegistry(t, providers.RoutingConfig{Strategy: providers.StrategyCost, SwitchMargin: 0.1}, 10)
+		if name := selected(t, registry, "before"); name != "azure-openai" {
+			t.Fatalf("Expected the cheaper provider chosen, got %s", name)
+		}
+
+		cheap.healthy.Store(false)
+		registry.HealthCheck(ctx)
+		if name := selected(t, registry, "during"); name != "openai" {
+			t.Errorf("Expected failover to the pricier healthy provider, got %s", name)
+		}
+
+		cheap.healthy.Store(true)
+		registry.HealthCheck(ctx)
+		if name := selected(t, registry, "after"); name != "azure-openai" {
+			t.Errorf("Expected traffic back on the cheaper provider once healthy, got %s", name)
+		}
+	})
+
+	t.Run("RecoveryDoesNotFlap", func(t *testing.T) {
+		// Within the dwell time a recovered cheaper provider does not take
+		// traffic back
+		registry, cheap := newRegistry(t, providers.RoutingConfig{Strategy: providers.StrategyCost, MinDwell: time.Hour}, 10)
+		cheap.healthy.Store(false)
+		registry.HealthCheck(ctx)
+		selected(t, registry, "failover")
+		cheap.healthy.Store(true)
+		registry.HealthCheck(ctx)
+		if name := selected(t, registry, "recovered"); name != "openai" {
+			t.Errorf("Expected the current provider kept within min_dwell, got %s", name)
+		}
+
+		// Nor does one cheaper by less than the switch margin
+		registry, cheap = newRegistry(t, providers.RoutingConfig{Strategy: providers.StrategyCost, SwitchMargin: 0.5}, 15)
+		cheap.healthy.Store(false)
+		registry.HealthCheck(ctx)
+		selected(t, registry, "failover")
+		cheap.healthy.Store(true)
+		registry.HealthCheck(ctx)
+		if name := selected(t, registry, "recovered"); name != "openai" {
+			t.Errorf("Expected the current provider kept within the switch margin, got %s", name)
+		}
+	})
+
+	t.Run("WeightedStrategyIgnoresPrice", func(t *testing.T) {
+		registry, _ := newRegistry(t, providers.RoutingConfig{Strategy: providers.StrategyWeighted}, 10)
+		if name := selected(t, registry, "weighted"); name != "openai" {
+			t.Errorf("Expected unweighted gpt-4o to use default routing, got %s", name)
+		}
+	})
+
+	t.Run("UnknownStrategyRejected", func(t *testing.T) {
+		if err := providers.NewRegistry(sugar).SetRouting(providers.RoutingConfig{Strategy: "fastest"}); err == nil {
+			t.Error("Expected an unknown routing strategy to be rejected")
+		}
+	})
+}
+
+func TestProviderLatencyRouting(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	// upstream answers chat completions after a delay and fails health checks
+	// while healthy is false
+	type upstream struct {
+		server  *httptest.Server
+		healthy atomic.Bool
+	}
+	newUpstream := func(t *testing.T, delay time.Duration) *upstream {
+		u := &upstream{}
+		u.healthy.Store(true)
+		u.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !u.healthy.Load() {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			time.Sleep(delay)
+			w.Header().Set("Content-Type", "application/json")
+			if strings.HasSuffix(r.URL.Path, "/models") {
+				w.Write([]byte(`{"data":[]}`))
+				return
+			}
+			w.Write([]byte(`{"id":"c1","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`))
+		}))
+		t.Cleanup(u.server.Close)
+		return u
+	}
+	providerConfig := func(endpoint string) *base.ProviderConfig {
+		return &base.ProviderConfig{
+			Type:     "openai",
+			Endpoint: endpoint,
+			Timeout:  5 * time.Second,
+			CircuitBreaker: base.CircuitBreakerConfig{
+				FailureThreshold: 50,
+				MinRequests:      10,
+				Timeout:          time.Minute,
+			},
+			Models: []base.ModelConfig{{Name: "gpt-4o"}},
+		}
+	}
+	newRegistry := func(t *testing.T, routing providers.RoutingConfig, fastDelay, slowDelay time.Duration) (*providers.Registry, *upstream) {
+		fast, slow := newUpstream(t, fastDelay), newUpstream(t, slowDelay)
+		registry := providers.NewRegistry(sugar)
+		if err := registry.SetRouting(routing); err != nil {
+			t.Fatalf("Failed to set routing: %v", err)
+		}
+		if err := registry.InitializeFromConfig(map[string]*base.ProviderConfig{
+			"fast": providerConfig(fast.server.URL),
+			"slow": providerConfig(slow.server.URL),
+		}); err != nil {
+			t.Fatalf("Failed to initialize providers: %v", err)
+		}
+		return registry, fast
+	}
+	selected := func(t *testing.T, registry *providers.Registry, requestID string) string {
+		t.Helper()
+		provider, err := registry.SelectProvider(&base.ProviderRequest{RequestID: requestID, Model: "gpt-4o"})
+		if err != nil {
+			t.Fatalf("Failed to select provider: %v", err)
+		}
+		return provider.Name()
+	}
+	// feed records latency samples for both providers
+	feed := func(registry *providers.Registry, fast, slow time.Duration) {
+		for i := 0; i < 10; i++ {
+			registry.RecordLatency("fast", "gpt-4o", fast)
+			registry.RecordLatency("slow", "gpt-4o", slow)
+		}
+	}
+	// split counts where many requests are routed
+	split := func(t *testing.T, registry *providers.Registry, prefix string) map[string]int {
+		counts := make(map[string]int)
+		for i := 0; i < 2000; i++ {
+			counts[selected(t, registry, fmt.Sprintf("%s-%d", prefix, i))]++
+		}
+		return counts
+	}
+	routing := providers.RoutingConfig{Strategy: providers.StrategyLatency, LatencySmoothing: 0.5, ExploreFraction: 0.1}
+
+	t.Run("MovingAverage", func(t *testing.T) {
+		registry, _ := newRegistry(t, routing, 0, 0)
+		if _, measured := registry.Latency("fast", "gpt-4o"); measured {
+			t.Fatal("Expected no estimate before any sample")
+		}
+		registry.RecordLatency("fast", "gpt-4o", 100*time.Millisecond)
+		registry.RecordLatency("fast", "gpt-4o", 200*time.Millisecond)
+		if estimate, _ := registry.Latency("fast", "gpt-4o"); estimate != 150*time.Millisecond {
+			t.Errorf("Expected an average of 150ms with smoothing 0.5, got %v", estimate)
+		}
+	})
+
+	t.Run("UnmeasuredProvidersTriedFirst", func(t *testing.T) {
+		registry, _ := newRegistry(t, routing, 0, 0)
+		registry.RecordLatency("fast", "gpt-4o", 10*time.Millisecond)
+		if name := selected(t, registry, "first"); name != "slow" {
+			t.Errorf("Expected the unmeasured provider to be tried, got %s", name)
+		}
+	})
+
+	t.Run("FasterPreferredWithExploration", func(t *testing.T) {
+		registry, _ := newRegistry(t, routing, 0, 0)
+		feed(registry, 50*time.Millisecond, 400*time.Millisecond)
+
+		counts := split(t, registry, "prefer")
+		if counts["slow"] < 100 || counts["slow"] > 300 {
+			t.Errorf("Expected about 10%% of requests to probe the slower provider, got %v", counts)
+		}
+		if counts["fast"] < 1700 {
+			t.Errorf("Expected most requests on the faster provider, got %v", counts)
+		}
+		if selected(t, registry, "prefer-7") != selected(t, registry, "prefer-7") {
+			t.Error("Expected a request ID to be routed consistently")
+		}
+
+		// Routing follows the averages when the providers trade places
+		feed(registry, 600*time.Millisecond, 20*time.Millisecond)
+		if counts := split(t, registry, "shifted"); counts["slow"] < 1700 {
+			t.Errorf("Expected traffic to move to the now faster provider, got %v", counts)
+		}
+	})
+
+	t.Run("NoExplorationWhenDisabled", func(t *testing.T) {
+		registry, _ := newRegistry(t, providers.RoutingConfig{Strategy: providers.StrategyLatency}, 0, 0)
+		feed(registry, 50*time.Millisecond, 400*time.Millisecond)
+		if counts := split(t, registry, "exploit"); counts["slow"] != 0 {
+			t.Errorf("Expected no probing with explore_fraction 0, got %v", counts)
+		}
+	})
+
+	t.Run("UnhealthyFastestSkipped", func(t *testing.T) {
+		registry, fast := newRegistry(t, routing, 0, 0)
+		feed(registry, 50*time.Millisecond, 400*time.Millisecond)
+		fast.healthy.Store(false)
+		registry.HealthCheck(ctx)
+		if counts := split(t, registry, "failover"); counts["slow"] != 2000 {
+			t.Errorf("Expected every request on the healthy provider, got %v", counts)
+		}
+	})
+
+	t.Run("RoutedRequestsMeasured", func(t *testing.T) {
+		registry, _ := newRegistry(t, routing, 0, 100*time.Millisecond)
+		for _, id := range []string{"measure-1", "measure-2"} {
+			if _, err := registry.RouteRequest(ctx, &base.ProviderRequest{
+				RequestID: id, Model: "gpt-4o",
+				Messages: []base.Message{{Role: "user", Content: "hi"}},
+			}); err != nil {
+				t.Fatalf("Routed request failed: %v", err)
+			}
+		}
+		fast, fastMeasured := registry.Latency("fast", "gpt-4o")
+		slow, slowMeasured := registry.Latency("slow", "gpt-4o")
+		if !fastMeasured || !slowMeasured || slow < 100*time.Millisecond || fast >= slow {
+			t.Fatalf("Expected both providers measured with the slow one slower, got fast=%v slow=%v", fast, slow)
+		}
+		if name := selected(t, registry, "after-measure"); name != "fast" {
+			t.Errorf("Expected the measured faster provider chosen, got %s", name)
+		}
+	})
+
+	t.Run("InvalidSettingsRejected", func(t *testing.T) {
+		for _, invalid := range []providers.RoutingConfig{
+			{Strategy: providers.StrategyLatency, LatencySmoothing: 1.5},
+			{Strategy: providers.StrategyLatency, ExploreFraction: 1},
+		} {
+			if err := providers.NewRegistry(sugar).SetRouting(invalid); err == nil {
+				t.Errorf("Expected %+v to be rejected", invalid)
+			}
+		}
+	})
+}
+
+func TestProviderIdempotencyKeys(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+
+	// newProvider returns a provider whose upstream fails each request's
+	// first two attempts, and the idempotency keys it received in order
+	newProvider := func(t *testing.T, header string) (*openai.OpenAIProvider, func() []string) {
+		var mu sync.Mutex
+		var keys []string
+		attempts := make(map[string]int)
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			keys = append(keys, r.Header.Get("Idempotency-Key"))
+			requestID := r.Header.Get("X-Request-ID")
+			attempts[requestID]++
+			failing := attempts[requestID] <= 2
+			mu.Unlock()
+
+			if failing {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(`{"id":"x","choices":[]}`))
+		}))
+		t.Cleanup(upstream.Close)
+
+		provider := openai.NewOpenAIProvider(&base.ProviderConfig{
+			Name:              "openai",
+			Endpoint:          upstream.URL,
+			Timeout:           time.Second,
+			RetryAttempts:     2,
+			RetryDelay:        time.Millisecond,
+			IdempotencyHeader: header,
+			CircuitBreaker: base.CircuitBreakerConfig{
+				FailureThreshold: 50,
+				MinRequests:      10,
+				Timeout:          time.Minute,
+			},
+		}, circuitbreaker.NewManager(), sugar)
+		return provider, func() []string {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]string(nil), keys...)
+		}
+	}
+	request := func(requestID string, headers map[string]string) *base.ProviderRequest {
+		return &base.ProviderRequest{
+			RequestID: requestID,
+			Model:     "gpt-4o-mini",
+			Headers:   headers,
+			Messages:  []base.Message{{Role: "user", Content: "charge my card"}},
+		}
+	}
+
+	t.Run("RetriesReuseKey", func(t *testing.T) {
+		provider, keys := newProvider(t, base.DefaultIdempotencyHeader)
+
+		for _, requestID := range []string{"idem-1", "idem-2"} {
+			resp, err := provider.ProcessRequest(context.Background(), request(requestID, nil))
+			if err != nil || resp.StatusCode != http.StatusOK {
+				t.Fatalf("Expected %s to succeed after retries, got %v", requestID, err)
+			}
+		}
+
+		got := keys()
+		if len(got) != 6 {
+			t.Fatalf("Expected three attempts per request, got %d", len(got))
+		}
+		first, second := got[:3], got[3:]
+		for _, attempts := range [][]string{first, second} {
+			if attempts[0] == "" || attempts[1] != attempts[0] || attempts[2] != attempts[0] {
+				t.Errorf("Expected every attempt at a request to carry the same key, got %v", attempts)
+			}
+		}
+		if first[0] == second[0] {
+			t.Errorf("Expected distinct requests with identical bodies to get distinct keys, got %s for both", first[0])
+		}
+	})
+
+	t.Run("ClientKeyPassedThrough", func(t *testing.T) {
+		provider, keys := newProvider(t, base.DefaultIdempotencyHeader)
+
+		if _, err := provider.ProcessRequest(context.Background(), request("idem-client", map[string]string{"idempotency-key": "client-key"})); err != nil {
+			t.Fatalf("Provider request failed: %v", err)
+		}
+		for _, key := range keys() {
+			if key != "client-key" {
+				t.Errorf("Expected the client's idempotency key passed through, got %q", key)
+			}
+		}
+	})
+
+	t.Run("DisabledSendsNoKey", func(t *testing.T) {
+		provider, keys := newProvider(t, "")
+
+		if _, err := provider.ProcessRequest(context.Background(), request("idem-off", nil)); err != nil {
+			t.Fatalf("Provider request failed: %v", err)
+		}
+		for _, key := range keys() {
+			if key != "" {
+				t.Errorf("Expected no idempotency key without a configured header, got %q", key)
+			}
+		}
+	})
+}
+
+func TestProviderTraceHeaders(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+
+	// The upstream answers with its own request ID, failing requests for an
+	// unknown model the way OpenAI does
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-request-id", "req_upstream_"+r.Header.Get("X-Request-ID"))
+		if r.Header.Get("Accept") == "text/event-stream" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: [DONE]\n\n"))
+			return
+		}
+		var body struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.Model != "gpt-4o-mini" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"message":"model not found"}}`))
+			return
+		}
+		w.Write([]byte(`{"id":"x","choices":[]}`))
+	}))
+	defer upstream.Close()
+
+	newProvider := func(traceHeaders []string) *openai.OpenAIProvider {
+		return openai.NewOpenAIProvider(&base.ProviderConfig{
+			Name:         "openai",
+			Endpoint:     upstream.URL,
+			Timeout:      time.Second,
+			TraceHeaders: traceHeaders,
+			CircuitBreaker: base.CircuitBreakerConfig{
+				FailureThreshold: 50,
+				MinRequests:      10,
+				Timeout:          time.Minute,
+			},
+		}, circuitbreaker.NewManager(), sugar)
+	}
+	request := func(requestID, model string) *base.ProviderRequest {
+		return &base.ProviderRequest{
+			RequestID: requestID,
+			Model:     model,
+			Messages:  []base.Message{{Role: "user", Content: "hello"}},
+		}
+	}
+
+	t.Run("CapturedAndSurfaced", func(t *testing.T) {
+		provider := newProvider([]string{"X-Request-ID"})
+		resp, err := provider.ProcessRequest(context.Background(), request("trace-1", "gpt-4o-mini"))
+		if err != nil {
+			t.Fatalf("Provider request failed: %v", err)
+		}
+		if got := resp.Headers["X-Leash-Provider-X-Request-Id"]; got != "req_upstream_trace-1" {
+			t.Errorf("Expected the provider's x-request-id returned in a namespaced header, got %q", got)
+		}
+		if got := resp.Metadata["provider_x_request_id"]; got != "req_upstream_trace-1" {
+			t.Errorf("Expected the provider's x-request-id in response metadata, got %v", resp.Metadata)
+		}
+	})
+
+	t.Run("CapturedOnErrors", func(t *testing.T) {
+		provider := newProvider([]string{"x-request-id"})
+		resp, err := provider.ProcessRequest(context.Background(), request("trace-2", "gpt-unknown"))
+		if err != nil {
+			t.Fatalf("Provider request failed: %v", err)
+		}
+		if resp.StatusCode != http.StatusNotFound || resp.Headers["X-Leash-Provider-X-Request-Id"] != "req_upstream_trace-2" {
+			t.Errorf("Expected the provider's request ID surfaced with its error, got %d %v", resp.StatusCode, resp.Headers)
+		}
+	})
+
+	t.Run("CapturedOnStreams", func(t *testing.T) {
+		provider := newProvider([]string{"x-request-id"})
+		stream, err := provider.ProcessStreamingRequest(context.Background(), request("trace-3", "gpt-4o-mini"))
+		if err != nil {
+			t.Fatalf("Streaming request failed: %v", err)
+		}
+		for range stream.Stream {
+		}
+		if stream.Headers["X-Leash-Provider-X-Request-Id"] != "req_upstream_trace-3" || stream.Metadata["provider_x_request_id"] != "req_upstream_trace-3" {
+			t.Errorf("Expected the provider's request ID captured from the stream, got %v %v", stream.Headers, stream.Metadata)
+		}
+	})
+
+	t.Run("NotConfigured", func(t *testing.T) {
+		provider := newProvider(nil)
+		resp, err := provider.ProcessRequest(context.Background(), request("trace-4", "gpt-4o-mini"))
+		if err != nil {
+			t.Fatalf("Provider request failed: %v", err)
+		}
+		if _, ok := resp.Headers["X-Leash-Provider-X-Request-Id"]; ok || resp.Metadata["provider_x_request_id"] != "" {
+			t.Errorf("Expected nothing captured without trace headers, got %v %v", resp.Headers, resp.Metadata)
+		}
+	})
+}
+
+func TestProviderReasoningTokens(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"x","choices":[],"usage":{"prompt_tokens":1000,"completion_tokens":3000,"total_tokens":4000,
+			"completion_tokens_details":{"reasoning_tokens":2500}}}`))
+	}))
+	defer upstream.Close()
+
+	providerConfig := func(reasoningRate float64) *base.ProviderConfig {
+		return &base.ProviderConfig{
+			Name:     "reasoning-test",
+			Endpoint: upstream.URL,
+			Timeout:  time.Second,
+			CircuitBreaker: base.CircuitBreakerConfig{
+				FailureThreshold: 50,
+				MinRequests:      10,
+				Timeout:          time.Minute,
+			},
+			Models: []base.ModelConfig{{
+				Name:                     "o1",
+				CostPer1kInputTokens:     1,
+				CostPer1kOutputTokens:    4,
+				CostPer1kReasoningTokens: reasoningRate,
+			}},
+		}
+	}
+	request := &base.ProviderRequest{
+		RequestID: "reasoning-req",
+		Model:     "o1",
+		Messages:  []base.Message{{Role: "user", Content: "think"}},
+	}
+	approx := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+	// 1000 prompt tokens and 3000 completion tokens, 2500 of them reasoning
+	const estimated = 1.0*1 + 3.0*4
+
+	t.Run("ReasoningTokensCosted", func(t *testing.T) {
+		provider := openai.NewOpenAIProvider(providerConfig(3), circuitbreaker.NewManager(), sugar)
+		resp, err := provider.ProcessRequest(context.Background(), request)
+		if err != nil {
+			t.Fatalf("Provider request failed: %v", err)
+		}
+		if resp.Usage.ReasoningTokens() != 2500 {
+			t.Errorf("Expected 2500 reasoning tokens, got %+v", resp.Usage)
+		}
+		const reconciled = 1.0*1 + 0.5*4 + 2.5*3
+		if !approx(resp.Cost, estimated) || !approx(resp.ReconciledCost, reconciled) {
+			t.Errorf("Expected estimated cost %f and reconciled cost %f, got %f and %f", estimated, reconciled, resp.Cost, resp.ReconciledCost)
+		}
+	})
+
+	t.Run("NoReasoningRateBillsOutputRate", func(t *testing.T) {
+		provider := openai.NewOpenAIProvider(providerConfig(0), circuitbreaker.NewManager(), sugar)
+		resp, err := provider.ProcessRequest(context.Background(), request)
+		if err != nil {
+			t.Fatalf("Provider request failed: %v", err)
+		}
+		if !approx(resp.Cost, estimated) || !approx(resp.ReconciledCost, estimated) {
+			t.Errorf("Expected both costs to be %f without a reasoning rate, got %f and %f", estimated, resp.Cost, resp.ReconciledCost)
+		}
+	})
+
+	t.Run("ReasoningTokensCounted", func(t *testing.T) {
+		registry := metrics.NewRegistry()
+		p := pipeline.NewPipeline(sugar)
+		p.SetMetrics(registry)
+
+		ctx := context.Background()
+		_, err := p.ProcessResponse(ctx, &interfaces.ProcessResponseContext{
+			ProcessRequestContext: &interfaces.ProcessRequestContext{RequestID: "reasoning-metrics", TenantID: "tenant-a", Provider: "openai", Model: "o1"},
+			StatusCode:            http.StatusOK,
+			TokensUsed:            &interfaces.TokenUsage{PromptTokens: 1000, CompletionTokens: 3000, TotalTokens: 4000, ReasoningTokens: 2500},
+		})
+		if err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		p.Drain(ctx)
+
+		for tokenType, expected := range map[string]float64{"input": 1000, "output": 3000, "reasoning": 2500} {
+			if got := testutil.ToFloat64(registry.TokensProcessed.WithLabelValues("tenant-a", "openai", "o1", tokenType)); got != expected {
+				t.Errorf("Expected %v %s tokens recorded, got %v", expected, tokenType, got)
+			}
+		}
+	})
+}
+
+func TestProviderResponseSizeLimit(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	small := `{"id":"small","choices":[{"message":{"role":"assistant","content":"hi"}}],"usage":{"prompt_tokens":3,"completion_tokens":1,"total_tokens":4}}`
+	large := `{"id":"large","choices":[{"message":{"role":"assistant","content":"` + strings.Repeat("a", 4096) + `"}}]}`
+
+	newProvider := func(t *testing.T, body string, status int, oversize string) *openai.OpenAIProvider {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			w.Write([]byte(body))
+		}))
+		t.Cleanup(upstream.Close)
+
+		return openai.NewOpenAIProvider(&base.ProviderConfig{
+			Name:             "bounded",
+			Endpoint:         upstream.URL,
+			Timeout:          time.Second,
+			MaxResponseBytes: 1024,
+			OversizeResponse: oversize,
+			CircuitBreaker: base.CircuitBreakerConfig{
+				FailureThreshold: 50,
+				MinRequests:      10,
+				Timeout:          time.Minute,
+			},
+		}, circuitbreaker.NewManager(), sugar)
+	}
+	request := &base.ProviderRequest{
+		RequestID: "size-req",
+		Model:     "gpt-4o-mini",
+		Messages:  []base.Message{{Role: "user", Content: "hi"}},
+	}
+
+	t.Run("UnderLimitBuffered", func(t *testing.T) {
+		resp, err := newProvider(t, small, http.StatusOK, base.OversizeResponseError).ProcessRequest(ctx, request)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		if string(resp.Body) != small || resp.BodyStream != nil {
+			t.Errorf("Expected the body buffered, got %q", resp.Body)
+		}
+		if resp.Usage == nil || resp.Usage.TotalTokens != 4 {
+			t.Errorf("Expected usage parsed from the buffered body, got %+v", resp.Usage)
+		}
+	})
+
+	t.Run("OverLimitFails", func(t *testing.T) {
+		_, err := newProvider(t, large, http.StatusOK, base.OversizeResponseError).ProcessRequest(ctx, request)
+		var tooLarge *base.ResponseTooLargeError
+		if !errors.As(err, &tooLarge) || tooLarge.Limit != 1024 {
+			t.Fatalf("Expected a response too large error, got %v", err)
+		}
+	})
+
+	t.Run("OverLimitStreamed", func(t *testing.T) {
+		resp, err := newProvider(t, large, http.StatusOK, base.OversizeResponseStream).ProcessRequest(ctx, request)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		if resp.BodyStream == nil || resp.Body != nil || resp.Metadata[base.StreamedBodyMetadata] != "true" {
+			t.Fatalf("Expected the body passed through as a stream, got %+v", resp)
+		}
+		defer resp.BodyStream.Close()
+		streamed, err := io.ReadAll(resp.BodyStream)
+		if err != nil || string(streamed) != large {
+			t.Errorf("Expected the whole body from the stream, got %d bytes (%v)", len(streamed), err)
+		}
+	})
+
+	t.Run("OverLimitErrorNotStreamed", func(t *testing.T) {
+		_, err := newProvider(t, large, http.StatusBadRequest, base.OversizeResponseStream).ProcessRequest(ctx, request)
+		var tooLarge *base.ResponseTooLargeError
+		if !errors.As(err, &tooLarge) {
+			t.Fatalf("Expected oversize error responses to fail, got %v", err)
+		}
+	})
+}
+
+func TestProviderRequestCompression(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	// upstream decodes gzip bodies unless it rejects them, recording the
+	// encoding and decoded body of every request
+	type received struct {
+		encoding string
+		body     string
+	}
+	newProvider := func(t *testing.T, acceptGzip bool) (*openai.OpenAIProvider, func() []received) {
+		var mu sync.Mutex
+		var requests []received
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := r.Header.Get("Content-Encoding")
+			if encoding == "gzip" && !acceptGzip {
+				mu.Lock()
+				requests = append(requests, received{encoding: encoding})
+				mu.Unlock()
+				w.WriteHeader(http.StatusUnsupportedMediaType)
+				return
+			}
+			var reader io.Reader = r.Body
+			if encoding == "gzip" {
+				gz, err := gzip.NewReader(r.Body)
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				reader = gz
+			}
+			body, _ := io.ReadAll(reader)
+			mu.Lock()
+			requests = append(requests, received{encoding: encoding, body: string(body)})
+			mu.Unlock()
+			w.Write([]byte(`{"id":"ok","choices":[{"message":{"role":"assistant","content":"ok"}}]}`))
+		}))
+		t.Cleanup(upstream.Close)
+
+		provider := openai.NewOpenAIProvider(&base.ProviderConfig{
+			Name:               "compressed",
+			Endpoint:           upstream.URL,
+			Timeout:            time.Second,
+			RequestCompression: base.CompressionConfig{Enabled: true, MinBytes: 1024},
+			CircuitBreaker: base.CircuitBreakerConfig{
+				FailureThreshold: 50,
+				MinRequests:      10,
+				Timeout:          time.Minute,
+			},
+		}, circuitbreaker.NewManager(), sugar)
+		return provider, func() []received {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]received(nil), requests...)
+		}
+	}
+	document := strings.Repeat("A long document paragraph. ", 1000)
+	request := func(content string) *base.ProviderRequest {
+		return &base.ProviderRequest{
+			RequestID: "compress-req",
+			Model:     "gpt-4o-mini",
+			Messages:  []base.Message{{Role: "user", Content: content}},
+		}
+	}
+
+	t.Run("LargeRequestGzipped", func(t *testing.T) {
+		provider, requests := newProvider(t, true)
+		if _, err := provider.ProcessRequest(ctx, request(document)); err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		got := requests()
+		if len(got) != 1 || got[0].encoding != "gzip" {
+			t.Fatalf("Expected one gzip-encoded request, got %+v", got)
+		}
+		if !strings.Contains(got[0].body, document) {
+			t.Errorf("Expected the decoded body to carry the document, got %d bytes", len(got[0].body))
+		}
+	})
+
+	t.Run("SmallRequestUncompressed", func(t *testing.T) {
+		provider, requests := newProvider(t, true)
+		if _, err := provider.ProcessRequest(ctx, request("hi")); err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		if got := requests(); len(got) != 1 || got[0].encoding != "" {
+			t.Errorf("Expected a small request sent uncompressed, got %+v", got)
+		}
+	})
+
+	t.Run("RejectedFallsBackUncompressed", func(t *testing.T) {
+		provider, requests := newProvider(t, false)
+		for i := 0; i < 2; i++ {
+			resp, err := provider.ProcessRequest(ctx, request(document))
+			if err != nil || resp.StatusCode != http.StatusOK {
+				t.Fatalf("Expected the request to succeed uncompressed, got %v (%v)", resp, err)
+			}
+		}
+
+		got := requests()
+		if len(got) != 3 || got[0].encoding != "gzip" || got[1].encoding != "" || got[2].encoding != "" {
+			t.Fatalf("Expected one rejected gzip attempt then plain requests, got %+v", got)
+		}
+		if !strings.Contains(got[1].body, document) {
+			t.Errorf("Expected the resent body intact, got %d bytes", len(got[1].body))
+		}
+	})
+}
+
+func TestProviderClientDeadline(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	// newRegistry routes gpt-4o to an upstream answering after delay, and
+	// returns a channel receiving each request the upstream saw cancelled
+	newRegistry := func(t *testing.T, deadline providers.ClientDeadlineConfig, delay, providerTimeout time.Duration) (*providers.Registry, chan struct{}) {
+		t.Helper()
+		cancelled := make(chan struct{}, 10)
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// The server notices a closed connection once the body is read
+			io.Copy(io.Discard, r.Body)
+			select {
+			case <-time.After(delay):
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"id":"c1","model":"gpt-4o","choices":[],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`))
+			case <-r.Context().Done():
+				cancelled <- struct{}{}
+			}
+		}))
+		t.Cleanup(upstream.Close)
+
+		registry := providers.NewRegistry(sugar)
+		if err := registry.SetClientDeadline(deadline); err != nil {
+			t.Fatalf("Failed to set client deadline: %v", err)
+		}
+		if err := registry.InitializeFromConfig(map[string]*base.ProviderConfig{
+			"openai": {
+				Type:           "openai",
+				Endpoint:       upstream.URL,
+				Timeout:        providerTimeout,
+				CircuitBreaker: base.CircuitBreakerConfig{FailureThreshold: 50, Timeout: time.Minute},
+				Models:         []base.ModelConfig{{Name: "gpt-4o"}},
+			},
+		}); err != nil {
+			t.Fatalf("Failed to initialize providers: %v", err)
+		}
+		t.Cleanup(func() { registry.Shutdown() })
+		return registry, cancelled
+	}
+	route := func(ctx context.Context, registry *providers.Registry, headers map[string]string) (*base.ProviderResponse, error, time.Duration) {
+		start := time.Now()
+		resp, err := registry.RouteRequest(ctx, &base.ProviderRequest{
+			RequestID: "deadline",
+			Model:     "gpt-4o",
+			Messages:  []base.Message{{Role: "user", Content: "hi"}},
+			Headers:   headers,
+		})
+		return resp, err, time.Since(start)
+	}
+	// timedOut checks a request failed with a provider timeout after timeout
+	// and that the upstream saw its call cancelled
+	timedOut := func(t *testing.T, err error, elapsed, timeout time.Duration, cancelled chan struct{}) {
+		t.Helper()
+		var providerTimeout *gatewayerrors.ProviderTimeoutError
+		if !errors.As(err, &providerTimeout) || providerTimeout.Timeout != timeout {
+			t.Fatalf("Expected a provider timeout after %v, got %v", timeout, err)
+		}
+		if gatewayerrors.Classify(err) != gatewayerrors.ErrorTypeProviderTimeout {
+			t.Errorf("Expected the failure classified as a provider timeout, got %s", gatewayerrors.Classify(err))
+		}
+		if elapsed >= time.Second {
+			t.Errorf("Expected the request to return at the client's deadline, took %v", elapsed)
+		}
+		select {
+		case <-cancelled:
+		case <-time.After(2 * time.Second):
+			t.Error("Expected the upstream call cancelled")
+		}
+	}
+
+	enabled := providers.ClientDeadlineConfig{Enabled: true}
+
+	t.Run("ShortDeadlineCancelsCall", func(t *testing.T) {
+		registry, cancelled := newRegistry(t, enabled, 5*time.Second, 10*time.Second)
+		_, err, elapsed := route(ctx, registry, map[string]string{"x-request-timeout": "100ms"})
+		timedOut(t, err, elapsed, 100*time.Millisecond, cancelled)
+	})
+
+	t.Run("SecondsAccepted", func(t *testing.T) {
+		registry, cancelled := newRegistry(t, enabled, 5*time.Second, 10*time.Second)
+		_, err, elapsed := route(ctx, registry, map[string]string{"X-Request-Timeout": "0.1"})
+		timedOut(t, err, elapsed, 100*time.Millisecond, cancelled)
+	})
+
+	t.Run("BoundedByServerMax", func(t *testing.T) {
+		registry, cancelled := newRegistry(t, providers.ClientDeadlineConfig{Enabled: true, MaxTimeout: 150 * time.Millisecond}, 5*time.Second, 10*time.Second)
+		_, err, elapsed := route(ctx, registry, map[string]string{"X-Request-Timeout": "30s"})
+		timedOut(t, err, elapsed, 150*time.Millisecond, cancelled)
+	})
+
+	t.Run("BoundedByProviderTimeout", func(t *testing.T) {
+		registry, _ := newRegistry(t, enabled, 5*time.Second, 200*time.Millisecond)
+		_, err, elapsed := route(ctx, registry, map[string]string{"X-Request-Timeout": "30s"})
+		var providerTimeout *gatewayerrors.ProviderTimeoutError
+		if !errors.As(err, &providerTimeout) || providerTimeout.Timeout != 200*time.Millisecond || elapsed >= time.Second {
+			t.Errorf("Expected the provider's timeout to apply, got %v after %v", err, elapsed)
+		}
+	})
+
+	t.Run("DeadlineAfterResponse", func(t *testing.T) {
+		registry, _ := newRegistry(t, enabled, 50*time.Millisecond, 10*time.Second)
+		if resp, err, _ := route(ctx, registry, map[string]string{"X-Request-Timeout": "5s"}); err != nil || resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected the request answered within the client's deadline, got %v", err)
+		}
+	})
+
+	t.Run("IgnoredWhenDisabledOrInvalid", func(t *testing.T) {
+		disabled, _ := newRegistry(t, providers.ClientDeadlineConfig{}, 200*time.Millisecond, 10*time.Second)
+		if _, err, _ := route(ctx, disabled, map[string]string{"X-Request-Timeout": "50ms"}); err != nil {
+			t.Errorf("Expected the client timeout ignored when disabled, got %v", err)
+		}
+		registry, _ := newRegistry(t, enabled, 200*time.Millisecond, 10*time.Second)
+		for _, invalid := range []string{"soon", "-1s", "0"} {
+			if _, err, _ := route(ctx, registry, map[string]string{"X-Request-Timeout": invalid}); err != nil {
+				t.Errorf("Expected the invalid timeout %q ignored, got %v", invalid, err)
+			}
+		}
+	})
+
+	t.Run("ContextDeadlineCancelsCall", func(t *testing.T) {
+		registry, cancelled := newRegistry(t, enabled, 5*time.Second, 10*time.Second)
+		deadlineCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		_, err, elapsed := route(deadlineCtx, registry, nil)
+		if !gatewayerrors.IsTimeout(err) || elapsed >= time.Second {
+			t.Fatalf("Expected the caller's deadline to end the request, got %v after %v", err, elapsed)
+		}
+		select {
+		case <-cancelled:
+		case <-time.After(2 * time.Second):
+			t.Error("Expected the upstream call cancelled")
+		}
+	})
+
+	t.Run("EnvelopeReportsGatewayTimeout", func(t *testing.T) {
+		registry, _ := newRegistry(t, enabled, 5*time.Second, 10*time.Second)
+		registry.SetErrorEnvelope(true)
+		_, err, _ := route(ctx, registry, map[string]string{"X-Request-Timeout": "100ms"})
+		if response := gatewayerrors.ResponseFor(err); response.Status != http.StatusGatewayTimeout {
+			t.Errorf("Expected a 504 for the client's deadline, got %+v", response)
+		}
+	})
+
+	t.Run("InvalidConfig", func(t *testing.T) {
+		if err := providers.NewRegistry(sugar).SetClientDeadline(providers.ClientDeadlineConfig{Enabled: true, MaxTimeout: -time.Second}); err == nil {
+			t.Error("Expected a negative max_timeout to be rejected")
+		}
+	})
+}
@@ -0,0 +1,705 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/ratelimiter"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// rateLimitRequest sends a single request for a tenant through the limiter
+func rateLimitRequest(t *testing.T, rl *ratelimiter.RateLimiter, tenantID string) *interfaces.ProcessRequestResult {
+	t.Helper()
+
+	result, err := rl.ProcessRequest(context.Background(), &interfaces.ProcessRequestContext{
+		RequestID: "rl-" + tenantID,
+		TenantID:  tenantID,
+		Provider:  "openai",
+	})
+	if err != nil {
+		t.Fatalf("Rate limiter failed: %v", err)
+	}
+	return result
+}
+
+func TestRateLimiterConfigReload(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	rl := ratelimiter.NewRateLimiter(sugar)
+	baseConfig := map[string]interface{}{"burst_size": 10, "refill_rate": 1}
+	if err := rl.Initialize(ctx, &interfaces.ModuleConfig{Name: "rate-limiter", Enabled: true, Config: baseConfig}); err != nil {
+		t.Fatalf("Failed to initialize rate limiter: %v", err)
+	}
+	rl.Start(ctx)
+
+	// Consume three tokens so the bucket has 7 left
+	for i := 0; i < 3; i++ {
+		rateLimitRequest(t, rl, "tenant-a")
+	}
+
+	t.Run("UnchangedLimitsPreserveTokens", func(t *testing.T) {
+		if err := rl.UpdateConfig(ctx, &interfaces.ModuleConfig{Name: "rate-limiter", Enabled: true, Config: baseConfig}); err != nil {
+			t.Fatalf("Failed to reload config: %v", err)
+		}
+
+		result := rateLimitRequest(t, rl, "tenant-a")
+		if remaining := result.Annotations["tokens_remaining"]; remaining != int64(6) {
+			t.Errorf("Expected bucket to keep its state (6 remaining), got %v", remaining)
+		}
+	})
+
+	t.Run("ChangedLimitsRescaleBucket", func(t *testing.T) {
+		// 6 of 10 tokens remain; doubling the burst should leave 12 of 20
+		if err := rl.UpdateConfig(ctx, &interfaces.ModuleConfig{
+			Name: "rate-limiter", Enabled: true,
+			Config: map[string]interface{}{"burst_size": 20, "refill_rate": 1},
+		}); err != nil {
+			t.Fatalf("Failed to reload config: %v", err)
+		}
+
+		result := rateLimitRequest(t, rl, "tenant-a")
+		if remaining := result.Annotations["tokens_remaining"]; remaining != int64(11) {
+			t.Errorf("Expected rescaled bucket to have 11 remaining, got %v", remaining)
+		}
+	})
+}
+
+func TestRateLimiterSoftLimit(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	rl := ratelimiter.NewRateLimiter(sugar)
+	err := rl.Initialize(ctx, &interfaces.ModuleConfig{
+		Name:    "rate-limiter",
+		Enabled: true,
+		Config:  map[string]interface{}{"burst_size": 10, "refill_rate": 0, "soft_limit_ratio": 0.8},
+	})
+	if err != nil {
+		t.Fatalf("Failed to initialize rate limiter: %v", err)
+	}
+	rl.Start(ctx)
+
+	t.Run("BelowSoftLimitNoWarning", func(t *testing.T) {
+		for i := 1; i < 8; i++ {
+			result := rateLimitRequest(t, rl, "tenant-a")
+			if result.Action != interfaces.ActionContinue || result.Annotations["rate_limit_warning"] != nil {
+				t.Fatalf("Request %d: expected continue without warning, got %s %v", i, result.Action, result.Annotations)
+			}
+		}
+	})
+
+	t.Run("BetweenSoftAndHardLimitWarns", func(t *testing.T) {
+		for i := 8; i <= 10; i++ {
+			result := rateLimitRequest(t, rl, "tenant-a")
+			if result.Action != interfaces.ActionContinue {
+				t.Fatalf("Request %d: expected continue below the hard limit, got %s", i, result.Action)
+			}
+			if result.Annotations["rate_limit_warning"] != true {
+				t.Errorf("Request %d: expected rate_limit_warning annotation, got %v", i, result.Annotations)
+			}
+			expected := fmt.Sprintf("remaining=%d, limit=10", 10-i)
+			if header := result.AdditionalHeaders["X-Leash-RateLimit-Warning"]; header != expected {
+				t.Errorf("Request %d: expected warning header %q, got %q", i, expected, header)
+			}
+		}
+	})
+
+	t.Run("OverHardLimitBlocked", func(t *testing.T) {
+		result := rateLimitRequest(t, rl, "tenant-a")
+		if result.Action != interfaces.ActionBlock {
+			t.Errorf("Expected request over the hard limit to be blocked, got %s", result.Action)
+		}
+	})
+
+	t.Run("NoWarningUnlessConfigured", func(t *testing.T) {
+		unconfigured := ratelimiter.NewRateLimiter(sugar)
+		if err := unconfigured.Initialize(ctx, &interfaces.ModuleConfig{
+			Name:    "rate-limiter",
+			Enabled: true,
+			Config:  map[string]interface{}{"burst_size": 10, "refill_rate": 0},
+		}); err != nil {
+			t.Fatalf("Failed to initialize rate limiter: %v", err)
+		}
+		unconfigured.Start(ctx)
+		for i := 1; i <= 10; i++ {
+			result := rateLimitRequest(t, unconfigured, "tenant-a")
+			if result.Annotations["rate_limit_warning"] != nil || len(result.AdditionalHeaders) != 0 {
+				t.Fatalf("Request %d: expected no warning without soft_limit_ratio, got %v %v", i, result.Annotations, result.AdditionalHeaders)
+			}
+		}
+	})
+
+	t.Run("InvalidRatioRejected", func(t *testing.T) {
+		err := rl.ValidateConfig(&interfaces.ModuleConfig{Enabled: true, Config: map[string]interface{}{"soft_limit_ratio": 1.5}})
+		if err == nil {
+			t.Error("Expected soft_limit_ratio above 1 to be rejected")
+		}
+	})
+
+	t.Run("ReloadDuringRequests", func(t *testing.T) {
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				rl.UpdateConfig(ctx, &interfaces.ModuleConfig{
+					Name:    "rate-limiter",
+					Enabled: true,
+					Config:  map[string]interface{}{"burst_size": 10, "refill_rate": 0, "soft_limit_ratio": 0.5, "warning_header": fmt.Sprintf("X-Warning-%d", i)},
+				})
+			}
+		}()
+		for i := 0; i < 20; i++ {
+			rateLimitRequest(t, rl, fmt.Sprintf("tenant-%d", i))
+		}
+		wg.Wait()
+	})
+}
+
+func TestRateLimiterTenantRules(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	config := map[string]interface{}{
+		"burst_size":  10,
+		"refill_rate": 0,
+		"tenants": map[string]interface{}{
+			"tenant-a": map[string]interface{}{
+				"rate_limits": []interface{}{
+					map[string]interface{}{
+						"name":   "gpt4",
+						"limit":  2,
+						"window": "1h",
+						"conditions": []interface{}{
+							map[string]interface{}{"field": "model", "operator": "in", "value": []interface{}{"gpt-4", "gpt-4o"}},
+						},
+					},
+				},
+			},
+		},
+	}
+	rl := ratelimiter.NewRateLimiter(sugar)
+	if err := rl.ValidateConfig(&interfaces.ModuleConfig{Enabled: true, Config: config}); err != nil {
+		t.Fatalf("Expected valid rule config, got %v", err)
+	}
+	if err := rl.Initialize(ctx, &interfaces.ModuleConfig{Name: "rate-limiter", Enabled: true, Config: config}); err != nil {
+		t.Fatalf("Failed to initialize rate limiter: %v", err)
+	}
+	rl.Start(ctx)
+
+	send := func(tenantID, model string) *interfaces.ProcessRequestResult {
+		result, err := rl.ProcessRequest(ctx, &interfaces.ProcessRequestContext{
+			RequestID: "rule-" + tenantID,
+			TenantID:  tenantID,
+			Provider:  "openai",
+			Model:     model,
+		})
+		if err != nil {
+			t.Fatalf("Rate limiter failed: %v", err)
+		}
+		return result
+	}
+
+	t.Run("MatchingRequestsUseRule", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			result := send("tenant-a", "gpt-4")
+			if result.Action != interfaces.ActionContinue || result.Annotations["rate_limit_rule"] != "gpt4" {
+				t.Fatalf("Request %d: expected continue under rule gpt4, got %s %v", i+1, result.Action, result.Annotations)
+			}
+		}
+		result := send("tenant-a", "gpt-4o")
+		if result.Action != interfaces.ActionBlock || result.Annotations["limit"] != int64(2) {
+			t.Errorf("Expected third matching request to exceed the rule, got %s %v", result.Action, result.Annotations)
+		}
+	})
+
+	t.Run("OtherRequestsUseDefault", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			result := send("tenant-a", "gpt-4o-mini")
+			if result.Action != interfaces.ActionContinue || result.Annotations["rate_limit_rule"] != nil {
+				t.Fatalf("Request %d: expected default limit to apply, got %s %v", i+1, result.Action, result.Annotations)
+			}
+		}
+		if result := send("tenant-a", "gpt-4o-mini"); result.Action != interfaces.ActionBlock {
+			t.Errorf("Expected default limit to be exhausted, got %s", result.Action)
+		}
+	})
+
+	t.Run("OtherTenantsUseDefault", func(t *testing.T) {
+		result := send("tenant-b", "gpt-4")
+		if result.Action != interfaces.ActionContinue || result.Annotations["rate_limit_rule"] != nil {
+			t.Errorf("Expected rules to be tenant-scoped, got %s %v", result.Action, result.Annotations)
+		}
+	})
+
+	t.Run("InvalidRulesRejected", func(t *testing.T) {
+		for name, rule := range map[string]map[string]interface{}{
+			"MissingName":     {"limit": 1, "window": "1m"},
+			"ZeroLimit":       {"name": "r", "limit": 0, "window": "1m"},
+			"BadWindow":       {"name": "r", "limit": 1, "window": "soon"},
+			"UnknownOperator": {"name": "r", "limit": 1, "window": "1m", "conditions": []interface{}{map[string]interface{}{"field": "model", "operator": "like"}}},
+		} {
+			err := rl.ValidateConfig(&interfaces.ModuleConfig{Enabled: true, Config: map[string]interface{}{
+				"tenants": map[string]interface{}{"tenant-a": map[string]interface{}{"rate_limits": []interface{}{rule}}},
+			}})
+			if err == nil {
+				t.Errorf("%s: expected rule to be rejected", name)
+			}
+		}
+	})
+}
+
+// usageStore records the usage batches a rate limiter writes
+type usageStore struct {
+	mu      sync.Mutex
+	counts  map[string]int64
+	writes  int
+	blocked chan struct{} // when set, writes wait on it or the context
+}
+
+func (s *usageStore) IncrBy(ctx context.Context, counts map[string]int64) error {
+	if s.blocked != nil {
+		select {
+		case <-s.blocked:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.counts == nil {
+		s.counts = make(map[string]int64)
+	}
+	for key, count := range counts {
+		s.counts[key] += count
+	}
+	s.writes++
+	return nil
+}
+
+func (s *usageStore) count(key string) (int64, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts[key], s.writes
+}
+
+func TestRateLimiterUsageDrain(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	newLimiter := func(t *testing.T, store *usageStore, config map[string]interface{}) *ratelimiter.RateLimiter {
+		t.Helper()
+		rl := ratelimiter.NewRateLimiter(sugar)
+		rl.SetUsageStore(store)
+		moduleConfig := &interfaces.ModuleConfig{Name: "rate-limiter", Enabled: true, Config: config}
+		if err := rl.ValidateConfig(moduleConfig); err != nil {
+			t.Fatalf("Invalid config: %v", err)
+		}
+		if err := rl.Initialize(ctx, moduleConfig); err != nil {
+			t.Fatalf("Failed to initialize rate limiter: %v", err)
+		}
+		rl.Start(ctx)
+		return rl
+	}
+
+	t.Run("PendingWritesFlushedOnShutdown", func(t *testing.T) {
+		store := &usageStore{}
+		rl := newLimiter(t, store, map[string]interface{}{"burst_size": 10, "refill_rate": 1, "flush_interval": "1h"})
+
+		for i := 0; i < 5; i++ {
+			rateLimitRequest(t, rl, "tenant-a")
+		}
+		if count, _ := store.count("tenant-a:openai"); count != 0 {
+			t.Fatalf("Expected usage batched until the next flush, got %d written", count)
+		}
+
+		rl.Stop(ctx)
+		if err := rl.Shutdown(ctx); err != nil {
+			t.Fatalf("Shutdown failed: %v", err)
+		}
+		if count, writes := store.count("tenant-a:openai"); count != 5 || writes != 1 {
+			t.Errorf("Expected the 5 admitted requests written in one batch on shutdown, got %d in %d writes", count, writes)
+		}
+		if pending := rl.Metrics()["pending_writes"]; pending != int64(0) {
+			t.Errorf("Expected no pending writes after shutdown, got %v", pending)
+		}
+	})
+
+	t.Run("LimitsEnforcedWhileDraining", func(t *testing.T) {
+		store := &usageStore{blocked: make(chan struct{})}
+		rl := newLimiter(t, store, map[string]interface{}{"burst_size": 3, "refill_rate": 1, "flush_interval": "1h"})
+
+		rateLimitRequest(t, rl, "tenant-a")
+		rl.Stop(ctx)
+
+		// Shutdown is stuck writing the first batch while requests still arrive
+		shutdown := make(chan error, 1)
+		go func() { shutdown <- rl.Shutdown(ctx) }()
+
+		for i := 0; i < 2; i++ {
+			if result := rateLimitRequest(t, rl, "tenant-a"); result.Action != interfaces.ActionContinue {
+				t.Fatalf("Expected request %d within the limit to pass while draining, got %s", i+2, result.Action)
+			}
+		}
+		if result := rateLimitRequest(t, rl, "tenant-a"); result.Action != interfaces.ActionBlock {
+			t.Errorf("Expected the over-limit request rejected while draining, got %s", result.Action)
+		}
+
+		close(store.blocked)
+		if err := <-shutdown; err != nil {
+			t.Fatalf("Shutdown failed: %v", err)
+		}
+		if count, _ := store.count("tenant-a:openai"); count < 1 || count > 3 {
+			t.Errorf("Expected only admitted requests written, got %d", count)
+		}
+	})
+
+	t.Run("ShutdownBoundedByDrainTimeout", func(t *testing.T) {
+		store := &usageStore{blocked: make(chan struct{})}
+		defer close(store.blocked)
+		rl := newLimiter(t, store, map[string]interface{}{"flush_interval": "1h", "drain_timeout": "50ms"})
+
+		rateLimitRequest(t, rl, "tenant-a")
+		start := time.Now()
+		err := rl.Shutdown(ctx)
+		if err == nil || !strings.Contains(err.Error(), "lost 1 uncounted requests") {
+			t.Errorf("Expected shutdown to report the unwritten request, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Expected shutdown to give up at the drain timeout, took %v", elapsed)
+		}
+	})
+
+	t.Run("PeriodicFlush", func(t *testing.T) {
+		store := &usageStore{}
+		rl := newLimiter(t, store, map[string]interface{}{"flush_interval": "10ms"})
+		defer rl.Shutdown(ctx)
+
+		rateLimitRequest(t, rl, "tenant-a")
+		rateLimitRequest(t, rl, "tenant-b")
+		deadline := time.Now().Add(time.Second)
+		for time.Now().Before(deadline) {
+			a, _ := store.count("tenant-a:openai")
+			b, _ := store.count("tenant-b:openai")
+			if a == 1 && b == 1 {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Error("Expected usage written by the periodic flush")
+	})
+
+	t.Run("InvalidIntervalsRejected", func(t *testing.T) {
+		rl := ratelimiter.NewRateLimiter(sugar)
+		for _, config := range []map[string]interface{}{
+			{"flush_interval": "often"},
+			{"drain_timeout": "-1s"},
+			{"storage": "memcached"},
+		} {
+			if err := rl.ValidateConfig(&interfaces.ModuleConfig{Name: "rate-limiter", Enabled: true, Config: config}); err == nil {
+				t.Errorf("Expected %v to be rejected", config)
+			}
+		}
+	})
+
+	t.Run("RedisStore", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		defer client.Close()
+
+		rl := ratelimiter.NewRateLimiter(sugar)
+		rl.SetUsageStore(ratelimiter.NewRedisUsageStore(client, "leash:ratelimit:", time.Hour))
+		moduleConfig := &interfaces.ModuleConfig{Name: "rate-limiter", Enabled: true, Config: map[string]interface{}{"storage": "redis", "flush_interval": "1h"}}
+		if err := rl.Initialize(ctx, moduleConfig); err != nil {
+			t.Fatalf("Failed to initialize rate limiter: %v", err)
+		}
+		rl.Start(ctx)
+		for i := 0; i < 3; i++ {
+			rateLimitRequest(t, rl, "tenant-a")
+		}
+		rl.Stop(ctx)
+		if err := rl.Shutdown(ctx); err != nil {
+			t.Fatalf("Shutdown failed: %v", err)
+		}
+
+		if count, err := client.Get(ctx, "leash:ratelimit:tenant-a:openai").Int64(); err != nil || count != 3 {
+			t.Errorf("Expected 3 admitted requests counted in Redis, got %d (%v)", count, err)
+		}
+		if ttl := server.TTL("leash:ratelimit:tenant-a:openai"); ttl != time.Hour {
+			t.Errorf("Expected the count to expire after the window, got %v", ttl)
+		}
+	})
+}
+
+func TestRateLimiterConcurrentTokens(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	t.Run("TokensRemainingUnderConcurrency", func(t *testing.T) {
+		rl := ratelimiter.NewRateLimiter(sugar)
+		if err := rl.Initialize(ctx, &interfaces.ModuleConfig{
+			Name: "rate-limiter", Enabled: true,
+			Config: map[string]interface{}{"burst_size": 60, "refill_rate": 1},
+		}); err != nil {
+			t.Fatalf("Failed to initialize rate limiter: %v", err)
+		}
+		rl.Start(ctx)
+
+		const requests = 100
+		remaining := make(chan int64, requests)
+		var wg sync.WaitGroup
+		for i := 0; i < requests; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				result, err := rl.ProcessRequest(ctx, &interfaces.ProcessRequestContext{
+					RequestID: "rl-concurrent",
+					TenantID:  "tenant-a",
+					Provider:  "openai",
+				})
+				if err != nil {
+					t.Errorf("Rate limiter failed: %v", err)
+					return
+				}
+				if tokens, ok := result.Annotations["tokens_remaining"].(int64); ok {
+					remaining <- tokens
+				}
+			}()
+			// Read the limiter's state while requests consume tokens
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				rl.Metrics()
+				rl.Status()
+				rl.Health(context.Background())
+				if _, err := rl.ExportState(); err != nil {
+					t.Errorf("Failed to export state: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+		close(remaining)
+
+		// Each admitted request reports the count its own token left behind
+		seen := make(map[int64]bool)
+		for tokens := range remaining {
+			if tokens < 0 || tokens >= 60 || seen[tokens] {
+				t.Errorf("Expected a distinct tokens_remaining below the burst size, got %d", tokens)
+			}
+			seen[tokens] = true
+		}
+		if len(seen) != 60 {
+			t.Errorf("Expected the 60 token burst admitted, got %d", len(seen))
+		}
+		if processed := rl.Metrics()["requests_processed"]; processed != int64(requests) {
+			t.Errorf("Expected %d requests counted, got %v", requests, processed)
+		}
+	})
+
+	t.Run("TokensAccessor", func(t *testing.T) {
+		bucket := ratelimiter.NewTokenBucket(50, 1)
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				if !bucket.Allow() {
+					t.Error("Expected a token available")
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				if tokens := bucket.Tokens(); tokens < 0 || tokens > 50 {
+					t.Errorf("Expected tokens within the capacity, got %d", tokens)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if tokens := bucket.Tokens(); tokens != 0 {
+			t.Errorf("Expected the bucket drained, got %d tokens", tokens)
+		}
+		if bucket.Allow() {
+			t.Error("Expected a drained bucket to reject")
+		}
+	})
+}
+
+func TestRateLimiterFixedWindow(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	start := time.Date(2026, time.October, 16, 12, 0, 0, 0, time.UTC)
+	now := start
+
+	config := map[string]interface{}{
+		"algorithm":      "fixed_window",
+		"default_limit":  5,
+		"default_window": "1m",
+		"burst_size":     100,
+		"tenants": map[string]interface{}{
+			"tenant-b": map[string]interface{}{
+				"rate_limits": []interface{}{
+					map[string]interface{}{"name": "all", "limit": 2, "window": "10s"},
+				},
+			},
+		},
+	}
+	rl := ratelimiter.NewRateLimiter(sugar)
+	rl.SetClock(func() time.Time { return now })
+	if err := rl.ValidateConfig(&interfaces.ModuleConfig{Enabled: true, Config: config}); err != nil {
+		t.Fatalf("Expected a valid fixed window config, got %v", err)
+	}
+	if err := rl.Initialize(ctx, &interfaces.ModuleConfig{Name: "rate-limiter", Enabled: true, Config: config}); err != nil {
+		t.Fatalf("Failed to initialize rate limiter: %v", err)
+	}
+	rl.Start(ctx)
+
+	t.Run("LimitPerWindow", func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			result := rateLimitRequest(t, rl, "tenant-a")
+			if result.Action != interfaces.ActionContinue {
+				t.Fatalf("Expected request %d of 5 allowed, got %v", i+1, result.Action)
+			}
+			if remaining := result.Annotations["tokens_remaining"]; remaining != int64(4-i) {
+				t.Errorf("Expected %d requests left in the window, got %v", 4-i, remaining)
+			}
+		}
+		if result := rateLimitRequest(t, rl, "tenant-a"); result.Action != interfaces.ActionBlock {
+			t.Fatalf("Expected the request past the limit blocked, got %v", result.Action)
+		}
+
+		// Still blocked until the window rolls over, not a minute after the
+		// first request
+		now = start.Add(59 * time.Second)
+		if result := rateLimitRequest(t, rl, "tenant-a"); result.Action != interfaces.ActionBlock {
+			t.Errorf("Expected requests blocked for the rest of the window, got %v", result.Action)
+		}
+		now = start.Add(time.Minute)
+		result := rateLimitRequest(t, rl, "tenant-a")
+		if result.Action != interfaces.ActionContinue || result.Annotations["tokens_remaining"] != int64(4) {
+			t.Errorf("Expected a fresh window after the rollover, got %v with %v left", result.Action, result.Annotations["tokens_remaining"])
+		}
+	})
+
+	t.Run("WindowsPerBucketKey", func(t *testing.T) {
+		now = start.Add(2 * time.Minute)
+		for i := 0; i < 5; i++ {
+			rateLimitRequest(t, rl, "tenant-a")
+		}
+		if result := rateLimitRequest(t, rl, "tenant-c"); result.Action != interfaces.ActionContinue {
+			t.Errorf("Expected another tenant's window unaffected, got %v", result.Action)
+		}
+	})
+
+	t.Run("TenantRuleWindow", func(t *testing.T) {
+		now = start.Add(3 * time.Minute)
+		for i := 0; i < 2; i++ {
+			if result := rateLimitRequest(t, rl, "tenant-b"); result.Action != interfaces.ActionContinue {
+				t.Fatalf("Expected request %d of the rule's 2 allowed, got %v", i+1, result.Action)
+			}
+		}
+		result := rateLimitRequest(t, rl, "tenant-b")
+		if result.Action != interfaces.ActionBlock || result.Annotations["rate_limit_rule"] != "all" {
+			t.Fatalf("Expected the rule's limit enforced, got %v: %v", result.Action, result.Annotations)
+		}
+		now = now.Add(10 * time.Second)
+		if result := rateLimitRequest(t, rl, "tenant-b"); result.Action != interfaces.ActionContinue {
+			t.Errorf("Expected the rule's window to roll over after 10s, got %v", result.Action)
+		}
+	})
+
+	t.Run("InvalidWindowRejected", func(t *testing.T) {
+		if err := rl.ValidateConfig(&interfaces.ModuleConfig{Enabled: true, Config: map[string]interface{}{
+			"algorithm": "fixed_window", "default_window": "0s",
+		}}); err == nil {
+			t.Error("Expected a zero window to be rejected")
+		}
+	})
+
+	t.Run("StateRoundTrip", func(t *testing.T) {
+		now = start.Add(4 * time.Minute)
+		for i := 0; i < 3; i++ {
+			rateLimitRequest(t, rl, "tenant-d")
+		}
+		state, err := rl.ExportState()
+		if err != nil {
+			t.Fatalf("Failed to export state: %v", err)
+		}
+
+		target := ratelimiter.NewRateLimiter(sugar)
+		target.SetClock(func() time.Time { return now })
+		if err := target.Initialize(ctx, &interfaces.ModuleConfig{Name: "rate-limiter", Enabled: true, Config: config}); err != nil {
+			t.Fatalf("Failed to initialize rate limiter: %v", err)
+		}
+		target.Start(ctx)
+		if err := target.ImportState(state); err != nil {
+			t.Fatalf("Failed to import state: %v", err)
+		}
+		if reexported, _ := target.ExportState(); !bytes.Equal(state, reexported) {
+			t.Errorf("Expected identical state after round trip:\n%s\n%s", state, reexported)
+		}
+
+		// The window's three requests carried over, so two are left
+		result := rateLimitRequest(t, target, "tenant-d")
+		if result.Action != interfaces.ActionContinue || result.Annotations["tokens_remaining"] != int64(1) {
+			t.Errorf("Expected the imported window to leave one request, got %v with %v left", result.Action, result.Annotations["tokens_remaining"])
+		}
+		if err := target.ImportState(json.RawMessage(`{"version": 1, "buckets": {}, "windows": {"tenant-d:openai": {"limit": 5, "window": 0}}}`)); err == nil {
+			t.Error("Expected a window without a length to be rejected")
+		}
+	})
+	t.Run("ReloadResizesWindows", func(t *testing.T) {
+		now = start.Add(5 * time.Minute)
+		for i := 0; i < 3; i++ {
+			rateLimitRequest(t, rl, "tenant-e")
+		}
+
+		reloaded := make(map[string]interface{}, len(config))
+		for key, value := range config {
+			reloaded[key] = value
+		}
+		reloaded["default_limit"] = 10
+		if err := rl.UpdateConfig(ctx, &interfaces.ModuleConfig{Name: "rate-limiter", Enabled: true, Config: reloaded}); err != nil {
+			t.Fatalf("Failed to reload: %v", err)
+		}
+
+		exported, err := rl.ExportState()
+		if err != nil {
+			t.Fatalf("Failed to export state: %v", err)
+		}
+		var state ratelimiter.State
+		if err := json.Unmarshal(exported, &state); err != nil {
+			t.Fatalf("Failed to decode state: %v", err)
+		}
+		if window := state.Windows["tenant-e:openai"]; window.Limit != 10 || window.Count != 3 {
+			t.Errorf("Expected the window resized to 10 at reload keeping its 3 requests, got %+v", window)
+		}
+		if window := state.Windows["tenant-b:openai:all"]; window.Limit != 2 || window.Rule != "all" {
+			t.Errorf("Expected the rule window to keep its rule's limit, got %+v", window)
+		}
+		if config := rl.GetConfig().Config; config["default_limit"] != int64(10) {
+			t.Errorf("Expected the reloaded limit in the config, got %v", config["default_limit"])
+		}
+	})
+}
@@ -0,0 +1,307 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"github.com/bendiamant/leash-gateway/internal/modules/registry"
+	"go.uber.org/zap"
+)
+
+func TestDuplicateModuleRegistration(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+
+	// register registers two modules under the same name with the given policy
+	register := func(t *testing.T, policy string) (*registry.ModuleRegistry, *lifecycleModule, *lifecycleModule, *shutdownLog, error) {
+		t.Helper()
+		modules := registry.NewModuleRegistry(sugar)
+		if err := modules.SetDuplicatePolicy(policy); err != nil {
+			t.Fatalf("Failed to set duplicate policy: %v", err)
+		}
+
+		log := &shutdownLog{}
+		first := &lifecycleModule{stubModule: newStubModule("inspector", interfaces.ModuleTypeInspector), log: log}
+		second := &lifecycleModule{stubModule: newStubModule("inspector", interfaces.ModuleTypeInspector), log: log}
+		if err := modules.Register(first); err != nil {
+			t.Fatalf("Failed to register the first module: %v", err)
+		}
+		return modules, first, second, log, modules.Register(second)
+	}
+
+	registered := func(t *testing.T, modules *registry.ModuleRegistry) interfaces.Module {
+		t.Helper()
+		module, err := modules.Get("inspector")
+		if err != nil {
+			t.Fatalf("Expected a module to stay registered: %v", err)
+		}
+		return module
+	}
+
+	t.Run("Error", func(t *testing.T) {
+		modules, first, _, log, err := register(t, registry.DuplicatePolicyError)
+		if !errors.Is(err, registry.ErrDuplicateModule) {
+			t.Errorf("Expected ErrDuplicateModule, got %v", err)
+		}
+		if registered(t, modules) != first {
+			t.Error("Expected the first module to stay registered")
+		}
+		if log.index("stop:inspector") >= 0 {
+			t.Error("Expected the registered module not to be stopped")
+		}
+	})
+
+	t.Run("Replace", func(t *testing.T) {
+		modules, _, second, log, err := register(t, registry.DuplicatePolicyReplace)
+		if err != nil {
+			t.Fatalf("Expected the duplicate to replace the registered module, got %v", err)
+		}
+		if registered(t, modules) != second {
+			t.Error("Expected the second module to be registered")
+		}
+		stop, shutdown := log.index("stop:inspector"), log.index("shutdown:inspector")
+		if stop < 0 || shutdown < stop {
+			t.Errorf("Expected the replaced module to be stopped then shut down, got %v", log.events)
+		}
+		if len(modules.List()) != 1 {
+			t.Errorf("Expected one registered module, got %d", len(modules.List()))
+		}
+	})
+
+	t.Run("ReplaceSwapsPipelineBeforeStopping", func(t *testing.T) {
+		modules := registry.NewModuleRegistry(sugar)
+		modules.SetDuplicatePolicy(registry.DuplicatePolicyReplace)
+		modulePipeline := pipeline.NewPipeline(sugar)
+		log := &shutdownLog{}
+		modules.SetReplaceHook(func(old, replacement interfaces.Module) error {
+			// The registry lock is released before the hook runs
+			if current, err := modules.Get(old.Name()); err != nil || current != replacement {
+				t.Errorf("Expected the replacement registered when the hook runs, got %v", current)
+			}
+			log.add("swap:" + old.Name())
+			return modulePipeline.ReplaceModule(replacement)
+		})
+
+		first := &lifecycleModule{stubModule: newStubModule("inspector", interfaces.ModuleTypeInspector), log: log}
+		second := &lifecycleModule{stubModule: newStubModule("inspector", interfaces.ModuleTypeInspector), log: log}
+		if err := modules.Register(first); err != nil {
+			t.Fatalf("Failed to register the first module: %v", err)
+		}
+		modulePipeline.AddModule(first)
+		if err := modules.Register(second); err != nil {
+			t.Fatalf("Expected the duplicate to replace the registered module, got %v", err)
+		}
+
+		swap, stop := log.index("swap:inspector"), log.index("stop:inspector")
+		if swap < 0 || stop < swap {
+			t.Errorf("Expected the pipeline swapped before the replaced module stopped, got %v", log.events)
+		}
+		if inspectors := modulePipeline.GetPipelineStatus()["inspectors"]; inspectors != 1 {
+			t.Errorf("Expected the replacement to take the replaced module's place, got %v inspectors", inspectors)
+		}
+	})
+
+	t.Run("FailedReplaceHookKeepsModule", func(t *testing.T) {
+		modules := registry.NewModuleRegistry(sugar)
+		modules.SetDuplicatePolicy(registry.DuplicatePolicyReplace)
+		modules.SetReplaceHook(func(old, replacement interfaces.Module) error {
+			return errors.New("pipeline unavailable")
+		})
+		log := &shutdownLog{}
+		first := &lifecycleModule{stubModule: newStubModule("inspector", interfaces.ModuleTypeInspector), log: log}
+		second := &lifecycleModule{stubModule: newStubModule("inspector", interfaces.ModuleTypeInspector), log: log}
+		if err := modules.Register(first); err != nil {
+			t.Fatalf("Failed to register the first module: %v", err)
+		}
+		if err := modules.Register(second); err == nil {
+			t.Error("Expected the replacement to fail with the hook")
+		}
+		if registered(t, modules) != first || log.index("stop:inspector") >= 0 {
+			t.Error("Expected the registered module to keep running after a failed replacement")
+		}
+	})
+
+	t.Run("Skip", func(t *testing.T) {
+		modules, first, _, log, err := register(t, registry.DuplicatePolicySkip)
+		if !errors.Is(err, registry.ErrDuplicateSkipped) {
+			t.Fatalf("Expected ErrDuplicateSkipped, got %v", err)
+		}
+		if registered(t, modules) != first {
+			t.Error("Expected the first module to stay registered")
+		}
+		if log.index("stop:inspector") >= 0 {
+			t.Error("Expected the registered module not to be stopped")
+		}
+	})
+
+	t.Run("InvalidReplacementKeepsModule", func(t *testing.T) {
+		modules := registry.NewModuleRegistry(sugar)
+		modules.SetDuplicatePolicy(registry.DuplicatePolicyReplace)
+		log := &shutdownLog{}
+		first := &lifecycleModule{stubModule: newStubModule("inspector", interfaces.ModuleTypeInspector), log: log}
+		if err := modules.Register(first); err != nil {
+			t.Fatalf("Failed to register the first module: %v", err)
+		}
+		invalid := &lifecycleModule{stubModule: newStubModule("inspector", interfaces.ModuleType(99)), log: log}
+		if err := modules.Register(invalid); err == nil {
+			t.Error("Expected an invalid replacement to be rejected")
+		}
+		if registered(t, modules) != first || log.index("stop:inspector") >= 0 {
+			t.Error("Expected the registered module to keep running after a rejected replacement")
+		}
+	})
+
+	t.Run("UnknownPolicyRejected", func(t *testing.T) {
+		if err := registry.NewModuleRegistry(sugar).SetDuplicatePolicy("merge"); err == nil {
+			t.Error("Expected an unknown duplicate policy to be rejected")
+		}
+	})
+}
+
+// configuredModule is a stub reporting a fixed config and health check error
+type configuredModule struct {
+	*stubModule
+	config    map[string]interface{}
+	healthErr error
+}
+
+func (m *configuredModule) GetConfig() *interfaces.ModuleConfig {
+	config := m.stubModule.GetConfig()
+	config.Config = m.config
+	return config
+}
+
+func (m *configuredModule) Health(ctx context.Context) (*interfaces.HealthStatus, error) {
+	if m.healthErr != nil {
+		return nil, m.healthErr
+	}
+	return m.stubModule.Health(ctx)
+}
+
+func TestModulesListing(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	modules := registry.NewModuleRegistry(logger.Sugar())
+
+	webhook := &configuredModule{
+		stubModule: newStubModule("decision-webhook", interfaces.ModuleTypeSink),
+		config: map[string]interface{}{
+			"url":         "https://hooks.example.com/decisions",
+			"secret":      "whsec-1234",
+			"api_key_env": "WEBHOOK_API_KEY",
+			"batch_size":  50,
+			"auth": map[string]interface{}{
+				"bearer_token": "tok-5678",
+				"client_key":   "",
+			},
+			"upstreams": []interface{}{map[string]interface{}{"name": "primary", "password": "hunter2"}},
+		},
+	}
+	moderation := &configuredModule{
+		stubModule: newStubModule("moderation", interfaces.ModuleTypeInspector),
+		healthErr:  errors.New("moderation API unreachable"),
+	}
+	for _, module := range []interfaces.Module{webhook, moderation} {
+		if err := modules.Register(module); err != nil {
+			t.Fatalf("Failed to register %s: %v", module.Name(), err)
+		}
+	}
+
+	list := func(t *testing.T, rawQuery string) []map[string]interface{} {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		modules.ModulesHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/modules?"+rawQuery, nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("Listing %q failed with %d: %s", rawQuery, recorder.Code, recorder.Body)
+		}
+		var body struct {
+			Modules []map[string]interface{} `json:"modules"`
+			Count   int                      `json:"count"`
+		}
+		if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode modules: %v", err)
+		}
+		if body.Count != 2 || len(body.Modules) != 2 {
+			t.Fatalf("Expected both modules listed, got %+v", body)
+		}
+		return body.Modules
+	}
+
+	t.Run("LeanByDefault", func(t *testing.T) {
+		for _, module := range list(t, "") {
+			if module["name"] == nil || module["status"] == nil || module["metrics"] == nil {
+				t.Errorf("Expected the module summary, got %v", module)
+			}
+			if _, ok := module["health"]; ok {
+				t.Errorf("Expected no health without include, got %v", module)
+			}
+			if _, ok := module["config"]; ok {
+				t.Errorf("Expected no config without include, got %v", module)
+			}
+		}
+	})
+
+	t.Run("HealthAndMaskedConfig", func(t *testing.T) {
+		listed := list(t, "include=health,config")
+		// Modules are listed by name
+		webhookInfo, moderationInfo := listed[0], listed[1]
+		if webhookInfo["name"] != "decision-webhook" || moderationInfo["name"] != "moderation" {
+			t.Fatalf("Expected modules sorted by name, got %v and %v", webhookInfo["name"], moderationInfo["name"])
+		}
+
+		if health, _ := webhookInfo["health"].(map[string]interface{}); health["status"] != float64(interfaces.HealthStateHealthy) {
+			t.Errorf("Expected the webhook healthy, got %v", webhookInfo["health"])
+		}
+		health, _ := moderationInfo["health"].(map[string]interface{})
+		if health["status"] != float64(interfaces.HealthStateUnhealthy) || health["message"] != "Health check failed: moderation API unreachable" {
+			t.Errorf("Expected the failed health check reported, got %v", moderationInfo["health"])
+		}
+
+		config, _ := webhookInfo["config"].(map[string]interface{})
+		settings, _ := config["config"].(map[string]interface{})
+		if settings["secret"] != registry.RedactedValue || settings["url"] != "https://hooks.example.com/decisions" || settings["batch_size"] != float64(50) {
+			t.Errorf("Expected the secret masked and other settings kept, got %v", settings)
+		}
+		if settings["api_key_env"] != "WEBHOOK_API_KEY" {
+			t.Errorf("Expected the secret's env var name kept, got %v", settings["api_key_env"])
+		}
+		auth, _ := settings["auth"].(map[string]interface{})
+		if auth["bearer_token"] != registry.RedactedValue || auth["client_key"] != "" {
+			t.Errorf("Expected nested secrets masked and unset ones kept, got %v", auth)
+		}
+		upstreams, _ := settings["upstreams"].([]interface{})
+		if len(upstreams) != 1 || upstreams[0].(map[string]interface{})["password"] != registry.RedactedValue {
+			t.Errorf("Expected secrets in lists masked, got %v", upstreams)
+		}
+		if config["name"] != "decision-webhook" {
+			t.Errorf("Expected the module config fields, got %v", config)
+		}
+		if webhook.config["secret"] != "whsec-1234" {
+			t.Error("Expected the module's own config left untouched")
+		}
+	})
+
+	t.Run("RepeatedInclude", func(t *testing.T) {
+		for _, module := range list(t, "include=health&include=config") {
+			if module["health"] == nil || module["config"] == nil {
+				t.Errorf("Expected health and config, got %v", module)
+			}
+		}
+	})
+
+	t.Run("UnknownIncludeRejected", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		modules.ModulesHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/modules?include=secrets", nil))
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for an unknown include, got %d", recorder.Code)
+		}
+	})
+}
@@ -0,0 +1,193 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/modulehost"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"github.com/bendiamant/leash-gateway/internal/replay"
+	"github.com/bendiamant/leash-gateway/internal/tenants"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// modelGuard blocks requests for a configurable set of models
+type modelGuard struct {
+	*stubModule
+	mu      sync.Mutex
+	blocked map[string]bool
+}
+
+func (g *modelGuard) block(model string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.blocked[model] = true
+}
+
+func (g *modelGuard) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequestContext) (*interfaces.ProcessRequestResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.blocked[req.Model] {
+		return &interfaces.ProcessRequestResult{Action: interfaces.ActionBlock, BlockReason: "model not allowed: " + req.Model}, nil
+	}
+	return &interfaces.ProcessRequestResult{Action: interfaces.ActionContinue}, nil
+}
+
+func TestRequestReplay(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	guard := &modelGuard{
+		stubModule: newStubModule("model-guard", interfaces.ModuleTypePolicy),
+		blocked:    map[string]bool{"gpt-4": true},
+	}
+	p := pipeline.NewPipeline(sugar)
+	p.AddModule(guard)
+	tokenHash := sha256.Sum256([]byte("replay-secret"))
+	p.SetBypass(pipeline.BypassConfig{Principals: []pipeline.TrustedPrincipal{
+		{Name: "replayer", TokenSHA256: hex.EncodeToString(tokenHash[:]), AllowDryRun: true},
+	}})
+	trusted := map[string]string{pipeline.DefaultBypassHeader: "replay-secret"}
+
+	anonymizer, err := tenants.NewAnonymizer("replay-salt", nil)
+	if err != nil {
+		t.Fatalf("Failed to create anonymizer: %v", err)
+	}
+	captured := &syncBuffer{}
+	recorder, err := replay.NewRecorder(captured, 1, anonymizer)
+	if err != nil {
+		t.Fatalf("Failed to create recorder: %v", err)
+	}
+	service := modulehost.NewService(p, sugar)
+	service.SetRecorder(recorder)
+
+	target := httptest.NewServer(modulehost.NewHTTPHandler(service, false, 0))
+	defer target.Close()
+
+	for _, model := range []string{"gpt-4o-mini", "gpt-4", "claude-3-haiku"} {
+		req, _ := structpb.NewStruct(map[string]interface{}{
+			"tenant_id": "tenant-a",
+			"model":     model,
+			"headers":   map[string]interface{}{"Authorization": "Bearer secret-key", "User-Agent": "sdk/1.0"},
+			"body":      `{"messages":[{"role":"user","content":"mail jane@example.com"}]}`,
+		})
+		if _, err := service.ProcessRequest(ctx, req); err != nil {
+			t.Fatalf("Request for %s failed: %v", model, err)
+		}
+	}
+
+	captured.mu.Lock()
+	raw := captured.buf.String()
+	captured.mu.Unlock()
+	records, err := replay.ReadRecords(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Failed to read capture: %v", err)
+	}
+
+	t.Run("CaptureIsAnonymized", func(t *testing.T) {
+		if len(records) != 3 {
+			t.Fatalf("Expected 3 captured requests, got %d", len(records))
+		}
+		for _, leaked := range []string{"tenant-a", "secret-key", "jane@example.com"} {
+			if strings.Contains(raw, leaked) {
+				t.Errorf("Expected %q not to be captured, got %s", leaked, raw)
+			}
+		}
+		if records[0].TenantID != anonymizer.TenantID("tenant-a") {
+			t.Errorf("Expected the tenant pseudonym, got %s", records[0].TenantID)
+		}
+		if records[0].Headers["user-agent"] != "sdk/1.0" {
+			t.Errorf("Expected non-sensitive headers to be captured, got %v", records[0].Headers)
+		}
+		if records[1].Action != "block" || records[1].BlockReason != "model not allowed: gpt-4" {
+			t.Errorf("Expected the captured block decision, got %+v", records[1])
+		}
+	})
+
+	t.Run("ReplayMatchesDecisions", func(t *testing.T) {
+		replayer := &replay.Replayer{Target: target.URL, Rate: 20, Headers: trusted, DryRun: true}
+		start := time.Now()
+		report, err := replayer.Run(ctx, records)
+		if err != nil {
+			t.Fatalf("Replay failed: %v", err)
+		}
+		if report.Total != 3 || report.Matched != 3 || len(report.Differences) != 0 {
+			t.Errorf("Expected every decision to match, got %+v", report)
+		}
+		if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+			t.Errorf("Expected 3 requests at 20/s to take at least 100ms, took %v", elapsed)
+		}
+		if recorder.Recorded() != 3 {
+			t.Errorf("Expected dry-run replays not to be captured, got %d captures", recorder.Recorded())
+		}
+	})
+
+	t.Run("ReplayReportsChangedDecisions", func(t *testing.T) {
+		guard.block("claude-3-haiku")
+
+		report, err := (&replay.Replayer{Target: target.URL, Headers: trusted, DryRun: true}).Run(ctx, records)
+		if err != nil {
+			t.Fatalf("Replay failed: %v", err)
+		}
+		if report.Matched != 2 || len(report.Differences) != 1 {
+			t.Fatalf("Expected one changed decision, got %+v", report)
+		}
+		diff := report.Differences[0]
+		if diff.RequestID != records[2].RequestID || diff.Action != "continue" || diff.ReplayedAction != "block" {
+			t.Errorf("Expected claude-3-haiku to change from continue to block, got %+v", diff)
+		}
+
+		var summary bytes.Buffer
+		report.Write(&summary)
+		if !strings.Contains(summary.String(), "2 matched, 1 differed") {
+			t.Errorf("Expected the summary to count the difference, got %s", summary.String())
+		}
+	})
+
+	t.Run("UntrustedDryRunIgnored", func(t *testing.T) {
+		captures := recorder.Recorded()
+		if _, err := (&replay.Replayer{Target: target.URL, DryRun: true}).Run(ctx, records[:1]); err != nil {
+			t.Fatalf("Replay failed: %v", err)
+		}
+		req, _ := structpb.NewStruct(map[string]interface{}{"tenant_id": "tenant-a", "model": "gpt-4o-mini", "dry_run": true})
+		if _, err := service.ProcessRequest(ctx, req); err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		if recorder.Recorded() != captures+2 {
+			t.Errorf("Expected dry runs without a trusted token to be captured, got %d captures", recorder.Recorded()-captures)
+		}
+	})
+
+	t.Run("ReplayCommandFailsOnDifferences", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "capture.jsonl")
+		if err := os.WriteFile(file, []byte(raw), 0600); err != nil {
+			t.Fatalf("Failed to write capture file: %v", err)
+		}
+		err := modulehost.RunReplay([]string{"-file", file, "-target", target.URL, "-rate", "0"}, io.Discard, io.Discard)
+		if err == nil || !strings.Contains(err.Error(), "1 of 3 decisions differ") {
+			t.Errorf("Expected the replay command to fail on the changed decision, got %v", err)
+		}
+	})
+
+	t.Run("InvalidSampleRateRejected", func(t *testing.T) {
+		if _, err := replay.NewRecorder(io.Discard, 0, nil); err == nil {
+			t.Error("Expected a zero sample rate to be rejected")
+		}
+	})
+}
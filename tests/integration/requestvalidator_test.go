@@ -0,0 +1,230 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/bendiamant/leash-gateway/internal/modulehost"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/requestvalidator"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"go.uber.org/zap"
+)
+
+func TestRequestValidatorStrictJSON(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	newPipeline := func(strict bool) *pipeline.Pipeline {
+		validator := requestvalidator.NewRequestValidator(sugar)
+		if err := validator.Initialize(ctx, &interfaces.ModuleConfig{
+			Name:   "request-validator",
+			Config: map[string]interface{}{"strict_json": strict},
+		}); err != nil {
+			t.Fatalf("Failed to initialize request validator: %v", err)
+		}
+		validator.Start(ctx)
+
+		modulePipeline := pipeline.NewPipeline(sugar)
+		modulePipeline.AddModule(validator)
+		return modulePipeline
+	}
+
+	newRequest := func(contentType, body string) *interfaces.ProcessRequestContext {
+		return &interfaces.ProcessRequestContext{
+			RequestID: "validator-test",
+			TenantID:  "tenant-a",
+			Headers:   map[string]string{"content-type": contentType},
+			Body:      []byte(body),
+		}
+	}
+
+	malformed := `{"model": "gpt-4o-mini", "messages": [{"role": "user", "content": "hi"`
+
+	t.Run("MalformedJSONBlockedWhenStrict", func(t *testing.T) {
+		result, err := newPipeline(true).ProcessRequest(ctx, newRequest("application/json; charset=utf-8", malformed))
+		if err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		if result.Action != interfaces.ActionBlock {
+			t.Fatalf("Expected malformed JSON to be blocked, got %s", result.Action)
+		}
+		if result.Metadata["status_code"] != "400" {
+			t.Errorf("Expected 400 status code metadata, got %v", result.Metadata)
+		}
+	})
+
+	t.Run("MalformedJSONPassesWhenLenient", func(t *testing.T) {
+		result, err := newPipeline(false).ProcessRequest(ctx, newRequest("application/json", malformed))
+		if err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		if result.Action != interfaces.ActionContinue {
+			t.Errorf("Expected malformed JSON to pass through, got %s: %s", result.Action, result.BlockReason)
+		}
+	})
+
+	t.Run("ValidJSONPasses", func(t *testing.T) {
+		result, err := newPipeline(true).ProcessRequest(ctx, newRequest("application/json", string(chatBody(t, "hi"))))
+		if err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		if result.Action != interfaces.ActionContinue {
+			t.Errorf("Expected valid JSON to pass, got %s: %s", result.Action, result.BlockReason)
+		}
+	})
+
+	t.Run("PlainTextNotParsed", func(t *testing.T) {
+		result, err := newPipeline(true).ProcessRequest(ctx, newRequest("text/plain", "just text {"))
+		if err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		if result.Action != interfaces.ActionContinue {
+			t.Errorf("Expected plain text body to pass, got %s: %s", result.Action, result.BlockReason)
+		}
+	})
+}
+
+func TestRequestValidatorSchema(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	validator := requestvalidator.NewRequestValidator(sugar)
+	config := &interfaces.ModuleConfig{
+		Name:   "request-validator",
+		Config: map[string]interface{}{"schema_validation": true},
+	}
+	if err := validator.ValidateConfig(config); err != nil {
+		t.Fatalf("Invalid config: %v", err)
+	}
+	if err := validator.Initialize(ctx, config); err != nil {
+		t.Fatalf("Failed to initialize request validator: %v", err)
+	}
+	validator.Start(ctx)
+
+	modulePipeline := pipeline.NewPipeline(sugar)
+	modulePipeline.AddModule(validator)
+
+	process := func(t *testing.T, provider, path, body string) *interfaces.ProcessRequestResult {
+		t.Helper()
+		result, err := modulePipeline.ProcessRequest(ctx, &interfaces.ProcessRequestContext{
+			RequestID: "schema-test",
+			TenantID:  "tenant-a",
+			Provider:  provider,
+			Path:      path,
+			Headers:   map[string]string{"Content-Type": "application/json"},
+			Body:      []byte(body),
+		})
+		if err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		return result
+	}
+
+	t.Run("MissingMessagesBlocked", func(t *testing.T) {
+		result := process(t, "openai", "/v1/chat/completions", `{"model": "gpt-4o-mini", "temperature": 0.2}`)
+		if result.Action != interfaces.ActionBlock {
+			t.Fatalf("Expected a request without messages to be blocked, got %s", result.Action)
+		}
+		if result.BlockReason != "invalid openai chat completions request: messages is required" {
+			t.Errorf("Expected a descriptive block reason, got %q", result.BlockReason)
+		}
+		if result.Metadata["status_code"] != "400" {
+			t.Errorf("Expected 400 status code metadata, got %v", result.Metadata)
+		}
+	})
+
+	t.Run("ValidRequestPasses", func(t *testing.T) {
+		result := process(t, "openai", "/v1/chat/completions", `{"model": "gpt-4o-mini", "temperature": 0.2, "max_tokens": 100,
+			"messages": [{"role": "system", "content": "Be brief"}, {"role": "user", "content": "hi"}]}`)
+		if result.Action != interfaces.ActionContinue {
+			t.Errorf("Expected a valid request to pass, got %s: %s", result.Action, result.BlockReason)
+		}
+	})
+
+	t.Run("RolesAndRangesChecked", func(t *testing.T) {
+		result := process(t, "openai", "/v1/chat/completions", `{"model": "gpt-4o-mini", "temperature": 3, "n": 1.5,
+			"messages": [{"role": "wizard", "content": "hi"}, {"content": "no role"}]}`)
+		if result.Action != interfaces.ActionBlock {
+			t.Fatalf("Expected an invalid request to be blocked, got %s", result.Action)
+		}
+		for _, expected := range []string{
+			`messages[0].role "wizard" is not one of`,
+			"messages[1].role is required",
+			"n must be an integer",
+			"temperature must be between 0 and 2, got 3",
+		} {
+			if !strings.Contains(result.BlockReason, expected) {
+				t.Errorf("Expected %q in the block reason, got %q", expected, result.BlockReason)
+			}
+		}
+	})
+
+	t.Run("ProviderSchemas", func(t *testing.T) {
+		// Anthropic requires max_tokens and has no system role in messages
+		result := process(t, "anthropic", "", `{"model": "claude-3-5-sonnet", "messages": [{"role": "system", "content": "hi"}]}`)
+		if result.Action != interfaces.ActionBlock || !strings.Contains(result.BlockReason, "max_tokens is required") ||
+			!strings.Contains(result.BlockReason, `messages[0].role "system"`) {
+			t.Errorf("Expected the anthropic schema enforced, got %s: %q", result.Action, result.BlockReason)
+		}
+		result = process(t, "anthropic", "/v1/messages", `{"model": "claude-3-5-sonnet", "max_tokens": 256, "messages": [{"role": "user", "content": "hi"}]}`)
+		if result.Action != interfaces.ActionContinue {
+			t.Errorf("Expected a valid anthropic request to pass, got %s: %s", result.Action, result.BlockReason)
+		}
+
+		result = process(t, "openai", "/v1/responses", `{"model": "gpt-4o-mini", "input": "hi"}`)
+		if result.Action != interfaces.ActionContinue {
+			t.Errorf("Expected a valid responses request to pass, got %s: %s", result.Action, result.BlockReason)
+		}
+
+		// Endpoints without a schema are not validated
+		result = process(t, "openai", "/v1/embeddings", `{"model": "text-embedding-3-small", "input": "hi"}`)
+		if result.Action != interfaces.ActionContinue {
+			t.Errorf("Expected other endpoints to pass, got %s: %s", result.Action, result.BlockReason)
+		}
+	})
+
+	t.Run("BlockedThroughModuleHost", func(t *testing.T) {
+		addr := startModuleHost(t, modulePipeline, sugar)
+
+		var stdout, stderr bytes.Buffer
+		err := modulehost.RunCall([]string{"--addr", addr, "--tenant", "tenant-a", "--provider", "openai",
+			"--path", "/v1/chat/completions", "--header", "Content-Type=application/json",
+			"--body", `{"model": "gpt-4o-mini", "messages": [{"role": "user"}], "top_p": 2}`, "--json"}, &stdout, &stderr)
+		if err != nil {
+			t.Fatalf("Call failed: %v (%s)", err, stderr.String())
+		}
+		var decision map[string]interface{}
+		if err := json.Unmarshal(stdout.Bytes(), &decision); err != nil {
+			t.Fatalf("Failed to decode decision: %v\n%s", err, stdout.String())
+		}
+		if decision["action"] != "block" {
+			t.Fatalf("Expected the module host to block an invalid request, got %v", decision)
+		}
+		reason, _ := decision["block_reason"].(string)
+		if !strings.HasPrefix(reason, "invalid openai chat completions request: ") || !strings.Contains(reason, "top_p") {
+			t.Errorf("Expected the schema violations in the block reason, got %q", reason)
+		}
+		if metadata, _ := decision["metadata"].(map[string]interface{}); metadata["status_code"] != "400" {
+			t.Errorf("Expected 400 status code metadata, got %v", decision["metadata"])
+		}
+	})
+
+	t.Run("InvalidConfigRejected", func(t *testing.T) {
+		err := validator.ValidateConfig(&interfaces.ModuleConfig{
+			Name:   "request-validator",
+			Config: map[string]interface{}{"schema_validation": "yes"},
+		})
+		if err == nil {
+			t.Error("Expected a non-boolean schema_validation to be rejected")
+		}
+	})
+}
@@ -0,0 +1,133 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/circuitbreaker"
+	"github.com/bendiamant/leash-gateway/internal/modules/chatcontent"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/contentfilter"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/providers/base"
+	"github.com/bendiamant/leash-gateway/internal/providers/openai"
+	"go.uber.org/zap"
+)
+
+// Responses API request and response bodies
+const (
+	responsesRequest = `{"model":"gpt-4o","instructions":"Answer briefly.",
+		"input":[
+			{"role":"user","content":[
+				{"type":"input_text","text":"what is in this harmful picture?"},
+				{"type":"input_image","image_url":"https://example.com/cat.png","detail":"low"}]},
+			{"type":"function_call_output","call_id":"call_1","output":"lookup result"}]}`
+	responsesResponse = `{"id":"resp_1","object":"response","status":"completed",
+		"output":[
+			{"type":"reasoning","id":"rs_1","summary":[]},
+			{"type":"message","id":"msg_1","role":"assistant","content":[
+				{"type":"output_text","text":"A harmful-looking cat.","annotations":[]}]}],
+		"usage":{"input_tokens":1000,"input_tokens_details":{"cached_tokens":200},
+			"output_tokens":3000,"output_tokens_details":{"reasoning_tokens":2500},"total_tokens":4000}}`
+)
+
+func TestResponsesAPIShape(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	t.Run("RequestContentExtracted", func(t *testing.T) {
+		summary, ok := chatcontent.ParseRequest([]byte(responsesRequest))
+		if !ok {
+			t.Fatal("Expected the Responses API request to parse")
+		}
+		for _, text := range []string{"Answer briefly.", "what is in this harmful picture?", "lookup result"} {
+			if !strings.Contains(summary.Text, text) {
+				t.Errorf("Expected %q in the extracted text, got %q", text, summary.Text)
+			}
+		}
+		if summary.Messages != 3 || len(summary.Images) != 1 || summary.Images[0].Detail != "low" {
+			t.Errorf("Expected instructions, two input items and one image, got %+v", summary)
+		}
+	})
+
+	t.Run("ResponseContentExtracted", func(t *testing.T) {
+		summary, ok := chatcontent.ParseResponse([]byte(responsesResponse))
+		if !ok {
+			t.Fatal("Expected the Responses API response to parse")
+		}
+		if strings.TrimSpace(summary.Text) != "A harmful-looking cat." || summary.Choices != 1 {
+			t.Errorf("Expected the output message text as one choice, got %+v", summary)
+		}
+	})
+
+	t.Run("ContentFilterChecksInputAndOutput", func(t *testing.T) {
+		filter := contentfilter.NewContentFilter(sugar)
+		if err := filter.Initialize(ctx, &interfaces.ModuleConfig{
+			Name:   "content-filter",
+			Config: map[string]interface{}{"blocked_keywords": []interface{}{"harmful"}, "action": "block"},
+		}); err != nil {
+			t.Fatalf("Failed to initialize content filter: %v", err)
+		}
+
+		result, err := filter.ProcessRequest(ctx, &interfaces.ProcessRequestContext{RequestID: "responses-req", Body: []byte(responsesRequest)})
+		if err != nil || result.Action != interfaces.ActionBlock {
+			t.Errorf("Expected the Responses API input to be blocked, got %v (%v)", result, err)
+		}
+
+		response, err := filter.ProcessResponse(ctx, &interfaces.ProcessResponseContext{
+			ProcessRequestContext: &interfaces.ProcessRequestContext{RequestID: "responses-resp"},
+			StatusCode:            http.StatusOK,
+			ResponseBody:          []byte(responsesResponse),
+		})
+		if err != nil || response.Annotations["content_safe"] != false {
+			t.Errorf("Expected the Responses API output to be flagged, got %v (%v)", response, err)
+		}
+	})
+
+	t.Run("UsageParsed", func(t *testing.T) {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(responsesResponse))
+		}))
+		defer upstream.Close()
+
+		provider := openai.NewOpenAIProvider(&base.ProviderConfig{
+			Name:     "responses-test",
+			Endpoint: upstream.URL,
+			Timeout:  time.Second,
+			CircuitBreaker: base.CircuitBreakerConfig{
+				FailureThreshold: 50,
+				MinRequests:      10,
+				Timeout:          time.Minute,
+			},
+			Models: []base.ModelConfig{{Name: "o3", CostPer1kInputTokens: 1, CostPer1kOutputTokens: 4}},
+		}, circuitbreaker.NewManager(), sugar)
+
+		resp, err := provider.ProcessRequest(ctx, &base.ProviderRequest{
+			RequestID: "responses-usage",
+			Model:     "o3",
+			Messages:  []base.Message{{Role: "user", Content: "think"}},
+		})
+		if err != nil {
+			t.Fatalf("Provider request failed: %v", err)
+		}
+		usage := resp.Usage
+		if usage.PromptTokens != 1000 || usage.CompletionTokens != 3000 || usage.TotalTokens != 4000 {
+			t.Errorf("Expected input and output tokens as prompt and completion tokens, got %+v", usage)
+		}
+		if usage.CachedTokens() != 200 || usage.ReasoningTokens() != 2500 {
+			t.Errorf("Expected 200 cached and 2500 reasoning tokens, got %d and %d", usage.CachedTokens(), usage.ReasoningTokens())
+		}
+		if math.Abs(resp.Cost-(1.0*1+3.0*4)) > 1e-9 {
+			t.Errorf("Expected the cost of 1000 input and 3000 output tokens, got %f", resp.Cost)
+		}
+	})
+}
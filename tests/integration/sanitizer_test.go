@@ -0,0 +1,142 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/core/sanitizer"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"go.uber.org/zap"
+)
+
+func TestRequestSanitizer(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	newSanitizer := func(t *testing.T, config map[string]interface{}) *sanitizer.Sanitizer {
+		t.Helper()
+		s := sanitizer.NewSanitizer(sugar)
+		moduleConfig := &interfaces.ModuleConfig{Name: "request-sanitizer", Config: config}
+		if err := s.ValidateConfig(moduleConfig); err != nil {
+			t.Fatalf("Invalid config: %v", err)
+		}
+		if err := s.Initialize(ctx, moduleConfig); err != nil {
+			t.Fatalf("Failed to initialize sanitizer: %v", err)
+		}
+		s.Start(ctx)
+		return s
+	}
+	sanitize := func(t *testing.T, s *sanitizer.Sanitizer, body []byte) *interfaces.ProcessRequestResult {
+		t.Helper()
+		result, err := s.ProcessRequest(ctx, &interfaces.ProcessRequestContext{RequestID: "sanitize-test", Body: body})
+		if err != nil {
+			t.Fatalf("Sanitizer failed: %v", err)
+		}
+		return result
+	}
+	// request decodes a sanitized chat request
+	request := func(t *testing.T, body []byte) (model string, contents []string) {
+		t.Helper()
+		var decoded struct {
+			Model    string `json:"model"`
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		if err := json.Unmarshal(body, &decoded); err != nil {
+			t.Fatalf("Sanitized body is not valid JSON: %v: %s", err, body)
+		}
+		for _, message := range decoded.Messages {
+			contents = append(contents, message.Content)
+		}
+		return decoded.Model, contents
+	}
+
+	t.Run("ControlCharactersStripped", func(t *testing.T) {
+		s := newSanitizer(t, nil)
+		result := sanitize(t, s, chatBody(t, "hello\x00 wor\x1bld\u0085\nnext\tline"))
+
+		if result.Action != interfaces.ActionTransform {
+			t.Fatalf("Expected the request to be rewritten, got %v", result.Action)
+		}
+		if _, contents := request(t, result.ModifiedBody); contents[0] != "hello world\nnext\tline" {
+			t.Errorf("Expected control characters removed and whitespace kept, got %q", contents[0])
+		}
+		if result.Annotations["request_sanitized"] != true || result.Annotations["sanitized_control_chars"] != 3 {
+			t.Errorf("Expected the sanitization to be annotated, got %v", result.Annotations)
+		}
+	})
+
+	t.Run("ControlCharactersEscaped", func(t *testing.T) {
+		s := newSanitizer(t, map[string]interface{}{"control_chars": "escape"})
+		result := sanitize(t, s, chatBody(t, "nul\x00byte"))
+		if _, contents := request(t, result.ModifiedBody); contents[0] != `nul\u0000byte` {
+			t.Errorf("Expected the NUL byte escaped as visible text, got %q", contents[0])
+		}
+	})
+
+	t.Run("OversizedFieldTruncated", func(t *testing.T) {
+		s := newSanitizer(t, map[string]interface{}{
+			"max_field_bytes": 64,
+			"field_limits":    map[string]interface{}{"messages.*.content": 9, "model": 0},
+		})
+		body := []byte(`{"model":"` + strings.Repeat("m", 100) + `","temperature":0.25,` +
+			`"messages":[{"role":"user","content":"short"},{"role":"user","content":"héllo wörld, this is far too long"}]}`)
+		result := sanitize(t, s, body)
+
+		model, contents := request(t, result.ModifiedBody)
+		if contents[0] != "short" {
+			t.Errorf("Expected a field within its cap to be untouched, got %q", contents[0])
+		}
+		// 9 bytes would split the ö, so the cut falls before it
+		if contents[1] != "héllo w" {
+			t.Errorf("Expected the content cut to 9 bytes on a character boundary, got %q", contents[1])
+		}
+		if len(model) != 100 {
+			t.Errorf("Expected a field limit of 0 to leave the model uncapped, got %d bytes", len(model))
+		}
+		truncated, _ := result.Annotations["truncated_fields"].([]string)
+		if len(truncated) != 1 || truncated[0] != "messages.1.content" {
+			t.Errorf("Expected the truncated field to be annotated, got %v", result.Annotations)
+		}
+		if !strings.Contains(string(result.ModifiedBody), `"temperature":0.25`) {
+			t.Errorf("Expected numbers preserved, got %s", result.ModifiedBody)
+		}
+	})
+
+	t.Run("ValidContentUntouched", func(t *testing.T) {
+		s := newSanitizer(t, map[string]interface{}{"max_field_bytes": 1024})
+		body := chatBody(t, "Plain <b>text</b> with ünïcode, emoji 🙂 and\nnewlines.")
+		result := sanitize(t, s, body)
+		if result.Action != interfaces.ActionContinue || result.ModifiedBody != nil || len(result.Annotations) != 0 {
+			t.Errorf("Expected clean content to pass through unchanged, got %+v", result)
+		}
+	})
+
+	t.Run("NonJSONBodyStripped", func(t *testing.T) {
+		s := newSanitizer(t, nil)
+		result := sanitize(t, s, []byte("plain\x00text"))
+		if result.Action != interfaces.ActionTransform || string(result.ModifiedBody) != "plaintext" {
+			t.Errorf("Expected control characters stripped from a raw body, got %+v", result)
+		}
+	})
+
+	t.Run("InvalidConfigRejected", func(t *testing.T) {
+		s := sanitizer.NewSanitizer(sugar)
+		for _, config := range []map[string]interface{}{
+			{"control_chars": "drop"},
+			{"max_field_bytes": -1},
+			{"field_limits": map[string]interface{}{"user": "big"}},
+		} {
+			if err := s.ValidateConfig(&interfaces.ModuleConfig{Name: "request-sanitizer", Config: config}); err == nil {
+				t.Errorf("Expected %v to be rejected", config)
+			}
+		}
+	})
+}
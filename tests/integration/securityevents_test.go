@@ -0,0 +1,254 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/core/securityevents"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"github.com/bendiamant/leash-gateway/internal/tenants"
+	"go.uber.org/zap"
+)
+
+func TestSecurityEvents(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	start := time.Date(2026, time.October, 16, 12, 0, 0, 0, time.UTC)
+
+	newEvents := func(t *testing.T, now *time.Time, config map[string]interface{}) *securityevents.SecurityEvents {
+		t.Helper()
+		se := securityevents.NewSecurityEvents(sugar)
+		se.SetClock(func() time.Time { return *now })
+		if err := se.Initialize(ctx, &interfaces.ModuleConfig{Name: "security-events", Config: config}); err != nil {
+			t.Fatalf("Failed to initialize security events: %v", err)
+		}
+		se.Start(ctx)
+		return se
+	}
+
+	t.Run("BlocksAndFlagsCaptured", func(t *testing.T) {
+		now := start
+		se := newEvents(t, &now, nil)
+
+		inspector := newStubModule("moderation", interfaces.ModuleTypeInspector)
+		inspector.conditions = []interfaces.Condition{{Field: "model", Operator: "eq", Value: "gpt-flagged"}}
+		inspector.result = &interfaces.ProcessRequestResult{
+			Action:      interfaces.ActionContinue,
+			Annotations: map[string]interface{}{"moderation_flagged": true},
+		}
+		policy := newStubModule("model-policy", interfaces.ModuleTypePolicy)
+		policy.conditions = []interfaces.Condition{{Field: "model", Operator: "eq", Value: "gpt-blocked"}}
+		policy.result = &interfaces.ProcessRequestResult{Action: interfaces.ActionBlock, BlockReason: "model_denied"}
+
+		// process runs a request through the pipeline and waits for its sink
+		// and block observers, which run in the background
+		process := func(t *testing.T, req *interfaces.ProcessRequestContext) {
+			t.Helper()
+			p := pipeline.NewPipeline(sugar)
+			for _, module := range []interfaces.Module{inspector, policy, se} {
+				if err := p.AddModule(module); err != nil {
+					t.Fatalf("Failed to add %s: %v", module.Name(), err)
+				}
+			}
+			if _, err := p.ProcessRequest(ctx, req); err != nil {
+				t.Fatalf("ProcessRequest failed: %v", err)
+			}
+			p.Drain(ctx)
+		}
+
+		for i, tc := range []struct{ tenant, model string }{
+			{"acme", "gpt-blocked"},
+			{"acme", "gpt-4o-mini"},
+			{"globex", "gpt-flagged"},
+			{"globex", "gpt-blocked"},
+		} {
+			now = start.Add(time.Duration(i) * time.Minute)
+			process(t, &interfaces.ProcessRequestContext{
+				RequestID: tc.tenant + "-" + tc.model,
+				TenantID:  tc.tenant,
+				Model:     tc.model,
+				Method:    http.MethodPost,
+				Path:      "/v1/chat/completions",
+				Headers:   map[string]string{"authorization": "Bearer sk-secret", "user-agent": "test"},
+				Body:      []byte(`{"messages":[{"role":"user","content":"mail jane@example.com"}]}`),
+			})
+		}
+
+		events := se.Query(securityevents.Query{})
+		if len(events) != 3 {
+			t.Fatalf("Expected two blocks and one flag captured, got %+v", events)
+		}
+		latest := events[0]
+		if latest.Type != securityevents.EventBlock || latest.TenantID != "globex" || latest.Module != "model-policy" || latest.Reason != "model_denied" {
+			t.Errorf("Expected the newest event to be globex's block by model-policy, got %+v", latest)
+		}
+		if _, leaked := latest.Headers["authorization"]; leaked || latest.Headers["user-agent"] != "test" {
+			t.Errorf("Expected credentials dropped from captured headers, got %v", latest.Headers)
+		}
+		if latest.Body != `{"messages":[{"role":"user","content":"mail [REDACTED_EMAIL]"}]}` {
+			t.Errorf("Expected the captured body redacted, got %s", latest.Body)
+		}
+		if flagged := events[1]; flagged.Type != securityevents.EventFlag || len(flagged.Flags) != 1 || flagged.Flags[0] != "moderation_flagged" {
+			t.Errorf("Expected globex's flagged request captured, got %+v", flagged)
+		}
+
+		query := func(t *testing.T, rawQuery string) []securityevents.Event {
+			t.Helper()
+			recorder := httptest.NewRecorder()
+			se.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/admin/security-events?"+rawQuery, nil))
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("Query %q failed with %d: %s", rawQuery, recorder.Code, recorder.Body)
+			}
+			var body struct {
+				Events []securityevents.Event `json:"events"`
+			}
+			if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+				t.Fatalf("Failed to decode events: %v", err)
+			}
+			return body.Events
+		}
+
+		if acme := query(t, "tenant=acme"); len(acme) != 1 || acme[0].RequestID != "acme-gpt-blocked" {
+			t.Errorf("Expected acme's block only, got %+v", acme)
+		}
+		if flags := query(t, "action=flag"); len(flags) != 1 || flags[0].TenantID != "globex" {
+			t.Errorf("Expected the one flag, got %+v", flags)
+		}
+		if blocks := query(t, "action=block&since="+start.Add(time.Minute).Format(time.RFC3339)); len(blocks) != 1 || blocks[0].TenantID != "globex" {
+			t.Errorf("Expected only the later block, got %+v", blocks)
+		}
+		if early := query(t, "until="+start.Add(time.Minute).Format(time.RFC3339)); len(early) != 1 || early[0].TenantID != "acme" {
+			t.Errorf("Expected only the first block, got %+v", early)
+		}
+		if limited := query(t, "limit=1"); len(limited) != 1 || limited[0].ID != latest.ID {
+			t.Errorf("Expected the newest event only, got %+v", limited)
+		}
+		if none := query(t, "tenant=initech"); len(none) != 0 {
+			t.Errorf("Expected no events for an unknown tenant, got %+v", none)
+		}
+
+		for _, invalid := range []string{"action=allow", "since=yesterday", "limit=0"} {
+			recorder := httptest.NewRecorder()
+			se.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/admin/security-events?"+invalid, nil))
+			if recorder.Code != http.StatusBadRequest {
+				t.Errorf("Expected 400 for %s, got %d", invalid, recorder.Code)
+			}
+		}
+	})
+
+	t.Run("TenantFilterAnonymized", func(t *testing.T) {
+		now := start
+		se := newEvents(t, &now, nil)
+		anonymizer, err := tenants.NewAnonymizer("salt", nil)
+		if err != nil {
+			t.Fatalf("Failed to create anonymizer: %v", err)
+		}
+		se.SetTenantAnonymizer(anonymizer)
+
+		policy := newStubModule("model-policy", interfaces.ModuleTypePolicy)
+		policy.result = &interfaces.ProcessRequestResult{Action: interfaces.ActionBlock, BlockReason: "model_denied"}
+		p := pipeline.NewPipeline(sugar)
+		for _, module := range []interfaces.Module{policy, se} {
+			if err := p.AddModule(module); err != nil {
+				t.Fatalf("Failed to add %s: %v", module.Name(), err)
+			}
+		}
+		for _, tenantID := range []string{"acme", "globex"} {
+			if _, err := p.ProcessRequest(ctx, &interfaces.ProcessRequestContext{RequestID: tenantID + "-1", TenantID: tenantID}); err != nil {
+				t.Fatalf("ProcessRequest failed: %v", err)
+			}
+		}
+		p.Drain(ctx)
+
+		recorder := httptest.NewRecorder()
+		se.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/admin/security-events?tenant=acme", nil))
+		var body struct {
+			Events []securityevents.Event `json:"events"`
+		}
+		if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode events: %v", err)
+		}
+		if len(body.Events) != 1 || body.Events[0].RequestID != "acme-1" || body.Events[0].TenantID != anonymizer.TenantID("acme") {
+			t.Errorf("Expected acme's pseudonymized event only, got %+v", body.Events)
+		}
+	})
+
+	t.Run("RetentionPurgesOldEvents", func(t *testing.T) {
+		now := start
+		se := newEvents(t, &now, map[string]interface{}{"retention": "24h"})
+
+		block := func(requestID string) {
+			se.ObserveBlock(interfaces.WithBlockingModule(ctx, "rate-limiter"), &interfaces.ProcessRequestContext{
+				RequestID: requestID,
+				TenantID:  "acme",
+			}, &interfaces.ProcessRequestResult{Action: interfaces.ActionBlock, BlockReason: "rate_limit_exceeded"})
+		}
+
+		block("old")
+		now = start.Add(12 * time.Hour)
+		block("recent")
+		if events := se.Query(securityevents.Query{}); len(events) != 2 {
+			t.Fatalf("Expected both events retained, got %+v", events)
+		}
+
+		now = start.Add(25 * time.Hour)
+		events := se.Query(securityevents.Query{})
+		if len(events) != 1 || events[0].RequestID != "recent" {
+			t.Fatalf("Expected the event past retention purged, got %+v", events)
+		}
+		if purged := se.Metrics()["events_purged"]; purged != int64(1) {
+			t.Errorf("Expected one purged event counted, got %v", purged)
+		}
+
+		now = start.Add(37 * time.Hour)
+		if events := se.Query(securityevents.Query{}); len(events) != 0 {
+			t.Errorf("Expected every event purged, got %+v", events)
+		}
+	})
+
+	t.Run("BoundedStoreEvictsOldest", func(t *testing.T) {
+		now := start
+		se := newEvents(t, &now, map[string]interface{}{"max_events": 2, "events": []interface{}{"block"}})
+
+		for _, requestID := range []string{"first", "second", "third"} {
+			se.ObserveBlock(ctx, &interfaces.ProcessRequestContext{RequestID: requestID, TenantID: "acme"},
+				&interfaces.ProcessRequestResult{Action: interfaces.ActionBlock})
+		}
+		// Flags are not captured with only block events configured
+		se.ProcessRequest(ctx, &interfaces.ProcessRequestContext{
+			RequestID:   "flagged",
+			TenantID:    "acme",
+			Annotations: map[string]interface{}{"content_safe": false},
+		})
+
+		events := se.Query(securityevents.Query{})
+		if len(events) != 2 || events[0].RequestID != "third" || events[1].RequestID != "second" {
+			t.Fatalf("Expected the oldest event evicted, got %+v", events)
+		}
+	})
+
+	t.Run("InvalidConfig", func(t *testing.T) {
+		se := securityevents.NewSecurityEvents(sugar)
+		for name, invalid := range map[string]map[string]interface{}{
+			"UnknownEvent":     {"events": []interface{}{"allow"}},
+			"NoCapacity":       {"max_events": 0},
+			"BadRetention":     {"retention": "7d"},
+			"NegativeBodySize": {"max_body_bytes": -1},
+			"FlagsNotAMap":     {"flag_annotations": []interface{}{"content_safe"}},
+		} {
+			if err := se.ValidateConfig(&interfaces.ModuleConfig{Name: "security-events", Config: invalid}); err == nil {
+				t.Errorf("%s: expected the config rejected", name)
+			}
+		}
+	})
+}
@@ -0,0 +1,161 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/config"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/ratelimiter"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"github.com/bendiamant/leash-gateway/internal/providers"
+	"github.com/bendiamant/leash-gateway/internal/providers/base"
+	"github.com/bendiamant/leash-gateway/internal/selftest"
+	"go.uber.org/zap"
+)
+
+// newSelfTestProviders registers an OpenAI provider backed by a stub upstream
+func newSelfTestProviders(t *testing.T, sugar *zap.SugaredLogger, status int) *providers.Registry {
+	t.Helper()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(upstream.Close)
+
+	registry := providers.NewRegistry(sugar)
+	err := registry.InitializeFromConfig(map[string]*base.ProviderConfig{
+		"openai": {
+			Endpoint: upstream.URL,
+			Timeout:  time.Second,
+			CircuitBreaker: base.CircuitBreakerConfig{
+				FailureThreshold: 5,
+				Timeout:          time.Minute,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to initialize providers: %v", err)
+	}
+	return registry
+}
+
+// readyStatus returns the readiness probe status code
+func readyStatus(runner *selftest.Runner) int {
+	recorder := httptest.NewRecorder()
+	runner.ReadyHTTP(recorder, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	return recorder.Code
+}
+
+func TestStartupSelfTest(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	fatalProviders := config.SelfTestConfig{
+		Enabled:     true,
+		Timeout:     5 * time.Second,
+		FatalChecks: []string{"providers", "pipeline"},
+	}
+
+	t.Run("HealthyProvidersReady", func(t *testing.T) {
+		sink := newStubModule("self-test-sink", interfaces.ModuleTypeSink)
+		modulePipeline := pipeline.NewPipeline(sugar)
+		modulePipeline.AddModule(sink)
+
+		runner := selftest.NewRunner(newSelfTestProviders(t, sugar, http.StatusOK), modulePipeline, fatalProviders, sugar)
+		if status := readyStatus(runner); status != http.StatusServiceUnavailable {
+			t.Errorf("Expected not ready before self-test, got %d", status)
+		}
+
+		report := runner.Run(ctx)
+		if !report.Ready {
+			t.Fatalf("Expected self-test to pass, got %+v", report.Checks)
+		}
+		if len(report.Checks) != 2 {
+			t.Errorf("Expected provider and pipeline checks, got %+v", report.Checks)
+		}
+		if status := readyStatus(runner); status != http.StatusOK {
+			t.Errorf("Expected ready after self-test, got %d", status)
+		}
+
+		// Dry-run requests must not reach sinks
+		time.Sleep(50 * time.Millisecond)
+		if sink.calls != 0 {
+			t.Errorf("Expected synthetic request to skip sinks, got %d calls", sink.calls)
+		}
+	})
+
+	t.Run("StatefulPoliciesUntouched", func(t *testing.T) {
+		rl := ratelimiter.NewRateLimiter(sugar)
+		if err := rl.Initialize(ctx, &interfaces.ModuleConfig{
+			Name: "rate-limiter", Enabled: true,
+			Config: map[string]interface{}{"burst_size": 1, "refill_rate": 0},
+		}); err != nil {
+			t.Fatalf("Failed to initialize rate limiter: %v", err)
+		}
+		modulePipeline := pipeline.NewPipeline(sugar)
+		modulePipeline.AddModule(rl)
+
+		runner := selftest.NewRunner(newSelfTestProviders(t, sugar, http.StatusOK), modulePipeline, fatalProviders, sugar)
+		for i := 0; i < 3; i++ {
+			if report := runner.Run(ctx); !report.Ready {
+				t.Fatalf("Expected self-test run %d to pass, got %+v", i+1, report.Checks)
+			}
+		}
+		if buckets := rl.Metrics()["active_buckets"]; buckets != 0 {
+			t.Errorf("Expected the self-test to create no rate limit buckets, got %v", buckets)
+		}
+
+		// The synthetic tenant's single token is still there
+		result, err := rl.ProcessRequest(ctx, &interfaces.ProcessRequestContext{RequestID: "after-self-test", TenantID: selftest.SyntheticTenant})
+		if err != nil || result.Action != interfaces.ActionContinue {
+			t.Errorf("Expected the first real request admitted, got %v (%v)", result, err)
+		}
+	})
+
+	t.Run("FailingProviderNotReady", func(t *testing.T) {
+		runner := selftest.NewRunner(newSelfTestProviders(t, sugar, http.StatusInternalServerError), pipeline.NewPipeline(sugar), fatalProviders, sugar)
+
+		report := runner.Run(ctx)
+		if report.Ready {
+			t.Fatal("Expected failing provider to fail readiness")
+		}
+		if status := readyStatus(runner); status != http.StatusServiceUnavailable {
+			t.Errorf("Expected not ready, got %d", status)
+		}
+	})
+
+	t.Run("NonFatalProviderFailureReady", func(t *testing.T) {
+		runner := selftest.NewRunner(newSelfTestProviders(t, sugar, http.StatusInternalServerError), pipeline.NewPipeline(sugar),
+			config.SelfTestConfig{Enabled: true, FatalChecks: []string{"pipeline"}}, sugar)
+
+		report := runner.Run(ctx)
+		if !report.Ready {
+			t.Fatal("Expected non-fatal provider failure to keep host ready")
+		}
+		for _, check := range report.Checks {
+			if check.Name == "provider:openai" && (check.Passed || check.Fatal) {
+				t.Errorf("Expected provider check to fail non-fatally, got %+v", check)
+			}
+		}
+	})
+
+	t.Run("BlockingPipelineNotReady", func(t *testing.T) {
+		blocker := newStubModule("blocker", interfaces.ModuleTypePolicy)
+		blocker.result = &interfaces.ProcessRequestResult{Action: interfaces.ActionBlock, BlockReason: "broken"}
+		modulePipeline := pipeline.NewPipeline(sugar)
+		modulePipeline.AddModule(blocker)
+
+		runner := selftest.NewRunner(newSelfTestProviders(t, sugar, http.StatusOK), modulePipeline, fatalProviders, sugar)
+		if report := runner.Run(ctx); report.Ready {
+			t.Error("Expected blocked synthetic request to fail readiness")
+		}
+	})
+}
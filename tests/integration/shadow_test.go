@@ -0,0 +1,196 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/circuitbreaker"
+	"github.com/bendiamant/leash-gateway/internal/providers"
+	"github.com/bendiamant/leash-gateway/internal/providers/base"
+	"github.com/bendiamant/leash-gateway/internal/providers/openai"
+	"github.com/bendiamant/leash-gateway/internal/providers/shadow"
+	"go.uber.org/zap"
+)
+
+func TestShadowProvider(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	const usage = `"usage":{"prompt_tokens":100,"completion_tokens":100,"total_tokens":200}`
+	primaryBody := `{"id":"primary","choices":[{"message":{"role":"assistant","content":"from primary"}}],` + usage + `}`
+	shadowBody := `{"id":"shadow","choices":[{"message":{"role":"assistant","content":"from shadow"}}],` + usage + `}`
+
+	// newUpstream serves a fixed body and counts requests and models seen
+	newUpstream := func(t *testing.T, body string, delay time.Duration) (*httptest.Server, *int64) {
+		var calls int64
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(&calls, 1)
+			time.Sleep(delay)
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(body))
+		}))
+		t.Cleanup(upstream.Close)
+		return upstream, &calls
+	}
+	providerConfig := func(name, endpoint string) *base.ProviderConfig {
+		return &base.ProviderConfig{
+			Name:     name,
+			Endpoint: endpoint,
+			Timeout:  5 * time.Second,
+			CircuitBreaker: base.CircuitBreakerConfig{
+				FailureThreshold: 50,
+				MinRequests:      10,
+				Timeout:          time.Minute,
+			},
+			Models: []base.ModelConfig{
+				{Name: "gpt-4o-mini", CostPer1kInputTokens: 1, CostPer1kOutputTokens: 1},
+				{Name: "candidate-model", CostPer1kInputTokens: 2, CostPer1kOutputTokens: 2},
+			},
+		}
+	}
+	request := func(id string) *base.ProviderRequest {
+		return &base.ProviderRequest{
+			RequestID: id,
+			Model:     "gpt-4o-mini",
+			Messages:  []base.Message{{Role: "user", Content: "hello"}},
+		}
+	}
+
+	t.Run("MirrorsConfiguredFraction", func(t *testing.T) {
+		primaryUpstream, _ := newUpstream(t, primaryBody, 0)
+		shadowUpstream, shadowCalls := newUpstream(t, shadowBody, 5*time.Millisecond)
+
+		manager := circuitbreaker.NewManager()
+		provider := shadow.Wrap(
+			openai.NewOpenAIProvider(providerConfig("primary", primaryUpstream.URL), manager, sugar),
+			openai.NewOpenAIProvider(providerConfig("candidate", shadowUpstream.URL), manager, sugar),
+			base.ShadowConfig{Provider: "candidate", Fraction: 0.25, Model: "candidate-model"},
+			sugar,
+		)
+
+		const requests = 400
+		for i := 0; i < requests; i++ {
+			resp, err := provider.ProcessRequest(ctx, request(fmt.Sprintf("shadow-req-%d", i)))
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			if string(resp.Body) != primaryBody {
+				t.Fatalf("Expected the primary's response to be returned, got %s", resp.Body)
+			}
+		}
+		provider.Wait()
+
+		calls := atomic.LoadInt64(shadowCalls)
+		if calls < requests*15/100 || calls > requests*35/100 {
+			t.Errorf("Expected about 25%% of %d requests mirrored, got %d", requests, calls)
+		}
+
+		results := provider.Results()
+		if int64(len(results)) != calls {
+			t.Fatalf("Expected %d recorded comparisons, got %d", calls, len(results))
+		}
+		for _, result := range results {
+			if result.Error != "" || result.ShadowStatus != http.StatusOK || result.PrimaryStatus != http.StatusOK {
+				t.Fatalf("Expected successful comparison, got %+v", result)
+			}
+			if result.Model != "candidate-model" || result.Shadow != "candidate" || result.Primary != "primary" {
+				t.Errorf("Expected shadow model override and provider names, got %+v", result)
+			}
+			if result.PrimaryCost != 0.2 || result.ShadowCost != 0.4 {
+				t.Errorf("Expected primary cost 0.2 and shadow cost 0.4, got %v and %v", result.PrimaryCost, result.ShadowCost)
+			}
+			if result.BodiesMatch || result.ShadowLatency < 5*time.Millisecond {
+				t.Errorf("Expected differing bodies and recorded shadow latency, got %+v", result)
+			}
+		}
+
+		// Sampling is by request ID, so the same request is mirrored again
+		before := atomic.LoadInt64(shadowCalls)
+		provider.ProcessRequest(ctx, request(results[0].RequestID))
+		provider.Wait()
+		if atomic.LoadInt64(shadowCalls) != before+1 {
+			t.Error("Expected a sampled request ID to be mirrored consistently")
+		}
+	})
+
+	t.Run("ZeroFractionNeverMirrors", func(t *testing.T) {
+		primaryUpstream, _ := newUpstream(t, primaryBody, 0)
+		shadowUpstream, shadowCalls := newUpstream(t, shadowBody, 0)
+
+		manager := circuitbreaker.NewManager()
+		provider := shadow.Wrap(
+			openai.NewOpenAIProvider(providerConfig("primary", primaryUpstream.URL), manager, sugar),
+			openai.NewOpenAIProvider(providerConfig("candidate", shadowUpstream.URL), manager, sugar),
+			base.ShadowConfig{Provider: "candidate"},
+			sugar,
+		)
+		for i := 0; i < 50; i++ {
+			provider.ProcessRequest(ctx, request(fmt.Sprintf("unmirrored-%d", i)))
+		}
+		provider.Wait()
+		if calls := atomic.LoadInt64(shadowCalls); calls != 0 || len(provider.Results()) != 0 {
+			t.Errorf("Expected no shadow requests, got %d", calls)
+		}
+	})
+
+	t.Run("RegistryWiresShadowFromConfig", func(t *testing.T) {
+		primaryUpstream, _ := newUpstream(t, primaryBody, 0)
+		shadowUpstream, shadowCalls := newUpstream(t, `{"id":"msg","content":[{"type":"text","text":"hi"}]}`, 0)
+
+		openaiConfig := providerConfig("openai", primaryUpstream.URL)
+		openaiConfig.Shadow = base.ShadowConfig{Provider: "anthropic", Fraction: 1, Model: "claude-3-haiku"}
+		registry := providers.NewRegistry(sugar)
+		if err := registry.InitializeFromConfig(map[string]*base.ProviderConfig{
+			"openai":    openaiConfig,
+			"anthropic": providerConfig("anthropic", shadowUpstream.URL),
+		}); err != nil {
+			t.Fatalf("Failed to initialize providers: %v", err)
+		}
+
+		provider, err := registry.Get("openai")
+		if err != nil {
+			t.Fatalf("Failed to get provider: %v", err)
+		}
+		mirrored, ok := provider.(*shadow.Provider)
+		if !ok {
+			t.Fatalf("Expected openai to be shadowed, got %T", provider)
+		}
+		resp, err := mirrored.ProcessRequest(ctx, request("registry-shadow"))
+		if err != nil || string(resp.Body) != primaryBody {
+			t.Fatalf("Expected the primary's response, got %v (%v)", resp, err)
+		}
+		registry.Shutdown()
+
+		results := mirrored.Results()
+		if atomic.LoadInt64(shadowCalls) != 1 || len(results) != 1 || results[0].Shadow != "anthropic" || results[0].Model != "claude-3-haiku" {
+			t.Errorf("Expected one comparison against anthropic, got %+v", results)
+		}
+	})
+
+	t.Run("InvalidShadowRejected", func(t *testing.T) {
+		for name, shadowConfig := range map[string]base.ShadowConfig{
+			"Self":            {Provider: "openai", Fraction: 0.1},
+			"Unknown":         {Provider: "missing", Fraction: 0.1},
+			"FractionTooHigh": {Provider: "anthropic", Fraction: 1.5},
+		} {
+			openaiConfig := providerConfig("openai", "http://127.0.0.1:0")
+			openaiConfig.Shadow = shadowConfig
+			err := providers.NewRegistry(sugar).InitializeFromConfig(map[string]*base.ProviderConfig{
+				"openai":    openaiConfig,
+				"anthropic": providerConfig("anthropic", "http://127.0.0.1:0"),
+			})
+			if err == nil {
+				t.Errorf("%s: expected shadow config to be rejected", name)
+			}
+		}
+	})
+}
@@ -0,0 +1,205 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/circuitbreaker"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"github.com/bendiamant/leash-gateway/internal/modules/registry"
+	"github.com/bendiamant/leash-gateway/internal/providers"
+	"github.com/bendiamant/leash-gateway/internal/providers/base"
+	"github.com/bendiamant/leash-gateway/internal/providers/openai"
+	"go.uber.org/zap"
+)
+
+// shutdownLog records lifecycle events in the order they happen
+type shutdownLog struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *shutdownLog) add(event string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, event)
+}
+
+func (l *shutdownLog) index(event string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, e := range l.events {
+		if e == event {
+			return i
+		}
+	}
+	return -1
+}
+
+// lifecycleModule is a stub module recording Stop and Shutdown calls
+type lifecycleModule struct {
+	*stubModule
+	log *shutdownLog
+}
+
+func (m *lifecycleModule) Stop(ctx context.Context) error {
+	m.log.add("stop:" + m.name)
+	return nil
+}
+
+func (m *lifecycleModule) Shutdown(ctx context.Context) error {
+	m.log.add("shutdown:" + m.name)
+	return nil
+}
+
+// bufferingSink buffers requests in memory and flushes them when stopped
+type bufferingSink struct {
+	*lifecycleModule
+	mu      sync.Mutex
+	buffer  []string
+	flushed []string
+}
+
+func (s *bufferingSink) ProcessRequest(ctx context.Context, req *interfaces.ProcessRequestContext) (*interfaces.ProcessRequestResult, error) {
+	time.Sleep(s.delay)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buffer = append(s.buffer, req.RequestID)
+	return s.result, nil
+}
+
+func (s *bufferingSink) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	s.flushed = append(s.flushed, s.buffer...)
+	s.buffer = nil
+	s.mu.Unlock()
+	return s.lifecycleModule.Stop(ctx)
+}
+
+// lifecycleProvider records provider Shutdown calls
+type lifecycleProvider struct {
+	base.Provider
+	log *shutdownLog
+}
+
+func (p *lifecycleProvider) Shutdown() error {
+	p.log.add("shutdown:provider:" + p.Name())
+	return p.Provider.(interface{ Shutdown() error }).Shutdown()
+}
+
+func TestGracefulShutdownOrdering(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	log := &shutdownLog{}
+	policy := &lifecycleModule{stubModule: newStubModule("policy", interfaces.ModuleTypePolicy), log: log}
+	sink := &bufferingSink{lifecycleModule: &lifecycleModule{stubModule: newStubModule("sink", interfaces.ModuleTypeSink), log: log}}
+	sink.delay = 100 * time.Millisecond
+
+	modules := registry.NewModuleRegistry(sugar)
+	p := pipeline.NewPipeline(sugar)
+	for _, module := range []interfaces.Module{policy, sink} {
+		if err := modules.Register(module); err != nil {
+			t.Fatalf("Failed to register %s: %v", module.Name(), err)
+		}
+		if err := p.AddModule(module); err != nil {
+			t.Fatalf("Failed to add %s: %v", module.Name(), err)
+		}
+	}
+
+	providerRegistry := providers.NewRegistry(sugar)
+	provider := &lifecycleProvider{
+		Provider: openai.NewOpenAIProvider(&base.ProviderConfig{
+			Name:     "openai",
+			Endpoint: "http://127.0.0.1:0",
+			Timeout:  time.Second,
+			HealthCheck: base.HealthCheckConfig{
+				Enabled:  true,
+				Interval: time.Hour,
+				Timeout:  time.Second,
+			},
+		}, circuitbreaker.NewManager(), sugar),
+		log: log,
+	}
+	if err := providerRegistry.Register(provider); err != nil {
+		t.Fatalf("Failed to register provider: %v", err)
+	}
+
+	// The sink is still buffering asynchronously when shutdown begins
+	if _, err := p.ProcessRequest(ctx, &interfaces.ProcessRequestContext{RequestID: "req-1", TenantID: "tenant-a"}); err != nil {
+		t.Fatalf("Pipeline failed: %v", err)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if err := p.Drain(shutdownCtx); err != nil {
+		t.Fatalf("Drain failed: %v", err)
+	}
+	if err := modules.Shutdown(shutdownCtx); err != nil {
+		t.Fatalf("Module shutdown failed: %v", err)
+	}
+	if err := providerRegistry.Shutdown(); err != nil {
+		t.Fatalf("Provider shutdown failed: %v", err)
+	}
+
+	t.Run("SinkFlushedBeforeExit", func(t *testing.T) {
+		if len(sink.flushed) != 1 || sink.flushed[0] != "req-1" {
+			t.Errorf("Expected buffered request to be flushed, got %v (still buffered: %v)", sink.flushed, sink.buffer)
+		}
+	})
+
+	t.Run("ModulesAndProvidersShutDown", func(t *testing.T) {
+		for _, event := range []string{"stop:sink", "shutdown:sink", "stop:policy", "shutdown:policy", "shutdown:provider:openai"} {
+			if log.index(event) < 0 {
+				t.Errorf("Expected %s, got events %v", event, log.events)
+			}
+		}
+	})
+
+	t.Run("Ordering", func(t *testing.T) {
+		if log.index("shutdown:sink") > log.index("stop:policy") {
+			t.Errorf("Expected sinks to shut down before other modules, got %v", log.events)
+		}
+		if log.index("shutdown:policy") > log.index("shutdown:provider:openai") {
+			t.Errorf("Expected modules to shut down before providers, got %v", log.events)
+		}
+	})
+
+	t.Run("DrainedPipelineRejectsRequests", func(t *testing.T) {
+		_, err := p.ProcessRequest(ctx, &interfaces.ProcessRequestContext{RequestID: "req-2", TenantID: "tenant-a"})
+		if !errors.Is(err, pipeline.ErrDraining) {
+			t.Errorf("Expected ErrDraining after drain, got %v", err)
+		}
+	})
+}
+
+func TestPipelineDrainDeadline(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+
+	sink := newStubModule("slow-sink", interfaces.ModuleTypeSink)
+	sink.delay = time.Second
+	p := pipeline.NewPipeline(sugar)
+	if err := p.AddModule(sink); err != nil {
+		t.Fatalf("Failed to add sink: %v", err)
+	}
+
+	if _, err := p.ProcessRequest(context.Background(), &interfaces.ProcessRequestContext{RequestID: "req-1", TenantID: "tenant-a"}); err != nil {
+		t.Fatalf("Pipeline failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := p.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected drain to stop at the deadline, got %v", err)
+	}
+}
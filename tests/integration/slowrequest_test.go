@@ -0,0 +1,109 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/metrics"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestSlowRequestDetection(t *testing.T) {
+	ctx := context.Background()
+
+	newPipeline := func(threshold time.Duration) (*pipeline.Pipeline, *observer.ObservedLogs, *metrics.Registry) {
+		core, logs := observer.New(zap.DebugLevel)
+		p := pipeline.NewPipeline(zap.New(core).Sugar())
+		registry := metrics.NewRegistry()
+		p.SetMetrics(registry)
+		p.SetSlowRequestThreshold(threshold)
+
+		fast := newStubModule("fast-inspector", interfaces.ModuleTypeInspector)
+		slow := newStubModule("slow-policy", interfaces.ModuleTypePolicy)
+		slow.delay = 60 * time.Millisecond
+		p.AddModule(fast)
+		p.AddModule(slow)
+		return p, logs, registry
+	}
+	request := func() *interfaces.ProcessRequestContext {
+		return &interfaces.ProcessRequestContext{RequestID: "slow-1", TenantID: "tenant-a", Provider: "openai", Model: "gpt-4o-mini"}
+	}
+
+	t.Run("SlowRequestLoggedWithModuleTimings", func(t *testing.T) {
+		p, logs, registry := newPipeline(50 * time.Millisecond)
+		if _, err := p.ProcessRequest(ctx, request()); err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+
+		entries := logs.FilterMessage("Slow request").All()
+		if len(entries) != 1 {
+			t.Fatalf("Expected one slow-request log, got %d", len(entries))
+		}
+		fields := entries[0].ContextMap()
+		if fields["request_id"] != "slow-1" || fields["phase"] != "request" {
+			t.Errorf("Expected the request phase of slow-1, got %v", fields)
+		}
+		modules, ok := fields["module_ms"].(map[string]float64)
+		if !ok {
+			t.Fatalf("Expected per-module timings, got %v", fields["module_ms"])
+		}
+		if modules["slow-policy"] < 60 {
+			t.Errorf("Expected slow-policy to take at least 60ms, got %v", modules["slow-policy"])
+		}
+		if _, timed := modules["fast-inspector"]; !timed {
+			t.Errorf("Expected the inspector to be timed, got %v", modules)
+		}
+		if latency, _ := fields["latency_ms"].(float64); latency < 60 {
+			t.Errorf("Expected the total latency in the log, got %v", fields["latency_ms"])
+		}
+		if count := testutil.ToFloat64(registry.SlowRequests.WithLabelValues("request", "openai", "gpt-4o-mini")); count != 1 {
+			t.Errorf("Expected slow_requests_total to be 1, got %v", count)
+		}
+	})
+
+	t.Run("ResponseIncludesProviderLatency", func(t *testing.T) {
+		p, logs, registry := newPipeline(time.Second)
+		_, err := p.ProcessResponse(ctx, &interfaces.ProcessResponseContext{
+			ProcessRequestContext: request(),
+			StatusCode:            200,
+			ProviderLatency:       1500 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		p.Drain(ctx)
+
+		entries := logs.FilterMessage("Slow request").All()
+		if len(entries) != 1 {
+			t.Fatalf("Expected one slow-request log, got %d", len(entries))
+		}
+		fields := entries[0].ContextMap()
+		if fields["phase"] != "response" || fields["provider_ms"] != float64(1500) {
+			t.Errorf("Expected the response phase with provider latency, got %v", fields)
+		}
+		if count := testutil.ToFloat64(registry.SlowRequests.WithLabelValues("response", "openai", "gpt-4o-mini")); count != 1 {
+			t.Errorf("Expected slow_requests_total to be 1, got %v", count)
+		}
+	})
+
+	t.Run("FastRequestsNotLogged", func(t *testing.T) {
+		p, logs, registry := newPipeline(time.Second)
+		if _, err := p.ProcessRequest(ctx, request()); err != nil {
+			t.Fatalf("Pipeline failed: %v", err)
+		}
+		if n := logs.FilterMessage("Slow request").Len(); n != 0 {
+			t.Errorf("Expected no slow-request log under the threshold, got %d", n)
+		}
+		if count := testutil.ToFloat64(registry.SlowRequests.WithLabelValues("request", "openai", "gpt-4o-mini")); count != 0 {
+			t.Errorf("Expected no slow requests counted, got %v", count)
+		}
+	})
+}
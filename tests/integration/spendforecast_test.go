@@ -0,0 +1,170 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/metrics"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/spendforecast"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+func TestSpendForecast(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	periodStart := time.Date(2026, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+	newForecast := func(t *testing.T, now *time.Time, config map[string]interface{}) (*spendforecast.SpendForecast, *metrics.Registry) {
+		t.Helper()
+		sf := spendforecast.NewSpendForecast(sugar)
+		registry := metrics.NewRegistry()
+		sf.SetMetrics(registry)
+		sf.SetClock(func() time.Time { return *now })
+		moduleConfig := &interfaces.ModuleConfig{Name: "spend-forecast", Config: config}
+		if err := sf.ValidateConfig(moduleConfig); err != nil {
+			t.Fatalf("Invalid config: %v", err)
+		}
+		if err := sf.Initialize(ctx, moduleConfig); err != nil {
+			t.Fatalf("Failed to initialize spend forecast: %v", err)
+		}
+		sf.Start(ctx)
+		return sf, registry
+	}
+	spend := func(t *testing.T, sf *spendforecast.SpendForecast, tenantID string, cost float64) map[string]interface{} {
+		t.Helper()
+		result, err := sf.ProcessResponse(ctx, &interfaces.ProcessResponseContext{
+			ProcessRequestContext: &interfaces.ProcessRequestContext{RequestID: "forecast-" + tenantID, TenantID: tenantID},
+			CostUSD:               cost,
+		})
+		if err != nil {
+			t.Fatalf("Spend forecast failed: %v", err)
+		}
+		return result.Annotations
+	}
+
+	t.Run("TrendOvershootsBudget", func(t *testing.T) {
+		now := periodStart
+		sf, registry := newForecast(t, &now, map[string]interface{}{
+			"budget_usd":     5000.0,
+			"tenant_budgets": map[string]interface{}{"acme": 1000},
+		})
+
+		// Ten days at $20 a day stay on track for October's $1000 budget...
+		for day := 1; day <= 10; day++ {
+			now = periodStart.AddDate(0, 0, day)
+			if annotations := spend(t, sf, "acme", 20); annotations["spend_forecast_exceeded"] != nil {
+				t.Fatalf("Expected no forecast overrun on day %d, got %v", day, annotations)
+			}
+		}
+		forecast, ok := sf.Forecast("acme")
+		if !ok {
+			t.Fatal("Expected a forecast after ten days")
+		}
+		// $200 over 240 hours projected across the 744 hours of October
+		if math.Abs(forecast.ProjectedUSD-620) > 1e-9 || forecast.OverBudget || !forecast.ExhaustsAt.IsZero() {
+			t.Errorf("Expected $620 projected within budget, got %+v", forecast)
+		}
+
+		// ...until spend jumps to $100 a day
+		now = periodStart.AddDate(0, 0, 11)
+		spend(t, sf, "acme", 100)
+		now = periodStart.AddDate(0, 0, 12)
+		annotations := spend(t, sf, "acme", 100)
+
+		forecast, _ = sf.Forecast("acme")
+		if forecast.SpendUSD != 400 || forecast.BudgetUSD != 1000 {
+			t.Fatalf("Expected $400 spent of a $1000 budget, got %+v", forecast)
+		}
+		if math.Abs(forecast.ProjectedUSD-400.0*744/288) > 1e-9 || !forecast.OverBudget {
+			t.Errorf("Expected the projection to overshoot the budget, got %+v", forecast)
+		}
+		// $600 left at $400 per 288 hours lasts 432 hours
+		if want := time.Date(2026, time.October, 31, 0, 0, 0, 0, time.UTC); !forecast.ExhaustsAt.Equal(want) {
+			t.Errorf("Expected the budget exhausted at %v, got %v", want, forecast.ExhaustsAt)
+		}
+		if annotations["spend_forecast_exceeded"] != true || annotations["budget_exhausted_at"] != "2026-10-31T00:00:00Z" {
+			t.Errorf("Expected the overrun annotated, got %v", annotations)
+		}
+		if got := testutil.ToFloat64(registry.ProjectedSpend.WithLabelValues("acme")); math.Abs(got-forecast.ProjectedUSD) > 1e-9 {
+			t.Errorf("Expected the projected spend gauge at %v, got %v", forecast.ProjectedUSD, got)
+		}
+
+		// The alert fires once per period
+		now = periodStart.AddDate(0, 0, 13)
+		spend(t, sf, "acme", 100)
+		if got := testutil.ToFloat64(registry.SpendForecastAlerts.WithLabelValues("acme")); got != 1 {
+			t.Errorf("Expected one forecast alert, got %v", got)
+		}
+
+		// November starts afresh
+		now = time.Date(2026, time.November, 2, 0, 0, 0, 0, time.UTC)
+		annotations = spend(t, sf, "acme", 10)
+		forecast, _ = sf.Forecast("acme")
+		if forecast.SpendUSD != 10 || forecast.OverBudget || annotations["spend_forecast_exceeded"] != nil {
+			t.Errorf("Expected a new period within budget, got %+v", forecast)
+		}
+	})
+
+	t.Run("NoProjectionWithoutHistory", func(t *testing.T) {
+		now := periodStart.Add(10 * 24 * time.Hour)
+		sf, registry := newForecast(t, &now, map[string]interface{}{"budget_usd": 100, "min_elapsed": "24h"})
+
+		// Tracking began on the 11th, so a burst an hour later is not a trend
+		now = now.Add(time.Hour)
+		if annotations := spend(t, sf, "acme", 50); annotations != nil {
+			t.Errorf("Expected no projection before min_elapsed, got %v", annotations)
+		}
+		if _, ok := sf.Forecast("acme"); ok {
+			t.Error("Expected no forecast before min_elapsed")
+		}
+
+		// A day in, $50 over 24 hours projects to $50 + $2.08/h over the
+		// remaining 20 days
+		now = now.Add(23 * time.Hour)
+		forecast, ok := sf.Forecast("acme")
+		if !ok || math.Abs(forecast.ProjectedUSD-(50+50.0/24*20*24)) > 1e-9 {
+			t.Errorf("Expected spend projected from when tracking began, got %+v", forecast)
+		}
+		if got := testutil.ToFloat64(registry.SpendForecastAlerts.WithLabelValues("acme")); got != 0 {
+			t.Errorf("Expected no alert from Forecast alone, got %v", got)
+		}
+	})
+
+	t.Run("CollapsedLabelsSumProjections", func(t *testing.T) {
+		registry := metrics.NewRegistry()
+		if err := registry.SetTenantLabelPolicy(metrics.TenantLabelPolicy{Mode: metrics.TenantLabelAllowlist}); err != nil {
+			t.Fatalf("Failed to set label policy: %v", err)
+		}
+		registry.RecordSpendForecast("acme", 300)
+		registry.RecordSpendForecast("globex", 200)
+		registry.RecordSpendForecast("acme", 400)
+
+		if got := testutil.ToFloat64(registry.ProjectedSpend.WithLabelValues("other")); got != 600 {
+			t.Errorf("Expected the shared series to sum both tenants' latest projections to 600, got %v", got)
+		}
+	})
+
+	t.Run("InvalidConfigRejected", func(t *testing.T) {
+		sf := spendforecast.NewSpendForecast(sugar)
+		for _, config := range []map[string]interface{}{
+			{"budget_usd": -1.0},
+			{"tenant_budgets": map[string]interface{}{"acme": "lots"}},
+			{"period": "quarterly"},
+			{"timezone": "Mars/Olympus_Mons"},
+			{"min_elapsed": "soon"},
+		} {
+			if err := sf.ValidateConfig(&interfaces.ModuleConfig{Name: "spend-forecast", Config: config}); err == nil {
+				t.Errorf("Expected %v to be rejected", config)
+			}
+		}
+	})
+}
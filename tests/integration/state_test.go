@@ -0,0 +1,211 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bendiamant/leash-gateway/internal/admin"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/costtracker"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/ratelimiter"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/registry"
+	"go.uber.org/zap"
+)
+
+func TestModuleStateExportImport(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	newLimiter := func(t *testing.T) *ratelimiter.RateLimiter {
+		rl := ratelimiter.NewRateLimiter(sugar)
+		if err := rl.Initialize(ctx, &interfaces.ModuleConfig{
+			Name: "rate-limiter", Enabled: true,
+			Config: map[string]interface{}{"burst_size": 10, "refill_rate": 1},
+		}); err != nil {
+			t.Fatalf("Failed to initialize rate limiter: %v", err)
+		}
+		rl.Start(ctx)
+		return rl
+	}
+	newTracker := func(t *testing.T) *costtracker.CostTracker {
+		ct := costtracker.NewCostTracker(sugar)
+		if err := ct.Initialize(ctx, &interfaces.ModuleConfig{Name: "cost-tracker", Enabled: true}); err != nil {
+			t.Fatalf("Failed to initialize cost tracker: %v", err)
+		}
+		return ct
+	}
+
+	t.Run("RateLimiterRoundTrip", func(t *testing.T) {
+		source := newLimiter(t)
+		for i := 0; i < 4; i++ {
+			rateLimitRequest(t, source, "tenant-a")
+		}
+
+		state, err := source.ExportState()
+		if err != nil {
+			t.Fatalf("Failed to export state: %v", err)
+		}
+
+		target := newLimiter(t)
+		if err := target.ImportState(state); err != nil {
+			t.Fatalf("Failed to import state: %v", err)
+		}
+		reexported, err := target.ExportState()
+		if err != nil {
+			t.Fatalf("Failed to export imported state: %v", err)
+		}
+		if !bytes.Equal(state, reexported) {
+			t.Errorf("Expected identical state after round trip:\n%s\n%s", state, reexported)
+		}
+
+		// 6 tokens carried over, so the next request leaves 5
+		result := rateLimitRequest(t, target, "tenant-a")
+		if remaining := result.Annotations["tokens_remaining"]; remaining != int64(5) {
+			t.Errorf("Expected imported bucket to have 5 remaining, got %v", remaining)
+		}
+	})
+
+	t.Run("CostTrackerRoundTrip", func(t *testing.T) {
+		source := newTracker(t)
+		trackCost(t, source, "tenant-a", 1.25)
+		trackCost(t, source, "tenant-b", 0.5)
+
+		state, err := source.ExportState()
+		if err != nil {
+			t.Fatalf("Failed to export state: %v", err)
+		}
+
+		target := newTracker(t)
+		if err := target.ImportState(state); err != nil {
+			t.Fatalf("Failed to import state: %v", err)
+		}
+		reexported, err := target.ExportState()
+		if err != nil {
+			t.Fatalf("Failed to export imported state: %v", err)
+		}
+		if !bytes.Equal(state, reexported) {
+			t.Errorf("Expected identical state after round trip:\n%s\n%s", state, reexported)
+		}
+	})
+
+	t.Run("InvalidStateRejected", func(t *testing.T) {
+		rl := newLimiter(t)
+		ct := newTracker(t)
+		cases := []struct {
+			name   string
+			module interfaces.StatefulModule
+			state  string
+		}{
+			{"UnknownVersion", rl, `{"version": 2, "buckets": {}}`},
+			{"TokensOverCapacity", rl, `{"version": 1, "buckets": {"tenant-a:openai": {"capacity": 10, "tokens": 11, "refill_rate": 1, "last_refill": "2026-01-01T00:00:00Z"}}}`},
+			{"MissingRefillTime", rl, `{"version": 1, "buckets": {"tenant-a:openai": {"capacity": 10, "tokens": 5, "refill_rate": 1}}}`},
+			{"MismatchedTenant", ct, `{"version": 1, "usage": {"tenant-a": {"tenant_id": "tenant-b"}}}`},
+			{"NegativeCost", ct, `{"version": 1, "usage": {"tenant-a": {"tenant_id": "tenant-a", "total_cost": -1}}}`},
+			{"Malformed", ct, `{"version": 1, "usage": [`},
+		}
+		for _, tc := range cases {
+			if err := tc.module.ImportState(json.RawMessage(tc.state)); err == nil {
+				t.Errorf("%s: expected import to fail", tc.name)
+			}
+		}
+	})
+
+	t.Run("AdminEndpoint", func(t *testing.T) {
+		source := registry.NewModuleRegistry(sugar)
+		rl := newLimiter(t)
+		for _, module := range []interfaces.Module{rl, newTracker(t), newStubModule("stub", interfaces.ModuleTypePolicy)} {
+			if err := source.Register(module); err != nil {
+				t.Fatalf("Failed to register %s: %v", module.Name(), err)
+			}
+		}
+		rateLimitRequest(t, rl, "tenant-a")
+
+		tokenHash := sha256.Sum256([]byte("admin-secret"))
+		auth := admin.NewTokenAuth([]string{hex.EncodeToString(tokenHash[:])})
+		server := httptest.NewServer(auth.Require(source.StateHandler()))
+		defer server.Close()
+		send := func(method, url string, body io.Reader, token string) *http.Response {
+			t.Helper()
+			req, _ := http.NewRequest(method, url, body)
+			req.Header.Set("Content-Type", "application/json")
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("State request failed: %v", err)
+			}
+			return resp
+		}
+
+		resp := send(http.MethodGet, server.URL, nil, "")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("Expected exporting state without a token to be unauthorized, got %d", resp.StatusCode)
+		}
+
+		resp = send(http.MethodGet, server.URL, nil, "admin-secret")
+		var snapshot registry.Snapshot
+		json.NewDecoder(resp.Body).Decode(&snapshot)
+		resp.Body.Close()
+		if len(snapshot.Modules) != 2 || snapshot.Modules["rate-limiter"] == nil || snapshot.Modules["cost-tracker"] == nil {
+			t.Fatalf("Expected rate limiter and cost tracker state, got %v", snapshot.Modules)
+		}
+
+		target := registry.NewModuleRegistry(sugar)
+		imported := newLimiter(t)
+		target.Register(imported)
+		target.Register(newTracker(t))
+		importServer := httptest.NewServer(auth.Require(target.StateHandler()))
+		defer importServer.Close()
+
+		body, _ := json.Marshal(snapshot)
+		resp = send(http.MethodPost, importServer.URL, bytes.NewReader(body), "")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("Expected importing state without a token to be unauthorized, got %d", resp.StatusCode)
+		}
+		resp = send(http.MethodPost, importServer.URL, bytes.NewReader(body), "admin-secret")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("Expected 204 from import, got %d", resp.StatusCode)
+		}
+		result := rateLimitRequest(t, imported, "tenant-a")
+		if remaining := result.Annotations["tokens_remaining"]; remaining != int64(8) {
+			t.Errorf("Expected imported bucket to have 8 remaining, got %v", remaining)
+		}
+
+		// Modules without exportable state are rejected
+		resp = send(http.MethodPost, importServer.URL, bytes.NewReader([]byte(`{"modules": {"stub": {}}}`)), "admin-secret")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected 400 for unknown module, got %d", resp.StatusCode)
+		}
+
+		// Oversized snapshots are refused before they are decoded
+		oversized := io.MultiReader(strings.NewReader(`{"modules": {"rate-limiter": "`), bytes.NewReader(bytes.Repeat([]byte("a"), 64<<20)))
+		resp = send(http.MethodPost, importServer.URL, oversized, "admin-secret")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected 413 for an oversized snapshot, got %d", resp.StatusCode)
+		}
+
+		resp = send(http.MethodGet, server.URL+"?module=stub", nil, "admin-secret")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected 404 for a module without state, got %d", resp.StatusCode)
+		}
+	})
+}
@@ -0,0 +1,574 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/providers"
+	"github.com/bendiamant/leash-gateway/internal/providers/base"
+	"github.com/bendiamant/leash-gateway/internal/providers/stream"
+	"go.uber.org/zap"
+)
+
+// The same completion as each provider streams it
+const (
+	openAIStream = `data: {"id":"c1","choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}
+
+data: {"id":"c1","choices":[{"index":0,"delta":{"content":"Hello"}}]}
+
+data: {"id":"c1","choices":[{"index":0,"delta":{"content":", world"}}]}
+
+data: {"id":"c1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}
+
+data: {"id":"c1","choices":[],"usage":{"prompt_tokens":12,"completion_tokens":3,"total_tokens":15}}
+
+data: [DONE]
+
+`
+	anthropicStream = `event: message_start
+data: {"type":"message_start","message":{"id":"m1","role":"assistant","usage":{"input_tokens":12,"output_tokens":1}}}
+
+event: content_block_start
+data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}
+
+event: ping
+data: {"type":"ping"}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":", world"}}
+
+event: content_block_stop
+data: {"type":"content_block_stop","index":0}
+
+event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":3}}
+
+event: message_stop
+data: {"type":"message_stop"}
+
+`
+)
+
+// canonicalEvents decodes a canonical stream and reports whether it completed
+func canonicalEvents(t *testing.T, data []byte) ([]stream.Event, bool) {
+	t.Helper()
+
+	var events []stream.Event
+	done := false
+	for _, block := range strings.Split(strings.TrimSpace(string(data)), "\n\n") {
+		payload, ok := strings.CutPrefix(block, "data: ")
+		if !ok {
+			t.Fatalf("Expected only data events, got %q", block)
+		}
+		if payload == "[DONE]" {
+			done = true
+			continue
+		}
+		if done {
+			t.Fatalf("Expected [DONE] to end the stream, got %q after it", payload)
+		}
+		var event stream.Event
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			t.Fatalf("Invalid canonical event %q: %v", payload, err)
+		}
+		events = append(events, event)
+	}
+	return events, done
+}
+
+func TestStreamNormalization(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+
+	// normalize feeds a provider stream through a normalizer in pieces of the
+	// given size, so events split across chunks are exercised
+	normalize := func(t *testing.T, source, raw string, size int) []byte {
+		t.Helper()
+		normalizer, err := stream.NewNormalizer(source)
+		if err != nil {
+			t.Fatalf("Failed to create normalizer: %v", err)
+		}
+		var out []byte
+		for start := 0; start < len(raw); start += size {
+			end := start + size
+			if end > len(raw) {
+				end = len(raw)
+			}
+			out = append(out, normalizer.Normalize([]byte(raw[start:end]))...)
+		}
+		return append(out, normalizer.Flush()...)
+	}
+
+	t.Run("ProvidersNormalizeToEquivalentEvents", func(t *testing.T) {
+		expected := []stream.Event{
+			{Delta: "Hello"},
+			{Delta: ", world"},
+			{FinishReason: "stop"},
+			{Usage: &base.TokenUsage{PromptTokens: 12, CompletionTokens: 3, TotalTokens: 15}},
+		}
+
+		for _, source := range []struct{ name, raw string }{
+			{stream.SourceOpenAI, openAIStream},
+			{stream.SourceAnthropic, anthropicStream},
+		} {
+			for _, size := range []int{1, 7, len(source.raw)} {
+				events, done := canonicalEvents(t, normalize(t, source.name, source.raw, size))
+				if !done {
+					t.Errorf("%s (%d byte chunks): expected the canonical stream to complete", source.name, size)
+				}
+				if !reflect.DeepEqual(events, expected) {
+					t.Errorf("%s (%d byte chunks): expected %+v, got %+v", source.name, size, expected, events)
+				}
+			}
+		}
+	})
+
+	t.Run("ErrorsNormalize", func(t *testing.T) {
+		anthropicError := "event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}\n\n"
+		events, done := canonicalEvents(t, normalize(t, stream.SourceAnthropic, anthropicError, 5))
+		if done || len(events) != 1 || events[0].Error == nil || events[0].Error.Message != "Overloaded" {
+			t.Errorf("Expected an incomplete stream ending in the provider error, got %+v", events)
+		}
+
+		gatewayError := string(base.StreamErrorEvent(base.ErrStreamInterrupted))
+		events, _ = canonicalEvents(t, normalize(t, stream.SourceOpenAI, gatewayError, 3))
+		if len(events) != 1 || events[0].Error == nil || events[0].Error.Type != "stream_error" {
+			t.Errorf("Expected the gateway's stream error to carry through, got %+v", events)
+		}
+	})
+
+	t.Run("NormalizeStreamKeepsFinalChunk", func(t *testing.T) {
+		in := make(chan base.StreamChunk, 4)
+		raw := []byte(anthropicStream)
+		in <- base.StreamChunk{Data: raw[:100]}
+		in <- base.StreamChunk{Data: raw[100:]}
+		in <- base.StreamChunk{Done: true, Cost: 0.5, Usage: &base.TokenUsage{TotalTokens: 15}}
+		close(in)
+
+		normalizer, _ := stream.NewNormalizer(stream.SourceAnthropic)
+		var data []byte
+		var final base.StreamChunk
+		for chunk := range stream.Normalize(in, normalizer) {
+			data = append(data, chunk.Data...)
+			if chunk.Done {
+				final = chunk
+			}
+		}
+		if !final.Done || final.Cost != 0.5 || final.Usage == nil {
+			t.Errorf("Expected the final chunk's usage and cost to pass through, got %+v", final)
+		}
+		if events, done := canonicalEvents(t, data); !done || len(events) != 4 {
+			t.Errorf("Expected the full canonical stream, got %+v", events)
+		}
+	})
+
+	t.Run("ProviderStreamFormat", func(t *testing.T) {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte(openAIStream))
+		}))
+		defer upstream.Close()
+
+		config := func(format string) *base.ProviderConfig {
+			return &base.ProviderConfig{
+				Type:         "openai",
+				Endpoint:     upstream.URL,
+				Timeout:      5 * time.Second,
+				StreamFormat: format,
+				CircuitBreaker: base.CircuitBreakerConfig{
+					FailureThreshold: 50,
+					MinRequests:      10,
+					Timeout:          time.Minute,
+				},
+				Models: []base.ModelConfig{{Name: "gpt-4o-mini"}},
+			}
+		}
+		registry := providers.NewRegistry(sugar)
+		if err := registry.InitializeFromConfig(map[string]*base.ProviderConfig{
+			"canonical":   config(stream.FormatCanonical),
+			"passthrough": config(""),
+		}); err != nil {
+			t.Fatalf("Failed to initialize providers: %v", err)
+		}
+
+		read := func(t *testing.T, name string) ([]byte, *base.StreamingResponse) {
+			t.Helper()
+			provider, err := registry.Get(name)
+			if err != nil {
+				t.Fatalf("Failed to get provider %s: %v", name, err)
+			}
+			resp, err := provider.ProcessStreamingRequest(context.Background(), &base.ProviderRequest{
+				RequestID: "stream-format", Model: "gpt-4o-mini", Streaming: true,
+				Messages: []base.Message{{Role: "user", Content: "hi"}},
+			})
+			if err != nil {
+				t.Fatalf("Streaming request failed: %v", err)
+			}
+			var data []byte
+			for chunk := range resp.Stream {
+				data = append(data, chunk.Data...)
+			}
+			return data, resp
+		}
+
+		data, resp := read(t, "canonical")
+		if resp.Metadata[stream.FormatMetadata] != stream.FormatCanonical {
+			t.Errorf("Expected the canonical stream format in metadata, got %v", resp.Metadata)
+		}
+		if events, done := canonicalEvents(t, data); !done || len(events) != 4 || events[0].Delta != "Hello" {
+			t.Errorf("Expected canonical events from the provider, got %+v", events)
+		}
+
+		data, _ = read(t, "passthrough")
+		if !bytes.Equal(data, []byte(openAIStream)) {
+			t.Errorf("Expected passthrough to return the provider's own stream, got %q", data)
+		}
+	})
+
+	t.Run("UnknownFormatRejected", func(t *testing.T) {
+		registry := providers.NewRegistry(sugar)
+		err := registry.InitializeFromConfig(map[string]*base.ProviderConfig{
+			"openai": {Endpoint: "http://localhost", StreamFormat: "ndjson"},
+		})
+		if err == nil {
+			t.Error("Expected an unknown stream format to be rejected")
+		}
+	})
+}
+
+func TestStreamKeepalive(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+
+	// keepalives intersperses SSE comments, as providers and proxies send
+	// them, between the events of a stream
+	keepalives := func(raw string) string {
+		events := strings.SplitAfter(raw, "\n\n")
+		return ": ping\n\n" + strings.Join(events, ":\n\n: keepalive 2026-10-16T00:00:00Z\r\n\r\n")
+	}
+
+	t.Run("ProviderKeepalivesIgnored", func(t *testing.T) {
+		expected := []stream.Event{
+			{Delta: "Hello"},
+			{Delta: ", world"},
+			{FinishReason: "stop"},
+			{Usage: &base.TokenUsage{PromptTokens: 12, CompletionTokens: 3, TotalTokens: 15}},
+		}
+		for _, source := range []struct{ name, raw string }{
+			{stream.SourceOpenAI, openAIStream},
+			{stream.SourceAnthropic, anthropicStream},
+		} {
+			raw := keepalives(source.raw)
+			for _, size := range []int{1, 9, len(raw)} {
+				normalizer, _ := stream.NewNormalizer(source.name)
+				var out []byte
+				for start := 0; start < len(raw); start += size {
+					end := start + size
+					if end > len(raw) {
+						end = len(raw)
+					}
+					out = append(out, normalizer.Normalize([]byte(raw[start:end]))...)
+				}
+				out = append(out, normalizer.Flush()...)
+
+				events, done := canonicalEvents(t, out)
+				if !done || !reflect.DeepEqual(events, expected) {
+					t.Errorf("%s (%d byte chunks): expected %+v, got %+v", source.name, size, expected, events)
+				}
+			}
+		}
+	})
+
+	t.Run("UsageIgnoresKeepalives", func(t *testing.T) {
+		usage := base.NewStreamUsage(&base.ProviderRequest{Messages: []base.Message{{Role: "user", Content: "hi"}}})
+		usage.Observe([]byte(keepalives(openAIStream)))
+		reported, estimated := usage.Usage()
+		if !usage.Done() || estimated || reported.TotalTokens != 15 {
+			t.Errorf("Expected the provider's usage despite keepalives, got %+v (estimated %t)", reported, estimated)
+		}
+	})
+
+	t.Run("HeartbeatBetweenEvents", func(t *testing.T) {
+		in := make(chan base.StreamChunk)
+		out := stream.Heartbeat(in, 20*time.Millisecond)
+
+		var data []byte
+		receive := func() base.StreamChunk {
+			chunk := <-out
+			data = append(data, chunk.Data...)
+			return chunk
+		}
+
+		// An idle upstream before the first event gets heartbeats
+		if chunk := receive(); !bytes.Equal(chunk.Data, stream.HeartbeatComment) {
+			t.Fatalf("Expected a heartbeat while waiting for the first event, got %q", chunk.Data)
+		}
+
+		// None inside an event split across chunks
+		raw := []byte(openAIStream)
+		in <- base.StreamChunk{Data: raw[:40]}
+		receive()
+		select {
+		case chunk := <-out:
+			t.Fatalf("Expected no heartbeat mid-event, got %q", chunk.Data)
+		case <-time.After(60 * time.Millisecond):
+		}
+
+		in <- base.StreamChunk{Data: raw[40:]}
+		receive()
+		if chunk := receive(); !bytes.Equal(chunk.Data, stream.HeartbeatComment) {
+			t.Fatalf("Expected a heartbeat once the event completed, got %q", chunk.Data)
+		}
+
+		in <- base.StreamChunk{Done: true, Usage: &base.TokenUsage{TotalTokens: 15}}
+		if final := receive(); !final.Done || final.Usage == nil {
+			t.Errorf("Expected the final chunk to pass through, got %+v", final)
+		}
+		if _, open := <-out; open {
+			t.Error("Expected the stream to end after its final chunk")
+		}
+
+		// Heartbeats are comments, so the events and their order are intact
+		events, done := canonicalEvents(t, normalizeAll(t, stream.SourceOpenAI, data))
+		if !done || len(events) != 4 || events[0].Delta != "Hello" {
+			t.Errorf("Expected every event intact around heartbeats, got %+v", events)
+		}
+	})
+
+	t.Run("ProviderStreamHeartbeat", func(t *testing.T) {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			events := strings.SplitAfter(openAIStream, "\n\n")
+			w.Write([]byte(events[0]))
+			w.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond) // a long generation
+			w.Write([]byte(strings.Join(events[1:], "")))
+		}))
+		defer upstream.Close()
+
+		registry := providers.NewRegistry(sugar)
+		if err := registry.InitializeFromConfig(map[string]*base.ProviderConfig{
+			"openai": {
+				Endpoint:        upstream.URL,
+				Timeout:         5 * time.Second,
+				StreamFormat:    stream.FormatCanonical,
+				StreamHeartbeat: 20 * time.Millisecond,
+				CircuitBreaker:  base.CircuitBreakerConfig{FailureThreshold: 50, MinRequests: 10, Timeout: time.Minute},
+				Models:          []base.ModelConfig{{Name: "gpt-4o-mini"}},
+			},
+		}); err != nil {
+			t.Fatalf("Failed to initialize providers: %v", err)
+		}
+		provider, _ := registry.Get("openai")
+		resp, err := provider.ProcessStreamingRequest(context.Background(), &base.ProviderRequest{
+			RequestID: "stream-heartbeat", Model: "gpt-4o-mini", Streaming: true,
+			Messages: []base.Message{{Role: "user", Content: "hi"}},
+		})
+		if err != nil {
+			t.Fatalf("Streaming request failed: %v", err)
+		}
+
+		var data []byte
+		for chunk := range resp.Stream {
+			data = append(data, chunk.Data...)
+		}
+		if !bytes.Contains(data, stream.HeartbeatComment) {
+			t.Errorf("Expected heartbeats during the pause, got %q", data)
+		}
+		events, done := canonicalEvents(t, bytes.ReplaceAll(data, stream.HeartbeatComment, nil))
+		if !done || len(events) != 4 {
+			t.Errorf("Expected the canonical events alongside heartbeats, got %+v", events)
+		}
+	})
+
+	t.Run("NegativeHeartbeatRejected", func(t *testing.T) {
+		registry := providers.NewRegistry(sugar)
+		err := registry.InitializeFromConfig(map[string]*base.ProviderConfig{
+			"openai": {Endpoint: "http://localhost", StreamHeartbeat: -time.Second},
+		})
+		if err == nil {
+			t.Error("Expected a negative stream heartbeat to be rejected")
+		}
+	})
+}
+
+func TestStreamDeadline(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+
+	// streamFrom streams a request to an upstream through a provider with the
+	// given stream limits, returning every chunk
+	streamFrom := func(t *testing.T, upstream *httptest.Server, config base.ProviderConfig) []base.StreamChunk {
+		t.Helper()
+		config.Endpoint = upstream.URL
+		config.CircuitBreaker = base.CircuitBreakerConfig{FailureThreshold: 50, MinRequests: 10, Timeout: time.Minute}
+		config.Models = []base.ModelConfig{{Name: "gpt-4o-mini"}}
+
+		registry := providers.NewRegistry(sugar)
+		if err := registry.InitializeFromConfig(map[string]*base.ProviderConfig{"openai": &config}); err != nil {
+			t.Fatalf("Failed to initialize providers: %v", err)
+		}
+		provider, _ := registry.Get("openai")
+		resp, err := provider.ProcessStreamingRequest(context.Background(), &base.ProviderRequest{
+			RequestID: "stream-deadline", Model: "gpt-4o-mini", Streaming: true,
+			Messages: []base.Message{{Role: "user", Content: "hi"}},
+		})
+		if err != nil {
+			t.Fatalf("Streaming request failed: %v", err)
+		}
+
+		var chunks []base.StreamChunk
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case chunk, ok := <-resp.Stream:
+				if !ok {
+					return chunks
+				}
+				chunks = append(chunks, chunk)
+			case <-timeout:
+				t.Fatalf("Expected the stream to end, still open after %d chunks", len(chunks))
+			}
+		}
+	}
+	// hung is an upstream that sends the first event, then nothing until the
+	// connection is closed, which it reports on closed
+	hung := func(closed chan<- struct{}) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte(strings.SplitAfter(openAIStream, "\n\n")[1]))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			close(closed)
+		}))
+	}
+	expectTerminalError := func(t *testing.T, chunks []base.StreamChunk, expected error) {
+		t.Helper()
+		final := chunks[len(chunks)-1]
+		if !final.Done || !errors.Is(final.Error, expected) {
+			t.Fatalf("Expected a final chunk failing with %v, got %+v", expected, final)
+		}
+		if !bytes.Contains(final.Data, []byte(`"type":"stream_error"`)) {
+			t.Errorf("Expected a terminal error event for the client, got %q", final.Data)
+		}
+		if final.Usage == nil || final.Usage.CompletionTokens == 0 || final.Metadata[base.PartialUsageMetadata] != "true" {
+			t.Errorf("Expected partial usage for the output delivered, got %+v (%v)", final.Usage, final.Metadata)
+		}
+	}
+
+	t.Run("IdleTimeoutEndsHungStream", func(t *testing.T) {
+		closed := make(chan struct{})
+		upstream := hung(closed)
+		defer upstream.Close()
+
+		// Heartbeats keep the client connection open but do not count as
+		// provider data
+		chunks := streamFrom(t, upstream, base.ProviderConfig{
+			Timeout:           time.Minute,
+			StreamHeartbeat:   10 * time.Millisecond,
+			StreamIdleTimeout: 100 * time.Millisecond,
+		})
+		expectTerminalError(t, chunks, base.ErrStreamIdleTimeout)
+		var data []byte
+		for _, chunk := range chunks {
+			data = append(data, chunk.Data...)
+		}
+		if !bytes.Contains(data, []byte("Hello")) {
+			t.Errorf("Expected the data sent before the stall to be delivered, got %q", data)
+		}
+
+		select {
+		case <-closed:
+		case <-time.After(time.Second):
+			t.Error("Expected the upstream connection to be closed")
+		}
+	})
+
+	t.Run("MaxDurationEndsTricklingStream", func(t *testing.T) {
+		// Keepalives arrive well within the idle timeout, forever
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte(strings.SplitAfter(openAIStream, "\n\n")[1]))
+			for {
+				w.Write([]byte(": keepalive\n\n"))
+				w.(http.Flusher).Flush()
+				select {
+				case <-r.Context().Done():
+					return
+				case <-time.After(10 * time.Millisecond):
+				}
+			}
+		}))
+		defer upstream.Close()
+
+		start := time.Now()
+		chunks := streamFrom(t, upstream, base.ProviderConfig{
+			Timeout:           time.Minute,
+			StreamIdleTimeout: time.Second,
+			StreamMaxDuration: 150 * time.Millisecond,
+		})
+		expectTerminalError(t, chunks, base.ErrStreamMaxDuration)
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Expected the stream to end at its maximum duration, took %v", elapsed)
+		}
+	})
+
+	t.Run("SlowStreamWithinLimitsCompletes", func(t *testing.T) {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			events := strings.SplitAfter(openAIStream, "\n\n")
+			for _, event := range events {
+				w.Write([]byte(event))
+				w.(http.Flusher).Flush()
+				time.Sleep(30 * time.Millisecond)
+			}
+		}))
+		defer upstream.Close()
+
+		chunks := streamFrom(t, upstream, base.ProviderConfig{
+			Timeout:           time.Minute,
+			StreamIdleTimeout: 200 * time.Millisecond,
+			StreamMaxDuration: 5 * time.Second,
+		})
+		final := chunks[len(chunks)-1]
+		if !final.Done || final.Error != nil || final.Usage == nil || final.Usage.TotalTokens != 15 {
+			t.Errorf("Expected the stream to complete with the provider's usage, got %+v", final)
+		}
+	})
+
+	t.Run("NegativeLimitsRejected", func(t *testing.T) {
+		for _, config := range []*base.ProviderConfig{
+			{Endpoint: "http://localhost", StreamIdleTimeout: -time.Second},
+			{Endpoint: "http://localhost", StreamMaxDuration: -time.Second},
+		} {
+			registry := providers.NewRegistry(sugar)
+			if err := registry.InitializeFromConfig(map[string]*base.ProviderConfig{"openai": config}); err == nil {
+				t.Errorf("Expected negative stream limits to be rejected: %+v", config)
+			}
+		}
+	})
+}
+
+// normalizeAll normalizes a complete provider stream
+func normalizeAll(t *testing.T, source string, raw []byte) []byte {
+	t.Helper()
+	normalizer, err := stream.NewNormalizer(source)
+	if err != nil {
+		t.Fatalf("Failed to create normalizer: %v", err)
+	}
+	return append(normalizer.Normalize(raw), normalizer.Flush()...)
+}
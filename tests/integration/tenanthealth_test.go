@@ -0,0 +1,368 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/metrics"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/costtracker"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/tenanthealth"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/tenants"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+// healthSignals is a synthetic batch of one tenant's traffic
+type healthSignals struct {
+	requests    int
+	errors      int // responses answered 502
+	latency     time.Duration
+	rateLimited int // requests blocked by the rate limiter
+}
+
+// feedHealth plays signals through the tenant health module as the
+// pipeline would
+func feedHealth(t *testing.T, th *tenanthealth.TenantHealth, tenantID string, signals healthSignals) {
+	t.Helper()
+	ctx := context.Background()
+
+	for i := 0; i < signals.requests; i++ {
+		req := &interfaces.ProcessRequestContext{RequestID: "health-" + tenantID, TenantID: tenantID}
+		if i < signals.rateLimited {
+			th.ObserveBlock(ctx, req, &interfaces.ProcessRequestResult{
+				Action:      interfaces.ActionBlock,
+				BlockReason: "rate_limit_exceeded",
+			})
+			continue
+		}
+		if _, err := th.ProcessRequest(ctx, req); err != nil {
+			t.Fatalf("Tenant health failed: %v", err)
+		}
+		status := http.StatusOK
+		if i < signals.rateLimited+signals.errors {
+			status = http.StatusBadGateway
+		}
+		if _, err := th.ProcessResponse(ctx, &interfaces.ProcessResponseContext{
+			ProcessRequestContext: req,
+			StatusCode:            status,
+			TotalLatency:          signals.latency,
+		}); err != nil {
+			t.Fatalf("Tenant health failed: %v", err)
+		}
+	}
+}
+
+func TestTenantHealthScore(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	start := time.Date(2026, time.October, 16, 12, 0, 0, 0, time.UTC)
+
+	newHealth := func(t *testing.T, now *time.Time, config map[string]interface{}) (*tenanthealth.TenantHealth, *metrics.Registry) {
+		t.Helper()
+		th := tenanthealth.NewTenantHealth(sugar)
+		registry := metrics.NewRegistry()
+		th.SetMetrics(registry)
+		th.SetClock(func() time.Time { return *now })
+		moduleConfig := &interfaces.ModuleConfig{Name: "tenant-health", Config: config}
+		if err := th.ValidateConfig(moduleConfig); err != nil {
+			t.Fatalf("Invalid config: %v", err)
+		}
+		if err := th.Initialize(ctx, moduleConfig); err != nil {
+			t.Fatalf("Failed to initialize tenant health: %v", err)
+		}
+		th.Start(ctx)
+		return th, registry
+	}
+	scoreOf := func(t *testing.T, th *tenanthealth.TenantHealth, tenantID string) *tenanthealth.Score {
+		t.Helper()
+		score, ok := th.TenantScore(tenantID)
+		if !ok {
+			t.Fatalf("Expected tenant %s to be tracked", tenantID)
+		}
+		return score
+	}
+	healthy := healthSignals{requests: 20, latency: 500 * time.Millisecond}
+
+	t.Run("HealthyTenantScoresFully", func(t *testing.T) {
+		now := start
+		th, registry := newHealth(t, &now, nil)
+		feedHealth(t, th, "acme", healthy)
+
+		score := scoreOf(t, th, "acme")
+		if score.Score != 100 {
+			t.Errorf("Expected a healthy tenant to score 100, got %.2f (%v)", score.Score, score.Components)
+		}
+		if gauge := testutil.ToFloat64(registry.TenantHealthScore.WithLabelValues("acme")); gauge != 100 {
+			t.Errorf("Expected the health gauge at 100, got %.2f", gauge)
+		}
+	})
+
+	t.Run("DegradationInAnyComponentLowersScore", func(t *testing.T) {
+		cases := []struct {
+			name      string
+			component string
+			signals   healthSignals
+			proximity float64
+		}{
+			{"ErrorRate", tenanthealth.ComponentErrorRate, healthSignals{requests: 20, errors: 5, latency: 500 * time.Millisecond}, 0},
+			{"Latency", tenanthealth.ComponentLatency, healthSignals{requests: 20, latency: 8 * time.Second}, 0},
+			{"RateLimit", tenanthealth.ComponentRateLimit, healthSignals{requests: 20, rateLimited: 10, latency: 500 * time.Millisecond}, 0},
+			{"CostLimit", tenanthealth.ComponentCostLimit, healthy, 0.9},
+		}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				now := start
+				th, registry := newHealth(t, &now, nil)
+				th.SetCostSource(costProximity{"degraded": tc.proximity})
+				feedHealth(t, th, "baseline", healthy)
+				feedHealth(t, th, "degraded", tc.signals)
+
+				baseline, degraded := scoreOf(t, th, "baseline"), scoreOf(t, th, "degraded")
+				if degraded.Score >= baseline.Score {
+					t.Fatalf("Expected degraded %s to lower the score below %.2f, got %.2f", tc.component, baseline.Score, degraded.Score)
+				}
+				if degraded.Components[tc.component] >= 1 {
+					t.Errorf("Expected the %s component below 1, got %v", tc.component, degraded.Components)
+				}
+				for component, value := range degraded.Components {
+					if component != tc.component && value != 1 {
+						t.Errorf("Expected only %s to degrade, %s is %.2f", tc.component, component, value)
+					}
+				}
+				if gauge := testutil.ToFloat64(registry.TenantHealthScore.WithLabelValues("degraded")); gauge != degraded.Score {
+					t.Errorf("Expected the health gauge at %.2f, got %.2f", degraded.Score, gauge)
+				}
+			})
+		}
+	})
+
+	t.Run("ScoreIsWeightedMean", func(t *testing.T) {
+		now := start
+		th, _ := newHealth(t, &now, map[string]interface{}{
+			"latency_target": "1s",
+			"weights": map[string]interface{}{
+				"error_rate": 3,
+				"latency":    1,
+				"rate_limit": 0,
+				"cost_limit": 0,
+			},
+		})
+		// Half the responses fail and mean latency is twice the target
+		feedHealth(t, th, "acme", healthSignals{requests: 10, errors: 5, rateLimited: 0, latency: 2 * time.Second})
+
+		score := scoreOf(t, th, "acme")
+		expected := 100 * (3*0.5 + 1*0.5) / 4
+		if math.Abs(score.Score-expected) > 1e-9 {
+			t.Errorf("Expected score %.2f, got %.2f (%v)", expected, score.Score, score.Components)
+		}
+
+		// A zero weight leaves a component out entirely
+		feedHealth(t, th, "limited", healthSignals{requests: 10, rateLimited: 10})
+		if score := scoreOf(t, th, "limited"); score.Score != 100 {
+			t.Errorf("Expected rate limiting to be ignored at weight 0, got %.2f", score.Score)
+		}
+	})
+
+	t.Run("CostTrackerProximity", func(t *testing.T) {
+		ct := costtracker.NewCostTracker(sugar)
+		trackerConfig := &interfaces.ModuleConfig{
+			Name: "cost-tracker",
+			Config: map[string]interface{}{
+				"limits": map[string]interface{}{
+					"acme": map[string]interface{}{"daily_limit_usd": 10},
+				},
+			},
+		}
+		if err := ct.Initialize(ctx, trackerConfig); err != nil {
+			t.Fatalf("Failed to initialize cost tracker: %v", err)
+		}
+		trackCost(t, ct, "acme", 8)
+		if proximity := ct.LimitProximity("acme"); math.Abs(proximity-0.8) > 1e-9 {
+			t.Fatalf("Expected $8 of a $10 limit to be 0.8 of the way, got %.2f", proximity)
+		}
+		if proximity := ct.LimitProximity("unlimited"); proximity != 0 {
+			t.Errorf("Expected no proximity without limits, got %.2f", proximity)
+		}
+
+		now := start
+		th, _ := newHealth(t, &now, nil)
+		th.SetCostSource(ct)
+		feedHealth(t, th, "acme", healthy)
+		score := scoreOf(t, th, "acme")
+		if component := score.Components[tenanthealth.ComponentCostLimit]; math.Abs(component-0.2) > 1e-9 {
+			t.Errorf("Expected the cost component at 0.2, got %.2f", component)
+		}
+
+		trackCost(t, ct, "acme", 5)
+		if score := scoreOf(t, th, "acme"); score.Components[tenanthealth.ComponentCostLimit] != 0 {
+			t.Errorf("Expected an exceeded cost limit to zero the cost component, got %v", score.Components)
+		}
+	})
+
+	t.Run("CostLimitBlocksWithoutSource", func(t *testing.T) {
+		now := start
+		th, _ := newHealth(t, &now, nil)
+		feedHealth(t, th, "acme", healthy)
+		th.ObserveBlock(ctx, &interfaces.ProcessRequestContext{TenantID: "acme"}, &interfaces.ProcessRequestResult{
+			Action:      interfaces.ActionBlock,
+			BlockReason: "cost_limit_exceeded",
+		})
+		if score := scoreOf(t, th, "acme"); score.Components[tenanthealth.ComponentCostLimit] != 0 {
+			t.Errorf("Expected a cost limit block to zero the cost component, got %v", score.Components)
+		}
+	})
+
+	t.Run("RecoversAsSignalsExpire", func(t *testing.T) {
+		now := start
+		th, registry := newHealth(t, &now, map[string]interface{}{"window": "10m"})
+		feedHealth(t, th, "acme", healthSignals{requests: 10, errors: 10, latency: 500 * time.Millisecond})
+		if score := scoreOf(t, th, "acme"); score.Score >= 100 {
+			t.Fatalf("Expected failing requests to lower the score, got %.2f", score.Score)
+		}
+
+		now = start.Add(11 * time.Minute)
+		feedHealth(t, th, "acme", healthy)
+		if score := scoreOf(t, th, "acme"); score.Score != 100 {
+			t.Errorf("Expected errors outside the window to be forgotten, got %.2f (%v)", score.Score, score.Components)
+		}
+
+		now = start.Add(30 * time.Minute)
+		if _, ok := th.TenantScore("acme"); ok {
+			t.Error("Expected a tenant idle for the whole window to be forgotten")
+		}
+		if count := testutil.CollectAndCount(registry.TenantHealthScore); count != 0 {
+			t.Errorf("Expected the forgotten tenant's gauge to be removed, got %d series", count)
+		}
+	})
+
+	t.Run("Endpoint", func(t *testing.T) {
+		now := start
+		th, _ := newHealth(t, &now, nil)
+		feedHealth(t, th, "acme", healthy)
+		feedHealth(t, th, "globex", healthSignals{requests: 10, errors: 10, latency: 500 * time.Millisecond})
+
+		recorder := httptest.NewRecorder()
+		th.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/admin/tenant-health", nil))
+		var list struct {
+			Tenants []tenanthealth.Score `json:"tenants"`
+		}
+		if err := json.NewDecoder(recorder.Body).Decode(&list); err != nil {
+			t.Fatalf("Failed to decode scores: %v", err)
+		}
+		if len(list.Tenants) != 2 || list.Tenants[0].TenantID != "acme" || list.Tenants[1].TenantID != "globex" {
+			t.Fatalf("Expected scores for acme and globex, got %+v", list.Tenants)
+		}
+		if list.Tenants[1].Score >= list.Tenants[0].Score {
+			t.Errorf("Expected globex to score below acme, got %.2f and %.2f", list.Tenants[1].Score, list.Tenants[0].Score)
+		}
+
+		recorder = httptest.NewRecorder()
+		th.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/admin/tenant-health?tenant=globex", nil))
+		var score tenanthealth.Score
+		if err := json.NewDecoder(recorder.Body).Decode(&score); err != nil {
+			t.Fatalf("Failed to decode score: %v", err)
+		}
+		if score.TenantID != "globex" || score.Components[tenanthealth.ComponentErrorRate] != 0 {
+			t.Errorf("Expected globex's error rate component at 0, got %+v", score)
+		}
+
+		recorder = httptest.NewRecorder()
+		th.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/admin/tenant-health?tenant=initech", nil))
+		if recorder.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 for an untracked tenant, got %d", recorder.Code)
+		}
+	})
+
+	t.Run("CollapsedLabelsReportLowestScore", func(t *testing.T) {
+		now := start
+		th, registry := newHealth(t, &now, nil)
+		if err := registry.SetTenantLabelPolicy(metrics.TenantLabelPolicy{Mode: metrics.TenantLabelAllowlist}); err != nil {
+			t.Fatalf("Failed to set label policy: %v", err)
+		}
+		feedHealth(t, th, "globex", healthSignals{requests: 10, errors: 10, latency: 500 * time.Millisecond})
+		feedHealth(t, th, "acme", healthy)
+
+		degraded := scoreOf(t, th, "globex").Score
+		if gauge := testutil.ToFloat64(registry.TenantHealthScore.WithLabelValues("other")); gauge != degraded {
+			t.Errorf("Expected the shared gauge at globex's %.2f, got %.2f", degraded, gauge)
+		}
+
+		registry.ForgetTenantHealthScore("globex")
+		if gauge := testutil.ToFloat64(registry.TenantHealthScore.WithLabelValues("other")); gauge != 100 {
+			t.Errorf("Expected the shared gauge to keep acme's score after forgetting globex, got %.2f", gauge)
+		}
+		registry.ForgetTenantHealthScore("acme")
+		if count := testutil.CollectAndCount(registry.TenantHealthScore); count != 0 {
+			t.Errorf("Expected the shared gauge removed once no tenant uses it, got %d series", count)
+		}
+	})
+
+	t.Run("EndpointAnonymizesTenants", func(t *testing.T) {
+		now := start
+		th, _ := newHealth(t, &now, nil)
+		anonymizer, err := tenants.NewAnonymizer("health-salt", nil)
+		if err != nil {
+			t.Fatalf("Failed to create anonymizer: %v", err)
+		}
+		th.SetTenantAnonymizer(anonymizer)
+		feedHealth(t, th, "acme", healthy)
+
+		recorder := httptest.NewRecorder()
+		th.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/admin/tenant-health", nil))
+		var list struct {
+			Tenants []tenanthealth.Score `json:"tenants"`
+		}
+		if err := json.NewDecoder(recorder.Body).Decode(&list); err != nil {
+			t.Fatalf("Failed to decode scores: %v", err)
+		}
+		if len(list.Tenants) != 1 || list.Tenants[0].TenantID != anonymizer.TenantID("acme") {
+			t.Fatalf("Expected acme's pseudonym, got %+v", list.Tenants)
+		}
+
+		recorder = httptest.NewRecorder()
+		th.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/admin/tenant-health?tenant=acme", nil))
+		var score tenanthealth.Score
+		if err := json.NewDecoder(recorder.Body).Decode(&score); err != nil {
+			t.Fatalf("Failed to decode score: %v", err)
+		}
+		if score.TenantID != anonymizer.TenantID("acme") {
+			t.Errorf("Expected acme's pseudonym, got %s", score.TenantID)
+		}
+		if tracked, _ := th.TenantScore("acme"); tracked.TenantID != "acme" {
+			t.Errorf("Expected the tracked score to keep the tenant ID, got %s", tracked.TenantID)
+		}
+	})
+
+	t.Run("InvalidConfig", func(t *testing.T) {
+		th := tenanthealth.NewTenantHealth(sugar)
+		for _, config := range []map[string]interface{}{
+			{"window": "soon"},
+			{"latency_target": "0s"},
+			{"weights": map[string]interface{}{"error_rate": -1}},
+			{"weights": map[string]interface{}{"throughput": 1}},
+			{"weights": map[string]interface{}{"error_rate": 0, "latency": 0, "rate_limit": 0, "cost_limit": 0}},
+		} {
+			if err := th.ValidateConfig(&interfaces.ModuleConfig{Name: "tenant-health", Config: config}); err == nil {
+				t.Errorf("Expected config %v to be rejected", config)
+			}
+		}
+	})
+}
+
+// costProximity is a fixed cost-limit proximity per tenant
+type costProximity map[string]float64
+
+func (c costProximity) LimitProximity(tenantID string) float64 {
+	return c[tenantID]
+}
@@ -0,0 +1,465 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bendiamant/leash-gateway/internal/config"
+	"github.com/bendiamant/leash-gateway/internal/modulehost"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"github.com/bendiamant/leash-gateway/internal/tenants"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestConfigTenantStore(t *testing.T) {
+	ctx := context.Background()
+	store := tenants.NewConfigStore(map[string]config.Tenant{
+		"tenant-b": {Name: "Tenant B", APIKeys: []string{"key-b"}},
+		"tenant-a": {Name: "Tenant A", APIKeys: []string{"key-a1", "key-a2"}, DeniedModels: []string{"gpt-4o"}},
+	})
+
+	t.Run("GetTenant", func(t *testing.T) {
+		tenant, err := store.GetTenant(ctx, "tenant-a")
+		if err != nil {
+			t.Fatalf("Failed to get tenant: %v", err)
+		}
+		if tenant.ID != "tenant-a" || tenant.Name != "Tenant A" || len(tenant.DeniedModels) != 1 {
+			t.Errorf("Unexpected tenant: %+v", tenant)
+		}
+
+		if _, err := store.GetTenant(ctx, "missing"); !errors.Is(err, tenants.ErrTenantNotFound) {
+			t.Errorf("Expected ErrTenantNotFound, got %v", err)
+		}
+	})
+
+	t.Run("ListTenants", func(t *testing.T) {
+		list, err := store.ListTenants(ctx)
+		if err != nil {
+			t.Fatalf("Failed to list tenants: %v", err)
+		}
+		if len(list) != 2 || list[0].ID != "tenant-a" || list[1].ID != "tenant-b" {
+			t.Errorf("Expected tenants ordered by ID, got %+v", list)
+		}
+	})
+
+	t.Run("ResolveByAPIKey", func(t *testing.T) {
+		tenant, err := store.ResolveByAPIKey(ctx, "key-a2")
+		if err != nil {
+			t.Fatalf("Failed to resolve API key: %v", err)
+		}
+		if tenant.ID != "tenant-a" {
+			t.Errorf("Expected tenant-a, got %s", tenant.ID)
+		}
+
+		if _, err := store.ResolveByAPIKey(ctx, "key-x"); !errors.Is(err, tenants.ErrUnknownAPIKey) {
+			t.Errorf("Expected ErrUnknownAPIKey, got %v", err)
+		}
+	})
+}
+
+func TestDBTenantStore(t *testing.T) {
+	ctx := context.Background()
+	db := openMockTenantDB(t)
+	store := tenants.NewDBStore(db, "postgres")
+
+	t.Run("GetTenant", func(t *testing.T) {
+		tenant, err := store.GetTenant(ctx, "tenant-a")
+		if err != nil {
+			t.Fatalf("Failed to get tenant: %v", err)
+		}
+		if tenant.Name != "Tenant A" || tenant.Quotas.RequestsPerHour != 500 {
+			t.Errorf("Unexpected tenant: %+v", tenant)
+		}
+		if len(tenant.AllowedModels) != 1 || tenant.AllowedModels[0] != "gpt-4o*" {
+			t.Errorf("Expected settings to be decoded, got %+v", tenant.AllowedModels)
+		}
+
+		if _, err := store.GetTenant(ctx, "missing"); !errors.Is(err, tenants.ErrTenantNotFound) {
+			t.Errorf("Expected ErrTenantNotFound, got %v", err)
+		}
+	})
+
+	t.Run("ListTenants", func(t *testing.T) {
+		list, err := store.ListTenants(ctx)
+		if err != nil {
+			t.Fatalf("Failed to list tenants: %v", err)
+		}
+		if len(list) != 2 || list[0].ID != "tenant-a" || list[1].ID != "tenant-b" {
+			t.Errorf("Expected tenants ordered by ID, got %+v", list)
+		}
+	})
+
+	t.Run("ResolveByAPIKey", func(t *testing.T) {
+		tenant, err := store.ResolveByAPIKey(ctx, "key-b")
+		if err != nil {
+			t.Fatalf("Failed to resolve API key: %v", err)
+		}
+		if tenant.ID != "tenant-b" {
+			t.Errorf("Expected tenant-b, got %s", tenant.ID)
+		}
+
+		if _, err := store.ResolveByAPIKey(ctx, "key-x"); !errors.Is(err, tenants.ErrUnknownAPIKey) {
+			t.Errorf("Expected ErrUnknownAPIKey, got %v", err)
+		}
+	})
+
+	t.Run("Resolver", func(t *testing.T) {
+		resolver := tenants.NewResolver(store, config.APIKeysConfig{HeaderName: "Authorization", Prefix: "Bearer "})
+
+		tenant, err := resolver.Resolve(ctx, "", map[string]string{"authorization": "Bearer key-a"})
+		if err != nil || tenant.ID != "tenant-a" {
+			t.Errorf("Expected API key to resolve tenant-a, got %v, %v", tenant, err)
+		}
+
+		if _, err := resolver.Resolve(ctx, "tenant-b", map[string]string{"authorization": "Bearer key-a"}); !errors.Is(err, tenants.ErrTenantMismatch) {
+			t.Errorf("Expected ErrTenantMismatch, got %v", err)
+		}
+
+		tenant, err = resolver.Resolve(ctx, "tenant-b", map[string]string{})
+		if err != nil || tenant.ID != "tenant-b" {
+			t.Errorf("Expected tenant ID to resolve tenant-b, got %v, %v", tenant, err)
+		}
+
+		if _, err := resolver.Resolve(ctx, "", map[string]string{}); !errors.Is(err, tenants.ErrTenantRequired) {
+			t.Errorf("Expected ErrTenantRequired, got %v", err)
+		}
+	})
+
+	t.Run("PlaceholdersPerDriver", func(t *testing.T) {
+		for driver, placeholder := range map[string]string{"postgres": "= $1", "mysql": "= ?"} {
+			store := tenants.NewDBStore(db, driver)
+			mockTenantQueries = nil
+			if _, err := store.GetTenant(ctx, "tenant-a"); err != nil {
+				t.Fatalf("Failed to get tenant with %s placeholders: %v", driver, err)
+			}
+			if _, err := store.ResolveByAPIKey(ctx, "key-a"); err != nil {
+				t.Fatalf("Failed to resolve API key with %s placeholders: %v", driver, err)
+			}
+			for _, query := range mockTenantQueries {
+				if !strings.HasSuffix(query, placeholder) {
+					t.Errorf("Expected %s query to end in %q, got %q", driver, placeholder, query)
+				}
+			}
+		}
+	})
+}
+
+func TestModuleHostTenantResolution(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+
+	service := modulehost.NewService(pipeline.NewPipeline(sugar), sugar)
+	service.SetTenantResolver(tenants.NewResolver(tenants.NewConfigStore(map[string]config.Tenant{
+		"tenant-a": {Name: "Tenant A", APIKeys: []string{"key-a"}},
+	}), config.APIKeysConfig{HeaderName: "X-API-Key"}))
+
+	call := func(fields map[string]interface{}) (*structpb.Struct, error) {
+		req, err := structpb.NewStruct(fields)
+		if err != nil {
+			t.Fatalf("Failed to build request: %v", err)
+		}
+		return service.ProcessRequest(context.Background(), req)
+	}
+
+	if _, err := call(map[string]interface{}{"headers": map[string]interface{}{"X-API-Key": "key-a"}}); err != nil {
+		t.Errorf("Expected API key to resolve the tenant, got %v", err)
+	}
+	if _, err := call(map[string]interface{}{"headers": map[string]interface{}{"X-API-Key": "key-x"}}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated for unknown API key, got %v", err)
+	}
+	if _, err := call(map[string]interface{}{"tenant_id": "tenant-z"}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Expected PermissionDenied for unknown tenant, got %v", err)
+	}
+	if _, err := call(map[string]interface{}{}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument without tenant, got %v", err)
+	}
+}
+
+func TestModuleHostDefaultTenantRoutes(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+
+	service := modulehost.NewService(pipeline.NewPipeline(sugar), sugar)
+	service.SetTenantResolver(tenants.NewResolver(tenants.NewConfigStore(map[string]config.Tenant{
+		"system":   {Name: "System"},
+		"tenant-a": {Name: "Tenant A", APIKeys: []string{"key-a"}},
+	}), config.APIKeysConfig{HeaderName: "X-API-Key"}))
+	if err := service.SetDefaultTenantRoutes([]modulehost.DefaultTenantRoute{
+		{Method: "POST", Path: "/internal/**", Tenant: "system"},
+		{Method: "*", Path: "/jobs/*", Tenant: "tenant-gone"},
+	}); err != nil {
+		t.Fatalf("Failed to set default tenant routes: %v", err)
+	}
+
+	call := func(fields map[string]interface{}) (map[string]interface{}, error) {
+		req, err := structpb.NewStruct(fields)
+		if err != nil {
+			t.Fatalf("Failed to build request: %v", err)
+		}
+		resp, err := service.ProcessRequest(context.Background(), req)
+		if err != nil {
+			return nil, err
+		}
+		return resp.AsMap(), nil
+	}
+
+	// Internal routes without credentials get the system tenant
+	decision, err := call(map[string]interface{}{"method": "POST", "path": "/internal/reindex?full=1"})
+	if err != nil {
+		t.Fatalf("Expected the internal route to map to the system tenant, got %v", err)
+	}
+	if annotations, _ := decision["annotations"].(map[string]interface{}); annotations["tenant_defaulted"] != true {
+		t.Errorf("Expected the request annotated as defaulted, got %v", decision)
+	}
+
+	// Public routes without credentials are still rejected
+	for _, path := range []string{"/v1/chat/completions", "/internal"} {
+		if _, err := call(map[string]interface{}{"method": "POST", "path": path}); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument for %s without credentials, got %v", path, err)
+		}
+	}
+	if _, err := call(map[string]interface{}{"method": "GET", "path": "/internal/reindex"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for an unmapped method, got %v", err)
+	}
+
+	// Credentials take precedence over the default, and bad ones are not defaulted
+	decision, err = call(map[string]interface{}{"method": "POST", "path": "/internal/reindex", "tenant_id": "tenant-a"})
+	if err != nil {
+		t.Fatalf("Expected the explicit tenant to resolve, got %v", err)
+	}
+	if annotations, _ := decision["annotations"].(map[string]interface{}); annotations["tenant_defaulted"] != nil {
+		t.Errorf("Expected an explicit tenant not to be defaulted, got %v", decision)
+	}
+	if _, err := call(map[string]interface{}{
+		"method":  "POST",
+		"path":    "/internal/reindex",
+		"headers": map[string]interface{}{"X-API-Key": "key-x"},
+	}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated for an unknown API key on an internal route, got %v", err)
+	}
+
+	// The default tenant is resolved like any other
+	if _, err := call(map[string]interface{}{"method": "POST", "path": "/jobs/nightly"}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Expected PermissionDenied for an unknown default tenant, got %v", err)
+	}
+
+	if err := service.SetDefaultTenantRoutes([]modulehost.DefaultTenantRoute{{Path: "/internal/**"}}); err == nil {
+		t.Errorf("Expected a route without a tenant to be rejected")
+	}
+}
+
+func TestTenantOnboarding(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	configured := map[string]config.Tenant{"tenant-a": {Name: "Tenant A", APIKeys: []string{"key-a"}}}
+	template := config.Tenant{
+		Quotas:        config.TenantQuotas{RequestsPerHour: 100},
+		RateLimits:    []config.RateLimit{{Name: "api_requests", Limit: 20, Window: "1m"}},
+		AllowedModels: []string{"gpt-4o-mini"},
+		APIKeys:       []string{"template-key"},
+	}
+
+	storeConfig := config.TenantStoreConfig{
+		UnknownTenants: "onboard",
+		Template:       template,
+		OnboardingKeys: []string{tenants.HashAPIKey("onboarding-key")},
+		MaxOnboarded:   2,
+	}
+
+	// newService creates a module host resolving tenants from store; apiKey,
+	// if set, is sent in the API key header
+	newService := func(store tenants.TenantStore) func(tenantID, apiKey string) error {
+		service := modulehost.NewService(pipeline.NewPipeline(sugar), sugar)
+		service.SetTenantResolver(tenants.NewResolver(store, config.APIKeysConfig{}))
+		return func(tenantID, apiKey string) error {
+			fields := map[string]interface{}{"tenant_id": tenantID}
+			if apiKey != "" {
+				fields["headers"] = map[string]interface{}{"x-api-key": apiKey}
+			}
+			req, _ := structpb.NewStruct(fields)
+			_, err := service.ProcessRequest(ctx, req)
+			return err
+		}
+	}
+
+	t.Run("OnboardedFromTemplate", func(t *testing.T) {
+		var onboarded []string
+		store := tenants.NewOnboardingStore(tenants.NewConfigStore(configured), storeConfig, func(tenant *tenants.Tenant) {
+			onboarded = append(onboarded, tenant.ID)
+		})
+		call := newService(store)
+
+		for i := 0; i < 3; i++ {
+			if err := call("tenant-new", "onboarding-key"); err != nil {
+				t.Fatalf("Expected unknown tenant to be onboarded, got %v", err)
+			}
+		}
+		if err := call("tenant-a", ""); err != nil {
+			t.Fatalf("Expected configured tenant to resolve, got %v", err)
+		}
+		if len(onboarded) != 1 || onboarded[0] != "tenant-new" {
+			t.Fatalf("Expected tenant-new to be onboarded once, got %v", onboarded)
+		}
+
+		tenant, err := store.GetTenant(ctx, "tenant-new")
+		if err != nil {
+			t.Fatalf("Failed to get onboarded tenant: %v", err)
+		}
+		if tenant.Name != "tenant-new" || tenant.Quotas.RequestsPerHour != 100 || len(tenant.RateLimits) != 1 ||
+			len(tenant.AllowedModels) != 1 || tenant.AllowedModels[0] != "gpt-4o-mini" {
+			t.Errorf("Expected template to be applied, got %+v", tenant)
+		}
+		if len(tenant.APIKeys) != 0 {
+			t.Errorf("Expected template API keys to be dropped, got %v", tenant.APIKeys)
+		}
+		if _, err := store.ResolveByAPIKey(ctx, "template-key"); !errors.Is(err, tenants.ErrUnknownAPIKey) {
+			t.Errorf("Expected template API key not to resolve, got %v", err)
+		}
+
+		list, _ := store.ListTenants(ctx)
+		if len(list) != 2 || list[0].ID != "tenant-a" || list[1].ID != "tenant-new" {
+			t.Errorf("Expected onboarded tenant to be listed, got %+v", list)
+		}
+	})
+
+	t.Run("RequiresOnboardingKey", func(t *testing.T) {
+		store := tenants.NewOnboardingStore(tenants.NewConfigStore(configured), storeConfig, nil)
+		call := newService(store)
+
+		if err := call("tenant-new", ""); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("Expected PermissionDenied without credentials, got %v", err)
+		}
+		if err := call("tenant-new", "some-key"); status.Code(err) != codes.Unauthenticated {
+			t.Errorf("Expected Unauthenticated for a key that is not an onboarding key, got %v", err)
+		}
+		if err := call("tenant-a", "onboarding-key"); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("Expected the onboarding key not to authenticate a configured tenant, got %v", err)
+		}
+		if list, _ := store.ListTenants(ctx); len(list) != 1 {
+			t.Errorf("Expected nothing onboarded, got %+v", list)
+		}
+	})
+
+	t.Run("OnboardedTenantsCapped", func(t *testing.T) {
+		store := tenants.NewOnboardingStore(tenants.NewConfigStore(configured), storeConfig, nil)
+		call := newService(store)
+
+		for _, tenantID := range []string{"tenant-1", "tenant-2"} {
+			if err := call(tenantID, "onboarding-key"); err != nil {
+				t.Fatalf("Expected %s to be onboarded, got %v", tenantID, err)
+			}
+		}
+		if err := call("tenant-3", "onboarding-key"); status.Code(err) != codes.ResourceExhausted {
+			t.Errorf("Expected ResourceExhausted past max_onboarded, got %v", err)
+		}
+		if err := call("tenant-1", "onboarding-key"); err != nil {
+			t.Errorf("Expected an onboarded tenant to still resolve at the cap, got %v", err)
+		}
+	})
+
+	t.Run("RejectedWithoutOnboarding", func(t *testing.T) {
+		call := newService(tenants.NewConfigStore(configured))
+		if err := call("tenant-new", ""); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("Expected PermissionDenied for unknown tenant, got %v", err)
+		}
+	})
+}
+
+// mockTenantRows are the rows of the mock tenants table
+var mockTenantRows = map[string][]driver.Value{
+	"tenant-a": {"tenant-a", "Tenant A", "First tenant", `{"allowed_models": ["gpt-4o*"], "quotas": {"requests_per_hour": 500}}`},
+	"tenant-b": {"tenant-b", "Tenant B", "Second tenant", nil},
+}
+
+// mockTenantKeys maps API key hashes to tenant IDs
+var mockTenantKeys = map[string]string{
+	tenants.HashAPIKey("key-a"): "tenant-a",
+	tenants.HashAPIKey("key-b"): "tenant-b",
+}
+
+func init() {
+	sql.Register("mock-tenants", mockTenantDriver{})
+}
+
+// mockTenantQueries records the queries run against the mock tables
+var mockTenantQueries []string
+
+// openMockTenantDB opens a database answering the DBStore queries from the mock tables
+func openMockTenantDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("mock-tenants", "")
+	if err != nil {
+		t.Fatalf("Failed to open mock database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+type mockTenantDriver struct{}
+
+func (mockTenantDriver) Open(name string) (driver.Conn, error) { return mockTenantConn{}, nil }
+
+type mockTenantConn struct{}
+
+func (mockTenantConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepare not supported")
+}
+func (mockTenantConn) Close() error              { return nil }
+func (mockTenantConn) Begin() (driver.Tx, error) { return nil, errors.New("transactions not supported") }
+
+func (mockTenantConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	mockTenantQueries = append(mockTenantQueries, query)
+	var ids []string
+	switch {
+	case strings.Contains(query, "tenant_api_keys"):
+		if id, ok := mockTenantKeys[args[0].Value.(string)]; ok {
+			ids = append(ids, id)
+		}
+	case strings.Contains(query, "WHERE t.id"):
+		if _, ok := mockTenantRows[args[0].Value.(string)]; ok {
+			ids = append(ids, args[0].Value.(string))
+		}
+	default:
+		for id := range mockTenantRows {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+	}
+
+	rows := &mockTenantResult{}
+	for _, id := range ids {
+		rows.rows = append(rows.rows, mockTenantRows[id])
+	}
+	return rows, nil
+}
+
+type mockTenantResult struct {
+	rows [][]driver.Value
+}
+
+func (r *mockTenantResult) Columns() []string {
+	return []string{"id", "name", "description", "settings"}
+}
+func (r *mockTenantResult) Close() error { return nil }
+
+func (r *mockTenantResult) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -0,0 +1,174 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/gatewayerrors"
+	"github.com/bendiamant/leash-gateway/internal/metrics"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"github.com/bendiamant/leash-gateway/internal/providers"
+	"github.com/bendiamant/leash-gateway/internal/providers/base"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+func TestTimeoutClassification(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+	registry := metrics.NewRegistry()
+
+	t.Run("ProviderTimeout", func(t *testing.T) {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+		}))
+		defer upstream.Close()
+
+		providerRegistry := providers.NewRegistry(sugar)
+		providerRegistry.SetMetrics(registry)
+		if err := providerRegistry.InitializeFromConfig(map[string]*base.ProviderConfig{
+			"openai": {
+				Type:     "openai",
+				Endpoint: upstream.URL,
+				Timeout:  50 * time.Millisecond,
+				CircuitBreaker: base.CircuitBreakerConfig{
+					FailureThreshold: 5,
+					Timeout:          time.Minute,
+				},
+				Models: []base.ModelConfig{{Name: "gpt-4o-mini"}},
+			},
+		}); err != nil {
+			t.Fatalf("Failed to initialize providers: %v", err)
+		}
+		defer providerRegistry.Shutdown()
+
+		_, err := providerRegistry.RouteRequest(ctx, &base.ProviderRequest{
+			RequestID: "timeout-provider",
+			Model:     "gpt-4o-mini",
+			Messages:  []base.Message{{Role: "user", Content: "hi"}},
+		})
+		if err == nil {
+			t.Fatal("Expected provider call to time out")
+		}
+		if errorType := gatewayerrors.Classify(err); errorType != gatewayerrors.ErrorTypeProviderTimeout {
+			t.Fatalf("Expected %s, got %s (%v)", gatewayerrors.ErrorTypeProviderTimeout, errorType, err)
+		}
+
+		if count := testutil.ToFloat64(registry.ProviderErrors.WithLabelValues("openai", "gpt-4o-mini", "provider_timeout")); count != 1 {
+			t.Errorf("Expected 1 provider timeout, got %v", count)
+		}
+	})
+
+	t.Run("ModuleTimeout", func(t *testing.T) {
+		slow := newStubModule("slow-policy", interfaces.ModuleTypePolicy)
+		slow.delay = time.Second
+		slow.timeout = 20 * time.Millisecond
+
+		modulePipeline := pipeline.NewPipeline(sugar)
+		modulePipeline.SetMetrics(registry)
+		modulePipeline.AddModule(slow)
+
+		result, err := modulePipeline.ProcessRequest(ctx, &interfaces.ProcessRequestContext{
+			RequestID: "timeout-module",
+			TenantID:  "tenant-a",
+		})
+		if err != nil {
+			t.Fatalf("Pipeline processing failed: %v", err)
+		}
+		if result.Action != interfaces.ActionBlock {
+			t.Errorf("Expected timed out policy to fail closed, got %s", result.Action)
+		}
+
+		if count := testutil.ToFloat64(registry.ModuleErrors.WithLabelValues("slow-policy", "policy", "tenant-a", "module_timeout")); count != 1 {
+			t.Errorf("Expected 1 module timeout, got %v", count)
+		}
+		if count := testutil.ToFloat64(registry.ProviderErrors.WithLabelValues("openai", "gpt-4o-mini", "module_timeout")); count != 0 {
+			t.Errorf("Module timeout must not count as a provider error, got %v", count)
+		}
+	})
+}
+
+func TestModuleTimeoutModes(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	// run sends a request through a pipeline with a module that times out
+	// (or fails), followed by a policy that records whether it ran
+	run := func(t *testing.T, moduleType interfaces.ModuleType, err error, modes map[string]pipeline.TimeoutMode) (*interfaces.ProcessRequestResult, *stubModule) {
+		t.Helper()
+		failing := newStubModule("failing-module", moduleType)
+		if err != nil {
+			failing.err = err
+		} else {
+			failing.delay = time.Second
+			failing.timeout = 20 * time.Millisecond
+		}
+		next := newStubModule("next-policy", interfaces.ModuleTypePolicy)
+		next.priority = 200
+
+		p := pipeline.NewPipeline(sugar)
+		p.SetTimeoutModes(modes)
+		p.AddModule(failing)
+		p.AddModule(next)
+
+		result, runErr := p.ProcessRequest(ctx, &interfaces.ProcessRequestContext{RequestID: "timeout-mode", TenantID: "tenant-a"})
+		if runErr != nil {
+			t.Fatalf("Pipeline processing failed: %v", runErr)
+		}
+		return result, next
+	}
+	failOpen := map[string]pipeline.TimeoutMode{"failing-module": pipeline.TimeoutFailOpen}
+	failClosed := map[string]pipeline.TimeoutMode{"failing-module": pipeline.TimeoutFailClosed}
+
+	t.Run("PolicyFailsClosedByDefault", func(t *testing.T) {
+		if result, _ := run(t, interfaces.ModuleTypePolicy, nil, nil); result.Action != interfaces.ActionBlock {
+			t.Errorf("Expected a timed-out policy to block, got %s", result.Action)
+		}
+	})
+
+	t.Run("PolicyConfiguredFailOpen", func(t *testing.T) {
+		result, next := run(t, interfaces.ModuleTypePolicy, nil, failOpen)
+		if result.Action != interfaces.ActionContinue {
+			t.Errorf("Expected a fail-open policy timeout to continue, got %s (%s)", result.Action, result.BlockReason)
+		}
+		if next.calls != 1 {
+			t.Errorf("Expected the following policy to run, got %d calls", next.calls)
+		}
+	})
+
+	t.Run("FailOpenOnlyCoversTimeouts", func(t *testing.T) {
+		if result, _ := run(t, interfaces.ModuleTypePolicy, errors.New("policy store unavailable"), failOpen); result.Action != interfaces.ActionBlock {
+			t.Errorf("Expected other policy errors to still block, got %s", result.Action)
+		}
+	})
+
+	t.Run("InspectorFailsOpenByDefault", func(t *testing.T) {
+		if result, _ := run(t, interfaces.ModuleTypeInspector, nil, nil); result.Action != interfaces.ActionContinue {
+			t.Errorf("Expected a timed-out inspector to be skipped, got %s", result.Action)
+		}
+	})
+
+	t.Run("InspectorConfiguredFailClosed", func(t *testing.T) {
+		result, next := run(t, interfaces.ModuleTypeInspector, nil, failClosed)
+		if result.Action != interfaces.ActionBlock || !strings.Contains(result.BlockReason, "failing-module") {
+			t.Errorf("Expected a fail-closed inspector timeout to block, got %s (%s)", result.Action, result.BlockReason)
+		}
+		if next.calls != 0 {
+			t.Errorf("Expected no policy to run after the block, got %d calls", next.calls)
+		}
+	})
+}
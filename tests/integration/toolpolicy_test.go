@@ -0,0 +1,128 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bendiamant/leash-gateway/internal/modules/core/toolpolicy"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"go.uber.org/zap"
+)
+
+func TestToolPolicy(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	tp := toolpolicy.NewToolPolicy(sugar)
+	config := &interfaces.ModuleConfig{
+		Name: "tool-policy",
+		Config: map[string]interface{}{
+			"tenants": map[string]interface{}{
+				"acme": map[string]interface{}{
+					"denied_tools": []interface{}{"delete_user", "drop_*"},
+				},
+				"locked": map[string]interface{}{
+					"allowed_tools": []interface{}{"get_weather", "web_search"},
+				},
+			},
+		},
+	}
+	if err := tp.ValidateConfig(config); err != nil {
+		t.Fatalf("Invalid config: %v", err)
+	}
+	if err := tp.Initialize(ctx, config); err != nil {
+		t.Fatalf("Failed to initialize tool policy: %v", err)
+	}
+	tp.Start(ctx)
+
+	process := func(t *testing.T, tenantID, body string) *interfaces.ProcessRequestResult {
+		t.Helper()
+		result, err := tp.ProcessRequest(ctx, &interfaces.ProcessRequestContext{
+			RequestID: "tool-" + tenantID,
+			TenantID:  tenantID,
+			Body:      []byte(body),
+		})
+		if err != nil {
+			t.Fatalf("Tool policy failed: %v", err)
+		}
+		return result
+	}
+
+	t.Run("DeniedToolBlocked", func(t *testing.T) {
+		result := process(t, "acme", `{"model": "gpt-4o", "messages": [{"role": "user", "content": "hi"}],
+			"tools": [
+				{"type": "function", "function": {"name": "get_weather", "parameters": {}}},
+				{"type": "function", "function": {"name": "delete_user", "parameters": {}}}
+			]}`)
+		if result.Action != interfaces.ActionBlock {
+			t.Fatalf("Expected a request declaring delete_user to be blocked, got %v", result.Action)
+		}
+		if result.BlockReason != "tool delete_user is denied for tenant acme" {
+			t.Errorf("Unexpected block reason: %s", result.BlockReason)
+		}
+		if denied, _ := result.Annotations["denied_tools"].([]string); len(denied) != 1 || denied[0] != "delete_user" {
+			t.Errorf("Expected delete_user annotated as denied, got %v", result.Annotations["denied_tools"])
+		}
+	})
+
+	t.Run("AllowedToolsPass", func(t *testing.T) {
+		result := process(t, "acme", `{"model": "gpt-4o", "messages": [{"role": "user", "content": "hi"}],
+			"tools": [{"type": "function", "function": {"name": "get_weather", "parameters": {}}}]}`)
+		if result.Action != interfaces.ActionContinue {
+			t.Fatalf("Expected a request with only allowed tools to pass, got %v: %s", result.Action, result.BlockReason)
+		}
+		if result.Annotations["tool_policy_checked"] != true {
+			t.Errorf("Expected the request annotated as checked, got %v", result.Annotations)
+		}
+	})
+
+	t.Run("GlobAndLegacyFunctions", func(t *testing.T) {
+		result := process(t, "acme", `{"model": "gpt-4o", "messages": [{"role": "user", "content": "hi"}],
+			"functions": [{"name": "drop_table", "parameters": {}}]}`)
+		if result.Action != interfaces.ActionBlock {
+			t.Errorf("Expected a legacy function matching drop_* to be blocked, got %v", result.Action)
+		}
+	})
+
+	t.Run("AllowList", func(t *testing.T) {
+		// Responses API declares function names at the top level and
+		// built-in tools by type
+		result := process(t, "locked", `{"model": "gpt-4o", "input": "hi",
+			"tools": [{"type": "function", "name": "get_weather"}, {"type": "web_search"}]}`)
+		if result.Action != interfaces.ActionContinue {
+			t.Errorf("Expected allow-listed tools to pass, got %v: %s", result.Action, result.BlockReason)
+		}
+
+		// Anthropic tools carry a name and input_schema
+		result = process(t, "locked", `{"model": "claude-3-5-sonnet", "max_tokens": 10, "messages": [{"role": "user", "content": "hi"}],
+			"tools": [{"name": "send_email", "input_schema": {"type": "object"}}]}`)
+		if result.Action != interfaces.ActionBlock || result.BlockReason != "tool send_email is not in the allowed tools for tenant locked" {
+			t.Errorf("Expected a tool outside the allow list to be blocked, got %v: %s", result.Action, result.BlockReason)
+		}
+	})
+
+	t.Run("NoToolsPass", func(t *testing.T) {
+		if result := process(t, "locked", `{"model": "gpt-4o", "messages": [{"role": "user", "content": "hi"}]}`); result.Action != interfaces.ActionContinue {
+			t.Errorf("Expected a request without tools to pass, got %v", result.Action)
+		}
+		if allowed, _ := tp.IsToolAllowed("other", "delete_user"); !allowed {
+			t.Error("Expected tenants without rules to fall back to the permissive default")
+		}
+	})
+
+	t.Run("InvalidPatternRejected", func(t *testing.T) {
+		err := tp.ValidateConfig(&interfaces.ModuleConfig{
+			Name: "tool-policy",
+			Config: map[string]interface{}{
+				"default": map[string]interface{}{"denied_tools": []interface{}{"delete_["}},
+			},
+		})
+		if err == nil {
+			t.Error("Expected an invalid glob to be rejected")
+		}
+	})
+}
@@ -0,0 +1,152 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bendiamant/leash-gateway/internal/config"
+	"github.com/bendiamant/leash-gateway/internal/modules/core/contextwindow"
+	"github.com/bendiamant/leash-gateway/internal/modules/interface"
+	"github.com/bendiamant/leash-gateway/internal/modules/pipeline"
+	"github.com/bendiamant/leash-gateway/internal/modules/registry"
+	"github.com/bendiamant/leash-gateway/internal/selftest"
+	"github.com/bendiamant/leash-gateway/internal/tokens"
+	"go.uber.org/zap"
+)
+
+// warmupStub is a stub module whose warmup blocks until released and then
+// returns err
+type warmupStub struct {
+	*stubModule
+	release chan struct{}
+	err     error
+}
+
+func (s *warmupStub) Warmup(ctx context.Context) error {
+	<-s.release
+	return s.err
+}
+
+func TestModuleWarmup(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+
+	t.Run("ReadyOnlyAfterWarmup", func(t *testing.T) {
+		// The tokenizer is expensive: it loads only once released
+		var loads atomic.Int32
+		release := make(chan struct{})
+		counter := tokens.NewCounter()
+		if err := counter.Register("known-*", func() (tokens.Tokenizer, error) {
+			<-release
+			loads.Add(1)
+			return wordTokenizer{}, nil
+		}); err != nil {
+			t.Fatalf("Failed to register tokenizer: %v", err)
+		}
+
+		window := contextwindow.NewContextWindow(sugar)
+		window.SetTokenCounter(counter)
+		if err := window.Initialize(ctx, &interfaces.ModuleConfig{
+			Name: "context-window", Type: "policy", Enabled: true,
+			Config: map[string]interface{}{
+				"context_windows": map[string]interface{}{
+					"local": map[string]interface{}{"known-model": 1000},
+				},
+			},
+		}); err != nil {
+			t.Fatalf("Failed to initialize context window: %v", err)
+		}
+		window.Start(ctx)
+
+		moduleRegistry := registry.NewModuleRegistry(sugar)
+		if err := moduleRegistry.Register(window); err != nil {
+			t.Fatalf("Failed to register module: %v", err)
+		}
+		if err := moduleRegistry.Register(newStubModule("plain", interfaces.ModuleTypeInspector)); err != nil {
+			t.Fatalf("Failed to register module: %v", err)
+		}
+		runner := selftest.NewRunner(nil, nil, config.SelfTestConfig{}, sugar)
+		runner.SetWarmup(moduleRegistry)
+		if status := readyStatus(runner); status != http.StatusServiceUnavailable {
+			t.Fatalf("Expected not ready before warmup started, got %d", status)
+		}
+
+		warmed := make(chan *registry.WarmupReport)
+		go func() { warmed <- moduleRegistry.Warmup(ctx) }()
+
+		// Warmup is under way but the tokenizer has not loaded yet
+		deadline := time.Now().Add(time.Second)
+		for len(moduleRegistry.WarmupStatus().Pending) == 0 && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if status := moduleRegistry.WarmupStatus(); status.Done || len(status.Pending) != 1 || status.Pending[0] != "context-window" {
+			t.Fatalf("Expected context-window pending, got %+v", status)
+		}
+		if status := readyStatus(runner); status != http.StatusServiceUnavailable {
+			t.Fatalf("Expected not ready during warmup, got %d", status)
+		}
+
+		close(release)
+		report := <-warmed
+		if !report.Done || len(report.Failed) != 0 || len(report.Pending) != 0 {
+			t.Fatalf("Expected warmup to complete cleanly, got %+v", report)
+		}
+		if loads.Load() != 1 {
+			t.Fatalf("Expected the tokenizer loaded by warmup, got %d loads", loads.Load())
+		}
+		if status := readyStatus(runner); status != http.StatusOK {
+			t.Fatalf("Expected ready after warmup, got %d", status)
+		}
+
+		// The first request finds the tokenizer loaded
+		modulePipeline := pipeline.NewPipeline(sugar)
+		modulePipeline.AddModule(window)
+		req := &interfaces.ProcessRequestContext{
+			RequestID: "first",
+			Provider:  "local",
+			Model:     "known-model",
+			Body:      []byte(`{"messages":[{"role":"user","content":"tokenizers count differently from chars"}]}`),
+		}
+		if _, err := modulePipeline.ProcessRequest(ctx, req); err != nil {
+			t.Fatalf("First request failed: %v", err)
+		}
+		if req.Annotations["context_estimated_tokens"] != 5 || loads.Load() != 1 {
+			t.Errorf("Expected the warmed tokenizer's count without another load, got %v after %d loads",
+				req.Annotations["context_estimated_tokens"], loads.Load())
+		}
+	})
+
+	t.Run("FailedOrSlowWarmupDoesNotHoldReadiness", func(t *testing.T) {
+		failing := &warmupStub{stubModule: newStubModule("failing", interfaces.ModuleTypeInspector), release: make(chan struct{}), err: errors.New("model file missing")}
+		stuck := &warmupStub{stubModule: newStubModule("stuck", interfaces.ModuleTypeInspector), release: make(chan struct{})}
+		defer close(stuck.release)
+		close(failing.release)
+
+		moduleRegistry := registry.NewModuleRegistry(sugar)
+		moduleRegistry.Register(failing)
+		moduleRegistry.Register(stuck)
+		runner := selftest.NewRunner(nil, nil, config.SelfTestConfig{}, sugar)
+		runner.SetWarmup(moduleRegistry)
+
+		warmupCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		report := moduleRegistry.Warmup(warmupCtx)
+		if !report.Done {
+			t.Fatalf("Expected warmup to complete at its timeout, got %+v", report)
+		}
+		if report.Failed["failing"] != "model file missing" || report.Failed["stuck"] != "warmup timed out" {
+			t.Errorf("Expected the failure and the timeout reported, got %v", report.Failed)
+		}
+		if status := readyStatus(runner); status != http.StatusOK {
+			t.Errorf("Expected ready once warmup gave up, got %d", status)
+		}
+	})
+}